@@ -0,0 +1,117 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"unicode/utf8"
+)
+
+// RedactedValue replaces the value of redacted properties in formatted
+// payloads.
+const RedactedValue = "[redacted]"
+
+// PayloadFormatter formats raw JSON payloads for debug and trace logging.
+// Properties with a redacted name are replaced at any depth, and the result is
+// truncated to a byte budget.
+//
+// A nil *PayloadFormatter returns payloads unchanged.
+type PayloadFormatter struct {
+	maxSize int
+	redact  [][]byte
+}
+
+// NewPayloadFormatter returns a formatter that truncates payloads longer than
+// maxSize bytes, and replaces the values of properties named in redact. A
+// maxSize of zero means no truncation.
+func NewPayloadFormatter(maxSize int, redact []string) *PayloadFormatter {
+	f := &PayloadFormatter{maxSize: maxSize}
+	for _, name := range redact {
+		f.redact = append(f.redact, []byte(name))
+	}
+	return f
+}
+
+// Format returns the payload with redacted properties replaced, truncated to
+// the byte budget. A truncated payload is suffixed with the total length of
+// the payload. A payload that is not valid JSON is only truncated.
+func (f *PayloadFormatter) Format(payload []byte) string {
+	if f == nil {
+		return string(payload)
+	}
+	if f.shouldRedact(payload) {
+		payload = f.redactPayload(payload)
+	}
+	if f.maxSize <= 0 || len(payload) <= f.maxSize {
+		return string(payload)
+	}
+	// Avoid splitting a multi-byte character
+	i := f.maxSize
+	for i > 0 && !utf8.RuneStart(payload[i]) {
+		i--
+	}
+	return string(payload[:i]) + "…(" + strconv.Itoa(len(payload)) + " bytes)"
+}
+
+// shouldRedact reports whether the payload may contain a redacted property,
+// to avoid decoding payloads that does not.
+func (f *PayloadFormatter) shouldRedact(payload []byte) bool {
+	for _, name := range f.redact {
+		if bytes.Contains(payload, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactPayload decodes the payload and replaces the values of redacted
+// properties. The payload is returned unchanged if it is not valid JSON.
+func (f *PayloadFormatter) redactPayload(payload []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return payload
+	}
+	if !f.redactValue(v) {
+		return payload
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return payload
+	}
+	return out
+}
+
+// redactValue replaces the values of redacted properties in any object within
+// v, and reports whether any value was replaced.
+func (f *PayloadFormatter) redactValue(v interface{}) bool {
+	redacted := false
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, pv := range t {
+			if f.isRedacted(k) {
+				t[k] = RedactedValue
+				redacted = true
+			} else if f.redactValue(pv) {
+				redacted = true
+			}
+		}
+	case []interface{}:
+		for _, iv := range t {
+			if f.redactValue(iv) {
+				redacted = true
+			}
+		}
+	}
+	return redacted
+}
+
+func (f *PayloadFormatter) isRedacted(name string) bool {
+	for _, r := range f.redact {
+		if string(r) == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPayloadFormatterFormat(t *testing.T) {
+	tbl := []struct {
+		MaxSize  int
+		Redact   []string
+		Payload  string
+		Expected string
+	}{
+		// Truncation
+		{0, nil, `{"foo":"bar"}`, `{"foo":"bar"}`},
+		{13, nil, `{"foo":"bar"}`, `{"foo":"bar"}`},
+		{12, nil, `{"foo":"bar"}`, `{"foo":"bar"…(13 bytes)`},
+		{4, nil, `{"foo":"bar"}`, `{"fo…(13 bytes)`},
+		{7, nil, `{"a":"åäö"}`, `{"a":"…(14 bytes)`},
+		{8, nil, `{"a":"åäö"}`, `{"a":"å…(14 bytes)`},
+		{4, nil, `not json`, `not …(8 bytes)`},
+		// Redaction
+		{0, []string{"token"}, `{"token":"secret","foo":"bar"}`, `{"foo":"bar","token":"[redacted]"}`},
+		{0, []string{"token"}, `{"params":{"token":{"user":42}}}`, `{"params":{"token":"[redacted]"}}`},
+		{0, []string{"password"}, `{"params":[{"password":"secret"},{"name":"foo"}]}`, `{"params":[{"password":"[redacted]"},{"name":"foo"}]}`},
+		{0, []string{"token", "password"}, `{"token":1,"password":2}`, `{"password":"[redacted]","token":"[redacted]"}`},
+		{0, []string{"token"}, `{"foo":"token"}`, `{"foo":"token"}`},
+		{0, []string{"token"}, `{"foo":"bar"}`, `{"foo":"bar"}`},
+		{0, []string{"token"}, `{"token":"secret"`, `{"token":"secret"`},
+		{0, []string{"amount"}, `{"amount":1.50,"n":12345678901234567890}`, `{"amount":"[redacted]","n":12345678901234567890}`},
+		// Redaction and truncation
+		{20, []string{"token"}, `{"token":"secret","foo":"bar"}`, `{"foo":"bar","token"…(34 bytes)`},
+	}
+
+	for i, l := range tbl {
+		f := NewPayloadFormatter(l.MaxSize, l.Redact)
+		if got := f.Format([]byte(l.Payload)); got != l.Expected {
+			t.Errorf("expected Format(%s) to return:\n%s\nbut got:\n%s\nin test %d", l.Payload, l.Expected, got, i+1)
+		}
+	}
+}
+
+func TestPayloadFormatterFormat_NilFormatter_ReturnsPayload(t *testing.T) {
+	var f *PayloadFormatter
+	payload := `{"token":"secret"}`
+	if got := f.Format([]byte(payload)); got != payload {
+		t.Errorf("expected Format to return %s, but got %s", payload, got)
+	}
+}
+
+func BenchmarkPayloadFormatterFormat_Truncate(b *testing.B) {
+	f := NewPayloadFormatter(4096, nil)
+	payload := []byte(`{"data":"` + strings.Repeat("x", 1<<20) + `"}`)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Format(payload)
+	}
+}
+
+func BenchmarkPayloadFormatterFormat_Redact(b *testing.B) {
+	f := NewPayloadFormatter(4096, []string{"token"})
+	payload := []byte(`{"token":"secret","params":{"foo":"bar","baz":[1,2,3]}}`)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Format(payload)
+	}
+}
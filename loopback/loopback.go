@@ -0,0 +1,320 @@
+// Package loopback provides an in-process messaging client, implementing the
+// mq.Client interface without a NATS server.
+package loopback
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/resgateio/resgate/server/mq"
+)
+
+// DefaultRequestTimeout is the request timeout used if none is set.
+const DefaultRequestTimeout = 3 * time.Second
+
+// inboxPrefix is the subject prefix of request reply subjects.
+const inboxPrefix = "_INBOX."
+
+// ErrClosed is the error returned when using a client that is not connected.
+var ErrClosed = errors.New("loopback: connection closed")
+
+// Client is an in-process messaging client. Messages published on the client
+// are delivered to the subscriptions made on the same client, allowing
+// resgate to be embedded together with services in a single process, or
+// tested, where no NATS server is available.
+//
+// Services handle requests by subscribing with SubscribeRequests, and
+// respond by publishing on the reply subject. Events are sent by publishing
+// on the event subject.
+type Client struct {
+	// RequestTimeout is the time to wait for a response to a request. If
+	// zero, DefaultRequestTimeout is used.
+	RequestTimeout time.Duration
+
+	mu         sync.Mutex
+	connected  bool
+	subs       map[*Subscription]struct{}
+	reqs       map[string]*request // Pending requests by reply subject
+	inboxCount uint64
+
+	// Tasks calling subscription and response callbacks, handled in order by
+	// the worker goroutine
+	queue []func()
+	work  chan struct{}
+}
+
+// Subscription implements the mq.Unsubscriber interface.
+type Subscription struct {
+	c      *Client
+	tokens []string          // Tokens of the subscribed subject, with any wildcard
+	f      mq.Response       // Event callback, or nil for request subscriptions
+	h      mq.RequestHandler // Request callback, or nil for event subscriptions
+}
+
+type request struct {
+	f mq.Response
+	t *time.Timer
+}
+
+// Connect connects the client, starting the worker delivering messages.
+func (c *Client) Connect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connected {
+		return errors.New("loopback: already connected")
+	}
+	c.connected = true
+	c.subs = make(map[*Subscription]struct{})
+	c.reqs = make(map[string]*request)
+	c.queue = nil
+	c.work = make(chan struct{}, 1)
+	go c.worker(c.work)
+	return nil
+}
+
+// IsClosed tests if the client connection has been closed.
+func (c *Client) IsClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.connected
+}
+
+// Close closes the client connection. Pending requests, and messages not yet
+// handled, are dropped without any callback being called.
+func (c *Client) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		return
+	}
+	c.connected = false
+	for _, r := range c.reqs {
+		r.t.Stop()
+	}
+	c.reqs = nil
+	c.subs = nil
+	close(c.work)
+}
+
+// SetClosedHandler sets the handler when the connection is lost. As the
+// connection is never lost, the handler is never called.
+func (c *Client) SetClosedHandler(_ func(error)) {}
+
+// SendRequest sends a request to the subscriptions matching the subject.
+func (c *Client) SendRequest(subj string, payload []byte, cb mq.Response, requestHeaders map[string][]string) {
+	if !mq.IsValidSubject(subj) {
+		go cb("", nil, nil, mq.ErrInvalidSubject)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected {
+		go cb("", nil, nil, ErrClosed)
+		return
+	}
+	subs := c.matchingSubs(subj)
+	if len(subs) == 0 {
+		go cb("", nil, nil, mq.ErrNoResponders)
+		return
+	}
+
+	c.inboxCount++
+	inbox := inboxPrefix + strconv.FormatUint(c.inboxCount, 10)
+	c.reqs[inbox] = &request{
+		f: cb,
+		t: time.AfterFunc(c.requestTimeout(), func() { c.onTimeout(inbox) }),
+	}
+	c.deliver(subs, subj, inbox, payload)
+}
+
+// Publish sends a message to the subscriptions matching the subject. If the
+// subject is the reply subject of a pending request, the message is passed as
+// the response to the request.
+func (c *Client) Publish(subj string, payload []byte) error {
+	if !mq.IsValidSubject(subj) {
+		return mq.ErrInvalidSubject
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected {
+		return ErrClosed
+	}
+	if r, ok := c.reqs[subj]; ok {
+		c.respond(subj, r, payload)
+		return nil
+	}
+	c.deliver(c.matchingSubs(subj), subj, "", payload)
+	return nil
+}
+
+// Subscribe to all events on a resource namespace.
+// The namespace has the format "event."+resource
+func (c *Client) Subscribe(namespace string, cb mq.Response) (mq.Unsubscriber, error) {
+	if !mq.IsValidSubject(namespace) {
+		return nil, mq.ErrInvalidSubject
+	}
+	return c.subscribe(&Subscription{
+		c:      c,
+		tokens: append(strings.Split(namespace, "."), "*"),
+		f:      cb,
+	})
+}
+
+// SubscribeRequests subscribes to requests on a subject, calling cb with the
+// reply subject of each request.
+func (c *Client) SubscribeRequests(subject string, cb mq.RequestHandler) (mq.Unsubscriber, error) {
+	if !mq.IsValidSubject(subject) {
+		return nil, mq.ErrInvalidSubject
+	}
+	return c.subscribe(&Subscription{
+		c:      c,
+		tokens: strings.Split(subject, "."),
+		h:      cb,
+	})
+}
+
+func (c *Client) subscribe(s *Subscription) (mq.Unsubscriber, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected {
+		return nil, ErrClosed
+	}
+	c.subs[s] = struct{}{}
+	return s, nil
+}
+
+// Unsubscribe removes the subscription.
+func (s *Subscription) Unsubscribe() error {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	delete(s.c.subs, s)
+	return nil
+}
+
+// matchingSubs returns the subscriptions matching the subject.
+// Client mutex is held when called.
+func (c *Client) matchingSubs(subj string) []*Subscription {
+	var subs []*Subscription
+	tokens := strings.Split(subj, ".")
+	for s := range c.subs {
+		if matchTokens(s.tokens, tokens) {
+			subs = append(subs, s)
+		}
+	}
+	return subs
+}
+
+// matchTokens reports whether the subject tokens matches the subscribed
+// tokens, where a "*" token matches any single token.
+func matchTokens(pattern, tokens []string) bool {
+	if len(pattern) != len(tokens) {
+		return false
+	}
+	for i, t := range pattern {
+		if t != "*" && t != tokens[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// deliver enqueues a message to be passed to the subscriptions.
+// Client mutex is held when called.
+func (c *Client) deliver(subs []*Subscription, subj, reply string, payload []byte) {
+	for _, s := range subs {
+		s := s
+		c.enqueue(func() {
+			// Skip subscriptions unsubscribed since the message was published
+			c.mu.Lock()
+			_, ok := c.subs[s]
+			c.mu.Unlock()
+			if !ok {
+				return
+			}
+			if s.h != nil {
+				s.h(subj, reply, payload)
+			} else {
+				s.f(subj, payload, nil, nil)
+			}
+		})
+	}
+}
+
+// respond handles a response, or a meta response, to a pending request.
+// Client mutex is held when called.
+func (c *Client) respond(inbox string, r *request, payload []byte) {
+	// Is the first character a-z or A-Z?
+	// Then it is a meta response
+	if len(payload) > 0 && (payload[0]|32) >= 'a' && (payload[0]|32) <= 'z' {
+		if v, ok := reflect.StructTag(payload).Lookup("timeout"); ok {
+			if timeout, err := strconv.Atoi(v); err == nil && r.t.Stop() {
+				r.t = time.AfterFunc(time.Duration(timeout)*time.Millisecond, func() { c.onTimeout(inbox) })
+			}
+		}
+		return
+	}
+	r.t.Stop()
+	delete(c.reqs, inbox)
+	c.enqueue(func() {
+		r.f(inbox, payload, nil, nil)
+	})
+}
+
+func (c *Client) onTimeout(inbox string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r, ok := c.reqs[inbox]
+	if !ok {
+		return
+	}
+	delete(c.reqs, inbox)
+	c.enqueue(func() {
+		r.f("", nil, nil, mq.ErrRequestTimeout)
+	})
+}
+
+func (c *Client) requestTimeout() time.Duration {
+	if c.RequestTimeout == 0 {
+		return DefaultRequestTimeout
+	}
+	return c.RequestTimeout
+}
+
+// enqueue adds a task to be handled by the worker.
+// Client mutex is held when called.
+func (c *Client) enqueue(f func()) {
+	c.queue = append(c.queue, f)
+	if len(c.queue) == 1 {
+		select {
+		case c.work <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// worker handles the queued tasks in order until the work channel is closed.
+func (c *Client) worker(work chan struct{}) {
+	for range work {
+		c.mu.Lock()
+		for len(c.queue) > 0 {
+			f := c.queue[0]
+			c.queue[0] = nil
+			c.queue = c.queue[1:]
+			c.mu.Unlock()
+			f()
+			c.mu.Lock()
+		}
+		c.mu.Unlock()
+	}
+}
@@ -0,0 +1,17 @@
+package loopback_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/loopback"
+	"github.com/resgateio/resgate/server/mq"
+	"github.com/resgateio/resgate/server/mq/mqtest"
+)
+
+func TestConformance(t *testing.T) {
+	mqtest.RunConformanceTests(t, func(t *testing.T) (mq.Client, mq.Client) {
+		c := &loopback.Client{RequestTimeout: 100 * time.Millisecond}
+		return c, c
+	})
+}
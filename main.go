@@ -14,6 +14,7 @@ import (
 	"github.com/resgateio/resgate/logger"
 	"github.com/resgateio/resgate/nats"
 	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
 )
 
 const (
@@ -26,6 +27,9 @@ const (
 
 	// DefaultRequestTimeout is the timeout duration for NATS requests in milliseconds.
 	DefaultRequestTimeout = 3000
+
+	// DefaultLogPayloadMaxSize is the maximum size in bytes of payloads written by trace logging.
+	DefaultLogPayloadMaxSize = 4096
 )
 
 var usageStr = `
@@ -54,6 +58,7 @@ Security Options:
         --tlscert <file>             HTTP server certificate file
         --tlskey <file>              Private key for HTTP server certificate
         --creds <file>               NATS User Credentials file
+        --nkey <file>                NATS NKey seed file
         --natscert <file>            NATS Client certificate file
         --natskey <file>             NATS Client certificate key file
         --natsrootca <file>          NATS Root CA file(s)
@@ -73,18 +78,65 @@ Configuration Documentation:         https://resgate.io/docs/get-started/configu
 
 // Config holds server configuration
 type Config struct {
-	NatsURL        string   `json:"natsUrl"`
-	NatsCreds      string   `json:"natsCreds"`
-	NatsTLSCert    string   `json:"natsCert"`
-	NatsTLSKey     string   `json:"natsKey"`
-	NatsRootCAs    []string `json:"natsRootCAs"`
-	RequestTimeout int      `json:"requestTimeout"`
-	BufferSize     int      `json:"bufferSize"`
-	Debug          bool     `json:"debug"`
-	Trace          bool     `json:"trace"`
+	NatsURL           string     `json:"natsUrl"`
+	NatsCreds         string     `json:"natsCreds"`
+	NatsNKeySeed      string     `json:"natsNKeySeed"`
+	NatsTLSCert       string     `json:"natsCert"`
+	NatsTLSKey        string     `json:"natsKey"`
+	NatsRootCAs       []string   `json:"natsRootCAs"`
+	RequestTimeout    int        `json:"requestTimeout"`
+	BufferSize        int        `json:"bufferSize"`
+	Upstreams         []Upstream `json:"upstreams"`
+	Debug             bool       `json:"debug"`
+	Trace             bool       `json:"trace"`
+	LogPayloadMaxSize int        `json:"logPayloadMaxSize"`
+	LogRedact         []string   `json:"logRedact"`
+
+	NatsServerName         string `json:"natsServerName"`
+	NatsInsecureSkipVerify bool   `json:"natsInsecureSkipVerify"`
+
+	RequestTimeoutOverrides map[string]int `json:"requestTimeoutOverrides"`
+
+	NatsMaxReconnects    int `json:"natsMaxReconnects"`
+	NatsReconnectWait    int `json:"natsReconnectWait"`
+	NatsReconnectJitter  int `json:"natsReconnectJitter"`
+	NatsReconnectBufSize int `json:"natsReconnectBufSize"`
+
+	NatsNoResponders      string `json:"natsNoResponders"`
+	NatsNoRespondersRetry int    `json:"natsNoRespondersRetry"`
+
+	NatsConnectionName string `json:"natsConnectionName"`
+	NatsInboxPrefix    string `json:"natsInboxPrefix"`
+	NatsNoEcho         bool   `json:"natsNoEcho"`
+
+	JetStreamConsumers []JetStreamConsumer `json:"jetStreamConsumers"`
+
+	SubjectPrefixes []SubjectPrefix `json:"subjectPrefixes"`
 	server.Config
 }
 
+// Upstream holds the configuration of an upstream NATS server, handling
+// resources matching a resource pattern.
+type Upstream struct {
+	NatsURL string `json:"natsUrl"`
+	Pattern string `json:"pattern"`
+}
+
+// JetStreamConsumer holds the configuration of a durable JetStream consumer,
+// used as source of events with subjects matching a subject.
+type JetStreamConsumer struct {
+	Stream   string `json:"stream"`
+	Subject  string `json:"subject"`
+	Consumer string `json:"consumer"`
+}
+
+// SubjectPrefix holds the configuration of a prefix added to the NATS
+// subjects for resources matching a resource pattern.
+type SubjectPrefix struct {
+	Prefix  string `json:"prefix"`
+	Pattern string `json:"pattern"`
+}
+
 // StringSlice is a slice of strings implementing the flag.Value interface.
 type StringSlice []string
 
@@ -112,9 +164,27 @@ func (c *Config) SetDefault() {
 	if c.NatsRootCAs == nil {
 		c.NatsRootCAs = []string{}
 	}
+	if c.Upstreams == nil {
+		c.Upstreams = []Upstream{}
+	}
+	if c.JetStreamConsumers == nil {
+		c.JetStreamConsumers = []JetStreamConsumer{}
+	}
+	if c.SubjectPrefixes == nil {
+		c.SubjectPrefixes = []SubjectPrefix{}
+	}
 	if c.BufferSize == 0 {
 		c.BufferSize = 8192
 	}
+	if c.NatsNoResponders == "" {
+		c.NatsNoResponders = "notFound"
+	}
+	if c.LogPayloadMaxSize == 0 {
+		c.LogPayloadMaxSize = DefaultLogPayloadMaxSize
+	}
+	if c.LogRedact == nil {
+		c.LogRedact = []string{}
+	}
 	c.Config.SetDefault()
 }
 
@@ -162,6 +232,7 @@ func (c *Config) Init(fs *flag.FlagSet, args []string) {
 	fs.IntVar(&c.RequestTimeout, "r", 0, "Timeout in milliseconds for NATS requests.")
 	fs.IntVar(&c.RequestTimeout, "reqtimeout", 0, "Timeout in milliseconds for NATS requests.")
 	fs.StringVar(&c.NatsCreds, "creds", "", "NATS User Credentials file.")
+	fs.StringVar(&c.NatsNKeySeed, "nkey", "", "NATS NKey seed file.")
 	fs.StringVar(&c.NatsTLSCert, "natscert", "", "NATS Client certificate file.")
 	fs.StringVar(&c.NatsTLSKey, "natskey", "", "NATS Client certificate key file.")
 	fs.Var(&natsRootCAs, "natsrootca", "NATS Root CA file(s).")
@@ -310,26 +381,75 @@ func main() {
 	cfg.Init(fs, os.Args[1:])
 
 	l := logger.NewStdLogger(cfg.Debug, cfg.Trace)
+	if cfg.LogPayloadMaxSize < 0 {
+		printAndDie(fmt.Sprintf("Invalid logPayloadMaxSize setting (%d): must be a positive number of bytes", cfg.LogPayloadMaxSize), false)
+	}
+	redact := cfg.LogRedact
+	if len(cfg.AuthQueryParams) > 0 {
+		// Mask the connection URL query parameters included in auth requests
+		redact = append(redact, "queryParams")
+	}
+	pf := logger.NewPayloadFormatter(cfg.LogPayloadMaxSize, redact)
 
 	// Remove below if clause after release of version >= 1.3.x
 	if cfg.RequestTimeout <= 10 {
 		fmt.Fprintf(os.Stderr, "[DEPRECATED] Request timeout should be in milliseconds.\nChange your requestTimeout from %d to %d, and you won't be bothered anymore.\n", cfg.RequestTimeout, cfg.RequestTimeout*1000)
 		cfg.RequestTimeout *= 1000
 	}
-	serv, err := server.NewService(&nats.Client{
-		URL:            cfg.NatsURL,
-		Creds:          cfg.NatsCreds,
-		ClientCert:     cfg.NatsTLSCert,
-		ClientKey:      cfg.NatsTLSKey,
-		RootCAs:        cfg.NatsRootCAs,
-		RequestTimeout: time.Duration(cfg.RequestTimeout) * time.Millisecond,
-		BufferSize:     cfg.BufferSize,
-		Logger:         l,
-	}, cfg.Config)
+	mq := &nats.Client{
+		URL:              cfg.NatsURL,
+		Creds:            cfg.NatsCreds,
+		NKeySeed:         cfg.NatsNKeySeed,
+		ClientCert:       cfg.NatsTLSCert,
+		ClientKey:        cfg.NatsTLSKey,
+		RootCAs:          cfg.NatsRootCAs,
+		RequestTimeout:   time.Duration(cfg.RequestTimeout) * time.Millisecond,
+		BufferSize:       cfg.BufferSize,
+		Logger:           l,
+		PayloadFormatter: pf,
+	}
+	mq.TLSServerName = cfg.NatsServerName
+	mq.TLSInsecureSkipVerify = cfg.NatsInsecureSkipVerify
+	if len(cfg.RequestTimeoutOverrides) > 0 {
+		overrides := make(map[string]time.Duration, len(cfg.RequestTimeoutOverrides))
+		for p, ms := range cfg.RequestTimeoutOverrides {
+			overrides[p] = time.Duration(ms) * time.Millisecond
+		}
+		mq.SetRequestTimeoutOverrides(overrides)
+	}
+	mq.MaxReconnects = cfg.NatsMaxReconnects
+	mq.ReconnectWait = time.Duration(cfg.NatsReconnectWait) * time.Millisecond
+	mq.ReconnectJitter = time.Duration(cfg.NatsReconnectJitter) * time.Millisecond
+	mq.ReconnectBufSize = cfg.NatsReconnectBufSize
+	switch cfg.NatsNoResponders {
+	case "notFound":
+	case "serviceUnavailable":
+		mq.NoRespondersError = reserr.ErrServiceUnavailable
+	default:
+		printAndDie(fmt.Sprintf("Invalid natsNoResponders setting (%s): must be notFound or serviceUnavailable", cfg.NatsNoResponders), false)
+	}
+	if cfg.NatsNoRespondersRetry < 0 {
+		printAndDie(fmt.Sprintf("Invalid natsNoRespondersRetry setting (%d): must be zero or a positive number of milliseconds", cfg.NatsNoRespondersRetry), false)
+	}
+	mq.NoRespondersRetry = time.Duration(cfg.NatsNoRespondersRetry) * time.Millisecond
+	mq.InboxPrefix = cfg.NatsInboxPrefix
+	mq.NoEcho = cfg.NatsNoEcho
+	for _, u := range cfg.Upstreams {
+		mq.WithUpstream(u.NatsURL, u.Pattern)
+	}
+	for _, jc := range cfg.JetStreamConsumers {
+		mq.WithJetStreamConsumer(jc.Stream, jc.Subject, jc.Consumer)
+	}
+	for _, sp := range cfg.SubjectPrefixes {
+		mq.WithSubjectPrefix(sp.Prefix, sp.Pattern)
+	}
+	serv, err := server.NewService(mq, cfg.Config)
 	if err != nil {
 		printAndDie(fmt.Sprintf("Failed to initialize server: %s", err.Error()), false)
 	}
 	serv.SetLogger(l)
+	serv.SetPayloadFormatter(pf)
+	mq.Name = connectionName(cfg.NatsConnectionName, serv.InstanceID())
 
 	if err := serv.Start(); err != nil {
 		printAndDie(fmt.Sprintf("Failed to start server: %s", err.Error()), false)
@@ -342,11 +462,21 @@ func main() {
 		syscall.SIGTERM,
 		syscall.SIGQUIT)
 
-	select {
-	case <-stop:
-	case err := <-serv.StopChannel():
-		if err != nil {
-			printAndDie(fmt.Sprintf("Server stopped with an error: %s", err.Error()), false)
+	// SIGHUP reloads the NATS credentials, if set, instead of stopping
+	reload := cfg.NatsCreds != "" || cfg.NatsNKeySeed != ""
+	for wait := true; wait; {
+		select {
+		case sig := <-stop:
+			if reload && sig == syscall.SIGHUP {
+				_ = mq.ReloadCredentials()
+				continue
+			}
+			wait = false
+		case err := <-serv.StopChannel():
+			if err != nil {
+				printAndDie(fmt.Sprintf("Server stopped with an error: %s", err.Error()), false)
+			}
+			wait = false
 		}
 	}
 	// Await for waitGroup to be done
@@ -362,3 +492,13 @@ func main() {
 		panic("Shutdown timed out")
 	}
 }
+
+// connectionName returns the NATS connection name, replacing {hostname}
+// with the host name, and {instanceId} with the instance ID.
+func connectionName(name string, instanceID string) string {
+	if strings.Contains(name, "{hostname}") {
+		hostname, _ := os.Hostname()
+		name = strings.ReplaceAll(name, "{hostname}", hostname)
+	}
+	return strings.ReplaceAll(name, "{instanceId}", instanceID)
+}
@@ -19,6 +19,76 @@ var (
 		Name:      "subscriptions",
 		Help:      "Number of subscriptions per sanitized name",
 	}, []string{"name"})
+	// CacheRetentionPendingTimers number of pending unsubscribe delay timers
+	CacheRetentionPendingTimers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "resgate",
+		Subsystem: "cache",
+		Name:      "retention_pending_timers",
+		Help:      "Number of pending unsubscribe delay timers",
+	})
+	// CacheRetainedEntries number of cached resources retained without subscribers
+	CacheRetainedEntries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "resgate",
+		Subsystem: "cache",
+		Name:      "retained_entries",
+		Help:      "Number of cached resources retained without subscribers",
+	})
+	// CacheRetainedBytes estimated size of cached resources retained without subscribers
+	CacheRetainedBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "resgate",
+		Subsystem: "cache",
+		Name:      "retained_bytes",
+		Help:      "Estimated size in bytes of cached resources retained without subscribers",
+	})
+	// CacheRetentionReused number of retained resources reused before expiry
+	CacheRetentionReused = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "resgate",
+		Subsystem: "cache",
+		Name:      "retention_reused_total",
+		Help:      "Number of retained resources reused before expiry",
+	})
+	// CacheRetentionExpired number of retained resources expired without reuse
+	CacheRetentionExpired = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "resgate",
+		Subsystem: "cache",
+		Name:      "retention_expired_total",
+		Help:      "Number of retained resources expired without reuse",
+	})
+	// CacheAccessHits number of access requests served from the shared access cache
+	CacheAccessHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "resgate",
+		Subsystem: "cache",
+		Name:      "access_hits_total",
+		Help:      "Number of access requests served from the shared access cache",
+	})
+	// CacheAccessMisses number of access requests not found in the shared access cache
+	CacheAccessMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "resgate",
+		Subsystem: "cache",
+		Name:      "access_misses_total",
+		Help:      "Number of access requests not found in the shared access cache",
+	})
+	// CacheEventThrottleActivations number of times a resource has exceeded its event rate limit, per sanitized service name
+	CacheEventThrottleActivations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "resgate",
+		Subsystem: "cache",
+		Name:      "event_throttle_activations_total",
+		Help:      "Number of times a resource has exceeded its event rate limit, per sanitized service name",
+	}, []string{"prefix"})
+	// CacheTypeMismatches number of responses rejected for changing the type of a cached resource, per sanitized service name
+	CacheTypeMismatches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "resgate",
+		Subsystem: "cache",
+		Name:      "type_mismatches_total",
+		Help:      "Number of responses rejected for changing the type of a cached resource, per sanitized service name",
+	}, []string{"prefix"})
+	// MethodNotFoundCount number of method not found responses per sanitized request subject
+	MethodNotFoundCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "resgate",
+		Subsystem: "call",
+		Name:      "method_not_found_total",
+		Help:      "Number of method not found responses per sanitized request subject",
+	}, []string{"method"})
 	// NATSConnected status of NATS connection
 	NATSConnected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: "resgate",
@@ -26,6 +96,27 @@ var (
 		Name:      "connected",
 		Help:      "Status of NATS connection",
 	}, []string{"host"})
+	// NATSRequestsInFlight number of outstanding NATS requests when limited
+	NATSRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "resgate",
+		Subsystem: "nats",
+		Name:      "requests_in_flight",
+		Help:      "Number of outstanding NATS requests when limited",
+	})
+	// NATSRequestsQueued number of NATS requests queued by the request limit
+	NATSRequestsQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "resgate",
+		Subsystem: "nats",
+		Name:      "requests_queued",
+		Help:      "Number of NATS requests queued by the request limit",
+	})
+	// NATSRequestRetries number of timed out get and access requests retried, per subject prefix
+	NATSRequestRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "resgate",
+		Subsystem: "nats",
+		Name:      "request_retries_total",
+		Help:      "Number of timed out get and access requests retried, per subject prefix",
+	}, []string{"prefix"})
 	// WSStablishedConnections number of stablished websocket connections
 	WSStablishedConnections = prometheus.NewGauge(prometheus.GaugeOpts{
 		Namespace: "resgate",
@@ -33,13 +124,42 @@ var (
 		Name:      "stablished_connections",
 		Help:      "Number of stablished websocket connections",
 	})
+	// WSTaggedConnections number of stablished connections per connection tag and value
+	WSTaggedConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "resgate",
+		Subsystem: "ws",
+		Name:      "tagged_connections",
+		Help:      "Number of stablished connections per connection tag and value",
+	}, []string{"tag", "value"})
+	// WSDroppedTasks number of tasks dropped by disposing connections, per task category
+	WSDroppedTasks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "resgate",
+		Subsystem: "ws",
+		Name:      "dropped_tasks_total",
+		Help:      "Number of tasks dropped by disposing connections, per task category",
+	}, []string{"category"})
 )
 
 // RegisterMetrics register all the defined metrics so they can be populated and consumed.
 func RegisterMetrics() {
 	prometheus.MustRegister(SubcriptionsCount)
+	prometheus.MustRegister(CacheRetentionPendingTimers)
+	prometheus.MustRegister(CacheRetainedEntries)
+	prometheus.MustRegister(CacheRetainedBytes)
+	prometheus.MustRegister(CacheRetentionReused)
+	prometheus.MustRegister(CacheRetentionExpired)
+	prometheus.MustRegister(CacheAccessHits)
+	prometheus.MustRegister(CacheAccessMisses)
+	prometheus.MustRegister(CacheEventThrottleActivations)
+	prometheus.MustRegister(CacheTypeMismatches)
+	prometheus.MustRegister(MethodNotFoundCount)
 	prometheus.MustRegister(NATSConnected)
+	prometheus.MustRegister(NATSRequestsInFlight)
+	prometheus.MustRegister(NATSRequestsQueued)
+	prometheus.MustRegister(NATSRequestRetries)
 	prometheus.MustRegister(WSStablishedConnections)
+	prometheus.MustRegister(WSTaggedConnections)
+	prometheus.MustRegister(WSDroppedTasks)
 }
 
 func SanitizedString(s string) string {
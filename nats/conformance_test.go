@@ -0,0 +1,152 @@
+package nats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server/mq"
+	"github.com/resgateio/resgate/server/mq/mqtest"
+)
+
+// mockRouter is a mock NATS server routing published messages to the
+// matching subscriptions of all connections, and responding with a no
+// responders status message to requests without any matching subscription.
+type mockRouter struct {
+	mu   sync.Mutex
+	subs map[*routerConn]map[string]string // Subjects by sid, per connection
+}
+
+// routerConn is a connection to a mockRouter.
+type routerConn struct {
+	conn net.Conn
+	wmu  sync.Mutex
+}
+
+func newMockRouter(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	m := &mockRouter{subs: make(map[*routerConn]map[string]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			rc := &routerConn{conn: conn}
+			m.mu.Lock()
+			m.subs[rc] = make(map[string]string)
+			m.mu.Unlock()
+			go m.serve(rc)
+		}
+	}()
+	return "nats://" + ln.Addr().String()
+}
+
+func (m *mockRouter) serve(rc *routerConn) {
+	defer func() {
+		m.mu.Lock()
+		delete(m.subs, rc)
+		m.mu.Unlock()
+		rc.conn.Close()
+	}()
+	rc.write(mockInfo + "\r\n")
+	r := bufio.NewReader(rc.conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		switch args[0] {
+		case "PING":
+			rc.write("PONG\r\n")
+		case "SUB":
+			m.mu.Lock()
+			m.subs[rc][args[len(args)-1]] = args[1]
+			m.mu.Unlock()
+		case "UNSUB":
+			m.mu.Lock()
+			delete(m.subs[rc], args[1])
+			m.mu.Unlock()
+		case "PUB", "HPUB":
+			hsize := 0
+			if args[0] == "HPUB" {
+				hsize, _ = strconv.Atoi(args[len(args)-2])
+			}
+			size, _ := strconv.Atoi(args[len(args)-1])
+			b := make([]byte, size+2)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return
+			}
+			var reply string
+			// PUB <subject> [reply] <size>, or HPUB <subject> [reply] <hsize> <size>
+			if len(args) == 4 && args[0] == "PUB" || len(args) == 5 {
+				reply = args[2]
+			}
+			m.route(rc, args[1], reply, hsize, b[:size])
+		}
+	}
+}
+
+// route sends a message to all matching subscriptions. If none matches and
+// the message has a reply subject, a no responders status message is sent
+// to the publisher.
+func (m *mockRouter) route(from *routerConn, subj, reply string, hsize int, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	matched := false
+	for rc, sids := range m.subs {
+		for sid, pattern := range sids {
+			if subjectMatch(pattern, subj) {
+				matched = true
+				rc.msg(subj, sid, reply, hsize, data)
+			}
+		}
+	}
+	if matched || reply == "" {
+		return
+	}
+	for sid, pattern := range m.subs[from] {
+		if subjectMatch(pattern, reply) {
+			from.msg(reply, sid, "", 16, []byte("NATS/1.0 503\r\n\r\n"))
+		}
+	}
+}
+
+func (rc *routerConn) msg(subj, sid, reply string, hsize int, data []byte) {
+	if reply != "" {
+		sid += " " + reply
+	}
+	if hsize > 0 {
+		rc.write(fmt.Sprintf("HMSG %s %s %d %d\r\n%s\r\n", subj, sid, hsize, len(data), data))
+	} else {
+		rc.write(fmt.Sprintf("MSG %s %s %d\r\n%s\r\n", subj, sid, len(data), data))
+	}
+}
+
+func (rc *routerConn) write(s string) {
+	rc.wmu.Lock()
+	defer rc.wmu.Unlock()
+	rc.conn.Write([]byte(s))
+}
+
+func TestConformance(t *testing.T) {
+	mqtest.RunConformanceTests(t, func(t *testing.T) (mq.Client, mq.Client) {
+		url := newMockRouter(t)
+		return newTestClient(t, url, withRequestTimeout(100*time.Millisecond)),
+			newTestClient(t, url, withRequestTimeout(100*time.Millisecond))
+	})
+}
@@ -0,0 +1,38 @@
+package nats
+
+import (
+	"fmt"
+	"strings"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/resgateio/resgate/server/mq"
+)
+
+// connectionOptions returns the options for the connection name, inbox
+// prefix, and echo suppression.
+func (c *Client) connectionOptions() ([]nats.Option, error) {
+	var opts []nats.Option
+	if c.Name != "" {
+		opts = append(opts, nats.Name(c.Name))
+	}
+	if c.InboxPrefix != "" {
+		if !mq.IsValidSubject(c.InboxPrefix) {
+			return nil, fmt.Errorf("invalid inbox prefix %#v: must be a valid subject without wildcards", c.InboxPrefix)
+		}
+		opts = append(opts, nats.CustomInboxPrefix(c.InboxPrefix))
+	}
+	if c.NoEcho {
+		opts = append(opts, nats.NoEcho())
+	}
+	return opts, nil
+}
+
+// newInbox returns a unique inbox subject for a request, using the inbox
+// prefix, if set.
+func (c *Client) newInbox() string {
+	inbox := nats.NewInbox()
+	if c.InboxPrefix == "" {
+		return inbox
+	}
+	return c.InboxPrefix + "." + strings.TrimPrefix(inbox, nats.InboxPrefix)
+}
@@ -0,0 +1,103 @@
+package nats
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/resgateio/resgate/logger"
+)
+
+func TestConnect_ConnectionOptions_SentOnConnect(t *testing.T) {
+	url, conns := newMockServer(t)
+	c := newTestClient(t, url)
+	c.Name = "resgate-test"
+	c.NoEcho = true
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	defer c.Close()
+	mc := getMockConn(t, conns)
+
+	mc.mu.Lock()
+	connect := mc.connect
+	mc.mu.Unlock()
+	var opts struct {
+		Name string `json:"name"`
+		Echo bool   `json:"echo"`
+	}
+	if err := json.Unmarshal([]byte(connect), &opts); err != nil {
+		t.Fatalf("expected CONNECT options to be JSON, but got %#v: %s", connect, err)
+	}
+	if opts.Name != "resgate-test" {
+		t.Errorf("expected connection name %#v, but got %#v", "resgate-test", opts.Name)
+	}
+	if opts.Echo {
+		t.Error("expected echo to be disabled")
+	}
+	if l := c.Logger.(*logger.MemLogger).String(); !strings.Contains(l, "as resgate-test") {
+		t.Errorf("expected log to contain the connection name, but got:\n%s", l)
+	}
+}
+
+func TestConnect_NoConnectionOptions_UsesDefaults(t *testing.T) {
+	url, conns := newMockServer(t)
+	c := newTestClient(t, url)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	defer c.Close()
+	mc := getMockConn(t, conns)
+
+	mc.mu.Lock()
+	connect := mc.connect
+	mc.mu.Unlock()
+	var opts struct {
+		Name string `json:"name"`
+		Echo bool   `json:"echo"`
+	}
+	if err := json.Unmarshal([]byte(connect), &opts); err != nil {
+		t.Fatalf("expected CONNECT options to be JSON, but got %#v: %s", connect, err)
+	}
+	if opts.Name != "" {
+		t.Errorf("expected no connection name, but got %#v", opts.Name)
+	}
+	if !opts.Echo {
+		t.Error("expected echo to be enabled")
+	}
+
+	c.SendRequest("get.test.model", nil, func(string, []byte, map[string][]string, error) {}, nil)
+	if p := mc.getPub(t); !strings.HasPrefix(p.reply, "_INBOX.") {
+		t.Errorf("expected reply subject with prefix _INBOX., but got %#v", p.reply)
+	}
+}
+
+func TestSendRequest_InboxPrefix_UsedForReplySubject(t *testing.T) {
+	url, conns := newMockServer(t)
+	c := newTestClient(t, url)
+	c.InboxPrefix = "_INBOX_tenant"
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	defer c.Close()
+	mc := getMockConn(t, conns)
+
+	c.SendRequest("get.test.model", nil, func(string, []byte, map[string][]string, error) {}, nil)
+	p := mc.getPub(t)
+	if !strings.HasPrefix(p.reply, "_INBOX_tenant.") {
+		t.Errorf("expected reply subject with prefix _INBOX_tenant., but got %#v", p.reply)
+	}
+	mc.assertSub(t, p.reply)
+}
+
+func TestConnect_InvalidInboxPrefix_ReturnsError(t *testing.T) {
+	for _, prefix := range []string{"_INBOX.>", "_INBOX..tenant", "_INBOX tenant"} {
+		url, _ := newMockServer(t)
+		c := newTestClient(t, url)
+		c.InboxPrefix = prefix
+		if err := c.Connect(); err == nil {
+			c.Close()
+			t.Errorf("expected an error for inbox prefix %#v, but got none", prefix)
+		}
+	}
+}
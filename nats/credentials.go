@@ -0,0 +1,198 @@
+package nats
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+// credentialsCheckInterval is the interval between checks for changes to the
+// credentials file or NKey seed file.
+const credentialsCheckInterval = 10 * time.Second
+
+// credentials holds the user JWT, if loaded from a credentials file, and the
+// key pair used to sign the nonce sent by the NATS server on connect.
+type credentials struct {
+	jwt     string
+	kp      nkeys.KeyPair
+	pub     string
+	modTime time.Time
+}
+
+// credentialsFile returns the path of the credentials file or NKey seed
+// file, or empty string if neither is set.
+func (c *Client) credentialsFile() string {
+	if c.Creds != "" {
+		return c.Creds
+	}
+	return c.NKeySeed
+}
+
+// authOptions returns the options used to authenticate with the
+// credentials. The credentials are loaded on first connect. On later
+// connects, they are reloaded if the file is modified, keeping the previous
+// credentials if the reload fails. Nil is returned if no credentials are set.
+func (c *Client) authOptions() ([]nats.Option, error) {
+	if c.Creds != "" && c.NKeySeed != "" {
+		return nil, errors.New("NATS credentials file and NKey seed file cannot both be set")
+	}
+	if c.credentialsFile() == "" {
+		return nil, nil
+	}
+
+	c.credsMu.Lock()
+	creds := c.creds
+	c.credsMu.Unlock()
+	if creds == nil {
+		var err error
+		if creds, err = c.loadCredentials(); err != nil {
+			return nil, err
+		}
+		c.credsMu.Lock()
+		c.creds = creds
+		c.credsModTime = creds.modTime
+		c.credsMu.Unlock()
+	} else {
+		c.checkCredentials()
+	}
+
+	if c.Creds != "" {
+		return []nats.Option{nats.UserJWT(c.userJWT, c.signNonce)}, nil
+	}
+	return []nats.Option{nats.Nkey(creds.pub, c.signNonce)}, nil
+}
+
+// loadCredentials reads the credentials file, or the NKey seed file.
+func (c *Client) loadCredentials() (*credentials, error) {
+	file := c.credentialsFile()
+	fi, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeSlice(contents)
+
+	creds := &credentials{modTime: fi.ModTime()}
+	if c.Creds != "" {
+		creds.jwt, err = nkeys.ParseDecoratedJWT(contents)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing user JWT in %s: %s", file, err)
+		}
+		if creds.jwt == "" {
+			return nil, fmt.Errorf("no user JWT found in %s", file)
+		}
+	}
+	creds.kp, err = nkeys.ParseDecoratedNKey(contents)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing NKey seed in %s: %s", file, err)
+	}
+	creds.pub, err = creds.kp.PublicKey()
+	if err != nil || !nkeys.IsValidPublicUserKey(creds.pub) {
+		creds.kp.Wipe()
+		return nil, fmt.Errorf("no valid user NKey seed found in %s", file)
+	}
+	return creds, nil
+}
+
+// ReloadCredentials reloads the credentials file, or NKey seed file, to be
+// used on any later connect. If the reload fails, the previous credentials
+// are kept. An NKey seed file may not change the public key, as it is set
+// for the connection.
+func (c *Client) ReloadCredentials() error {
+	if c.credentialsFile() == "" {
+		return nil
+	}
+	creds, err := c.loadCredentials()
+	if err == nil && c.Creds == "" {
+		c.credsMu.Lock()
+		if c.creds != nil && c.creds.pub != creds.pub {
+			err = fmt.Errorf("public key of NKey seed in %s changed", c.NKeySeed)
+			creds.kp.Wipe()
+		}
+		c.credsMu.Unlock()
+	}
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to reload NATS credentials, keeping previous credentials: %s", err))
+		return err
+	}
+
+	c.credsMu.Lock()
+	old := c.creds
+	c.creds = creds
+	c.credsModTime = creds.modTime
+	if old != nil {
+		old.kp.Wipe()
+	}
+	c.credsMu.Unlock()
+
+	c.Logf("Reloaded NATS credentials from %s", c.credentialsFile())
+	return nil
+}
+
+// checkCredentials reloads the credentials if the file has been modified
+// since it was last checked or loaded.
+func (c *Client) checkCredentials() {
+	fi, err := os.Stat(c.credentialsFile())
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to check NATS credentials: %s", err))
+		return
+	}
+	c.credsMu.Lock()
+	modified := !fi.ModTime().Equal(c.credsModTime)
+	c.credsModTime = fi.ModTime()
+	c.credsMu.Unlock()
+	if modified {
+		_ = c.ReloadCredentials()
+	}
+}
+
+// watchCredentials checks for changes to the credentials file each
+// credentialsCheckInterval, until stop is closed.
+func (c *Client) watchCredentials(stop chan struct{}) {
+	ticker := time.NewTicker(credentialsCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.checkCredentials()
+		}
+	}
+}
+
+// userJWT returns the user JWT of the loaded credentials.
+func (c *Client) userJWT() (string, error) {
+	c.credsMu.Lock()
+	defer c.credsMu.Unlock()
+	if c.creds == nil {
+		return "", errors.New("no NATS credentials loaded")
+	}
+	return c.creds.jwt, nil
+}
+
+// signNonce signs the nonce sent by the NATS server with the key pair of the
+// loaded credentials.
+func (c *Client) signNonce(nonce []byte) ([]byte, error) {
+	c.credsMu.Lock()
+	defer c.credsMu.Unlock()
+	if c.creds == nil {
+		return nil, errors.New("no NATS credentials loaded")
+	}
+	return c.creds.kp.Sign(nonce)
+}
+
+// wipeSlice overwrites the content of the slice.
+func wipeSlice(buf []byte) {
+	for i := range buf {
+		buf[i] = 'x'
+	}
+}
@@ -0,0 +1,209 @@
+package nats
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/resgateio/resgate/logger"
+)
+
+var testNonce = []byte("nonce")
+
+// createUser creates a user key pair, returning it with its seed.
+func createUser(t *testing.T) (nkeys.KeyPair, string) {
+	kp, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, err := kp.Seed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kp, string(seed)
+}
+
+// writeFile writes the content to the file, setting its modification time to
+// modTime.
+func writeFile(t *testing.T, file, content string, modTime time.Time) {
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// credsFileContent returns the content of a decorated user credentials file.
+func credsFileContent(jwt, seed string) string {
+	return "-----BEGIN NATS USER JWT-----\n" + jwt + "\n------END NATS USER JWT------\n\n" +
+		"-----BEGIN USER NKEY SEED-----\n" + seed + "\n------END USER NKEY SEED------\n"
+}
+
+// applyAuthOptions returns the nats options set by the client's auth options.
+func applyAuthOptions(t *testing.T, c *Client) nats.Options {
+	opts, err := c.authOptions()
+	if err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	o := nats.GetDefaultOptions()
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return o
+}
+
+func assertUserJWT(t *testing.T, o nats.Options, jwt string) {
+	if o.UserJWT == nil {
+		t.Fatal("expected user JWT callback to be set")
+	}
+	got, err := o.UserJWT()
+	if err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	if got != jwt {
+		t.Errorf("expected user JWT to be %#v, but got %#v", jwt, got)
+	}
+}
+
+func assertSignedBy(t *testing.T, o nats.Options, kp nkeys.KeyPair) {
+	sig, err := o.SignatureCB(testNonce)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	if err := kp.Verify(testNonce, sig); err != nil {
+		t.Errorf("expected nonce to be signed by key pair, but got: %s", err)
+	}
+}
+
+func newCredentialsTestClient(t *testing.T) (*Client, string) {
+	return &Client{Logger: logger.NewMemLogger(false, false)}, t.TempDir()
+}
+
+func TestAuthOptions_CredsFile_SetsUserJWTAndSignature(t *testing.T) {
+	c, dir := newCredentialsTestClient(t)
+	kp, seed := createUser(t)
+	c.Creds = filepath.Join(dir, "user.creds")
+	writeFile(t, c.Creds, credsFileContent("jwt1", seed), time.Now())
+
+	o := applyAuthOptions(t, c)
+	assertUserJWT(t, o, "jwt1")
+	assertSignedBy(t, o, kp)
+}
+
+func TestAuthOptions_NKeySeedFile_SetsNkeyAndSignature(t *testing.T) {
+	c, dir := newCredentialsTestClient(t)
+	kp, seed := createUser(t)
+	pub, _ := kp.PublicKey()
+	c.NKeySeed = filepath.Join(dir, "user.nk")
+	writeFile(t, c.NKeySeed, seed+"\n", time.Now())
+
+	o := applyAuthOptions(t, c)
+	if o.Nkey != pub {
+		t.Errorf("expected nkey to be %#v, but got %#v", pub, o.Nkey)
+	}
+	assertSignedBy(t, o, kp)
+}
+
+func TestAuthOptions_CredsAndNKeySeed_ReturnsError(t *testing.T) {
+	c, dir := newCredentialsTestClient(t)
+	c.Creds = filepath.Join(dir, "user.creds")
+	c.NKeySeed = filepath.Join(dir, "user.nk")
+	if _, err := c.authOptions(); err == nil {
+		t.Fatal("expected an error, but got none")
+	}
+}
+
+func TestAuthOptions_MissingFile_ReturnsError(t *testing.T) {
+	c, dir := newCredentialsTestClient(t)
+	c.Creds = filepath.Join(dir, "missing.creds")
+	if _, err := c.authOptions(); err == nil {
+		t.Fatal("expected an error, but got none")
+	}
+}
+
+func TestReloadCredentials_ModifiedCredsFile_UsesNewCredentials(t *testing.T) {
+	c, dir := newCredentialsTestClient(t)
+	_, seed1 := createUser(t)
+	kp2, seed2 := createUser(t)
+	c.Creds = filepath.Join(dir, "user.creds")
+	writeFile(t, c.Creds, credsFileContent("jwt1", seed1), time.Now())
+	o := applyAuthOptions(t, c)
+
+	writeFile(t, c.Creds, credsFileContent("jwt2", seed2), time.Now())
+	if err := c.ReloadCredentials(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	assertUserJWT(t, o, "jwt2")
+	assertSignedBy(t, o, kp2)
+}
+
+func TestReloadCredentials_InvalidCredsFile_KeepsPreviousCredentials(t *testing.T) {
+	c, dir := newCredentialsTestClient(t)
+	kp1, seed1 := createUser(t)
+	c.Creds = filepath.Join(dir, "user.creds")
+	writeFile(t, c.Creds, credsFileContent("jwt1", seed1), time.Now())
+	o := applyAuthOptions(t, c)
+
+	writeFile(t, c.Creds, credsFileContent("jwt2", "invalid"), time.Now())
+	if err := c.ReloadCredentials(); err == nil {
+		t.Fatal("expected an error, but got none")
+	}
+	assertUserJWT(t, o, "jwt1")
+	assertSignedBy(t, o, kp1)
+}
+
+func TestReloadCredentials_NKeySeedWithNewPublicKey_KeepsPreviousSeed(t *testing.T) {
+	c, dir := newCredentialsTestClient(t)
+	kp1, seed1 := createUser(t)
+	_, seed2 := createUser(t)
+	c.NKeySeed = filepath.Join(dir, "user.nk")
+	writeFile(t, c.NKeySeed, seed1, time.Now())
+	o := applyAuthOptions(t, c)
+
+	writeFile(t, c.NKeySeed, seed2, time.Now())
+	if err := c.ReloadCredentials(); err == nil {
+		t.Fatal("expected an error, but got none")
+	}
+	assertSignedBy(t, o, kp1)
+}
+
+func TestCheckCredentials_ModifiedFile_ReloadsCredentials(t *testing.T) {
+	c, dir := newCredentialsTestClient(t)
+	_, seed1 := createUser(t)
+	kp2, seed2 := createUser(t)
+	modTime := time.Now().Add(-time.Hour)
+	c.Creds = filepath.Join(dir, "user.creds")
+	writeFile(t, c.Creds, credsFileContent("jwt1", seed1), modTime)
+	o := applyAuthOptions(t, c)
+
+	// Unmodified file is not reloaded
+	c.checkCredentials()
+	assertUserJWT(t, o, "jwt1")
+
+	writeFile(t, c.Creds, credsFileContent("jwt2", seed2), modTime.Add(time.Minute))
+	c.checkCredentials()
+	assertUserJWT(t, o, "jwt2")
+	assertSignedBy(t, o, kp2)
+}
+
+func TestAuthOptions_Reconnect_UsesModifiedCredentials(t *testing.T) {
+	c, dir := newCredentialsTestClient(t)
+	_, seed1 := createUser(t)
+	kp2, seed2 := createUser(t)
+	modTime := time.Now().Add(-time.Hour)
+	c.Creds = filepath.Join(dir, "user.creds")
+	writeFile(t, c.Creds, credsFileContent("jwt1", seed1), modTime)
+	applyAuthOptions(t, c)
+
+	writeFile(t, c.Creds, credsFileContent("jwt2", seed2), modTime.Add(time.Minute))
+	o := applyAuthOptions(t, c)
+	assertUserJWT(t, o, "jwt2")
+	assertSignedBy(t, o, kp2)
+}
@@ -0,0 +1,47 @@
+package nats
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func sendHeaderRequest(t *testing.T, info string) mockPub {
+	url, conns := newMockServerWithInfo(t, info)
+	c := newTestClient(t, url)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	defer c.Close()
+	mc := getMockConn(t, conns)
+
+	errs := make(chan error, 1)
+	c.SendRequest("get.test.model", nil, func(_ string, _ []byte, _ map[string][]string, err error) {
+		errs <- err
+	}, map[string][]string{"traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}})
+	p := mc.getPub(t)
+	mc.respond(p.reply, `{"result":null}`)
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatalf("expected no error, but got: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a response, but got none")
+	}
+	return p
+}
+
+func TestSendRequest_WithHeaders_PublishesHeaders(t *testing.T) {
+	p := sendHeaderRequest(t, mockInfo)
+	if !strings.Contains(p.header, "traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01\r\n") {
+		t.Errorf("expected traceparent header, but got header block %#v", p.header)
+	}
+}
+
+func TestSendRequest_ServerWithoutHeaderSupport_PublishesWithoutHeaders(t *testing.T) {
+	p := sendHeaderRequest(t, `INFO {"server_id":"mock","version":"2.1.0","proto":1,"max_payload":1048576}`)
+	if p.header != "" {
+		t.Errorf("expected no headers, but got header block %#v", p.header)
+	}
+}
@@ -0,0 +1,210 @@
+package nats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/logger"
+)
+
+// testClientOption is an option applied to a client created by
+// newTestClient.
+type testClientOption func(c *Client)
+
+// withRequestTimeout sets the request timeout of a test client.
+func withRequestTimeout(d time.Duration) testClientOption {
+	return func(c *Client) { c.RequestTimeout = d }
+}
+
+// withRequestTimeoutOverrides sets the request timeout overrides of a test
+// client.
+func withRequestTimeoutOverrides(overrides map[string]time.Duration) testClientOption {
+	return func(c *Client) { c.SetRequestTimeoutOverrides(overrides) }
+}
+
+// withReconnect makes a test client reconnect without limit, with a short
+// reconnect wait.
+func withReconnect() testClientOption {
+	return func(c *Client) {
+		c.MaxReconnects = -1
+		c.ReconnectWait = 10 * time.Millisecond
+		c.ReconnectJitter = time.Millisecond
+	}
+}
+
+// newTestClient returns a client for the NATS server at url, with a one
+// second request timeout and a memory logger. The client is closed when the
+// test completes.
+func newTestClient(t *testing.T, url string, opts ...testClientOption) *Client {
+	c := &Client{
+		URL:            url,
+		RequestTimeout: time.Second,
+		BufferSize:     64,
+		Logger:         logger.NewMemLogger(false, false),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// mockConn is a connection to a mock NATS server, passing the subject of
+// each subscription made on subs, and each published message on pubs.
+type mockConn struct {
+	conn net.Conn
+	subs chan string
+	pubs chan mockPub
+
+	mu      sync.Mutex
+	sids    map[string]string // Subscription sids by subject
+	connect string            // JSON options of the CONNECT message
+}
+
+// mockPub is a message published to a mock NATS server.
+type mockPub struct {
+	subject string
+	reply   string
+	header  string // Raw header block, or empty if published without headers
+}
+
+// mockInfo is the INFO message sent by a mock NATS server supporting headers.
+const mockInfo = `INFO {"server_id":"mock","version":"2.6.4","proto":1,"headers":true,"max_payload":1048576}`
+
+// newMockServer starts a mock NATS server accepting any number of
+// connections, each passed on the returned channel.
+func newMockServer(t *testing.T) (string, chan *mockConn) {
+	return newMockServerWithInfo(t, mockInfo)
+}
+
+// newMockServerWithInfo starts a mock NATS server, like newMockServer, that
+// sends the INFO message info on connect.
+func newMockServerWithInfo(t *testing.T, info string) (string, chan *mockConn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	conns := make(chan *mockConn, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mc := &mockConn{conn: conn, subs: make(chan string, 16), pubs: make(chan mockPub, 16), sids: make(map[string]string)}
+			conns <- mc
+			go mc.serve(info)
+		}
+	}()
+	return "nats://" + ln.Addr().String(), conns
+}
+
+func (mc *mockConn) serve(info string) {
+	defer mc.conn.Close()
+	if _, err := mc.conn.Write([]byte(info + "\r\n")); err != nil {
+		return
+	}
+	r := bufio.NewReader(mc.conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		switch args[0] {
+		case "CONNECT":
+			mc.mu.Lock()
+			mc.connect = strings.TrimSpace(strings.TrimPrefix(line, "CONNECT"))
+			mc.mu.Unlock()
+		case "PING":
+			if _, err := mc.conn.Write([]byte("PONG\r\n")); err != nil {
+				return
+			}
+		case "SUB":
+			mc.mu.Lock()
+			mc.sids[args[1]] = args[len(args)-1]
+			mc.mu.Unlock()
+			mc.subs <- args[1]
+		case "PUB":
+			size, _ := strconv.Atoi(args[len(args)-1])
+			if _, err := io.CopyN(io.Discard, r, int64(size+2)); err != nil {
+				return
+			}
+			var reply string
+			if len(args) == 4 {
+				reply = args[2]
+			}
+			mc.pubs <- mockPub{subject: args[1], reply: reply}
+		case "HPUB":
+			hsize, _ := strconv.Atoi(args[len(args)-2])
+			size, _ := strconv.Atoi(args[len(args)-1])
+			b := make([]byte, size+2)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return
+			}
+			var reply string
+			if len(args) == 5 {
+				reply = args[2]
+			}
+			mc.pubs <- mockPub{subject: args[1], reply: reply, header: string(b[:hsize])}
+		}
+	}
+}
+
+// respond sends a message with the data to the subscription on the subject.
+func (mc *mockConn) respond(subj string, data string) {
+	mc.send(subj, subj, data)
+}
+
+// send sends a message on a subject with the data to the subscription made
+// on the subscription subject.
+func (mc *mockConn) send(subSubj string, subj string, data string) {
+	mc.mu.Lock()
+	sid := mc.sids[subSubj]
+	mc.mu.Unlock()
+	mc.conn.Write([]byte(fmt.Sprintf("MSG %s %s %d\r\n%s\r\n", subj, sid, len(data), data)))
+}
+
+func (mc *mockConn) getPub(t *testing.T) mockPub {
+	select {
+	case p := <-mc.pubs:
+		return p
+	case <-time.After(time.Second):
+		t.Fatal("expected a published message, but got none")
+	}
+	return mockPub{}
+}
+
+func (mc *mockConn) assertSub(t *testing.T, subj string) {
+	for {
+		select {
+		case s := <-mc.subs:
+			if s == subj {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected subscription on %s, but got none", subj)
+		}
+	}
+}
+
+func getMockConn(t *testing.T, conns chan *mockConn) *mockConn {
+	select {
+	case mc := <-conns:
+		return mc
+	case <-time.After(time.Second):
+		t.Fatal("expected a connection, but got none")
+	}
+	return nil
+}
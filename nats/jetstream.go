@@ -0,0 +1,177 @@
+package nats
+
+import (
+	"fmt"
+	"strings"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/resgateio/resgate/server/mq"
+)
+
+// jetStreamConsumer is a durable JetStream push consumer used as the source
+// of events with subjects matching a subject.
+type jetStreamConsumer struct {
+	stream   string
+	subject  string
+	consumer string
+	tokens   []string
+	sub      *nats.Subscription
+	lastSeq  uint64 // Stream sequence of the last handled event
+}
+
+// WithJetStreamConsumer adds a durable JetStream push consumer, bound to
+// stream, as the source of events with subjects matching subject. On connect,
+// the consumer delivers any stored event after its last acknowledged
+// sequence, replaying events published while not connected. If the stream
+// doesn't exist, events are subscribed to on core NATS instead.
+//
+// Event subscriptions for resources with events matching subject are made on
+// the consumer instead of on core NATS. Delivered events are acknowledged once
+// handled, and events for resources not subscribed to are acknowledged and
+// discarded, as are redelivered events with a stream sequence already handled.
+// If multiple subjects match, the first one added applies. It must be called
+// before Connect.
+func (c *Client) WithJetStreamConsumer(stream, subject, consumerName string) *Client {
+	c.jsConsumers = append(c.jsConsumers, &jetStreamConsumer{
+		stream:   stream,
+		subject:  subject,
+		consumer: consumerName,
+		tokens:   strings.Split(subject, "."),
+	})
+	return c
+}
+
+// isValid returns true if the stream and consumer names are set, and the
+// subject is a valid subject for events.
+func (jc *jetStreamConsumer) isValid() bool {
+	if jc.stream == "" || jc.consumer == "" || jc.tokens[0] != "event" || strings.ContainsAny(jc.subject, " \t\r\n") {
+		return false
+	}
+	for i, t := range jc.tokens {
+		if t == "" || (t == ">" && i < len(jc.tokens)-1) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchNamespace returns true if all events of the namespace, with the format
+// "event."+resource, matches the consumer subject.
+func (jc *jetStreamConsumer) matchNamespace(namespace string) bool {
+	ts := strings.Split(namespace, ".")
+	for i, t := range jc.tokens {
+		if t == ">" {
+			return true
+		}
+		if i == len(ts) {
+			// Token matching the event name
+			return t == "*" && i == len(jc.tokens)-1
+		}
+		if t != "*" && t != ts[i] {
+			return false
+		}
+	}
+	return false
+}
+
+// subscribeJetStream subscribes to all JetStream consumers on the connection,
+// delivering messages on ch. On error, the connection should be closed.
+// Client mutex is held when called.
+func (c *Client) subscribeJetStream(nc *nats.Conn, ch chan *nats.Msg) error {
+	if len(c.jsConsumers) == 0 {
+		return nil
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		return err
+	}
+	for _, jc := range c.jsConsumers {
+		if !jc.isValid() {
+			c.clearJetStream()
+			return fmt.Errorf("invalid JetStream consumer %s on stream %s for subject: %s", jc.consumer, jc.stream, jc.subject)
+		}
+		c.Logf("Subscribing to JetStream consumer %s on stream %s for %s", jc.consumer, jc.stream, jc.subject)
+		sub, err := js.ChanSubscribe(jc.subject, ch, nats.Durable(jc.consumer), nats.BindStream(jc.stream), nats.ManualAck())
+		if isStreamNotFound(err) {
+			c.Logf("JetStream stream %s not found: subscribing to %s on core NATS", jc.stream, jc.subject)
+			continue
+		}
+		if err != nil {
+			c.clearJetStream()
+			return fmt.Errorf("JetStream consumer %s on stream %s: %s", jc.consumer, jc.stream, err)
+		}
+		jc.sub = sub
+	}
+	return nil
+}
+
+// isStreamNotFound returns true if the error is caused by a missing stream.
+func isStreamNotFound(err error) bool {
+	return err != nil && (err == nats.ErrStreamNotFound || strings.Contains(err.Error(), "stream not found"))
+}
+
+// clearJetStream clears the JetStream consumer subscriptions. The
+// subscriptions are not unsubscribed, as that would delete any durable
+// consumer created on subscribe, but are closed with the connection.
+// Client mutex is held when called.
+func (c *Client) clearJetStream() {
+	for _, jc := range c.jsConsumers {
+		jc.sub = nil
+	}
+}
+
+// jetStreamConsumer returns the JetStream consumer for the events of an event
+// namespace, or nil if events are subscribed to on core NATS.
+// Client mutex is held when called.
+func (c *Client) jetStreamConsumer(namespace string) *jetStreamConsumer {
+	for _, jc := range c.jsConsumers {
+		if jc.sub != nil && jc.matchNamespace(namespace) {
+			return jc
+		}
+	}
+	return nil
+}
+
+// isDuplicateJetStreamMsg returns true if the message is a redelivery of an
+// event already handled by its consumer. Otherwise, the stream sequence of the
+// message is recorded as handled.
+// Client mutex is held when called.
+func (c *Client) isDuplicateJetStreamMsg(msg *nats.Msg) bool {
+	meta, err := msg.Metadata()
+	if err != nil {
+		return false
+	}
+	for _, jc := range c.jsConsumers {
+		if jc.sub == msg.Sub {
+			if meta.Sequence.Stream <= jc.lastSeq {
+				c.Debugf("Discarding redelivered JetStream event %s (%d)", msg.Subject, meta.Sequence.Stream)
+				return true
+			}
+			jc.lastSeq = meta.Sequence.Stream
+			return false
+		}
+	}
+	return false
+}
+
+// handleJetStreamMsg passes an event delivered by a JetStream consumer to the
+// subscription callback of its resource, if any, and acknowledges it.
+func (c *Client) handleJetStreamMsg(msg *nats.Msg, f mq.Response) {
+	if f != nil {
+		c.tracePayload("=>>", "", msg.Subject, msg.Data)
+		f(msg.Subject, msg.Data, msg.Header, nil)
+	}
+	if err := msg.Ack(); err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to acknowledge JetStream event %s: %s", msg.Subject, err))
+	}
+}
+
+// eventNamespace returns the namespace of an event subject, with the event
+// name removed.
+func eventNamespace(subj string) string {
+	idx := strings.LastIndexByte(subj, '.')
+	if idx < 0 {
+		return subj
+	}
+	return subj[:idx]
+}
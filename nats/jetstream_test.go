@@ -0,0 +1,441 @@
+package nats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testStream   = "EVENTS"
+	testConsumer = "resgate"
+	testDeliver  = "deliver.resgate"
+)
+
+// mockJetStream is a mock NATS server with a single stream and a durable push
+// consumer, handling consumer info requests, message delivery, and acks.
+type mockJetStream struct {
+	t        *testing.T
+	ln       net.Listener
+	subject  string
+	stored   []string // Stored stream messages as "subject payload"
+	ackFloor uint64
+	acks     chan uint64
+	noStream bool // Respond to JetStream API requests with stream not found
+
+	mu   sync.Mutex
+	w    *bufio.Writer
+	subs map[string]string // Subscription subjects by sid
+}
+
+func newMockJetStream(t *testing.T, subject string, ackFloor uint64, stored ...string) *mockJetStream {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockJetStream{
+		t:        t,
+		ln:       ln,
+		subject:  subject,
+		stored:   stored,
+		ackFloor: ackFloor,
+		acks:     make(chan uint64, 16),
+		subs:     make(map[string]string),
+	}
+	go m.serve()
+	t.Cleanup(func() { ln.Close() })
+	return m
+}
+
+func (m *mockJetStream) URL() string {
+	return "nats://" + m.ln.Addr().String()
+}
+
+func (m *mockJetStream) serve() {
+	conn, err := m.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	m.mu.Lock()
+	m.w = bufio.NewWriter(conn)
+	m.write(`INFO {"server_id":"mock","version":"2.6.4","proto":1,"headers":true,"max_payload":1048576}` + "\r\n")
+	m.mu.Unlock()
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		m.mu.Lock()
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			m.write("PONG\r\n")
+		case "SUB":
+			m.subs[args[len(args)-1]] = args[1]
+		case "UNSUB":
+			delete(m.subs, args[1])
+		case "PUB", "HPUB":
+			size, _ := strconv.Atoi(args[len(args)-1])
+			buf := make([]byte, size+2)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				m.mu.Unlock()
+				return
+			}
+			if args[0] == "HPUB" {
+				hdrLen, _ := strconv.Atoi(args[len(args)-2])
+				buf = buf[hdrLen:]
+			}
+			var reply string
+			if len(args) == 5 || (args[0] == "PUB" && len(args) == 4) {
+				reply = args[2]
+			}
+			m.handlePub(args[1], reply, buf[:len(buf)-2])
+		}
+		m.mu.Unlock()
+	}
+}
+
+// handlePub handles a published message.
+// Mutex is held when called.
+func (m *mockJetStream) handlePub(subj, reply string, data []byte) {
+	switch {
+	case m.noStream && strings.HasPrefix(subj, "$JS.API."):
+		m.send(reply, "", `{"type":"io.nats.jetstream.api.v1.consumer_info_response","error":{"code":404,"err_code":10059,"description":"stream not found"}}`)
+	case subj == "$JS.API.CONSUMER.INFO."+testStream+"."+testConsumer:
+		m.send(reply, "", fmt.Sprintf(`{"type":"io.nats.jetstream.api.v1.consumer_info_response","stream_name":%q,"name":%q,"config":{"durable_name":%q,"deliver_subject":%q,"deliver_policy":"all","ack_policy":"explicit","replay_policy":"instant","filter_subject":%q}}`,
+			testStream, testConsumer, testConsumer, testDeliver, m.subject))
+	case strings.HasPrefix(subj, "$JS.ACK."):
+		// $JS.ACK.<stream>.<consumer>.<delivered>.<stream seq>.<consumer seq>.<timestamp>.<pending>
+		seq, _ := strconv.ParseUint(strings.Split(subj, ".")[5], 10, 64)
+		m.acks <- seq
+	}
+}
+
+// replay delivers all stored messages after the ack floor to the consumer's
+// deliver subject.
+func (m *mockJetStream) replay() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, msg := range m.stored {
+		seq := uint64(i + 1)
+		if seq <= m.ackFloor {
+			continue
+		}
+		parts := strings.SplitN(msg, " ", 2)
+		reply := fmt.Sprintf("$JS.ACK.%s.%s.1.%d.%d.%d.%d", testStream, testConsumer, seq, seq, time.Now().UnixNano(), uint64(len(m.stored))-seq)
+		m.sendTo(testDeliver, parts[0], reply, parts[1])
+	}
+}
+
+// send sends a message to any subscription matching the subject.
+// Mutex is held when called.
+func (m *mockJetStream) send(subj, reply, data string) {
+	for _, s := range m.subs {
+		if subjectMatch(s, subj) {
+			m.sendTo(s, subj, reply, data)
+		}
+	}
+}
+
+// sendTo sends a message to the subscription with the subject subSubj.
+// Mutex is held when called.
+func (m *mockJetStream) sendTo(subSubj, subj, reply, data string) {
+	for sid, s := range m.subs {
+		if s == subSubj {
+			if reply != "" {
+				reply += " "
+			}
+			m.write(fmt.Sprintf("MSG %s %s %s%d\r\n%s\r\n", subj, sid, reply, len(data), data))
+			return
+		}
+	}
+	m.t.Errorf("mock JetStream: no subscription on %s", subSubj)
+}
+
+// hasSub returns true if there is a subscription with the subject.
+func (m *mockJetStream) hasSub(subj string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.subs {
+		if s == subj {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *mockJetStream) assertAck(t *testing.T, seq uint64) {
+	select {
+	case got := <-m.acks:
+		if got != seq {
+			t.Fatalf("expected ack for sequence %d, but got %d", seq, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected ack for sequence %d, but got none", seq)
+	}
+}
+
+// write writes to the connection.
+// Mutex is held when called.
+func (m *mockJetStream) write(s string) {
+	m.w.WriteString(s)
+	m.w.Flush()
+}
+
+func subjectMatch(pattern, subj string) bool {
+	pts, sts := strings.Split(pattern, "."), strings.Split(subj, ".")
+	for i, pt := range pts {
+		if pt == ">" {
+			return len(sts) > i
+		}
+		if i >= len(sts) || (pt != "*" && pt != sts[i]) {
+			return false
+		}
+	}
+	return len(pts) == len(sts)
+}
+
+func newJetStreamTestClient(t *testing.T, m *mockJetStream) *Client {
+	return newTestClient(t, m.URL()).WithJetStreamConsumer(testStream, m.subject, testConsumer)
+}
+
+func TestJetStreamConsumer_Replay_DeliversEventsAfterAckFloor(t *testing.T) {
+	m := newMockJetStream(t, "event.test.>", 1,
+		`event.test.model.change {"values":{"foo":1}}`,
+		`event.test.model.change {"values":{"foo":2}}`,
+		`event.test.other.change {"values":{"bar":3}}`,
+	)
+	c := newJetStreamTestClient(t, m)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	defer c.Close()
+
+	events := make(chan string, 8)
+	_, err := c.Subscribe("event.test.model", func(subj string, payload []byte, _ map[string][]string, err error) {
+		events <- subj + " " + string(payload)
+	})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	if err := c.mq.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if m.hasSub("event.test.model.*") {
+		t.Fatal("expected no core NATS subscription for event.test.model.*")
+	}
+
+	m.replay()
+	select {
+	case ev := <-events:
+		if expected := `event.test.model.change {"values":{"foo":2}}`; ev != expected {
+			t.Fatalf("expected event %#v, but got %#v", expected, ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected replayed event, but got none")
+	}
+	// Events for resources not subscribed to are acknowledged
+	m.assertAck(t, 2)
+	m.assertAck(t, 3)
+	select {
+	case ev := <-events:
+		t.Fatalf("expected no more events, but got %#v", ev)
+	default:
+	}
+}
+
+func subscribeJetStreamTestEvents(t *testing.T, c *Client, namespace string) chan string {
+	events := make(chan string, 8)
+	_, err := c.Subscribe(namespace, func(subj string, payload []byte, _ map[string][]string, err error) {
+		events <- subj + " " + string(payload)
+	})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	if err := c.mq.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func assertJetStreamTestEvent(t *testing.T, events chan string, expected string) {
+	select {
+	case ev := <-events:
+		if ev != expected {
+			t.Fatalf("expected event %#v, but got %#v", expected, ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected event %#v, but got none", expected)
+	}
+}
+
+func TestJetStreamConsumer_Restart_ReplaysEventsPublishedWhileDown(t *testing.T) {
+	m := newMockJetStream(t, "event.test.>", 0,
+		`event.test.model.change {"values":{"foo":1}}`,
+	)
+	c := newJetStreamTestClient(t, m)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	events := subscribeJetStreamTestEvents(t, c, "event.test.model")
+	m.replay()
+	assertJetStreamTestEvent(t, events, `event.test.model.change {"values":{"foo":1}}`)
+	m.assertAck(t, 1)
+	c.Close()
+
+	// Restart with an event stored while down
+	m = newMockJetStream(t, "event.test.>", 1,
+		`event.test.model.change {"values":{"foo":1}}`,
+		`event.test.model.change {"values":{"foo":2}}`,
+	)
+	c = newJetStreamTestClient(t, m)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	defer c.Close()
+	events = subscribeJetStreamTestEvents(t, c, "event.test.model")
+	m.replay()
+	assertJetStreamTestEvent(t, events, `event.test.model.change {"values":{"foo":2}}`)
+	m.assertAck(t, 2)
+}
+
+func TestJetStreamConsumer_Redelivery_DiscardsHandledEvents(t *testing.T) {
+	m := newMockJetStream(t, "event.test.>", 0,
+		`event.test.model.change {"values":{"foo":1}}`,
+	)
+	c := newJetStreamTestClient(t, m)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	defer c.Close()
+	events := subscribeJetStreamTestEvents(t, c, "event.test.model")
+
+	m.replay()
+	assertJetStreamTestEvent(t, events, `event.test.model.change {"values":{"foo":1}}`)
+	m.assertAck(t, 1)
+
+	// Redeliver
+	m.replay()
+	m.assertAck(t, 1)
+	select {
+	case ev := <-events:
+		t.Fatalf("expected no redelivered event, but got %#v", ev)
+	default:
+	}
+}
+
+func TestJetStreamConsumer_StreamNotFound_SubscribesOnCoreNATS(t *testing.T) {
+	m := newMockJetStream(t, "event.test.>", 0)
+	m.mu.Lock()
+	m.noStream = true
+	m.mu.Unlock()
+	c := newJetStreamTestClient(t, m)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	defer c.Close()
+
+	subscribeJetStreamTestEvents(t, c, "event.test.model")
+	if !m.hasSub("event.test.model.*") {
+		t.Fatal("expected core NATS subscription for event.test.model.*")
+	}
+}
+
+func TestJetStreamConsumer_UnmatchedNamespace_SubscribesOnCoreNATS(t *testing.T) {
+	m := newMockJetStream(t, "event.test.>", 0)
+	c := newJetStreamTestClient(t, m)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Subscribe("event.other.model", func(string, []byte, map[string][]string, error) {}); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	if err := c.mq.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !m.hasSub("event.other.model.*") {
+		t.Fatal("expected core NATS subscription for event.other.model.*")
+	}
+}
+
+func TestJetStreamConsumer_Unsubscribe_DiscardsEvents(t *testing.T) {
+	m := newMockJetStream(t, "event.test.>", 0,
+		`event.test.model.change {"values":{"foo":1}}`,
+	)
+	c := newJetStreamTestClient(t, m)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	defer c.Close()
+
+	events := make(chan string, 8)
+	sub, err := c.Subscribe("event.test.model", func(subj string, payload []byte, _ map[string][]string, err error) {
+		events <- subj
+	})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	if err := c.mq.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	m.replay()
+	m.assertAck(t, 1)
+	select {
+	case ev := <-events:
+		t.Fatalf("expected no events, but got %#v", ev)
+	default:
+	}
+}
+
+func TestJetStreamConsumer_InvalidSubject_ReturnsError(t *testing.T) {
+	m := newMockJetStream(t, "get.test.>", 0)
+	c := newJetStreamTestClient(t, m)
+	if err := c.Connect(); err == nil {
+		c.Close()
+		t.Fatal("expected an error, but got none")
+	}
+}
+
+func TestJetStreamConsumerMatchNamespace(t *testing.T) {
+	tbl := []struct {
+		Subject   string
+		Namespace string
+		Match     bool
+	}{
+		{"event.>", "event.test.model", true},
+		{"event.test.>", "event.test.model", true},
+		{"event.test.>", "event.test", true},
+		{"event.test.>", "event", false},
+		{"event.test.>", "event.other.model", false},
+		{"event.test.*.*", "event.test.model", true},
+		{"event.test.*.*", "event.test.model.1", false},
+		{"event.*.model.*", "event.test.model", true},
+		{"event.test.model.change", "event.test.model", false},
+		{"event.test.model", "event.test.model", false},
+	}
+
+	for i, l := range tbl {
+		jc := (&Client{}).WithJetStreamConsumer(testStream, l.Subject, testConsumer).jsConsumers[0]
+		if match := jc.matchNamespace(l.Namespace); match != l.Match {
+			t.Errorf("expected matchNamespace(%#v) for subject %#v to return %v, but got %v in test %d", l.Namespace, l.Subject, l.Match, match, i+1)
+		}
+	}
+}
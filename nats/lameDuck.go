@@ -0,0 +1,174 @@
+package nats
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/resgateio/resgate/metrics"
+)
+
+// onLameDuckMode is called when the server of a connection enters lame duck
+// mode, before it closes all its connections.
+func (c *Client) onLameDuckMode(conn *nats.Conn) {
+	c.mu.Lock()
+	current := conn == c.mq
+	c.mu.Unlock()
+
+	if !current {
+		c.Logf("Upstream NATS server %s entered lame duck mode", conn.ConnectedUrl())
+		return
+	}
+	c.Logf("NATS server %s entered lame duck mode", conn.ConnectedUrl())
+	go c.switchConnection(conn)
+}
+
+// switchConnection connects to another server in the server pool of the old
+// connection, and moves all subscriptions to the new connection. Once the
+// new subscriptions are active, the old connection is replaced, and it is
+// closed after the request timeout to let any outstanding requests be
+// responded to. Events published while switching may be received twice, so
+// the reconnect handler is called to resynchronize.
+//
+// If the connection cannot be switched, the old connection is kept until the
+// server closes it.
+func (c *Client) switchConnection(old *nats.Conn) {
+	if len(c.jsConsumers) > 0 {
+		c.Logf("Not switching NATS connection, as JetStream consumers cannot be moved")
+		return
+	}
+	servers := otherServers(old)
+	if len(servers) == 0 {
+		c.Logf("Not switching NATS connection, as there is no other server to connect to")
+		return
+	}
+
+	// Connection options are not modified once connected
+	nc, err := nats.Connect(strings.Join(servers, ","), c.opts...)
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Failed to switch NATS connection: %s", connectError(strings.Join(servers, ","), err)))
+		return
+	}
+
+	c.mu.Lock()
+	if c.mq != old {
+		c.retire(nc)
+		c.mu.Unlock()
+		nc.Close()
+		return
+	}
+
+	// Subscribe on the new connection
+	var rcs []*responseCont
+	for sub, rc := range c.mqReqs {
+		if rc.us != nil && rc.us.nc == old && rc.us.sub == sub {
+			rcs = append(rcs, rc)
+		}
+	}
+	subs := make([]*nats.Subscription, 0, len(rcs))
+	for _, rc := range rcs {
+		sub, err := nc.ChanSubscribe(rc.us.sub.Subject, c.mqCh)
+		if err == nil {
+			c.mqReqs[sub] = rc
+			subs = append(subs, sub)
+			continue
+		}
+		for _, sub := range subs {
+			delete(c.mqReqs, sub)
+		}
+		c.retire(nc)
+		c.mu.Unlock()
+		nc.Close()
+		c.Logger.Error(fmt.Sprintf("Failed to switch NATS connection: %s", err))
+		return
+	}
+	if err := nc.FlushTimeout(c.RequestTimeout); err != nil {
+		for _, sub := range subs {
+			delete(c.mqReqs, sub)
+		}
+		c.retire(nc)
+		c.mu.Unlock()
+		nc.Close()
+		c.Logger.Error(fmt.Sprintf("Failed to switch NATS connection: %s", err))
+		return
+	}
+
+	// Cut over to the new connection. Messages already received by the old
+	// subscriptions are still handled until the old connection is closed.
+	oldSubs := make([]*nats.Subscription, 0, len(rcs))
+	for i, rc := range rcs {
+		oldSubs = append(oldSubs, rc.us.sub)
+		rc.us.sub.Unsubscribe()
+		rc.us.sub = subs[i]
+		rc.us.nc = nc
+	}
+	c.mq = nc
+	c.retire(old)
+	c.mu.Unlock()
+
+	c.Logf("Switched NATS connection to %s", nc.ConnectedUrl())
+	metrics.NATSConnected.WithLabelValues(nc.ConnectedClusterName()).Set(1)
+
+	time.AfterFunc(c.RequestTimeout, func() {
+		c.mu.Lock()
+		for _, sub := range oldSubs {
+			delete(c.mqReqs, sub)
+		}
+		c.mu.Unlock()
+		old.Close()
+	})
+
+	if c.reconnectHandler != nil {
+		c.reconnectHandler()
+	}
+}
+
+// otherServers returns the URLs of the servers in the server pool of a
+// connection, except the one connected to.
+func otherServers(conn *nats.Conn) []string {
+	current := conn.ConnectedUrl()
+	var servers []string
+	for _, s := range conn.Servers() {
+		if s != current {
+			servers = append(servers, s)
+		}
+	}
+	return servers
+}
+
+// retire flags a connection that is no longer used, so that its handlers
+// are ignored.
+// Client mutex is held when called.
+func (c *Client) retire(conn *nats.Conn) {
+	if c.retired == nil {
+		c.retired = make(map[*nats.Conn]struct{})
+	}
+	c.retired[conn] = struct{}{}
+}
+
+// isRetired returns true if the connection is retired.
+func (c *Client) isRetired(conn *nats.Conn) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.retired[conn]
+	return ok
+}
+
+// removeRetired removes a closed connection from the retired connections,
+// returning true if it was retired.
+func (c *Client) removeRetired(conn *nats.Conn) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.retired[conn]
+	delete(c.retired, conn)
+	return ok
+}
+
+// closeRetired closes all retired connections.
+// Client mutex is held when called.
+func (c *Client) closeRetired() {
+	for conn := range c.retired {
+		conn.Close()
+	}
+}
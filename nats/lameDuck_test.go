@@ -0,0 +1,76 @@
+package nats
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLameDuck_ServerInLameDuckMode_SwitchesConnection(t *testing.T) {
+	urlB, connsB := newMockServer(t)
+	info := strings.TrimSuffix(mockInfo, "}") + `,"connect_urls":["` + strings.TrimPrefix(urlB, "nats://") + `"]}`
+	urlA, connsA := newMockServerWithInfo(t, info)
+	c := newTestClient(t, urlA, withReconnect())
+	reconnected := make(chan struct{}, 1)
+	c.SetReconnectHandler(func() { reconnected <- struct{}{} })
+	c.SetClosedHandler(func(err error) { t.Errorf("expected no closed handler call, but got: %s", err) })
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	mcA := getMockConn(t, connsA)
+	events := make(chan string, 1)
+	if _, err := c.Subscribe("event.test.model", func(subj string, data []byte, _ map[string][]string, _ error) { events <- string(data) }); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	mcA.assertSub(t, "event.test.model.*")
+
+	// Enter lame duck mode
+	mcA.conn.Write([]byte(strings.TrimSuffix(mockInfo, "}") + `,"ldm":true}` + "\r\n"))
+	mcB := getMockConn(t, connsB)
+	mcB.assertSub(t, "event.test.model.*")
+	select {
+	case <-reconnected:
+	case <-time.After(time.Second):
+		t.Fatal("expected reconnect handler to be called, but it wasn't")
+	}
+
+	// Events are received on the new connection
+	mcB.send("event.test.model.*", "event.test.model.change", `{"values":{"foo":"bar"}}`)
+	select {
+	case data := <-events:
+		if data != `{"values":{"foo":"bar"}}` {
+			t.Errorf("expected event data %s, but got %s", `{"values":{"foo":"bar"}}`, data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected event to be received, but it wasn't")
+	}
+	if c.IsClosed() {
+		t.Fatal("expected client not to be closed")
+	}
+	c.SetClosedHandler(nil)
+	c.Close()
+}
+
+func TestLameDuck_NoOtherServer_KeepsConnection(t *testing.T) {
+	url, conns := newMockServer(t)
+	c := newTestClient(t, url, withReconnect())
+	c.SetReconnectHandler(func() { t.Error("expected no reconnect handler call") })
+	c.SetClosedHandler(func(err error) { t.Errorf("expected no closed handler call, but got: %s", err) })
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	mc := getMockConn(t, conns)
+
+	mc.conn.Write([]byte(strings.TrimSuffix(mockInfo, "}") + `,"ldm":true}` + "\r\n"))
+	select {
+	case <-conns:
+		t.Fatal("expected no new connection")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if c.IsClosed() {
+		t.Fatal("expected client not to be closed")
+	}
+	c.SetClosedHandler(nil)
+	c.SetReconnectHandler(nil)
+	c.Close()
+}
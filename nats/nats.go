@@ -19,11 +19,48 @@ type Client struct {
 	RequestTimeout time.Duration
 	URL            string
 	Creds          string
+	NKeySeed       string
 	ClientCert     string
 	ClientKey      string
 	RootCAs        []string
 	Logger         logger.Logger
 	BufferSize     int
+	// PayloadFormatter formats payloads in trace logging. If nil, payloads
+	// are logged unchanged.
+	PayloadFormatter *logger.PayloadFormatter
+	// TLSServerName overrides the server name used to verify the NATS server
+	// certificate. If empty, the host name of the URL is used.
+	TLSServerName string
+	// TLSInsecureSkipVerify disables verification of the NATS server
+	// certificate. It should only be used for testing.
+	TLSInsecureSkipVerify bool
+	// MaxReconnects is the number of attempts to reconnect after losing the
+	// connection, or -1 for unlimited attempts. If zero, the connection is
+	// closed instead.
+	MaxReconnects int
+	// ReconnectWait is the time to wait between reconnect attempts to the
+	// same server, with a random ReconnectJitter added.
+	ReconnectWait   time.Duration
+	ReconnectJitter time.Duration
+	// ReconnectBufSize is the size in bytes of the buffer for messages
+	// published while reconnecting, or -1 to disable buffering.
+	ReconnectBufSize int
+	// NoRespondersError is the error passed to the response callback when a
+	// request has no responders. If nil, mq.ErrNoResponders is used.
+	NoRespondersError error
+	// NoRespondersRetry is the time to wait before sending a request with no
+	// responders once more, in case the service is restarting. If zero, the
+	// request is not retried.
+	NoRespondersRetry time.Duration
+	// Name is the connection name shown by the NATS server monitoring.
+	Name string
+	// InboxPrefix replaces the _INBOX prefix of the reply subjects of
+	// requests, such as when the account only allows replies on a subject
+	// namespace.
+	InboxPrefix string
+	// NoEcho suppresses delivery of messages published by the connection to
+	// its own subscriptions.
+	NoEcho bool
 
 	mq           *nats.Conn
 	mqCh         chan *nats.Msg
@@ -32,18 +69,70 @@ type Client struct {
 	mu           sync.Mutex
 	closeHandler func(error)
 	stopped      chan struct{}
+	upstreams    []*upstream
+
+	// Query subjects of query events received from an upstream server, and
+	// the same subjects in the order received, to remove them once expired.
+	upstreamQueries    map[string]upstreamQuery
+	upstreamQueryOrder []upstreamQuery
+
+	// Handlers called after losing the connection, and after reconnecting
+	// to a NATS server
+	disconnectHandler func()
+	reconnectHandler  func()
+
+	// Options used to connect, and connections replaced after their server
+	// entered lame duck mode, awaiting to be closed
+	opts    []nats.Option
+	retired map[*nats.Conn]struct{}
+
+	// Request timeout overrides, ordered by pattern length, longest first,
+	// and the timeouts by resource name
+	timeoutPatterns []requestTimeoutPattern
+	timeoutCache    map[string]time.Duration
+
+	// Subject prefixes for resources matching a pattern
+	subjectPrefixes []*subjectPrefix
+
+	// JetStream consumers, and event subscription callbacks by namespace for
+	// events delivered by the consumers
+	jsConsumers []*jetStreamConsumer
+	jsEvents    map[string]mq.Response
+
+	// Loaded credentials, modification time of the file when last checked,
+	// and channel closed to stop watching the file
+	credsMu      sync.Mutex
+	creds        *credentials
+	credsModTime time.Time
+	credsStop    chan struct{}
 }
 
 // Subscription implements the mq.Unsubscriber interface.
 type Subscription struct {
 	c   *Client
 	sub *nats.Subscription
+	nc  *nats.Conn // Connection of sub
+	// Subscriptions on upstream connections, for namespaces not belonging to
+	// a resource, such as system and connection events
+	upstreamSubs []*Subscription
+	// Namespace of events delivered by a JetStream consumer, if sub is nil
+	namespace string
 }
 
 type responseCont struct {
-	isReq bool
-	f     mq.Response
-	t     *time.Timer
+	isReq  bool
+	js     bool
+	f      mq.Response
+	h      mq.RequestHandler
+	t      *time.Timer
+	prefix string        // Subject prefix to remove from event subjects
+	us     *Subscription // Subscription, if not a request or JetStream
+
+	// Request, kept for retrying it on no responders
+	subj    string
+	payload []byte
+	headers map[string][]string
+	retried bool
 }
 
 // Logf writes a formatted log message
@@ -65,22 +154,59 @@ func (c *Client) Tracef(format string, v ...interface{}) {
 	}
 }
 
+// tracePayload writes a trace message with the direction, followed by the
+// inbox and subject if not empty, and the payload formatted by the payload
+// formatter. The payload is only formatted if trace logging is active.
+func (c *Client) tracePayload(dir string, inbox string, subj string, payload []byte) {
+	if !c.Logger.IsTrace() {
+		return
+	}
+	s := dir
+	if inbox != "" {
+		s += " (" + inboxSubstr(inbox) + ")"
+	}
+	if subj != "" {
+		s += " " + subj
+	}
+	c.Logger.Trace(s + ": " + c.PayloadFormatter.Format(payload))
+}
+
 // Connect creates a connection to the nats server.
 func (c *Client) Connect() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.Logf("Connecting to NATS at %s", c.URL)
+	if c.Name != "" {
+		c.Logf("Connecting to NATS at %s as %s", c.URL, c.Name)
+	} else {
+		c.Logf("Connecting to NATS at %s", c.URL)
+	}
 
 	// Create connection options
-	opts := []nats.Option{
-		nats.NoReconnect(),
+	if err := c.validateRequestTimeouts(); err != nil {
+		return err
+	}
+	if err := c.validateSubjectPrefixes(); err != nil {
+		return err
+	}
+	opts, err := c.reconnectOptions()
+	if err != nil {
+		return err
+	}
+	opts = append(opts,
 		nats.ClosedHandler(c.onClose),
 		nats.ErrorHandler(c.onError),
+	)
+	connOpts, err := c.connectionOptions()
+	if err != nil {
+		return err
 	}
-	if c.Creds != "" {
-		opts = append(opts, nats.UserCredentials(c.Creds))
+	opts = append(opts, connOpts...)
+	authOpts, err := c.authOptions()
+	if err != nil {
+		return err
 	}
+	opts = append(opts, authOpts...)
 	if c.ClientCert != "" && c.ClientKey != "" {
 		opts = append(opts, nats.ClientCert(c.ClientCert, c.ClientKey))
 	} else if c.ClientCert != c.ClientKey {
@@ -92,22 +218,45 @@ func (c *Client) Connect() error {
 	if len(c.RootCAs) > 0 {
 		opts = append(opts, nats.RootCAs(c.RootCAs...))
 	}
+	if opt := c.tlsOption(); opt != nil {
+		opts = append(opts, opt)
+	}
+	opts = append(opts, nats.LameDuckModeHandler(c.onLameDuckMode))
 
-	// No reconnects as all resources are instantly stale anyhow
+	// No reconnects by default as all resources are instantly stale anyhow
 	nc, err := nats.Connect(c.URL, opts...)
 	if err != nil {
+		return connectError(c.URL, err)
+	}
+	if err := c.connectUpstreams(opts); err != nil {
+		nc.Close()
+		return err
+	}
+	mqCh := make(chan *nats.Msg, c.BufferSize)
+	if err := c.subscribeJetStream(nc, mqCh); err != nil {
+		c.closeUpstreams()
+		nc.Close()
 		return err
 	}
 
 	c.mq = nc
-	c.mqCh = make(chan *nats.Msg, c.BufferSize)
+	c.opts = opts
+	c.mqCh = mqCh
 	c.mqReqs = make(map[*nats.Subscription]*responseCont)
+	c.jsEvents = make(map[string]mq.Response)
+	for _, jc := range c.jsConsumers {
+		c.mqReqs[jc.sub] = &responseCont{js: true}
+	}
 	c.tq = timerqueue.New(c.onTimeout, c.RequestTimeout)
 	c.stopped = make(chan struct{})
 
 	metrics.NATSConnected.WithLabelValues(c.mq.ConnectedClusterName()).Set(1)
 
 	go c.listener(c.mqCh, c.stopped)
+	if c.credentialsFile() != "" {
+		c.credsStop = make(chan struct{})
+		go c.watchCredentials(c.credsStop)
+	}
 
 	return nil
 }
@@ -147,6 +296,15 @@ func (c *Client) close() chan struct{} {
 		c.mq.Close()
 		c.Debugf("NATS connection closed")
 	}
+	c.closeUpstreams()
+	c.upstreamQueries = nil
+	c.upstreamQueryOrder = nil
+	c.closeRetired()
+	c.clearJetStream()
+	if c.credsStop != nil {
+		close(c.credsStop)
+		c.credsStop = nil
+	}
 
 	c.Debugf("Stopping NATS listener...")
 	close(c.mqCh)
@@ -155,6 +313,7 @@ func (c *Client) close() chan struct{} {
 	c.mq = nil
 	// Set mqReqs to empty map to avoid possible nil reference error in listener
 	c.mqReqs = make(map[*nats.Subscription]*responseCont)
+	c.jsEvents = make(map[string]mq.Response)
 
 	c.tq.Clear()
 	c.tq = nil
@@ -171,10 +330,13 @@ func (c *Client) SetClosedHandler(cb func(error)) {
 }
 
 func (c *Client) onClose(conn *nats.Conn) {
+	if c.removeRetired(conn) {
+		return
+	}
 	if c.closeHandler != nil {
 		err := conn.LastError()
 		c.closeHandler(fmt.Errorf("lost NATS connection: %s", err))
-		metrics.NATSConnected.WithLabelValues(c.mq.ConnectedClusterName()).Set(0)
+		metrics.NATSConnected.WithLabelValues(conn.ConnectedClusterName()).Set(0)
 	}
 }
 
@@ -187,10 +349,21 @@ func (c *Client) onError(conn *nats.Conn, sub *nats.Subscription, err error) {
 
 // SendRequest sends a request to the MQ.
 func (c *Client) SendRequest(subj string, payload []byte, cb mq.Response, requestHeaders map[string][]string) {
-	inbox := nats.NewInbox()
+	c.sendRequest(subj, payload, cb, requestHeaders, false)
+}
+
+func (c *Client) sendRequest(subj string, payload []byte, cb mq.Response, requestHeaders map[string][]string, retried bool) {
+	// Refuse subjects that could match unintended subscriptions
+	if !mq.IsValidSubject(subj) {
+		go cb("", nil, nil, mq.ErrInvalidSubject)
+		return
+	}
+
+	inbox := c.newInbox()
+	prefix := c.subjectPrefix(subj)
 
 	// Validate max control line size
-	if len(subj)+len(inbox) > nats.MAX_CONTROL_LINE_SIZE {
+	if len(prefix)+len(subj)+len(inbox) > nats.MAX_CONTROL_LINE_SIZE {
 		go cb("", nil, nil, mq.ErrSubjectTooLong)
 		return
 	}
@@ -198,50 +371,147 @@ func (c *Client) SendRequest(subj string, payload []byte, cb mq.Response, reques
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	sub, err := c.mq.ChanSubscribe(inbox, c.mqCh)
+	if c.mq == nil {
+		go cb("", nil, nil, nats.ErrConnectionClosed)
+		return
+	}
+
+	// The inbox subscription must be on the connection the request is sent on
+	conn := c.conn(subj)
+
+	// Fail fast on payloads the server would refuse
+	if max := conn.MaxPayload(); max > 0 && int64(len(payload)) > max {
+		go cb("", nil, nil, c.payloadTooLarge(subj, len(payload), max))
+		return
+	}
+
+	sub, err := conn.ChanSubscribe(inbox, c.mqCh)
 	if err != nil {
 		go cb("", nil, nil, err)
 		return
 	}
-	c.Tracef("<== (%s) %s: %s", inboxSubstr(inbox), subj, payload)
+	c.tracePayload("<==", inbox, prefix+subj, payload)
 
-	natsMsg := nats.NewMsg(subj)
+	natsMsg := nats.NewMsg(prefix + subj)
 	natsMsg.Reply = inbox
 	natsMsg.Data = payload
-	natsMsg.Header = requestHeaders
-	err = c.mq.PublishMsg(natsMsg)
+	// Headers are dropped for servers without header support
+	if conn.HeadersSupported() {
+		natsMsg.Header = requestHeaders
+	}
+	err = conn.PublishMsg(natsMsg)
 
 	if err != nil {
 		sub.Unsubscribe()
+		// The headers may exceed what remains of the max payload
+		if err == nats.ErrMaxPayload {
+			err = c.payloadTooLarge(subj, len(payload), conn.MaxPayload())
+		}
 		go cb("", nil, nil, err)
 		return
 	}
 
-	c.tq.Add(sub)
-	c.mqReqs[sub] = &responseCont{isReq: true, f: cb}
+	rc := &responseCont{isReq: true, f: cb, subj: subj, payload: payload, headers: requestHeaders, retried: retried}
+	if d := c.requestTimeout(subj); d > 0 {
+		rc.t = time.AfterFunc(d, func() {
+			c.onTimeout(sub)
+		})
+	} else {
+		c.tq.Add(sub)
+	}
+	c.mqReqs[sub] = rc
+}
+
+// payloadTooLarge logs and returns the error for a request payload exceeding
+// the max payload of the server.
+func (c *Client) payloadTooLarge(subj string, size int, max int64) error {
+	c.Logger.Error(fmt.Sprintf("Request to %s not sent: payload of %d bytes exceeds max payload of %d bytes", subj, size, max))
+	return mq.PayloadTooLargeError(size, max)
+}
+
+// Publish sends a message on a subject to the MQ.
+func (c *Client) Publish(subj string, payload []byte) error {
+	// Refuse subjects that could match unintended subscriptions
+	if !mq.IsValidSubject(subj) {
+		return mq.ErrInvalidSubject
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.mq == nil {
+		return nats.ErrConnectionClosed
+	}
+	c.tracePayload("<=P", "", subj, payload)
+	return c.mq.Publish(subj, payload)
 }
 
 // Subscribe to all events on a resource namespace.
 // The namespace has the format "event."+resource
 func (c *Client) Subscribe(namespace string, cb mq.Response) (mq.Unsubscriber, error) {
+	// Refuse namespaces that could match unintended events
+	if !mq.IsValidSubject(namespace) {
+		return nil, mq.ErrInvalidSubject
+	}
+
+	prefix := c.subjectPrefix(namespace)
+
 	// Validate max control line size
-	if len(namespace) > nats.MAX_CONTROL_LINE_SIZE-2 {
+	if len(prefix)+len(namespace) > nats.MAX_CONTROL_LINE_SIZE-2 {
 		return nil, mq.ErrSubjectTooLong
 	}
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	sub, err := c.mq.ChanSubscribe(namespace+".*", c.mqCh)
+	if jc := c.jetStreamConsumer(namespace); jc != nil {
+		c.Tracef("S=> %s.* (JetStream %s)", namespace, jc.consumer)
+		c.jsEvents[namespace] = cb
+		return &Subscription{c: c, namespace: namespace}, nil
+	}
+
+	conn := c.conn(namespace)
+	sub, err := conn.ChanSubscribe(prefix+namespace+".*", c.mqCh)
 	if err != nil {
 		return nil, err
 	}
 
 	c.Tracef("S=> %s", sub.Subject)
 
-	c.mqReqs[sub] = &responseCont{f: cb}
+	us := &Subscription{c: c, sub: sub, nc: conn}
+	c.mqReqs[sub] = &responseCont{f: cb, prefix: prefix, us: us}
+	if err := c.subscribeUpstreams(us, namespace, prefix, cb); err != nil {
+		us.unsubscribe()
+		return nil, err
+	}
+	return us, nil
+}
+
+// SubscribeRequests subscribes to requests on a subject, calling cb with the
+// reply subject of each request.
+func (c *Client) SubscribeRequests(subject string, cb mq.RequestHandler) (mq.Unsubscriber, error) {
+	// Refuse subjects that could match unintended requests
+	if !mq.IsValidSubject(subject) {
+		return nil, mq.ErrInvalidSubject
+	}
+
+	// Validate max control line size
+	if len(subject) > nats.MAX_CONTROL_LINE_SIZE {
+		return nil, mq.ErrSubjectTooLong
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sub, err := c.mq.ChanSubscribe(subject, c.mqCh)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Tracef("S=> %s", sub.Subject)
 
-	us := &Subscription{c: c, sub: sub}
+	us := &Subscription{c: c, sub: sub, nc: c.mq}
+	c.mqReqs[sub] = &responseCont{h: cb, us: us}
 	return us, nil
 }
 
@@ -250,8 +520,24 @@ func (s *Subscription) Unsubscribe() error {
 	s.c.mu.Lock()
 	defer s.c.mu.Unlock()
 
+	if s.sub == nil {
+		s.c.Tracef("U=> %s.*", s.namespace)
+		delete(s.c.jsEvents, s.namespace)
+		return nil
+	}
+
+	return s.unsubscribe()
+}
+
+// unsubscribe unsubscribes the subscription and any upstream subscriptions.
+// Client mutex is held when called.
+func (s *Subscription) unsubscribe() error {
 	s.c.Tracef("U=> %s", s.sub.Subject)
 
+	for _, us := range s.upstreamSubs {
+		delete(s.c.mqReqs, us.sub)
+		us.sub.Unsubscribe()
+	}
 	delete(s.c.mqReqs, s.sub)
 	return s.sub.Unsubscribe()
 }
@@ -260,13 +546,22 @@ func (c *Client) listener(ch chan *nats.Msg, stopped chan struct{}) {
 	for msg := range ch {
 		c.mu.Lock()
 		rc, ok := c.mqReqs[msg.Sub]
+		if ok && rc.js {
+			f := c.jsEvents[eventNamespace(msg.Subject)]
+			if c.isDuplicateJetStreamMsg(msg) {
+				f = nil
+			}
+			c.mu.Unlock()
+			c.handleJetStreamMsg(msg, f)
+			continue
+		}
 		if ok && rc.isReq {
 			// Is the first character a-z or A-Z?
 			// Then it is a meta response
 			if len(msg.Data) > 0 && (msg.Data[0]|32) >= 'a' && (msg.Data[0]|32) <= 'z' {
 				c.parseMeta(msg, rc)
 				c.mu.Unlock()
-				c.Tracef("==> (%s): %s", inboxSubstr(msg.Subject), msg.Data)
+				c.tracePayload("==>", msg.Subject, "", msg.Data)
 				continue
 			}
 
@@ -277,21 +572,30 @@ func (c *Client) listener(ch chan *nats.Msg, stopped chan struct{}) {
 			}
 			msg.Sub.Unsubscribe()
 		}
+		if ok && rc.us != nil && c.isUpstream(rc.us.nc) {
+			c.addUpstreamQuery(rc.us.nc, msg.Subject[len(rc.prefix):], msg.Data)
+		}
 		c.mu.Unlock()
 
+		if ok && rc.h != nil {
+			c.tracePayload("=>R", "", msg.Subject, msg.Data)
+			rc.h(msg.Subject, msg.Reply, msg.Data)
+			continue
+		}
+
 		if ok {
 			if rc.isReq {
 				// Handle no responders header, if available
 				if len(msg.Data) == 0 && msg.Header.Get("Status") == "503" {
 					c.Tracef("x=> (%s) No responders", inboxSubstr(msg.Subject))
-					rc.f("", nil, nil, mq.ErrNoResponders)
+					c.noResponders(rc.subj, rc.payload, rc.f, rc.headers, rc.retried)
 					continue
 				}
-				c.Tracef("==> (%s): %s", inboxSubstr(msg.Subject), msg.Data)
+				c.tracePayload("==>", msg.Subject, "", msg.Data)
 			} else {
-				c.Tracef("=>> %s: %s", msg.Subject, msg.Data)
+				c.tracePayload("=>>", "", msg.Subject, msg.Data)
 			}
-			rc.f(msg.Subject, msg.Data, msg.Header, nil)
+			rc.f(msg.Subject[len(rc.prefix):], msg.Data, msg.Header, nil)
 		}
 	}
 
@@ -0,0 +1,78 @@
+package nats
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/logger"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+func TestTracePayload_TraceDisabled_DoesNotAllocate(t *testing.T) {
+	c := &Client{
+		Logger:           logger.NewStdLogger(true, false),
+		PayloadFormatter: logger.NewPayloadFormatter(16, []string{"token"}),
+	}
+	payload := []byte(`{"token":"secret","data":"` + strings.Repeat("x", 1024) + `"}`)
+	allocs := testing.AllocsPerRun(100, func() {
+		c.tracePayload("<==", "_INBOX.abcdef123456", "get.test.model", payload)
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, but got %v", allocs)
+	}
+}
+
+func TestSendRequest_PayloadExceedingMaxPayload_ReturnsErrPayloadTooLarge(t *testing.T) {
+	url, conns := newMockServerWithInfo(t, strings.Replace(mockInfo, `"max_payload":1048576`, `"max_payload":64`, 1))
+	c := newTestClient(t, url, withRequestTimeout(5*time.Second))
+	l := c.Logger.(*logger.MemLogger)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	defer c.Close()
+	mc := getMockConn(t, conns)
+
+	errs := make(chan error, 1)
+	payload := []byte(`{"params":"` + strings.Repeat("x", 64) + `"}`)
+	c.SendRequest("call.test.model.method", payload, func(_ string, _ []byte, _ map[string][]string, err error) {
+		errs <- err
+	}, nil)
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("expected a response, but got none")
+	}
+	rerr, ok := err.(*reserr.Error)
+	if !ok || rerr.Code != reserr.CodePayloadTooLarge {
+		t.Fatalf("expected error code %s, but got: %#v", reserr.CodePayloadTooLarge, err)
+	}
+	expectedData := map[string]interface{}{"size": len(payload), "maxPayload": int64(64)}
+	if !reflect.DeepEqual(rerr.Data, expectedData) {
+		t.Errorf("expected error data %#v, but got %#v", expectedData, rerr.Data)
+	}
+	if !strings.Contains(l.String(), "call.test.model.method") {
+		t.Errorf("expected log to contain the request subject, but got:\n%s", l.String())
+	}
+	select {
+	case p := <-mc.pubs:
+		t.Errorf("expected no published message, but got one on %s", p.subject)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func BenchmarkTracePayload_TraceDisabled(b *testing.B) {
+	c := &Client{
+		Logger:           logger.NewStdLogger(true, false),
+		PayloadFormatter: logger.NewPayloadFormatter(4096, []string{"token"}),
+	}
+	payload := []byte(`{"token":"secret","data":"` + strings.Repeat("x", 1<<20) + `"}`)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.tracePayload("<==", "_INBOX.abcdef123456", "get.test.model", payload)
+	}
+}
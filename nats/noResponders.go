@@ -0,0 +1,25 @@
+package nats
+
+import (
+	"time"
+
+	"github.com/resgateio/resgate/server/mq"
+)
+
+// noResponders calls the response callback of a request with no responders.
+// If NoRespondersRetry is set, and the request has not been retried, the
+// request is sent once more after the retry delay.
+func (c *Client) noResponders(subj string, payload []byte, cb mq.Response, requestHeaders map[string][]string, retried bool) {
+	if c.NoRespondersRetry > 0 && !retried {
+		c.Tracef("x=> %s: No responders, retrying in %s", subj, c.NoRespondersRetry)
+		time.AfterFunc(c.NoRespondersRetry, func() {
+			c.sendRequest(subj, payload, cb, requestHeaders, true)
+		})
+		return
+	}
+	err := c.NoRespondersError
+	if err == nil {
+		err = mq.ErrNoResponders
+	}
+	cb("", nil, nil, err)
+}
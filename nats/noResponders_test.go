@@ -0,0 +1,106 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server/mq"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+type noRespondersResult struct {
+	data []byte
+	err  error
+}
+
+func sendNoRespondersTestRequest(c *Client) chan noRespondersResult {
+	ch := make(chan noRespondersResult, 1)
+	c.SendRequest("get.test.model", nil, func(_ string, data []byte, _ map[string][]string, err error) {
+		ch <- noRespondersResult{data: data, err: err}
+	}, nil)
+	return ch
+}
+
+func getNoRespondersResult(t *testing.T, ch chan noRespondersResult, within time.Duration) noRespondersResult {
+	select {
+	case r := <-ch:
+		return r
+	case <-time.After(within):
+		t.Fatalf("expected a response within %s, but got none", within)
+	}
+	return noRespondersResult{}
+}
+
+func TestSendRequest_NoResponders_ReturnsErrorBeforeTimeout(t *testing.T) {
+	tbl := []struct {
+		NoRespondersError error
+		ExpectedCode      string
+	}{
+		{nil, reserr.CodeNotFound},
+		{reserr.ErrServiceUnavailable, reserr.CodeServiceUnavailable},
+	}
+
+	for _, l := range tbl {
+		c := newTestClient(t, newMockRouter(t), withRequestTimeout(5*time.Second))
+		c.NoRespondersError = l.NoRespondersError
+		if err := c.Connect(); err != nil {
+			t.Fatalf("expected no error, but got: %s", err)
+		}
+
+		r := getNoRespondersResult(t, sendNoRespondersTestRequest(c), time.Second)
+		if l.NoRespondersError == nil && r.err != mq.ErrNoResponders {
+			t.Errorf("expected error %v, but got %v", mq.ErrNoResponders, r.err)
+		}
+		if code := reserr.RESError(r.err).Code; code != l.ExpectedCode {
+			t.Errorf("expected error code %#v, but got %#v", l.ExpectedCode, code)
+		}
+	}
+}
+
+func TestSendRequest_NoRespondersWithRetry_RetriesOnce(t *testing.T) {
+	url := newMockRouter(t)
+	c := newTestClient(t, url, withRequestTimeout(5*time.Second))
+	c.NoRespondersRetry = 300 * time.Millisecond
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	s := newTestClient(t, url, withRequestTimeout(5*time.Second))
+	if err := s.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+
+	ch := sendNoRespondersTestRequest(c)
+	// Start responding while the request awaits the retry
+	time.Sleep(50 * time.Millisecond)
+	if _, err := s.SubscribeRequests("get.test.model", func(_ string, reply string, _ []byte) {
+		s.Publish(reply, []byte(`{"result":{"model":{"foo":"bar"}}}`))
+	}); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+
+	r := getNoRespondersResult(t, ch, time.Second)
+	if r.err != nil {
+		t.Fatalf("expected no error, but got: %s", r.err)
+	}
+	if string(r.data) != `{"result":{"model":{"foo":"bar"}}}` {
+		t.Errorf("expected response data, but got: %s", r.data)
+	}
+}
+
+func TestSendRequest_NoRespondersAfterRetry_ReturnsError(t *testing.T) {
+	c := newTestClient(t, newMockRouter(t), withRequestTimeout(5*time.Second))
+	c.NoRespondersRetry = 50 * time.Millisecond
+	c.NoRespondersError = reserr.ErrServiceUnavailable
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+
+	start := time.Now()
+	r := getNoRespondersResult(t, sendNoRespondersTestRequest(c), time.Second)
+	if r.err != reserr.ErrServiceUnavailable {
+		t.Errorf("expected error %v, but got %v", reserr.ErrServiceUnavailable, r.err)
+	}
+	if d := time.Since(start); d < c.NoRespondersRetry {
+		t.Errorf("expected error after retry delay %s, but got it after %s", c.NoRespondersRetry, d)
+	}
+}
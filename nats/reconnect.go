@@ -0,0 +1,83 @@
+package nats
+
+import (
+	"errors"
+	"fmt"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/resgateio/resgate/metrics"
+)
+
+// reconnectOptions returns the options for reconnecting to the NATS server
+// after losing the connection. Reconnects are disabled unless MaxReconnects
+// is set. Any duration or buffer size not set uses the NATS client default.
+func (c *Client) reconnectOptions() ([]nats.Option, error) {
+	if c.MaxReconnects == 0 {
+		return []nats.Option{nats.NoReconnect()}, nil
+	}
+	if c.ReconnectWait < 0 {
+		return nil, errors.New("invalid NATS reconnect wait: must be zero or a positive duration")
+	}
+	if c.ReconnectJitter < 0 {
+		return nil, errors.New("invalid NATS reconnect jitter: must be zero or a positive duration")
+	}
+
+	opts := []nats.Option{
+		nats.MaxReconnects(c.MaxReconnects),
+		nats.DisconnectErrHandler(c.onDisconnect),
+		nats.ReconnectHandler(c.onReconnect),
+	}
+	if c.ReconnectWait > 0 {
+		opts = append(opts, nats.ReconnectWait(c.ReconnectWait))
+	}
+	if c.ReconnectJitter > 0 {
+		opts = append(opts, nats.ReconnectJitter(c.ReconnectJitter, c.ReconnectJitter))
+	}
+	if c.ReconnectBufSize != 0 {
+		opts = append(opts, nats.ReconnectBufSize(c.ReconnectBufSize))
+	}
+	return opts, nil
+}
+
+// SetReconnectHandler sets the handler called after the connection to a NATS
+// server is reestablished. Subscriptions are resubscribed by the NATS client,
+// but any event published while disconnected is lost.
+func (c *Client) SetReconnectHandler(cb func()) {
+	c.reconnectHandler = cb
+}
+
+// SetDisconnectHandler sets the handler called when the connection to the
+// NATS server is lost, and the client starts to reconnect. It is not called
+// if reconnects are disabled, as the client is then closed.
+func (c *Client) SetDisconnectHandler(cb func()) {
+	c.disconnectHandler = cb
+}
+
+func (c *Client) onDisconnect(conn *nats.Conn, err error) {
+	if c.isRetired(conn) {
+		return
+	}
+	if err != nil {
+		c.Logger.Error(fmt.Sprintf("Disconnected from NATS: %s", err))
+	} else {
+		c.Logger.Error("Disconnected from NATS")
+	}
+	metrics.NATSConnected.WithLabelValues(conn.ConnectedClusterName()).Set(0)
+	if !conn.IsClosed() {
+		c.Logf("Reconnecting to NATS...")
+		if c.disconnectHandler != nil {
+			c.disconnectHandler()
+		}
+	}
+}
+
+func (c *Client) onReconnect(conn *nats.Conn) {
+	if c.isRetired(conn) {
+		return
+	}
+	c.Logf("Reconnected to NATS at %s", conn.ConnectedUrl())
+	metrics.NATSConnected.WithLabelValues(conn.ConnectedClusterName()).Set(1)
+	if c.reconnectHandler != nil {
+		c.reconnectHandler()
+	}
+}
@@ -0,0 +1,93 @@
+package nats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnect_LostConnection_ResubscribesAndCallsHandler(t *testing.T) {
+	url, conns := newMockServer(t)
+	c := newTestClient(t, url, withReconnect())
+	reconnected := make(chan struct{}, 1)
+	c.SetReconnectHandler(func() { reconnected <- struct{}{} })
+	c.SetClosedHandler(func(err error) { t.Errorf("expected no closed handler call, but got: %s", err) })
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	mc := getMockConn(t, conns)
+	if _, err := c.Subscribe("event.test.model", func(string, []byte, map[string][]string, error) {}); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	mc.assertSub(t, "event.test.model.*")
+
+	// Kill the connection
+	mc.conn.Close()
+	mc = getMockConn(t, conns)
+	mc.assertSub(t, "event.test.model.*")
+	select {
+	case <-reconnected:
+	case <-time.After(time.Second):
+		t.Fatal("expected reconnect handler to be called, but it wasn't")
+	}
+	if c.IsClosed() {
+		t.Fatal("expected client not to be closed")
+	}
+	c.SetClosedHandler(nil)
+	c.Close()
+}
+
+func TestReconnect_LostConnection_CallsDisconnectHandlerBeforeReconnect(t *testing.T) {
+	url, conns := newMockServer(t)
+	c := newTestClient(t, url, withReconnect())
+	events := make(chan string, 2)
+	c.SetDisconnectHandler(func() { events <- "disconnect" })
+	c.SetReconnectHandler(func() { events <- "reconnect" })
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	defer c.Close()
+
+	getMockConn(t, conns).conn.Close()
+	getMockConn(t, conns)
+	for _, expected := range []string{"disconnect", "reconnect"} {
+		select {
+		case ev := <-events:
+			if ev != expected {
+				t.Fatalf("expected %s handler to be called, but got %s", expected, ev)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected %s handler to be called, but it wasn't", expected)
+		}
+	}
+}
+
+func TestReconnect_NoMaxReconnects_ClosesOnLostConnection(t *testing.T) {
+	url, conns := newMockServer(t)
+	c := newTestClient(t, url, withReconnect())
+	c.MaxReconnects = 0
+	c.SetDisconnectHandler(func() { t.Error("expected no disconnect handler call") })
+	c.SetReconnectHandler(func() { t.Error("expected no reconnect handler call") })
+	closed := make(chan error, 1)
+	c.SetClosedHandler(func(err error) { closed <- err })
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	defer c.Close()
+
+	getMockConn(t, conns).conn.Close()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("expected closed handler to be called, but it wasn't")
+	}
+}
+
+func TestReconnect_NegativeReconnectWait_ReturnsError(t *testing.T) {
+	url, _ := newMockServer(t)
+	c := newTestClient(t, url, withReconnect())
+	c.ReconnectWait = -time.Second
+	if err := c.Connect(); err == nil {
+		c.Close()
+		t.Fatal("expected an error, but got none")
+	}
+}
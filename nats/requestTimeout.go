@@ -0,0 +1,83 @@
+package nats
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/resgateio/resgate/server/rescache"
+)
+
+// requestTimeoutCacheSize is the maximum number of resource names with a
+// cached request timeout. The cache is cleared when exceeded.
+const requestTimeoutCacheSize = 10000
+
+// requestTimeoutPattern is a request timeout for resources matching a
+// pattern.
+type requestTimeoutPattern struct {
+	pattern string
+	p       rescache.ResourcePattern
+	timeout time.Duration
+}
+
+// SetRequestTimeoutOverrides sets the timeouts of get, access, call, and auth
+// requests for resources matching a resource pattern, overriding
+// RequestTimeout. The longest matching pattern applies. The timeout for a
+// resource name is cached on first request. It must be called before Connect.
+func (c *Client) SetRequestTimeoutOverrides(overrides map[string]time.Duration) *Client {
+	c.timeoutPatterns = make([]requestTimeoutPattern, 0, len(overrides))
+	for p, d := range overrides {
+		c.timeoutPatterns = append(c.timeoutPatterns, requestTimeoutPattern{
+			pattern: p,
+			p:       rescache.ParseResourcePattern(p),
+			timeout: d,
+		})
+	}
+	sort.Slice(c.timeoutPatterns, func(i, j int) bool {
+		return len(c.timeoutPatterns[i].pattern) > len(c.timeoutPatterns[j].pattern)
+	})
+	return c
+}
+
+// validateRequestTimeouts returns an error if any request timeout override
+// has an invalid pattern or timeout.
+func (c *Client) validateRequestTimeouts() error {
+	for _, tp := range c.timeoutPatterns {
+		if !tp.p.IsValid() {
+			return fmt.Errorf("invalid request timeout resource pattern: %s", tp.pattern)
+		}
+		if tp.timeout <= 0 {
+			return fmt.Errorf("invalid request timeout for %s: must be a positive duration", tp.pattern)
+		}
+	}
+	return nil
+}
+
+// requestTimeout returns the timeout overriding RequestTimeout for a request
+// subject, or zero if no override applies.
+// Client mutex is held when called.
+func (c *Client) requestTimeout(subj string) time.Duration {
+	if len(c.timeoutPatterns) == 0 {
+		return 0
+	}
+	rname, ok := subjectResourceName(subj)
+	if !ok {
+		return 0
+	}
+	if d, ok := c.timeoutCache[rname]; ok {
+		return d
+	}
+
+	var d time.Duration
+	for _, tp := range c.timeoutPatterns {
+		if tp.p.Match(rname) {
+			d = tp.timeout
+			break
+		}
+	}
+	if c.timeoutCache == nil || len(c.timeoutCache) >= requestTimeoutCacheSize {
+		c.timeoutCache = make(map[string]time.Duration)
+	}
+	c.timeoutCache[rname] = d
+	return d
+}
@@ -0,0 +1,123 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server/mq"
+)
+
+// testRequestTimeoutOverrides are the request timeout overrides used by the
+// tests, with a request timeout of 50 milliseconds.
+var testRequestTimeoutOverrides = map[string]time.Duration{
+	"search.>":         500 * time.Millisecond,
+	"search.fast.>":    20 * time.Millisecond,
+	"search.*.archive": time.Second,
+}
+
+// sendSlowRequest sends a request responded to after delay, and returns the
+// error passed to the response callback.
+func sendSlowRequest(t *testing.T, c *Client, mc *mockConn, subj string, delay time.Duration) error {
+	errs := make(chan error, 1)
+	c.SendRequest(subj, nil, func(_ string, _ []byte, _ map[string][]string, err error) {
+		errs <- err
+	}, nil)
+	p := mc.getPub(t)
+	if p.subject != subj {
+		t.Fatalf("expected request on %s, but got %s", subj, p.subject)
+	}
+	time.Sleep(delay)
+	mc.respond(p.reply, `{"result":null}`)
+	select {
+	case err := <-errs:
+		return err
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a response, but got none")
+	}
+	return nil
+}
+
+func TestRequestTimeoutOverrides_MatchingPattern_UsesExtendedTimeout(t *testing.T) {
+	url, conns := newMockServer(t)
+	c := newTestClient(t, url, withRequestTimeout(50*time.Millisecond), withRequestTimeoutOverrides(testRequestTimeoutOverrides))
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	mc := getMockConn(t, conns)
+	for _, subj := range []string{"get.search.query", "access.search.query", "call.search.query.run", "auth.search.query.login"} {
+		if err := sendSlowRequest(t, c, mc, subj, 150*time.Millisecond); err != nil {
+			t.Errorf("expected no error for %s, but got: %s", subj, err)
+		}
+	}
+}
+
+func TestRequestTimeoutOverrides_NonMatchingPattern_UsesRequestTimeout(t *testing.T) {
+	url, conns := newMockServer(t)
+	c := newTestClient(t, url, withRequestTimeout(50*time.Millisecond), withRequestTimeoutOverrides(testRequestTimeoutOverrides))
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	mc := getMockConn(t, conns)
+	for _, subj := range []string{"get.test.model", "call.test.model.search"} {
+		if err := sendSlowRequest(t, c, mc, subj, 150*time.Millisecond); err != mq.ErrRequestTimeout {
+			t.Errorf("expected request timeout for %s, but got: %v", subj, err)
+		}
+	}
+}
+
+func TestRequestTimeoutOverrides_LongestPattern_Applies(t *testing.T) {
+	url, conns := newMockServer(t)
+	c := newTestClient(t, url, withRequestTimeout(50*time.Millisecond), withRequestTimeoutOverrides(testRequestTimeoutOverrides))
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	mc := getMockConn(t, conns)
+	if err := sendSlowRequest(t, c, mc, "get.search.fast.query", 100*time.Millisecond); err != mq.ErrRequestTimeout {
+		t.Errorf("expected request timeout, but got: %v", err)
+	}
+}
+
+func TestRequestTimeout_CachesTimeoutByResourceName(t *testing.T) {
+	c := (&Client{}).SetRequestTimeoutOverrides(map[string]time.Duration{
+		"search.>":         time.Second,
+		"search.*.archive": 2 * time.Second,
+	})
+	tbl := []struct {
+		Subject string
+		Timeout time.Duration
+	}{
+		{"get.search.query", time.Second},
+		{"access.search.query", time.Second},
+		{"call.search.query.run", time.Second},
+		{"get.search.user.archive", 2 * time.Second},
+		{"get.test.model", 0},
+		{"system.reset", 0},
+	}
+	for i, l := range tbl {
+		if d := c.requestTimeout(l.Subject); d != l.Timeout {
+			t.Errorf("expected requestTimeout(%#v) to return %s, but got %s in test %d", l.Subject, l.Timeout, d, i+1)
+		}
+	}
+	if len(c.timeoutCache) != 3 {
+		t.Errorf("expected 3 cached resource names, but got %d", len(c.timeoutCache))
+	}
+	// Cached value is used
+	c.timeoutCache["test.model"] = time.Minute
+	if d := c.requestTimeout("get.test.model"); d != time.Minute {
+		t.Errorf("expected cached timeout %s, but got %s", time.Minute, d)
+	}
+}
+
+func TestConnect_InvalidRequestTimeoutOverride_ReturnsError(t *testing.T) {
+	for _, overrides := range []map[string]time.Duration{
+		{"search.>.foo": time.Second},
+		{"search.>": 0},
+	} {
+		url, _ := newMockServer(t)
+		c := newTestClient(t, url).SetRequestTimeoutOverrides(overrides)
+		if err := c.Connect(); err == nil {
+			c.Close()
+			t.Errorf("expected an error for %v, but got none", overrides)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package nats
+
+import (
+	"fmt"
+
+	"github.com/resgateio/resgate/server/mq"
+	"github.com/resgateio/resgate/server/rescache"
+)
+
+// subjectPrefix is a prefix added to the NATS subjects of requests and event
+// subscriptions for resources matching a pattern.
+type subjectPrefix struct {
+	prefix  string
+	pattern string
+	p       rescache.ResourcePattern
+}
+
+// WithSubjectPrefix adds a prefix to the NATS subjects of get, access, call,
+// auth, and new requests, and event subscriptions, for resources matching
+// resourcePattern. Only the subjects are prefixed. Resource IDs in payloads,
+// and subjects passed to event callbacks, are left unprefixed. If multiple
+// patterns match a resource, the first one added applies. It must be called
+// before Connect.
+//
+// Requests sent to a subject given by the service, such as query requests in
+// response to query events, are sent without prefix.
+func (c *Client) WithSubjectPrefix(prefix string, resourcePattern string) *Client {
+	c.subjectPrefixes = append(c.subjectPrefixes, &subjectPrefix{
+		prefix:  prefix,
+		pattern: resourcePattern,
+		p:       rescache.ParseResourcePattern(resourcePattern),
+	})
+	return c
+}
+
+// validateSubjectPrefixes returns an error if any subject prefix has an
+// invalid prefix or pattern.
+func (c *Client) validateSubjectPrefixes() error {
+	for _, sp := range c.subjectPrefixes {
+		if !mq.IsValidSubject(sp.prefix) {
+			return fmt.Errorf("invalid subject prefix for %s: %s", sp.pattern, sp.prefix)
+		}
+		if !sp.p.IsValid() {
+			return fmt.Errorf("invalid subject prefix resource pattern: %s", sp.pattern)
+		}
+	}
+	return nil
+}
+
+// subjectPrefix returns the prefix, including the trailing dot, to add to a
+// request subject or event namespace, or an empty string if no prefix
+// applies.
+func (c *Client) subjectPrefix(subj string) string {
+	if len(c.subjectPrefixes) > 0 {
+		if rname, ok := subjectResourceName(subj); ok {
+			for _, sp := range c.subjectPrefixes {
+				if sp.p.Match(rname) {
+					return sp.prefix + "."
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,107 @@
+package nats
+
+import (
+	"testing"
+	"time"
+)
+
+func newSubjectPrefixTestClient(t *testing.T) (*Client, *mockConn) {
+	url, conns := newMockServer(t)
+	c := newTestClient(t, url).
+		WithSubjectPrefix("stg", "test.>").
+		WithSubjectPrefix("prd", ">")
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	return c, getMockConn(t, conns)
+}
+
+func TestSubjectPrefix_Request_SendsPrefixedSubject(t *testing.T) {
+	c, mc := newSubjectPrefixTestClient(t)
+	tbl := []struct {
+		Subject  string
+		Expected string
+	}{
+		{"get.test.model", "stg.get.test.model"},
+		{"access.test.model", "stg.access.test.model"},
+		{"call.test.model.method", "stg.call.test.model.method"},
+		{"auth.test.model.login", "stg.auth.test.model.login"},
+		{"new.test.collection", "stg.new.test.collection"},
+		{"get.example.model", "prd.get.example.model"},
+		// Subject given by service for query events
+		{"_EVENT_01_", "_EVENT_01_"},
+	}
+	for i, l := range tbl {
+		resp := make(chan []byte, 1)
+		c.SendRequest(l.Subject, []byte(`{}`), func(_ string, data []byte, _ map[string][]string, err error) {
+			if err != nil {
+				t.Errorf("expected no error, but got: %s", err)
+			}
+			resp <- data
+		}, nil)
+		p := mc.getPub(t)
+		if p.subject != l.Expected {
+			t.Errorf("expected request on %#v, but got %#v in test %d", l.Expected, p.subject, i+1)
+		}
+		mc.respond(p.reply, `{"result":null}`)
+		select {
+		case <-resp:
+		case <-time.After(time.Second):
+			t.Fatalf("expected a response, but got none in test %d", i+1)
+		}
+	}
+}
+
+func TestSubjectPrefix_Subscribe_SubscribesPrefixedSubject(t *testing.T) {
+	c, mc := newSubjectPrefixTestClient(t)
+	events := make(chan string, 1)
+	if _, err := c.Subscribe("event.test.model", func(subj string, _ []byte, _ map[string][]string, _ error) {
+		events <- subj
+	}); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	mc.assertSub(t, "stg.event.test.model.*")
+	mc.send("stg.event.test.model.*", "stg.event.test.model.change", `{"values":{"foo":"bar"}}`)
+	select {
+	case subj := <-events:
+		if subj != "event.test.model.change" {
+			t.Errorf("expected event subject %#v, but got %#v", "event.test.model.change", subj)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected an event, but got none")
+	}
+}
+
+func TestSubjectPrefix_NoMatchingPattern_SendsUnprefixedSubject(t *testing.T) {
+	url, conns := newMockServer(t)
+	c := newTestClient(t, url).WithSubjectPrefix("stg", "test.>")
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	defer c.Close()
+	mc := getMockConn(t, conns)
+	c.SendRequest("get.example.model", []byte(`{}`), func(string, []byte, map[string][]string, error) {}, nil)
+	if p := mc.getPub(t); p.subject != "get.example.model" {
+		t.Errorf("expected request on %#v, but got %#v", "get.example.model", p.subject)
+	}
+}
+
+func TestConnect_InvalidSubjectPrefix_ReturnsError(t *testing.T) {
+	tbl := []struct {
+		Prefix  string
+		Pattern string
+	}{
+		{"", ">"},
+		{"stg.", ">"},
+		{"stg.*", ">"},
+		{"stg", "test.>.model"},
+	}
+	for i, l := range tbl {
+		url, _ := newMockServer(t)
+		c := newTestClient(t, url).WithSubjectPrefix(l.Prefix, l.Pattern)
+		if err := c.Connect(); err == nil {
+			c.Close()
+			t.Errorf("expected an error, but got none in test %d", i+1)
+		}
+	}
+}
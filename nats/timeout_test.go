@@ -0,0 +1,39 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server/mq"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+func TestSendRequest_NoResponse_ReturnsTimeoutError(t *testing.T) {
+	url, _ := newMockServer(t)
+	c := newTestClient(t, url, withRequestTimeout(50*time.Millisecond))
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	defer c.Close()
+
+	errs := make(chan error, 1)
+	start := time.Now()
+	c.SendRequest("get.test.model", nil, func(_ string, _ []byte, _ map[string][]string, err error) {
+		errs <- err
+	}, nil)
+
+	select {
+	case err := <-errs:
+		if err != mq.ErrRequestTimeout {
+			t.Fatalf("expected request timeout error, but got: %v", err)
+		}
+		if code := err.(*reserr.Error).Code; code != reserr.CodeTimeout {
+			t.Errorf("expected error code %#v, but got %#v", reserr.CodeTimeout, code)
+		}
+		if d := time.Since(start); d < c.RequestTimeout {
+			t.Errorf("expected timeout after %s, but got it after %s", c.RequestTimeout, d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a timeout error, but got none")
+	}
+}
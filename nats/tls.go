@@ -0,0 +1,55 @@
+package nats
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// tlsOption returns an option setting the server name and
+// InsecureSkipVerify of the TLS configuration, or nil if neither is set. It
+// should be added after any other TLS option.
+func (c *Client) tlsOption() nats.Option {
+	if c.TLSServerName == "" && !c.TLSInsecureSkipVerify {
+		return nil
+	}
+	return func(o *nats.Options) error {
+		if o.TLSConfig == nil {
+			o.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		o.TLSConfig.ServerName = c.TLSServerName
+		o.TLSConfig.InsecureSkipVerify = c.TLSInsecureSkipVerify
+		o.Secure = true
+		return nil
+	}
+}
+
+// connectError returns an error describing a failed TLS handshake with the
+// NATS server at url, if err is caused by one. Otherwise err is returned.
+func connectError(url string, err error) error {
+	if isTLSError(err) {
+		return fmt.Errorf("TLS handshake with NATS server at %s failed: %s", url, err)
+	}
+	return err
+}
+
+// isTLSError returns true if the error is caused by a TLS handshake failure,
+// or by a TLS setting mismatch between the client and server.
+func isTLSError(err error) bool {
+	if errors.Is(err, nats.ErrSecureConnWanted) || errors.Is(err, nats.ErrSecureConnRequired) {
+		return true
+	}
+	var uaErr x509.UnknownAuthorityError
+	var hErr x509.HostnameError
+	var ciErr x509.CertificateInvalidError
+	var rhErr tls.RecordHeaderError
+	if errors.As(err, &uaErr) || errors.As(err, &hErr) || errors.As(err, &ciErr) || errors.As(err, &rhErr) {
+		return true
+	}
+	// Alerts sent by the server, such as on a rejected client certificate
+	return strings.Contains(err.Error(), "tls: ")
+}
@@ -0,0 +1,241 @@
+package nats
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA is a certificate authority issuing certificates for tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+func newTestCA(t *testing.T, dir string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "ca.pem")
+	writeFile(t, file, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), time.Now())
+	return &testCA{cert: cert, key: key, file: file}
+}
+
+// issue issues a certificate, written to files in dir prefixed with name.
+// The certificate and key file paths are returned, together with the
+// certificate.
+func (ca *testCA) issue(t *testing.T, dir, name string, usage x509.ExtKeyUsage, dnsNames []string, ips []net.IP) (string, string, tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	certFile, keyFile := filepath.Join(dir, name+"-cert.pem"), filepath.Join(dir, name+"-key.pem")
+	writeFile(t, certFile, string(certPEM), time.Now())
+	writeFile(t, keyFile, string(keyPEM), time.Now())
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+// tlsTestEnv holds a CA, with a client certificate and a server certificate
+// valid for 127.0.0.1, issued by the CA.
+type tlsTestEnv struct {
+	ca         *testCA
+	clientCert string
+	clientKey  string
+	serverCert tls.Certificate
+	dir        string
+}
+
+func newTLSTestEnv(t *testing.T) *tlsTestEnv {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	clientCert, clientKey, _ := ca.issue(t, dir, "client", x509.ExtKeyUsageClientAuth, nil, nil)
+	_, _, serverCert := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth, nil, []net.IP{net.ParseIP("127.0.0.1")})
+	return &tlsTestEnv{ca: ca, clientCert: clientCert, clientKey: clientKey, serverCert: serverCert, dir: dir}
+}
+
+// serverConfig returns a TLS configuration for the server, requiring a
+// client certificate issued by the CA if requireClientCert is true.
+func (e *tlsTestEnv) serverConfig(cert tls.Certificate, requireClientCert bool) *tls.Config {
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if requireClientCert {
+		pool := x509.NewCertPool()
+		pool.AddCert(e.ca.cert)
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg
+}
+
+// newMockTLSServer starts a mock NATS server requiring TLS, and returns its
+// URL. It responds to pings once the TLS handshake is completed.
+func newMockTLSServer(t *testing.T, cfg *tls.Config) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveMockTLSConn(conn, cfg)
+		}
+	}()
+	return "nats://" + ln.Addr().String()
+}
+
+func serveMockTLSConn(conn net.Conn, cfg *tls.Config) {
+	defer conn.Close()
+	if _, err := conn.Write([]byte(`INFO {"server_id":"mock","version":"2.6.4","proto":1,"tls_required":true,"max_payload":1048576}` + "\r\n")); err != nil {
+		return
+	}
+	tc := tls.Server(conn, cfg)
+	if err := tc.Handshake(); err != nil {
+		return
+	}
+	r := bufio.NewReader(tc)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if strings.HasPrefix(line, "PING") {
+			if _, err := tc.Write([]byte("PONG\r\n")); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func assertConnects(t *testing.T, c *Client) {
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	c.Close()
+}
+
+func assertTLSError(t *testing.T, c *Client) {
+	err := c.Connect()
+	if err == nil {
+		c.Close()
+		t.Fatal("expected an error, but got none")
+	}
+	if !strings.HasPrefix(err.Error(), "TLS handshake with NATS server at "+c.URL+" failed: ") {
+		t.Fatalf("expected a TLS handshake error, but got: %s", err)
+	}
+}
+
+func TestConnect_MutualTLS_Connects(t *testing.T) {
+	e := newTLSTestEnv(t)
+	c := newTestClient(t, newMockTLSServer(t, e.serverConfig(e.serverCert, true)))
+	c.RootCAs = []string{e.ca.file}
+	c.ClientCert = e.clientCert
+	c.ClientKey = e.clientKey
+	assertConnects(t, c)
+}
+
+func TestConnect_MissingClientCert_ReturnsError(t *testing.T) {
+	e := newTLSTestEnv(t)
+	c := newTestClient(t, newMockTLSServer(t, e.serverConfig(e.serverCert, true)))
+	c.RootCAs = []string{e.ca.file}
+	if err := c.Connect(); err == nil {
+		c.Close()
+		t.Fatal("expected an error, but got none")
+	}
+}
+
+func TestConnect_UnknownCA_ReturnsTLSError(t *testing.T) {
+	e := newTLSTestEnv(t)
+	c := newTestClient(t, newMockTLSServer(t, e.serverConfig(e.serverCert, false)))
+	assertTLSError(t, c)
+}
+
+func TestConnect_InsecureSkipVerify_Connects(t *testing.T) {
+	e := newTLSTestEnv(t)
+	c := newTestClient(t, newMockTLSServer(t, e.serverConfig(e.serverCert, false)))
+	c.TLSInsecureSkipVerify = true
+	assertConnects(t, c)
+}
+
+func TestConnect_ServerNameMismatch_ReturnsTLSError(t *testing.T) {
+	e := newTLSTestEnv(t)
+	_, _, cert := e.ca.issue(t, e.dir, "named", x509.ExtKeyUsageServerAuth, []string{"nats.example.com"}, nil)
+	c := newTestClient(t, newMockTLSServer(t, e.serverConfig(cert, false)))
+	c.RootCAs = []string{e.ca.file}
+	assertTLSError(t, c)
+}
+
+func TestConnect_ServerNameOverride_Connects(t *testing.T) {
+	e := newTLSTestEnv(t)
+	_, _, cert := e.ca.issue(t, e.dir, "named", x509.ExtKeyUsageServerAuth, []string{"nats.example.com"}, nil)
+	c := newTestClient(t, newMockTLSServer(t, e.serverConfig(cert, true)))
+	c.RootCAs = []string{e.ca.file}
+	c.ClientCert = e.clientCert
+	c.ClientKey = e.clientKey
+	c.TLSServerName = "nats.example.com"
+	assertConnects(t, c)
+}
+
+func TestConnect_TLSNotAvailable_ReturnsTLSError(t *testing.T) {
+	e := newTLSTestEnv(t)
+	m := newMockJetStream(t, "event.>", 0)
+	c := newTestClient(t, m.URL())
+	c.RootCAs = []string{e.ca.file}
+	assertTLSError(t, c)
+}
@@ -0,0 +1,199 @@
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/resgateio/resgate/server/mq"
+	"github.com/resgateio/resgate/server/rescache"
+)
+
+// upstreamQueryTTL is the time the subject of a query event received from an
+// upstream server is kept, for sending query requests to the same server.
+const upstreamQueryTTL = time.Minute
+
+// upstream is a connection to a separate NATS server, handling requests and
+// event subscriptions for resources matching a pattern.
+type upstream struct {
+	url     string
+	pattern string
+	p       rescache.ResourcePattern
+	mq      *nats.Conn
+}
+
+// upstreamQuery is the subject of a query event received from an upstream
+// server.
+type upstreamQuery struct {
+	subj     string
+	nc       *nats.Conn
+	received time.Time
+}
+
+// WithUpstream adds an upstream NATS server to forward get, access, call, and
+// auth requests, and event subscriptions, for resources matching
+// resourcePattern. This mirrors the resources of another cluster, such as the
+// one of a primary datacenter, letting this resgate act as a fan-out layer for
+// its own clients. Responses and events are handled by the same listener as
+// for the main connection. If multiple patterns match a resource, the first
+// one added applies. It must be called before Connect.
+//
+// Subscriptions to namespaces not belonging to a resource, such as system and
+// connection events, are made on the main and all upstream connections, so
+// that a system reset or a connection token event from an upstream service is
+// received. Query requests in response to a query event are sent on the
+// connection the event was received on.
+func (c *Client) WithUpstream(natsURL string, resourcePattern string) *Client {
+	c.upstreams = append(c.upstreams, &upstream{
+		url:     natsURL,
+		pattern: resourcePattern,
+		p:       rescache.ParseResourcePattern(resourcePattern),
+	})
+	return c
+}
+
+// connectUpstreams connects to all upstream NATS servers. On error, any
+// upstream connection already made is closed.
+// Client mutex is held when called.
+func (c *Client) connectUpstreams(opts []nats.Option) error {
+	for _, u := range c.upstreams {
+		if !u.p.IsValid() {
+			c.closeUpstreams()
+			return fmt.Errorf("invalid upstream resource pattern: %s", u.pattern)
+		}
+		c.Logf("Connecting to upstream NATS at %s for %s", u.url, u.pattern)
+		nc, err := nats.Connect(u.url, opts...)
+		if err != nil {
+			c.closeUpstreams()
+			return fmt.Errorf("upstream NATS for %s: %s", u.pattern, connectError(u.url, err))
+		}
+		u.mq = nc
+	}
+	return nil
+}
+
+// closeUpstreams closes all upstream connections.
+// Client mutex is held when called.
+func (c *Client) closeUpstreams() {
+	for _, u := range c.upstreams {
+		if u.mq != nil && !u.mq.IsClosed() {
+			u.mq.Close()
+		}
+		u.mq = nil
+	}
+}
+
+// conn returns the connection to use for a request subject or event
+// namespace. Subjects for resources matching an upstream pattern, and query
+// subjects of query events received from an upstream server, returns the
+// upstream connection, while any other subject returns the main connection.
+// Client mutex is held when called.
+func (c *Client) conn(subj string) *nats.Conn {
+	if len(c.upstreams) > 0 {
+		if rname, ok := subjectResourceName(subj); ok {
+			for _, u := range c.upstreams {
+				if u.mq != nil && u.p.Match(rname) {
+					return u.mq
+				}
+			}
+		} else if uq, ok := c.upstreamQueries[subj]; ok {
+			return uq.nc
+		}
+	}
+	return c.mq
+}
+
+// isUpstream returns true if the connection is an upstream connection.
+// Client mutex is held when called.
+func (c *Client) isUpstream(nc *nats.Conn) bool {
+	for _, u := range c.upstreams {
+		if u.mq == nc {
+			return true
+		}
+	}
+	return false
+}
+
+// subscribeUpstreams subscribes to a namespace not belonging to a resource on
+// all upstream connections, adding the subscriptions to us. Namespaces of a
+// resource are only subscribed on the connection returned by conn.
+// Client mutex is held when called.
+func (c *Client) subscribeUpstreams(us *Subscription, namespace string, prefix string, cb mq.Response) error {
+	if _, ok := subjectResourceName(namespace); ok {
+		return nil
+	}
+	for _, u := range c.upstreams {
+		if u.mq == nil {
+			continue
+		}
+		sub, err := u.mq.ChanSubscribe(prefix+namespace+".*", c.mqCh)
+		if err != nil {
+			return err
+		}
+		c.Tracef("S=> %s (upstream %s)", sub.Subject, u.pattern)
+		uus := &Subscription{c: c, sub: sub, nc: u.mq}
+		c.mqReqs[sub] = &responseCont{f: cb, prefix: prefix, us: uus}
+		us.upstreamSubs = append(us.upstreamSubs, uus)
+	}
+	return nil
+}
+
+// addUpstreamQuery stores the query subject of a query event received on an
+// upstream connection, so that query requests are sent to the same server.
+// Subjects received longer than upstreamQueryTTL ago are removed. Any other
+// event is ignored.
+// Client mutex is held when called.
+func (c *Client) addUpstreamQuery(nc *nats.Conn, subj string, payload []byte) {
+	if !strings.HasPrefix(subj, "event.") || !strings.HasSuffix(subj, ".query") {
+		return
+	}
+	var ev struct {
+		Subject string `json:"subject"`
+	}
+	if json.Unmarshal(payload, &ev) != nil || ev.Subject == "" {
+		return
+	}
+
+	now := time.Now()
+	i := 0
+	for ; i < len(c.upstreamQueryOrder) && now.Sub(c.upstreamQueryOrder[i].received) >= upstreamQueryTTL; i++ {
+		uq := c.upstreamQueryOrder[i]
+		// Keep the subject if received again later
+		if c.upstreamQueries[uq.subj] == uq {
+			delete(c.upstreamQueries, uq.subj)
+		}
+	}
+	c.upstreamQueryOrder = c.upstreamQueryOrder[i:]
+
+	if c.upstreamQueries == nil {
+		c.upstreamQueries = make(map[string]upstreamQuery)
+	}
+	uq := upstreamQuery{subj: ev.Subject, nc: nc, received: now}
+	c.upstreamQueries[ev.Subject] = uq
+	c.upstreamQueryOrder = append(c.upstreamQueryOrder, uq)
+}
+
+// subjectResourceName returns the resource name of a get, access, call, auth,
+// or new request subject, or of an event namespace. False is returned for any
+// other subject.
+func subjectResourceName(subj string) (string, bool) {
+	idx := strings.IndexByte(subj, '.')
+	if idx < 0 {
+		return "", false
+	}
+	typ, rname := subj[:idx], subj[idx+1:]
+	switch typ {
+	case "get", "access", "new", "event":
+		return rname, true
+	case "call", "auth":
+		// Remove the method name
+		idx = strings.LastIndexByte(rname, '.')
+		if idx < 0 {
+			return "", false
+		}
+		return rname[:idx], true
+	}
+	return "", false
+}
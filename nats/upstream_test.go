@@ -0,0 +1,98 @@
+package nats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubjectResourceName(t *testing.T) {
+	tbl := []struct {
+		Subject      string
+		ResourceName string
+		OK           bool
+	}{
+		{"get.inventory.item.9", "inventory.item.9", true},
+		{"access.inventory.item.9", "inventory.item.9", true},
+		{"call.inventory.item.9.set", "inventory.item.9", true},
+		{"auth.inventory.login", "inventory", true},
+		{"new.inventory.items", "inventory.items", true},
+		{"event.inventory.item.9", "inventory.item.9", true},
+		{"call.inventory", "", false},
+		{"system", "", false},
+		{"system.reset", "", false},
+		{"conn.abc123", "", false},
+		{"_INBOX.abc123", "", false},
+	}
+
+	for i, l := range tbl {
+		rname, ok := subjectResourceName(l.Subject)
+		if rname != l.ResourceName || ok != l.OK {
+			t.Errorf("expected subjectResourceName(%#v) to return %#v, %v, but got %#v, %v in test %d", l.Subject, l.ResourceName, l.OK, rname, ok, i+1)
+		}
+	}
+}
+
+// newUpstreamTestClient connects a client to a main and an upstream mock
+// server, with the upstream server handling resources matching pattern.
+func newUpstreamTestClient(t *testing.T, pattern string) (*Client, *mockConn, *mockConn) {
+	url, conns := newMockServer(t)
+	upURL, upConns := newMockServer(t)
+	c := newTestClient(t, url).WithUpstream(upURL, pattern)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	return c, getMockConn(t, conns), getMockConn(t, upConns)
+}
+
+func getEvent(t *testing.T, events chan string) string {
+	select {
+	case subj := <-events:
+		return subj
+	case <-time.After(time.Second):
+		t.Fatal("expected an event, but got none")
+	}
+	return ""
+}
+
+func TestUpstream_SystemSubscription_ReceivesEventsFromAllServers(t *testing.T) {
+	c, mc, upmc := newUpstreamTestClient(t, "inventory.>")
+	events := make(chan string, 2)
+	if _, err := c.Subscribe("system", func(subj string, _ []byte, _ map[string][]string, _ error) { events <- subj }); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	mc.assertSub(t, "system.*")
+	upmc.assertSub(t, "system.*")
+
+	mc.send("system.*", "system.reset", `{"resources":["test.>"]}`)
+	if subj := getEvent(t, events); subj != "system.reset" {
+		t.Fatalf("expected event on system.reset, but got %s", subj)
+	}
+	upmc.send("system.*", "system.reset", `{"resources":["inventory.>"]}`)
+	if subj := getEvent(t, events); subj != "system.reset" {
+		t.Fatalf("expected event on system.reset, but got %s", subj)
+	}
+}
+
+func TestUpstream_QueryEvent_SendsQueryRequestToUpstream(t *testing.T) {
+	c, mc, upmc := newUpstreamTestClient(t, "inventory.>")
+	events := make(chan string, 1)
+	if _, err := c.Subscribe("event.inventory.items", func(subj string, _ []byte, _ map[string][]string, _ error) { events <- subj }); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+	upmc.assertSub(t, "event.inventory.items.*")
+
+	upmc.send("event.inventory.items.*", "event.inventory.items.query", `{"subject":"_EVENT_01_"}`)
+	if subj := getEvent(t, events); subj != "event.inventory.items.query" {
+		t.Fatalf("expected event on event.inventory.items.query, but got %s", subj)
+	}
+	c.SendRequest("_EVENT_01_", []byte(`{"query":"limit=10"}`), func(string, []byte, map[string][]string, error) {}, nil)
+	if p := upmc.getPub(t); p.subject != "_EVENT_01_" {
+		t.Fatalf("expected query request on upstream server, but got %s", p.subject)
+	}
+
+	// Other subjects given by services are sent on the main connection
+	c.SendRequest("_EVENT_02_", []byte(`{"query":"limit=10"}`), func(string, []byte, map[string][]string, error) {}, nil)
+	if p := mc.getPub(t); p.subject != "_EVENT_02_" {
+		t.Fatalf("expected query request on main server, but got %s", p.subject)
+	}
+}
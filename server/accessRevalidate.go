@@ -0,0 +1,79 @@
+package server
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/resgateio/resgate/server/rescache"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// Maximum number of times the revalidation interval is doubled on
+// consecutive access errors.
+const maxRevalidateBackoff = 5
+
+// scheduleRevalidation starts a timer to revalidate access to a directly
+// subscribed resource once the accessRevalidateInterval has passed, jittered
+// by up to 10%. The interval is doubled for each consecutive access error.
+// The timer is not started if the setting is not set, or if a timer is
+// already running.
+func (s *Subscription) scheduleRevalidation() {
+	interval := s.c.AccessRevalidateInterval()
+	if interval == 0 || s.revalidateTimer != nil || s.state == stateDisposed || s.direct == 0 {
+		return
+	}
+
+	d := interval << s.revalidateErrors
+	d += time.Duration(rand.Int63n(int64(d)/5+1)) - d/10
+
+	var t *time.Timer
+	t = time.AfterFunc(d, func() {
+		s.c.EnqueueTask(taskAccess, func() {
+			if s.revalidateTimer != t {
+				return
+			}
+			s.revalidateTimer = nil
+			s.revalidateAccess()
+		}, nil)
+	})
+	s.revalidateTimer = t
+}
+
+// stopRevalidation stops any running revalidation timer.
+func (s *Subscription) stopRevalidation() {
+	if s.revalidateTimer != nil {
+		s.revalidateTimer.Stop()
+		s.revalidateTimer = nil
+	}
+}
+
+// revalidateAccess makes a new access request, same as on a reaccess event,
+// unsubscribing if get access is denied. On any other access error, the
+// subscription is kept, and the next revalidation backs off.
+func (s *Subscription) revalidateAccess() {
+	if s.state == stateDisposed || s.direct == 0 {
+		return
+	}
+
+	// Try again later if events are queued for loading or a reaccess.
+	if s.queueFlag != 0 {
+		s.scheduleRevalidation()
+		return
+	}
+
+	s.access = nil
+	s.queueEvents(queueReasonReaccess)
+	s.loadAccess(func(a *rescache.Access) {
+		if a.Error != nil && a.Error.Code != reserr.CodeAccessDenied {
+			s.c.Debugf("Subscription %s: Access revalidation error: %s", s.rid, a.Error.Message)
+			if s.revalidateErrors < maxRevalidateBackoff {
+				s.revalidateErrors++
+			}
+		} else {
+			s.revalidateErrors = 0
+			s.validateAccess(a)
+		}
+		s.unqueueEvents(queueReasonReaccess)
+		s.scheduleRevalidation()
+	}, nil)
+}
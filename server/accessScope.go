@@ -0,0 +1,91 @@
+package server
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/resgateio/resgate/server/rescache"
+)
+
+// accessScope is an access result granted by a service to all resources
+// matching a resource pattern, for the connection's current token.
+type accessScope struct {
+	raw     string
+	pattern rescache.ResourcePattern
+	access  *rescache.Access
+}
+
+// scopedAccess returns the access of the longest access scope pattern
+// matching the resource, or nil if no scope matches.
+// Connection mutex is held when called.
+func (c *wsConn) scopedAccess(rname string) *rescache.Access {
+	for _, sc := range c.accessScopes {
+		if sc.pattern.Match(rname) {
+			return sc.access
+		}
+	}
+	return nil
+}
+
+// addAccessScope stores the access result for all resources matching its
+// scope pattern, unless the scopes have been cleared since the access
+// request was sent. The scope must be a valid resource pattern matching the
+// resource, with the same service name, or it is ignored.
+func (c *wsConn) addAccessScope(rname string, gen uint, a *rescache.Access) {
+	p := rescache.ParseResourcePattern(a.Scope)
+	if !p.IsValid() || !p.Match(rname) || !sameServiceName(a.Scope, rname) {
+		c.Debugf("Ignoring invalid access scope %#v for %s", a.Scope, rname)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.accessScopeGen {
+		return
+	}
+	scopes := make([]accessScope, 0, len(c.accessScopes)+1)
+	for _, sc := range c.accessScopes {
+		if sc.raw != a.Scope {
+			scopes = append(scopes, sc)
+		}
+	}
+	scopes = append(scopes, accessScope{raw: a.Scope, pattern: p, access: a})
+	sort.SliceStable(scopes, func(i, j int) bool {
+		return len(scopes[i].raw) > len(scopes[j].raw)
+	})
+	c.accessScopes = scopes
+}
+
+// clearAccessScopes removes all access scopes.
+func (c *wsConn) clearAccessScopes() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.accessScopes = nil
+	c.accessScopeGen++
+}
+
+// InvalidateAccessScopes removes the access scopes matching the resource.
+func (c *wsConn) InvalidateAccessScopes(rname string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	scopes := make([]accessScope, 0, len(c.accessScopes))
+	for _, sc := range c.accessScopes {
+		if !sc.pattern.Match(rname) {
+			scopes = append(scopes, sc)
+		}
+	}
+	if len(scopes) != len(c.accessScopes) {
+		c.accessScopes = scopes
+		c.accessScopeGen++
+	}
+}
+
+// sameServiceName reports whether the scope pattern has the same, non
+// wildcard, service name as the resource.
+func sameServiceName(scope, rname string) bool {
+	idx := strings.IndexByte(rname, '.')
+	if idx < 0 {
+		return scope == rname
+	}
+	return strings.HasPrefix(scope, rname[:idx+1])
+}
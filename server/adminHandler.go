@@ -0,0 +1,78 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// AdminEventPath is the HTTP path for injecting synthetic events, if an admin
+// token is set.
+const AdminEventPath = "/admin/event"
+
+type adminEventRequest struct {
+	RID   string          `json:"rid"`
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// isAdminPath returns true if the path is handled by the admin API.
+func (s *Service) isAdminPath(path string) bool {
+	return s.cfg.AdminToken != "" && path == AdminEventPath
+}
+
+// adminHandler handles admin API requests, authorized by the admin token as a
+// bearer token in the Authorization header.
+func (s *Service) adminHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdminAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		httpError(w, reserr.ErrAccessDenied, s.enc)
+		return
+	}
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		httpError(w, reserr.ErrMethodNotAllowed, s.enc)
+		return
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpError(w, &reserr.Error{Code: reserr.CodeBadRequest, Message: "Error reading request body: " + err.Error()}, s.enc)
+		return
+	}
+	var req adminEventRequest
+	if err := json.Unmarshal(b, &req); err != nil {
+		httpError(w, &reserr.Error{Code: reserr.CodeBadRequest, Message: "Error decoding request body: " + err.Error()}, s.enc)
+		return
+	}
+	if !codec.IsValidRID(req.RID, false) {
+		httpError(w, &reserr.Error{Code: reserr.CodeBadRequest, Message: "Invalid resource ID"}, s.enc)
+		return
+	}
+	if !codec.IsValidRIDPart(req.Event) {
+		httpError(w, &reserr.Error{Code: reserr.CodeBadRequest, Message: "Invalid event name"}, s.enc)
+		return
+	}
+
+	s.Debugf("Injecting event %s.%s: %s", req.RID, req.Event, req.Data)
+	if !s.cache.InjectEvent(req.RID, req.Event, req.Data) {
+		httpError(w, reserr.ErrNotFound, s.enc)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isAdminAuthorized returns true if the request has the admin token as bearer
+// token.
+func (s *Service) isAdminAuthorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(s.cfg.AdminToken)) == 1
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/rescache"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// csvContentType is the content type of CSV encoded collections.
+const csvContentType = "text/csv; charset=utf-8"
+
+// csvValueHeader is the column header used for collections that are not
+// encoded as rows of models.
+const csvValueHeader = "value"
+
+var errCSVNotCollection = &reserr.Error{Code: reserr.CodeBadRequest, Message: "CSV format is only available for collections"}
+
+// extractCSVFormat removes any FormatQueryParam parameter with the value csv
+// from a raw query string, and returns the remaining query. The returned flag
+// is true if the parameter was found.
+func extractCSVFormat(rawQuery string) (string, bool) {
+	query, values := extractQueryParam(rawQuery, FormatQueryParam, func(v string) bool {
+		return v == "csv"
+	})
+	return query, len(values) > 0
+}
+
+// acceptsCSV returns true if the request's Accept header contains text/csv.
+func acceptsCSV(r *http.Request) bool {
+	for _, h := range r.Header["Accept"] {
+		for _, part := range strings.Split(h, ",") {
+			mt, _, err := mime.ParseMediaType(part)
+			if err == nil && mt == "text/csv" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// encodeCSV writes a collection subscription as CSV to w.
+//
+// A collection where all items are model references is written as one row per
+// model, with a header row containing the union of the model keys in order of
+// first appearance. Any other collection is written as a single column. Values
+// that are references are written as their resource ID. Rows are written as
+// they are encoded, without buffering the full output.
+func encodeCSV(w io.Writer, s *Subscription) error {
+	cw := csv.NewWriter(w)
+	vals := s.CollectionValues()
+
+	if models := csvModels(s, vals); models != nil {
+		var keys []string
+		seen := make(map[string]bool)
+		for _, m := range models {
+			mkeys := make([]string, 0, len(m))
+			for k := range m {
+				if !seen[k] {
+					mkeys = append(mkeys, k)
+				}
+			}
+			sort.Strings(mkeys)
+			for _, k := range mkeys {
+				seen[k] = true
+			}
+			keys = append(keys, mkeys...)
+		}
+		if err := cw.Write(keys); err != nil {
+			return err
+		}
+		row := make([]string, len(keys))
+		for _, m := range models {
+			for i, k := range keys {
+				v, ok := m[k]
+				if !ok {
+					row[i] = ""
+					continue
+				}
+				row[i] = csvValue(v)
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	} else {
+		if err := cw.Write([]string{csvValueHeader}); err != nil {
+			return err
+		}
+		row := make([]string, 1)
+		for _, v := range vals {
+			row[0] = csvValue(v)
+			// A single empty field is written as an empty line by the csv
+			// writer, which readers skip. Write it quoted instead.
+			if row[0] == "" {
+				cw.Flush()
+				if err := cw.Error(); err != nil {
+					return err
+				}
+				if _, err := io.WriteString(w, "\"\"\n"); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvModels returns the model values of each collection item, or nil if any
+// of the items is not a reference to a model.
+func csvModels(s *Subscription, vals []codec.Value) []map[string]codec.Value {
+	if len(vals) == 0 {
+		return nil
+	}
+	models := make([]map[string]codec.Value, len(vals))
+	for i, v := range vals {
+		if !v.IsReference() {
+			return nil
+		}
+		ref := s.Ref(v.RID)
+		if ref == nil || ref.Error() != nil || ref.ResourceType() != rescache.TypeModel {
+			return nil
+		}
+		models[i] = ref.ModelValues()
+	}
+	return models
+}
+
+// csvValue returns the CSV cell content of a value. Strings are written
+// without quotes, null as an empty cell, and references as their resource ID.
+func csvValue(v codec.Value) string {
+	switch v.Type {
+	case codec.ValueTypeReference, codec.ValueTypeSoftReference, codec.ValueTypeLinkedResource:
+		return v.RID
+	case codec.ValueTypeData:
+		return string(v.Inner)
+	case codec.ValueTypePrimitive:
+		var str string
+		if err := json.Unmarshal(v.RawMessage, &str); err == nil {
+			return str
+		}
+		if string(v.RawMessage) == "null" {
+			return ""
+		}
+		return string(v.RawMessage)
+	}
+	return ""
+}
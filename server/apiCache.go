@@ -0,0 +1,92 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/resgateio/resgate/server/rescache"
+)
+
+// cacheMaxAgePattern is a Cache-Control max-age for resources matching a
+// pattern.
+type cacheMaxAgePattern struct {
+	pattern rescache.ResourcePattern
+	length  int
+	maxAge  int
+}
+
+// newCacheMaxAges returns the cache max-age patterns sorted with the longest
+// pattern first.
+func newCacheMaxAges(m map[string]int) []cacheMaxAgePattern {
+	if len(m) == 0 {
+		return nil
+	}
+	ps := make([]cacheMaxAgePattern, 0, len(m))
+	for p, maxAge := range m {
+		ps = append(ps, cacheMaxAgePattern{
+			pattern: rescache.ParseResourcePattern(p),
+			length:  len(p),
+			maxAge:  maxAge,
+		})
+	}
+	sort.Slice(ps, func(i, j int) bool {
+		return ps[i].length > ps[j].length
+	})
+	return ps
+}
+
+// cacheMaxAge returns the max-age in seconds for a resource, or 0 if the
+// resource should not be cached.
+func (c *Config) cacheMaxAge(rname string) int {
+	for _, p := range c.cacheMaxAges {
+		if p.pattern.Match(rname) {
+			return p.maxAge
+		}
+	}
+	return 0
+}
+
+// setCacheHeaders sets the Cache-Control and Last-Modified headers of a
+// successful HTTP GET response for resources matching a cacheMaxAge pattern.
+// If the client connection has an access token, the response is not to be
+// stored by any cache.
+func (s *Service) setCacheHeaders(w http.ResponseWriter, c *wsConn, sub *Subscription) {
+	maxAge := s.cfg.cacheMaxAge(sub.ResourceName())
+	if maxAge == 0 {
+		return
+	}
+	h := w.Header()
+	if c.hasToken() {
+		h.Set("Cache-Control", "private, no-store")
+		return
+	}
+	h.Set("Cache-Control", "public, max-age="+strconv.Itoa(maxAge))
+	if t := sub.lastModified(nil); !t.IsZero() {
+		h.Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+	}
+}
+
+// lastModified returns the latest time when the subscribed resource, or any
+// resource it references, was loaded or modified by an event. The visited map
+// is used to avoid cyclic references, and may be nil on the first call.
+func (s *Subscription) lastModified(visited map[*Subscription]bool) time.Time {
+	if s.resourceSub == nil {
+		return time.Time{}
+	}
+	if visited == nil {
+		visited = make(map[*Subscription]bool)
+	}
+	visited[s] = true
+	t := s.resourceSub.LastModified()
+	for _, ref := range s.refs {
+		if visited[ref.sub] {
+			continue
+		}
+		if rt := ref.sub.lastModified(visited); rt.After(t) {
+			t = rt
+		}
+	}
+	return t
+}
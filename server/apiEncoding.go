@@ -133,8 +133,6 @@ func init() {
 }
 
 type encoderJSON struct {
-	b             bytes.Buffer
-	path          []string
 	apiPath       string
 	notFoundBytes []byte
 }
@@ -144,25 +142,15 @@ func (e *encoderJSON) ContentType() string {
 }
 
 func (e *encoderJSON) EncodeGET(s *Subscription) ([]byte, error) {
-	// Clone encoder for concurrency safety
-	ec := encoderJSON{
-		apiPath:       e.apiPath,
-		notFoundBytes: e.notFoundBytes,
-	}
+	return e.EncodeGETWithPath(s, e.apiPath)
+}
 
-	err := ec.encodeSubscription(s, false)
-	if err != nil {
-		return nil, err
-	}
-	return json.RawMessage(ec.b.Bytes()), nil
+func (e *encoderJSON) EncodeGETWithPath(s *Subscription, apiPath string) ([]byte, error) {
+	return encodeJSONTree(s, apiPath, false)
 }
 
 func (e *encoderJSON) EncodePOST(r json.RawMessage) ([]byte, error) {
-	b := []byte(r)
-	if bytes.Equal(b, nullBytes) {
-		return nil, nil
-	}
-	return b, nil
+	return jsonEncodePOST(r)
 }
 
 func (e *encoderJSON) EncodeError(rerr *reserr.Error) []byte {
@@ -173,114 +161,7 @@ func (e *encoderJSON) NotFoundError() []byte {
 	return e.notFoundBytes
 }
 
-func (e *encoderJSON) encodeSubscription(s *Subscription, wrap bool) error {
-	rid := s.RID()
-
-	if wrap {
-		e.b.Write([]byte(`{"href":`))
-		dta, err := json.Marshal(RIDToPath(rid, e.apiPath))
-		if err != nil {
-			return err
-		}
-		e.b.Write(dta)
-		defer e.b.WriteByte('}')
-	}
-
-	// Check for cyclic reference
-	if containsString(e.path, rid) {
-		return nil
-	}
-
-	// Check for errors
-	if err := s.Error(); err != nil {
-		if wrap {
-			e.b.Write([]byte(`,"error":`))
-		}
-		e.b.Write(jsonEncodeError(reserr.RESError(err)))
-		return nil
-	}
-
-	// Add itself to path
-	e.path = append(e.path, s.rid)
-
-	switch s.ResourceType() {
-	case rescache.TypeCollection:
-		if wrap {
-			e.b.Write([]byte(`,"collection":`))
-		}
-		e.b.WriteByte('[')
-		vals := s.CollectionValues()
-		for i, v := range vals {
-			if i > 0 {
-				e.b.WriteByte(',')
-			}
-			if err := e.encodeValue(s, v); err != nil {
-				return err
-			}
-		}
-		e.b.WriteByte(']')
-
-	case rescache.TypeModel:
-		if wrap {
-			e.b.Write([]byte(`,"model":`))
-		}
-		e.b.WriteByte('{')
-		vals := s.ModelValues()
-		first := true
-		for k, v := range vals {
-			// Write comma separator
-			if !first {
-				e.b.WriteByte(',')
-			}
-			first = false
-
-			// Write object key
-			dta, err := json.Marshal(k)
-			if err != nil {
-				return err
-			}
-			e.b.Write(dta)
-			e.b.WriteByte(':')
-
-			if err := e.encodeValue(s, v); err != nil {
-				return err
-			}
-		}
-		e.b.WriteByte('}')
-	}
-
-	// Remove itself from path
-	e.path = e.path[:len(e.path)-1]
-
-	return nil
-}
-
-func (e *encoderJSON) encodeValue(s *Subscription, v codec.Value) error {
-	switch v.Type {
-	case codec.ValueTypeReference:
-		sc := s.Ref(v.RID)
-		if err := e.encodeSubscription(sc, true); err != nil {
-			return err
-		}
-	case codec.ValueTypeSoftReference:
-		e.b.Write([]byte(`{"href":`))
-		dta, err := json.Marshal(RIDToPath(v.RID, e.apiPath))
-		if err != nil {
-			return err
-		}
-		e.b.Write(dta)
-		e.b.WriteByte('}')
-	case codec.ValueTypeData:
-		e.b.Write(v.Inner)
-	default:
-		e.b.Write(v.RawMessage)
-	}
-	return nil
-}
-
 type encoderJSONFlat struct {
-	b             bytes.Buffer
-	path          []string
 	apiPath       string
 	notFoundBytes []byte
 }
@@ -290,25 +171,15 @@ func (e *encoderJSONFlat) ContentType() string {
 }
 
 func (e *encoderJSONFlat) EncodeGET(s *Subscription) ([]byte, error) {
-	// Clone encoder for concurrency safety
-	ec := encoderJSONFlat{
-		apiPath:       e.apiPath,
-		notFoundBytes: e.notFoundBytes,
-	}
+	return e.EncodeGETWithPath(s, e.apiPath)
+}
 
-	err := ec.encodeSubscription(s)
-	if err != nil {
-		return nil, err
-	}
-	return json.RawMessage(ec.b.Bytes()), nil
+func (e *encoderJSONFlat) EncodeGETWithPath(s *Subscription, apiPath string) ([]byte, error) {
+	return encodeJSONTree(s, apiPath, true)
 }
 
 func (e *encoderJSONFlat) EncodePOST(r json.RawMessage) ([]byte, error) {
-	b := []byte(r)
-	if bytes.Equal(b, nullBytes) {
-		return nil, nil
-	}
-	return b, nil
+	return jsonEncodePOST(r)
 }
 
 func (e *encoderJSONFlat) EncodeError(rerr *reserr.Error) []byte {
@@ -319,52 +190,91 @@ func (e *encoderJSONFlat) NotFoundError() []byte {
 	return e.notFoundBytes
 }
 
-func (e *encoderJSONFlat) encodeSubscription(s *Subscription) error {
-	rid := s.RID()
+// jsonTree traverses a subscription tree, encoding it as JSON. It is shared by
+// the json and jsonflat API encodings, which only differ in how referenced
+// resources are written:
+//
+// With the json encoding, a reference is written as an object with href and
+// model, collection, or error. With the jsonflat encoding, a reference is
+// written as the resource itself, unless it is a cyclic reference, which is
+// written as an object with href.
+type jsonTree struct {
+	b       bytes.Buffer
+	path    []string
+	apiPath string
+	flat    bool
+}
 
+// encodeJSONTree encodes a subscription and all its references as JSON.
+func encodeJSONTree(s *Subscription, apiPath string, flat bool) ([]byte, error) {
+	t := jsonTree{apiPath: apiPath, flat: flat}
+	err := t.encodeSubscription(s, false)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(t.b.Bytes()), nil
+}
+
+func (t *jsonTree) encodeSubscription(s *Subscription, ref bool) error {
+	rid := s.RID()
+	wrap := ref && !t.flat
 	// Check for cyclic reference
-	if containsString(e.path, rid) {
-		e.b.Write([]byte(`{"href":`))
-		dta, err := json.Marshal(RIDToPath(rid, e.apiPath))
+	cyclic := containsString(t.path, rid)
+
+	if wrap || cyclic {
+		t.b.Write([]byte(`{"href":`))
+		dta, err := json.Marshal(RIDToPath(rid, t.apiPath))
 		if err != nil {
 			return err
 		}
-		e.b.Write(dta)
-		e.b.WriteByte('}')
+		t.b.Write(dta)
+		defer t.b.WriteByte('}')
+	}
+
+	if cyclic {
 		return nil
 	}
 
 	// Check for errors
 	if err := s.Error(); err != nil {
-		e.b.Write(jsonEncodeError(reserr.RESError(err)))
+		if wrap {
+			t.b.Write([]byte(`,"error":`))
+		}
+		t.b.Write(jsonEncodeError(reserr.RESError(err)))
 		return nil
 	}
 
 	// Add itself to path
-	e.path = append(e.path, s.rid)
+	t.path = append(t.path, s.rid)
 
 	switch s.ResourceType() {
 	case rescache.TypeCollection:
-		e.b.WriteByte('[')
+		if wrap {
+			t.b.Write([]byte(`,"collection":`))
+		}
+		t.b.WriteByte('[')
 		vals := s.CollectionValues()
 		for i, v := range vals {
 			if i > 0 {
-				e.b.WriteByte(',')
+				t.b.WriteByte(',')
 			}
-			if err := e.encodeValue(s, v); err != nil {
+			if err := t.encodeValue(s, v); err != nil {
 				return err
 			}
 		}
-		e.b.WriteByte(']')
+		t.b.WriteByte(']')
 
 	case rescache.TypeModel:
-		e.b.WriteByte('{')
+		if wrap {
+			t.b.Write([]byte(`,"model":`))
+		}
+		t.b.WriteByte('{')
 		vals := s.ModelValues()
 		first := true
 		for k, v := range vals {
 			// Write comma separator
 			if !first {
-				e.b.WriteByte(',')
+				t.b.WriteByte(',')
 			}
 			first = false
 
@@ -373,44 +283,53 @@ func (e *encoderJSONFlat) encodeSubscription(s *Subscription) error {
 			if err != nil {
 				return err
 			}
-			e.b.Write(dta)
-			e.b.WriteByte(':')
+			t.b.Write(dta)
+			t.b.WriteByte(':')
 
-			if err := e.encodeValue(s, v); err != nil {
+			if err := t.encodeValue(s, v); err != nil {
 				return err
 			}
 		}
-		e.b.WriteByte('}')
+		t.b.WriteByte('}')
 	}
 
 	// Remove itself from path
-	e.path = e.path[:len(e.path)-1]
+	t.path = t.path[:len(t.path)-1]
+
 	return nil
 }
 
-func (e *encoderJSONFlat) encodeValue(s *Subscription, v codec.Value) error {
+func (t *jsonTree) encodeValue(s *Subscription, v codec.Value) error {
 	switch v.Type {
-	case codec.ValueTypeReference:
+	case codec.ValueTypeReference, codec.ValueTypeLinkedResource:
 		sc := s.Ref(v.RID)
-		if err := e.encodeSubscription(sc); err != nil {
+		if err := t.encodeSubscription(sc, true); err != nil {
 			return err
 		}
 	case codec.ValueTypeSoftReference:
-		e.b.Write([]byte(`{"href":`))
-		dta, err := json.Marshal(RIDToPath(v.RID, e.apiPath))
+		t.b.Write([]byte(`{"href":`))
+		dta, err := json.Marshal(RIDToPath(v.RID, t.apiPath))
 		if err != nil {
 			return err
 		}
-		e.b.Write(dta)
-		e.b.WriteByte('}')
+		t.b.Write(dta)
+		t.b.WriteByte('}')
 	case codec.ValueTypeData:
-		e.b.Write(v.Inner)
+		t.b.Write(v.Inner)
 	default:
-		e.b.Write(v.RawMessage)
+		t.b.Write(v.RawMessage)
 	}
 	return nil
 }
 
+func jsonEncodePOST(r json.RawMessage) ([]byte, error) {
+	b := []byte(r)
+	if bytes.Equal(b, nullBytes) {
+		return nil, nil
+	}
+	return b, nil
+}
+
 func jsonEncodeError(rerr *reserr.Error) []byte {
 	out, err := json.Marshal(rerr)
 	if err != nil {
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// apiEncodingProfiles maps profile parameter values of an application/json
+// Accept header to API encodings.
+var apiEncodingProfiles = map[string]string{
+	"nested": "json",
+	"flat":   "jsonflat",
+}
+
+// extractEncodingFormat removes any FormatQueryParam parameter with the name
+// of an API encoding from a raw query string, and returns the remaining query.
+// The returned encoding name is empty if the parameter was not found.
+func (s *Service) extractEncodingFormat(rawQuery string) (string, string) {
+	query, values := extractQueryParam(rawQuery, FormatQueryParam, func(v string) bool {
+		_, ok := s.encs[strings.ToLower(v)]
+		return ok
+	})
+	if len(values) == 0 {
+		return query, ""
+	}
+	return query, strings.ToLower(values[len(values)-1])
+}
+
+// acceptedEncoding returns the name of the API encoding requested by an
+// application/json media range with a profile parameter in the request's
+// Accept header, or an empty string if no profile is requested.
+func acceptedEncoding(r *http.Request) string {
+	for _, h := range r.Header["Accept"] {
+		for _, part := range strings.Split(h, ",") {
+			mt, params, err := mime.ParseMediaType(part)
+			if err == nil && mt == "application/json" {
+				if enc, ok := apiEncodingProfiles[strings.ToLower(params["profile"])]; ok {
+					return enc
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// requestEncoder returns the API encoder used for a GET response, selected by
+// the FormatQueryParam parameter, or by the Accept header profile. It falls
+// back to the encoder of the apiEncoding setting.
+func (s *Service) requestEncoder(r *http.Request, format string) APIEncoder {
+	if format == "" {
+		format = acceptedEncoding(r)
+	}
+	if enc, ok := s.encs[format]; ok {
+		return enc
+	}
+	return s.enc
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/rescache"
+)
+
+// fieldSelection is a set of selected model fields. A field mapped to a nil
+// selection is selected in full, while a non-nil selection is applied to the
+// resource referenced by the field.
+type fieldSelection map[string]fieldSelection
+
+// extractFields removes any FieldsQueryParam parameter from a raw query
+// string, and returns the remaining query together with the parsed field
+// selection. The returned selection is nil if no fields were selected.
+func extractFields(rawQuery string) (string, fieldSelection) {
+	query, values := extractQueryParam(rawQuery, FieldsQueryParam, nil)
+	var fs fieldSelection
+	for _, value := range values {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			if fs == nil {
+				fs = make(fieldSelection)
+			}
+			fs.add(strings.Split(field, "."))
+		}
+	}
+	return query, fs
+}
+
+// add adds a dot separated field path to the selection.
+func (fs fieldSelection) add(path []string) {
+	name := path[0]
+	sub, ok := fs[name]
+	if len(path) == 1 {
+		// Selecting the full field overrides any previous sub selection.
+		fs[name] = nil
+		return
+	}
+	if ok && sub == nil {
+		return
+	}
+	if sub == nil {
+		sub = make(fieldSelection)
+		fs[name] = sub
+	}
+	sub.add(path[1:])
+}
+
+// merge returns the union of two selections, where nil means all fields.
+func (fs fieldSelection) merge(other fieldSelection) fieldSelection {
+	if fs == nil || other == nil {
+		return nil
+	}
+	m := make(fieldSelection, len(fs)+len(other))
+	for k, v := range fs {
+		m[k] = v
+	}
+	for k, v := range other {
+		if cur, ok := m[k]; ok {
+			m[k] = cur.merge(v)
+		} else {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// selectFields returns a shallow copy of the subscription, holding only the
+// model values selected by fs. For collections, the selection is applied to
+// each element that is a model reference. Unknown fields are omitted. The
+// returned subscription must only be used for encoding.
+func (s *Subscription) selectFields(fs fieldSelection) *Subscription {
+	if fs == nil || s.err != nil || s.state == stateDisposed {
+		return s
+	}
+
+	// Collect the selections to apply on each referenced resource
+	var refSel map[string]fieldSelection
+	addRef := func(rid string, sel fieldSelection) {
+		if refSel == nil {
+			refSel = make(map[string]fieldSelection)
+		}
+		if cur, ok := refSel[rid]; ok {
+			sel = cur.merge(sel)
+		}
+		refSel[rid] = sel
+	}
+
+	cp := *s
+	switch s.typ {
+	case rescache.TypeModel:
+		vals := s.model.Values
+		m := make(map[string]codec.Value, len(fs))
+		for k, sel := range fs {
+			v, ok := vals[k]
+			if !ok {
+				continue
+			}
+			m[k] = v
+			if v.IsReference() {
+				addRef(v.RID, sel)
+			}
+		}
+		cp.model = &rescache.Model{Values: m}
+	case rescache.TypeCollection:
+		for _, v := range s.collection.Values {
+			if !v.IsReference() {
+				continue
+			}
+			if ref := s.Ref(v.RID); ref != nil && ref.typ == rescache.TypeModel {
+				addRef(v.RID, fs)
+			}
+		}
+	default:
+		return s
+	}
+
+	if len(refSel) == 0 {
+		return &cp
+	}
+	refs := make(map[string]*reference, len(s.refs))
+	for rid, r := range s.refs {
+		if sel, ok := refSel[rid]; ok && r.sub != nil {
+			r = &reference{sub: r.sub.selectFields(sel), count: r.count}
+		}
+		refs[rid] = r
+	}
+	cp.refs = refs
+	return &cp
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// fileResult is the result of a call response with the meta file flag set.
+type fileResult struct {
+	ContentType string  `json:"contentType"`
+	Filename    string  `json:"filename"`
+	Data        *string `json:"data"`
+}
+
+// invalidFileResult returns an error for a file result that could not be
+// decoded.
+func invalidFileResult(reason string) *reserr.Error {
+	return &reserr.Error{Code: reserr.CodeInternalError, Message: "Internal error: invalid file result: " + reason}
+}
+
+// decodeFileResult decodes a file result, and returns its content type,
+// content disposition, and raw data. The content disposition is empty if no
+// filename is set. An error is returned if the result is invalid, or if the
+// data is larger than maxSize bytes.
+func decodeFileResult(result json.RawMessage, maxSize int) (string, string, []byte, error) {
+	var fr fileResult
+	if err := json.Unmarshal(result, &fr); err != nil {
+		return "", "", nil, invalidFileResult(err.Error())
+	}
+	if fr.Data == nil {
+		return "", "", nil, invalidFileResult("missing data")
+	}
+	if _, _, err := mime.ParseMediaType(fr.ContentType); err != nil {
+		return "", "", nil, invalidFileResult("invalid content type")
+	}
+	var disposition string
+	if fr.Filename != "" {
+		if disposition = mime.FormatMediaType("attachment", map[string]string{"filename": fr.Filename}); disposition == "" {
+			return "", "", nil, invalidFileResult("invalid filename")
+		}
+	}
+	// Check the encoded length before decoding to avoid allocating for
+	// oversized data.
+	if len(*fr.Data) > base64.StdEncoding.EncodedLen(maxSize) {
+		return "", "", nil, invalidFileResult(fmt.Sprintf("data exceeds the maximum size of %d bytes", maxSize))
+	}
+	data, err := base64.StdEncoding.DecodeString(*fr.Data)
+	if err != nil {
+		return "", "", nil, invalidFileResult("invalid base64 data")
+	}
+	if len(data) > maxSize {
+		return "", "", nil, invalidFileResult(fmt.Sprintf("data exceeds the maximum size of %d bytes", maxSize))
+	}
+	return fr.ContentType, disposition, data, nil
+}
+
+// writeFileResult writes the raw data of a file result as the response body,
+// with the status, or 200 OK if status is 0. A Content-Disposition header
+// set by the meta object takes precedence over the filename. An invalid file
+// result is responded with 502 Bad Gateway.
+func (s *Service) writeFileResult(w http.ResponseWriter, result json.RawMessage, status int) {
+	ct, disposition, data, err := decodeFileResult(result, s.cfg.fileResultMaxSize)
+	if err != nil {
+		httpErrorStatus(w, reserr.RESError(err), http.StatusBadGateway, s.enc)
+		return
+	}
+	if status == 0 {
+		status = http.StatusOK
+	}
+	h := w.Header()
+	h.Set("Content-Type", ct)
+	h.Set("Content-Length", strconv.Itoa(len(data)))
+	if disposition != "" && h.Get("Content-Disposition") == "" {
+		h.Set("Content-Disposition", disposition)
+	}
+	w.WriteHeader(status)
+	w.Write(data)
+}
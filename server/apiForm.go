@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// Form content types accepted as HTTP call request bodies.
+const (
+	formURLEncodedContentType = "application/x-www-form-urlencoded"
+	formMultipartContentType  = "multipart/form-data"
+)
+
+// formMediaType returns the media type of the request's Content-Type header,
+// if it is a form content type. Only the exact media types are accepted, and
+// the body is never sniffed.
+func formMediaType(r *http.Request) (string, map[string]string, bool) {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return "", nil, false
+	}
+	mt, params, err := mime.ParseMediaType(ct)
+	if err != nil || (mt != formURLEncodedContentType && mt != formMultipartContentType) {
+		return "", nil, false
+	}
+	return mt, params, true
+}
+
+// decodeFormParams decodes a form request body into a JSON params object. A
+// field with a single value is set as a string, while repeated fields are set
+// as an array of strings. Files are base64 encoded, and rejected if larger
+// than maxFileSize bytes.
+func decodeFormParams(r *http.Request, mt string, mtParams map[string]string, maxFileSize int) (json.RawMessage, error) {
+	var fields url.Values
+	switch mt {
+	case formURLEncodedContentType:
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, &reserr.Error{Code: reserr.CodeBadRequest, Message: "Error reading request body: " + err.Error()}
+		}
+		fields, err = url.ParseQuery(string(b))
+		if err != nil {
+			return nil, &reserr.Error{Code: reserr.CodeBadRequest, Message: "Error decoding request body: " + err.Error()}
+		}
+	case formMultipartContentType:
+		boundary := mtParams["boundary"]
+		if boundary == "" {
+			return nil, &reserr.Error{Code: reserr.CodeBadRequest, Message: "Error decoding request body: missing multipart boundary"}
+		}
+		var err error
+		fields, err = readMultipartFields(multipart.NewReader(r.Body, boundary), maxFileSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	params := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if len(v) == 1 {
+			params[k] = v[0]
+		} else {
+			params[k] = v
+		}
+	}
+	return json.Marshal(params)
+}
+
+// readMultipartFields reads all parts of a multipart form. Files are base64
+// encoded, and an error is returned if any file is larger than maxFileSize
+// bytes. Parts without a form name are ignored.
+func readMultipartFields(mr *multipart.Reader, maxFileSize int) (url.Values, error) {
+	fields := make(url.Values)
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return fields, nil
+		}
+		if err != nil {
+			return nil, &reserr.Error{Code: reserr.CodeBadRequest, Message: "Error decoding request body: " + err.Error()}
+		}
+		name := p.FormName()
+		if name == "" {
+			continue
+		}
+		if p.FileName() == "" {
+			b, err := ioutil.ReadAll(p)
+			if err != nil {
+				return nil, &reserr.Error{Code: reserr.CodeBadRequest, Message: "Error reading request body: " + err.Error()}
+			}
+			fields.Add(name, string(b))
+			continue
+		}
+		b, err := ioutil.ReadAll(io.LimitReader(p, int64(maxFileSize)+1))
+		if err != nil {
+			return nil, &reserr.Error{Code: reserr.CodeBadRequest, Message: "Error reading request body: " + err.Error()}
+		}
+		if len(b) > maxFileSize {
+			return nil, &reserr.Error{Code: reserr.CodeBadRequest, Message: fmt.Sprintf("File in form field %s exceeds the maximum size of %d bytes", name, maxFileSize)}
+		}
+		fields.Add(name, base64.StdEncoding.EncodeToString(b))
+	}
+}
@@ -6,10 +6,14 @@ import (
 	"io/ioutil"
 	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/rescache"
 	"github.com/resgateio/resgate/server/reserr"
+	"github.com/rs/xid"
 )
 
 func (s *Service) initAPIHandler() error {
@@ -21,7 +25,11 @@ func (s *Service) initAPIHandler() error {
 		}
 		return fmt.Errorf("invalid apiEncoding setting (%s) - available encodings: %s", s.cfg.APIEncoding, strings.Join(keys, ", "))
 	}
-	s.enc = f(s.cfg)
+	s.encs = make(map[string]APIEncoder, len(apiEncoderFactories))
+	for k, ef := range apiEncoderFactories {
+		s.encs[k] = ef(s.cfg)
+	}
+	s.enc = s.encs[strings.ToLower(s.cfg.APIEncoding)]
 	mimetype, _, err := mime.ParseMediaType(s.enc.ContentType())
 	s.mimetype = mimetype
 	return err
@@ -30,7 +38,7 @@ func (s *Service) initAPIHandler() error {
 // setCommonHeaders sets common headers such as Access-Control-*.
 // It returns error if the origin header does not match any allowed origin.
 func (s *Service) setCommonHeaders(w http.ResponseWriter, r *http.Request) error {
-	if s.cfg.HeaderAuth != nil {
+	if s.cfg.HeaderAuth != nil || len(s.cfg.headerAuthChain) > 0 {
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 	}
 	if s.cfg.allowOrigin[0] == "*" {
@@ -58,12 +66,8 @@ func (s *Service) setCommonHeaders(w http.ResponseWriter, r *http.Request) error
 
 func (s *Service) apiHandler(w http.ResponseWriter, r *http.Request) {
 	err := s.setCommonHeaders(w, r)
-	if r.Method == "OPTIONS" {
-		w.Header().Set("Access-Control-Allow-Methods", s.cfg.allowMethods)
-		reqHeaders := r.Header["Access-Control-Request-Headers"]
-		if len(reqHeaders) > 0 {
-			w.Header().Set("Access-Control-Allow-Headers", strings.Join(reqHeaders, ", "))
-		}
+	if isPreflight(r) {
+		setPreflightHeaders(w, r, s.cfg.allowMethods)
 		return
 	}
 	if err != nil {
@@ -71,6 +75,9 @@ func (s *Service) apiHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	reqID := httpRequestID(r)
+	w.Header().Set(RequestIDHeader, reqID)
+
 	path := r.URL.RawPath
 	if path == "" {
 		path = r.URL.Path
@@ -86,22 +93,87 @@ func (s *Service) apiHandler(w http.ResponseWriter, r *http.Request) {
 
 	var rid, action string
 	switch r.Method {
+	case "OPTIONS":
+		s.handleOptions(w, r, reqID, PathToRID(path, r.URL.RawQuery, apiPath))
+		return
+
 	case "HEAD":
 		fallthrough
 	case "GET":
-		rid = PathToRID(path, r.URL.RawQuery, apiPath)
+		query, fields := extractFields(r.URL.RawQuery)
+		query, formatCSV := extractCSVFormat(query)
+		acceptCSV := formatCSV || acceptsCSV(r)
+		query, formatJSONLines := extractJSONLinesFormat(query)
+		acceptJSONLines := formatJSONLines || acceptsJSONLines(r)
+		query, format := s.extractEncodingFormat(query)
+		enc := s.requestEncoder(r, format)
+		rid = PathToRID(path, query, apiPath)
 		if !codec.IsValidRID(rid, true) {
-			notFoundHandler(w, r, s.enc)
+			notFoundHandler(w, r, enc)
 			return
 		}
+		publicAPIPath := s.publicAPIPath(r)
+		if s.cfg.ForwardedPrefix {
+			w.Header().Add("Vary", ForwardedPrefixHeader)
+		}
+		// HEAD requests are handled as GET requests, but without the body.
+		head := r.Method == "HEAD"
 
-		s.temporaryConn(w, r, func(c *wsConn, cb func([]byte, error, bool)) {
+		s.temporaryConn(w, r, reqID, enc, func(c *wsConn, w http.ResponseWriter, cb func([]byte, error, bool)) {
 			c.GetSubscription(rid, func(sub *Subscription, err error) {
 				if err != nil {
 					cb(nil, err, false)
 					return
 				}
-				b, err := s.enc.EncodeGET(sub)
+				s.setCacheHeaders(w, c, sub)
+				setETag(w, sub)
+				sub = sub.selectFields(fields)
+				if acceptCSV && sub.ResourceType() == rescache.TypeCollection {
+					w.Header().Set("Content-Type", csvContentType)
+					w.WriteHeader(http.StatusOK)
+					if head {
+						cb(nil, nil, true)
+						return
+					}
+					if err := encodeCSV(w, sub); err != nil {
+						s.Debugf("Error writing CSV response for %s: %s", rid, err)
+					}
+					cb(nil, nil, true)
+					return
+				}
+				if acceptJSONLines && sub.ResourceType() == rescache.TypeCollection {
+					w.Header().Set("Content-Type", jsonLinesContentType)
+					w.WriteHeader(http.StatusOK)
+					if head {
+						cb(nil, nil, true)
+						return
+					}
+					if err := encodeJSONLines(w, sub, publicAPIPath); err != nil {
+						s.Debugf("Error writing JSON Lines response for %s: %s", rid, err)
+					}
+					cb(nil, nil, true)
+					return
+				}
+				// Only fail explicit format requests. Accept header negotiation
+				// falls back to the API encoding.
+				if formatCSV {
+					cb(nil, errCSVNotCollection, false)
+					return
+				}
+				if formatJSONLines {
+					cb(nil, errJSONLinesNotCollection, false)
+					return
+				}
+				b, err := encodeGET(enc, sub, publicAPIPath)
+				if err == nil && head {
+					// Set the length of the body that GET would return, as
+					// the http package does not for HEAD requests.
+					w.Header().Set("Content-Type", enc.ContentType())
+					w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+					w.WriteHeader(http.StatusOK)
+					cb(nil, nil, true)
+					return
+				}
 				cb(b, err, false)
 			})
 		})
@@ -134,7 +206,32 @@ func (s *Service) apiHandler(w http.ResponseWriter, r *http.Request) {
 		action = *m
 	}
 
-	s.handleCall(w, r, rid, action)
+	s.handleCall(w, r, reqID, rid, action)
+}
+
+// httpRequestID returns the request ID of the X-Request-Id header, if set to a
+// valid ID. Otherwise a new request ID is generated.
+func httpRequestID(r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if !isValidHeaderID(id, MaxRequestIDLength) {
+		return xid.New().String()
+	}
+	return id
+}
+
+// isValidHeaderID returns true if id is a non-empty string of printable ASCII
+// characters, excluding space, no longer than maxLen.
+func isValidHeaderID(id string, maxLen int) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		// Only allow printable ASCII characters, excluding space
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
 }
 
 func notFoundHandler(w http.ResponseWriter, r *http.Request, enc APIEncoder) {
@@ -143,88 +240,204 @@ func notFoundHandler(w http.ResponseWriter, r *http.Request, enc APIEncoder) {
 	w.Write(enc.NotFoundError())
 }
 
-func (s *Service) handleCall(w http.ResponseWriter, r *http.Request, rid string, action string) {
+func (s *Service) handleCall(w http.ResponseWriter, r *http.Request, reqID string, rid string, action string) {
 	if !codec.IsValidRID(rid, true) || !codec.IsValidRIDPart(action) {
 		notFoundHandler(w, r, s.enc)
 		return
 	}
 
-	// Try to parse the body
-	b, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		httpError(w, &reserr.Error{Code: reserr.CodeBadRequest, Message: "Error reading request body: " + err.Error()}, s.enc)
-		return
-	}
-
 	var params json.RawMessage
-	if strings.TrimSpace(string(b)) != "" {
-		err = json.Unmarshal(b, &params)
+	if mt, mtParams, ok := formMediaType(r); ok {
+		// Convert form fields to a params object
+		var err error
+		params, err = decodeFormParams(r, mt, mtParams, s.cfg.formFileMaxSize)
 		if err != nil {
-			httpError(w, &reserr.Error{Code: reserr.CodeBadRequest, Message: "Error decoding request body: " + err.Error()}, s.enc)
+			httpError(w, err, s.enc)
+			return
+		}
+	} else {
+		// Try to parse the body
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			httpError(w, &reserr.Error{Code: reserr.CodeBadRequest, Message: "Error reading request body: " + err.Error()}, s.enc)
 			return
 		}
-	}
 
-	s.temporaryConn(w, r, func(c *wsConn, cb func([]byte, error, bool)) {
-		c.CallHTTPResource(rid, s.cfg.APIPath, action, params, func(r json.RawMessage, href string, err error) {
+		if strings.TrimSpace(string(b)) != "" {
+			err = json.Unmarshal(b, &params)
 			if err != nil {
-				cb(nil, err, false)
-			} else if href != "" {
-				w.Header().Set("Location", href)
-				w.WriteHeader(http.StatusOK)
-				cb(nil, nil, true)
-			} else {
-				b, err := s.enc.EncodePOST(r)
-				cb(b, err, false)
+				httpError(w, &reserr.Error{Code: reserr.CodeBadRequest, Message: "Error decoding request body: " + err.Error()}, s.enc)
+				return
 			}
-		})
-	})
-}
+		}
+	}
 
-func (s *Service) temporaryConn(w http.ResponseWriter, r *http.Request, cb func(*wsConn, func([]byte, error, bool))) {
-	c := s.newWSConn(nil, r, versionLatest)
-	if c == nil {
-		httpError(w, reserr.ErrServiceUnavailable, s.enc)
-		return
+	// Idempotency keys are ignored unless an idempotency TTL is set
+	var idemKey string
+	if s.idem != nil {
+		if idemKey = r.Header.Get(IdempotencyKeyHeader); idemKey != "" && !isValidHeaderID(idemKey, MaxIdempotencyKeyLength) {
+			httpError(w, &reserr.Error{Code: reserr.CodeBadRequest, Message: "Invalid idempotency key"}, s.enc)
+			return
+		}
 	}
 
-	done := make(chan struct{})
-	rs := func(out []byte, err error, headerWritten bool) {
-		defer c.dispose()
-		defer close(done)
+	method := r.Method
+	publicAPIPath := s.publicAPIPath(r)
+
+	// If-Match is only honored on PATCH and DELETE requests
+	var expectedVersion uint64
+	if method == "PATCH" || method == "DELETE" {
+		var ok bool
+		if expectedVersion, ok = parseIfMatch(r.Header.Get("If-Match")); !ok {
+			httpError(w, &reserr.Error{Code: reserr.CodeBadRequest, Message: "Invalid If-Match header"}, s.enc)
+			return
+		}
+	}
 
+	s.temporaryConn(w, r, reqID, s.enc, func(c *wsConn, w http.ResponseWriter, cb func([]byte, error, bool)) {
+		c.expectedVersion = expectedVersion
+		if idemKey == "" {
+			s.callHTTPResource(c, w, method, publicAPIPath, rid, action, params, cb)
+			return
+		}
+		// The scope is set after any header authentication, as it
+		// includes the access token.
+		s.idempotentCall(c, w, idempotencyScope(rid, action, c.token, idemKey), cb, func(w http.ResponseWriter, cb func([]byte, error, bool)) {
+			s.callHTTPResource(c, w, method, publicAPIPath, rid, action, params, cb)
+		})
+	})
+}
+
+// callHTTPResource calls a method on a resource for an HTTP API request, and
+// writes any response headers or status to w before calling cb. The apiPath is
+// used as prefix for the Location header path of resource responses.
+func (s *Service) callHTTPResource(c *wsConn, w http.ResponseWriter, method string, apiPath string, rid string, action string, params json.RawMessage, cb func([]byte, error, bool)) {
+	c.CallHTTPResource(rid, apiPath, action, params, func(r json.RawMessage, href string, meta *codec.Meta, err error) {
+		status := s.applyMeta(w, meta)
 		if err != nil {
-			// Convert system.methodNotFound to system.methodNotAllowed for PUT/DELETE/PATCH
-			if rerr, ok := err.(*reserr.Error); ok {
-				if rerr.Code == reserr.CodeMethodNotFound && (r.Method == "PUT" || r.Method == "DELETE" || r.Method == "PATCH") {
+			// A status set by the service overrides any default status.
+			if status != 0 {
+				httpErrorStatus(w, reserr.RESError(err), status, s.enc)
+				cb(nil, nil, true)
+				return
+			}
+			if s.isMethodNotFound(err) {
+				// Convert method not found to system.methodNotAllowed for PUT/DELETE/PATCH
+				if method == "PUT" || method == "DELETE" || method == "PATCH" {
 					httpError(w, reserr.ErrMethodNotAllowed, s.enc)
-					return
+				} else {
+					httpErrorStatus(w, reserr.RESError(err), s.cfg.methodNotFoundStatus, s.enc)
 				}
+				cb(nil, nil, true)
+				return
 			}
-			httpError(w, err, s.enc)
-			return
+			cb(nil, err, false)
+		} else if href != "" {
+			if status == 0 {
+				status = http.StatusOK
+			}
+			w.Header().Set("Location", href)
+			w.WriteHeader(status)
+			cb(nil, nil, true)
+		} else if meta != nil && meta.File {
+			s.writeFileResult(w, r, status)
+			cb(nil, nil, true)
+		} else {
+			b, err := s.enc.EncodePOST(r)
+			if err != nil || status == 0 {
+				cb(b, err, false)
+				return
+			}
+			if len(b) > 0 {
+				w.Header().Set("Content-Type", s.enc.ContentType())
+			}
+			w.WriteHeader(status)
+			w.Write(b)
+			cb(nil, nil, true)
 		}
+	})
+}
 
-		if len(out) > 0 {
-			w.Header().Set("Content-Type", s.enc.ContentType())
-			w.Write(out)
-			return
+// hasHeaderAuth returns true if header authentication should be done for the
+// HTTP request. If the headerAuthHeaders setting is set, the request must
+// carry at least one of the headers.
+func (s *Service) hasHeaderAuth(r *http.Request) bool {
+	if s.cfg.HeaderAuth == nil {
+		return false
+	}
+	if len(s.cfg.headerAuthHeaders) == 0 {
+		return true
+	}
+	for _, h := range s.cfg.headerAuthHeaders {
+		if _, ok := r.Header[h]; ok {
+			return true
 		}
+	}
+	return false
+}
 
-		if !headerWritten {
-			w.WriteHeader(http.StatusNoContent)
+// temporaryConn creates a temporary connection for handling an HTTP request
+// with the given request ID, and calls cb with the connection and the response
+// writer to use. The response is written with the API encoder once the
+// callback function passed to cb is called.
+func (s *Service) temporaryConn(w http.ResponseWriter, r *http.Request, reqID string, enc APIEncoder, cb func(*wsConn, http.ResponseWriter, func([]byte, error, bool))) {
+	c, err := s.newWSConn(nil, r, versionLatest)
+	if err != nil {
+		if err != reserr.ErrServiceUnavailable {
+			s.Errorf("Failed to create connection for HTTP request %s: %s", reqID, err)
+			err = reserr.InternalError(err)
 		}
+		httpError(w, err, enc)
+		return
+	}
+
+	dw := newDeadlineWriter(w)
+	done := make(chan struct{})
+	rs := func(out []byte, err error, headerWritten bool) {
+		defer c.dispose()
+		defer close(done)
+		writeResponse(dw, out, err, headerWritten, enc)
 	}
 	c.Enqueue(func() {
-		if s.cfg.HeaderAuth != nil {
-			c.AuthResource(s.cfg.headerAuthRID, s.cfg.headerAuthAction, nil, func(_ interface{}, err error) {
-				cb(c, rs)
+		// The temporary connection handles a single request
+		c.reqID = reqID
+		c.reqTrace = c.trace.newSpan()
+		if s.hasHeaderAuth(r) {
+			c.AuthHTTPResource(s.cfg.headerAuthRID, s.cfg.headerAuthAction, nil, func(meta *codec.Meta, _ error) {
+				// Only meta headers are applied, as the status is determined
+				// by the request being authenticated.
+				s.applyMeta(dw, meta)
+				s.setTokenCookie(dw, meta)
+				cb(c, dw, rs)
+			})
+		} else if steps := s.headerAuthSteps(r); len(steps) > 0 {
+			s.headerAuthChain(c, dw, steps, func() {
+				cb(c, dw, rs)
 			})
 		} else {
-			cb(c, rs)
+			cb(c, dw, rs)
 		}
 	})
-	<-done
+	s.awaitDeadline(dw, done, enc)
+}
+
+// writeResponse writes the error, if not nil, or else the encoded out data. If
+// out is empty, and the header is not yet written, 204 No Content is written.
+func writeResponse(w http.ResponseWriter, out []byte, err error, headerWritten bool, enc APIEncoder) {
+	if err != nil {
+		httpError(w, err, enc)
+		return
+	}
+
+	if len(out) > 0 {
+		w.Header().Set("Content-Type", enc.ContentType())
+		w.Write(out)
+		return
+	}
+
+	if !headerWritten {
+		w.WriteHeader(http.StatusNoContent)
+	}
 }
 
 func httpError(w http.ResponseWriter, err error, enc APIEncoder) {
@@ -250,11 +463,50 @@ func httpError(w http.ResponseWriter, err error, enc APIEncoder) {
 		code = http.StatusForbidden
 	case reserr.CodeSubjectTooLong:
 		code = http.StatusRequestURITooLong
+	case reserr.CodePayloadTooLarge:
+		code = http.StatusRequestEntityTooLarge
+	case reserr.CodePreconditionFailed:
+		code = http.StatusPreconditionFailed
 	default:
 		code = http.StatusBadRequest
 	}
 
+	httpErrorStatus(w, rerr, code, enc)
+}
+
+// httpErrorStatus writes the error with the given HTTP status code.
+func httpErrorStatus(w http.ResponseWriter, rerr *reserr.Error, code int, enc APIEncoder) {
 	w.Header().Set("Content-Type", enc.ContentType())
 	w.WriteHeader(code)
 	w.Write(enc.EncodeError(rerr))
 }
+
+// extractQueryParam removes all parameters with the given key from a raw query
+// string, and returns the remaining query together with the unescaped values
+// of the removed parameters. If match is not nil, only parameters with values
+// for which match returns true are removed.
+func extractQueryParam(rawQuery string, key string, match func(value string) bool) (string, []string) {
+	if rawQuery == "" {
+		return rawQuery, nil
+	}
+	var values []string
+	parts := strings.Split(rawQuery, "&")
+	kept := parts[:0]
+	for _, part := range parts {
+		k, v := part, ""
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			k, v = part[:i], part[i+1:]
+		}
+		if k, err := url.QueryUnescape(k); err != nil || k != key {
+			kept = append(kept, part)
+			continue
+		}
+		v, err := url.QueryUnescape(v)
+		if err != nil || (match != nil && !match(v)) {
+			kept = append(kept, part)
+			continue
+		}
+		values = append(values, v)
+	}
+	return strings.Join(kept, "&"), values
+}
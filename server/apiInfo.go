@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// APIInfoPath is the HTTP path for the API info endpoint, if enabled.
+const APIInfoPath = "/api-info"
+
+// apiInfo is the response of the API info endpoint, describing how clients
+// may access resgate. The schema is found in docs/api-info.schema.json, and
+// fields must only be added in a backwards compatible way.
+type apiInfo struct {
+	Protocol    string        `json:"protocol"`
+	APIPath     string        `json:"apiPath"`
+	WSPath      string        `json:"wsPath"`
+	APIEncoding string        `json:"apiEncoding"`
+	Verbs       []apiInfoVerb `json:"verbs"`
+}
+
+// apiInfoVerb describes how requests with an HTTP method are routed. Action is
+// either "get", for getting resources, or "call", for calling methods. For
+// call actions, Method is the call method mapped to the HTTP method, or empty
+// if the call method is taken from the last part of the path.
+type apiInfoVerb struct {
+	Verb   string `json:"verb"`
+	Action string `json:"action"`
+	Method string `json:"method,omitempty"`
+}
+
+// isAPIInfoPath returns true if the path is handled by the API info endpoint.
+func (s *Service) isAPIInfoPath(path string) bool {
+	return s.cfg.APIInfo && path == APIInfoPath
+}
+
+// apiInfoHandler responds to GET requests with the API info. No secrets are
+// included, as the endpoint requires no authorization.
+func (s *Service) apiInfoHandler(w http.ResponseWriter, r *http.Request) {
+	err := s.setCommonHeaders(w, r)
+	if isPreflight(r) {
+		setPreflightHeaders(w, r, "GET, HEAD, OPTIONS")
+		return
+	}
+	if err != nil {
+		httpError(w, err, s.enc)
+		return
+	}
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+		httpError(w, reserr.ErrMethodNotAllowed, s.enc)
+		return
+	}
+
+	b, _ := json.Marshal(s.apiInfo(r))
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == "GET" {
+		w.Write(b)
+	}
+}
+
+// apiInfo returns the API info, with the API path as seen by the client of
+// the request.
+func (s *Service) apiInfo(r *http.Request) apiInfo {
+	verbs := []apiInfoVerb{
+		{Verb: "GET", Action: "get"},
+		{Verb: "HEAD", Action: "get"},
+		{Verb: "POST", Action: "call"},
+	}
+	for _, m := range []struct {
+		verb   string
+		method *string
+	}{
+		{"PUT", s.cfg.PUTMethod},
+		{"DELETE", s.cfg.DELETEMethod},
+		{"PATCH", s.cfg.PATCHMethod},
+	} {
+		if m.method != nil {
+			verbs = append(verbs, apiInfoVerb{Verb: m.verb, Action: "call", Method: *m.method})
+		}
+	}
+	return apiInfo{
+		Protocol:    ProtocolVersion,
+		APIPath:     s.publicAPIPath(r),
+		WSPath:      s.cfg.WSPath,
+		APIEncoding: s.cfg.APIEncoding,
+		Verbs:       verbs,
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// jsonLinesContentType is the content type of JSON Lines encoded collections.
+const jsonLinesContentType = "application/x-ndjson"
+
+var errJSONLinesNotCollection = &reserr.Error{Code: reserr.CodeBadRequest, Message: "JSON Lines format is only available for collections"}
+
+// extractJSONLinesFormat removes any FormatQueryParam parameter with the value
+// jsonlines from a raw query string, and returns the remaining query. The
+// returned flag is true if the parameter was found.
+func extractJSONLinesFormat(rawQuery string) (string, bool) {
+	query, values := extractQueryParam(rawQuery, FormatQueryParam, func(v string) bool {
+		return v == "jsonlines"
+	})
+	return query, len(values) > 0
+}
+
+// acceptsJSONLines returns true if the request's Accept header contains
+// application/x-ndjson.
+func acceptsJSONLines(r *http.Request) bool {
+	for _, h := range r.Header["Accept"] {
+		for _, part := range strings.Split(h, ",") {
+			mt, _, err := mime.ParseMediaType(part)
+			if err == nil && mt == jsonLinesContentType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// encodeJSONLines writes a collection subscription as JSON Lines to w, with
+// one line per collection value. Primitive values are written as is. A
+// resource reference is written as an object with the resource ID as key, and
+// the resource encoded as for the json API encoding, with href and model,
+// collection, or error. Each line is flushed once written, without buffering
+// the full output.
+//
+// If an error occurs while encoding, the stream is terminated with a line
+// containing an object with the error.
+func encodeJSONLines(w io.Writer, s *Subscription, apiPath string) error {
+	flusher, _ := w.(http.Flusher)
+	e := &jsonTree{apiPath: apiPath}
+	for _, v := range s.CollectionValues() {
+		e.b.Reset()
+		e.path = append(e.path[:0], s.rid)
+		err := e.encodeJSONLine(s, v)
+		if err != nil {
+			e.b.Reset()
+			e.b.Write([]byte(`{"error":`))
+			e.b.Write(jsonEncodeError(reserr.RESError(err)))
+			e.b.WriteByte('}')
+		}
+		e.b.WriteByte('\n')
+		if _, werr := w.Write(e.b.Bytes()); werr != nil {
+			return werr
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeJSONLine encodes a single collection value of a JSON Lines stream.
+func (e *jsonTree) encodeJSONLine(s *Subscription, v codec.Value) error {
+	if !v.IsReference() {
+		return e.encodeValue(s, v)
+	}
+	e.b.WriteByte('{')
+	dta, err := json.Marshal(v.RID)
+	if err != nil {
+		return err
+	}
+	e.b.Write(dta)
+	e.b.WriteByte(':')
+	if err := e.encodeValue(s, v); err != nil {
+		return err
+	}
+	e.b.WriteByte('}')
+	return nil
+}
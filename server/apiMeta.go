@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/resgateio/resgate/server/codec"
+)
+
+// metaAllowedHeaders contains the canonical names of the headers that a
+// service may set on an HTTP response using a response meta object.
+var metaAllowedHeaders = map[string]bool{
+	"Cache-Control":       true,
+	"Content-Disposition": true,
+	"Content-Language":    true,
+	"Etag":                true,
+	"Expires":             true,
+	"Last-Modified":       true,
+	"Location":            true,
+	"Retry-After":         true,
+	"Set-Cookie":          true,
+	"Www-Authenticate":    true,
+}
+
+// metaHeaderPrefix is the prefix of custom headers that a service may set on
+// an HTTP response using a response meta object.
+const metaHeaderPrefix = "X-"
+
+// isMetaHeaderAllowed returns true if a service may set the header with the
+// canonical name key using a response meta object.
+func isMetaHeaderAllowed(key string) bool {
+	return metaAllowedHeaders[key] || (strings.HasPrefix(key, metaHeaderPrefix) && len(key) > len(metaHeaderPrefix))
+}
+
+// applyMeta sets the allowed headers of a response meta object on the HTTP
+// response, and returns the meta status code. If meta is nil, or holds no
+// valid status code, 0 is returned. Headers that are not allowed are ignored.
+func (s *Service) applyMeta(w http.ResponseWriter, meta *codec.Meta) int {
+	if meta == nil {
+		return 0
+	}
+
+	h := w.Header()
+	for k, v := range meta.Header {
+		key := http.CanonicalHeaderKey(k)
+		if !isMetaHeaderAllowed(key) {
+			s.Debugf("Ignoring meta header not allowed in response: %s", k)
+			continue
+		}
+		h[key] = append([]string(nil), v...)
+	}
+
+	if meta.Status != 0 && (meta.Status < 200 || meta.Status > 599) {
+		s.Debugf("Ignoring invalid meta status in response: %d", meta.Status)
+		return 0
+	}
+	return meta.Status
+}
+
+// setTokenCookie sets the token cookie on the HTTP response if the tokenCookie
+// setting is set, and the response meta object holds a cookie value. An empty
+// cookie value clears the cookie.
+func (s *Service) setTokenCookie(w http.ResponseWriter, meta *codec.Meta) {
+	if meta == nil || meta.Cookie == nil {
+		return
+	}
+	cfg := s.cfg
+	if cfg.TokenCookie == nil {
+		s.Debugf("Ignoring meta cookie with no tokenCookie setting")
+		return
+	}
+
+	c := &http.Cookie{
+		Name:     *cfg.TokenCookie,
+		Value:    *meta.Cookie,
+		Path:     "/",
+		Domain:   cfg.TokenCookieDomain,
+		MaxAge:   cfg.TokenCookieMaxAge,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: cfg.tokenCookieSameSite,
+	}
+	if c.Value == "" {
+		c.MaxAge = -1
+	}
+	if err := c.Valid(); err != nil {
+		s.Debugf("Ignoring invalid meta cookie: %s", err)
+		return
+	}
+	http.SetCookie(w, c)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/rescache"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// isPreflight returns true if the request is a CORS preflight request.
+func isPreflight(r *http.Request) bool {
+	return r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// setPreflightHeaders sets the headers of a response to a CORS preflight
+// request, allowing the methods and any requested headers.
+func setPreflightHeaders(w http.ResponseWriter, r *http.Request, methods string) {
+	w.Header().Set("Access-Control-Allow-Methods", methods)
+	reqHeaders := r.Header["Access-Control-Request-Headers"]
+	if len(reqHeaders) > 0 {
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(reqHeaders, ", "))
+	}
+}
+
+// handleOptions responds to a non-preflight OPTIONS request with an Allow
+// header listing the methods the client has access to use on the resource.
+// If the client has no access, 403 Forbidden is responded.
+func (s *Service) handleOptions(w http.ResponseWriter, r *http.Request, reqID string, rid string) {
+	if !codec.IsValidRID(rid, true) {
+		notFoundHandler(w, r, s.enc)
+		return
+	}
+
+	s.temporaryConn(w, r, reqID, s.enc, func(c *wsConn, w http.ResponseWriter, cb func([]byte, error, bool)) {
+		sub, ok := c.subs[rid]
+		if !ok {
+			sub = NewSubscription(c, rid, nil)
+		}
+		sub.loadAccess(func(a *rescache.Access) {
+			if a.Error != nil && a.Error.Code != reserr.CodeAccessDenied {
+				cb(nil, a.Error, false)
+				return
+			}
+			methods := s.allowedMethods(a)
+			if len(methods) == 0 {
+				httpErrorStatus(w, reserr.ErrAccessDenied, http.StatusForbidden, s.enc)
+				cb(nil, nil, true)
+				return
+			}
+			w.Header().Set("Allow", strings.Join(append(methods, "OPTIONS"), ", "))
+			w.WriteHeader(http.StatusOK)
+			cb(nil, nil, true)
+		}, nil)
+	})
+}
+
+// allowedMethods returns the HTTP methods, excluding OPTIONS, that are
+// granted by the access. POST is allowed if any call access is granted, while
+// PUT, DELETE, and PATCH are only allowed if mapped to a call method that is
+// granted.
+func (s *Service) allowedMethods(a *rescache.Access) []string {
+	var methods []string
+	if a.CanGet() == nil {
+		methods = append(methods, "GET", "HEAD")
+	}
+	if a.Error != nil || a.Call == "" {
+		return methods
+	}
+	methods = append(methods, "POST")
+	for _, m := range []struct {
+		method string
+		action *string
+	}{
+		{"PUT", s.cfg.PUTMethod},
+		{"DELETE", s.cfg.DELETEMethod},
+		{"PATCH", s.cfg.PATCHMethod},
+	} {
+		if m.action != nil && a.CanCall(*m.action) == nil {
+			methods = append(methods, m.method)
+		}
+	}
+	return methods
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// APIPathEncoder is implemented by API encoders that encode resource
+// references as paths, allowing the path prefix to be set for each request.
+type APIPathEncoder interface {
+	// EncodeGETWithPath encodes a GET response, using apiPath as prefix for
+	// resource reference paths. The apiPath starts and ends with /.
+	EncodeGETWithPath(s *Subscription, apiPath string) ([]byte, error)
+}
+
+// publicAPIPath returns the API path prefix as seen by the client, used for
+// paths in hrefs and Location headers. It is the APIPath prefixed by the
+// X-Forwarded-Prefix header, if the forwardedPrefix setting is enabled and the
+// header holds a valid prefix, or otherwise by the publicPathPrefix setting.
+func (s *Service) publicAPIPath(r *http.Request) string {
+	prefix := s.cfg.publicPathPrefix
+	if s.cfg.ForwardedPrefix {
+		if h := r.Header.Get(ForwardedPrefixHeader); h != "" && isValidPathPrefix(h) {
+			prefix = strings.TrimRight(h, "/")
+		}
+	}
+	return prefix + s.cfg.APIPath
+}
+
+// encodeGET encodes a GET response with the API encoder, using apiPath as
+// prefix for resource reference paths, if supported by the encoder.
+func encodeGET(enc APIEncoder, sub *Subscription, apiPath string) ([]byte, error) {
+	if pe, ok := enc.(APIPathEncoder); ok {
+		return pe.EncodeGETWithPath(sub, apiPath)
+	}
+	return enc.EncodeGET(sub)
+}
+
+// isValidPathPrefix returns true if p is a URL path starting with /, without
+// query or fragment, and containing only printable ASCII characters,
+// excluding space and backslash.
+func isValidPathPrefix(p string) bool {
+	if p == "" || p[0] != '/' || strings.Contains(p, "//") {
+		return false
+	}
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if c <= ' ' || c > '~' || c == '?' || c == '#' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// deadlineWriter is a http.ResponseWriter that discards anything written
+// after the HTTP request deadline has passed. Headers are buffered until the
+// status is written, to prevent data races on the underlying writer.
+type deadlineWriter struct {
+	w           http.ResponseWriter
+	h           http.Header
+	mu          sync.Mutex
+	timedOut    bool
+	wroteHeader bool
+}
+
+func newDeadlineWriter(w http.ResponseWriter) *deadlineWriter {
+	return &deadlineWriter{
+		w: w,
+		h: w.Header().Clone(),
+	}
+}
+
+// Header returns the buffered header map.
+func (dw *deadlineWriter) Header() http.Header {
+	return dw.h
+}
+
+// WriteHeader writes the buffered headers and status code, unless the
+// deadline has passed.
+func (dw *deadlineWriter) WriteHeader(code int) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	dw.writeHeader(code)
+}
+
+func (dw *deadlineWriter) writeHeader(code int) {
+	if dw.timedOut || dw.wroteHeader {
+		return
+	}
+	dw.wroteHeader = true
+	h := dw.w.Header()
+	for k, v := range dw.h {
+		h[k] = v
+	}
+	dw.w.WriteHeader(code)
+}
+
+// Write writes the data to the response, unless the deadline has passed.
+func (dw *deadlineWriter) Write(b []byte) (int, error) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	if dw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	dw.writeHeader(http.StatusOK)
+	return dw.w.Write(b)
+}
+
+// Flush sends any buffered data to the client, unless the deadline has
+// passed or the underlying writer does not support flushing.
+func (dw *deadlineWriter) Flush() {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	if dw.timedOut {
+		return
+	}
+	if f, ok := dw.w.(http.Flusher); ok {
+		dw.writeHeader(http.StatusOK)
+		f.Flush()
+	}
+}
+
+// timeout writes a system.timeout error with status 504 Gateway Timeout and
+// discards any later writes. It returns false if a response has already been
+// started, in which case nothing is written.
+func (dw *deadlineWriter) timeout(enc APIEncoder) bool {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	if dw.wroteHeader {
+		return false
+	}
+	dw.timedOut = true
+	httpErrorStatus(dw.w, reserr.ErrTimeout, http.StatusGatewayTimeout, enc)
+	return true
+}
+
+// awaitDeadline waits for done to be closed. If an HTTP request timeout is
+// set, and the timeout passes before a response is started, a 504 Gateway
+// Timeout is written and awaitDeadline returns without waiting any further.
+// Any request still in progress will complete in the background, and the
+// responses are cached but discarded.
+func (s *Service) awaitDeadline(dw *deadlineWriter, done <-chan struct{}, enc APIEncoder) {
+	if s.cfg.HTTPRequestTimeout == 0 {
+		<-done
+		return
+	}
+	timer := time.NewTimer(time.Duration(s.cfg.HTTPRequestTimeout) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		if !dw.timeout(enc) {
+			<-done
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// setETag sets the ETag header of an HTTP GET response to the resource
+// version set by the service, if the version is valid for the subscription's
+// data.
+func setETag(w http.ResponseWriter, sub *Subscription) {
+	if sub.resourceSub == nil {
+		return
+	}
+	if v := sub.resourceSub.VersionAt(sub.version); v != 0 {
+		w.Header().Set("ETag", `"`+strconv.FormatUint(v, 10)+`"`)
+	}
+}
+
+// parseIfMatch parses an If-Match header holding a single entity tag with a
+// resource version, as set in the ETag header. It returns the version, or zero
+// if the header is empty or "*". False is returned if the header is invalid.
+func parseIfMatch(h string) (uint64, bool) {
+	h = strings.TrimSpace(h)
+	if h == "" || h == "*" {
+		return 0, true
+	}
+	if len(h) < 3 || h[0] != '"' || h[len(h)-1] != '"' {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(h[1:len(h)-1], 10, 64)
+	if err != nil || v == 0 {
+		return 0, false
+	}
+	return v, true
+}
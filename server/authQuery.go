@@ -0,0 +1,35 @@
+package server
+
+import "net/http"
+
+// authQueryParams returns the query parameters of the WebSocket connection
+// URL named by the authQueryParams setting, and the request with the
+// parameters removed from its URL, to prevent them from being passed on as
+// part of the uri. If the URL has none of the parameters, nil and the
+// unaltered request are returned.
+func (s *Service) authQueryParams(r *http.Request) (map[string][]string, *http.Request) {
+	if len(s.cfg.AuthQueryParams) == 0 || r.URL.RawQuery == "" {
+		return nil, r
+	}
+	q := r.URL.Query()
+	var params map[string][]string
+	for _, name := range s.cfg.AuthQueryParams {
+		if v, ok := q[name]; ok {
+			if params == nil {
+				params = make(map[string][]string, len(s.cfg.AuthQueryParams))
+			}
+			params[name] = v
+			q.Del(name)
+		}
+	}
+	if params == nil {
+		return nil, r
+	}
+
+	u := *r.URL
+	u.RawQuery = q.Encode()
+	r = r.WithContext(r.Context())
+	r.URL = &u
+	r.RequestURI = u.RequestURI()
+	return params, r
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/mq"
+	"github.com/resgateio/resgate/server/rescache"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// CacheInspectSubject is the subject prefix for cache inspection requests. The
+// full subject is CacheInspectSubject+"."+instanceID.
+const CacheInspectSubject = "resgate.cache"
+
+type cacheInspectRequest struct {
+	Secret string `json:"secret"`
+	RID    string `json:"rid"`
+}
+
+type cacheInspectResult struct {
+	RID          string        `json:"rid"`
+	Cached       bool          `json:"cached"`
+	Type         string        `json:"type,omitempty"`
+	Model        interface{}   `json:"model,omitempty"`
+	Collection   interface{}   `json:"collection,omitempty"`
+	Error        *reserr.Error `json:"error,omitempty"`
+	Truncated    bool          `json:"truncated,omitempty"`
+	Version      uint64        `json:"version,omitempty"`
+	Resetting    bool          `json:"resetting,omitempty"`
+	Throttled    bool          `json:"throttled,omitempty"`
+	Subscribers  *int          `json:"subscribers,omitempty"`
+	LastModified *time.Time    `json:"lastModified,omitempty"`
+}
+
+// startCacheInspect subscribes to cache inspection requests, if a secret is
+// configured and the messaging client supports request subscriptions and
+// publishing.
+// Service.mu is held when called
+func (s *Service) startCacheInspect() error {
+	if s.cfg.CacheInspectSecret == "" {
+		return nil
+	}
+	rs, ok := s.mq.(mq.RequestSubscriber)
+	p, pok := s.mq.(mq.Publisher)
+	if !ok || !pok {
+		s.Errorf("Cache inspection not supported by messaging client")
+		return nil
+	}
+	subj := CacheInspectSubject + "." + s.cfg.instanceID
+	if _, err := rs.SubscribeRequests(subj, func(subj string, reply string, payload []byte) {
+		s.handleCacheInspect(p, reply, payload)
+	}); err != nil {
+		return err
+	}
+	s.Logf("Cache inspection listening on %s", subj)
+	return nil
+}
+
+// handleCacheInspect handles a cache inspection request. The request is
+// handled in a separate goroutine to not stall the messaging client.
+func (s *Service) handleCacheInspect(p mq.Publisher, reply string, payload []byte) {
+	if reply == "" {
+		return
+	}
+	go func() {
+		result, err := s.inspectCache(payload)
+		var data []byte
+		if err != nil {
+			data, _ = json.Marshal(struct {
+				Error *reserr.Error `json:"error"`
+			}{reserr.RESError(err)})
+		} else {
+			data, _ = json.Marshal(struct {
+				Result *cacheInspectResult `json:"result"`
+			}{result})
+		}
+		if err := p.Publish(reply, data); err != nil {
+			s.Errorf("Error responding to cache inspection request: %s", err)
+		}
+	}()
+}
+
+// inspectCache decodes a cache inspection request and returns the cached
+// resource. The secret is validated before the resource ID.
+func (s *Service) inspectCache(payload []byte) (*cacheInspectResult, error) {
+	var req cacheInspectRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, reserr.ErrInvalidParams
+	}
+	if subtle.ConstantTimeCompare([]byte(req.Secret), []byte(s.cfg.CacheInspectSecret)) != 1 {
+		return nil, reserr.ErrAccessDenied
+	}
+	if err := codec.ValidateRID(req.RID, true); err != nil {
+		return nil, err
+	}
+
+	rname, query := parseRID(req.RID)
+	result := &cacheInspectResult{RID: req.RID}
+	r, ok := s.cache.Snapshot(rname, query)
+	if !ok {
+		return result, nil
+	}
+	result.Cached = true
+	result.Version = r.Version
+	result.Resetting = r.Resetting
+	result.Throttled = r.Throttled
+	result.Subscribers = &r.Subscribers
+	if !r.LastModified.IsZero() {
+		result.LastModified = &r.LastModified
+	}
+	switch r.Type {
+	case rescache.TypeModel:
+		result.Type = "model"
+		result.Model, result.Truncated = capModel(r.Model, s.cfg.cacheInspectMaxSize)
+	case rescache.TypeCollection:
+		result.Type = "collection"
+		result.Collection, result.Truncated = capCollection(r.Collection, s.cfg.cacheInspectMaxSize)
+	default:
+		result.Type = "error"
+		result.Error = reserr.RESError(r.Err)
+	}
+	return result, nil
+}
+
+// capModel returns the model values, in key order, until the encoded size
+// would exceed maxSize bytes. The returned flag is true if any value was left
+// out.
+func capModel(m map[string]codec.Value, maxSize int) (map[string]json.RawMessage, bool) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make(map[string]json.RawMessage, len(m))
+	size := 2
+	for _, k := range keys {
+		v := m[k]
+		size += len(k) + len(v.RawMessage) + 4
+		if size > maxSize {
+			return out, true
+		}
+		out[k] = v.RawMessage
+	}
+	return out, false
+}
+
+// capCollection returns the collection values, in order, until the encoded
+// size would exceed maxSize bytes. The returned flag is true if any value was
+// left out.
+func capCollection(col []codec.Value, maxSize int) ([]json.RawMessage, bool) {
+	out := make([]json.RawMessage, 0, len(col))
+	size := 2
+	for _, v := range col {
+		size += len(v.RawMessage) + 1
+		if size > maxSize {
+			return out, true
+		}
+		out = append(out, v.RawMessage)
+	}
+	return out, false
+}
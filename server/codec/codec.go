@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/resgateio/resgate/server/reserr"
 )
@@ -13,24 +15,30 @@ var (
 	noQueryGetRequest               = []byte(`{}`)
 	errMissingResult                = reserr.InternalError(errors.New("response missing result"))
 	errInvalidResponse              = reserr.InternalError(errors.New("invalid service response"))
+	errAccessBatchMismatch          = reserr.InternalError(errors.New("access batch response count mismatch"))
 	errInvalidValue                 = reserr.InternalError(errors.New("invalid value"))
 	errInvalidValueEmptyRID         = reserr.InternalError(errors.New(`invalid value: resource references requires a non-empty "rid" value`))
+	errInvalidValueEmptyRel         = reserr.InternalError(errors.New(`invalid value: linked resource references requires a non-empty "rel" value`))
 	errInvalidValueAmbiguous        = reserr.InternalError(errors.New(`invalid value: ambiguous value type`))
 	errInvalidValueObjectNotAllowed = reserr.InternalError(errors.New(`invalid value: nested json object must be wrapped as a data value`))
 	errInvalidValueArrayNotAllowed  = reserr.InternalError(errors.New(`invalid value: nested json array must be wrapped as a data value`))
+	errInvalidTokenTTL              = reserr.InternalError(errors.New("invalid token ttl: must be zero or a positive number"))
 )
 
 const (
 	actionDelete = "delete"
+	actionUnset  = "unset"
 )
 
 // Request represents a RES-service request
 // https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#requests
 type Request struct {
-	Params interface{} `json:"params,omitempty"`
-	Token  interface{} `json:"token,omitempty"`
-	Query  string      `json:"query,omitempty"`
-	CID    string      `json:"cid"`
+	Params          interface{} `json:"params,omitempty"`
+	Token           interface{} `json:"token,omitempty"`
+	Query           string      `json:"query,omitempty"`
+	CID             string      `json:"cid"`
+	ReqID           string      `json:"reqId,omitempty"`
+	ExpectedVersion uint64      `json:"expectedVersion,omitempty"`
 }
 
 // Response represents a RES-service response
@@ -39,6 +47,18 @@ type Response struct {
 	Result   json.RawMessage `json:"result"`
 	Resource *Resource       `json:"resource"`
 	Error    *reserr.Error   `json:"error"`
+	Meta     *Meta           `json:"meta"`
+}
+
+// Meta represents the optional meta object of a RES-service call or auth
+// response, used to set the status and headers of an HTTP response, to flag a
+// result to be written as a file, and to set the token cookie on an HTTP auth
+// response.
+type Meta struct {
+	Status int                 `json:"status,omitempty"`
+	Header map[string][]string `json:"header,omitempty"`
+	File   bool                `json:"file,omitempty"`
+	Cookie *string             `json:"cookie,omitempty"`
 }
 
 // AccessResponse represents the response of a RES-service access request
@@ -50,8 +70,38 @@ type AccessResponse struct {
 
 // AccessResult represents the response result of a RES-service access request
 type AccessResult struct {
-	Get  bool   `json:"get"`
-	Call string `json:"call"`
+	Get   bool   `json:"get"`
+	Call  string `json:"call"`
+	Batch bool   `json:"batch"`
+	Scope string `json:"scope"`
+}
+
+// AccessBatchRequest represents a RES-service access batch request
+type AccessBatchRequest struct {
+	Resources []AccessBatchResource `json:"resources"`
+	Token     interface{}           `json:"token,omitempty"`
+	CID       string                `json:"cid"`
+}
+
+// AccessBatchResource represents a resource in a RES-service access batch
+// request
+type AccessBatchResource struct {
+	RID   string `json:"rid"`
+	Query string `json:"query,omitempty"`
+}
+
+// AccessBatchResponse represents the response of a RES-service access batch
+// request
+type AccessBatchResponse struct {
+	Result *AccessBatchResult `json:"result"`
+	Error  *reserr.Error      `json:"error"`
+}
+
+// AccessBatchResult represents the response result of a RES-service access
+// batch request, with an access response for each requested resource, in the
+// same order.
+type AccessBatchResult struct {
+	Resources []json.RawMessage `json:"resources"`
 }
 
 // GetRequest represents a RES-service get request
@@ -68,9 +118,13 @@ type GetResponse struct {
 
 // GetResult represent the response result of a RES-service get request
 type GetResult struct {
-	Model      map[string]Value `json:"model"`
-	Collection []Value          `json:"collection"`
-	Query      string           `json:"query"`
+	Model      map[string]Value           `json:"model"`
+	Collection []Value                    `json:"collection"`
+	Query      string                     `json:"query"`
+	Version    uint64                     `json:"version"`
+	Meta       map[string]json.RawMessage `json:"meta"`
+	Total      *int64                     `json:"total"`
+	Group      string                     `json:"group"`
 }
 
 // AuthRequest represents a RES-service auth request
@@ -81,6 +135,9 @@ type AuthRequest struct {
 	Host       string      `json:"host,omitempty"`
 	RemoteAddr string      `json:"remoteAddr,omitempty"`
 	URI        string      `json:"uri,omitempty"`
+	Cookie     string      `json:"cookie,omitempty"`
+
+	QueryParams map[string][]string `json:"queryParams,omitempty"`
 }
 
 // NewResponse represents the response of a RES-service new call request
@@ -132,6 +189,13 @@ type EventQueryEvent struct {
 type ConnTokenEvent struct {
 	Token json.RawMessage `json:"token"`
 	TID   string          `json:"tid"`
+	TTL   int64           `json:"ttl"`
+}
+
+// ConnDisconnectEvent represents a RES-server connection disconnect event
+// https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#connection-disconnect-event
+type ConnDisconnectEvent struct {
+	Reason string `json:"reason"`
 }
 
 // ChangeEvent represent a RES-server model change event
@@ -167,20 +231,77 @@ type SystemTokenReset struct {
 	Subject string   `json:"subject"`
 }
 
+// SystemTokenIDs represents a RES-server system token revoke or token expired
+// event, identifying the affected tokens by token ID.
+// https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#system-token-revoke-event
+// https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#system-token-expired-event
+type SystemTokenIDs struct {
+	TIDs []string `json:"tids"`
+}
+
+// SystemPrime represents a RES-server system prime event, holding the data of
+// a resource in the same shape as a get response result.
+// https://github.com/resgateio/resgate/blob/master/docs/res-service-protocol.md#system-prime-event
+type SystemPrime struct {
+	RID string `json:"rid"`
+	GetResult
+}
+
 // Requester is the connection making the request
 type Requester interface {
 	// CID returns the connection of the requester
 	CID() string
+	// RequestID returns the ID of the client request causing the request,
+	// or empty string if no request ID should be sent.
+	RequestID() string
+}
+
+// VersionRequester is a Requester that may expect the resource to have a
+// specific version.
+type VersionRequester interface {
+	Requester
+	// ExpectedVersion returns the resource version expected by the client,
+	// or zero if no version is expected.
+	ExpectedVersion() uint64
 }
 
 // AuthRequester is the connection making the auth request
 type AuthRequester interface {
 	// CID returns the connection of the requester
 	CID() string
+	// RequestID returns the ID of the client request causing the request,
+	// or empty string if no request ID should be sent.
+	RequestID() string
 	// HTTPRequest returns the http.Request from requesters (upgraded) HTTP connection
 	HTTPRequest() *http.Request
 }
 
+// HeaderRequester is a requester setting headers on the requests sent on its
+// behalf, such as a trace ID.
+type HeaderRequester interface {
+	// RequestHeaders returns the headers to set on the request, or nil if no
+	// headers should be set. The returned map must not be modified.
+	RequestHeaders() map[string][]string
+}
+
+// QueryParamsRequester is an AuthRequester that may have query parameters of
+// its connection URL to include in auth requests.
+type QueryParamsRequester interface {
+	AuthRequester
+	// QueryParams returns the query parameters to include in auth requests,
+	// or nil if there are none.
+	QueryParams() map[string][]string
+}
+
+// CookieRequester is an AuthRequester that may hold a token cookie set by a
+// previous auth response.
+type CookieRequester interface {
+	AuthRequester
+	// TokenCookie returns the value of the token cookie sent with the
+	// requester's HTTP request, or empty string if no cookie was sent.
+	TokenCookie() string
+}
+
 // ValueType is an enum reprenting the value type
 type ValueType byte
 
@@ -188,10 +309,12 @@ type ValueType byte
 const (
 	ValueTypeNone ValueType = iota
 	ValueTypeDelete
+	ValueTypeUnset
 	ValueTypePrimitive
 	ValueTypeReference
 	ValueTypeSoftReference
 	ValueTypeData
+	ValueTypeLinkedResource
 )
 
 // Value represents a RES value
@@ -200,6 +323,7 @@ type Value struct {
 	json.RawMessage
 	Type  ValueType
 	RID   string
+	Rel   string // Relationship label of a linked resource reference
 	Inner json.RawMessage
 }
 
@@ -207,16 +331,35 @@ type Value struct {
 type ValueObject struct {
 	RID    *string         `json:"rid"`
 	Soft   bool            `json:"soft"`
+	Rel    *string         `json:"rel"`
 	Action *string         `json:"action"`
 	Data   json.RawMessage `json:"data"`
 }
 
+// linkedResource is the JSON encoding of a linked resource reference.
+type linkedResource struct {
+	RID string `json:"rid"`
+	Rel string `json:"rel"`
+}
+
 // IsProper returns true if the value's type is either a primitive, a
 // reference, or a data value.
 func (v Value) IsProper() bool {
 	return v.Type >= ValueTypePrimitive
 }
 
+// IsReference returns true if the value is a resource reference, with or
+// without a relationship label, but not a soft reference.
+func (v Value) IsReference() bool {
+	return v.Type == ValueTypeReference || v.Type == ValueTypeLinkedResource
+}
+
+// IsRemoval returns true if the value is a delete or unset action, removing
+// the property from the model.
+func (v Value) IsRemoval() bool {
+	return v.Type == ValueTypeDelete || v.Type == ValueTypeUnset
+}
+
 // DeleteValue is a predeclared delete action value
 var DeleteValue = Value{
 	RawMessage: json.RawMessage(`{"action":"delete"}`),
@@ -262,20 +405,40 @@ func (v *Value) UnmarshalJSON(data []byte) error {
 			if !IsValidRID(v.RID, true) {
 				return reserr.InternalError(errors.New(`invalid value: resource reference rid "` + v.RID + `" is invalid`))
 			}
-			if mvo.Soft {
+			switch {
+			case mvo.Rel != nil:
+				// Invalid to have a relationship on a soft reference
+				if mvo.Soft {
+					return errInvalidValueAmbiguous
+				}
+				if *mvo.Rel == "" {
+					return errInvalidValueEmptyRel
+				}
+				v.Rel = *mvo.Rel
+				v.Type = ValueTypeLinkedResource
+				v.RawMessage, err = json.Marshal(linkedResource{RID: v.RID, Rel: v.Rel})
+				if err != nil {
+					return err
+				}
+			case mvo.Soft:
 				v.Type = ValueTypeSoftReference
-			} else {
+			default:
 				v.Type = ValueTypeReference
 			}
 		case mvo.Action != nil:
-			// Invalid to have both Action and Data set, or if action is not actionDelete
+			// Invalid to have both Action and Data set, or if action is not
+			// actionDelete or actionUnset
 			if mvo.Data != nil {
 				return errInvalidValueAmbiguous
 			}
-			if *mvo.Action != actionDelete {
+			switch *mvo.Action {
+			case actionDelete:
+				v.Type = ValueTypeDelete
+			case actionUnset:
+				v.Type = ValueTypeUnset
+			default:
 				return reserr.InternalError(errors.New(`invalid value: unknown action "` + *mvo.Action + `"`))
 			}
-			v.Type = ValueTypeDelete
 		case mvo.Data != nil:
 			v.Inner = mvo.Data
 			dc := mvo.Data[0]
@@ -313,6 +476,8 @@ func (v Value) Equal(w Value) bool {
 		fallthrough
 	case ValueTypeSoftReference:
 		return v.RID == w.RID
+	case ValueTypeLinkedResource:
+		return v.RID == w.RID && v.Rel == w.Rel
 	}
 
 	return true
@@ -320,7 +485,18 @@ func (v Value) Equal(w Value) bool {
 
 // CreateRequest creates a JSON encoded RES-service request
 func CreateRequest(params interface{}, r Requester, query string, token interface{}) []byte {
-	out, _ := json.Marshal(Request{Params: params, Token: token, Query: query, CID: r.CID()})
+	req := Request{Params: params, Token: token, Query: query, CID: r.CID(), ReqID: r.RequestID()}
+	if vr, ok := r.(VersionRequester); ok {
+		req.ExpectedVersion = vr.ExpectedVersion()
+	}
+	out, _ := json.Marshal(req)
+	return out
+}
+
+// CreateAccessBatchRequest creates a JSON encoded RES-service access batch
+// request
+func CreateAccessBatchRequest(resources []AccessBatchResource, cid string, token interface{}) []byte {
+	out, _ := json.Marshal(AccessBatchRequest{Resources: resources, Token: token, CID: cid})
 	return out
 }
 
@@ -336,13 +512,22 @@ func CreateGetRequest(query string) []byte {
 // CreateAuthRequest creates a JSON encoded RES-service auth request
 func CreateAuthRequest(params interface{}, r AuthRequester, query string, token interface{}) []byte {
 	hr := r.HTTPRequest()
-	out, _ := json.Marshal(AuthRequest{
-		Request:    Request{Params: params, Token: token, Query: query, CID: r.CID()},
+	var cookie string
+	if cr, ok := r.(CookieRequester); ok {
+		cookie = cr.TokenCookie()
+	}
+	req := AuthRequest{
+		Request:    Request{Params: params, Token: token, Query: query, CID: r.CID(), ReqID: r.RequestID()},
 		Header:     hr.Header,
 		Host:       hr.Host,
 		RemoteAddr: hr.RemoteAddr,
 		URI:        hr.RequestURI,
-	})
+		Cookie:     cookie,
+	}
+	if qr, ok := r.(QueryParamsRequester); ok {
+		req.QueryParams = qr.QueryParams()
+	}
+	out, _ := json.Marshal(req)
 	return out
 }
 
@@ -362,30 +547,40 @@ func DecodeGetResponse(payload []byte) (*GetResult, error) {
 		return nil, errMissingResult
 	}
 
-	// Assert we got either a model or a collection
-	res := r.Result
+	if err := validateGetResult(r.Result); err != nil {
+		return nil, err
+	}
+
+	return r.Result, nil
+}
+
+// validateGetResult asserts that a get result has either a model or a
+// collection, containing only proper values.
+func validateGetResult(res *GetResult) error {
+	if res.Total != nil && *res.Total < 0 {
+		return errInvalidResponse
+	}
 	if res.Model != nil {
 		if res.Collection != nil {
-			return nil, errInvalidResponse
+			return errInvalidResponse
 		}
 		// Assert model only has proper values
 		for _, v := range res.Model {
 			if !v.IsProper() {
-				return nil, errInvalidResponse
+				return errInvalidResponse
 			}
 		}
 	} else if res.Collection != nil {
 		// Assert collection only has proper values
 		for _, v := range res.Collection {
 			if !v.IsProper() {
-				return nil, errInvalidResponse
+				return errInvalidResponse
 			}
 		}
 	} else {
-		return nil, errInvalidResponse
+		return errInvalidResponse
 	}
-
-	return r.Result, nil
+	return nil
 }
 
 // DecodeEvent decodes a JSON encoded RES-service event
@@ -472,7 +667,12 @@ func IsLegacyChangeEvent(data json.RawMessage) bool {
 		return false
 	}
 
-	if len(r) != 1 {
+	l := len(r)
+	// The optional ts field is not a model property
+	if _, ok := r["ts"]; ok {
+		l--
+	}
+	if l != 1 {
 		return true
 	}
 
@@ -507,6 +707,22 @@ func DecodeChangeEvent(data json.RawMessage) (map[string]Value, error) {
 	return r.Values, nil
 }
 
+// EventTimestamp represents the optional timestamp of a RES-server event.
+type EventTimestamp struct {
+	TS *time.Time `json:"ts"`
+}
+
+// DecodeEventTimestamp decodes the ts field of a JSON encoded event payload.
+// The zero time is returned if the field is missing, or not a valid RFC 3339
+// time.
+func DecodeEventTimestamp(data json.RawMessage) time.Time {
+	var r EventTimestamp
+	if json.Unmarshal(data, &r) != nil || r.TS == nil {
+		return time.Time{}
+	}
+	return *r.TS
+}
+
 // DecodeLegacyChangeEvent decodes a JSON encoded RES-service v1.0 model change event
 func DecodeLegacyChangeEvent(data json.RawMessage) (map[string]Value, error) {
 	var r map[string]Value
@@ -576,31 +792,57 @@ func DecodeAccessResponse(payload []byte) (*AccessResult, *reserr.Error) {
 	return r.Result, nil
 }
 
-// DecodeCallResponse decodes a JSON encoded RES-service call response
-func DecodeCallResponse(payload []byte) (json.RawMessage, string, error) {
+// DecodeAccessBatchResponse decodes a JSON encoded RES-service access batch
+// response into the access responses of each resource. An error is returned
+// if the number of access responses does not match count.
+func DecodeAccessBatchResponse(payload []byte, count int) ([]json.RawMessage, *reserr.Error) {
+	var r AccessBatchResponse
+	err := json.Unmarshal(payload, &r)
+	if err != nil {
+		return nil, reserr.RESError(err)
+	}
+
+	if r.Error != nil {
+		return nil, r.Error
+	}
+
+	if r.Result == nil {
+		return nil, errMissingResult
+	}
+
+	if len(r.Result.Resources) != count {
+		return nil, errAccessBatchMismatch
+	}
+
+	return r.Result.Resources, nil
+}
+
+// DecodeCallResponse decodes a JSON encoded RES-service call or auth response.
+// Any meta object is returned both on success and on error.
+func DecodeCallResponse(payload []byte) (json.RawMessage, string, *Meta, error) {
 	var r Response
 	err := json.Unmarshal(payload, &r)
 	if err != nil {
-		return nil, "", reserr.RESError(err)
+		return nil, "", nil, reserr.RESError(err)
 	}
 
 	if r.Error != nil {
-		return nil, "", r.Error
+		return nil, "", r.Meta, r.Error
 	}
 
 	if r.Resource != nil {
 		rid := r.Resource.RID
 		if !IsValidRID(rid, true) {
-			return nil, "", errInvalidResponse
+			return nil, "", nil, errInvalidResponse
 		}
-		return nil, rid, nil
+		return nil, rid, r.Meta, nil
 	}
 
 	if r.Result == nil {
-		return nil, "", errMissingResult
+		return nil, "", nil, errMissingResult
 	}
 
-	return r.Result, "", nil
+	return r.Result, "", r.Meta, nil
 }
 
 // TryDecodeLegacyNewResult tries to detect legacy v1.1.1 behavior.
@@ -636,6 +878,23 @@ func DecodeConnTokenEvent(payload []byte) (*ConnTokenEvent, error) {
 	if err != nil {
 		return nil, reserr.RESError(err)
 	}
+	if e.TTL < 0 {
+		return nil, errInvalidTokenTTL
+	}
+	return &e, nil
+}
+
+// DecodeConnDisconnectEvent decodes a JSON encoded RES-service connection
+// disconnect event. An empty payload is accepted as an event without reason.
+func DecodeConnDisconnectEvent(payload []byte) (*ConnDisconnectEvent, error) {
+	var e ConnDisconnectEvent
+	if len(payload) == 0 {
+		return &e, nil
+	}
+	err := json.Unmarshal(payload, &e)
+	if err != nil {
+		return nil, reserr.RESError(err)
+	}
 	return &e, nil
 }
 
@@ -670,37 +929,119 @@ func DecodeSystemTokenReset(data json.RawMessage) (SystemTokenReset, error) {
 	return r, nil
 }
 
-// IsValidRID returns true if the RID is valid, otherwise false.
-// If allowQuery flag is false, encountering a question mark (?) will
-// cause IsValidRID to return false.
-func IsValidRID(rid string, allowQuery bool) bool {
+// DecodeSystemTokenIDs decodes a JSON encoded RES-service system token revoke
+// or token expired event
+func DecodeSystemTokenIDs(data json.RawMessage) (SystemTokenIDs, error) {
+	var r SystemTokenIDs
+	if len(data) == 0 {
+		return r, nil
+	}
+
+	err := json.Unmarshal(data, &r)
+	if err != nil {
+		return r, err
+	}
+
+	return r, nil
+}
+
+// DecodeSystemPrime decodes a JSON encoded RES-service system prime event.
+// The resource ID must be valid and without query, and the event must contain
+// either a model or a collection.
+func DecodeSystemPrime(data json.RawMessage) (*SystemPrime, error) {
+	var r SystemPrime
+	err := json.Unmarshal(data, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ValidateRID(r.RID, false); err != nil {
+		return nil, err
+	}
+
+	if err := validateGetResult(&r.GetResult); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// InvalidRIDData is the error data of an invalid resource ID error.
+type InvalidRIDData struct {
+	// Pos is the byte position of the offending character. For empty
+	// segments, it is the position where the segment was expected.
+	Pos int `json:"pos"`
+}
+
+// ValidateRID validates a resource ID, returning nil if it is valid, or else
+// a system.invalidRequest error with InvalidRIDData describing the position
+// of the offending character. The resource name part must consist of
+// non-empty dot separated segments of printable ASCII characters, excluding
+// the NATS wildcard characters (* and >). If allowQuery flag is false,
+// encountering a question mark (?) will cause an error. Anything following a
+// question mark is the query, and is not validated.
+func ValidateRID(rid string, allowQuery bool) error {
+	return validateRID(rid, allowQuery, false, 0)
+}
+
+// ValidateRIDPart validates a single resource ID segment, such as a method
+// name, in the same way as ValidateRID, but without allowing dots or a query.
+// The offset is added to the position in the error data, and should be the
+// position of the part within the client provided string.
+func ValidateRIDPart(part string, offset int) error {
+	return validateRID(part, false, true, offset)
+}
+
+func validateRID(rid string, allowQuery bool, single bool, offset int) error {
 	start := true
-	for _, r := range rid {
-		if r == '?' {
-			return allowQuery && !start
+	for i := 0; i < len(rid); i++ {
+		c := rid[i]
+		if c == '?' {
+			if !allowQuery {
+				return invalidRIDError(offset+i, "illegal character")
+			}
+			if start {
+				return invalidRIDError(offset+i, "empty segment")
+			}
+			return nil
 		}
-		if r < 33 || r > 126 || r == '*' || r == '>' {
-			return false
+		if c < 33 || c > 126 || c == '*' || c == '>' {
+			return invalidRIDError(offset+i, "illegal character")
 		}
-		if r == '.' {
+		if c == '.' {
+			if single {
+				return invalidRIDError(offset+i, "illegal character")
+			}
 			if start {
-				return false
+				return invalidRIDError(offset+i, "empty segment")
 			}
 			start = true
 		} else {
 			start = false
 		}
 	}
+	if start {
+		return invalidRIDError(offset+len(rid), "empty segment")
+	}
+	return nil
+}
 
-	return !start
+func invalidRIDError(pos int, reason string) *reserr.Error {
+	return &reserr.Error{
+		Code:    reserr.CodeInvalidRequest,
+		Message: "Invalid resource ID: " + reason + " at position " + strconv.Itoa(pos),
+		Data:    InvalidRIDData{Pos: pos},
+	}
+}
+
+// IsValidRID returns true if the RID is valid, otherwise false.
+// If allowQuery flag is false, encountering a question mark (?) will
+// cause IsValidRID to return false.
+func IsValidRID(rid string, allowQuery bool) bool {
+	return ValidateRID(rid, allowQuery) == nil
 }
 
 // IsValidRIDPart returns true if the RID part is valid, otherwise false.
 func IsValidRIDPart(part string) bool {
-	for _, r := range part {
-		if r < 33 || r > 126 || r == '.' || r == '*' || r == '>' || r == '?' {
-			return false
-		}
-	}
-	return len(part) > 0
+	return ValidateRIDPart(part, 0) == nil
 }
@@ -0,0 +1,186 @@
+package codec_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// Test Value unmarshaling of action values, and that the value is marshaled
+// back unchanged.
+func TestValueUnmarshalJSON_Action(t *testing.T) {
+	tbl := []struct {
+		JSON         string
+		ExpectedType codec.ValueType
+	}{
+		{`{"action":"delete"}`, codec.ValueTypeDelete},
+		{`{"action":"unset"}`, codec.ValueTypeUnset},
+	}
+
+	for _, l := range tbl {
+		var v codec.Value
+		if err := json.Unmarshal([]byte(l.JSON), &v); err != nil {
+			t.Fatalf("expected no error unmarshaling %s, but got: %s", l.JSON, err)
+		}
+		if v.Type != l.ExpectedType {
+			t.Errorf("expected %s to have type %d, but got %d", l.JSON, l.ExpectedType, v.Type)
+		}
+		if !v.IsRemoval() {
+			t.Errorf("expected %s to be a removal", l.JSON)
+		}
+		if v.IsProper() {
+			t.Errorf("expected %s not to be a proper value", l.JSON)
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("expected no error marshaling %s, but got: %s", l.JSON, err)
+		}
+		if string(b) != l.JSON {
+			t.Errorf("expected %s to be marshaled unchanged, but got %s", l.JSON, b)
+		}
+	}
+}
+
+// Test Value unmarshaling of invalid action values.
+func TestValueUnmarshalJSON_InvalidAction_ReturnsError(t *testing.T) {
+	for _, data := range []string{
+		`{"action":"remove"}`,
+		`{"action":"unset","data":42}`,
+	} {
+		var v codec.Value
+		if err := json.Unmarshal([]byte(data), &v); err == nil {
+			t.Errorf("expected an error unmarshaling %s, but got none", data)
+		}
+	}
+}
+
+// Test ValidateRID with valid and invalid resource IDs
+func TestValidateRID(t *testing.T) {
+	tbl := []struct {
+		RID         string
+		AllowQuery  bool
+		ExpectedPos int // Expected error position. -1 means valid.
+	}{
+		// Valid
+		{"test", false, -1},
+		{"test.model", false, -1},
+		{"test.model.42", false, -1},
+		{"test.model_$#!%&~", false, -1},
+		{"test.model?foo=bar", true, -1},
+		{"test.model?q=*>. \t", true, -1},
+		// Empty segments
+		{"", false, 0},
+		{".test", false, 0},
+		{"test..model", false, 5},
+		{"test.", false, 5},
+		{"?foo=bar", true, 0},
+		{"test.?foo=bar", true, 5},
+		// Illegal characters
+		{"test.model?foo=bar", false, 10},
+		{"test.*", false, 5},
+		{"test.>", false, 5},
+		{"test.mo*del", false, 7},
+		{"test model", false, 4},
+		{"test\tmodel", false, 4},
+		{"test\x00model", false, 4},
+		{"test\x7fmodel", false, 4},
+		{"täst.model", false, 1},
+		{"test.模型", false, 5},
+	}
+
+	for i, l := range tbl {
+		err := codec.ValidateRID(l.RID, l.AllowQuery)
+		if l.ExpectedPos == -1 {
+			if err != nil {
+				t.Fatalf("expected %#v to be valid, but got error %s in test #%d", l.RID, err, i+1)
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatalf("expected %#v to be invalid, but got no error in test #%d", l.RID, i+1)
+		}
+		rerr, ok := err.(*reserr.Error)
+		if !ok || rerr.Code != reserr.CodeInvalidRequest {
+			t.Fatalf("expected %s error, but got %#v in test #%d", reserr.CodeInvalidRequest, err, i+1)
+		}
+		data, ok := rerr.Data.(codec.InvalidRIDData)
+		if !ok || data.Pos != l.ExpectedPos {
+			t.Fatalf("expected error position %d, but got %#v in test #%d", l.ExpectedPos, rerr.Data, i+1)
+		}
+	}
+}
+
+// Test ValidateRIDPart adds the offset to the error position, and disallows dots
+func TestValidateRIDPart(t *testing.T) {
+	tbl := []struct {
+		Part        string
+		Offset      int
+		ExpectedPos int // Expected error position. -1 means valid.
+	}{
+		{"method", 5, -1},
+		{"", 5, 5},
+		{"me.thod", 5, 7},
+		{"me*thod", 5, 7},
+		{"method?foo", 5, 11},
+	}
+
+	for i, l := range tbl {
+		err := codec.ValidateRIDPart(l.Part, l.Offset)
+		if l.ExpectedPos == -1 {
+			if err != nil {
+				t.Fatalf("expected %#v to be valid, but got error %s in test #%d", l.Part, err, i+1)
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatalf("expected %#v to be invalid, but got no error in test #%d", l.Part, i+1)
+		}
+		if data := err.(*reserr.Error).Data.(codec.InvalidRIDData); data.Pos != l.ExpectedPos {
+			t.Fatalf("expected error position %d, but got %d in test #%d", l.ExpectedPos, data.Pos, i+1)
+		}
+	}
+}
+
+// Fuzz ValidateRID to ensure that no resource ID accepted by the validator
+// can be used to inject wildcards, whitespace, or empty tokens into a subject.
+func FuzzValidateRID(f *testing.F) {
+	for _, seed := range []string{"test.model", "test.model?q=foo", "test.*", "test.>", "test..model", "test model", "täst", "test.model?", ""} {
+		f.Add(seed, true)
+		f.Add(seed, false)
+	}
+
+	f.Fuzz(func(t *testing.T, rid string, allowQuery bool) {
+		err := codec.ValidateRID(rid, allowQuery)
+		if codec.IsValidRID(rid, allowQuery) != (err == nil) {
+			t.Fatalf("IsValidRID and ValidateRID disagree on %#v", rid)
+		}
+		if err != nil {
+			pos := err.(*reserr.Error).Data.(codec.InvalidRIDData).Pos
+			if pos < 0 || pos > len(rid) {
+				t.Fatalf("error position %d out of range for %#v", pos, rid)
+			}
+			return
+		}
+
+		name := rid
+		if idx := strings.IndexByte(rid, '?'); idx >= 0 {
+			if !allowQuery {
+				t.Fatalf("expected query to be rejected in %#v", rid)
+			}
+			name = rid[:idx]
+		}
+		for _, token := range strings.Split(name, ".") {
+			if token == "" {
+				t.Fatalf("accepted empty token in %#v", rid)
+			}
+			for _, c := range []byte(token) {
+				if c <= ' ' || c >= 0x7f || c == '*' || c == '>' {
+					t.Fatalf("accepted illegal character %q in %#v", c, rid)
+				}
+			}
+		}
+	})
+}
@@ -4,12 +4,17 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"net/url"
 	"sort"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/rescache"
+	"github.com/resgateio/resgate/server/reserr"
+	"github.com/rs/xid"
 )
 
 // Config holds server configuration
@@ -26,14 +31,107 @@ type Config struct {
 	DELETEMethod *string `json:"deleteMethod"`
 	PATCHMethod  *string `json:"patchMethod"`
 
+	HeaderAuthHeaders []string `json:"headerAuthHeaders"`
+	TokenRefresh      *string  `json:"tokenRefresh"`
+
+	HeaderAuthChain []HeaderAuthMethod `json:"headerAuthChain"`
+	AuthQueryParams []string           `json:"authQueryParams"`
+
+	JWTAuth *JWTAuth `json:"jwtAuth"`
+
+	TokenCookie         *string `json:"tokenCookie"`
+	TokenCookieDomain   string  `json:"tokenCookieDomain"`
+	TokenCookieSameSite string  `json:"tokenCookieSameSite"`
+	TokenCookieMaxAge   int     `json:"tokenCookieMaxAge"`
+
+	PublicPathPrefix string `json:"publicPathPrefix"`
+	ForwardedPrefix  bool   `json:"forwardedPrefix"`
+
+	MethodNotFoundAliases []string `json:"methodNotFoundAliases"`
+	MethodNotFoundStatus  int      `json:"methodNotFoundStatus"`
+
 	TLS     bool   `json:"tls"`
 	TLSCert string `json:"certFile"`
 	TLSKey  string `json:"keyFile"`
 
-	WSCompression bool `json:"wsCompression"`
+	HTTPReadTimeout    int `json:"httpReadTimeout"`
+	HTTPWriteTimeout   int `json:"httpWriteTimeout"`
+	HTTPIdleTimeout    int `json:"httpIdleTimeout"`
+	TCPKeepAlivePeriod int `json:"tcpKeepAlivePeriod"`
+
+	WSCompression      bool `json:"wsCompression"`
+	SessionTTL         int  `json:"sessionTTL"`
+	HTTPRequestTimeout int  `json:"httpRequestTimeout"`
+	SendRequestID      bool `json:"sendRequestId"`
+	ClientTimeoutMax   int  `json:"clientTimeoutMax"`
+	LocalIfMatch       bool `json:"localIfMatch"`
+
+	TraceIDHeader string `json:"traceIdHeader"`
+
+	TraceContext bool `json:"traceContext"`
+
+	ConnectionCountThresholds []int `json:"connectionCountThresholds"`
+
+	IdempotencyTTL     int `json:"idempotencyTTL"`
+	IdempotencyMaxKeys int `json:"idempotencyMaxKeys"`
+
+	RequestLimit        int `json:"requestLimit"`
+	RequestQueueSize    int `json:"requestQueueSize"`
+	RequestQueueTimeout int `json:"requestQueueTimeout"`
+
+	RequestRetryAttempts int `json:"requestRetryAttempts"`
+	RequestRetryBackoff  int `json:"requestRetryBackoff"`
+	RequestRetryDeadline int `json:"requestRetryDeadline"`
 
 	ResetThrottle     int `json:"resetThrottle"`
 	ReferenceThrottle int `json:"referenceThrottle"`
+	NegativeCacheTTL  int `json:"negativeCacheTTL"`
+	ResourceIdleTTL   int `json:"resourceIdleTTL"`
+	AccessCacheTTL    int `json:"accessCacheTTL"`
+
+	AccessRevalidateInterval int `json:"accessRevalidateInterval"`
+	AccessBatchWindow        int `json:"accessBatchWindow"`
+
+	ReadYourWrites       bool `json:"readYourWrites"`
+	ReadYourWritesWindow int  `json:"readYourWritesWindow"`
+
+	TypeMismatchAction string `json:"typeMismatchAction"`
+
+	PrimeMaxSize   int `json:"primeMaxSize"`
+	PrimeRateLimit int `json:"primeRateLimit"`
+
+	FormFileMaxSize   int `json:"formFileMaxSize"`
+	FileResultMaxSize int `json:"fileResultMaxSize"`
+
+	MaxModelFields    int `json:"maxModelFields"`
+	MaxCollectionSize int `json:"maxCollectionSize"`
+
+	TimestampEvents bool `json:"timestampEvents"`
+	SystemEvents    bool `json:"systemEvents"`
+
+	EventRateLimit          int            `json:"eventRateLimit"`
+	EventRateLimitOverrides map[string]int `json:"eventRateLimitOverrides"`
+	MaxEventQueueSize       int            `json:"maxEventQueueSize"`
+
+	ReconnectWindow     int `json:"reconnectWindow"`
+	ReconnectBufferSize int `json:"reconnectBufferSize"`
+
+	CacheMaxAge map[string]int `json:"cacheMaxAge"`
+
+	BackgroundRefresh map[string]int `json:"backgroundRefresh"`
+
+	UnsharedResources []string `json:"unsharedResources"`
+
+	AccessPolicies map[string]string `json:"accessPolicies"`
+
+	AllowedResources []string `json:"allowedResources"`
+	DeniedResources  []string `json:"deniedResources"`
+
+	InstanceID          string `json:"instanceId"`
+	CacheInspectSecret  string `json:"cacheInspectSecret"`
+	CacheInspectMaxSize int    `json:"cacheInspectMaxSize"`
+	AdminToken          string `json:"adminToken"`
+	APIInfo             bool   `json:"apiInfo"`
 
 	NoHTTP bool `json:"-"` // Disable start of the HTTP server. Used for testing
 
@@ -44,6 +142,55 @@ type Config struct {
 	headerAuthAction string
 	allowOrigin      []string
 	allowMethods     string
+	publicPathPrefix string
+
+	headerAuthHeaders []string
+	headerAuthChain   []headerAuthStep
+
+	connectionCountThresholds []int
+
+	tokenRefreshRID    string
+	tokenRefreshAction string
+
+	tokenCookieSameSite http.SameSite
+
+	traceIDHeader string
+
+	accessRevalidateInterval time.Duration
+	accessBatchWindow        time.Duration
+
+	methodNotFoundCodes  map[string]bool
+	methodNotFoundStatus int
+	primeMaxSize         int
+	primeRateLimit       int
+	formFileMaxSize      int
+	fileResultMaxSize    int
+	idempotencyMaxKeys   int
+	cacheMaxAges         []cacheMaxAgePattern
+	negativeCacheTTL     time.Duration
+	resourceIdleTTL      time.Duration
+	accessCacheTTL       time.Duration
+	readYourWritesWindow time.Duration
+	clientTimeoutMax     time.Duration
+	typeMismatchAction   rescache.TypeMismatchAction
+	instanceID           string
+	cacheInspectMaxSize  int
+	maxEventQueueSize    int
+	reconnectWindow      time.Duration
+	reconnectBufferSize  int
+	requestQueueTimeout  time.Duration
+	requestRetryBackoff  time.Duration
+	requestRetryDeadline time.Duration
+
+	accessPolicies map[string]rescache.AccessPolicy
+
+	allowedResources []rescache.ResourcePattern // Nil means all resources are allowed
+	deniedResources  []rescache.ResourcePattern
+
+	httpReadTimeout    time.Duration
+	httpWriteTimeout   time.Duration
+	httpIdleTimeout    time.Duration
+	tcpKeepAlivePeriod time.Duration
 }
 
 // SetDefault sets the default values
@@ -118,6 +265,64 @@ func (c *Config) prepare() error {
 		}
 	}
 
+	if c.TokenRefresh != nil {
+		s := *c.TokenRefresh
+		idx := strings.LastIndexByte(s, '.')
+		if codec.IsValidRID(s, false) && idx >= 0 {
+			c.tokenRefreshRID = s[:idx]
+			c.tokenRefreshAction = s[idx+1:]
+		} else {
+			return fmt.Errorf("invalid tokenRefresh setting (%s)\n\tmust be a valid resource method", s)
+		}
+	}
+
+	if err := c.prepareTokenCookie(); err != nil {
+		return err
+	}
+
+	c.traceIDHeader = ""
+	if c.TraceIDHeader != "" {
+		if !isValidHeaderName(c.TraceIDHeader) {
+			return fmt.Errorf("invalid traceIdHeader setting (%#v)\n\tmust be a valid header name", c.TraceIDHeader)
+		}
+		c.traceIDHeader = http.CanonicalHeaderKey(c.TraceIDHeader)
+	}
+
+	c.headerAuthHeaders = nil
+	if len(c.HeaderAuthHeaders) > 0 {
+		if c.HeaderAuth == nil {
+			return errors.New("invalid headerAuthHeaders setting\n\trequires headerAuth to be set")
+		}
+		for _, h := range c.HeaderAuthHeaders {
+			if !isValidHeaderName(h) {
+				return fmt.Errorf("invalid headerAuthHeaders setting (%#v)\n\tmust be valid header names", h)
+			}
+			c.headerAuthHeaders = append(c.headerAuthHeaders, http.CanonicalHeaderKey(h))
+		}
+	}
+
+	if err := c.prepareHeaderAuthChain(); err != nil {
+		return err
+	}
+	if err := c.prepareJWTAuth(); err != nil {
+		return err
+	}
+
+	c.connectionCountThresholds = nil
+	for _, n := range c.ConnectionCountThresholds {
+		if n <= 0 {
+			return fmt.Errorf("invalid connectionCountThresholds setting (%d)\n\tmust be positive numbers of connections", n)
+		}
+		c.connectionCountThresholds = append(c.connectionCountThresholds, n)
+	}
+	sort.Ints(c.connectionCountThresholds)
+
+	for _, p := range c.AuthQueryParams {
+		if p == "" {
+			return errors.New("invalid authQueryParams setting\n\tmust not contain empty query parameter names")
+		}
+	}
+
 	if c.AllowOrigin != nil {
 		c.allowOrigin = strings.Split(*c.AllowOrigin, ";")
 		if err := validateAllowOrigin(c.allowOrigin); err != nil {
@@ -148,6 +353,298 @@ func (c *Config) prepare() error {
 		c.allowMethods += ", PATCH"
 	}
 
+	c.methodNotFoundCodes = map[string]bool{reserr.CodeMethodNotFound: true}
+	for _, code := range c.MethodNotFoundAliases {
+		if code == "" {
+			return errors.New("invalid methodNotFoundAliases setting\n\tmust not contain empty error codes")
+		}
+		c.methodNotFoundCodes[code] = true
+	}
+	switch c.MethodNotFoundStatus {
+	case 0:
+		c.methodNotFoundStatus = http.StatusNotFound
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		c.methodNotFoundStatus = c.MethodNotFoundStatus
+	default:
+		return fmt.Errorf("invalid methodNotFoundStatus setting (%d)\n\tvalid options are 404 or 405", c.MethodNotFoundStatus)
+	}
+
+	if c.SessionTTL < 0 {
+		return fmt.Errorf("invalid sessionTTL setting (%d)\n\tmust be zero or a positive number of milliseconds", c.SessionTTL)
+	}
+	if c.HTTPRequestTimeout < 0 {
+		return fmt.Errorf("invalid httpRequestTimeout setting (%d)\n\tmust be zero or a positive number of milliseconds", c.HTTPRequestTimeout)
+	}
+	if c.HTTPReadTimeout < 0 {
+		return fmt.Errorf("invalid httpReadTimeout setting (%d)\n\tmust be zero or a positive number of milliseconds", c.HTTPReadTimeout)
+	}
+	c.httpReadTimeout = time.Duration(c.HTTPReadTimeout) * time.Millisecond
+	if c.HTTPWriteTimeout < 0 {
+		return fmt.Errorf("invalid httpWriteTimeout setting (%d)\n\tmust be zero or a positive number of milliseconds", c.HTTPWriteTimeout)
+	}
+	c.httpWriteTimeout = time.Duration(c.HTTPWriteTimeout) * time.Millisecond
+	if c.HTTPIdleTimeout < 0 {
+		return fmt.Errorf("invalid httpIdleTimeout setting (%d)\n\tmust be zero or a positive number of milliseconds", c.HTTPIdleTimeout)
+	}
+	c.httpIdleTimeout = time.Duration(c.HTTPIdleTimeout) * time.Millisecond
+	if c.TCPKeepAlivePeriod < 0 {
+		return fmt.Errorf("invalid tcpKeepAlivePeriod setting (%d)\n\tmust be zero or a positive number of milliseconds", c.TCPKeepAlivePeriod)
+	}
+	c.tcpKeepAlivePeriod = time.Duration(c.TCPKeepAlivePeriod) * time.Millisecond
+	if c.EventRateLimit < 0 {
+		return fmt.Errorf("invalid eventRateLimit setting (%d)\n\tmust be zero or a positive number of events per second", c.EventRateLimit)
+	}
+	for p, l := range c.EventRateLimitOverrides {
+		if !rescache.ParseResourcePattern(p).IsValid() {
+			return fmt.Errorf("invalid eventRateLimitOverrides setting (%s)\n\tmust be a valid resource pattern", p)
+		}
+		if l < 0 {
+			return fmt.Errorf("invalid eventRateLimitOverrides setting for %s (%d)\n\tmust be zero or a positive number of events per second", p, l)
+		}
+	}
+	for p, maxAge := range c.CacheMaxAge {
+		if !rescache.ParseResourcePattern(p).IsValid() {
+			return fmt.Errorf("invalid cacheMaxAge setting (%s)\n\tmust be a valid resource pattern", p)
+		}
+		if maxAge < 0 {
+			return fmt.Errorf("invalid cacheMaxAge setting for %s (%d)\n\tmust be zero or a positive number of seconds", p, maxAge)
+		}
+	}
+	c.cacheMaxAges = newCacheMaxAges(c.CacheMaxAge)
+	for p, interval := range c.BackgroundRefresh {
+		if !rescache.ParseResourcePattern(p).IsValid() {
+			return fmt.Errorf("invalid backgroundRefresh setting (%s)\n\tmust be a valid resource pattern", p)
+		}
+		if interval < 0 {
+			return fmt.Errorf("invalid backgroundRefresh setting for %s (%d)\n\tmust be zero or a positive number of milliseconds", p, interval)
+		}
+	}
+	for _, p := range c.UnsharedResources {
+		if !rescache.ParseResourcePattern(p).IsValid() {
+			return fmt.Errorf("invalid unsharedResources setting (%s)\n\tmust be a valid resource pattern", p)
+		}
+	}
+	c.accessPolicies = make(map[string]rescache.AccessPolicy, len(c.AccessPolicies))
+	for p, policy := range c.AccessPolicies {
+		if !rescache.ParseResourcePattern(p).IsValid() {
+			return fmt.Errorf("invalid accessPolicies setting (%s)\n\tmust be a valid resource pattern", p)
+		}
+		switch policy {
+		case "publicGet":
+			c.accessPolicies[p] = rescache.PolicyPublicGet
+		case "denyAll":
+			c.accessPolicies[p] = rescache.PolicyDenyAll
+		default:
+			return fmt.Errorf("invalid accessPolicies setting for %s (%s)\n\tvalid options are publicGet or denyAll", p, policy)
+		}
+	}
+	c.allowedResources = nil
+	if c.AllowedResources != nil {
+		c.allowedResources = make([]rescache.ResourcePattern, 0, len(c.AllowedResources))
+		for _, r := range c.AllowedResources {
+			p := rescache.ParseResourcePattern(r)
+			if !p.IsValid() {
+				return fmt.Errorf("invalid allowedResources setting (%s)\n\tmust be a valid resource pattern", r)
+			}
+			c.allowedResources = append(c.allowedResources, p)
+		}
+	}
+	c.deniedResources = make([]rescache.ResourcePattern, 0, len(c.DeniedResources))
+	for _, r := range c.DeniedResources {
+		p := rescache.ParseResourcePattern(r)
+		if !p.IsValid() {
+			return fmt.Errorf("invalid deniedResources setting (%s)\n\tmust be a valid resource pattern", r)
+		}
+		c.deniedResources = append(c.deniedResources, p)
+	}
+	if c.IdempotencyTTL < 0 {
+		return fmt.Errorf("invalid idempotencyTTL setting (%d)\n\tmust be zero or a positive number of milliseconds", c.IdempotencyTTL)
+	}
+	switch {
+	case c.IdempotencyMaxKeys < 0:
+		return fmt.Errorf("invalid idempotencyMaxKeys setting (%d)\n\tmust be zero or a positive number of keys", c.IdempotencyMaxKeys)
+	case c.IdempotencyMaxKeys == 0:
+		c.idempotencyMaxKeys = DefaultIdempotencyMaxKeys
+	default:
+		c.idempotencyMaxKeys = c.IdempotencyMaxKeys
+	}
+
+	switch c.TypeMismatchAction {
+	case "", "delete":
+		c.typeMismatchAction = rescache.TypeMismatchDelete
+	case "unsubscribe":
+		c.typeMismatchAction = rescache.TypeMismatchUnsubscribe
+	default:
+		return fmt.Errorf("invalid typeMismatchAction setting (%s)\n\tvalid options are delete or unsubscribe", c.TypeMismatchAction)
+	}
+
+	switch {
+	case c.ClientTimeoutMax < 0:
+		return fmt.Errorf("invalid clientTimeoutMax setting (%d)\n\tmust be zero or a positive number of milliseconds", c.ClientTimeoutMax)
+	case c.ClientTimeoutMax == 0:
+		c.clientTimeoutMax = DefaultClientTimeoutMax
+	default:
+		c.clientTimeoutMax = time.Duration(c.ClientTimeoutMax) * time.Millisecond
+	}
+
+	switch {
+	case c.NegativeCacheTTL < -1:
+		return fmt.Errorf("invalid negativeCacheTTL setting (%d)\n\tmust be -1, or zero or a positive number of milliseconds", c.NegativeCacheTTL)
+	case c.NegativeCacheTTL == -1:
+		c.negativeCacheTTL = 0
+	case c.NegativeCacheTTL == 0:
+		c.negativeCacheTTL = DefaultNegativeCacheTTL
+	default:
+		c.negativeCacheTTL = time.Duration(c.NegativeCacheTTL) * time.Millisecond
+	}
+
+	switch {
+	case c.ResourceIdleTTL < 0:
+		return fmt.Errorf("invalid resourceIdleTTL setting (%d)\n\tmust be zero or a positive number of milliseconds", c.ResourceIdleTTL)
+	case c.ResourceIdleTTL == 0:
+		c.resourceIdleTTL = UnsubscribeDelay
+	default:
+		c.resourceIdleTTL = time.Duration(c.ResourceIdleTTL) * time.Millisecond
+	}
+
+	if c.AccessCacheTTL < 0 {
+		return fmt.Errorf("invalid accessCacheTTL setting (%d)\n\tmust be zero or a positive number of milliseconds", c.AccessCacheTTL)
+	}
+	c.accessCacheTTL = time.Duration(c.AccessCacheTTL) * time.Millisecond
+
+	if c.AccessRevalidateInterval < 0 {
+		return fmt.Errorf("invalid accessRevalidateInterval setting (%d)\n\tmust be zero or a positive number of milliseconds", c.AccessRevalidateInterval)
+	}
+	c.accessRevalidateInterval = time.Duration(c.AccessRevalidateInterval) * time.Millisecond
+
+	if c.AccessBatchWindow < 0 {
+		return fmt.Errorf("invalid accessBatchWindow setting (%d)\n\tmust be zero or a positive number of milliseconds", c.AccessBatchWindow)
+	}
+	c.accessBatchWindow = time.Duration(c.AccessBatchWindow) * time.Millisecond
+
+	switch {
+	case c.ReadYourWritesWindow < 0:
+		return fmt.Errorf("invalid readYourWritesWindow setting (%d)\n\tmust be zero or a positive number of milliseconds", c.ReadYourWritesWindow)
+	case !c.ReadYourWrites:
+		if c.ReadYourWritesWindow != 0 {
+			return fmt.Errorf("invalid readYourWritesWindow setting (%d)\n\trequires readYourWrites to be true", c.ReadYourWritesWindow)
+		}
+		c.readYourWritesWindow = 0
+	case c.ReadYourWritesWindow == 0:
+		c.readYourWritesWindow = DefaultReadYourWritesWindow
+	default:
+		c.readYourWritesWindow = time.Duration(c.ReadYourWritesWindow) * time.Millisecond
+	}
+
+	switch {
+	case c.PrimeMaxSize < 0:
+		return fmt.Errorf("invalid primeMaxSize setting (%d)\n\tmust be zero or a positive number of bytes", c.PrimeMaxSize)
+	case c.PrimeMaxSize == 0:
+		c.primeMaxSize = DefaultPrimeMaxSize
+	default:
+		c.primeMaxSize = c.PrimeMaxSize
+	}
+	switch {
+	case c.PrimeRateLimit < 0:
+		return fmt.Errorf("invalid primeRateLimit setting (%d)\n\tmust be zero or a positive number of events per second", c.PrimeRateLimit)
+	case c.PrimeRateLimit == 0:
+		c.primeRateLimit = DefaultPrimeRateLimit
+	default:
+		c.primeRateLimit = c.PrimeRateLimit
+	}
+
+	switch {
+	case c.FormFileMaxSize < 0:
+		return fmt.Errorf("invalid formFileMaxSize setting (%d)\n\tmust be zero or a positive number of bytes", c.FormFileMaxSize)
+	case c.FormFileMaxSize == 0:
+		c.formFileMaxSize = DefaultFormFileMaxSize
+	default:
+		c.formFileMaxSize = c.FormFileMaxSize
+	}
+	switch {
+	case c.FileResultMaxSize < 0:
+		return fmt.Errorf("invalid fileResultMaxSize setting (%d)\n\tmust be zero or a positive number of bytes", c.FileResultMaxSize)
+	case c.FileResultMaxSize == 0:
+		c.fileResultMaxSize = DefaultFileResultMaxSize
+	default:
+		c.fileResultMaxSize = c.FileResultMaxSize
+	}
+
+	if c.InstanceID == "" {
+		c.instanceID = xid.New().String()
+	} else if codec.IsValidRIDPart(c.InstanceID) {
+		c.instanceID = c.InstanceID
+	} else {
+		return fmt.Errorf("invalid instanceId setting (%s)\n\tmust be a valid subject token", c.InstanceID)
+	}
+
+	if c.MaxModelFields < 0 {
+		return fmt.Errorf("invalid maxModelFields setting (%d)\n\tmust be zero or a positive number of fields", c.MaxModelFields)
+	}
+	if c.MaxCollectionSize < 0 {
+		return fmt.Errorf("invalid maxCollectionSize setting (%d)\n\tmust be zero or a positive number of values", c.MaxCollectionSize)
+	}
+
+	switch {
+	case c.MaxEventQueueSize < 0:
+		return fmt.Errorf("invalid maxEventQueueSize setting (%d)\n\tmust be zero or a positive number of events", c.MaxEventQueueSize)
+	case c.MaxEventQueueSize == 0:
+		c.maxEventQueueSize = DefaultMaxEventQueueSize
+	default:
+		c.maxEventQueueSize = c.MaxEventQueueSize
+	}
+
+	if c.RequestLimit < 0 {
+		return fmt.Errorf("invalid requestLimit setting (%d)\n\tmust be zero or a positive number of requests", c.RequestLimit)
+	}
+	if c.RequestQueueSize < 0 {
+		return fmt.Errorf("invalid requestQueueSize setting (%d)\n\tmust be zero or a positive number of requests", c.RequestQueueSize)
+	}
+	if c.RequestQueueTimeout < 0 {
+		return fmt.Errorf("invalid requestQueueTimeout setting (%d)\n\tmust be zero or a positive number of milliseconds", c.RequestQueueTimeout)
+	}
+	c.requestQueueTimeout = time.Duration(c.RequestQueueTimeout) * time.Millisecond
+
+	if c.RequestRetryAttempts < 0 {
+		return fmt.Errorf("invalid requestRetryAttempts setting (%d)\n\tmust be zero or a positive number of retries", c.RequestRetryAttempts)
+	}
+	if c.RequestRetryBackoff < 0 {
+		return fmt.Errorf("invalid requestRetryBackoff setting (%d)\n\tmust be zero or a positive number of milliseconds", c.RequestRetryBackoff)
+	}
+	c.requestRetryBackoff = time.Duration(c.RequestRetryBackoff) * time.Millisecond
+	if c.RequestRetryDeadline < 0 {
+		return fmt.Errorf("invalid requestRetryDeadline setting (%d)\n\tmust be zero or a positive number of milliseconds", c.RequestRetryDeadline)
+	}
+	c.requestRetryDeadline = time.Duration(c.RequestRetryDeadline) * time.Millisecond
+
+	if c.ReconnectWindow < 0 {
+		return fmt.Errorf("invalid reconnectWindow setting (%d)\n\tmust be zero or a positive number of milliseconds", c.ReconnectWindow)
+	}
+	c.reconnectWindow = time.Duration(c.ReconnectWindow) * time.Millisecond
+
+	switch {
+	case c.ReconnectBufferSize < 0:
+		return fmt.Errorf("invalid reconnectBufferSize setting (%d)\n\tmust be zero or a positive number of events", c.ReconnectBufferSize)
+	case c.ReconnectBufferSize == 0:
+		c.reconnectBufferSize = DefaultReconnectBufferSize
+	default:
+		c.reconnectBufferSize = c.ReconnectBufferSize
+	}
+
+	switch {
+	case c.CacheInspectMaxSize < 0:
+		return fmt.Errorf("invalid cacheInspectMaxSize setting (%d)\n\tmust be zero or a positive number of bytes", c.CacheInspectMaxSize)
+	case c.CacheInspectMaxSize == 0:
+		c.cacheInspectMaxSize = DefaultCacheInspectMaxSize
+	default:
+		c.cacheInspectMaxSize = c.CacheInspectMaxSize
+	}
+
+	if c.PublicPathPrefix != "" && !isValidPathPrefix(c.PublicPathPrefix) {
+		return fmt.Errorf("invalid publicPathPrefix setting (%s)\n\tmust be a path starting with /", c.PublicPathPrefix)
+	}
+	c.publicPathPrefix = strings.TrimRight(c.PublicPathPrefix, "/")
+
 	if c.WSPath == "" {
 		c.WSPath = "/"
 	}
@@ -158,6 +655,40 @@ func (c *Config) prepare() error {
 	return nil
 }
 
+// prepareTokenCookie validates the token cookie settings.
+func (c *Config) prepareTokenCookie() error {
+	if c.TokenCookie == nil {
+		if c.TokenCookieDomain != "" || c.TokenCookieSameSite != "" || c.TokenCookieMaxAge != 0 {
+			return errors.New("invalid tokenCookie settings\n\trequires tokenCookie to be set")
+		}
+		return nil
+	}
+
+	name := *c.TokenCookie
+	if name == "" || (&http.Cookie{Name: name}).Valid() != nil {
+		return fmt.Errorf("invalid tokenCookie setting (%s)\n\tmust be a valid cookie name", name)
+	}
+	if c.TokenCookieDomain != "" && (&http.Cookie{Name: name, Domain: c.TokenCookieDomain}).Valid() != nil {
+		return fmt.Errorf("invalid tokenCookieDomain setting (%s)\n\tmust be a valid cookie domain", c.TokenCookieDomain)
+	}
+
+	switch c.TokenCookieSameSite {
+	case "", "lax":
+		c.tokenCookieSameSite = http.SameSiteLaxMode
+	case "strict":
+		c.tokenCookieSameSite = http.SameSiteStrictMode
+	case "none":
+		c.tokenCookieSameSite = http.SameSiteNoneMode
+	default:
+		return fmt.Errorf("invalid tokenCookieSameSite setting (%s)\n\tvalid options are lax, strict, or none", c.TokenCookieSameSite)
+	}
+
+	if c.TokenCookieMaxAge < 0 {
+		return fmt.Errorf("invalid tokenCookieMaxAge setting (%d)\n\tmust be zero or a positive number of seconds", c.TokenCookieMaxAge)
+	}
+	return nil
+}
+
 func validateAllowOrigin(s []string) error {
 	for i, o := range s {
 		o = toLowerASCII(o)
@@ -180,6 +711,24 @@ func validateAllowOrigin(s []string) error {
 }
 
 // toLowerASCII converts only A-Z to lower case in a string
+// isValidHeaderName returns true if s is a valid HTTP header field name, as
+// defined by the token rule of RFC 7230.
+func isValidHeaderName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			continue
+		}
+		if !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
 func toLowerASCII(s string) string {
 	var b strings.Builder
 	b.Grow(len(s))
@@ -1,8 +1,12 @@
 package server
 
 import (
+	"net/http"
 	"os"
 	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server/rescache"
 )
 
 func compareString(t *testing.T, name string, str, exp string, i int) {
@@ -32,6 +36,10 @@ func TestConfigPrepare(t *testing.T) {
 	ipv6Addr := "::1"
 	invalidAddr := "127.0.0"
 	invalidHeaderAuth := "test"
+	headerAuth := "auth.login"
+	tokenCookie := "resgate-token"
+	invalidTokenCookie := "resgate token"
+	emptyTokenCookie := ""
 	allowOriginAll := "*"
 	allowOriginSingle := "http://resgate.io"
 	allowOriginMultiple := "http://localhost;http://resgate.io"
@@ -42,6 +50,7 @@ func TestConfigPrepare(t *testing.T) {
 	allowOriginInvalidOrigin := "http://this.is/invalid"
 	method := "foo"
 	invalidMethod := "foo.bar"
+	methodNotFoundAlias := "test.noSuchMethod"
 	defaultCfg := Config{}
 	defaultCfg.SetDefault()
 
@@ -65,9 +74,62 @@ func TestConfigPrepare(t *testing.T) {
 		{Config{WSPath: "/", DELETEMethod: &method}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", DELETEMethod: &method, scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST, DELETE"}, false},
 		{Config{WSPath: "/", PATCHMethod: &method}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", PATCHMethod: &method, scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST, PATCH"}, false},
 		{Config{WSPath: "/", PUTMethod: &method, DELETEMethod: &method, PATCHMethod: &method}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", PUTMethod: &method, DELETEMethod: &method, PATCHMethod: &method, scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST, PUT, DELETE, PATCH"}, false},
+		// Method not found
+		{Config{WSPath: "/", MethodNotFoundAliases: []string{methodNotFoundAlias}}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", methodNotFoundCodes: map[string]bool{"system.methodNotFound": true, methodNotFoundAlias: true}, methodNotFoundStatus: 404}, false},
+		{Config{WSPath: "/", MethodNotFoundStatus: 405}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", methodNotFoundStatus: 405}, false},
+		// Prime limits
+		{Config{WSPath: "/"}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", primeMaxSize: DefaultPrimeMaxSize, primeRateLimit: DefaultPrimeRateLimit, idempotencyMaxKeys: DefaultIdempotencyMaxKeys, formFileMaxSize: DefaultFormFileMaxSize, fileResultMaxSize: DefaultFileResultMaxSize, cacheInspectMaxSize: DefaultCacheInspectMaxSize, maxEventQueueSize: DefaultMaxEventQueueSize, reconnectBufferSize: DefaultReconnectBufferSize}, false},
+		{Config{WSPath: "/", PrimeMaxSize: 1024, PrimeRateLimit: 10, IdempotencyMaxKeys: 100, FormFileMaxSize: 2048, FileResultMaxSize: 4096, CacheInspectMaxSize: 512, MaxEventQueueSize: 10, ReconnectBufferSize: 50, InstanceID: "gw1"}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", primeMaxSize: 1024, primeRateLimit: 10, idempotencyMaxKeys: 100, formFileMaxSize: 2048, fileResultMaxSize: 4096, cacheInspectMaxSize: 512, maxEventQueueSize: 10, reconnectBufferSize: 50, instanceID: "gw1"}, false},
+		{Config{WSPath: "/", ReconnectWindow: 30000}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", reconnectWindow: 30 * time.Second}, false},
+		// Header auth headers
+		{Config{WSPath: "/", TokenRefresh: &headerAuth}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", TokenRefresh: &headerAuth, scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", tokenRefreshRID: "auth", tokenRefreshAction: "login"}, false},
+		{Config{WSPath: "/", HeaderAuth: &headerAuth, HeaderAuthHeaders: []string{"authorization", "X-Api-Key"}}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", HeaderAuth: &headerAuth, scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", headerAuthRID: "auth", headerAuthAction: "login", headerAuthHeaders: []string{"Authorization", "X-Api-Key"}}, false},
+		// Token cookie
+		{Config{WSPath: "/", TokenCookie: &tokenCookie}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", TokenCookie: &tokenCookie, scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", tokenCookieSameSite: http.SameSiteLaxMode}, false},
+		{Config{WSPath: "/", TokenCookie: &tokenCookie, TokenCookieDomain: "example.com", TokenCookieSameSite: "strict", TokenCookieMaxAge: 3600}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", TokenCookie: &tokenCookie, TokenCookieDomain: "example.com", TokenCookieSameSite: "strict", TokenCookieMaxAge: 3600, scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", tokenCookieSameSite: http.SameSiteStrictMode}, false},
+		{Config{WSPath: "/", TokenCookie: &tokenCookie, TokenCookieSameSite: "none"}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", TokenCookie: &tokenCookie, TokenCookieSameSite: "none", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", tokenCookieSameSite: http.SameSiteNoneMode}, false},
+		// Trace ID header
+		{Config{WSPath: "/", HeaderAuthChain: []HeaderAuthMethod{{Header: "authorization", Method: "auth.jwt"}, {Header: "X-Api-Key", Method: "auth.apikey"}}}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", headerAuthChain: []headerAuthStep{{header: "Authorization", method: "auth.jwt", rid: "auth", action: "jwt"}, {header: "X-Api-Key", method: "auth.apikey", rid: "auth", action: "apikey"}}}, false},
+		{Config{WSPath: "/", ConnectionCountThresholds: []int{100, 10}}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", connectionCountThresholds: []int{10, 100}}, false},
+		{Config{WSPath: "/", TraceIDHeader: "x-trace-id"}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", TraceIDHeader: "x-trace-id", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", traceIDHeader: "X-Trace-Id"}, false},
+		// Public path prefix
+		{Config{WSPath: "/", PublicPathPrefix: "/gateway"}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", PublicPathPrefix: "/gateway", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", publicPathPrefix: "/gateway"}, false},
+		{Config{WSPath: "/", PublicPathPrefix: "/gateway/"}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", PublicPathPrefix: "/gateway/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", publicPathPrefix: "/gateway"}, false},
+		{Config{WSPath: "/", PublicPathPrefix: "/"}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", PublicPathPrefix: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST"}, false},
+		// Negative cache TTL
+		{Config{WSPath: "/"}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", negativeCacheTTL: DefaultNegativeCacheTTL}, false},
+		{Config{WSPath: "/", NegativeCacheTTL: 1500}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", negativeCacheTTL: 1500 * time.Millisecond}, false},
+		// Resource idle TTL
+		{Config{WSPath: "/"}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", resourceIdleTTL: UnsubscribeDelay}, false},
+		{Config{WSPath: "/", ResourceIdleTTL: 30000}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", resourceIdleTTL: 30 * time.Second}, false},
+		{Config{WSPath: "/", AccessCacheTTL: 5000}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", accessCacheTTL: 5 * time.Second}, false},
+		{Config{WSPath: "/", AccessRevalidateInterval: 60000}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", accessRevalidateInterval: time.Minute}, false},
+		{Config{WSPath: "/", HTTPReadTimeout: 1000, HTTPWriteTimeout: 2000, HTTPIdleTimeout: 3000, TCPKeepAlivePeriod: 4000}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", httpReadTimeout: time.Second, httpWriteTimeout: 2 * time.Second, httpIdleTimeout: 3 * time.Second, tcpKeepAlivePeriod: 4 * time.Second}, false},
+		{Config{WSPath: "/", AccessBatchWindow: 10}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", accessBatchWindow: 10 * time.Millisecond}, false},
+		{Config{WSPath: "/", ReadYourWrites: true}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", readYourWritesWindow: DefaultReadYourWritesWindow}, false},
+		{Config{WSPath: "/", ReadYourWrites: true, ReadYourWritesWindow: 500}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", readYourWritesWindow: 500 * time.Millisecond}, false},
+		// Client timeout max
+		{Config{WSPath: "/"}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", clientTimeoutMax: DefaultClientTimeoutMax}, false},
+		{Config{WSPath: "/", ClientTimeoutMax: 2500}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", clientTimeoutMax: 2500 * time.Millisecond}, false},
+		// Type mismatch action
+		{Config{WSPath: "/", TypeMismatchAction: "delete"}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", typeMismatchAction: rescache.TypeMismatchDelete}, false},
+		{Config{WSPath: "/", TypeMismatchAction: "unsubscribe"}, Config{Addr: nil, Port: 80, WSPath: "/", APIPath: "/", scheme: "http", netAddr: "0.0.0.0:80", allowOrigin: []string{"*"}, allowMethods: "GET, HEAD, OPTIONS, POST", typeMismatchAction: rescache.TypeMismatchUnsubscribe}, false},
 		// Invalid config
 		{Config{Addr: &invalidAddr, WSPath: "/"}, Config{}, true},
 		{Config{HeaderAuth: &invalidHeaderAuth, WSPath: "/"}, Config{}, true},
+		{Config{TokenRefresh: &invalidHeaderAuth, WSPath: "/"}, Config{}, true},
+		{Config{HeaderAuthHeaders: []string{"Authorization"}, WSPath: "/"}, Config{}, true},
+		{Config{HeaderAuth: &headerAuth, HeaderAuthHeaders: []string{""}, WSPath: "/"}, Config{}, true},
+		{Config{HeaderAuth: &headerAuth, HeaderAuthHeaders: []string{"X Api Key"}, WSPath: "/"}, Config{}, true},
+		{Config{HeaderAuth: &headerAuth, HeaderAuthHeaders: []string{"Authorization:"}, WSPath: "/"}, Config{}, true},
+		{Config{HeaderAuth: &headerAuth, HeaderAuthChain: []HeaderAuthMethod{{Header: "Authorization", Method: "auth.jwt"}}, WSPath: "/"}, Config{}, true},
+		{Config{HeaderAuthChain: []HeaderAuthMethod{{Header: "", Method: "auth.jwt"}}, WSPath: "/"}, Config{}, true},
+		{Config{AuthQueryParams: []string{"code", ""}, WSPath: "/"}, Config{}, true},
+		{Config{ConnectionCountThresholds: []int{10, 0}, WSPath: "/"}, Config{}, true},
+		{Config{ConnectionCountThresholds: []int{-1}, WSPath: "/"}, Config{}, true},
+		{Config{HeaderAuthChain: []HeaderAuthMethod{{Header: "X Api Key", Method: "auth.jwt"}}, WSPath: "/"}, Config{}, true},
+		{Config{HeaderAuthChain: []HeaderAuthMethod{{Header: "Authorization", Method: "auth"}}, WSPath: "/"}, Config{}, true},
+		{Config{HeaderAuthChain: []HeaderAuthMethod{{Header: "Authorization", Method: "auth..jwt"}}, WSPath: "/"}, Config{}, true},
 		{Config{AllowOrigin: &allowOriginInvalidEmpty, WSPath: "/"}, Config{}, true},
 		{Config{AllowOrigin: &allowOriginInvalidEmptyOrigin, WSPath: "/"}, Config{}, true},
 		{Config{AllowOrigin: &allowOriginInvalidMultipleAll, WSPath: "/"}, Config{}, true},
@@ -76,6 +138,72 @@ func TestConfigPrepare(t *testing.T) {
 		{Config{PUTMethod: &invalidMethod, WSPath: "/"}, Config{}, true},
 		{Config{DELETEMethod: &invalidMethod, WSPath: "/"}, Config{}, true},
 		{Config{PATCHMethod: &invalidMethod, WSPath: "/"}, Config{}, true},
+		{Config{SessionTTL: -1, WSPath: "/"}, Config{}, true},
+		{Config{HTTPRequestTimeout: -1, WSPath: "/"}, Config{}, true},
+		{Config{HTTPReadTimeout: -1, WSPath: "/"}, Config{}, true},
+		{Config{HTTPWriteTimeout: -1, WSPath: "/"}, Config{}, true},
+		{Config{HTTPIdleTimeout: -1, WSPath: "/"}, Config{}, true},
+		{Config{TCPKeepAlivePeriod: -1, WSPath: "/"}, Config{}, true},
+		{Config{IdempotencyTTL: -1, WSPath: "/"}, Config{}, true},
+		{Config{ClientTimeoutMax: -1, WSPath: "/"}, Config{}, true},
+		{Config{IdempotencyMaxKeys: -1, WSPath: "/"}, Config{}, true},
+		{Config{NegativeCacheTTL: -2, WSPath: "/"}, Config{}, true},
+		{Config{ResourceIdleTTL: -1, WSPath: "/"}, Config{}, true},
+		{Config{AccessCacheTTL: -1, WSPath: "/"}, Config{}, true},
+		{Config{AccessRevalidateInterval: -1, WSPath: "/"}, Config{}, true},
+		{Config{AccessBatchWindow: -1, WSPath: "/"}, Config{}, true},
+		{Config{ReadYourWrites: true, ReadYourWritesWindow: -1, WSPath: "/"}, Config{}, true},
+		{Config{ReadYourWritesWindow: 500, WSPath: "/"}, Config{}, true},
+		{Config{TypeMismatchAction: "error", WSPath: "/"}, Config{}, true},
+		{Config{MethodNotFoundAliases: []string{""}, WSPath: "/"}, Config{}, true},
+		{Config{MethodNotFoundStatus: 500, WSPath: "/"}, Config{}, true},
+		{Config{PrimeMaxSize: -1, WSPath: "/"}, Config{}, true},
+		{Config{PrimeRateLimit: -1, WSPath: "/"}, Config{}, true},
+		{Config{FormFileMaxSize: -1, WSPath: "/"}, Config{}, true},
+		{Config{FileResultMaxSize: -1, WSPath: "/"}, Config{}, true},
+		{Config{CacheInspectMaxSize: -1, WSPath: "/"}, Config{}, true},
+		{Config{MaxEventQueueSize: -1, WSPath: "/"}, Config{}, true},
+		{Config{ReconnectWindow: -1, WSPath: "/"}, Config{}, true},
+		{Config{ReconnectBufferSize: -1, WSPath: "/"}, Config{}, true},
+		{Config{TokenCookie: &invalidTokenCookie, WSPath: "/"}, Config{}, true},
+		{Config{TokenCookie: &emptyTokenCookie, WSPath: "/"}, Config{}, true},
+		{Config{TokenCookie: &tokenCookie, TokenCookieDomain: "exa mple.com", WSPath: "/"}, Config{}, true},
+		{Config{TokenCookie: &tokenCookie, TokenCookieSameSite: "default", WSPath: "/"}, Config{}, true},
+		{Config{TokenCookie: &tokenCookie, TokenCookieMaxAge: -1, WSPath: "/"}, Config{}, true},
+		{Config{TokenCookieMaxAge: 3600, WSPath: "/"}, Config{}, true},
+		{Config{TraceIDHeader: "X Trace", WSPath: "/"}, Config{}, true},
+		{Config{InstanceID: "gw.1", WSPath: "/"}, Config{}, true},
+		{Config{InstanceID: "gw*", WSPath: "/"}, Config{}, true},
+		{Config{PublicPathPrefix: "gateway", WSPath: "/"}, Config{}, true},
+		{Config{PublicPathPrefix: "/gate way", WSPath: "/"}, Config{}, true},
+		{Config{PublicPathPrefix: "//gateway", WSPath: "/"}, Config{}, true},
+		{Config{PublicPathPrefix: "/gateway?x=1", WSPath: "/"}, Config{}, true},
+		{Config{EventRateLimit: -1, WSPath: "/"}, Config{}, true},
+		{Config{EventRateLimitOverrides: map[string]int{"test..model": 10}, WSPath: "/"}, Config{}, true},
+		{Config{EventRateLimitOverrides: map[string]int{"test.>": -1}, WSPath: "/"}, Config{}, true},
+		{Config{CacheMaxAge: map[string]int{"test..model": 60}, WSPath: "/"}, Config{}, true},
+		{Config{CacheMaxAge: map[string]int{"test.>": -1}, WSPath: "/"}, Config{}, true},
+		{Config{MaxModelFields: -1, WSPath: "/"}, Config{}, true},
+		{Config{MaxCollectionSize: -1, WSPath: "/"}, Config{}, true},
+		{Config{RequestLimit: -1, WSPath: "/"}, Config{}, true},
+		{Config{RequestQueueSize: -1, WSPath: "/"}, Config{}, true},
+		{Config{RequestQueueTimeout: -1, WSPath: "/"}, Config{}, true},
+		{Config{RequestRetryAttempts: -1, WSPath: "/"}, Config{}, true},
+		{Config{RequestRetryBackoff: -1, WSPath: "/"}, Config{}, true},
+		{Config{RequestRetryDeadline: -1, WSPath: "/"}, Config{}, true},
+		{Config{JWTAuth: &JWTAuth{}, WSPath: "/"}, Config{}, true},
+		{Config{JWTAuth: &JWTAuth{JWKSURL: "https://example.com/jwks.json", PublicKeyFile: "key.pem"}, WSPath: "/"}, Config{}, true},
+		{Config{JWTAuth: &JWTAuth{JWKSURL: "example.com/jwks.json"}, WSPath: "/"}, Config{}, true},
+		{Config{JWTAuth: &JWTAuth{JWKSURL: "https://example.com/jwks.json", ClockSkew: -1}, WSPath: "/"}, Config{}, true},
+		{Config{JWTAuth: &JWTAuth{JWKSURL: "https://example.com/jwks.json", JWKSRefreshInterval: -1}, WSPath: "/"}, Config{}, true},
+		{Config{BackgroundRefresh: map[string]int{"test..model": 1000}, WSPath: "/"}, Config{}, true},
+		{Config{BackgroundRefresh: map[string]int{"test.>": -1}, WSPath: "/"}, Config{}, true},
+		{Config{UnsharedResources: []string{"test..model"}, WSPath: "/"}, Config{}, true},
+		{Config{UnsharedResources: []string{""}, WSPath: "/"}, Config{}, true},
+		{Config{AccessPolicies: map[string]string{"test..model": "publicGet"}, WSPath: "/"}, Config{}, true},
+		{Config{AccessPolicies: map[string]string{"test.>": "allowAll"}, WSPath: "/"}, Config{}, true},
+		{Config{AllowedResources: []string{"test..model"}, WSPath: "/"}, Config{}, true},
+		{Config{DeniedResources: []string{"test.>.model"}, WSPath: "/"}, Config{}, true},
 	}
 
 	for i, r := range tbl {
@@ -93,6 +221,7 @@ func TestConfigPrepare(t *testing.T) {
 		compareString(t, "WSPath", cfg.WSPath, r.Expected.WSPath, i)
 		compareString(t, "APIPath", cfg.APIPath, r.Expected.APIPath, i)
 		compareString(t, "APIEncoding", cfg.APIEncoding, r.Expected.APIEncoding, i)
+		compareString(t, "publicPathPrefix", cfg.publicPathPrefix, r.Expected.publicPathPrefix, i)
 		compareStringPtr(t, "Addr", cfg.Addr, r.Expected.Addr, i)
 		compareStringPtr(t, "PUTMethod", cfg.PUTMethod, r.Expected.PUTMethod, i)
 		compareStringPtr(t, "DELETEMethod", cfg.DELETEMethod, r.Expected.DELETEMethod, i)
@@ -106,8 +235,115 @@ func TestConfigPrepare(t *testing.T) {
 		compareString(t, "netAddr", cfg.netAddr, r.Expected.netAddr, i)
 		compareString(t, "headerAuthAction", cfg.headerAuthAction, r.Expected.headerAuthAction, i)
 		compareString(t, "headerAuthRID", cfg.headerAuthRID, r.Expected.headerAuthRID, i)
+		compareString(t, "tokenRefreshRID", cfg.tokenRefreshRID, r.Expected.tokenRefreshRID, i)
+		compareString(t, "tokenRefreshAction", cfg.tokenRefreshAction, r.Expected.tokenRefreshAction, i)
+		compareStringPtr(t, "TokenCookie", cfg.TokenCookie, r.Expected.TokenCookie, i)
+		compareString(t, "traceIDHeader", cfg.traceIDHeader, r.Expected.traceIDHeader, i)
+		if cfg.tokenCookieSameSite != r.Expected.tokenCookieSameSite {
+			t.Fatalf("expected tokenCookieSameSite to be:\n%d\nbut got:\n%d\nin test %d", r.Expected.tokenCookieSameSite, cfg.tokenCookieSameSite, i+1)
+		}
 		compareString(t, "allowMethods", cfg.allowMethods, r.Expected.allowMethods, i)
 
+		if r.Expected.methodNotFoundStatus != 0 && cfg.methodNotFoundStatus != r.Expected.methodNotFoundStatus {
+			t.Fatalf("expected methodNotFoundStatus to be:\n%d\nbut got:\n%d\nin test %d", r.Expected.methodNotFoundStatus, cfg.methodNotFoundStatus, i+1)
+		}
+		if r.Expected.primeMaxSize != 0 && cfg.primeMaxSize != r.Expected.primeMaxSize {
+			t.Fatalf("expected primeMaxSize to be:\n%d\nbut got:\n%d\nin test %d", r.Expected.primeMaxSize, cfg.primeMaxSize, i+1)
+		}
+		if r.Expected.primeRateLimit != 0 && cfg.primeRateLimit != r.Expected.primeRateLimit {
+			t.Fatalf("expected primeRateLimit to be:\n%d\nbut got:\n%d\nin test %d", r.Expected.primeRateLimit, cfg.primeRateLimit, i+1)
+		}
+		if r.Expected.negativeCacheTTL != 0 && cfg.negativeCacheTTL != r.Expected.negativeCacheTTL {
+			t.Fatalf("expected negativeCacheTTL to be:\n%s\nbut got:\n%s\nin test %d", r.Expected.negativeCacheTTL, cfg.negativeCacheTTL, i+1)
+		}
+		if r.Expected.resourceIdleTTL != 0 && cfg.resourceIdleTTL != r.Expected.resourceIdleTTL {
+			t.Fatalf("expected resourceIdleTTL to be:\n%s\nbut got:\n%s\nin test %d", r.Expected.resourceIdleTTL, cfg.resourceIdleTTL, i+1)
+		}
+		if r.Expected.accessCacheTTL != 0 && cfg.accessCacheTTL != r.Expected.accessCacheTTL {
+			t.Fatalf("expected accessCacheTTL to be:\n%s\nbut got:\n%s\nin test %d", r.Expected.accessCacheTTL, cfg.accessCacheTTL, i+1)
+		}
+		if cfg.httpReadTimeout != r.Expected.httpReadTimeout {
+			t.Fatalf("expected httpReadTimeout to be:\n%s\nbut got:\n%s\nin test %d", r.Expected.httpReadTimeout, cfg.httpReadTimeout, i+1)
+		}
+		if cfg.httpWriteTimeout != r.Expected.httpWriteTimeout {
+			t.Fatalf("expected httpWriteTimeout to be:\n%s\nbut got:\n%s\nin test %d", r.Expected.httpWriteTimeout, cfg.httpWriteTimeout, i+1)
+		}
+		if cfg.httpIdleTimeout != r.Expected.httpIdleTimeout {
+			t.Fatalf("expected httpIdleTimeout to be:\n%s\nbut got:\n%s\nin test %d", r.Expected.httpIdleTimeout, cfg.httpIdleTimeout, i+1)
+		}
+		if cfg.tcpKeepAlivePeriod != r.Expected.tcpKeepAlivePeriod {
+			t.Fatalf("expected tcpKeepAlivePeriod to be:\n%s\nbut got:\n%s\nin test %d", r.Expected.tcpKeepAlivePeriod, cfg.tcpKeepAlivePeriod, i+1)
+		}
+		if cfg.accessBatchWindow != r.Expected.accessBatchWindow {
+			t.Fatalf("expected accessBatchWindow to be:\n%s\nbut got:\n%s\nin test %d", r.Expected.accessBatchWindow, cfg.accessBatchWindow, i+1)
+		}
+		if cfg.accessRevalidateInterval != r.Expected.accessRevalidateInterval {
+			t.Fatalf("expected accessRevalidateInterval to be:\n%s\nbut got:\n%s\nin test %d", r.Expected.accessRevalidateInterval, cfg.accessRevalidateInterval, i+1)
+		}
+		if cfg.readYourWritesWindow != r.Expected.readYourWritesWindow {
+			t.Fatalf("expected readYourWritesWindow to be:\n%s\nbut got:\n%s\nin test %d", r.Expected.readYourWritesWindow, cfg.readYourWritesWindow, i+1)
+		}
+		if r.Expected.clientTimeoutMax != 0 && cfg.clientTimeoutMax != r.Expected.clientTimeoutMax {
+			t.Fatalf("expected clientTimeoutMax to be:\n%s\nbut got:\n%s\nin test %d", r.Expected.clientTimeoutMax, cfg.clientTimeoutMax, i+1)
+		}
+		if cfg.typeMismatchAction != r.Expected.typeMismatchAction {
+			t.Fatalf("expected typeMismatchAction to be:\n%d\nbut got:\n%d\nin test %d", r.Expected.typeMismatchAction, cfg.typeMismatchAction, i+1)
+		}
+		if r.Expected.formFileMaxSize != 0 && cfg.formFileMaxSize != r.Expected.formFileMaxSize {
+			t.Fatalf("expected formFileMaxSize to be:\n%d\nbut got:\n%d\nin test %d", r.Expected.formFileMaxSize, cfg.formFileMaxSize, i+1)
+		}
+		if r.Expected.fileResultMaxSize != 0 && cfg.fileResultMaxSize != r.Expected.fileResultMaxSize {
+			t.Fatalf("expected fileResultMaxSize to be:\n%d\nbut got:\n%d\nin test %d", r.Expected.fileResultMaxSize, cfg.fileResultMaxSize, i+1)
+		}
+		if r.Expected.cacheInspectMaxSize != 0 && cfg.cacheInspectMaxSize != r.Expected.cacheInspectMaxSize {
+			t.Fatalf("expected cacheInspectMaxSize to be:\n%d\nbut got:\n%d\nin test %d", r.Expected.cacheInspectMaxSize, cfg.cacheInspectMaxSize, i+1)
+		}
+		if r.Expected.maxEventQueueSize != 0 && cfg.maxEventQueueSize != r.Expected.maxEventQueueSize {
+			t.Fatalf("expected maxEventQueueSize to be:\n%d\nbut got:\n%d\nin test %d", r.Expected.maxEventQueueSize, cfg.maxEventQueueSize, i+1)
+		}
+		if r.Expected.reconnectBufferSize != 0 && cfg.reconnectBufferSize != r.Expected.reconnectBufferSize {
+			t.Fatalf("expected reconnectBufferSize to be:\n%d\nbut got:\n%d\nin test %d", r.Expected.reconnectBufferSize, cfg.reconnectBufferSize, i+1)
+		}
+		if cfg.reconnectWindow != r.Expected.reconnectWindow {
+			t.Fatalf("expected reconnectWindow to be:\n%s\nbut got:\n%s\nin test %d", r.Expected.reconnectWindow, cfg.reconnectWindow, i+1)
+		}
+		if r.Expected.instanceID != "" && cfg.instanceID != r.Expected.instanceID {
+			t.Fatalf("expected instanceID to be:\n%s\nbut got:\n%s\nin test %d", r.Expected.instanceID, cfg.instanceID, i+1)
+		}
+		if cfg.instanceID == "" {
+			t.Fatalf("expected instanceID to be set, but it was empty in test %d", i+1)
+		}
+		if r.Expected.idempotencyMaxKeys != 0 && cfg.idempotencyMaxKeys != r.Expected.idempotencyMaxKeys {
+			t.Fatalf("expected idempotencyMaxKeys to be:\n%d\nbut got:\n%d\nin test %d", r.Expected.idempotencyMaxKeys, cfg.idempotencyMaxKeys, i+1)
+		}
+		if len(cfg.headerAuthHeaders) != len(r.Expected.headerAuthHeaders) {
+			t.Fatalf("expected headerAuthHeaders to be:\n%+v\nbut got:\n%+v\nin test %d", r.Expected.headerAuthHeaders, cfg.headerAuthHeaders, i+1)
+		}
+		for j, h := range cfg.headerAuthHeaders {
+			compareString(t, "headerAuthHeaders", h, r.Expected.headerAuthHeaders[j], i)
+		}
+		if len(cfg.headerAuthChain) != len(r.Expected.headerAuthChain) {
+			t.Fatalf("expected headerAuthChain to be:\n%+v\nbut got:\n%+v\nin test %d", r.Expected.headerAuthChain, cfg.headerAuthChain, i+1)
+		}
+		for j, step := range cfg.headerAuthChain {
+			if step != r.Expected.headerAuthChain[j] {
+				t.Fatalf("expected headerAuthChain to be:\n%+v\nbut got:\n%+v\nin test %d", r.Expected.headerAuthChain, cfg.headerAuthChain, i+1)
+			}
+		}
+		if len(cfg.connectionCountThresholds) != len(r.Expected.connectionCountThresholds) {
+			t.Fatalf("expected connectionCountThresholds to be:\n%+v\nbut got:\n%+v\nin test %d", r.Expected.connectionCountThresholds, cfg.connectionCountThresholds, i+1)
+		}
+		for j, n := range cfg.connectionCountThresholds {
+			if n != r.Expected.connectionCountThresholds[j] {
+				t.Fatalf("expected connectionCountThresholds to be:\n%+v\nbut got:\n%+v\nin test %d", r.Expected.connectionCountThresholds, cfg.connectionCountThresholds, i+1)
+			}
+		}
+		for code := range r.Expected.methodNotFoundCodes {
+			if !cfg.methodNotFoundCodes[code] {
+				t.Fatalf("expected methodNotFoundCodes to contain %#v, but got:\n%+v\nin test %d", code, cfg.methodNotFoundCodes, i+1)
+			}
+		}
+
 		if len(cfg.allowOrigin) != len(r.Expected.allowOrigin) {
 			t.Fatalf("expected allowOrigin to be:\n%+v\nbut got:\n%+v\nin test %d", r.Expected.allowOrigin, cfg.allowOrigin, i+1)
 		}
@@ -118,6 +354,7 @@ func TestConfigPrepare(t *testing.T) {
 		}
 
 		compareStringPtr(t, "HeaderAuth", cfg.HeaderAuth, r.Expected.HeaderAuth, i)
+		compareStringPtr(t, "TokenRefresh", cfg.TokenRefresh, r.Expected.TokenRefresh, i)
 	}
 }
 
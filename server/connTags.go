@@ -0,0 +1,47 @@
+package server
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/resgateio/resgate/metrics"
+)
+
+// formatTags returns the tags formatted for the log prefix of a connection,
+// sorted by key, with each tag preceded by a space. Values containing spaces
+// or special characters are quoted. Empty string is returned if there are no
+// tags.
+func formatTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		v := tags[k]
+		if v == "" || strings.ContainsAny(v, " \t\"=[]") {
+			v = strconv.Quote(v)
+		}
+		b.WriteString(" " + k + "=" + v)
+	}
+	return b.String()
+}
+
+// addTaggedConn increases the tagged connections metric for each tag.
+func addTaggedConn(tags map[string]string) {
+	for k, v := range tags {
+		metrics.WSTaggedConnections.WithLabelValues(k, v).Inc()
+	}
+}
+
+// removeTaggedConn decreases the tagged connections metric for each tag.
+func removeTaggedConn(tags map[string]string) {
+	for k, v := range tags {
+		metrics.WSTaggedConnections.WithLabelValues(k, v).Dec()
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/resgateio/resgate/server/mq"
+)
+
+// ConnectionCountSubject is the subject of the messages published when the
+// number of WebSocket connections crosses any of the thresholds set by the
+// connectionCountThresholds setting.
+const ConnectionCountSubject = "system.resgate.connectionCount"
+
+// connectionCountEvent is the payload of a message published on
+// ConnectionCountSubject.
+type connectionCountEvent struct {
+	Count     int    `json:"count"`
+	Direction string `json:"direction"`
+}
+
+// startConnectionCount starts a goroutine publishing a message whenever the
+// number of WebSocket connections crosses a threshold. Nothing is started if
+// no thresholds are set, or if the messaging client is not a mq.Publisher.
+func (s *Service) startConnectionCount() {
+	if len(s.cfg.connectionCountThresholds) == 0 {
+		return
+	}
+	p, ok := s.mq.(mq.Publisher)
+	if !ok {
+		s.Errorf("Connection count messages not supported by messaging client")
+		return
+	}
+	s.wsCountCh = make(chan struct{}, 1)
+	s.wsCountStop = make(chan struct{})
+	go s.watchConnectionCount(p, s.wsCountCh, s.wsCountStop)
+}
+
+// stopConnectionCount stops the goroutine started by startConnectionCount.
+func (s *Service) stopConnectionCount() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.wsCountStop != nil {
+		close(s.wsCountStop)
+		s.wsCountCh = nil
+		s.wsCountStop = nil
+	}
+}
+
+// addWSConnCount adds delta to the number of WebSocket connections, and
+// signals the connection count goroutine, if started, to check the
+// thresholds.
+func (s *Service) addWSConnCount(delta int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.wsCount += delta
+	if s.wsCountCh != nil {
+		select {
+		case s.wsCountCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// watchConnectionCount checks the number of WebSocket connections each time
+// it is signaled on ch, and publishes a message if the number of thresholds
+// reached has changed since the last check.
+func (s *Service) watchConnectionCount(p mq.Publisher, ch chan struct{}, stop chan struct{}) {
+	thresholds := s.cfg.connectionCountThresholds
+	level := 0
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ch:
+		}
+
+		s.mu.Lock()
+		count := s.wsCount
+		s.mu.Unlock()
+
+		l := sort.Search(len(thresholds), func(i int) bool { return thresholds[i] > count })
+		if l == level {
+			continue
+		}
+		dir := "up"
+		if l < level {
+			dir = "down"
+		}
+		level = l
+
+		s.Debugf("Connection count %d crossed threshold (%s)", count, dir)
+		payload, _ := json.Marshal(connectionCountEvent{Count: count, Direction: dir})
+		if err := p.Publish(ConnectionCountSubject, payload); err != nil {
+			s.Errorf("Error publishing connection count: %s", err)
+		}
+	}
+}
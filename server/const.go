@@ -30,18 +30,78 @@ const (
 	// MQTimeout is the wait time for the messaging client to close on shutdown.
 	MQTimeout = 3 * time.Second
 
+	// MaxCloseReasonLength is the maximum length in bytes of the reason sent in a WebSocket close message.
+	MaxCloseReasonLength = 123
+
 	// WSConnWorkerQueueSize is the size of the queue for each connection worker.
 	WSConnWorkerQueueSize = 256
 
 	// CIDPlaceholder is the placeholder tag for the connection ID.
 	CIDPlaceholder = "{cid}"
 
+	// FieldsQueryParam is the reserved HTTP GET query parameter used to select model fields.
+	FieldsQueryParam = "_fields"
+
+	// FormatQueryParam is the HTTP GET query parameter used to request CSV or JSON Lines encoding of collections, or an API encoding.
+	FormatQueryParam = "format"
+
+	// RequestIDHeader is the HTTP header used to pass the request ID of HTTP API requests.
+	RequestIDHeader = "X-Request-Id"
+
+	// IdempotencyKeyHeader is the HTTP header used to pass the idempotency key of HTTP API call requests.
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// IdempotentReplayedHeader is the HTTP header set on responses replayed from a previous request with the same idempotency key.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	// MaxIdempotencyKeyLength is the maximum length of an idempotency key passed in the IdempotencyKeyHeader.
+	MaxIdempotencyKeyLength = 255
+
+	// ForwardedPrefixHeader is the HTTP header used by proxies to pass the path prefix stripped from HTTP API requests.
+	ForwardedPrefixHeader = "X-Forwarded-Prefix"
+
+	// MaxRequestIDLength is the maximum length of a request ID passed in the RequestIDHeader.
+	MaxRequestIDLength = 128
+
 	// SubscriptionCountLimit is the subscription limit of a single connection.
 	SubscriptionCountLimit = 256
 
 	// CacheWorkers is the number of goroutines handling cached resources.
 	CacheWorkers = 10
 
-	// UnsubscribeDelay is the delay for the cache to unsubscribe and evict resources no longer used.
+	// UnsubscribeDelay is the default delay for the cache to unsubscribe and evict resources no longer used.
 	UnsubscribeDelay = 5 * time.Second
+
+	// DefaultPrimeMaxSize is the default maximum payload size in bytes of a system prime event.
+	DefaultPrimeMaxSize = 64 * 1024
+
+	// DefaultPrimeRateLimit is the default maximum number of system prime events per second and service name.
+	DefaultPrimeRateLimit = 100
+
+	// DefaultIdempotencyMaxKeys is the default maximum number of idempotency keys stored at any time.
+	DefaultIdempotencyMaxKeys = 10000
+
+	// DefaultClientTimeoutMax is the default maximum timeout of subscribe and get requests set by clients.
+	DefaultClientTimeoutMax = 60 * time.Second
+
+	// DefaultNegativeCacheTTL is the default duration a not found get response is cached.
+	DefaultNegativeCacheTTL = 5 * time.Second
+
+	// DefaultFormFileMaxSize is the default maximum size in bytes of a file in a multipart form HTTP call request.
+	DefaultFormFileMaxSize = 1024 * 1024
+
+	// DefaultFileResultMaxSize is the default maximum size in bytes of the data of a file result to an HTTP call request.
+	DefaultFileResultMaxSize = 8 * 1024 * 1024
+
+	// DefaultCacheInspectMaxSize is the default maximum size in bytes of the resource values in a cache inspection response.
+	DefaultCacheInspectMaxSize = 64 * 1024
+
+	// DefaultMaxEventQueueSize is the default maximum number of events queued by a subscription waiting for referenced resources to load.
+	DefaultMaxEventQueueSize = 1000
+
+	// DefaultReadYourWritesWindow is the default duration after a call request during which a subscription to the called resource makes a new get request.
+	DefaultReadYourWritesWindow = time.Second
+
+	// DefaultReconnectBufferSize is the default maximum number of events buffered for a disconnected client awaiting reconnect.
+	DefaultReconnectBufferSize = 1000
 )
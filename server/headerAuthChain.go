@@ -0,0 +1,88 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/resgateio/resgate/server/codec"
+)
+
+// HeaderAuthMethod is a header authentication method of the headerAuthChain
+// setting, called for HTTP requests carrying the header.
+type HeaderAuthMethod struct {
+	Header string `json:"header"`
+	Method string `json:"method"`
+}
+
+// headerAuthStep is a prepared header authentication method.
+type headerAuthStep struct {
+	header string // Canonical header name
+	method string
+	rid    string
+	action string
+}
+
+// prepareHeaderAuthChain validates the headerAuthChain setting.
+func (c *Config) prepareHeaderAuthChain() error {
+	c.headerAuthChain = nil
+	if len(c.HeaderAuthChain) == 0 {
+		return nil
+	}
+	if c.HeaderAuth != nil {
+		return errors.New("invalid headerAuthChain setting\n\tcannot be combined with headerAuth")
+	}
+	for _, m := range c.HeaderAuthChain {
+		if !isValidHeaderName(m.Header) {
+			return fmt.Errorf("invalid headerAuthChain setting (%#v)\n\tmust be a valid header name", m.Header)
+		}
+		idx := strings.LastIndexByte(m.Method, '.')
+		if !codec.IsValidRID(m.Method, false) || idx < 0 {
+			return fmt.Errorf("invalid headerAuthChain setting (%#v)\n\tmust be a valid resource method", m.Method)
+		}
+		c.headerAuthChain = append(c.headerAuthChain, headerAuthStep{
+			header: http.CanonicalHeaderKey(m.Header),
+			method: m.Method,
+			rid:    m.Method[:idx],
+			action: m.Method[idx+1:],
+		})
+	}
+	return nil
+}
+
+// headerAuthSteps returns the header authentication methods of the
+// headerAuthChain setting for the headers carried by the HTTP request, in
+// order.
+func (s *Service) headerAuthSteps(r *http.Request) []headerAuthStep {
+	var steps []headerAuthStep
+	for _, step := range s.cfg.headerAuthChain {
+		if _, ok := r.Header[step.header]; ok {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+// headerAuthChain calls the header authentication methods in order, until one
+// results in the connection having a token, before calling cb. A failing
+// method does not prevent the next one from being tried.
+func (s *Service) headerAuthChain(c *wsConn, w http.ResponseWriter, steps []headerAuthStep, cb func()) {
+	if len(steps) == 0 {
+		cb()
+		return
+	}
+	step := steps[0]
+	c.AuthHTTPResource(step.rid, step.action, nil, func(meta *codec.Meta, err error) {
+		s.applyMeta(w, meta)
+		s.setTokenCookie(w, meta)
+		if err != nil {
+			c.Debugf("Header auth %s using %s header failed: %s", step.method, step.header, err)
+		} else if c.hasToken() {
+			c.Debugf("Header authenticated by %s using %s header", step.method, step.header)
+			cb()
+			return
+		}
+		s.headerAuthChain(c, w, steps[1:], cb)
+	})
+}
@@ -2,12 +2,16 @@ package server
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"strings"
 	"time"
 )
 
 func (s *Service) initHTTPServer() {
+	if s.cfg.IdempotencyTTL > 0 {
+		s.idem = newIdempotencyStore(time.Duration(s.cfg.IdempotencyTTL)*time.Millisecond, s.cfg.idempotencyMaxKeys)
+	}
 }
 
 // startHTTPServer initializes the server and starts a goroutine with a http server
@@ -18,15 +22,17 @@ func (s *Service) startHTTPServer() {
 	}
 
 	s.Logf("Listening on %s://%s", s.cfg.scheme, s.cfg.netAddr)
-	h := &http.Server{Addr: s.cfg.netAddr, Handler: s}
+	h := s.newHTTPServer()
 	s.h = h
 
 	go func() {
-		var err error
-		if s.cfg.TLS {
-			err = h.ListenAndServeTLS(s.cfg.TLSCert, s.cfg.TLSKey)
-		} else {
-			err = h.ListenAndServe()
+		ln, err := s.newListenConfig().Listen(context.Background(), "tcp", h.Addr)
+		if err == nil {
+			if s.cfg.TLS {
+				err = h.ServeTLS(ln, s.cfg.TLSCert, s.cfg.TLSKey)
+			} else {
+				err = h.Serve(ln)
+			}
 		}
 
 		if err != nil {
@@ -35,6 +41,23 @@ func (s *Service) startHTTPServer() {
 	}()
 }
 
+// newHTTPServer returns a http server with the configured timeouts.
+func (s *Service) newHTTPServer() *http.Server {
+	return &http.Server{
+		Addr:         s.cfg.netAddr,
+		Handler:      s,
+		ReadTimeout:  s.cfg.httpReadTimeout,
+		WriteTimeout: s.cfg.httpWriteTimeout,
+		IdleTimeout:  s.cfg.httpIdleTimeout,
+	}
+}
+
+// newListenConfig returns the listen config used for the http server, with
+// the configured TCP keep-alive period.
+func (s *Service) newListenConfig() *net.ListenConfig {
+	return &net.ListenConfig{KeepAlive: s.cfg.tcpKeepAlivePeriod}
+}
+
 // stopHTTPServer stops the http server
 func (s *Service) stopHTTPServer() {
 	s.mu.Lock()
@@ -51,6 +74,9 @@ func (s *Service) stopHTTPServer() {
 
 	s.h.Shutdown(ctx)
 	s.h = nil
+	if s.idem != nil {
+		s.idem.clear()
+	}
 
 	if ctx.Err() == context.DeadlineExceeded {
 		s.Errorf("HTTP server forcefully stopped after timeout")
@@ -71,6 +97,10 @@ func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch {
 	case r.URL.Path == s.cfg.WSPath:
 		s.wsHandler(w, r)
+	case s.isAdminPath(r.URL.Path):
+		s.adminHandler(w, r)
+	case s.isAPIInfoPath(r.URL.Path):
+		s.apiInfoHandler(w, r)
 	case strings.HasPrefix(r.URL.Path, s.cfg.APIPath):
 		s.apiHandler(w, r)
 	default:
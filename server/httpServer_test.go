@@ -0,0 +1,51 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewHTTPServer_WithTimeouts_SetsServerTimeouts(t *testing.T) {
+	cfg := Config{
+		HTTPReadTimeout:    1000,
+		HTTPWriteTimeout:   2000,
+		HTTPIdleTimeout:    3000,
+		TCPKeepAlivePeriod: 4000,
+	}
+	cfg.SetDefault()
+	if err := cfg.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{cfg: cfg}
+
+	h := s.newHTTPServer()
+	if h.ReadTimeout != time.Second {
+		t.Errorf("expected ReadTimeout to be %s, but got %s", time.Second, h.ReadTimeout)
+	}
+	if h.WriteTimeout != 2*time.Second {
+		t.Errorf("expected WriteTimeout to be %s, but got %s", 2*time.Second, h.WriteTimeout)
+	}
+	if h.IdleTimeout != 3*time.Second {
+		t.Errorf("expected IdleTimeout to be %s, but got %s", 3*time.Second, h.IdleTimeout)
+	}
+	if lc := s.newListenConfig(); lc.KeepAlive != 4*time.Second {
+		t.Errorf("expected KeepAlive to be %s, but got %s", 4*time.Second, lc.KeepAlive)
+	}
+}
+
+func TestNewHTTPServer_WithoutTimeouts_UsesDefaults(t *testing.T) {
+	cfg := Config{}
+	cfg.SetDefault()
+	if err := cfg.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{cfg: cfg}
+
+	h := s.newHTTPServer()
+	if h.ReadTimeout != 0 || h.WriteTimeout != 0 || h.IdleTimeout != 0 {
+		t.Errorf("expected no timeouts, but got ReadTimeout %s, WriteTimeout %s, IdleTimeout %s", h.ReadTimeout, h.WriteTimeout, h.IdleTimeout)
+	}
+	if lc := s.newListenConfig(); lc.KeepAlive != 0 {
+		t.Errorf("expected KeepAlive to be 0, but got %s", lc.KeepAlive)
+	}
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jirenius/timerqueue"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// idempotencyStore holds responses to HTTP API call requests by idempotency
+// scope. Completed responses are kept until the TTL has passed, while
+// responses still in progress are shared with any duplicate request.
+type idempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	queue   *timerqueue.Queue
+	maxKeys int
+}
+
+// idempotencyEntry is a response to an HTTP API call request, which is
+// available once done is closed.
+type idempotencyEntry struct {
+	done chan struct{}
+	resp *storedResponse
+}
+
+// storedResponse is a recorded HTTP response.
+type storedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func newIdempotencyStore(ttl time.Duration, maxKeys int) *idempotencyStore {
+	st := &idempotencyStore{
+		entries: make(map[string]*idempotencyEntry),
+		maxKeys: maxKeys,
+	}
+	st.queue = timerqueue.New(st.expire, ttl)
+	return st
+}
+
+// acquire returns the entry for the scope. If no entry exists, a new one is
+// created, and owner is true, meaning the caller must complete it. If the
+// store is full, a nil entry is returned.
+func (st *idempotencyStore) acquire(scope string) (e *idempotencyEntry, owner bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if e, ok := st.entries[scope]; ok {
+		return e, false
+	}
+	if len(st.entries) >= st.maxKeys {
+		return nil, false
+	}
+	e = &idempotencyEntry{done: make(chan struct{})}
+	st.entries[scope] = e
+	return e, true
+}
+
+// complete sets the response of an acquired entry, and releases any duplicate
+// request waiting for it. If keep is true, the response is stored until the
+// TTL has passed. Otherwise it is removed from the store.
+func (st *idempotencyStore) complete(scope string, e *idempotencyEntry, resp *storedResponse, keep bool) {
+	st.mu.Lock()
+	e.resp = resp
+	close(e.done)
+	if keep {
+		st.queue.Add(scope)
+	} else {
+		delete(st.entries, scope)
+	}
+	st.mu.Unlock()
+}
+
+// expire is called by the timer queue when a stored response has passed its
+// TTL.
+func (st *idempotencyStore) expire(v interface{}) {
+	st.mu.Lock()
+	delete(st.entries, v.(string))
+	st.mu.Unlock()
+}
+
+// clear removes all stored responses and stops any pending timers. Entries in
+// progress are left to be completed.
+func (st *idempotencyStore) clear() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, v := range st.queue.Clear() {
+		delete(st.entries, v.(string))
+	}
+}
+
+// idempotencyScope returns the key used to store the response of a call
+// request with an idempotency key. The scope includes resource ID, method, and
+// access token to prevent replays across resources or users.
+func idempotencyScope(rid string, action string, token json.RawMessage, key string) string {
+	h := sha256.New()
+	for _, s := range []string{rid, action, string(token), key} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// idempotentCall calls call unless there is a stored or in-progress response
+// for the same scope, in which case that response is written instead. The
+// response of call is stored, unless it is a server error or timeout.
+func (s *Service) idempotentCall(c *wsConn, w http.ResponseWriter, scope string, cb func([]byte, error, bool), call func(http.ResponseWriter, func([]byte, error, bool))) {
+	e, owner := s.idem.acquire(scope)
+	if e == nil {
+		s.Debugf("Idempotency key limit reached: handling request without idempotency")
+		call(w, cb)
+		return
+	}
+
+	if owner {
+		rec := newResponseRecorder(w)
+		call(rec, func(out []byte, err error, headerWritten bool) {
+			writeResponse(rec, out, err, headerWritten, s.enc)
+			keep := rec.status < http.StatusInternalServerError && (err == nil || reserr.RESError(err).Code != reserr.CodeTimeout)
+			s.idem.complete(scope, e, rec.response(), keep)
+			cb(nil, nil, true)
+		})
+		return
+	}
+
+	go func() {
+		<-e.done
+		c.Enqueue(func() {
+			e.resp.write(w)
+			cb(nil, nil, true)
+		})
+	}()
+}
+
+// responseRecorder is a http.ResponseWriter that records the status, the
+// headers set after it was created, and the body written.
+type responseRecorder struct {
+	http.ResponseWriter
+	initial http.Header
+	status  int
+	body    bytes.Buffer
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{
+		ResponseWriter: w,
+		initial:        w.Header().Clone(),
+	}
+}
+
+// WriteHeader records and writes the status code.
+func (rec *responseRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Write records and writes the data.
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// response returns the recorded response. Only headers that differ from when
+// the recorder was created are included.
+func (rec *responseRecorder) response() *storedResponse {
+	h := make(http.Header)
+	for k, v := range rec.Header() {
+		if !equalStrings(rec.initial[k], v) {
+			h[k] = append([]string(nil), v...)
+		}
+	}
+	return &storedResponse{
+		status: rec.status,
+		header: h,
+		body:   rec.body.Bytes(),
+	}
+}
+
+// write writes the stored response, marked as replayed.
+func (resp *storedResponse) write(w http.ResponseWriter) {
+	h := w.Header()
+	for k, v := range resp.header {
+		h[k] = append([]string(nil), v...)
+	}
+	h.Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(resp.status)
+	if len(resp.body) > 0 {
+		w.Write(resp.body)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, s := range a {
+		if s != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,406 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwksMinRefreshInterval is the minimum time between two fetches of a JWKS
+// triggered by a token signed with an unknown key ID.
+const jwksMinRefreshInterval = 10 * time.Second
+
+// jwtAlgorithm is a JWT signature algorithm.
+type jwtAlgorithm struct {
+	hash crypto.Hash
+	pss  bool // RSASSA-PSS instead of RSASSA-PKCS1-v1_5, for RSA keys
+	ec   bool // ECDSA
+}
+
+// jwtAlgorithms are the supported asymmetric signature algorithms. HMAC and
+// none are not supported, as the key is public.
+var jwtAlgorithms = map[string]jwtAlgorithm{
+	"RS256": {hash: crypto.SHA256},
+	"RS384": {hash: crypto.SHA384},
+	"RS512": {hash: crypto.SHA512},
+	"PS256": {hash: crypto.SHA256, pss: true},
+	"PS384": {hash: crypto.SHA384, pss: true},
+	"PS512": {hash: crypto.SHA512, pss: true},
+	"ES256": {hash: crypto.SHA256, ec: true},
+	"ES384": {hash: crypto.SHA384, ec: true},
+	"ES512": {hash: crypto.SHA512, ec: true},
+}
+
+// jwtKeySource returns the public key for verifying a JWT signed with the key
+// ID.
+type jwtKeySource interface {
+	key(kid string) (crypto.PublicKey, error)
+}
+
+// jwtVerifier validates JWTs, returning their claims.
+type jwtVerifier struct {
+	keys     jwtKeySource
+	issuer   string
+	audience string
+	skew     time.Duration
+	now      func() time.Time
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Iss string          `json:"iss"`
+	Aud json.RawMessage `json:"aud"`
+	Exp *float64        `json:"exp"`
+	Nbf *float64        `json:"nbf"`
+}
+
+// verify validates the signature, issuer, audience, expiry, and not before
+// time of the token, and returns the claims.
+func (v *jwtVerifier) verify(token string) (json.RawMessage, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var h jwtHeader
+	if err := decodeJWTPart(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("invalid header: %s", err)
+	}
+	alg, ok := jwtAlgorithms[h.Alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm %#v", h.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %s", err)
+	}
+	key, err := v.keys.key(h.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := alg.verify(key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload: %s", err)
+	}
+	var c jwtClaims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, fmt.Errorf("invalid claims: %s", err)
+	}
+	now := v.now()
+	if c.Exp != nil && !now.Before(jwtTime(*c.Exp).Add(v.skew)) {
+		return nil, errors.New("token expired")
+	}
+	if c.Nbf != nil && now.Add(v.skew).Before(jwtTime(*c.Nbf)) {
+		return nil, errors.New("token not yet valid")
+	}
+	if v.issuer != "" && c.Iss != v.issuer {
+		return nil, fmt.Errorf("invalid issuer %#v", c.Iss)
+	}
+	if v.audience != "" && !hasAudience(c.Aud, v.audience) {
+		return nil, errors.New("invalid audience")
+	}
+	return json.RawMessage(payload), nil
+}
+
+// verify verifies the signature of the signed string with the key.
+func (alg jwtAlgorithm) verify(key crypto.PublicKey, signed string, sig []byte) error {
+	hasher := alg.hash.New()
+	hasher.Write([]byte(signed))
+	digest := hasher.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg.ec {
+			return errors.New("key type does not match algorithm")
+		}
+		var err error
+		if alg.pss {
+			err = rsa.VerifyPSS(k, alg.hash, digest, sig, nil)
+		} else {
+			err = rsa.VerifyPKCS1v15(k, alg.hash, digest, sig)
+		}
+		if err != nil {
+			return errors.New("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if !alg.ec {
+			return errors.New("key type does not match algorithm")
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("invalid signature")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return errors.New("unsupported key type")
+	}
+	return nil
+}
+
+// decodeJWTPart decodes a base64 URL encoded JSON part of a JWT.
+func decodeJWTPart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// jwtTime returns the time of a JWT NumericDate.
+func jwtTime(t float64) time.Time {
+	return time.Unix(0, int64(t*float64(time.Second)))
+}
+
+// hasAudience returns true if the aud claim, either a string or an array of
+// strings, contains the audience.
+func hasAudience(aud json.RawMessage, audience string) bool {
+	if len(aud) == 0 {
+		return false
+	}
+	var s string
+	if json.Unmarshal(aud, &s) == nil {
+		return s == audience
+	}
+	var arr []string
+	if json.Unmarshal(aud, &arr) == nil {
+		for _, a := range arr {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// staticJWTKey is a single public key used for all key IDs.
+type staticJWTKey struct {
+	pub crypto.PublicKey
+}
+
+func (k staticJWTKey) key(string) (crypto.PublicKey, error) {
+	return k.pub, nil
+}
+
+// loadPublicKeyFile loads a PEM encoded RSA or ECDSA public key, or the
+// public key of a certificate.
+func loadPublicKeyFile(path string) (crypto.PublicKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	var pub interface{}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pub = cert.PublicKey
+	case "RSA PUBLIC KEY":
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return pub, nil
+	}
+	return nil, errors.New("unsupported key type")
+}
+
+// jwks is a JSON Web Key Set fetched from a URL. The set is fetched again
+// when older than the refresh interval, or when a token is signed with an
+// unknown key ID, to handle key rotation.
+type jwks struct {
+	url      string
+	client   *http.Client
+	interval time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	keys     map[string]crypto.PublicKey
+	fetched  time.Time
+	fetching *jwksFetch // Fetch in progress, or nil
+}
+
+// jwksFetch is a fetch of the key set in progress, shared by all callers
+// needing it. The done channel is closed once completed.
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+type jwksResponse struct {
+	Keys []jwk `json:"keys"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (ks *jwks) key(kid string) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := ks.now()
+	k, ok := ks.keys[kid]
+	f := ks.fetching
+	if f == nil {
+		stale := ks.keys == nil || now.Sub(ks.fetched) >= ks.interval
+		if stale || (!ok && now.Sub(ks.fetched) >= jwksMinRefreshInterval) {
+			f = ks.startFetch(now)
+		}
+	} else if ok {
+		// Use the known key instead of waiting for the fetch in progress
+		return k, nil
+	}
+
+	if f != nil {
+		// The lock is not held while fetching, to not block other callers
+		ks.mu.Unlock()
+		<-f.done
+		ks.mu.Lock()
+		// Keep using the keys previously fetched on error
+		if f.err != nil && ks.keys == nil {
+			return nil, f.err
+		}
+		k, ok = ks.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %#v", kid)
+	}
+	return k, nil
+}
+
+// startFetch starts fetching the key set in a separate goroutine, and
+// returns the fetch in progress.
+// Mutex is held when called.
+func (ks *jwks) startFetch(now time.Time) *jwksFetch {
+	f := &jwksFetch{done: make(chan struct{})}
+	ks.fetching = f
+	ks.fetched = now
+	go func() {
+		keys, err := ks.fetch()
+		ks.mu.Lock()
+		if err == nil {
+			ks.keys = keys
+		}
+		f.err = err
+		ks.fetching = nil
+		ks.mu.Unlock()
+		close(f.done)
+	}()
+	return f
+}
+
+// fetch fetches and returns the keys of the key set.
+func (ks *jwks) fetch() (map[string]crypto.PublicKey, error) {
+	resp, err := ks.client.Get(ks.url)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching JWKS: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching JWKS: status %d", resp.StatusCode)
+	}
+	var r jwksResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("error decoding JWKS: %s", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(r.Keys))
+	for _, k := range r.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if pub, err := k.publicKey(); err == nil {
+			keys[k.Kid] = pub
+		}
+	}
+	return keys, nil
+}
+
+// publicKey returns the RSA or EC public key of the JWK.
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %#v", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("point not on curve")
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %#v", k.Kty)
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultJWKSRefreshInterval is the default time in milliseconds before a
+	// JWKS is fetched again.
+	DefaultJWKSRefreshInterval = 300000
+	// jwksFetchTimeout is the timeout for fetching a JWKS.
+	jwksFetchTimeout = 5 * time.Second
+)
+
+// JWTAuth is the jwtAuth setting, letting resgate validate JWTs and set their
+// claims as connection token, without any auth request.
+type JWTAuth struct {
+	JWKSURL             string `json:"jwksUrl"`
+	PublicKeyFile       string `json:"publicKeyFile"`
+	Issuer              string `json:"issuer"`
+	Audience            string `json:"audience"`
+	QueryParam          string `json:"queryParam"`
+	ClockSkew           int    `json:"clockSkew"`
+	JWKSRefreshInterval int    `json:"jwksRefreshInterval"`
+}
+
+// prepareJWTAuth validates the jwtAuth setting.
+func (c *Config) prepareJWTAuth() error {
+	a := c.JWTAuth
+	if a == nil {
+		return nil
+	}
+	if (a.JWKSURL == "") == (a.PublicKeyFile == "") {
+		return errors.New("invalid jwtAuth setting\n\tmust have either jwksUrl or publicKeyFile set")
+	}
+	if a.JWKSURL != "" {
+		u, err := url.Parse(a.JWKSURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid jwtAuth jwksUrl setting (%s)\n\tmust be an http or https URL", a.JWKSURL)
+		}
+	}
+	if a.ClockSkew < 0 {
+		return fmt.Errorf("invalid jwtAuth clockSkew setting (%d)\n\tmust be zero or a positive number of milliseconds", a.ClockSkew)
+	}
+	if a.JWKSRefreshInterval < 0 {
+		return fmt.Errorf("invalid jwtAuth jwksRefreshInterval setting (%d)\n\tmust be zero or a positive number of milliseconds", a.JWKSRefreshInterval)
+	}
+	return nil
+}
+
+// initJWTAuth creates the JWT verifier, loading any public key file.
+func (s *Service) initJWTAuth() error {
+	a := s.cfg.JWTAuth
+	if a == nil {
+		return nil
+	}
+	var keys jwtKeySource
+	if a.PublicKeyFile != "" {
+		pub, err := loadPublicKeyFile(a.PublicKeyFile)
+		if err != nil {
+			return fmt.Errorf("invalid jwtAuth publicKeyFile setting (%s)\n\t%s", a.PublicKeyFile, err)
+		}
+		keys = staticJWTKey{pub: pub}
+	} else {
+		interval := a.JWKSRefreshInterval
+		if interval == 0 {
+			interval = DefaultJWKSRefreshInterval
+		}
+		keys = &jwks{
+			url:      a.JWKSURL,
+			client:   &http.Client{Timeout: jwksFetchTimeout},
+			interval: time.Duration(interval) * time.Millisecond,
+			now:      time.Now,
+		}
+	}
+	s.jwt = &jwtVerifier{
+		keys:     keys,
+		issuer:   a.Issuer,
+		audience: a.Audience,
+		skew:     time.Duration(a.ClockSkew) * time.Millisecond,
+		now:      time.Now,
+	}
+	return nil
+}
+
+// jwtToken returns the claims of a valid JWT carried by the request, as a
+// bearer token in the Authorization header, or in the query parameter of the
+// jwtAuth setting, to be used as connection token. Nil is returned if JWT
+// validation is not enabled, or if the request has no valid JWT.
+func (s *Service) jwtToken(r *http.Request) json.RawMessage {
+	if s.jwt == nil || r == nil {
+		return nil
+	}
+	token := bearerToken(r)
+	if token == "" && s.cfg.JWTAuth.QueryParam != "" {
+		token = r.URL.Query().Get(s.cfg.JWTAuth.QueryParam)
+	}
+	if token == "" {
+		return nil
+	}
+	claims, err := s.jwt.verify(token)
+	if err != nil {
+		s.Debugf("Invalid JWT from %s: %s", r.RemoteAddr, err)
+		return nil
+	}
+	return claims
+}
+
+// bearerToken returns the bearer token of the Authorization header, or empty
+// string if there is none.
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(h[7:])
+}
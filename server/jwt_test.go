@@ -0,0 +1,367 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/logger"
+)
+
+var testJWTNow = time.Unix(1700000000, 0)
+
+// signTestJWT returns a JWT with the header and claims, signed with the key.
+func signTestJWT(t *testing.T, key crypto.Signer, alg, kid string, claims string) string {
+	h := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		h["kid"] = kid
+	}
+	hb, _ := json.Marshal(h)
+	signed := base64.RawURLEncoding.EncodeToString(hb) + "." + base64.RawURLEncoding.EncodeToString([]byte(claims))
+	a := jwtAlgorithms[alg]
+	hasher := a.hash.New()
+	hasher.Write([]byte(signed))
+	digest := hasher.Sum(nil)
+
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if a.pss {
+			sig, err = rsa.SignPSS(rand.Reader, k, a.hash, digest, nil)
+		} else {
+			sig, err = rsa.SignPKCS1v15(rand.Reader, k, a.hash, digest)
+		}
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest)
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		s.FillBytes(sig[size:])
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func newTestRSAKey(t *testing.T) *rsa.PrivateKey {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func newTestECKey(t *testing.T) *ecdsa.PrivateKey {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func newTestJWTVerifier(pub crypto.PublicKey) *jwtVerifier {
+	return &jwtVerifier{
+		keys:     staticJWTKey{pub: pub},
+		issuer:   "https://issuer.example.com",
+		audience: "resgate",
+		skew:     5 * time.Second,
+		now:      func() time.Time { return testJWTNow },
+	}
+}
+
+func TestJWTVerifier_ValidToken_ReturnsClaims(t *testing.T) {
+	rsaKey := newTestRSAKey(t)
+	ecKey := newTestECKey(t)
+	claims := `{"iss":"https://issuer.example.com","aud":["other","resgate"],"sub":"user1","exp":1700000060,"nbf":1699999990}`
+	tbl := []struct {
+		Alg string
+		Key crypto.Signer
+	}{
+		{"RS256", rsaKey},
+		{"RS512", rsaKey},
+		{"PS256", rsaKey},
+		{"ES256", ecKey},
+	}
+
+	for _, l := range tbl {
+		v := newTestJWTVerifier(l.Key.Public())
+		got, err := v.verify(signTestJWT(t, l.Key, l.Alg, "", claims))
+		if err != nil {
+			t.Fatalf("expected no error for %s, but got: %s", l.Alg, err)
+		}
+		if string(got) != claims {
+			t.Errorf("expected claims for %s to be:\n%s\nbut got:\n%s", l.Alg, claims, got)
+		}
+	}
+}
+
+func TestJWTVerifier_InvalidToken_ReturnsError(t *testing.T) {
+	key := newTestRSAKey(t)
+	otherKey := newTestRSAKey(t)
+	tbl := []struct {
+		Name  string
+		Token string
+	}{
+		{"malformed", "not.a-token"},
+		{"expired", signTestJWT(t, key, "RS256", "", `{"iss":"https://issuer.example.com","aud":"resgate","exp":1699999990}`)},
+		{"not yet valid", signTestJWT(t, key, "RS256", "", `{"iss":"https://issuer.example.com","aud":"resgate","nbf":1700000010}`)},
+		{"wrong issuer", signTestJWT(t, key, "RS256", "", `{"iss":"https://other.example.com","aud":"resgate"}`)},
+		{"wrong audience", signTestJWT(t, key, "RS256", "", `{"iss":"https://issuer.example.com","aud":"other"}`)},
+		{"missing audience", signTestJWT(t, key, "RS256", "", `{"iss":"https://issuer.example.com"}`)},
+		{"wrong key", signTestJWT(t, otherKey, "RS256", "", `{"iss":"https://issuer.example.com","aud":"resgate"}`)},
+		{"algorithm none", "eyJhbGciOiJub25lIn0.eyJhdWQiOiJyZXNnYXRlIn0."},
+		{"key type mismatch", signTestJWT(t, newTestECKey(t), "ES256", "", `{"iss":"https://issuer.example.com","aud":"resgate"}`)},
+	}
+
+	v := newTestJWTVerifier(key.Public())
+	for _, l := range tbl {
+		if _, err := v.verify(l.Token); err == nil {
+			t.Errorf("expected an error for %s token, but got none", l.Name)
+		}
+	}
+}
+
+func TestJWTVerifier_WithinClockSkew_ReturnsClaims(t *testing.T) {
+	key := newTestRSAKey(t)
+	v := newTestJWTVerifier(key.Public())
+	for _, claims := range []string{
+		`{"iss":"https://issuer.example.com","aud":"resgate","exp":1699999996}`,
+		`{"iss":"https://issuer.example.com","aud":"resgate","nbf":1700000004}`,
+	} {
+		if _, err := v.verify(signTestJWT(t, key, "RS256", "", claims)); err != nil {
+			t.Errorf("expected no error for claims %s, but got: %s", claims, err)
+		}
+	}
+}
+
+// testJWKSServer serves a JWKS with the keys currently set. If block is set,
+// responses wait until it is closed.
+type testJWKSServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetches int
+	block   chan struct{}
+}
+
+func newTestJWKSServer() *testJWKSServer {
+	ts := &testJWKSServer{}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ts.mu.Lock()
+		block := ts.block
+		ts.mu.Unlock()
+		if block != nil {
+			<-block
+		}
+		ts.mu.Lock()
+		defer ts.mu.Unlock()
+		ts.fetches++
+		var keys []jwk
+		for kid, k := range ts.keys {
+			keys = append(keys, jwk{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(jwksResponse{Keys: keys})
+	}))
+	return ts
+}
+
+func (ts *testJWKSServer) setKeys(keys map[string]*rsa.PublicKey) {
+	ts.mu.Lock()
+	ts.keys = keys
+	ts.mu.Unlock()
+}
+
+func TestJWKS_RotatedKey_FetchesKeySet(t *testing.T) {
+	key1 := newTestRSAKey(t)
+	key2 := newTestRSAKey(t)
+	ts := newTestJWKSServer()
+	defer ts.Close()
+	ts.setKeys(map[string]*rsa.PublicKey{"key1": &key1.PublicKey})
+
+	now := testJWTNow
+	ks := &jwks{url: ts.URL, client: ts.Client(), interval: time.Hour, now: func() time.Time { return now }}
+	v := &jwtVerifier{keys: ks, now: func() time.Time { return now }}
+	claims := `{"sub":"user1"}`
+
+	if _, err := v.verify(signTestJWT(t, key1, "RS256", "key1", claims)); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+
+	// Rotate keys
+	ts.setKeys(map[string]*rsa.PublicKey{"key2": &key2.PublicKey})
+	now = now.Add(jwksMinRefreshInterval)
+	if _, err := v.verify(signTestJWT(t, key2, "RS256", "key2", claims)); err != nil {
+		t.Fatalf("expected no error after rotation, but got: %s", err)
+	}
+	if _, err := v.verify(signTestJWT(t, key1, "RS256", "key1", claims)); err == nil {
+		t.Errorf("expected an error for a token signed with a removed key, but got none")
+	}
+	if ts.fetches != 2 {
+		t.Errorf("expected 2 fetches of the key set, but got %d", ts.fetches)
+	}
+}
+
+func TestJWKS_RefreshInterval_FetchesKeySet(t *testing.T) {
+	key := newTestRSAKey(t)
+	ts := newTestJWKSServer()
+	defer ts.Close()
+	ts.setKeys(map[string]*rsa.PublicKey{"key1": &key.PublicKey})
+
+	now := testJWTNow
+	ks := &jwks{url: ts.URL, client: ts.Client(), interval: time.Minute, now: func() time.Time { return now }}
+	for _, d := range []time.Duration{0, 30 * time.Second, 31 * time.Second} {
+		now = now.Add(d)
+		if _, err := ks.key("key1"); err != nil {
+			t.Fatalf("expected no error, but got: %s", err)
+		}
+	}
+	if ts.fetches != 2 {
+		t.Errorf("expected 2 fetches of the key set, but got %d", ts.fetches)
+	}
+}
+
+func TestJWKS_UnknownKeyID_RateLimitsFetches(t *testing.T) {
+	key := newTestRSAKey(t)
+	ts := newTestJWKSServer()
+	defer ts.Close()
+	ts.setKeys(map[string]*rsa.PublicKey{"key1": &key.PublicKey})
+
+	ks := &jwks{url: ts.URL, client: ts.Client(), interval: time.Hour, now: func() time.Time { return testJWTNow }}
+	for i := 0; i < 3; i++ {
+		if _, err := ks.key("unknown"); err == nil {
+			t.Fatalf("expected an error for an unknown key ID, but got none")
+		}
+	}
+	if ts.fetches != 1 {
+		t.Errorf("expected 1 fetch of the key set, but got %d", ts.fetches)
+	}
+}
+
+func TestJWKS_FetchInProgress_DoesNotBlockKnownKeys(t *testing.T) {
+	key := newTestRSAKey(t)
+	ts := newTestJWKSServer()
+	defer ts.Close()
+	ts.setKeys(map[string]*rsa.PublicKey{"key1": &key.PublicKey})
+
+	var mu sync.Mutex
+	now := testJWTNow
+	ks := &jwks{url: ts.URL, client: ts.Client(), interval: time.Hour, now: func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}}
+	if _, err := ks.key("key1"); err != nil {
+		t.Fatalf("expected no error, but got: %s", err)
+	}
+
+	// Block the fetch triggered by unknown key IDs
+	block := make(chan struct{})
+	ts.mu.Lock()
+	ts.block = block
+	ts.mu.Unlock()
+	mu.Lock()
+	now = now.Add(jwksMinRefreshInterval)
+	mu.Unlock()
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := ks.key("unknown")
+			errs <- err
+		}()
+	}
+
+	// Wait for the fetch to start
+	for i := 0; ; i++ {
+		ks.mu.Lock()
+		fetching := ks.fetching != nil
+		ks.mu.Unlock()
+		if fetching {
+			break
+		}
+		if i == 100 {
+			t.Fatal("expected a fetch of the key set to start, but it didn't")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	got := make(chan error, 1)
+	go func() {
+		_, err := ks.key("key1")
+		got <- err
+	}()
+	select {
+	case err := <-got:
+		if err != nil {
+			t.Fatalf("expected no error, but got: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a known key to be returned while fetching, but it blocked")
+	}
+
+	close(block)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err == nil {
+			t.Errorf("expected an error for an unknown key ID, but got none")
+		}
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.fetches != 2 {
+		t.Errorf("expected 2 fetches of the key set, but got %d", ts.fetches)
+	}
+}
+
+func TestJWTToken_TokenSource_ReturnsClaims(t *testing.T) {
+	key := newTestRSAKey(t)
+	claims := `{"iss":"https://issuer.example.com","aud":"resgate","sub":"user1"}`
+	token := signTestJWT(t, key, "RS256", "", claims)
+	tbl := []struct {
+		Name       string
+		QueryParam string
+		URL        string
+		Header     http.Header
+		Expected   string
+	}{
+		{"bearer token", "", "/", http.Header{"Authorization": {"Bearer " + token}}, claims},
+		{"lower case bearer token", "", "/", http.Header{"Authorization": {"bearer " + token}}, claims},
+		{"query parameter", "access_token", "/?access_token=" + token, nil, claims},
+		{"query parameter not set", "", "/?access_token=" + token, nil, ""},
+		{"basic auth", "", "/", http.Header{"Authorization": {"Basic dXNlcjpwYXNz"}}, ""},
+		{"invalid token", "", "/", http.Header{"Authorization": {"Bearer " + token + "x"}}, ""},
+		{"no token", "access_token", "/", nil, ""},
+	}
+
+	for _, l := range tbl {
+		s := &Service{
+			cfg:    Config{JWTAuth: &JWTAuth{QueryParam: l.QueryParam}},
+			logger: logger.NewMemLogger(true, false),
+			jwt:    newTestJWTVerifier(key.Public()),
+		}
+		r := httptest.NewRequest("GET", l.URL, nil)
+		for k, v := range l.Header {
+			r.Header[k] = v
+		}
+		if got := s.jwtToken(r); string(got) != l.Expected {
+			t.Errorf("expected token for %s to be %#v, but got %#v", l.Name, l.Expected, string(got))
+		}
+	}
+}
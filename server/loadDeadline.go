@@ -0,0 +1,83 @@
+package server
+
+import (
+	"time"
+
+	"github.com/resgateio/resgate/server/reserr"
+	"github.com/resgateio/resgate/server/rpc"
+)
+
+// loadDeadline bounds the total time for loading a resource and its
+// references for a subscribe or get request with a timeout.
+//
+// A nil *loadDeadline has no timeout.
+type loadDeadline struct {
+	timer   *time.Timer
+	partial bool
+	ready   bool // Access granted and awaiting the resources to be ready
+	done    bool
+}
+
+// startLoadDeadline starts a timer for the timeout of the load request, capped
+// by the clientTimeoutMax setting, or returns nil if the request has no
+// timeout.
+//
+// On expiry, if the request is partial and awaiting the resources to be
+// ready, any resources still loading for sub are aborted with a timeout error,
+// letting the loaded resources be returned. Otherwise fail is called, and the
+// request should respond with a timeout error and release sub.
+func (c *wsConn) startLoadDeadline(lr *rpc.LoadRequest, sub *Subscription, fail func()) *loadDeadline {
+	if lr == nil || lr.Timeout == 0 {
+		return nil
+	}
+	timeout := time.Duration(lr.Timeout) * time.Millisecond
+	if timeout > c.serv.cfg.clientTimeoutMax {
+		timeout = c.serv.cfg.clientTimeoutMax
+	}
+	d := &loadDeadline{partial: lr.Partial}
+	d.timer = time.AfterFunc(timeout, func() {
+		c.EnqueueTask(taskRequest, func() {
+			if d.done {
+				return
+			}
+			if d.partial && d.ready {
+				sub.abortLoading(reserr.ErrTimeout)
+				// Aborting should have made the resources ready.
+				if d.done {
+					return
+				}
+			}
+			d.done = true
+			fail()
+		}, nil)
+	})
+	return d
+}
+
+// expired returns true if the deadline has expired, and the request has been
+// responded to.
+func (d *loadDeadline) expired() bool {
+	return d != nil && d.done
+}
+
+// awaitReady marks that access is granted, and that the request is awaiting
+// the resources to be ready.
+func (d *loadDeadline) awaitReady() {
+	if d != nil {
+		d.ready = true
+	}
+}
+
+// finish stops the deadline timer. It returns false if the deadline has
+// already expired, in which case the request must not be responded to.
+func (d *loadDeadline) finish() bool {
+	if d == nil {
+		return true
+	}
+	if d.done {
+		return false
+	}
+	d.done = true
+	d.timer.Stop()
+	return true
+}
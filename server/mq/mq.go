@@ -1,6 +1,10 @@
 package mq
 
-import "github.com/resgateio/resgate/server/reserr"
+import (
+	"strings"
+
+	"github.com/resgateio/resgate/server/reserr"
+)
 
 // Response sends a response to the messaging system
 type Response func(subj string, payload []byte, responseHeaders map[string][]string, err error)
@@ -12,16 +16,38 @@ type Unsubscriber interface {
 }
 
 // Client is an interface that represents a client to a messaging system.
+//
+// Subjects are strings of dot separated tokens, such as "get.example.model".
+// A subject used for sending requests, publishing, or subscribing, must be
+// valid as reported by IsValidSubject. Wildcards are only used by Subscribe,
+// which subscribes to the namespace followed by a single token wildcard, as
+// for a NATS subscription on namespace+".*". The namespace "event.example"
+// matches the subject "event.example.change", but not "event.example" or
+// "event.example.model.change".
+//
+// A message published on a subject is delivered to all subscriptions with a
+// matching subject, in the order published. Callbacks for messages and
+// responses are called on a goroutine separate from the caller.
 type Client interface {
 	// Connect establishes a connection to the MQ
 	Connect() error
 
 	// SendRequest sends an asynchronous request on a subject, expecting the Response
 	// callback to be called once on a separate go routine.
+	//
+	// The callback is called with ErrInvalidSubject if the subject is not
+	// valid, ErrNoResponders if there is no subscription for the subject,
+	// and ErrRequestTimeout if no response is received within the client's
+	// request timeout. The requestHeaders, if any, are sent with the request
+	// if supported by the messaging system.
 	SendRequest(subject string, payload []byte, cb Response, requestHeaders map[string][]string)
 
 	// Subscribe to all events on a resource namespace.
 	// The namespace has the format "event."+resource
+	//
+	// The callback is called with the full subject for each message published
+	// on a subject with a single token following the namespace. An
+	// ErrInvalidSubject error is returned if the namespace is not valid.
 	Subscribe(namespace string, cb Response) (Unsubscriber, error)
 
 	// Close closes the connection.
@@ -30,10 +56,44 @@ type Client interface {
 	// IsClosed tests if the connection has been closed.
 	IsClosed() bool
 
-	// Sets the closed handler
+	// Sets the closed handler, called when the connection is lost. It may
+	// also be called after a call to Close.
 	SetClosedHandler(cb func(error))
 }
 
+// RequestHandler handles a request received on a subscribed subject. The
+// reply subject is empty if no response is expected.
+type RequestHandler func(subj string, reply string, payload []byte)
+
+// RequestSubscriber is an optional interface implemented by a Client that can
+// subscribe to requests, to be responded by publishing on the reply subject.
+type RequestSubscriber interface {
+	// SubscribeRequests subscribes to requests, and published messages, on a
+	// subject. No wildcards are used. An ErrInvalidSubject error is returned
+	// if the subject is not valid.
+	SubscribeRequests(subject string, cb RequestHandler) (Unsubscriber, error)
+}
+
+// Publisher is an optional interface implemented by a Client that can
+// publish messages without expecting any response.
+type Publisher interface {
+	// Publish sends a message on a subject, without expecting any response.
+	// Publishing on the reply subject of a request responds to the request.
+	// An ErrInvalidSubject error is returned if the subject is not valid.
+	Publish(subject string, payload []byte) error
+}
+
+// ReconnectNotifier is an optional interface implemented by a Client that
+// reconnects after losing the connection, instead of closing it.
+type ReconnectNotifier interface {
+	// SetReconnectHandler sets the handler called after the connection is
+	// reestablished. Any event published while disconnected may be lost.
+	SetReconnectHandler(cb func())
+	// SetDisconnectHandler sets the handler called when the connection is
+	// lost, and the client starts to reconnect.
+	SetDisconnectHandler(cb func())
+}
+
 // ErrNoResponders is the error the client should pass to the Response
 // when a call to SendRequest has no reponders.
 var ErrNoResponders = reserr.ErrNotFound
@@ -45,3 +105,39 @@ var ErrRequestTimeout = reserr.ErrTimeout
 // ErrSubjectTooLong is the error the client should pass to the Response when
 // the subject exceeds the maximum control line size
 var ErrSubjectTooLong = reserr.ErrSubjectTooLong
+
+// PayloadTooLargeError returns the error the client should pass to the
+// Response when the request payload exceeds the maximum payload size of the
+// server, with the payload size and the maximum size in bytes as error data.
+func PayloadTooLargeError(size int, maxPayload int64) *reserr.Error {
+	return &reserr.Error{
+		Code:    reserr.CodePayloadTooLarge,
+		Message: reserr.ErrPayloadTooLarge.Message,
+		Data: map[string]interface{}{
+			"size":       size,
+			"maxPayload": maxPayload,
+		},
+	}
+}
+
+// ErrInvalidSubject is the error the client should pass to the Response when
+// the subject is not a valid request subject.
+var ErrInvalidSubject = &reserr.Error{Code: reserr.CodeInvalidRequest, Message: "Invalid subject"}
+
+// IsValidSubject returns true if the subject is valid to send requests to or
+// subscribe to. A valid subject has no empty tokens, no wildcard tokens
+// (* or >), and no whitespace.
+func IsValidSubject(subj string) bool {
+	if subj == "" {
+		return false
+	}
+	if strings.ContainsAny(subj, " \t\r\n") {
+		return false
+	}
+	for _, token := range strings.Split(subj, ".") {
+		if token == "" || token == "*" || token == ">" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+package mq_test
+
+import (
+	"testing"
+
+	"github.com/resgateio/resgate/server/mq"
+)
+
+// Test IsValidSubject refuses subjects with wildcard tokens
+func TestIsValidSubject(t *testing.T) {
+	tbl := []struct {
+		Subject  string
+		Expected bool
+	}{
+		{"get.test.model", true},
+		{"call.test.model.method", true},
+		{"get.test.mo*del", true},
+		{"", false},
+		{"get.test.*", false},
+		{"get.*.model", false},
+		{"get.test.>", false},
+		{"get.test..model", false},
+		{"get.test.model.", false},
+		{"get.test model", false},
+		{"get.test\tmodel", false},
+		{"get.test\r\nmodel", false},
+	}
+
+	for i, l := range tbl {
+		if v := mq.IsValidSubject(l.Subject); v != l.Expected {
+			t.Fatalf("expected IsValidSubject(%#v) to be %v, but got %v in test #%d", l.Subject, l.Expected, v, i+1)
+		}
+	}
+}
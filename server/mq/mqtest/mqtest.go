@@ -0,0 +1,319 @@
+// Package mqtest provides a conformance test suite for mq.Client
+// implementations.
+package mqtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server/mq"
+)
+
+const (
+	// Time to wait for an expected callback
+	waitTimeout = 2 * time.Second
+	// Time to wait for an unexpected second callback
+	noCallbackWait = 50 * time.Millisecond
+	// Subject of the ping request responded by the service client
+	pingSubject = "mqtest.ping"
+)
+
+// NewClients returns two clients, not yet connected, to the same messaging
+// system. The client is the one under test, and must have a request timeout
+// shorter than one second. The service client is used to respond to
+// requests and publish events, and must implement mq.RequestSubscriber and
+// mq.Publisher. For an in-process implementation, the same client may be returned as both.
+type NewClients func(t *testing.T) (client mq.Client, service mq.Client)
+
+// session is a connected client and service client.
+type session struct {
+	t       *testing.T
+	client  mq.Client
+	service mq.Client
+	rs      mq.RequestSubscriber
+	pub     mq.Publisher
+}
+
+// message is a message passed to a Response or RequestHandler callback.
+type message struct {
+	subj    string
+	reply   string
+	payload []byte
+	err     error
+}
+
+// RunConformanceTests runs the tests that any mq.Client implementation must
+// pass, as described by the mq.Client interface documentation. The Publish
+// tests are skipped if the client does not implement mq.Publisher.
+func RunConformanceTests(t *testing.T, newClients NewClients) {
+	for _, test := range []struct {
+		name string
+		f    func(s *session)
+	}{
+		{"SendRequest_Response_CallsCallbackOnce", testSendRequestResponse},
+		{"SendRequest_NoResponders_ReturnsErrNoResponders", testSendRequestNoResponders},
+		{"SendRequest_NoResponse_ReturnsErrRequestTimeout", testSendRequestTimeout},
+		{"SendRequest_InvalidSubject_ReturnsErrInvalidSubject", testSendRequestInvalidSubject},
+		{"Subscribe_Namespace_MatchesSingleToken", testSubscribeSingleToken},
+		{"Subscribe_Unsubscribe_StopsDelivery", testSubscribeUnsubscribe},
+		{"Subscribe_InvalidNamespace_ReturnsErrInvalidSubject", testSubscribeInvalidNamespace},
+		{"Publish_RequestSubscriber_ReceivesWithoutReply", testPublishRequestSubscriber},
+		{"Publish_InvalidSubject_ReturnsErrInvalidSubject", testPublishInvalidSubject},
+		{"Close_Connected_IsClosed", testClose},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.f(newSession(t, newClients))
+		})
+	}
+}
+
+func newSession(t *testing.T, newClients NewClients) *session {
+	client, service := newClients(t)
+	rs, ok := service.(mq.RequestSubscriber)
+	if !ok {
+		t.Fatal("service client does not implement mq.RequestSubscriber")
+	}
+	pub, ok := service.(mq.Publisher)
+	if !ok {
+		t.Fatal("service client does not implement mq.Publisher")
+	}
+	if err := service.Connect(); err != nil {
+		t.Fatalf("error connecting service client: %s", err)
+	}
+	t.Cleanup(service.Close)
+	if client != service {
+		if err := client.Connect(); err != nil {
+			t.Fatalf("error connecting client: %s", err)
+		}
+		t.Cleanup(client.Close)
+	}
+
+	s := &session{t: t, client: client, service: service, rs: rs, pub: pub}
+	s.respond(pingSubject, []byte(`{"result":null}`))
+	s.flushService()
+	return s
+}
+
+// respond subscribes to requests on the subject with the service client,
+// responding with payload.
+func (s *session) respond(subj string, payload []byte) chan message {
+	ch := make(chan message, 16)
+	_, err := s.rs.SubscribeRequests(subj, func(subj, reply string, data []byte) {
+		ch <- message{subj: subj, reply: reply, payload: data}
+		if reply != "" && payload != nil {
+			if err := s.pub.Publish(reply, payload); err != nil {
+				s.t.Errorf("error publishing response: %s", err)
+			}
+		}
+	})
+	if err != nil {
+		s.t.Fatalf("error subscribing to requests on %s: %s", subj, err)
+	}
+	return ch
+}
+
+// flushClient waits until subscriptions made by the client are active, by
+// sending a request responded to by the service client.
+func (s *session) flushClient() {
+	s.ping(s.client)
+}
+
+// flushService waits until subscriptions made by the service client are
+// active, by sending a request to itself.
+func (s *session) flushService() {
+	s.ping(s.service)
+}
+
+func (s *session) ping(c mq.Client) {
+	ch := make(chan message, 1)
+	c.SendRequest(pingSubject, nil, responseTo(ch), nil)
+	if m := getMessage(s.t, ch); m.err != nil {
+		s.t.Fatalf("error sending ping request: %s", m.err)
+	}
+}
+
+func (s *session) publish(subj string, payload string) {
+	if err := s.pub.Publish(subj, []byte(payload)); err != nil {
+		s.t.Fatalf("error publishing on %s: %s", subj, err)
+	}
+}
+
+func (s *session) subscribe(namespace string) chan message {
+	ch := make(chan message, 16)
+	if _, err := s.client.Subscribe(namespace, responseTo(ch)); err != nil {
+		s.t.Fatalf("error subscribing to %s: %s", namespace, err)
+	}
+	return ch
+}
+
+func responseTo(ch chan message) mq.Response {
+	return func(subj string, payload []byte, _ map[string][]string, err error) {
+		ch <- message{subj: subj, payload: payload, err: err}
+	}
+}
+
+func getMessage(t *testing.T, ch chan message) message {
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(waitTimeout):
+		t.Fatal("expected a callback, but got none")
+	}
+	return message{}
+}
+
+func assertNoMessage(t *testing.T, ch chan message) {
+	select {
+	case m := <-ch:
+		t.Fatalf("expected no callback, but got one for subject %#v with error %v", m.subj, m.err)
+	case <-time.After(noCallbackWait):
+	}
+}
+
+func testSendRequestResponse(s *session) {
+	reqs := s.respond("get.test.model", []byte(`{"result":{"model":{"foo":"bar"}}}`))
+	s.flushService()
+
+	ch := make(chan message, 2)
+	s.client.SendRequest("get.test.model", []byte(`{"token":null}`), responseTo(ch), nil)
+	m := getMessage(s.t, ch)
+	if m.err != nil {
+		s.t.Fatalf("expected no error, but got: %s", m.err)
+	}
+	if string(m.payload) != `{"result":{"model":{"foo":"bar"}}}` {
+		s.t.Errorf("expected response payload %s, but got %s", `{"result":{"model":{"foo":"bar"}}}`, m.payload)
+	}
+	req := getMessage(s.t, reqs)
+	if req.subj != "get.test.model" || string(req.payload) != `{"token":null}` {
+		s.t.Errorf("expected request on get.test.model with payload %s, but got %#v with payload %s", `{"token":null}`, req.subj, req.payload)
+	}
+	if req.reply == "" {
+		s.t.Error("expected request to have a reply subject, but got none")
+	}
+	assertNoMessage(s.t, ch)
+}
+
+func testSendRequestNoResponders(s *session) {
+	ch := make(chan message, 2)
+	s.client.SendRequest("get.test.model", nil, responseTo(ch), nil)
+	if m := getMessage(s.t, ch); m.err != mq.ErrNoResponders {
+		s.t.Errorf("expected error %v, but got %v", mq.ErrNoResponders, m.err)
+	}
+	assertNoMessage(s.t, ch)
+}
+
+func testSendRequestTimeout(s *session) {
+	s.respond("get.test.model", nil)
+	s.flushService()
+
+	ch := make(chan message, 2)
+	s.client.SendRequest("get.test.model", nil, responseTo(ch), nil)
+	if m := getMessage(s.t, ch); m.err != mq.ErrRequestTimeout {
+		s.t.Errorf("expected error %v, but got %v", mq.ErrRequestTimeout, m.err)
+	}
+	assertNoMessage(s.t, ch)
+}
+
+func testSendRequestInvalidSubject(s *session) {
+	for _, subj := range []string{"", "get.test.*", "get.test.>", "get..model", "get.test model"} {
+		ch := make(chan message, 2)
+		s.client.SendRequest(subj, nil, responseTo(ch), nil)
+		if m := getMessage(s.t, ch); m.err != mq.ErrInvalidSubject {
+			s.t.Errorf("expected error %v for subject %#v, but got %v", mq.ErrInvalidSubject, subj, m.err)
+		}
+	}
+}
+
+func testSubscribeSingleToken(s *session) {
+	ch := s.subscribe("event.test.model")
+	s.flushClient()
+
+	for _, subj := range []string{
+		"event.test.model",
+		"event.test.model.foo.change",
+		"event.test.modelx.change",
+		"event.test.change",
+		"event.test.model.change",
+	} {
+		s.publish(subj, `{"foo":"bar"}`)
+	}
+	m := getMessage(s.t, ch)
+	if m.subj != "event.test.model.change" {
+		s.t.Errorf("expected event on %#v, but got %#v", "event.test.model.change", m.subj)
+	}
+	if string(m.payload) != `{"foo":"bar"}` || m.err != nil {
+		s.t.Errorf("expected payload %s without error, but got %s with error %v", `{"foo":"bar"}`, m.payload, m.err)
+	}
+	assertNoMessage(s.t, ch)
+}
+
+func testSubscribeUnsubscribe(s *session) {
+	ch := make(chan message, 16)
+	sub, err := s.client.Subscribe("event.test.model", responseTo(ch))
+	if err != nil {
+		s.t.Fatalf("error subscribing: %s", err)
+	}
+	marker := s.subscribe("event.test.marker")
+	s.flushClient()
+	if err := sub.Unsubscribe(); err != nil {
+		s.t.Fatalf("error unsubscribing: %s", err)
+	}
+	s.flushClient()
+
+	s.publish("event.test.model.change", `{}`)
+	s.publish("event.test.marker.change", `{}`)
+	getMessage(s.t, marker)
+	assertNoMessage(s.t, ch)
+}
+
+func testSubscribeInvalidNamespace(s *session) {
+	for _, ns := range []string{"", "event.test.*", "event.>", "event..model", "event.test model"} {
+		if _, err := s.client.Subscribe(ns, func(string, []byte, map[string][]string, error) {}); err != mq.ErrInvalidSubject {
+			s.t.Errorf("expected error %v for namespace %#v, but got %v", mq.ErrInvalidSubject, ns, err)
+		}
+	}
+}
+
+// clientPublisher returns the client as a mq.Publisher, or skips the test if
+// the client does not implement it.
+func (s *session) clientPublisher() mq.Publisher {
+	p, ok := s.client.(mq.Publisher)
+	if !ok {
+		s.t.Skip("client does not implement mq.Publisher")
+	}
+	return p
+}
+
+func testPublishRequestSubscriber(s *session) {
+	p := s.clientPublisher()
+	reqs := s.respond("system.test", nil)
+	s.flushService()
+
+	if err := p.Publish("system.test", []byte(`{"foo":"bar"}`)); err != nil {
+		s.t.Fatalf("expected no error, but got: %s", err)
+	}
+	m := getMessage(s.t, reqs)
+	if m.subj != "system.test" || m.reply != "" || string(m.payload) != `{"foo":"bar"}` {
+		s.t.Errorf("expected message on system.test without reply subject, but got %#v with reply %#v and payload %s", m.subj, m.reply, m.payload)
+	}
+}
+
+func testPublishInvalidSubject(s *session) {
+	p := s.clientPublisher()
+	for _, subj := range []string{"", "system.*", "system.>", "system..test"} {
+		if err := p.Publish(subj, nil); err != mq.ErrInvalidSubject {
+			s.t.Errorf("expected error %v for subject %#v, but got %v", mq.ErrInvalidSubject, subj, err)
+		}
+	}
+}
+
+func testClose(s *session) {
+	if s.client.IsClosed() {
+		s.t.Fatal("expected client not to be closed")
+	}
+	s.client.Close()
+	if !s.client.IsClosed() {
+		s.t.Fatal("expected client to be closed")
+	}
+}
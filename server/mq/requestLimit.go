@@ -0,0 +1,132 @@
+package mq
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/resgateio/resgate/metrics"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// ErrRequestLimit is the error passed to the Response by a RequestLimiter
+// when a request could not be sent within the limit of outstanding requests.
+var ErrRequestLimit = &reserr.Error{Code: reserr.CodeServiceUnavailable, Message: "Too many outstanding requests"}
+
+// RequestLimiter is a Client that limits the number of outstanding requests
+// sent with SendRequest. Requests beyond the limit wait in a bounded FIFO
+// queue until a previous request is responded to. Requests that don't fit
+// in the queue, or that time out while queued, are responded with
+// ErrRequestLimit. All other methods are passed on to the underlying Client.
+type RequestLimiter struct {
+	Client
+	limit     int
+	queueSize int
+	timeout   time.Duration
+
+	mu       sync.Mutex
+	inFlight int
+	queue    *list.List
+}
+
+type queuedRequest struct {
+	subject        string
+	payload        []byte
+	cb             Response
+	requestHeaders map[string][]string
+	t              *time.Timer
+	e              *list.Element // Element in queue, or nil if removed
+}
+
+// NewRequestLimiter returns a RequestLimiter allowing at most limit
+// outstanding requests to be sent with c, and at most queueSize requests to
+// wait for up to timeout in queue. If timeout is zero, queued requests wait
+// until sent.
+func NewRequestLimiter(c Client, limit int, queueSize int, timeout time.Duration) *RequestLimiter {
+	if limit <= 0 {
+		panic("mq: request limit must be a positive number")
+	}
+	return &RequestLimiter{
+		Client:    c,
+		limit:     limit,
+		queueSize: queueSize,
+		timeout:   timeout,
+		queue:     list.New(),
+	}
+}
+
+// SendRequest sends the request if the number of outstanding requests is
+// below the limit. Otherwise the request is queued, or responded with
+// ErrRequestLimit if the queue is full.
+func (l *RequestLimiter) SendRequest(subject string, payload []byte, cb Response, requestHeaders map[string][]string) {
+	l.mu.Lock()
+	if l.inFlight < l.limit {
+		l.inFlight++
+		l.setMetrics()
+		l.mu.Unlock()
+		l.send(subject, payload, cb, requestHeaders)
+		return
+	}
+	if l.queue.Len() >= l.queueSize {
+		l.mu.Unlock()
+		go cb("", nil, nil, ErrRequestLimit)
+		return
+	}
+	qr := &queuedRequest{subject: subject, payload: payload, cb: cb, requestHeaders: requestHeaders}
+	qr.e = l.queue.PushBack(qr)
+	if l.timeout > 0 {
+		qr.t = time.AfterFunc(l.timeout, func() { l.onQueueTimeout(qr) })
+	}
+	l.setMetrics()
+	l.mu.Unlock()
+}
+
+// send sends the request, freeing its slot once responded to.
+func (l *RequestLimiter) send(subject string, payload []byte, cb Response, requestHeaders map[string][]string) {
+	l.Client.SendRequest(subject, payload, func(subj string, data []byte, responseHeaders map[string][]string, err error) {
+		l.release()
+		cb(subj, data, responseHeaders, err)
+	}, requestHeaders)
+}
+
+// release frees a slot of an outstanding request, giving it to the first
+// queued request, if any.
+func (l *RequestLimiter) release() {
+	l.mu.Lock()
+	e := l.queue.Front()
+	if e == nil {
+		l.inFlight--
+		l.setMetrics()
+		l.mu.Unlock()
+		return
+	}
+	qr := l.queue.Remove(e).(*queuedRequest)
+	qr.e = nil
+	if qr.t != nil {
+		qr.t.Stop()
+	}
+	l.setMetrics()
+	l.mu.Unlock()
+	l.send(qr.subject, qr.payload, qr.cb, qr.requestHeaders)
+}
+
+func (l *RequestLimiter) onQueueTimeout(qr *queuedRequest) {
+	l.mu.Lock()
+	// Quick exit if the request has already been sent
+	if qr.e == nil {
+		l.mu.Unlock()
+		return
+	}
+	l.queue.Remove(qr.e)
+	qr.e = nil
+	l.setMetrics()
+	l.mu.Unlock()
+	qr.cb("", nil, nil, ErrRequestLimit)
+}
+
+// setMetrics sets the gauges of outstanding and queued requests.
+// Mutex is held when called.
+func (l *RequestLimiter) setMetrics() {
+	metrics.NATSRequestsInFlight.Set(float64(l.inFlight))
+	metrics.NATSRequestsQueued.Set(float64(l.queue.Len()))
+}
@@ -3,11 +3,37 @@ package server
 import (
 	"time"
 
+	"github.com/resgateio/resgate/server/mq"
 	"github.com/resgateio/resgate/server/rescache"
 )
 
 func (s *Service) initMQClient() {
-	s.cache = rescache.NewCache(s.mq, CacheWorkers, s.cfg.ResetThrottle, UnsubscribeDelay, s.logger)
+	// Requests are only sent by the cache, so only its client is limited
+	var c mq.Client = s.mq
+	if s.cfg.RequestLimit > 0 {
+		c = mq.NewRequestLimiter(s.mq, s.cfg.RequestLimit, s.cfg.RequestQueueSize, s.cfg.requestQueueTimeout)
+	}
+	s.cache = rescache.NewCache(c, CacheWorkers, s.cfg.ResetThrottle, s.cfg.resourceIdleTTL, s.logger)
+	s.cache.SetPrimeLimits(s.cfg.primeMaxSize, s.cfg.primeRateLimit)
+	s.cache.SetEventRateLimit(s.cfg.EventRateLimit, s.cfg.EventRateLimitOverrides)
+	s.cache.WithTimestampEvents(s.cfg.TimestampEvents)
+	s.cache.WithSystemEvents(s.cfg.SystemEvents)
+	s.cache.WithRequestRetry(s.cfg.RequestRetryAttempts, s.cfg.requestRetryBackoff, s.cfg.requestRetryDeadline)
+	s.cache.WithMaxModelFields(s.cfg.MaxModelFields)
+	s.cache.WithMaxCollectionSize(s.cfg.MaxCollectionSize)
+	for p, interval := range s.cfg.BackgroundRefresh {
+		s.cache.WithBackgroundRefreshInterval(time.Duration(interval)*time.Millisecond, p)
+	}
+	s.cache.SetNegativeCacheTTL(s.cfg.negativeCacheTTL)
+	s.cache.SetAccessCacheTTL(s.cfg.accessCacheTTL)
+	s.cache.SetAccessBatchWindow(s.cfg.accessBatchWindow)
+	for p, policy := range s.cfg.accessPolicies {
+		s.cache.SetAccessPolicy(p, policy)
+	}
+	s.cache.SetReadYourWrites(s.cfg.readYourWritesWindow)
+	s.cache.SetTypeMismatchAction(s.cfg.typeMismatchAction)
+	s.cache.SetUnsharedResources(s.cfg.UnsharedResources)
+	s.cache.SetTraceContext(s.cfg.TraceContext)
 }
 
 // startMQClients creates a connection to the messaging system.
@@ -21,7 +47,15 @@ func (s *Service) startMQClient() error {
 		return err
 	}
 
+	if err := s.startCacheInspect(); err != nil {
+		return err
+	}
+
 	s.mq.SetClosedHandler(s.handleClosedMQ)
+	if rn, ok := s.mq.(mq.ReconnectNotifier); ok {
+		rn.SetDisconnectHandler(s.handleDisconnectedMQ)
+		rn.SetReconnectHandler(s.handleReconnectedMQ)
+	}
 	return nil
 }
 
@@ -49,3 +83,21 @@ func (s *Service) stopMQClient() {
 func (s *Service) handleClosedMQ(err error) {
 	s.Stop(err)
 }
+
+// handleDisconnectedMQ calls any disconnect callback after the messaging
+// client has lost the connection, and started to reconnect.
+func (s *Service) handleDisconnectedMQ() {
+	if s.onMQDisconnect != nil {
+		s.onMQDisconnect()
+	}
+}
+
+// handleReconnectedMQ resynchronizes the cache after the messaging client has
+// reconnected, as events may have been missed while disconnected.
+func (s *Service) handleReconnectedMQ() {
+	s.Logf("Reconnected to messaging system. Resynchronizing cached resources...")
+	s.cache.Resync()
+	if s.onMQReconnect != nil {
+		s.onMQReconnect()
+	}
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// initReconnect generates the secret used to sign reconnect tokens, if
+// reconnecting is enabled.
+func (s *Service) initReconnect() error {
+	s.suspended = make(map[string]*wsConn)
+	if s.cfg.reconnectWindow == 0 {
+		return nil
+	}
+	s.reconnectSecret = make([]byte, 32)
+	_, err := rand.Read(s.reconnectSecret)
+	return err
+}
+
+// newReconnectToken returns a reconnect token for the connection, in the
+// format "<cid>.<timestamp>.<signature>", where the timestamp is the Unix
+// time in milliseconds when the token was issued, and the signature is a
+// base64 URL encoded HMAC-SHA256 of the connection ID and timestamp.
+func (s *Service) newReconnectToken(cid string) string {
+	payload := cid + "." + strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+	return payload + "." + s.signReconnectPayload(payload)
+}
+
+func (s *Service) signReconnectPayload(payload string) string {
+	mac := hmac.New(sha256.New, s.reconnectSecret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// takeSuspended validates the reconnect token, and returns the suspended
+// connection it was issued to, removing it from the suspended connections.
+// Nil is returned if the token is invalid, if its timestamp is in the future,
+// if the connection has been suspended for longer than the reconnect window,
+// or if no connection can be resumed with the token.
+//
+// The token is the only credential needed to resume a session. The resumed
+// connection keeps the access token and HTTP request of the suspended
+// connection, and access is not checked again, so whoever holds the token may
+// take over the session within the reconnect window.
+func (s *Service) takeSuspended(token string) *wsConn {
+	if token == "" || s.cfg.reconnectWindow == 0 {
+		return nil
+	}
+	idx := strings.LastIndexByte(token, '.')
+	if idx < 0 || !hmac.Equal([]byte(token[idx+1:]), []byte(s.signReconnectPayload(token[:idx]))) {
+		return nil
+	}
+	payload := token[:idx]
+	issued, err := strconv.ParseInt(payload[strings.LastIndexByte(payload, '.')+1:], 10, 64)
+	if err != nil || issued > time.Now().UnixNano()/int64(time.Millisecond) {
+		return nil
+	}
+	cid := token[:strings.IndexByte(token, '.')]
+
+	s.mu.Lock()
+	c, ok := s.suspended[cid]
+	// The suspend timer may not yet have disposed an expired connection.
+	if !ok || c.reconnectToken != token || time.Since(c.suspendedAt) >= s.cfg.reconnectWindow {
+		s.mu.Unlock()
+		return nil
+	}
+	delete(s.suspended, cid)
+	s.mu.Unlock()
+
+	c.mu.Lock()
+	lost := c.eventsLost
+	c.mu.Unlock()
+	if lost {
+		c.Debugf("Reconnect rejected: buffered events exceeded %d", s.cfg.reconnectBufferSize)
+		c.Dispose()
+		return nil
+	}
+	return c
+}
+
+// suspend keeps the disconnected connection, with its subscriptions, for the
+// duration of the reconnect window, buffering any events to be replayed when
+// the client reconnects. The connection is not suspended if reconnecting is
+// disabled, if no reconnect token has been issued, or if the connection was
+// disconnected by the server.
+// Returns true if the connection was suspended.
+func (c *wsConn) suspend() bool {
+	window := c.serv.cfg.reconnectWindow
+	if window == 0 {
+		return false
+	}
+
+	done := make(chan bool, 1)
+	if !c.Enqueue(func() {
+		done <- c.suspendConn(window)
+	}) {
+		return false
+	}
+	return <-done
+}
+
+// suspendConn is called by the worker goroutine to suspend the connection.
+func (c *wsConn) suspendConn(window time.Duration) bool {
+	if c.reconnectToken == "" {
+		return false
+	}
+
+	c.serv.mu.Lock()
+	defer c.serv.mu.Unlock()
+	if c.serv.stopping {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closing {
+		return false
+	}
+	c.ws = nil
+	c.events = make([][]byte, 0, 16)
+	c.eventsLost = false
+	c.serv.suspended[c.cid] = c
+	c.suspendedAt = time.Now()
+	c.suspendTimer = time.AfterFunc(window, c.expireSuspend)
+	c.Tracef("Suspended awaiting reconnect")
+	return true
+}
+
+// expireSuspend disposes the connection if it is still suspended.
+func (c *wsConn) expireSuspend() {
+	c.serv.mu.Lock()
+	if c.serv.suspended[c.cid] != c {
+		c.serv.mu.Unlock()
+		return
+	}
+	delete(c.serv.suspended, c.cid)
+	c.serv.mu.Unlock()
+
+	c.Tracef("Reconnect window expired")
+	c.Dispose()
+}
+
+// stopSuspendTimer stops the suspend timer, if one is running.
+func (c *wsConn) stopSuspendTimer() {
+	if c.suspendTimer != nil {
+		c.suspendTimer.Stop()
+		c.suspendTimer = nil
+	}
+}
+
+// resume sets the WebSocket connection of a suspended connection taken with
+// takeSuspended. Events are kept buffered until the connection's version
+// request is handled.
+func (c *wsConn) resume(ws *websocket.Conn) {
+	c.Enqueue(func() {
+		c.stopSuspendTimer()
+		c.mu.Lock()
+		c.ws = ws
+		c.mu.Unlock()
+		c.resumed = true
+		c.Tracef("Resumed: %s", ws.RemoteAddr())
+	})
+}
+
+// handOver disposes the connection without closing its WebSocket
+// connection, which is handed over to a resumed connection.
+func (c *wsConn) handOver() {
+	done := make(chan struct{})
+	if c.Enqueue(func() {
+		c.mu.Lock()
+		c.ws = nil
+		c.mu.Unlock()
+		c.dispose()
+		close(done)
+	}) {
+		<-done
+	}
+}
+
+// bufferEvent adds the event to the buffered events, if the connection is
+// suspended or awaiting replay. If the reconnect buffer size is exceeded
+// while suspended, the buffered events are dropped, and the connection can
+// no longer be resumed.
+// Returns true if the event was buffered or dropped.
+func (c *wsConn) bufferEvent(data []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.events == nil {
+		return c.eventsLost
+	}
+	if c.ws == nil && len(c.events) >= c.serv.cfg.reconnectBufferSize {
+		c.events = nil
+		c.eventsLost = true
+		return true
+	}
+	c.events = append(c.events, data)
+	return true
+}
+
+// replayEvents sends the events buffered while suspended.
+func (c *wsConn) replayEvents() {
+	c.mu.Lock()
+	evs := c.events
+	c.events = nil
+	c.mu.Unlock()
+	for _, ev := range evs {
+		c.Send(ev)
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newReconnectTestService returns a service with reconnecting enabled, and a
+// connection suspended for the duration.
+func newReconnectTestService(t *testing.T, suspended time.Duration) (*Service, *wsConn) {
+	cfg := Config{ReconnectWindow: 1000}
+	cfg.SetDefault()
+	if err := cfg.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{cfg: cfg}
+	if err := s.initReconnect(); err != nil {
+		t.Fatal(err)
+	}
+	c := &wsConn{serv: s, cid: "testcid", suspendedAt: time.Now().Add(-suspended)}
+	s.suspended[c.cid] = c
+	return s, c
+}
+
+func TestTakeSuspended_ValidToken_ReturnsConn(t *testing.T) {
+	s, c := newReconnectTestService(t, 0)
+	c.reconnectToken = s.newReconnectToken(c.cid)
+	if sc := s.takeSuspended(c.reconnectToken); sc != c {
+		t.Fatalf("expected suspended connection, but got %v", sc)
+	}
+}
+
+func TestTakeSuspended_FutureTimestamp_ReturnsNil(t *testing.T) {
+	s, c := newReconnectTestService(t, 0)
+	payload := c.cid + "." + strconv.FormatInt(time.Now().Add(time.Hour).UnixNano()/int64(time.Millisecond), 10)
+	c.reconnectToken = payload + "." + s.signReconnectPayload(payload)
+	if sc := s.takeSuspended(c.reconnectToken); sc != nil {
+		t.Fatal("expected nil, but got suspended connection")
+	}
+}
+
+func TestTakeSuspended_SuspendedLongerThanWindow_ReturnsNil(t *testing.T) {
+	s, c := newReconnectTestService(t, 2*time.Second)
+	c.reconnectToken = s.newReconnectToken(c.cid)
+	if sc := s.takeSuspended(c.reconnectToken); sc != nil {
+		t.Fatal("expected nil, but got suspended connection")
+	}
+}
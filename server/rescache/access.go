@@ -1,6 +1,8 @@
 package rescache
 
 import (
+	"strings"
+
 	"github.com/resgateio/resgate/server/codec"
 	"github.com/resgateio/resgate/server/reserr"
 )
@@ -25,7 +27,8 @@ func (a *Access) CanGet() error {
 	return reserr.ErrAccessDenied
 }
 
-// CanCall reports whether call access for a given action is granted.
+// CanCall reports whether call access for a given action is granted. If
+// action is "*", it reports whether call access for any action is granted.
 // Returns nil if get access is granted, otherwise an error.
 func (a *Access) CanCall(action string) error {
 	if a.Error != nil {
@@ -40,6 +43,10 @@ func (a *Access) CanCall(action string) error {
 		return reserr.ErrAccessDenied
 	}
 
+	if action == "*" {
+		return nil
+	}
+
 	s := a.Call
 	e := len(s)
 	i := e
@@ -59,3 +66,13 @@ func (a *Access) CanCall(action string) error {
 
 	return reserr.ErrAccessDenied
 }
+
+// CallActions returns the call actions granted, in the order given by the
+// service. A wildcard grant is returned as a single "*" action. An empty slice
+// is returned if no call access is granted.
+func (a *Access) CallActions() []string {
+	if a.Error != nil || a.Call == "" {
+		return []string{}
+	}
+	return strings.Split(a.Call, ",")
+}
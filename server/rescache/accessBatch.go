@@ -0,0 +1,162 @@
+package rescache
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// accessBatchKey identifies access requests that may be sent in the same
+// access batch request.
+type accessBatchKey struct {
+	service string
+	cid     string
+	token   string // Hex encoded sha256 hash of the JSON encoded token
+}
+
+// accessBatch is a set of access requests pending to be sent in a single
+// access batch request.
+type accessBatch struct {
+	key   accessBatchKey
+	token interface{}
+	items []*accessBatchItem
+}
+
+// accessBatchItem is an access request pending in an access batch.
+type accessBatchItem struct {
+	rname          string
+	query          string
+	subj           string
+	payload        []byte
+	requestHeaders map[string][]string
+	eventSub       *EventSubscription
+	cb             func(data []byte, err error)
+}
+
+// SetAccessBatchWindow sets the duration access requests are held to be sent
+// in a single access batch request, for services that have advertised
+// support for access batch requests. Zero or less disables access batching.
+// Should be called before Start.
+func (c *Cache) SetAccessBatchWindow(window time.Duration) {
+	c.accessBatchWindow = window
+	c.accessBatchServices = make(map[string]bool)
+	c.accessBatches = make(map[accessBatchKey]*accessBatch)
+}
+
+// setAccessBatchSupport sets if the service of the resource supports access
+// batch requests.
+func (c *Cache) setAccessBatchSupport(rname string, batch bool) {
+	if c.accessBatchWindow <= 0 {
+		return
+	}
+	service := serviceName(rname)
+	c.accessBatchMu.Lock()
+	defer c.accessBatchMu.Unlock()
+	if batch {
+		c.accessBatchServices[service] = true
+	} else {
+		delete(c.accessBatchServices, service)
+	}
+}
+
+// batchAccess adds the access request to a pending access batch, if the
+// service of the resource supports access batch requests.
+// Returns true if the request was added, otherwise it must be sent
+// separately.
+func (c *Cache) batchAccess(sub Subscriber, token interface{}, subj string, payload []byte, cb func(data []byte, err error), requestHeaders map[string][]string) bool {
+	if c.accessBatchWindow <= 0 {
+		return false
+	}
+	rname := sub.ResourceName()
+	service := serviceName(rname)
+	th, ok := tokenHash(token)
+	if !ok {
+		return false
+	}
+
+	c.accessBatchMu.Lock()
+	defer c.accessBatchMu.Unlock()
+	if !c.accessBatchServices[service] {
+		return false
+	}
+
+	eventSub, _ := c.getSubscription(rname, false)
+	item := &accessBatchItem{
+		rname:          rname,
+		query:          sub.ResourceQuery(),
+		subj:           subj,
+		payload:        payload,
+		requestHeaders: requestHeaders,
+		eventSub:       eventSub,
+		cb:             cb,
+	}
+
+	key := accessBatchKey{service: service, cid: sub.CID(), token: th}
+	ab, ok := c.accessBatches[key]
+	if !ok {
+		ab = &accessBatch{key: key, token: token}
+		c.accessBatches[key] = ab
+		time.AfterFunc(c.accessBatchWindow, func() { c.sendAccessBatch(ab) })
+	}
+	ab.items = append(ab.items, item)
+	return true
+}
+
+// sendAccessBatch sends the pending access requests of the batch. If the
+// service responds with an error to the access batch request, it is no
+// longer considered to support access batch requests, and the access
+// requests are sent separately.
+func (c *Cache) sendAccessBatch(ab *accessBatch) {
+	c.accessBatchMu.Lock()
+	delete(c.accessBatches, ab.key)
+	c.accessBatchMu.Unlock()
+
+	if len(ab.items) == 1 {
+		ab.items[0].send(c)
+		return
+	}
+
+	resources := make([]codec.AccessBatchResource, len(ab.items))
+	for i, item := range ab.items {
+		resources[i] = codec.AccessBatchResource{RID: item.rname, Query: item.query}
+	}
+	payload := codec.CreateAccessBatchRequest(resources, ab.key.cid, ab.token)
+	c.mq.SendRequest("accessbatch."+ab.key.service, payload, func(_ string, data []byte, _ map[string][]string, err error) {
+		var rs []json.RawMessage
+		if err == nil {
+			var rerr *reserr.Error
+			if rs, rerr = codec.DecodeAccessBatchResponse(data, len(ab.items)); rerr != nil {
+				err = rerr
+			}
+		}
+		if err != nil {
+			c.Debugf("Access batch request for service %s failed, sending separate requests: %s", ab.key.service, err)
+			c.setAccessBatchSupport(ab.key.service, false)
+			for _, item := range ab.items {
+				item.send(c)
+			}
+			return
+		}
+		for i, item := range ab.items {
+			item.respond(rs[i], nil)
+		}
+	}, ab.items[0].requestHeaders)
+}
+
+// send sends the access request separately.
+func (item *accessBatchItem) send(c *Cache) {
+	c.sendRetriedRequest(item.subj, item.payload, func(_ string, data []byte, _ map[string][]string, err error) {
+		item.respond(data, err)
+	}, item.requestHeaders)
+}
+
+// respond passes the access response to the callback on the event
+// subscription's worker.
+func (item *accessBatchItem) respond(data []byte, err error) {
+	item.eventSub.Enqueue(func() {
+		item.cb(data, err)
+		item.eventSub.removeCount(1)
+	})
+}
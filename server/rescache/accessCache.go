@@ -0,0 +1,202 @@
+package rescache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/resgateio/resgate/metrics"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// accessKey identifies access results that may be shared between
+// connections.
+type accessKey struct {
+	rname string
+	query string
+	token string // Hex encoded sha256 hash of the JSON encoded token
+}
+
+// accessEntry is a shared access result, or a pending access request if
+// access is nil.
+type accessEntry struct {
+	key    accessKey
+	access *Access
+	cbs    []func(*Access)
+	timer  *time.Timer
+}
+
+// SetAccessCacheTTL sets the duration an access response is shared between
+// subscribers of the same resource, with the same query and token.
+// The connection ID is not part of the key, so that responses are shared
+// across connections. It should therefore only be enabled if access services
+// do not base their response on the cid of the request.
+// Zero or less disables access caching.
+// Should be called before Start.
+func (c *Cache) SetAccessCacheTTL(ttl time.Duration) {
+	c.accessCacheTTL = ttl
+}
+
+// cachedAccess calls the callback with a cached access result for the key,
+// or adds it to a pending access request for the key.
+// Returns nil if a cached or pending entry exists, otherwise the new pending
+// entry, for which an access request must be sent, and the result passed to
+// storeAccess.
+func (c *Cache) cachedAccess(key accessKey, callback func(*Access)) *accessEntry {
+	c.accessMu.Lock()
+	ae, ok := c.accessEntries[key]
+	if !ok {
+		ae = &accessEntry{key: key, cbs: []func(*Access){callback}}
+		c.addAccessEntry(ae)
+		c.accessMu.Unlock()
+		metrics.CacheAccessMisses.Inc()
+		return ae
+	}
+	access := ae.access
+	if access == nil {
+		ae.cbs = append(ae.cbs, callback)
+	}
+	c.accessMu.Unlock()
+
+	metrics.CacheAccessHits.Inc()
+	if access != nil {
+		callback(access)
+	}
+	return nil
+}
+
+// storeAccess passes the access result to all callbacks waiting for the
+// pending entry, and caches the result unless it is an error other than
+// system.accessDenied, or the entry has been invalidated while the request
+// was pending.
+func (c *Cache) storeAccess(ae *accessEntry, access *Access) {
+	c.accessMu.Lock()
+	cbs := ae.cbs
+	ae.cbs = nil
+	if c.accessEntries[ae.key] == ae {
+		if access.Error == nil || access.Error.Code == reserr.CodeAccessDenied {
+			ae.access = access
+			ae.timer = time.AfterFunc(c.accessCacheTTL, func() {
+				c.accessMu.Lock()
+				defer c.accessMu.Unlock()
+				if c.accessEntries[ae.key] == ae {
+					c.removeAccessEntry(ae)
+				}
+			})
+		} else {
+			c.removeAccessEntry(ae)
+		}
+	}
+	c.accessMu.Unlock()
+
+	for _, cb := range cbs {
+		cb(access)
+	}
+}
+
+// invalidateAccess removes all cached access results for the resource.
+func (c *Cache) invalidateAccess(rname string) {
+	c.accessMu.Lock()
+	defer c.accessMu.Unlock()
+	for ae := range c.accessByRID[rname] {
+		c.removeAccessEntry(ae)
+	}
+}
+
+// invalidateAccessMatch removes all cached access results for resources
+// matching any of the resource patterns.
+func (c *Cache) invalidateAccessMatch(p []string) {
+	if len(p) == 0 {
+		return
+	}
+
+	patterns := make([]ResourcePattern, 0, len(p))
+	for _, r := range p {
+		pattern := ParseResourcePattern(r)
+		if pattern.IsValid() {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	c.accessMu.Lock()
+	defer c.accessMu.Unlock()
+	for rname, aes := range c.accessByRID {
+		for _, p := range patterns {
+			if p.Match(rname) {
+				for ae := range aes {
+					c.removeAccessEntry(ae)
+				}
+				break
+			}
+		}
+	}
+}
+
+// InvalidateAccessToken removes all cached access results for the token.
+// Should be called when a connection's token is replaced, before requesting
+// access with the new token.
+func (c *Cache) InvalidateAccessToken(token interface{}) {
+	if c.accessCacheTTL <= 0 {
+		return
+	}
+	th, ok := tokenHash(token)
+	if !ok {
+		return
+	}
+
+	c.accessMu.Lock()
+	defer c.accessMu.Unlock()
+	for ae := range c.accessByToken[th] {
+		c.removeAccessEntry(ae)
+	}
+}
+
+// addAccessEntry adds an entry to the access cache.
+// Cache.accessMu is held when called.
+func (c *Cache) addAccessEntry(ae *accessEntry) {
+	c.accessEntries[ae.key] = ae
+	addAccessIndex(c.accessByRID, ae.key.rname, ae)
+	addAccessIndex(c.accessByToken, ae.key.token, ae)
+}
+
+// removeAccessEntry removes an entry from the access cache. If the entry is
+// pending, its callbacks are still called by storeAccess once the access
+// response is received, but the response is not cached.
+// Cache.accessMu is held when called.
+func (c *Cache) removeAccessEntry(ae *accessEntry) {
+	if ae.timer != nil {
+		ae.timer.Stop()
+		ae.timer = nil
+	}
+	delete(c.accessEntries, ae.key)
+	removeAccessIndex(c.accessByRID, ae.key.rname, ae)
+	removeAccessIndex(c.accessByToken, ae.key.token, ae)
+}
+
+func addAccessIndex(idx map[string]map[*accessEntry]struct{}, k string, ae *accessEntry) {
+	aes, ok := idx[k]
+	if !ok {
+		aes = make(map[*accessEntry]struct{})
+		idx[k] = aes
+	}
+	aes[ae] = struct{}{}
+}
+
+func removeAccessIndex(idx map[string]map[*accessEntry]struct{}, k string, ae *accessEntry) {
+	aes := idx[k]
+	delete(aes, ae)
+	if len(aes) == 0 {
+		delete(idx, k)
+	}
+}
+
+// tokenHash returns a hex encoded sha256 hash of the JSON encoded token.
+func tokenHash(token interface{}) (string, bool) {
+	dta, err := json.Marshal(token)
+	if err != nil {
+		return "", false
+	}
+	h := sha256.Sum256(dta)
+	return hex.EncodeToString(h[:]), true
+}
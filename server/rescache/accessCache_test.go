@@ -0,0 +1,58 @@
+package rescache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server/rescache"
+)
+
+// assertAccessResults waits for n access results, and asserts they all have
+// the expected get access.
+func assertAccessResults(t *testing.T, results chan *rescache.Access, n int, get bool) {
+	for i := 0; i < n; i++ {
+		select {
+		case a := <-results:
+			if a.Error != nil || a.AccessResult.Get != get {
+				t.Fatalf("expected access result with get %v, but got %+v", get, a)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected %d access results, but got %d", n, i)
+		}
+	}
+}
+
+func TestAccessCache_InvalidatedWhilePending_CallsAllCallbacks(t *testing.T) {
+	m := newRequestTestMQ()
+	c := startCache(t, m, 1, time.Hour, func(c *rescache.Cache) {
+		c.SetAccessCacheTTL(time.Minute)
+	})
+	defer c.Stop()
+
+	sub := newTestSubscriber()
+	token := map[string]string{"user": "foo"}
+	results := make(chan *rescache.Access, 4)
+	cb := func(a *rescache.Access) { results <- a }
+
+	// A pending access request shared by two callbacks
+	c.Access(sub, token, nil, cb)
+	req1 := m.getRequest(t)
+	c.Access(sub, token, nil, cb)
+	m.assertNoRequest(t)
+
+	// Invalidating the token results in a new access request
+	c.InvalidateAccessToken(token)
+	c.Access(sub, token, nil, cb)
+	req2 := m.getRequest(t)
+
+	req1("", []byte(`{"result":{"get":true}}`), nil, nil)
+	assertAccessResults(t, results, 2, true)
+
+	req2("", []byte(`{"result":{"get":false}}`), nil, nil)
+	assertAccessResults(t, results, 1, false)
+
+	// Only the response to the request sent after invalidation is cached
+	c.Access(sub, token, nil, cb)
+	m.assertNoRequest(t)
+	assertAccessResults(t, results, 1, false)
+}
@@ -0,0 +1,71 @@
+package rescache
+
+import (
+	"sort"
+
+	"github.com/resgateio/resgate/server/codec"
+)
+
+// AccessPolicy returns the access a client has to a resource, without
+// sending an access request to the service. If nil is returned, an access
+// request is sent.
+type AccessPolicy func(rname, query string, token interface{}) *codec.AccessResult
+
+// accessPolicyPattern is an access policy for resources matching a pattern.
+type accessPolicyPattern struct {
+	raw     string
+	pattern ResourcePattern
+	policy  AccessPolicy
+}
+
+var (
+	publicGetAccess = codec.AccessResult{Get: true}
+	denyAllAccess   = codec.AccessResult{}
+)
+
+// PolicyPublicGet is an access policy granting get access, but no call
+// access, to all clients.
+func PolicyPublicGet(rname, query string, token interface{}) *codec.AccessResult {
+	return &publicGetAccess
+}
+
+// PolicyDenyAll is an access policy denying all access to all clients.
+func PolicyDenyAll(rname, query string, token interface{}) *codec.AccessResult {
+	return &denyAllAccess
+}
+
+// SetAccessPolicy sets the access policy for resources matching the resource
+// pattern, replacing any previous policy for the same pattern. If multiple
+// patterns match a resource, the longest applies. A nil policy removes the
+// policy for the pattern.
+// Should be called before Start.
+func (c *Cache) SetAccessPolicy(pattern string, policy AccessPolicy) {
+	ps := make([]accessPolicyPattern, 0, len(c.accessPolicies)+1)
+	for _, p := range c.accessPolicies {
+		if p.raw != pattern {
+			ps = append(ps, p)
+		}
+	}
+	if policy != nil {
+		ps = append(ps, accessPolicyPattern{
+			raw:     pattern,
+			pattern: ParseResourcePattern(pattern),
+			policy:  policy,
+		})
+	}
+	sort.SliceStable(ps, func(i, j int) bool {
+		return len(ps[i].raw) > len(ps[j].raw)
+	})
+	c.accessPolicies = ps
+}
+
+// policyAccess returns the access result of the access policy for the
+// resource, or nil if no policy applies.
+func (c *Cache) policyAccess(rname, query string, token interface{}) *codec.AccessResult {
+	for _, p := range c.accessPolicies {
+		if p.pattern.Match(rname) {
+			return p.policy(rname, query, token)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package rescache_test
+
+import (
+	"testing"
+
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/rescache"
+)
+
+func TestAccessCanCall_WildcardAction_ReportsAnyCallAccess(t *testing.T) {
+	tbl := []struct {
+		Payload string
+		Granted bool
+	}{
+		{`{"result":{"get":true,"call":"*"}}`, true},
+		{`{"result":{"get":true,"call":"update,delete"}}`, true},
+		{`{"result":{"get":true,"call":"update"}}`, true},
+		{`{"result":{"get":true,"call":false}}`, false},
+		{`{"result":{"get":true,"call":""}}`, false},
+		{`{"result":{"get":true}}`, false},
+		{`{"error":{"code":"system.accessDenied","message":"Access denied"}}`, false},
+	}
+	for i, l := range tbl {
+		r, rerr := codec.DecodeAccessResponse([]byte(l.Payload))
+		a := &rescache.Access{AccessResult: r, Error: rerr}
+		err := a.CanCall("*")
+		if l.Granted && err != nil {
+			t.Errorf("expected CanCall(\"*\") to return nil, but got %s in test %d", err, i+1)
+		} else if !l.Granted && err == nil {
+			t.Errorf("expected CanCall(\"*\") to return an error, but got nil in test %d", i+1)
+		}
+	}
+}
+
+func TestAccessCanCall_SpecificAction_ReportsActionAccess(t *testing.T) {
+	tbl := []struct {
+		Call    string
+		Action  string
+		Granted bool
+	}{
+		{"*", "update", true},
+		{"update,delete", "update", true},
+		{"update,delete", "delete", true},
+		{"update,delete", "set", false},
+		{"", "update", false},
+	}
+	for i, l := range tbl {
+		a := &rescache.Access{AccessResult: &codec.AccessResult{Get: true, Call: l.Call}}
+		err := a.CanCall(l.Action)
+		if l.Granted && err != nil {
+			t.Errorf("expected CanCall(%#v) to return nil, but got %s in test %d", l.Action, err, i+1)
+		} else if !l.Granted && err == nil {
+			t.Errorf("expected CanCall(%#v) to return an error, but got nil in test %d", l.Action, i+1)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package rescache
+
+import (
+	"sort"
+	"time"
+)
+
+// backgroundRefreshPattern is a background refresh interval for resources
+// matching a pattern.
+type backgroundRefreshPattern struct {
+	pattern  ResourcePattern
+	length   int
+	interval time.Duration
+}
+
+// WithBackgroundRefreshInterval periodically re-fetches resources matching
+// resourcePattern, with the interval d, while they have subscribers. Any
+// difference from the cached resource is sent to subscribers as change, add,
+// or remove events, in the same way as for a system reset. It is intended for
+// resources of services that don't reliably send events. If multiple patterns
+// match a resource, the longest applies. An interval of 0 means no refresh.
+// It must be called before the cache is started.
+func (c *Cache) WithBackgroundRefreshInterval(d time.Duration, resourcePattern string) *Cache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.backgroundRefreshes = append(c.backgroundRefreshes, backgroundRefreshPattern{
+		pattern:  ParseResourcePattern(resourcePattern),
+		length:   len(resourcePattern),
+		interval: d,
+	})
+	sort.SliceStable(c.backgroundRefreshes, func(i, j int) bool {
+		return c.backgroundRefreshes[i].length > c.backgroundRefreshes[j].length
+	})
+	return c
+}
+
+// backgroundRefreshInterval returns the background refresh interval for the
+// resource, or 0 if the resource is not refreshed.
+// Cache mutex is held when called.
+func (c *Cache) backgroundRefreshInterval(rname string) time.Duration {
+	for _, p := range c.backgroundRefreshes {
+		if p.pattern.Match(rname) {
+			return p.interval
+		}
+	}
+	return 0
+}
+
+// startRefresh starts a goroutine refreshing the resource with the interval
+// d, if d is greater than 0, until stopRefresh is called or the cache is
+// stopped.
+// Cache mutex is held when called.
+func (e *EventSubscription) startRefresh(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	stop := make(chan struct{})
+	e.refreshStop = stop
+	go e.refresh(d, stop, e.cache.stopCh)
+}
+
+// stopRefresh stops any goroutine started by startRefresh.
+// Cache mutex is held when called.
+func (e *EventSubscription) stopRefresh() {
+	if e.refreshStop != nil {
+		close(e.refreshStop)
+		e.refreshStop = nil
+	}
+}
+
+// refresh resets the resource on each tick while it has subscribers.
+// Resources retained without subscribers during the unsubscribe delay are
+// not refreshed.
+func (e *EventSubscription) refresh(d time.Duration, stop chan struct{}, cacheStop chan struct{}) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			select {
+			case <-cacheStop:
+				return
+			default:
+			}
+			e.Enqueue(func() {
+				// Count is protected by the event subscription mutex, held
+				// by the worker.
+				if e.count > 0 {
+					e.resetResources(nil)
+				}
+			})
+		case <-stop:
+			return
+		case <-cacheStop:
+			return
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package rescache
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/resgateio/resgate/metrics"
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/mq"
+)
+
+// EventRateLimitSubject is the subject prefix for diagnostic messages
+// published when a resource exceeds its event rate limit. The resource name
+// is appended to the subject.
+const EventRateLimitSubject = "resgate.eventRateLimit"
+
+// eventRateLimitNotifyInterval is the minimum time between two diagnostic
+// messages for the same resource.
+const eventRateLimitNotifyInterval = time.Minute
+
+// eventRateLimitPattern is an event rate limit for resources matching a
+// pattern.
+type eventRateLimitPattern struct {
+	pattern ResourcePattern
+	length  int
+	limit   int
+}
+
+// eventRateLimitNotice is the payload of a diagnostic message published when
+// a resource exceeds its event rate limit.
+type eventRateLimitNotice struct {
+	RID   string `json:"rid"`
+	Limit int    `json:"limit"`
+}
+
+// eventLimiter is a token bucket limiting the rate of events on a resource.
+// The bucket holds up to limit tokens, and is refilled at a rate of limit
+// tokens per second.
+type eventLimiter struct {
+	limit     int
+	tokens    float64
+	last      time.Time
+	throttled bool      // True from the first denied event until the bucket is full again
+	notified  time.Time // Time of the last diagnostic message
+}
+
+// SetEventRateLimit sets the maximum number of events per second accepted on
+// a single resource. The overrides map resource patterns to limits, where the
+// longest matching pattern applies. A limit of 0 means no limit. It must be
+// called before the cache is started.
+func (c *Cache) SetEventRateLimit(limit int, overrides map[string]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.eventRateLimit = limit
+	c.eventRateLimits = make([]eventRateLimitPattern, 0, len(overrides))
+	for p, l := range overrides {
+		c.eventRateLimits = append(c.eventRateLimits, eventRateLimitPattern{
+			pattern: ParseResourcePattern(p),
+			length:  len(p),
+			limit:   l,
+		})
+	}
+	sort.Slice(c.eventRateLimits, func(i, j int) bool {
+		return c.eventRateLimits[i].length > c.eventRateLimits[j].length
+	})
+}
+
+// newEventLimiter returns an event limiter for the resource, or nil if events
+// on the resource are not limited.
+// Cache mutex is held when called.
+func (c *Cache) newEventLimiter(rname string) *eventLimiter {
+	limit := c.eventRateLimit
+	for _, p := range c.eventRateLimits {
+		if p.pattern.Match(rname) {
+			limit = p.limit
+			break
+		}
+	}
+	if limit <= 0 {
+		return nil
+	}
+	return &eventLimiter{
+		limit:  limit,
+		tokens: float64(limit),
+		last:   time.Now(),
+	}
+}
+
+// allow refills the bucket and takes a token, returning true if a token was
+// available.
+func (l *eventLimiter) allow(now time.Time) bool {
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.limit)
+	l.last = now
+	if l.tokens >= float64(l.limit) {
+		l.tokens = float64(l.limit)
+		l.throttled = false
+	}
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// wait returns the duration until the next token is available.
+func (l *eventLimiter) wait() time.Duration {
+	if l.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / float64(l.limit) * float64(time.Second))
+}
+
+// limitEvent applies the event rate limit to an event on the base resource.
+// It returns true if the event was coalesced or dropped, and should not be
+// handled. Change events beyond the limit are merged, and handled as a single
+// change event once the limit allows it. Other events beyond the limit are
+// dropped. Delete events are never limited.
+func (e *EventSubscription) limitEvent(event string, payload json.RawMessage) bool {
+	if event == "delete" {
+		e.discardChanges()
+		return false
+	}
+
+	if e.limiter.allow(time.Now()) {
+		// Flush changes before any other event to keep the order.
+		if event != "change" {
+			e.flushChanges()
+			return false
+		}
+		if e.pending == nil {
+			return false
+		}
+		if !e.mergeChange(payload) {
+			return true
+		}
+		e.flushChanges()
+		return true
+	}
+
+	e.throttle()
+	if event != "change" {
+		return true
+	}
+	if e.mergeChange(payload) {
+		e.scheduleFlush()
+	}
+	return true
+}
+
+// throttle marks the limiter as throttled. On activation, a metric is counted
+// and an error is logged. A diagnostic message is published, unless one has
+// already been published for the resource within the notify interval, or the
+// messaging client is not a mq.Publisher. The message is published by a
+// separate goroutine, as the event subscription mutex is held.
+func (e *EventSubscription) throttle() {
+	l := e.limiter
+	if l.throttled {
+		return
+	}
+	l.throttled = true
+	metrics.CacheEventThrottleActivations.WithLabelValues(metrics.SanitizedString(serviceName(e.ResourceName))).Inc()
+	e.cache.Errorf("Event rate limit of %d events per second exceeded for %s: coalescing change events and dropping other events", l.limit, e.ResourceName)
+
+	p, ok := e.cache.mq.(mq.Publisher)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if !l.notified.IsZero() && now.Sub(l.notified) < eventRateLimitNotifyInterval {
+		return
+	}
+	l.notified = now
+	payload, _ := json.Marshal(eventRateLimitNotice{RID: e.ResourceName, Limit: l.limit})
+	rname := e.ResourceName
+	go func() {
+		if err := p.Publish(EventRateLimitSubject+"."+rname, payload); err != nil {
+			e.cache.Errorf("Error publishing event rate limit notice for %s: %s", rname, err)
+		}
+	}()
+}
+
+// mergeChange merges the values of a change event into the pending changes.
+// It returns false if the payload could not be decoded.
+func (e *EventSubscription) mergeChange(payload json.RawMessage) bool {
+	props, err := e.decodeChangeEvent(payload)
+	if err != nil {
+		e.cache.Errorf("Error processing event %s.change: %s", e.ResourceName, err)
+		return false
+	}
+	if e.pending == nil {
+		e.pending = props
+		return true
+	}
+	for k, v := range props {
+		e.pending[k] = v
+	}
+	return true
+}
+
+// flushChanges handles any pending changes as a single change event.
+func (e *EventSubscription) flushChanges() {
+	props := e.pending
+	if props == nil {
+		return
+	}
+	e.discardChanges()
+	if e.base == nil || e.base.query != "" {
+		return
+	}
+	e.base.handleEvent(&ResourceEvent{Event: "change", Payload: codec.EncodeChangeEvent(props)})
+}
+
+// discardChanges removes any pending changes without handling them.
+func (e *EventSubscription) discardChanges() {
+	e.pending = nil
+	if e.flushTimer != nil {
+		e.flushTimer.Stop()
+		e.flushTimer = nil
+	}
+}
+
+// scheduleFlush starts a timer to flush pending changes once the limit
+// allows another event, unless a timer is already started.
+func (e *EventSubscription) scheduleFlush() {
+	if e.flushTimer != nil {
+		return
+	}
+	var t *time.Timer
+	t = time.AfterFunc(e.limiter.wait(), func() {
+		select {
+		case <-e.cache.stopCh:
+			return
+		default:
+		}
+		e.Enqueue(func() {
+			if e.flushTimer != t {
+				return
+			}
+			e.flushTimer = nil
+			if e.pending == nil {
+				return
+			}
+			if e.limiter.allow(time.Now()) {
+				e.flushChanges()
+			} else {
+				e.scheduleFlush()
+			}
+		})
+	})
+	e.flushTimer = t
+}
+
+// serviceName returns the service name of a resource, which is the first
+// segment of the resource name.
+func serviceName(rname string) string {
+	if idx := strings.IndexByte(rname, '.'); idx >= 0 {
+		return rname[:idx]
+	}
+	return rname
+}
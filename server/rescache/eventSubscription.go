@@ -2,6 +2,7 @@ package rescache
 
 import (
 	"sync"
+	"time"
 
 	"github.com/resgateio/resgate/metrics"
 	"github.com/resgateio/resgate/server/codec"
@@ -24,20 +25,30 @@ type EventSubscription struct {
 	// Immutable
 	ResourceName string
 	cache        *Cache
+	unshared     bool // Unsubscribed without delay, and without keeping JSON encodings
 
 	// Protected by cache mutex
-	mqSub mq.Unsubscriber
-	count int64
+	mqSub       mq.Unsubscriber
+	count       int64
+	refreshStop chan struct{} // Closed to stop background refresh
 
 	// Protected by single goroutine
-	base    *ResourceSubscription
-	queries map[string]*ResourceSubscription
-	links   map[string]*ResourceSubscription
+	base        *ResourceSubscription
+	queries     map[string]*ResourceSubscription
+	links       map[string]*ResourceSubscription
+	limiter     *eventLimiter          // Event rate limiter, or nil if not limited
+	pending     map[string]codec.Value // Coalesced change values
+	flushTimer  *time.Timer
+	subscribers int // Subscribers of all resource subscriptions
 
 	// Mutex protected
-	mu    sync.Mutex
-	queue []func()
-	locks []func()
+	mu            sync.Mutex
+	queue         []func()
+	locks         []func()
+	retained      bool   // True while waiting in the unsubscribe queue
+	retainedBytes int64  // Estimated size when retained
+	group         string // Group of the resource, or empty if not grouped
+	unsubPending  bool   // True while an unshared unsubscribe is pending
 }
 
 func (e *EventSubscription) getResourceSubscription(q string) (rs *ResourceSubscription) {
@@ -69,58 +80,71 @@ func (e *EventSubscription) getResourceSubscription(q string) (rs *ResourceSubsc
 
 func (e *EventSubscription) addSubscriber(sub Subscriber, t *Throttle, requestHeaders map[string][]string) {
 	e.Enqueue(func() {
-		var rs *ResourceSubscription
-		q := sub.ResourceQuery()
-		rs = e.getResourceSubscription(q)
+		rs := e.getResourceSubscription(sub.ResourceQuery())
+		// A recently called resource is fetched anew rather than served
+		// from cache.
+		if (rs.state == stateModel || rs.state == stateCollection) && e.cache.consumeWritten(e.ResourceName) {
+			rs.addFreshSubscriber(sub, requestHeaders)
+			return
+		}
+		e.loadSubscriber(rs, sub, t, requestHeaders)
+	})
+}
 
-		if rs.state != stateError {
+// loadSubscriber adds the subscriber to the resource subscription, and calls
+// Loaded once the resource is loaded.
+// Event subscription mutex is held when called.
+func (e *EventSubscription) loadSubscriber(rs *ResourceSubscription, sub Subscriber, t *Throttle, requestHeaders map[string][]string) {
+	if rs.state != stateError && rs.state != stateNotFound {
+		if _, ok := rs.subs[sub]; !ok {
 			rs.subs[sub] = struct{}{}
+			e.addSubscribers(1)
 		}
+	}
 
-		switch rs.state {
-		// A subscription is made, but no request for the data.
-		// A request is made and state progressed
-		case stateSubscribed:
-			// Progress state
-			rs.state = stateRequested
-			// Create request
-			subj := "get." + e.ResourceName
-			payload := codec.CreateGetRequest(q)
-			// Request directly if we don't throttle, or else add to throttle
-			if t == nil {
-				e.cache.mq.SendRequest(subj, payload, func(_ string, data []byte, responseHeaders map[string][]string, err error) {
+	switch rs.state {
+	// A subscription is made, but no request for the data.
+	// A request is made and state progressed
+	case stateSubscribed:
+		// Progress state
+		rs.state = stateRequested
+		// Create request
+		subj := "get." + e.ResourceName
+		payload := codec.CreateGetRequest(rs.query)
+		// Request directly if we don't throttle, or else add to throttle
+		if t == nil {
+			e.cache.sendRetriedRequest(subj, payload, func(_ string, data []byte, responseHeaders map[string][]string, err error) {
+				rs.enqueueGetResponse(data, responseHeaders, err)
+			}, requestHeaders)
+		} else {
+			t.Add(func() {
+				e.cache.sendRetriedRequest(subj, payload, func(_ string, data []byte, responseHeaders map[string][]string, err error) {
 					rs.enqueueGetResponse(data, responseHeaders, err)
+					t.Done()
 				}, requestHeaders)
-			} else {
-				t.Add(func() {
-					e.cache.mq.SendRequest(subj, payload, func(_ string, data []byte, responseHeaders map[string][]string, err error) {
-						rs.enqueueGetResponse(data, responseHeaders, err)
-						t.Done()
-					}, requestHeaders)
-				})
-			}
-
-		// If a request has already been sent
-		// In that case the subscriber will be handled
-		// on the response for that request
-		case stateRequested:
-			return
+			})
+		}
 
-		// An error occurred during request
-		case stateError:
-			e.count--
-			metrics.SubcriptionsCount.WithLabelValues(metrics.SanitizedString(e.ResourceName)).Dec()
-			e.mu.Unlock()
-			defer e.mu.Lock()
-			sub.Loaded(nil, nil, rs.err)
+	// If a request has already been sent
+	// In that case the subscriber will be handled
+	// on the response for that request
+	case stateRequested:
+		return
 
-		// stateModel or stateCollection
-		default:
-			e.mu.Unlock()
-			defer e.mu.Lock()
-			sub.Loaded(rs, nil, nil)
-		}
-	})
+	// An error occurred during request, or a cached not found error
+	case stateError, stateNotFound:
+		e.count--
+		metrics.SubcriptionsCount.WithLabelValues(metrics.SanitizedString(e.ResourceName)).Dec()
+		e.mu.Unlock()
+		defer e.mu.Lock()
+		sub.Loaded(nil, nil, rs.err)
+
+	// stateModel or stateCollection
+	default:
+		e.mu.Unlock()
+		defer e.mu.Lock()
+		sub.Loaded(rs, nil, nil)
+	}
 }
 
 // Enqueue passes the callback function to be executed by one of the worker goroutines.
@@ -137,7 +161,7 @@ func (e *EventSubscription) Enqueue(f func()) {
 	// assigned to the event subscription, so we pass it to one.
 	// This only applies if no locks are active
 	if locks == nil && count == 0 {
-		e.cache.inCh <- e
+		e.cache.work(e)
 	}
 }
 
@@ -151,7 +175,7 @@ func (e *EventSubscription) enqueueUnlock(f func()) {
 	e.mu.Unlock()
 
 	if count == 0 {
-		e.cache.inCh <- e
+		e.cache.work(e)
 	}
 }
 
@@ -212,23 +236,45 @@ func (e *EventSubscription) addCount() {
 
 	if e.count == 0 {
 		e.cache.unsubQueue.Remove(e)
+		e.cache.release(e, true)
 	}
 	e.count++
 	metrics.SubcriptionsCount.WithLabelValues(metrics.SanitizedString(e.ResourceName)).Inc()
 }
 
 // removeCount decreases the subscription count, and puts the event subscription
-// in the unsubscribe queue if count reaches zero.
+// in the unsubscribe queue if count reaches zero. An unshared event
+// subscription is unsubscribed without delay.
 func (e *EventSubscription) removeCount(n int64) {
 	e.count -= n
 	if e.count == 0 && n != 0 {
-		e.cache.unsubQueue.Add(e)
+		if e.unshared {
+			// The cache mutex must be locked before the event subscription
+			// mutex, which is held.
+			if !e.unsubPending {
+				e.unsubPending = true
+				go e.cache.mqUnsubscribe(e)
+			}
+		} else {
+			e.cache.unsubQueue.Add(e)
+			e.cache.retain(e)
+		}
 	}
 	metrics.SubcriptionsCount.WithLabelValues(metrics.SanitizedString(e.ResourceName)).Sub(float64(n))
 }
 
-func (e *EventSubscription) enqueueEvent(subj string, payload []byte) {
-	e.Enqueue(func() {
+// enqueueEvent enqueues an event to be handled. Any trace context headers,
+// traceHeaders, are set on requests sent in response to the event.
+func (e *EventSubscription) enqueueEvent(subj string, payload []byte, traceHeaders map[string][]string) {
+	e.mu.Lock()
+	group := e.group
+	e.mu.Unlock()
+
+	enqueue := e.Enqueue
+	if group != "" {
+		enqueue = func(f func()) { e.cache.enqueueGroupEvent(group, e, f) }
+	}
+	enqueue(func() {
 		idx := len(e.ResourceName) + 7 // Length of "event." + "."
 		if idx >= len(subj) {
 			e.cache.Errorf("Error processing event %s: malformed event subject", subj)
@@ -238,8 +284,11 @@ func (e *EventSubscription) enqueueEvent(subj string, payload []byte) {
 		event := subj[idx:]
 		switch event {
 		case "query":
-			e.handleQueryEvent(subj, payload)
+			e.handleQueryEvent(subj, payload, traceHeaders)
 		default:
+			if event == "reaccess" {
+				e.cache.invalidateAccess(e.ResourceName)
+			}
 
 			// Validate we have a base resource,
 			// and that it is not a link to a query resource.
@@ -253,12 +302,16 @@ func (e *EventSubscription) enqueueEvent(subj string, payload []byte) {
 				return
 			}
 
+			if e.limiter != nil && e.limitEvent(event, ev) {
+				return
+			}
+
 			e.base.handleEvent(&ResourceEvent{Event: event, Payload: ev})
 		}
 	})
 }
 
-func (e *EventSubscription) handleQueryEvent(subj string, payload []byte) {
+func (e *EventSubscription) handleQueryEvent(subj string, payload []byte, traceHeaders map[string][]string) {
 	l := len(e.queries)
 	if l == 0 {
 		return
@@ -314,20 +367,20 @@ func (e *EventSubscription) handleQueryEvent(subj string, payload []byte) {
 				// Handle model response
 				case result.Model != nil:
 					if rs.state != stateModel {
-						e.cache.Errorf("Error processing query event for %s?%s: non-model payload on model %s", e.ResourceName, rs.query, data)
+						rs.handleTypeMismatch(TypeModel, "query event response")
 						return
 					}
 					rs.processResetModel(result.Model)
 				// Handle collection response
 				case result.Collection != nil:
 					if rs.state != stateCollection {
-						e.cache.Errorf("Error processing query event for %s?%s: non-model payload on model %s", e.ResourceName, rs.query, data)
+						rs.handleTypeMismatch(TypeCollection, "query event response")
 						return
 					}
 					rs.processResetCollection(result.Collection)
 				}
 			})
-		}, nil)
+		}, traceHeaders)
 	}
 }
 
@@ -339,6 +392,8 @@ func (e *EventSubscription) mqUnsubscribe() bool {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
+	e.unsubPending = false
+
 	// Have we just received a subscription?
 	// In that case we abort
 	if e.count > 0 {
@@ -347,6 +402,8 @@ func (e *EventSubscription) mqUnsubscribe() bool {
 
 	// Clear the response queue
 	e.queue = nil
+	e.discardChanges()
+	e.cache.dropGroupEvents(e)
 
 	// Unsubscribe from messaging system
 	if e.mqSub != nil {
@@ -355,20 +412,36 @@ func (e *EventSubscription) mqUnsubscribe() bool {
 			e.cache.Errorf("Error unsubscribing to %s: %s", e.ResourceName, err)
 			return false
 		}
+		e.mqSub = nil
 	}
+	e.cache.release(e, false)
 	return true
 }
 
+// size returns an estimate of the memory in bytes held by the cached
+// resources of the event subscription.
+func (e *EventSubscription) size() int64 {
+	n := e.base.size()
+	for _, rs := range e.queries {
+		n += rs.size()
+	}
+	return n
+}
+
 func (e *EventSubscription) handleResetResource(t *Throttle) {
-	e.Enqueue(func() {
-		if e.base != nil && e.base.query == "" {
-			e.base.handleResetResource(t)
-		}
+	e.Enqueue(func() { e.resetResources(t) })
+}
 
-		for _, rs := range e.queries {
-			rs.handleResetResource(t)
-		}
-	})
+// resetResources resets the base resource and all query resources.
+// Called from within the event subscription's worker.
+func (e *EventSubscription) resetResources(t *Throttle) {
+	if e.base != nil && e.base.query == "" {
+		e.base.handleResetResource(t)
+	}
+
+	for _, rs := range e.queries {
+		rs.handleResetResource(t)
+	}
 }
 
 func (e *EventSubscription) handleResetAccess(t *Throttle) {
@@ -0,0 +1,42 @@
+package rescache
+
+import (
+	"time"
+
+	"github.com/resgateio/resgate/server/codec"
+)
+
+// WithTimestampEvents sets if change, add, and remove events without a ts
+// field set by the service should have their Timestamp set to the time the
+// event was handled by the cache. It must be called before the cache is
+// started.
+func (c *Cache) WithTimestampEvents(enable bool) *Cache {
+	c.timestampEvents = enable
+	return c
+}
+
+// eventTimestamp returns the timestamp of a change, add, or remove event. The
+// ts field of the payload is used if set by the service. Otherwise the
+// current time is used if timestamp events are enabled. For any other event,
+// the zero time is returned.
+func (e *EventSubscription) eventTimestamp(r *ResourceEvent) time.Time {
+	switch r.Event {
+	case "change":
+		// [DEPRECATED:deprecatedModelChangeEvent]
+		// Legacy change events have no reserved fields.
+		if codec.IsLegacyChangeEvent(r.Payload) {
+			break
+		}
+		fallthrough
+	case "add", "remove":
+		if ts := codec.DecodeEventTimestamp(r.Payload); !ts.IsZero() {
+			return ts
+		}
+	default:
+		return time.Time{}
+	}
+	if e.cache.timestampEvents {
+		return time.Now()
+	}
+	return time.Time{}
+}
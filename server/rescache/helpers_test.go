@@ -0,0 +1,238 @@
+package rescache_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/logger"
+	"github.com/resgateio/resgate/server/mq"
+	"github.com/resgateio/resgate/server/rescache"
+)
+
+const testUnsubscribeDelay = 50 * time.Millisecond
+
+// testGetResponse is the get response of the default test messaging client.
+const testGetResponse = `{"result":{"model":{"foo":"bar"}}}`
+
+// testMQ is a messaging client responding to get requests, and letting the
+// test publish events on subscribed resources. If reqs is set, requests are
+// passed on the channel instead, leaving it to the test to respond.
+type testMQ struct {
+	getResponse func(subj string) string
+	reqs        chan mq.Response
+	mu          sync.Mutex
+	subs        map[string]mq.Response
+}
+
+// newTestMQ returns a messaging client responding to all get requests with
+// the get response.
+func newTestMQ(getResponse string) *testMQ {
+	return newTestMQFunc(func(string) string { return getResponse })
+}
+
+// newTestMQFunc returns a messaging client responding to get requests with
+// the response returned by f for the request subject.
+func newTestMQFunc(f func(subj string) string) *testMQ {
+	return &testMQ{getResponse: f, subs: make(map[string]mq.Response)}
+}
+
+// newRequestTestMQ returns a messaging client passing all requests on a
+// channel.
+func newRequestTestMQ() *testMQ {
+	return &testMQ{reqs: make(chan mq.Response, 4), subs: make(map[string]mq.Response)}
+}
+
+func (m *testMQ) Connect() error { return nil }
+func (m *testMQ) SendRequest(subj string, payload []byte, cb mq.Response, requestHeaders map[string][]string) {
+	if m.reqs != nil {
+		m.reqs <- cb
+		return
+	}
+	go cb(subj, []byte(m.getResponse(subj)), nil, nil)
+}
+func (m *testMQ) Subscribe(namespace string, cb mq.Response) (mq.Unsubscriber, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subs[namespace] = cb
+	return testUnsubscriber{m: m, namespace: namespace}, nil
+}
+func (m *testMQ) Close()                          {}
+func (m *testMQ) IsClosed() bool                  { return false }
+func (m *testMQ) SetClosedHandler(cb func(error)) {}
+
+type testUnsubscriber struct {
+	m         *testMQ
+	namespace string
+}
+
+func (u testUnsubscriber) Unsubscribe() error {
+	u.m.mu.Lock()
+	defer u.m.mu.Unlock()
+	delete(u.m.subs, u.namespace)
+	return nil
+}
+
+// publish sends an event on the resource to the cache. Nothing is sent if
+// the cache is not subscribed to the resource events.
+func (m *testMQ) publish(rname, event string, payload []byte) {
+	m.mu.Lock()
+	cb := m.subs["event."+rname]
+	m.mu.Unlock()
+	if cb != nil {
+		cb("event."+rname+"."+event, payload, nil, nil)
+	}
+}
+
+// assertUnsubscribed waits for the cache to unsubscribe to the resource
+// events.
+func (m *testMQ) assertUnsubscribed(t *testing.T, rname string) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		m.mu.Lock()
+		_, ok := m.subs["event."+rname]
+		m.mu.Unlock()
+		if !ok {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("expected %s to be unsubscribed, but timed out", rname)
+}
+
+// getRequest returns the callback of the next request.
+func (m *testMQ) getRequest(t *testing.T) mq.Response {
+	select {
+	case cb := <-m.reqs:
+		return cb
+	case <-time.After(time.Second):
+		t.Fatal("expected a request, but timed out")
+	}
+	return nil
+}
+
+// assertNoRequest asserts that no request has been sent.
+func (m *testMQ) assertNoRequest(t *testing.T) {
+	select {
+	case <-m.reqs:
+		t.Fatal("expected no request, but got one")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+// testSubscriber is a subscriber passing the loaded resource subscription on
+// a channel, and holding on to all events, as a slow subscriber with queued
+// events would. If log is set, the resource name is also logged for each
+// event, after the delay.
+type testSubscriber struct {
+	rname  string
+	loaded chan *rescache.ResourceSubscription
+	delay  time.Duration
+	log    *eventLog
+	mu     sync.Mutex
+	events []*rescache.ResourceEvent
+}
+
+// eventLog is a log of resource names shared by subscribers.
+type eventLog struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func newTestSubscriber() *testSubscriber {
+	return newNamedTestSubscriber("test.model")
+}
+
+func newNamedTestSubscriber(rname string) *testSubscriber {
+	return &testSubscriber{rname: rname, loaded: make(chan *rescache.ResourceSubscription, 1)}
+}
+
+// newLogSubscriber returns a subscriber logging its resource name to log
+// for each event, after the delay.
+func newLogSubscriber(rname string, delay time.Duration, log *eventLog) *testSubscriber {
+	s := newNamedTestSubscriber(rname)
+	s.delay = delay
+	s.log = log
+	return s
+}
+
+func (s *testSubscriber) CID() string                   { return "testcid" }
+func (s *testSubscriber) RequestID() string             { return "" }
+func (s *testSubscriber) ResourceName() string          { return s.rname }
+func (s *testSubscriber) ResourceQuery() string         { return "" }
+func (s *testSubscriber) Reaccess(t *rescache.Throttle) {}
+func (s *testSubscriber) Loaded(rs *rescache.ResourceSubscription, responseHeaders map[string][]string, err error) {
+	s.loaded <- rs
+}
+
+func (s *testSubscriber) Event(event *rescache.ResourceEvent) {
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	s.events = append(s.events, event)
+	s.mu.Unlock()
+	if s.log != nil {
+		s.log.mu.Lock()
+		s.log.names = append(s.log.names, s.rname)
+		s.log.mu.Unlock()
+	}
+}
+
+// subscribe subscribes to the resource and waits for it to be loaded.
+func (s *testSubscriber) subscribe(t *testing.T, c *rescache.Cache) *rescache.ResourceSubscription {
+	c.Subscribe(s, nil, nil)
+	select {
+	case rs := <-s.loaded:
+		if rs == nil {
+			t.Fatal("expected resource subscription, but got nil")
+		}
+		return rs
+	case <-time.After(time.Second):
+		t.Fatal("expected resource to be loaded, but timed out")
+	}
+	return nil
+}
+
+// awaitEvents waits until the subscriber has received n events, and returns
+// them.
+func (s *testSubscriber) awaitEvents(t *testing.T, n int) []*rescache.ResourceEvent {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		evs := s.events
+		s.mu.Unlock()
+		if len(evs) >= n {
+			return evs
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("expected %d events, but timed out", n)
+	return nil
+}
+
+// startTestCache starts a cache with a single worker, using a messaging
+// client responding with testGetResponse.
+func startTestCache(t *testing.T) *rescache.Cache {
+	return startCache(t, newTestMQ(testGetResponse), 1, testUnsubscribeDelay)
+}
+
+// startCache starts a cache using the messaging client, after calling the
+// setup functions on it.
+func startCache(tb testing.TB, m *testMQ, workers int, unsubscribeDelay time.Duration, setup ...func(c *rescache.Cache)) *rescache.Cache {
+	c := rescache.NewCache(m, workers, 0, unsubscribeDelay, logger.NewMemLogger(false, false))
+	for _, f := range setup {
+		f(c)
+	}
+	if err := c.Start(); err != nil {
+		tb.Fatal(err)
+	}
+	return c
+}
+
+// startEventCache starts a cache using the messaging client, with a
+// subscriber loaded for test.model.
+func startEventCache(t *testing.T, m *testMQ) (*rescache.Cache, *testSubscriber) {
+	c := startCache(t, m, 1, testUnsubscribeDelay)
+	sub := newTestSubscriber()
+	sub.subscribe(t, c)
+	return c, sub
+}
@@ -0,0 +1,16 @@
+package rescache
+
+// InjectEvent handles an event on a cached resource as if it was received
+// from the messaging system, passing it through the same event handling. It
+// returns false if the resource is not cached, in which case the event is
+// discarded.
+func (c *Cache) InjectEvent(rname, event string, payload []byte) bool {
+	c.mu.Lock()
+	eventSub := c.eventSubs[rname]
+	c.mu.Unlock()
+	if eventSub == nil {
+		return false
+	}
+	eventSub.enqueueEvent("event."+rname+"."+event, payload, nil)
+	return true
+}
@@ -0,0 +1,59 @@
+package rescache
+
+import (
+	"time"
+
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// SetNegativeCacheTTL sets the duration a system.notFound get response is
+// cached. Zero or less disables negative caching.
+// Should be called before Start.
+func (c *Cache) SetNegativeCacheTTL(ttl time.Duration) {
+	c.negativeCacheTTL = ttl
+}
+
+// cacheNotFound sets the resource subscription to stateNotFound if err is a
+// system.notFound error and negative caching is enabled, and starts a timer
+// to evict it once the TTL expires. While cached, the entry holds one count
+// on the event subscription. The caller must not remove that count.
+// Returns true if the error is cached.
+// Event subscription mutex is held when called.
+func (rs *ResourceSubscription) cacheNotFound(err error) bool {
+	ttl := rs.e.cache.negativeCacheTTL
+	if ttl <= 0 || !reserr.IsError(err, reserr.CodeNotFound) {
+		return false
+	}
+
+	rs.state = stateNotFound
+	var t *time.Timer
+	t = time.AfterFunc(ttl, func() {
+		select {
+		case <-rs.e.cache.stopCh:
+			return
+		default:
+		}
+		rs.e.Enqueue(func() {
+			if rs.notFoundTimer != t {
+				return
+			}
+			rs.evictNotFound()
+		})
+	})
+	rs.notFoundTimer = t
+	return true
+}
+
+// evictNotFound removes a cached system.notFound error, releasing the count
+// held on the event subscription. The next subscriber will make a new get
+// request.
+// Event subscription mutex is held when called.
+func (rs *ResourceSubscription) evictNotFound() {
+	if rs.notFoundTimer != nil {
+		rs.notFoundTimer.Stop()
+		rs.notFoundTimer = nil
+	}
+	rs.state = stateError
+	rs.unregister()
+	rs.e.removeCount(1)
+}
@@ -0,0 +1,140 @@
+package rescache
+
+import (
+	"time"
+
+	"github.com/resgateio/resgate/server/codec"
+)
+
+// primeRateWindow is the time window for the prime rate limit.
+const primeRateWindow = time.Second
+
+// SetPrimeLimits sets the limits for system prime events. The maxSize is the
+// maximum payload size in bytes, and rateLimit is the maximum number of prime
+// events accepted per second for resources sharing the same service name, the
+// first segment of the resource name. A value of 0 means no limit.
+func (c *Cache) SetPrimeLimits(maxSize int, rateLimit int) {
+	c.primeMu.Lock()
+	defer c.primeMu.Unlock()
+	c.primeMaxSize = maxSize
+	c.primeRateLimit = rateLimit
+}
+
+// handleSystemPrime handles a system prime event by creating or refreshing
+// the cached base resource, without any request to the service. A primed
+// resource without subscribers is evicted after the unsubscribe delay.
+func (c *Cache) handleSystemPrime(payload []byte) {
+	if !c.primeSizeAllowed(len(payload)) {
+		c.Errorf("Error processing system prime: payload size %d exceeds limit", len(payload))
+		return
+	}
+
+	r, err := codec.DecodeSystemPrime(payload)
+	if err != nil {
+		c.Errorf("Error decoding system prime: %s", err)
+		return
+	}
+
+	if !c.primeRateAllowed(r.RID) {
+		c.Errorf("Error processing system prime for %s: rate limit exceeded", r.RID)
+		return
+	}
+
+	eventSub, err := c.getSubscription(r.RID, true)
+	if err != nil {
+		c.Errorf("Error processing system prime for %s: %s", r.RID, err)
+		return
+	}
+
+	eventSub.Enqueue(func() {
+		eventSub.handlePrime(&r.GetResult)
+		// Release the count held during priming. If there are no other
+		// subscriptions, the resource is kept until the unsubscribe delay
+		// has passed.
+		eventSub.removeCount(1)
+	})
+}
+
+// primeSizeAllowed returns true if a prime event payload of size bytes is
+// within the size limit.
+func (c *Cache) primeSizeAllowed(size int) bool {
+	c.primeMu.Lock()
+	defer c.primeMu.Unlock()
+	return c.primeMaxSize <= 0 || size <= c.primeMaxSize
+}
+
+// primeRateAllowed counts a prime event for the resource's service name, and
+// returns true if the rate limit has not been exceeded within the current
+// window.
+func (c *Cache) primeRateAllowed(rname string) bool {
+	c.primeMu.Lock()
+	defer c.primeMu.Unlock()
+
+	if c.primeRateLimit <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	if c.primeCounts == nil || now.Sub(c.primeWindow) >= primeRateWindow {
+		c.primeCounts = make(map[string]int)
+		c.primeWindow = now
+	}
+
+	prefix := serviceName(rname)
+	n := c.primeCounts[prefix]
+	if n >= c.primeRateLimit {
+		return false
+	}
+	c.primeCounts[prefix] = n + 1
+	return true
+}
+
+// handlePrime sets the cached base resource to the primed data. If the
+// resource is already cached, the data is applied in the same way as on a
+// system reset, generating events for any differences. If a get request is
+// pending, the prime is ignored in favor of the get response.
+func (e *EventSubscription) handlePrime(r *codec.GetResult) {
+	rs := e.base
+	// A cached not found error is replaced by the primed data
+	if rs != nil && rs.state == stateNotFound {
+		rs.evictNotFound()
+		rs = e.base
+	}
+	if rs == nil {
+		rs = newResourceSubscription(e, "")
+		if r.Model != nil {
+			rs.model = rs.newModel(r.Model)
+			rs.state = stateModel
+		} else {
+			rs.collection = rs.newCollection(r.Collection, collectionTotal(r.Total))
+			rs.state = stateCollection
+		}
+		rs.setServiceVersion(r.Version)
+		rs.meta = r.Meta
+		e.base = rs
+		return
+	}
+
+	// Ignore base resources that are links to a query resource
+	if rs.query != "" {
+		return
+	}
+
+	switch rs.state {
+	case stateModel:
+		if r.Model == nil {
+			e.cache.Errorf("Error processing system prime for %s: mismatching resource type", e.ResourceName)
+			return
+		}
+		rs.processResetModel(r.Model)
+	case stateCollection:
+		if r.Collection == nil {
+			e.cache.Errorf("Error processing system prime for %s: mismatching resource type", e.ResourceName)
+			return
+		}
+		rs.processResetCollection(r.Collection)
+		rs.setCollectionTotal(collectionTotal(r.Total))
+	}
+	rs.setServiceVersion(r.Version)
+	rs.meta = r.Meta
+}
@@ -0,0 +1,71 @@
+package rescache
+
+import (
+	"time"
+
+	"github.com/jirenius/timerqueue"
+	"github.com/resgateio/resgate/server/codec"
+)
+
+// SetReadYourWrites sets the duration after a successful call request during
+// which the next subscription to the called resource makes a new get request,
+// instead of being served a cached resource that may not yet reflect the
+// changes of the call. Zero or less disables read-your-writes.
+// Should be called before Start.
+func (c *Cache) SetReadYourWrites(window time.Duration) {
+	c.readYourWritesWindow = window
+}
+
+// markWritten marks the resource as written to by a call request, resetting
+// the read-your-writes window if already marked.
+func (c *Cache) markWritten(rname string) {
+	if c.writtenQueue == nil {
+		return
+	}
+	c.writtenMu.Lock()
+	if !c.writtenQueue.Reset(rname) {
+		c.writtenQueue.Add(rname)
+	}
+	c.writtenMu.Unlock()
+}
+
+// consumeWritten removes the written mark of the resource.
+// Returns true if the resource was marked as written.
+func (c *Cache) consumeWritten(rname string) bool {
+	if c.writtenQueue == nil {
+		return false
+	}
+	c.writtenMu.Lock()
+	defer c.writtenMu.Unlock()
+	return c.writtenQueue.Remove(rname)
+}
+
+// newWrittenQueue returns a timer queue for written resources, or nil if
+// read-your-writes is disabled.
+func (c *Cache) newWrittenQueue() *timerqueue.Queue {
+	if c.readYourWritesWindow <= 0 {
+		return nil
+	}
+	return timerqueue.New(func(interface{}) {}, c.readYourWritesWindow)
+}
+
+// addFreshSubscriber makes a new get request for the resource, and adds the
+// subscriber once the response has updated the cached resource, with any
+// changes passed as events to existing subscribers.
+// Event subscription mutex is held when called.
+func (rs *ResourceSubscription) addFreshSubscriber(sub Subscriber, requestHeaders map[string][]string) {
+	e := rs.e
+	subj := "get." + e.ResourceName
+	payload := codec.CreateGetRequest(rs.query)
+	e.cache.sendRetriedRequest(subj, payload, func(_ string, data []byte, _ map[string][]string, err error) {
+		e.Enqueue(func() {
+			// Skip if the resource was deleted while waiting for the response.
+			if rs.subs != nil {
+				rs.processResetGetResponse(data, err)
+			}
+			// The response may have deleted the resource, so we get the
+			// current resource subscription.
+			e.loadSubscriber(e.getResourceSubscription(sub.ResourceQuery()), sub, nil, requestHeaders)
+		})
+	}, requestHeaders)
+}
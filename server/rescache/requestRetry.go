@@ -0,0 +1,73 @@
+package rescache
+
+import (
+	"strings"
+	"time"
+
+	"github.com/resgateio/resgate/metrics"
+	"github.com/resgateio/resgate/server/mq"
+)
+
+// requestRetry is the retry policy for get and access requests that time out.
+type requestRetry struct {
+	attempts int
+	backoff  time.Duration
+	deadline time.Duration
+}
+
+// WithRequestRetry sets the number of times a get or access request is
+// retried if it times out, before the timeout error is passed on to the
+// subscribers. The first retry waits for backoff, with the wait doubled for
+// each following retry. A retry is not sent if the time since the first
+// request, including the wait, would exceed deadline. A zero deadline means
+// no deadline. Call and auth requests are never retried, as they are not
+// idempotent.
+//
+// Must be called before starting the cache.
+func (c *Cache) WithRequestRetry(attempts int, backoff, deadline time.Duration) *Cache {
+	c.retry = requestRetry{
+		attempts: attempts,
+		backoff:  backoff,
+		deadline: deadline,
+	}
+	return c
+}
+
+// sendRetriedRequest sends a get or access request, retrying it if it times
+// out, as set by WithRequestRetry. The callback is only called once, with the
+// response of the last attempt.
+func (c *Cache) sendRetriedRequest(subj string, payload []byte, cb mq.Response, requestHeaders map[string][]string) {
+	if c.retry.attempts <= 0 {
+		c.mq.SendRequest(subj, payload, cb, requestHeaders)
+		return
+	}
+	c.sendAttempt(subj, payload, cb, requestHeaders, time.Now(), 0)
+}
+
+func (c *Cache) sendAttempt(subj string, payload []byte, cb mq.Response, requestHeaders map[string][]string, start time.Time, attempt int) {
+	c.mq.SendRequest(subj, payload, func(rsubj string, data []byte, responseHeaders map[string][]string, err error) {
+		if err != mq.ErrRequestTimeout || attempt >= c.retry.attempts {
+			cb(rsubj, data, responseHeaders, err)
+			return
+		}
+		wait := c.retry.backoff << uint(attempt)
+		if c.retry.deadline > 0 && time.Since(start)+wait > c.retry.deadline {
+			c.Debugf("Request %s timed out with no time left for a retry", subj)
+			cb(rsubj, data, responseHeaders, err)
+			return
+		}
+		c.Debugf("Request %s timed out, retrying in %s (%d/%d)", subj, wait, attempt+1, c.retry.attempts)
+		metrics.NATSRequestRetries.WithLabelValues(subjectPrefix(subj)).Inc()
+		time.AfterFunc(wait, func() {
+			c.sendAttempt(subj, payload, cb, requestHeaders, start, attempt+1)
+		})
+	}, requestHeaders)
+}
+
+// subjectPrefix returns the first token of a subject, such as get or access.
+func subjectPrefix(subj string) string {
+	if idx := strings.IndexByte(subj, '.'); idx >= 0 {
+		return subj[:idx]
+	}
+	return subj
+}
@@ -17,12 +17,17 @@ import (
 
 // Cache is an in memory resource cache.
 type Cache struct {
-	mq               mq.Client
-	logger           logger.Logger
-	workers          int
-	resetThrottle    int
-	unsubscribeDelay time.Duration
-	conns            map[string]Conn
+	// Atomically updated. Kept first for 64-bit alignment.
+	retention retentionCounters
+
+	mq                 mq.Client
+	logger             logger.Logger
+	workers            int
+	resetThrottle      int
+	unsubscribeDelay   time.Duration
+	negativeCacheTTL   time.Duration
+	typeMismatchAction TypeMismatchAction
+	conns              map[string]Conn
 
 	mu         sync.Mutex
 	started    bool
@@ -30,6 +35,72 @@ type Cache struct {
 	inCh       chan *EventSubscription
 	unsubQueue *timerqueue.Queue
 	resetSub   mq.Unsubscriber
+	stopCh     chan struct{}
+
+	// Prime event limits
+	primeMu        sync.Mutex
+	primeMaxSize   int
+	primeRateLimit int
+	primeWindow    time.Time
+	primeCounts    map[string]int
+
+	// Unshared resource patterns, protected by mu
+	unsharedPatterns []ResourcePattern
+
+	// Event rate limits, protected by mu
+	eventRateLimit  int
+	eventRateLimits []eventRateLimitPattern // Ordered by pattern length, longest first
+
+	// Background refresh intervals, protected by mu
+	backgroundRefreshes []backgroundRefreshPattern // Ordered by pattern length, longest first
+
+	// Flag to stamp events with the time received, set before start
+	timestampEvents bool
+
+	// Flag to publish system subscribe and unsubscribe messages, set before
+	// start
+	systemEvents bool
+
+	// System subscribe and unsubscribe messages waiting to be published,
+	// protected by sysEventsMu
+	sysEventsMu sync.Mutex
+	sysEvents   []systemEvent
+	sysEventsCh chan struct{}
+
+	// Retry policy for get and access requests timing out, set before start
+	retry requestRetry
+
+	// Resource groups with pending events, protected by groupsMu
+	groupsMu sync.Mutex
+	groups   map[string]*resourceGroup
+
+	// Resource size limits, set before start. Zero means no limit.
+	maxModelFields    int
+	maxCollectionSize int
+
+	// Read-your-writes, with the queue protected by writtenMu
+	readYourWritesWindow time.Duration
+	writtenMu            sync.Mutex
+	writtenQueue         *timerqueue.Queue
+
+	// Shared access cache, protected by accessMu
+	accessMu       sync.Mutex
+	accessCacheTTL time.Duration
+	accessEntries  map[accessKey]*accessEntry
+	accessByRID    map[string]map[*accessEntry]struct{}
+	accessByToken  map[string]map[*accessEntry]struct{}
+
+	// Access batching, protected by accessBatchMu
+	accessBatchMu       sync.Mutex
+	accessBatchWindow   time.Duration
+	accessBatchServices map[string]bool
+	accessBatches       map[accessBatchKey]*accessBatch
+
+	// Access policies, ordered by pattern length, longest first
+	accessPolicies []accessPolicyPattern
+
+	// Flag to pass on trace context headers of events
+	traceContext bool
 
 	// Deprecated behavior logging
 	depMutex  sync.Mutex
@@ -39,6 +110,7 @@ type Cache struct {
 // Subscriber interface represents a subscription made on a client connection
 type Subscriber interface {
 	CID() string
+	RequestID() string
 	Loaded(resourceSub *ResourceSubscription, responseHeaders map[string][]string, err error)
 	Event(event *ResourceEvent)
 	ResourceName() string
@@ -50,20 +122,31 @@ type Subscriber interface {
 type Conn interface {
 	CID() string
 	TokenReset(tids map[string]bool, subject string)
+	TokenRevoke(tids map[string]bool)
+	TokenExpired(tids map[string]bool)
 }
 
 // ResourceEvent represents an event on a resource
 type ResourceEvent struct {
-	Event     string
-	Payload   json.RawMessage
-	Idx       int
-	Value     codec.Value
-	Changed   map[string]codec.Value
+	Event   string
+	Payload json.RawMessage
+	Idx     int
+	Value   codec.Value
+	Changed map[string]codec.Value
+	// OldValues holds the old values of changed properties, but only those
+	// that are resource references.
 	OldValues map[string]codec.Value
 	// Version is the targeted internal version of the resource
 	Version uint
 	// Update flags if the event causes a version bump. Set by eg. add/remove/change.
 	Update bool
+	// Reason is set on a delete event generated by the cache, to unsubscribe
+	// direct subscribers with the reason instead of sending a delete event.
+	Reason *reserr.Error
+	// Timestamp is the time of a change, add, or remove event, as set by
+	// the service, or by the cache if timestamp events are enabled. It is
+	// the zero time if not set.
+	Timestamp time.Time
 }
 
 // NewCache creates a new Cache instance
@@ -75,6 +158,9 @@ func NewCache(mq mq.Client, workers int, resetThrottle int, unsubscribeDelay tim
 		resetThrottle:    resetThrottle,
 		unsubscribeDelay: unsubscribeDelay,
 		conns:            make(map[string]Conn),
+		accessEntries:    make(map[accessKey]*accessEntry),
+		accessByRID:      make(map[string]map[*accessEntry]struct{}),
+		accessByToken:    make(map[string]map[*accessEntry]struct{}),
 		depLogged:        make(map[string]featureType),
 	}
 }
@@ -93,10 +179,12 @@ func (c *Cache) Start() error {
 	inCh := make(chan *EventSubscription, 100)
 	c.eventSubs = make(map[string]*EventSubscription)
 	c.unsubQueue = timerqueue.New(c.mqUnsubscribe, c.unsubscribeDelay)
+	c.writtenQueue = c.newWrittenQueue()
 	c.inCh = inCh
+	c.stopCh = make(chan struct{})
 
 	for i := 0; i < c.workers; i++ {
-		go c.startWorker(inCh)
+		go c.startWorker(inCh, c.stopCh)
 	}
 
 	resetSub, err := c.mq.Subscribe("system", func(subj string, payload []byte, responseHeaders map[string][]string, _ error) {
@@ -106,6 +194,12 @@ func (c *Cache) Start() error {
 			c.handleSystemReset(payload)
 		case "tokenReset":
 			c.handleSystemTokenReset(payload)
+		case "tokenRevoke":
+			c.handleSystemTokenIDs("token revoke", payload, Conn.TokenRevoke)
+		case "tokenExpired":
+			c.handleSystemTokenIDs("token expired", payload, Conn.TokenExpired)
+		case "prime":
+			c.handleSystemPrime(payload)
 		}
 
 	})
@@ -116,6 +210,8 @@ func (c *Cache) Start() error {
 
 	c.resetSub = resetSub
 	c.started = true
+	go c.logRetention(c.stopCh)
+	c.startSystemEvents()
 	return nil
 }
 
@@ -129,6 +225,13 @@ func (c *Cache) Errorf(format string, v ...interface{}) {
 	c.logger.Error(fmt.Sprintf(format, v...))
 }
 
+// Debugf writes a formatted debug message
+func (c *Cache) Debugf(format string, v ...interface{}) {
+	if c.logger.IsDebug() {
+		c.logger.Debug(fmt.Sprintf(format, v...))
+	}
+}
+
 // Subscribe fetches a resource from the cache, and if it is
 // not cached, starts subscribing to the resource and sends a get request
 func (c *Cache) Subscribe(sub Subscriber, t *Throttle, requestHeaders map[string][]string) {
@@ -141,81 +244,127 @@ func (c *Cache) Subscribe(sub Subscriber, t *Throttle, requestHeaders map[string
 	eventSub.addSubscriber(sub, t, requestHeaders)
 }
 
-// Access sends an access request
-func (c *Cache) Access(sub Subscriber, token interface{}, callback func(access *Access)) {
+// Access sends an access request with the request headers, unless an access
+// policy applies to the resource.
+func (c *Cache) Access(sub Subscriber, token interface{}, requestHeaders map[string][]string, callback func(access *Access)) {
 	rname := sub.ResourceName()
+	if a := c.policyAccess(rname, sub.ResourceQuery(), token); a != nil {
+		callback(&Access{AccessResult: a})
+		return
+	}
+	if c.accessCacheTTL > 0 {
+		if th, ok := tokenHash(token); ok {
+			key := accessKey{rname: rname, query: sub.ResourceQuery(), token: th}
+			ae := c.cachedAccess(key, callback)
+			if ae == nil {
+				return
+			}
+			callback = func(access *Access) { c.storeAccess(ae, access) }
+		}
+	}
 	payload := codec.CreateRequest(nil, sub, sub.ResourceQuery(), token)
 	subj := "access." + rname
-	c.sendRequest(rname, subj, payload, func(data []byte, err error) {
+	cb := func(data []byte, err error) {
 		if err != nil {
 			callback(&Access{Error: reserr.RESError(err)})
 			return
 		}
 
 		access, rerr := codec.DecodeAccessResponse(data)
+		if access != nil && access.Batch {
+			c.setAccessBatchSupport(rname, true)
+		}
 		callback(&Access{AccessResult: access, Error: rerr})
-	}, nil)
+	}
+	if c.batchAccess(sub, token, subj, payload, cb, requestHeaders) {
+		return
+	}
+	c.sendRequest(rname, subj, payload, cb, requestHeaders, true)
 }
 
 // Call sends a method call request
-func (c *Cache) Call(req codec.Requester, rname, query, action string, token, params interface{}, callback func(result json.RawMessage, rid string, err error)) {
+func (c *Cache) Call(req codec.Requester, rname, query, action string, token, params interface{}, callback func(result json.RawMessage, rid string, meta *codec.Meta, err error)) {
+	if c.readYourWritesWindow > 0 {
+		cb := callback
+		callback = func(result json.RawMessage, rid string, meta *codec.Meta, err error) {
+			if err == nil {
+				c.markWritten(rname)
+			}
+			cb(result, rid, meta, err)
+		}
+	}
 	payload := codec.CreateRequest(params, req, query, token)
 	subj := "call." + rname + "." + action
 	c.sendRequest(rname, subj, payload, func(data []byte, err error) {
 		if err != nil {
-			callback(nil, "", err)
+			callback(nil, "", nil, err)
 			return
 		}
 
 		// [DEPRECATED:deprecatedNewCallRequest]
 		if action == "new" {
-			result, rid, err := codec.DecodeCallResponse(data)
+			result, rid, meta, err := codec.DecodeCallResponse(data)
 			if err == nil && rid == "" {
 				rid, err = codec.TryDecodeLegacyNewResult(result)
 				if err != nil || rid != "" {
 					c.deprecated(rname, deprecatedNewCallRequest)
-					callback(nil, rid, err)
+					callback(nil, rid, meta, err)
 					return
 				}
 			}
-			callback(result, rid, err)
+			callback(result, rid, meta, err)
 			return
 		}
 
 		callback(codec.DecodeCallResponse(data))
-	}, nil)
+	}, requestHeaders(req), false)
 }
 
 // Auth sends an auth method call
-func (c *Cache) Auth(req codec.AuthRequester, rname, query, action string, token, params interface{}, callback func(result json.RawMessage, rid string, err error)) {
+func (c *Cache) Auth(req codec.AuthRequester, rname, query, action string, token, params interface{}, callback func(result json.RawMessage, rid string, meta *codec.Meta, err error)) {
 	payload := codec.CreateAuthRequest(params, req, query, token)
 	subj := "auth." + rname + "." + action
 	c.sendRequest(rname, subj, payload, func(data []byte, err error) {
 		if err != nil {
-			callback(nil, "", err)
+			callback(nil, "", nil, err)
 			return
 		}
 
 		callback(codec.DecodeCallResponse(data))
-	}, nil)
+	}, requestHeaders(req), false)
 }
 
 // CustomAuth sends an auth method call to a custom subject
-func (c *Cache) CustomAuth(req codec.AuthRequester, subj, query string, token, params interface{}, callback func(result json.RawMessage, rid string, err error)) {
+func (c *Cache) CustomAuth(req codec.AuthRequester, subj, query string, token, params interface{}, callback func(result json.RawMessage, rid string, meta *codec.Meta, err error)) {
 	payload := codec.CreateAuthRequest(params, req, query, token)
 	c.mq.SendRequest(subj, payload, func(_ string, data []byte, responseHeaders map[string][]string, err error) {
 		if err != nil {
-			callback(nil, "", err)
+			callback(nil, "", nil, err)
 			return
 		}
 
 		callback(codec.DecodeCallResponse(data))
-	}, nil)
+	}, requestHeaders(req))
 }
 
-func (c *Cache) sendRequest(rname, subj string, payload []byte, cb func(data []byte, err error), requestHeaders map[string][]string) {
+// requestHeaders returns the headers to set on requests sent on behalf of
+// req, or nil if req is not a codec.HeaderRequester.
+func requestHeaders(req interface{}) map[string][]string {
+	if hr, ok := req.(codec.HeaderRequester); ok {
+		return hr.RequestHeaders()
+	}
+	return nil
+}
+
+// sendRequest sends a request on behalf of the resource. If retry is true,
+// the request is retried if it times out, and must be idempotent.
+func (c *Cache) sendRequest(rname, subj string, payload []byte, cb func(data []byte, err error), requestHeaders map[string][]string, retry bool) {
 	eventSub, _ := c.getSubscription(rname, false)
-	c.mq.SendRequest(subj, payload, func(_ string, data []byte, responseHeaders map[string][]string, err error) {
+	send := c.mq.SendRequest
+	if retry {
+		send = c.sendRetriedRequest
+	}
+	send(subj, payload, func(_ string, data []byte, responseHeaders map[string][]string, err error) {
 		eventSub.Enqueue(func() {
 			cb(data, err)
 			eventSub.removeCount(1)
@@ -242,6 +391,58 @@ func (c *Cache) RemoveConn(conn Conn) {
 	metrics.WSStablishedConnections.Set(float64(len(c.conns)))
 }
 
+// Stats contains statistics on the content of the cache.
+type Stats struct {
+	// Resources is the number of cached resources, including query resources
+	// and resources retained by the unsubscribe delay.
+	Resources int
+	// Subscriptions is the number of subscribers to the cached resources.
+	Subscriptions int
+	// Conns is the number of connections listening to events.
+	Conns int
+}
+
+// Stats returns statistics on the content of the cache.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st := Stats{Conns: len(c.conns)}
+	for _, eventSub := range c.eventSubs {
+		eventSub.mu.Lock()
+		if eventSub.base != nil {
+			st.Resources++
+			st.Subscriptions += len(eventSub.base.subs)
+		}
+		for _, rs := range eventSub.queries {
+			st.Resources++
+			st.Subscriptions += len(rs.subs)
+		}
+		eventSub.mu.Unlock()
+	}
+	return st
+}
+
+// Version returns the resource version set by the service for a cached
+// resource, or zero if the resource is not cached, or has no valid version.
+// The cached version may lag behind the version held by the service.
+func (c *Cache) Version(rname, query string) uint64 {
+	c.mu.Lock()
+	eventSub := c.eventSubs[rname]
+	c.mu.Unlock()
+	if eventSub == nil {
+		return 0
+	}
+
+	eventSub.mu.Lock()
+	defer eventSub.mu.Unlock()
+	rs := eventSub.resource(query)
+	if rs == nil || rs.state <= stateRequested {
+		return 0
+	}
+	return rs.versionAt(rs.version)
+}
+
 // getSubscription returns the existing eventSubscription after adding its count, or creates a new
 // subscription with count of 1. If the subscribe flag is true, a mq subscription is also made.
 func (c *Cache) getSubscription(name string, subscribe bool) (*EventSubscription, error) {
@@ -254,8 +455,11 @@ func (c *Cache) getSubscription(name string, subscribe bool) (*EventSubscription
 			ResourceName: name,
 			cache:        c,
 			count:        1,
+			limiter:      c.newEventLimiter(name),
+			unshared:     c.isUnshared(name),
 		}
 		metrics.SubcriptionsCount.WithLabelValues(metrics.SanitizedString(name)).Inc()
+		eventSub.startRefresh(c.backgroundRefreshInterval(name))
 
 		c.eventSubs[name] = eventSub
 	} else {
@@ -264,7 +468,7 @@ func (c *Cache) getSubscription(name string, subscribe bool) (*EventSubscription
 
 	if subscribe && eventSub.mqSub == nil {
 		mqSub, err := c.mq.Subscribe("event."+name, func(subj string, payload []byte, responseHeaders map[string][]string, _ error) {
-			eventSub.enqueueEvent(subj, payload)
+			eventSub.enqueueEvent(subj, payload, c.eventTraceHeaders(responseHeaders))
 		})
 		if err != nil {
 			return nil, err
@@ -276,26 +480,46 @@ func (c *Cache) getSubscription(name string, subscribe bool) (*EventSubscription
 	return eventSub, nil
 }
 
-// Stop closes the worker channel, stops all the workers,  and clears
-// the unsubscribe queue
+// Stop stops all the workers, and clears the unsubscribe queue. The worker
+// channel is not closed, as callbacks may still be enqueued by subscriptions
+// being loaded or unsubscribed.
 func (c *Cache) Stop() {
 	if !c.started {
 		return
 	}
-	close(c.inCh)
+	close(c.stopCh)
 	c.unsubQueue.Clear()
+	if c.writtenQueue != nil {
+		c.writtenQueue.Clear()
+	}
+	metrics.CacheRetentionPendingTimers.Set(0)
 	c.resetSub = nil
 	c.started = false
 }
 
-func (c *Cache) startWorker(ch chan *EventSubscription) {
-	for eventSub := range ch {
-		eventSub.processQueue()
+func (c *Cache) startWorker(ch chan *EventSubscription, stop chan struct{}) {
+	for {
+		select {
+		case eventSub := <-ch:
+			eventSub.processQueue()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// work passes the event subscription to a worker, unless the cache is
+// stopped.
+func (c *Cache) work(eventSub *EventSubscription) {
+	select {
+	case c.inCh <- eventSub:
+	case <-c.stopCh:
 	}
 }
 
 func (c *Cache) mqUnsubscribe(v interface{}) {
 	eventSub := v.(*EventSubscription)
+	metrics.CacheRetentionPendingTimers.Set(float64(c.unsubQueue.Len()))
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -303,7 +527,10 @@ func (c *Cache) mqUnsubscribe(v interface{}) {
 		return
 	}
 
-	delete(c.eventSubs, eventSub.ResourceName)
+	eventSub.stopRefresh()
+	if c.eventSubs[eventSub.ResourceName] == eventSub {
+		delete(c.eventSubs, eventSub.ResourceName)
+	}
 }
 
 func (c *Cache) handleSystemReset(payload []byte) {
@@ -313,6 +540,21 @@ func (c *Cache) handleSystemReset(payload []byte) {
 		return
 	}
 
+	c.reset(r.Resources, r.Access)
+}
+
+// Resync resets all cached resources and access, in the same way as a
+// system.reset event matching all resources. It is used to resynchronize the
+// cache after reconnecting to the messaging system, as events may have been
+// missed while disconnected.
+func (c *Cache) Resync() {
+	c.reset([]string{">"}, []string{">"})
+}
+
+// reset resets the resources and access matching the resource patterns,
+// sending new get requests and access requests, throttled by the reset
+// throttle.
+func (c *Cache) reset(resources []string, access []string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -321,10 +563,11 @@ func (c *Cache) handleSystemReset(payload []byte) {
 		t = NewThrottle(c.resetThrottle)
 	}
 
-	c.forEachMatch(r.Resources, func(e *EventSubscription) {
+	c.forEachMatch(resources, func(e *EventSubscription) {
 		e.handleResetResource(t)
 	})
-	c.forEachMatch(r.Access, func(e *EventSubscription) {
+	c.invalidateAccessMatch(access)
+	c.forEachMatch(access, func(e *EventSubscription) {
 		e.handleResetAccess(t)
 	})
 }
@@ -383,3 +626,36 @@ func (c *Cache) handleSystemTokenReset(payload []byte) {
 		sub.TokenReset(m, r.Subject)
 	}
 }
+
+// handleSystemTokenIDs decodes a system token revoke or token expired event,
+// and calls cb for each connection with the set of token IDs.
+//
+// Each connection matches the token IDs against its own token ID (tid), in
+// its own task queue, after any previously received token event. This is
+// preferred over an index from token ID, or token hash, to connections, as
+// the index would have to be kept in sync with token events queued on the
+// connections.
+func (c *Cache) handleSystemTokenIDs(event string, payload []byte, cb func(conn Conn, tids map[string]bool)) {
+	r, err := codec.DecodeSystemTokenIDs(payload)
+	if err != nil {
+		c.Errorf("Error decoding system %s: %s", event, err)
+		return
+	}
+
+	// Quick exit if no token IDs are available.
+	if len(r.TIDs) == 0 {
+		return
+	}
+
+	m := make(map[string]bool, len(r.TIDs))
+	for _, tid := range r.TIDs {
+		m[tid] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, conn := range c.conns {
+		cb(conn, m)
+	}
+}
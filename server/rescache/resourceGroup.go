@@ -0,0 +1,105 @@
+package rescache
+
+// resourceGroup serializes the events of resources in the same group, as set
+// by the group field of get responses. Events are dispatched to the event
+// subscription of their resource one at a time, in the order they arrived,
+// with the next event dispatched only once the previous one is handled.
+type resourceGroup struct {
+	queue []*groupEvent // Pending events, the first one being handled
+}
+
+type groupEvent struct {
+	e *EventSubscription
+	f func()
+}
+
+// setGroup sets the group of the resource.
+// Event subscription mutex is held when called.
+func (e *EventSubscription) setGroup(group string) {
+	e.group = group
+}
+
+// enqueueGroupEvent enqueues the event handler, f, to be dispatched to the
+// event subscription once all previous events of the group are handled.
+func (c *Cache) enqueueGroupEvent(group string, e *EventSubscription, f func()) {
+	c.groupsMu.Lock()
+	g, ok := c.groups[group]
+	if !ok {
+		g = &resourceGroup{}
+		if c.groups == nil {
+			c.groups = make(map[string]*resourceGroup)
+		}
+		c.groups[group] = g
+	}
+	ge := &groupEvent{e: e, f: f}
+	g.queue = append(g.queue, ge)
+	first := len(g.queue) == 1
+	c.groupsMu.Unlock()
+
+	if first {
+		c.dispatchGroupEvent(group, g, ge)
+	}
+}
+
+// dispatchGroupEvent enqueues the event handler on its event subscription,
+// and dispatches the next event of the group once handled. The handler is
+// skipped if the event has been dropped from the group.
+func (c *Cache) dispatchGroupEvent(group string, g *resourceGroup, ge *groupEvent) {
+	ge.e.Enqueue(func() {
+		c.groupsMu.Lock()
+		dropped := len(g.queue) == 0 || g.queue[0] != ge
+		c.groupsMu.Unlock()
+		if dropped {
+			return
+		}
+
+		ge.f()
+
+		c.groupsMu.Lock()
+		next := c.nextGroupEvent(group, g)
+		c.groupsMu.Unlock()
+		if next != nil {
+			// The next event may be on the same event subscription, whose
+			// mutex is held while handling the event.
+			go c.dispatchGroupEvent(group, g, next)
+		}
+	})
+}
+
+// nextGroupEvent removes the first event of the group, and returns the next
+// event to dispatch, or nil if there is none. The group is removed when it
+// has no pending events.
+// Cache.groupsMu is held when called.
+func (c *Cache) nextGroupEvent(group string, g *resourceGroup) *groupEvent {
+	g.queue = g.queue[1:]
+	if len(g.queue) == 0 {
+		delete(c.groups, group)
+		return nil
+	}
+	return g.queue[0]
+}
+
+// dropGroupEvents removes all pending group events of the event
+// subscription, whose queue has been cleared. If the first event of a group
+// is dropped, the next event of the group is dispatched, as the dropped
+// handler will never advance the group.
+func (c *Cache) dropGroupEvents(e *EventSubscription) {
+	c.groupsMu.Lock()
+	defer c.groupsMu.Unlock()
+	for group, g := range c.groups {
+		first := g.queue[0]
+		queue := g.queue[:1]
+		for _, ge := range g.queue[1:] {
+			if ge.e != e {
+				queue = append(queue, ge)
+			}
+		}
+		g.queue = queue
+		if first.e == e {
+			if next := c.nextGroupEvent(group, g); next != nil {
+				// The event subscription mutex is held.
+				go c.dispatchGroupEvent(group, g, next)
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package rescache_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server/rescache"
+)
+
+// groupGetResponse returns a get response with a model, in the same group
+// for order resources.
+func groupGetResponse(subj string) string {
+	if !strings.HasPrefix(subj, "get.order.") {
+		return `{"result":{"model":{"n":0}}}`
+	}
+	return `{"result":{"model":{"n":0},"group":"order.1"}}`
+}
+
+// Test that events on resources in the same group are handled one at a time,
+// in the order they arrived, even if handled by different workers.
+func TestResourceGroup_EventsOnGroupedResources_HandledInArrivalOrder(t *testing.T) {
+	m := newTestMQFunc(groupGetResponse)
+	c := startCache(t, m, 4, testUnsubscribeDelay)
+	defer c.Stop()
+
+	log := &eventLog{}
+	for _, sub := range []*testSubscriber{
+		newLogSubscriber("order.1", 50*time.Millisecond, log),
+		newLogSubscriber("order.1.items", 0, log),
+	} {
+		c.Subscribe(sub, nil, nil)
+		select {
+		case <-sub.loaded:
+		case <-time.After(time.Second):
+			t.Fatal("expected resource to be loaded, but timed out")
+		}
+	}
+
+	m.publish("order.1", "change", []byte(`{"values":{"n":1}}`))
+	m.publish("order.1.items", "change", []byte(`{"values":{"n":1}}`))
+	m.publish("order.1", "change", []byte(`{"values":{"n":2}}`))
+
+	expected := []string{"order.1", "order.1.items", "order.1"}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		log.mu.Lock()
+		names := append([]string(nil), log.names...)
+		log.mu.Unlock()
+		if len(names) == len(expected) {
+			for i, name := range names {
+				if name != expected[i] {
+					t.Fatalf("expected events in order %v, but got %v", expected, names)
+				}
+			}
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("expected %d events, but timed out", len(expected))
+}
+
+// Test that an event queued on a grouped resource, when the resource is
+// unsubscribed from the messaging system, does not block later events of the
+// group.
+func TestResourceGroup_UnsubscribeWithQueuedEvent_NextEventHandled(t *testing.T) {
+	m := newTestMQFunc(groupGetResponse)
+	c := startCache(t, m, 1, 20*time.Millisecond)
+	defer c.Stop()
+
+	log := &eventLog{}
+	subs := []*testSubscriber{
+		newLogSubscriber("slow.model", 200*time.Millisecond, log),
+		newLogSubscriber("order.1", 0, log),
+		newLogSubscriber("order.1.items", 0, log),
+	}
+	var items *rescache.ResourceSubscription
+	for _, sub := range subs {
+		c.Subscribe(sub, nil, nil)
+		select {
+		case items = <-sub.loaded:
+		case <-time.After(time.Second):
+			t.Fatal("expected resource to be loaded, but timed out")
+		}
+	}
+	items.Unsubscribe(subs[2])
+	deadline := time.Now().Add(time.Second)
+	for c.Stats().Subscriptions != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected items to be unsubscribed, but timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Keep the single worker busy while the items event is queued, until
+	// the items resource is unsubscribed after the unsubscribe delay.
+	m.publish("slow.model", "change", []byte(`{"values":{"n":1}}`))
+	m.publish("order.1.items", "change", []byte(`{"values":{"n":1}}`))
+	m.assertUnsubscribed(t, "order.1.items")
+
+	m.publish("order.1", "change", []byte(`{"values":{"n":1}}`))
+	deadline = time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		log.mu.Lock()
+		names := append([]string(nil), log.names...)
+		log.mu.Unlock()
+		if len(names) > 0 && names[len(names)-1] == "order.1" {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("expected order.1 event to be handled, but timed out")
+}
@@ -0,0 +1,50 @@
+package rescache
+
+import (
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// WithMaxModelFields sets the maximum number of fields of a model in a get
+// response. A larger model is not cached, and its subscribers get a
+// system.resourceTooLarge error. Zero means no limit.
+//
+// Must be called before starting the cache.
+func (c *Cache) WithMaxModelFields(n int) *Cache {
+	c.maxModelFields = n
+	return c
+}
+
+// WithMaxCollectionSize sets the maximum number of values of a collection in
+// a get response. A larger collection is not cached, and its subscribers get
+// a system.resourceTooLarge error. Zero means no limit.
+//
+// Must be called before starting the cache.
+func (c *Cache) WithMaxCollectionSize(n int) *Cache {
+	c.maxCollectionSize = n
+	return c
+}
+
+// checkResourceSize returns a system.resourceTooLarge error if the resource
+// of the get result exceeds the size limits, with the size and the limit as
+// error data. The error is logged with the resource name.
+func (e *EventSubscription) checkResourceSize(result *codec.GetResult) error {
+	var size, limit int
+	if result.Model != nil {
+		size, limit = len(result.Model), e.cache.maxModelFields
+	} else {
+		size, limit = len(result.Collection), e.cache.maxCollectionSize
+	}
+	if limit <= 0 || size <= limit {
+		return nil
+	}
+	e.cache.Errorf("Resource %s too large: %d values exceeds limit of %d", e.ResourceName, size, limit)
+	return &reserr.Error{
+		Code:    reserr.CodeResourceTooLarge,
+		Message: reserr.ErrResourceTooLarge.Message,
+		Data: map[string]interface{}{
+			"size":  size,
+			"limit": limit,
+		},
+	}
+}
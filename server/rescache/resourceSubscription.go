@@ -2,7 +2,7 @@ package rescache
 
 import (
 	"encoding/json"
-	"errors"
+	"time"
 
 	"github.com/resgateio/resgate/server/codec"
 	"github.com/resgateio/resgate/server/reserr"
@@ -13,6 +13,7 @@ type subscriptionState byte
 const (
 	stateSubscribed subscriptionState = iota
 	stateError
+	stateNotFound
 	stateRequested
 	stateCollection
 	stateModel
@@ -21,16 +22,18 @@ const (
 // Model represents a RES model
 // https://github.com/resgateio/resgate/blob/master/docs/res-protocol.md#models
 type Model struct {
-	Values map[string]codec.Value
-	data   []byte
+	Values   map[string]codec.Value
+	data     []byte
+	size     int64 // Estimated JSON encoded length
+	unshared bool  // True if the JSON encoding should not be kept
 }
 
 // MarshalJSON creates a JSON encoded representation of the model
 func (m *Model) MarshalJSON() ([]byte, error) {
 	if m.data == nil {
 		data, err := json.Marshal(m.Values)
-		if err != nil {
-			return nil, err
+		if err != nil || m.unshared {
+			return data, err
 		}
 		m.data = data
 	}
@@ -41,15 +44,20 @@ func (m *Model) MarshalJSON() ([]byte, error) {
 // https://github.com/resgateio/resgate/blob/master/docs/res-protocol.md#collections
 type Collection struct {
 	Values []codec.Value
-	data   []byte
+	// Total is the total count of the full collection, as set by the
+	// service when the values hold a single page, or -1 if not set.
+	Total    int64
+	data     []byte
+	size     int64 // Estimated JSON encoded length
+	unshared bool  // True if the JSON encoding should not be kept
 }
 
 // MarshalJSON creates a JSON encoded representation of the collection
 func (c *Collection) MarshalJSON() ([]byte, error) {
 	if c.data == nil {
 		data, err := json.Marshal(c.Values)
-		if err != nil {
-			return nil, err
+		if err != nil || c.unshared {
+			return data, err
 		}
 		c.data = data
 	}
@@ -67,6 +75,19 @@ type ResourceSubscription struct {
 	// version is the internal resource version, starting with 0 and bumped +1
 	// for each modifying event.
 	version uint
+	// serviceVersion is the resource version set by the service, valid only
+	// while the internal version equals serviceVersionAt. Zero means no
+	// version.
+	serviceVersion   uint64
+	serviceVersionAt uint
+	// meta is the metadata set by the service in the last get response, or
+	// nil if no metadata was set.
+	meta map[string]json.RawMessage
+	// modified is the time when the resource was loaded, or last modified by
+	// an event.
+	modified time.Time
+	// notFoundTimer evicts a cached system.notFound error on expiry.
+	notFoundTimer *time.Timer
 	// Three types of values stored
 	model      *Model
 	collection *Collection
@@ -110,11 +131,122 @@ func (rs *ResourceSubscription) GetModel() (*Model, uint) {
 	return rs.model, rs.version
 }
 
+// Version returns the resource version set by the service in the last get
+// response, or zero if no version was set or if the resource has been modified
+// by events since.
+func (rs *ResourceSubscription) Version() uint64 {
+	rs.e.mu.Lock()
+	defer rs.e.mu.Unlock()
+	return rs.versionAt(rs.version)
+}
+
+// VersionAt returns the resource version set by the service, or zero if the
+// version is not valid for the given internal version as returned by GetModel
+// or GetCollection.
+func (rs *ResourceSubscription) VersionAt(version uint) uint64 {
+	rs.e.mu.Lock()
+	defer rs.e.mu.Unlock()
+	return rs.versionAt(version)
+}
+
+func (rs *ResourceSubscription) versionAt(version uint) uint64 {
+	if rs.serviceVersionAt != version {
+		return 0
+	}
+	return rs.serviceVersion
+}
+
+// Meta returns the metadata set by the service in the last get response, or
+// nil if no metadata was set. The returned map must not be modified.
+func (rs *ResourceSubscription) Meta() map[string]json.RawMessage {
+	rs.e.mu.Lock()
+	defer rs.e.mu.Unlock()
+	return rs.meta
+}
+
+// LastModified returns the time when the resource was loaded, or last
+// modified by an event.
+func (rs *ResourceSubscription) LastModified() time.Time {
+	rs.e.mu.Lock()
+	defer rs.e.mu.Unlock()
+	return rs.modified
+}
+
+// modify bumps the internal resource version, and sets the time of
+// modification.
+func (rs *ResourceSubscription) modify() {
+	rs.version++
+	rs.modified = time.Now()
+}
+
+// setCollectionTotal sets the total count of the collection, replacing the
+// collection as it might have been passed to a Subscriber and should be
+// considered immutable.
+func (rs *ResourceSubscription) setCollectionTotal(total int64) {
+	if total != rs.collection.Total {
+		rs.collection = rs.newCollection(rs.collection.Values, total)
+	}
+}
+
+// collectionTotal returns the total count of a collection get result, or -1 if
+// not set.
+func collectionTotal(total *int64) int64 {
+	if total == nil {
+		return -1
+	}
+	return *total
+}
+
+// setServiceVersion sets the resource version set by the service, valid for
+// the current internal version.
+func (rs *ResourceSubscription) setServiceVersion(version uint64) {
+	rs.serviceVersion = version
+	rs.serviceVersionAt = rs.version
+}
+
+// size returns an estimate of the memory in bytes held by the cached resource,
+// based on its JSON encoded length as estimated when the values were set.
+func (rs *ResourceSubscription) size() int64 {
+	if rs == nil {
+		return 0
+	}
+	switch rs.state {
+	case stateModel:
+		return rs.model.size
+	case stateCollection:
+		return rs.collection.size
+	}
+	return 0
+}
+
+// modelSize returns the estimated JSON encoded length of the model values,
+// without encoding them.
+func modelSize(values map[string]codec.Value) int64 {
+	n := 1 + len(values)
+	for k, v := range values {
+		n += len(k) + 3 + len(v.RawMessage)
+	}
+	return int64(n)
+}
+
+// collectionSize returns the estimated JSON encoded length of the collection
+// values, without encoding them.
+func collectionSize(values []codec.Value) int64 {
+	n := 1 + len(values)
+	for _, v := range values {
+		n += len(v.RawMessage)
+	}
+	return int64(n)
+}
+
 // Unsubscribe cancels the client subscriber's subscription
 func (rs *ResourceSubscription) Unsubscribe(sub Subscriber) {
 	rs.e.Enqueue(func() {
 		if sub != nil {
-			delete(rs.subs, sub)
+			if _, ok := rs.subs[sub]; ok {
+				delete(rs.subs, sub)
+				rs.e.removeSubscribers(1)
+			}
 		}
 
 		// Directly unregister unsubscribed queries
@@ -126,6 +258,11 @@ func (rs *ResourceSubscription) Unsubscribe(sub Subscriber) {
 	})
 }
 
+// handleEvent updates the cached resource before passing the event on to the
+// subscribers, with the event targeting the version prior to the update. As
+// the resource and its version are read together by GetModel and
+// GetCollection, a subscriber loaded concurrently either gets the updated
+// resource, or the event.
 func (rs *ResourceSubscription) handleEvent(r *ResourceEvent) {
 	// Discard if event happened before resource was loaded,
 	// unless it is a reaccess. Then we let the event be passed further.
@@ -135,6 +272,9 @@ func (rs *ResourceSubscription) handleEvent(r *ResourceEvent) {
 
 	// Set event to target current version of the resource.
 	r.Version = rs.version
+	if r.Timestamp.IsZero() {
+		r.Timestamp = rs.e.eventTimestamp(r)
+	}
 
 	switch r.Event {
 	case "change":
@@ -169,17 +309,7 @@ func (rs *ResourceSubscription) handleEventChange(r *ResourceEvent) bool {
 		return false
 	}
 
-	var props map[string]codec.Value
-	var err error
-
-	// [DEPRECATED:deprecatedModelChangeEvent]
-	if codec.IsLegacyChangeEvent(r.Payload) {
-		rs.e.cache.deprecated(rs.e.ResourceName, deprecatedModelChangeEvent)
-		props, err = codec.DecodeLegacyChangeEvent(r.Payload)
-	} else {
-		props, err = codec.DecodeChangeEvent(r.Payload)
-	}
-
+	props, err := rs.e.decodeChangeEvent(r.Payload)
 	if err != nil {
 		rs.e.cache.Errorf("Error processing event %s.%s: %s", rs.e.ResourceName, r.Event, err)
 	}
@@ -193,7 +323,7 @@ func (rs *ResourceSubscription) handleEventChange(r *ResourceEvent) bool {
 
 	// Update model properties
 	for k, v := range props {
-		if v.Type == codec.ValueTypeDelete {
+		if v.IsRemoval() {
 			if _, ok := m[k]; ok {
 				delete(m, k)
 			} else {
@@ -214,13 +344,42 @@ func (rs *ResourceSubscription) handleEventChange(r *ResourceEvent) bool {
 	}
 
 	r.Changed = props
-	r.OldValues = rs.model.Values
+	r.OldValues = oldReferences(rs.model.Values, props)
+	// The payload is replaced by Changed. Drop it to avoid holding two
+	// copies of the changed values while the event is queued.
+	r.Payload = nil
 	r.Update = true
-	rs.model = &Model{Values: m}
-	rs.version++
+	rs.model = rs.newModel(m)
+	rs.modify()
 	return true
 }
 
+// oldReferences returns the old values of changed properties that are
+// resource references, needed by subscribers to remove replaced references.
+// Other old values are not retained, as they might be large.
+func oldReferences(vals map[string]codec.Value, changed map[string]codec.Value) map[string]codec.Value {
+	var old map[string]codec.Value
+	for k := range changed {
+		if v, ok := vals[k]; ok && v.IsReference() {
+			if old == nil {
+				old = make(map[string]codec.Value)
+			}
+			old[k] = v
+		}
+	}
+	return old
+}
+
+// decodeChangeEvent decodes the values of a change event payload.
+func (e *EventSubscription) decodeChangeEvent(payload json.RawMessage) (map[string]codec.Value, error) {
+	// [DEPRECATED:deprecatedModelChangeEvent]
+	if codec.IsLegacyChangeEvent(payload) {
+		e.cache.deprecated(e.ResourceName, deprecatedModelChangeEvent)
+		return codec.DecodeLegacyChangeEvent(payload)
+	}
+	return codec.DecodeChangeEvent(payload)
+}
+
 func (rs *ResourceSubscription) handleEventAdd(r *ResourceEvent) bool {
 	if rs.state == stateModel {
 		rs.e.cache.Errorf("Error processing event %s.%s: add event on model", rs.e.ResourceName, r.Event)
@@ -249,8 +408,8 @@ func (rs *ResourceSubscription) handleEventAdd(r *ResourceEvent) bool {
 	copy(col[idx+1:], old[idx:])
 	col[idx] = params.Value
 
-	rs.collection = &Collection{Values: col}
-	rs.version++
+	rs.collection = rs.newCollection(col, rs.collection.Total)
+	rs.modify()
 	r.Idx = params.Idx
 	r.Value = params.Value
 	r.Update = true
@@ -285,8 +444,8 @@ func (rs *ResourceSubscription) handleEventRemove(r *ResourceEvent) bool {
 	col := make([]codec.Value, l-1)
 	copy(col, old[0:idx])
 	copy(col[idx:], old[idx+1:])
-	rs.collection = &Collection{Values: col}
-	rs.version++
+	rs.collection = rs.newCollection(col, rs.collection.Total)
+	rs.modify()
 	r.Idx = params.Idx
 	r.Update = true
 
@@ -298,6 +457,7 @@ func (rs *ResourceSubscription) handleEventDelete(r *ResourceEvent) {
 	c := int64(len(subs))
 	rs.subs = nil
 	rs.unregister()
+	rs.e.removeSubscribers(len(subs))
 	rs.e.removeCount(c)
 
 	rs.e.mu.Unlock()
@@ -313,7 +473,7 @@ func (rs *ResourceSubscription) enqueueGetResponse(data []byte, responseHeaders
 
 		rs.e.mu.Unlock()
 		defer rs.e.mu.Lock()
-		if rs.state == stateError {
+		if rs.state == stateError || rs.state == stateNotFound {
 			for _, sub := range sublist {
 				sub.Loaded(nil, responseHeaders, rs.err)
 			}
@@ -350,6 +510,12 @@ func (rs *ResourceSubscription) processGetResponse(payload []byte, err error) (n
 	if err == nil {
 		result, err = codec.DecodeGetResponse(payload)
 	}
+	if err == nil {
+		err = rs.e.checkResourceSize(result)
+	}
+	if err == nil {
+		rs.e.setGroup(result.Group)
+	}
 
 	// Get request failed
 	if err != nil {
@@ -368,7 +534,14 @@ func (rs *ResourceSubscription) processGetResponse(payload []byte, err error) (n
 
 		c := int64(len(sublist))
 		rs.subs = nil
-		rs.unregister()
+		rs.e.removeSubscribers(len(sublist))
+		// Keep a not found resource registered, holding one count,
+		// to serve subscribers until the negative cache TTL expires.
+		if c > 0 && rs.cacheNotFound(err) {
+			c--
+		} else {
+			rs.unregister()
+		}
 
 		rs.e.removeCount(c)
 		nrs = rs
@@ -421,18 +594,28 @@ func (rs *ResourceSubscription) processGetResponse(payload []byte, err error) (n
 
 	// Make sure internal resource version has its 0 value
 	nrs.version = 0
+	nrs.modified = time.Now()
+	nrs.setServiceVersion(result.Version)
+	nrs.meta = result.Meta
 
 	if result.Model != nil {
-		nrs.model = &Model{Values: result.Model}
+		nrs.model = nrs.newModel(result.Model)
 		nrs.state = stateModel
 	} else {
-		nrs.collection = &Collection{Values: result.Collection}
+		nrs.collection = nrs.newCollection(result.Collection, collectionTotal(result.Total))
 		nrs.state = stateCollection
 	}
 	return
 }
 
 func (rs *ResourceSubscription) handleResetResource(t *Throttle) {
+	// A cached not found error is evicted rather than reset,
+	// letting the next subscriber make a new get request.
+	if rs.state == stateNotFound {
+		rs.evictNotFound()
+		return
+	}
+
 	// Are we already resetting. Then quick exit
 	if rs.resetting {
 		return
@@ -476,9 +659,12 @@ func (rs *ResourceSubscription) processResetGetResponse(payload []byte, err erro
 	// or an error in the service's response
 	if err == nil {
 		result, err = codec.DecodeGetResponse(payload)
-		if err == nil && ((rs.state == stateModel && result.Model == nil) || (rs.state == stateCollection && result.Collection == nil)) {
-			err = errors.New("mismatching resource type")
-		}
+	}
+	if err == nil {
+		err = rs.e.checkResourceSize(result)
+	}
+	if err == nil {
+		rs.e.setGroup(result.Group)
 	}
 
 	// Get request failed
@@ -496,13 +682,29 @@ func (rs *ResourceSubscription) processResetGetResponse(payload []byte, err erro
 
 	switch rs.state {
 	case stateModel:
+		if result.Model == nil {
+			rs.handleTypeMismatch(TypeCollection, "reset get response")
+			return
+		}
 		rs.processResetModel(result.Model)
 	case stateCollection:
+		if result.Collection == nil {
+			rs.handleTypeMismatch(TypeModel, "reset get response")
+			return
+		}
 		rs.processResetCollection(result.Collection)
+		rs.setCollectionTotal(collectionTotal(result.Total))
 	}
+	rs.setServiceVersion(result.Version)
+	rs.meta = result.Meta
 }
 
 func (rs *ResourceSubscription) processResetModel(props map[string]codec.Value) {
+	// Coalesced changes are outdated by the reset
+	if rs == rs.e.base {
+		rs.e.discardChanges()
+	}
+
 	// Update cached model properties
 	vals := rs.model.Values
 
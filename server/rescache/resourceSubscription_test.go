@@ -0,0 +1,130 @@
+package rescache_test
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/rescache"
+)
+
+func TestChangeEvent_ReferenceSwap_RetainsOnlyOldReferences(t *testing.T) {
+	m := newTestMQ(`{"result":{"model":{"ref":{"rid":"test.a"},"string":"foo","data":{"data":[1]}}}}`)
+	c, sub := startEventCache(t, m)
+	defer c.Stop()
+
+	m.publish("test.model", "change", []byte(`{"values":{"ref":{"rid":"test.b"},"string":"bar","data":{"data":[2]}}}`))
+	ev := sub.awaitEvents(t, 1)[0]
+
+	if len(ev.Changed) != 3 {
+		t.Errorf("expected 3 changed values, but got %d", len(ev.Changed))
+	}
+	if len(ev.OldValues) != 1 {
+		t.Fatalf("expected 1 old value, but got %d", len(ev.OldValues))
+	}
+	if v := ev.OldValues["ref"]; v.Type != codec.ValueTypeReference || v.RID != "test.a" {
+		t.Errorf("expected old value to be reference to test.a, but got %#v", v)
+	}
+	if ev.Payload != nil {
+		t.Errorf("expected payload to be dropped, but got %s", ev.Payload)
+	}
+}
+
+func TestChangeEvent_QueuedEventsOnLargeDataProperty_HoldSingleCopy(t *testing.T) {
+	const size = 1 << 20
+	const count = 10
+
+	largeData := func(i int) string {
+		return `{"data":"` + strings.Repeat(string(rune('a'+i)), size) + `"}`
+	}
+
+	m := newTestMQ(`{"result":{"model":{"data":` + largeData(count) + `}}}`)
+	c, sub := startEventCache(t, m)
+	defer c.Stop()
+
+	before := heapAlloc()
+	for i := 0; i < count; i++ {
+		m.publish("test.model", "change", []byte(`{"values":{"data":`+largeData(i)+`}}`))
+	}
+	evs := sub.awaitEvents(t, count)
+	growth := int64(heapAlloc()) - int64(before)
+	runtime.KeepAlive(evs)
+
+	// Each queued event holds the decoded data value, where the raw value
+	// and the inner data are each about size bytes. Anything more means
+	// the raw payload or old values are also held.
+	if limit := int64(count * size * 5 / 2); growth > limit {
+		t.Errorf("expected heap growth of queued events to be below %d bytes, but got %d", limit, growth)
+	}
+}
+
+// Test that a subscriber loaded while change events are being handled sees
+// each event either in the model it gets, or as an event targeting the
+// version it got, but never both or neither.
+func TestChangeEvent_SubscribeDuringEvents_SeesEachEventOnce(t *testing.T) {
+	const events = 200
+	const subscribers = 50
+
+	m := newTestMQ(`{"result":{"model":{"n":0}}}`)
+	c, _ := startEventCache(t, m)
+	defer c.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 1; i <= events; i++ {
+			m.publish("test.model", "change", []byte(`{"values":{"n":`+strconv.Itoa(i)+`}}`))
+		}
+		close(done)
+	}()
+
+	type loadedSub struct {
+		sub     *testSubscriber
+		model   *rescache.Model
+		version uint
+	}
+	subs := make([]loadedSub, 0, subscribers)
+	for i := 0; i < subscribers; i++ {
+		sub := newTestSubscriber()
+		c.Subscribe(sub, nil, nil)
+		var rs *rescache.ResourceSubscription
+		select {
+		case rs = <-sub.loaded:
+		case <-time.After(time.Second):
+			t.Fatal("expected resource to be loaded, but timed out")
+		}
+		model, version := rs.GetModel()
+		subs = append(subs, loadedSub{sub, model, version})
+	}
+	<-done
+	// Await all events being handled by subscribing once more
+	newTestSubscriber().subscribe(t, c)
+
+	for i, ls := range subs {
+		n := string(ls.model.Values["n"].RawMessage)
+		version := ls.version
+		ls.sub.mu.Lock()
+		for _, ev := range ls.sub.events {
+			// Discard events targeting a different version, as
+			// Subscription does
+			if ev.Version != version {
+				continue
+			}
+			version++
+			n = string(ev.Changed["n"].RawMessage)
+		}
+		ls.sub.mu.Unlock()
+		if n != strconv.Itoa(events) {
+			t.Fatalf("expected subscriber #%d to end with n=%d, but got n=%s", i+1, events, n)
+		}
+	}
+}
+
+func heapAlloc() uint64 {
+	var ms runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	return ms.HeapAlloc
+}
@@ -0,0 +1,104 @@
+package rescache
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/resgateio/resgate/metrics"
+)
+
+// retentionLogInterval is the interval between retention summaries logged on
+// debug level.
+const retentionLogInterval = time.Minute
+
+// RetentionStats contains statistics on resources retained by the cache
+// during the unsubscribe delay, after losing their last subscriber.
+type RetentionStats struct {
+	// PendingTimers is the number of pending unsubscribe delay timers.
+	PendingTimers int64
+	// Retained is the number of resources retained without subscribers.
+	Retained int64
+	// RetainedBytes is an estimate of the memory held by retained resources.
+	RetainedBytes int64
+	// Reused is the number of retained resources subscribed to again before
+	// the unsubscribe delay expired.
+	Reused int64
+	// Expired is the number of retained resources evicted without being reused.
+	Expired int64
+}
+
+// retentionCounters holds the atomically updated retention statistics.
+type retentionCounters struct {
+	retained      int64
+	retainedBytes int64
+	reused        int64
+	expired       int64
+}
+
+// RetentionStats returns the current retention statistics.
+func (c *Cache) RetentionStats() RetentionStats {
+	var pending int64
+	if c.unsubQueue != nil {
+		pending = int64(c.unsubQueue.Len())
+	}
+	return RetentionStats{
+		PendingTimers: pending,
+		Retained:      atomic.LoadInt64(&c.retention.retained),
+		RetainedBytes: atomic.LoadInt64(&c.retention.retainedBytes),
+		Reused:        atomic.LoadInt64(&c.retention.reused),
+		Expired:       atomic.LoadInt64(&c.retention.expired),
+	}
+}
+
+// retain marks the event subscription as retained after it has been added to
+// the unsubscribe queue. The event subscription's mutex must be held.
+func (c *Cache) retain(e *EventSubscription) {
+	if e.retained {
+		return
+	}
+	e.retained = true
+	e.retainedBytes = e.size()
+	atomic.AddInt64(&c.retention.retained, 1)
+	atomic.AddInt64(&c.retention.retainedBytes, e.retainedBytes)
+	metrics.CacheRetainedEntries.Inc()
+	metrics.CacheRetainedBytes.Add(float64(e.retainedBytes))
+	metrics.CacheRetentionPendingTimers.Set(float64(c.unsubQueue.Len()))
+}
+
+// release clears the retained mark of the event subscription, counting it as
+// either reused or expired. The event subscription's mutex must be held.
+func (c *Cache) release(e *EventSubscription, reused bool) {
+	metrics.CacheRetentionPendingTimers.Set(float64(c.unsubQueue.Len()))
+	if !e.retained {
+		return
+	}
+	e.retained = false
+	atomic.AddInt64(&c.retention.retained, -1)
+	atomic.AddInt64(&c.retention.retainedBytes, -e.retainedBytes)
+	metrics.CacheRetainedEntries.Dec()
+	metrics.CacheRetainedBytes.Sub(float64(e.retainedBytes))
+	e.retainedBytes = 0
+	if reused {
+		atomic.AddInt64(&c.retention.reused, 1)
+		metrics.CacheRetentionReused.Inc()
+	} else {
+		atomic.AddInt64(&c.retention.expired, 1)
+		metrics.CacheRetentionExpired.Inc()
+	}
+}
+
+// logRetention periodically writes a summary of the retention statistics on
+// debug level until the stop channel is closed.
+func (c *Cache) logRetention(stop chan struct{}) {
+	ticker := time.NewTicker(retentionLogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			st := c.RetentionStats()
+			c.Debugf("Cache retention: %d pending timers, %d retained (~%d bytes), %d reused, %d expired", st.PendingTimers, st.Retained, st.RetainedBytes, st.Reused, st.Expired)
+		case <-stop:
+			return
+		}
+	}
+}
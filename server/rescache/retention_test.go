@@ -0,0 +1,53 @@
+package rescache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server/rescache"
+)
+
+// assertRetentionStats waits for the cache retention statistics to match the
+// expected values.
+func assertRetentionStats(t *testing.T, c *rescache.Cache, expected rescache.RetentionStats) {
+	deadline := time.Now().Add(time.Second)
+	var st rescache.RetentionStats
+	for time.Now().Before(deadline) {
+		st = c.RetentionStats()
+		if st == expected {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("expected retention stats to be:\n%+v\nbut got:\n%+v", expected, st)
+}
+
+func TestRetentionStats_UnsubscribeAndResubscribe_CountsReuse(t *testing.T) {
+	c := startTestCache(t)
+	defer c.Stop()
+
+	sub := newTestSubscriber()
+	rs := sub.subscribe(t, c)
+	rs.Unsubscribe(sub)
+	assertRetentionStats(t, c, rescache.RetentionStats{PendingTimers: 1, Retained: 1, RetainedBytes: 13})
+
+	rs = sub.subscribe(t, c)
+	assertRetentionStats(t, c, rescache.RetentionStats{Reused: 1})
+	rs.Unsubscribe(sub)
+	assertRetentionStats(t, c, rescache.RetentionStats{PendingTimers: 1, Retained: 1, RetainedBytes: 13, Reused: 1})
+}
+
+func TestRetentionStats_UnsubscribeWithoutResubscribe_CountsExpiry(t *testing.T) {
+	c := startTestCache(t)
+	defer c.Stop()
+
+	sub := newTestSubscriber()
+	rs := sub.subscribe(t, c)
+	rs.Unsubscribe(sub)
+	assertRetentionStats(t, c, rescache.RetentionStats{Expired: 1})
+
+	// A new subscription after expiry is not counted as reuse
+	rs = sub.subscribe(t, c)
+	rs.Unsubscribe(sub)
+	assertRetentionStats(t, c, rescache.RetentionStats{Expired: 2})
+}
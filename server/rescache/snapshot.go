@@ -0,0 +1,170 @@
+package rescache
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/resgateio/resgate/server/codec"
+)
+
+// ResourceSnapshot is a copy of a cached resource, taken at a single point
+// in time. The values are copied from the cache, and may be modified without
+// affecting it.
+type ResourceSnapshot struct {
+	ResourceName string
+	Query        string
+	Type         ResourceType
+	Subscribers  int       // Number of subscribers, or 0 if retained awaiting unsubscribe
+	LastModified time.Time // Time when the resource was loaded, or last modified by an event
+	Model        map[string]codec.Value
+	Collection   []codec.Value
+	Err          error
+	Version      uint64 // Resource version set by the service, or 0 if not set or outdated
+	Resetting    bool   // True while a reset get request is pending
+	Throttled    bool   // True while events on the resource are rate limited
+}
+
+// ForEachResource calls cb with a snapshot of each loaded resource with a
+// resource name starting with prefix, in resource name order. An empty prefix
+// matches all resources. Iteration stops if cb returns false.
+//
+// The cache is only locked briefly while collecting the resource names, and
+// each resource is only locked while taking its snapshot. Events may be
+// processed during the iteration, so resources taken at different times may
+// not be consistent with each other. The callback is never called while
+// holding any lock, and may use the cache.
+func (c *Cache) ForEachResource(prefix string, cb func(r ResourceSnapshot) bool) {
+	c.mu.Lock()
+	eventSubs := make([]*EventSubscription, 0, len(c.eventSubs))
+	for name, eventSub := range c.eventSubs {
+		if strings.HasPrefix(name, prefix) {
+			eventSubs = append(eventSubs, eventSub)
+		}
+	}
+	c.mu.Unlock()
+
+	sort.Slice(eventSubs, func(i, j int) bool {
+		return eventSubs[i].ResourceName < eventSubs[j].ResourceName
+	})
+
+	for _, eventSub := range eventSubs {
+		for _, r := range eventSub.snapshots() {
+			if !cb(r.clone()) {
+				return
+			}
+		}
+	}
+}
+
+// Snapshot returns a snapshot of a loaded resource. False is returned if the
+// resource is not cached. The resource is only locked while taking the
+// snapshot.
+func (c *Cache) Snapshot(rname, query string) (ResourceSnapshot, bool) {
+	c.mu.Lock()
+	eventSub := c.eventSubs[rname]
+	c.mu.Unlock()
+	if eventSub == nil {
+		return ResourceSnapshot{}, false
+	}
+
+	eventSub.mu.Lock()
+	r, ok := eventSub.resource(query).snapshot()
+	eventSub.mu.Unlock()
+	if !ok {
+		return ResourceSnapshot{}, false
+	}
+	return r.clone(), true
+}
+
+// resource returns the base resource, or the query resource or link for a
+// non-empty query. Nil is returned if there is none.
+// Event subscription mutex is held when called.
+func (e *EventSubscription) resource(query string) *ResourceSubscription {
+	if query == "" {
+		return e.base
+	}
+	if rs := e.queries[query]; rs != nil {
+		return rs
+	}
+	return e.links[query]
+}
+
+// snapshots returns snapshots of the base resource and all query resources
+// that are loaded, sorted by query. The snapshot values are not yet copied,
+// and must be cloned before being passed on.
+func (e *EventSubscription) snapshots() []ResourceSnapshot {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rss := make([]ResourceSnapshot, 0, len(e.queries)+1)
+	if r, ok := e.base.snapshot(); ok {
+		rss = append(rss, r)
+	}
+	qs := make([]ResourceSnapshot, 0, len(e.queries))
+	for _, rs := range e.queries {
+		if r, ok := rs.snapshot(); ok {
+			qs = append(qs, r)
+		}
+	}
+	sort.Slice(qs, func(i, j int) bool {
+		return qs[i].Query < qs[j].Query
+	})
+	return append(rss, qs...)
+}
+
+// snapshot returns a snapshot of the resource without copying the values,
+// which are immutable once set on the resource subscription. False is
+// returned if the resource is not loaded.
+// Event subscription mutex is held when called.
+func (rs *ResourceSubscription) snapshot() (ResourceSnapshot, bool) {
+	if rs == nil || rs.state <= stateRequested {
+		return ResourceSnapshot{}, false
+	}
+	r := ResourceSnapshot{
+		ResourceName: rs.e.ResourceName,
+		Query:        rs.query,
+		Type:         ResourceType(rs.state),
+		Subscribers:  len(rs.subs),
+		LastModified: rs.modified,
+		Version:      rs.versionAt(rs.version),
+		Resetting:    rs.resetting,
+		Throttled:    rs.e.limiter != nil && rs.e.limiter.throttled,
+	}
+	switch rs.state {
+	case stateModel:
+		r.Model = rs.model.Values
+	case stateCollection:
+		r.Collection = rs.collection.Values
+	case stateError:
+		r.Err = rs.err
+	}
+	return r, true
+}
+
+// clone returns a copy of the snapshot with all values copied.
+func (r ResourceSnapshot) clone() ResourceSnapshot {
+	if r.Model != nil {
+		m := make(map[string]codec.Value, len(r.Model))
+		for k, v := range r.Model {
+			m[k] = cloneValue(v)
+		}
+		r.Model = m
+	}
+	if r.Collection != nil {
+		col := make([]codec.Value, len(r.Collection))
+		for i, v := range r.Collection {
+			col[i] = cloneValue(v)
+		}
+		r.Collection = col
+	}
+	return r
+}
+
+func cloneValue(v codec.Value) codec.Value {
+	v.RawMessage = append([]byte(nil), v.RawMessage...)
+	if v.Inner != nil {
+		v.Inner = append([]byte(nil), v.Inner...)
+	}
+	return v
+}
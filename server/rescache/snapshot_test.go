@@ -0,0 +1,157 @@
+package rescache_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server/rescache"
+)
+
+// collectResources returns the snapshots yielded by ForEachResource.
+func collectResources(c *rescache.Cache, prefix string) []rescache.ResourceSnapshot {
+	var rss []rescache.ResourceSnapshot
+	c.ForEachResource(prefix, func(r rescache.ResourceSnapshot) bool {
+		rss = append(rss, r)
+		return true
+	})
+	return rss
+}
+
+func TestForEachResource_WithPrefix_YieldsMatchingResources(t *testing.T) {
+	c := startTestCache(t)
+	defer c.Stop()
+
+	for _, rname := range []string{"test.model", "foo.model", "test.other"} {
+		newNamedTestSubscriber(rname).subscribe(t, c)
+	}
+
+	tbl := []struct {
+		Prefix   string
+		Expected []string
+	}{
+		{"", []string{"foo.model", "test.model", "test.other"}},
+		{"test.", []string{"test.model", "test.other"}},
+		{"test.model", []string{"test.model"}},
+		{"bar.", nil},
+	}
+
+	for i, l := range tbl {
+		var names []string
+		for _, r := range collectResources(c, l.Prefix) {
+			names = append(names, r.ResourceName)
+			if r.Type != rescache.TypeModel {
+				t.Errorf("expected %s to be a model in test %d, but got type %d", r.ResourceName, i+1, r.Type)
+			}
+			if r.Subscribers != 1 {
+				t.Errorf("expected %s to have 1 subscriber in test %d, but got %d", r.ResourceName, i+1, r.Subscribers)
+			}
+			if v := string(r.Model["foo"].RawMessage); v != `"bar"` {
+				t.Errorf("expected %s to have foo set to \"bar\" in test %d, but got %s", r.ResourceName, i+1, v)
+			}
+			if r.LastModified.IsZero() {
+				t.Errorf("expected %s to have a last modified time in test %d, but got none", r.ResourceName, i+1)
+			}
+		}
+		if !reflect.DeepEqual(names, l.Expected) {
+			t.Errorf("expected resources to be:\n%v\nbut got:\n%v\nin test %d", l.Expected, names, i+1)
+		}
+	}
+}
+
+func TestForEachResource_CallbackReturnsFalse_StopsIteration(t *testing.T) {
+	c := startTestCache(t)
+	defer c.Stop()
+
+	for _, rname := range []string{"test.a", "test.b", "test.c"} {
+		newNamedTestSubscriber(rname).subscribe(t, c)
+	}
+
+	calls := 0
+	c.ForEachResource("", func(r rescache.ResourceSnapshot) bool {
+		calls++
+		return false
+	})
+	if calls != 1 {
+		t.Errorf("expected callback to be called once, but got %d calls", calls)
+	}
+}
+
+func TestForEachResource_MutatingSnapshot_DoesNotAffectCache(t *testing.T) {
+	c := startTestCache(t)
+	defer c.Stop()
+
+	rs := newTestSubscriber().subscribe(t, c)
+
+	c.ForEachResource("", func(r rescache.ResourceSnapshot) bool {
+		copy(r.Model["foo"].RawMessage, `"baz"`)
+		r.Model["zoo"] = r.Model["foo"]
+		return true
+	})
+
+	m, _ := rs.GetModel()
+	if data, _ := json.Marshal(m.Values); string(data) != `{"foo":"bar"}` {
+		t.Errorf("expected cached model to be unchanged, but got %s", data)
+	}
+	rss := collectResources(c, "")
+	if len(rss) != 1 || len(rss[0].Model) != 1 || string(rss[0].Model["foo"].RawMessage) != `"bar"` {
+		t.Errorf("expected new snapshot to be unchanged, but got %+v", rss)
+	}
+}
+
+func TestForEachResource_DuringEventStorm_YieldsConsistentSnapshots(t *testing.T) {
+	const events = 1000
+	m := newTestMQ(`{"result":{"model":{"foo":"bar"}}}`)
+	c, _ := startEventCache(t, m)
+	defer c.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= events; i++ {
+			m.publish("test.model", "change", []byte(fmt.Sprintf(`{"values":{"a":%d,"b":%d}}`, i, i)))
+		}
+	}()
+
+	// Each change event sets a and b to the same value, so any snapshot
+	// must have equal values, never decreasing between iterations.
+	last := 0
+	for iterating := true; iterating; {
+		select {
+		case <-done:
+			iterating = false
+		default:
+		}
+		c.ForEachResource("test.", func(r rescache.ResourceSnapshot) bool {
+			a, b := r.Model["a"].RawMessage, r.Model["b"].RawMessage
+			if string(a) != string(b) {
+				t.Fatalf("expected a and b to be equal, but got %s and %s", a, b)
+			}
+			if a == nil {
+				return true
+			}
+			n, err := strconv.Atoi(string(a))
+			if err != nil {
+				t.Fatalf("expected a to be a number, but got %s", a)
+			}
+			if n < last {
+				t.Fatalf("expected a to be at least %d, but got %d", last, n)
+			}
+			last = n
+			return true
+		})
+	}
+
+	// Await all events to be processed
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if rss := collectResources(c, ""); len(rss) == 1 && string(rss[0].Model["a"].RawMessage) == strconv.Itoa(events) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("expected all %d events to be processed", events)
+}
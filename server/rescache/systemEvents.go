@@ -0,0 +1,128 @@
+package rescache
+
+import (
+	"encoding/json"
+
+	"github.com/resgateio/resgate/server/mq"
+)
+
+const (
+	// SystemSubscribeSubject is the subject of the message published, if
+	// system events are enabled, when a resource gets its first subscriber.
+	SystemSubscribeSubject = "system.resgate.subscribe"
+	// SystemUnsubscribeSubject is the subject of the message published, if
+	// system events are enabled, when the last subscriber of a resource
+	// leaves.
+	SystemUnsubscribeSubject = "system.resgate.unsubscribe"
+)
+
+// systemSubscriptionEvent is the payload of system subscribe and unsubscribe
+// messages.
+type systemSubscriptionEvent struct {
+	RID string `json:"rid"`
+}
+
+// systemEvent is a system subscribe or unsubscribe message waiting to be
+// published.
+type systemEvent struct {
+	subj  string
+	rname string
+}
+
+// WithSystemEvents sets if system.resgate.subscribe and
+// system.resgate.unsubscribe messages, with the resource name as rid, are
+// published when the number of subscribers of a resource goes from zero to
+// one, and back to zero. The number is shared by all queries of the
+// resource, and does not include pending requests, such as access or call
+// requests. Services may use the messages to start and stop producing data
+// for a resource.
+//
+// Must be called before starting the cache.
+func (c *Cache) WithSystemEvents(enable bool) *Cache {
+	c.systemEvents = enable
+	return c
+}
+
+// addSubscribers increases the number of subscribers, and queues a system
+// subscribe message if it was zero.
+// Event subscription mutex is held when called.
+func (e *EventSubscription) addSubscribers(n int) {
+	if n == 0 {
+		return
+	}
+	if e.subscribers == 0 {
+		e.cache.publishSystemEvent(SystemSubscribeSubject, e.ResourceName)
+	}
+	e.subscribers += n
+}
+
+// removeSubscribers decreases the number of subscribers, and queues a system
+// unsubscribe message if it reaches zero.
+// Event subscription mutex is held when called.
+func (e *EventSubscription) removeSubscribers(n int) {
+	if n == 0 {
+		return
+	}
+	e.subscribers -= n
+	if e.subscribers == 0 {
+		e.cache.publishSystemEvent(SystemUnsubscribeSubject, e.ResourceName)
+	}
+}
+
+// startSystemEvents starts a goroutine publishing queued system messages, if
+// system events are enabled. System events are disabled if the messaging
+// client is not a mq.Publisher.
+func (c *Cache) startSystemEvents() {
+	if !c.systemEvents {
+		return
+	}
+	p, ok := c.mq.(mq.Publisher)
+	if !ok {
+		c.Errorf("System events not supported by messaging client")
+		c.systemEvents = false
+		return
+	}
+	c.sysEventsCh = make(chan struct{}, 1)
+	go c.publishSystemEvents(p, c.sysEventsCh, c.stopCh)
+}
+
+// publishSystemEvent queues a system subscribe or unsubscribe message for the
+// resource, if system events are enabled. The message is published by a
+// separate goroutine, in the order queued, as the caller may hold the cache
+// or event subscription mutex.
+func (c *Cache) publishSystemEvent(subj, rname string) {
+	if !c.systemEvents {
+		return
+	}
+	c.sysEventsMu.Lock()
+	c.sysEvents = append(c.sysEvents, systemEvent{subj: subj, rname: rname})
+	c.sysEventsMu.Unlock()
+	select {
+	case c.sysEventsCh <- struct{}{}:
+	default:
+	}
+}
+
+// publishSystemEvents publishes all queued system messages each time it is
+// signaled on ch, until stop is closed.
+func (c *Cache) publishSystemEvents(p mq.Publisher, ch chan struct{}, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ch:
+		}
+
+		c.sysEventsMu.Lock()
+		evs := c.sysEvents
+		c.sysEvents = nil
+		c.sysEventsMu.Unlock()
+
+		for _, ev := range evs {
+			payload, _ := json.Marshal(systemSubscriptionEvent{RID: ev.rname})
+			if err := p.Publish(ev.subj, payload); err != nil {
+				c.Errorf("Error publishing %s for %s: %s", ev.subj, ev.rname, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package rescache
+
+// W3C trace context header names.
+// https://www.w3.org/TR/trace-context/
+var traceContextHeaders = []string{"traceparent", "tracestate"}
+
+// SetTraceContext sets if W3C trace context headers of events are set on
+// requests sent in response to the events, such as query requests for query
+// events.
+// Should be called before Start.
+func (c *Cache) SetTraceContext(enabled bool) {
+	c.traceContext = enabled
+}
+
+// eventTraceHeaders returns the trace context headers of an event, or nil if
+// the event has none or if trace context is not enabled.
+func (c *Cache) eventTraceHeaders(h map[string][]string) map[string][]string {
+	if !c.traceContext || len(h) == 0 {
+		return nil
+	}
+	var th map[string][]string
+	for _, k := range traceContextHeaders {
+		if v, ok := h[k]; ok {
+			if th == nil {
+				th = make(map[string][]string, len(traceContextHeaders))
+			}
+			th[k] = v
+		}
+	}
+	return th
+}
@@ -0,0 +1,56 @@
+package rescache
+
+import (
+	"github.com/resgateio/resgate/metrics"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// TypeMismatchAction is the action taken on the subscribers of a cached
+// resource when a service responds with data of a different resource type.
+type TypeMismatchAction byte
+
+// Type mismatch actions
+const (
+	// TypeMismatchDelete sends a delete event to the subscribers.
+	TypeMismatchDelete TypeMismatchAction = iota
+	// TypeMismatchUnsubscribe sends an unsubscribe event, with
+	// reserr.ErrTypeMismatch as reason, to direct subscribers.
+	TypeMismatchUnsubscribe
+)
+
+// SetTypeMismatchAction sets the action taken when a service changes the
+// type of a cached resource. Should be called before Start.
+func (c *Cache) SetTypeMismatchAction(a TypeMismatchAction) {
+	c.typeMismatchAction = a
+}
+
+// handleTypeMismatch rejects data of another type than the cached resource,
+// as responded by a service on a reset get request or a query event request.
+// The resource is removed from the cache, and the subscribers are sent a
+// delete event. If the cache action is TypeMismatchUnsubscribe, the delete
+// event carries reserr.ErrTypeMismatch as reason.
+// Event subscription mutex is held when called.
+func (rs *ResourceSubscription) handleTypeMismatch(typ ResourceType, source string) {
+	rid := rs.e.ResourceName
+	if rs.query != "" {
+		rid += "?" + rs.query
+	}
+	metrics.CacheTypeMismatches.WithLabelValues(metrics.SanitizedString(serviceName(rs.e.ResourceName))).Inc()
+	rs.e.cache.Errorf("Protocol violation by service on %s: %s responded with a %s for a cached %s. Data is rejected and the resource removed from cache.", rid, source, typeName(typ), typeName(ResourceType(rs.state)))
+
+	r := &ResourceEvent{Event: "delete"}
+	if rs.e.cache.typeMismatchAction == TypeMismatchUnsubscribe {
+		r.Reason = reserr.ErrTypeMismatch
+	}
+	rs.handleEvent(r)
+}
+
+func typeName(typ ResourceType) string {
+	switch typ {
+	case TypeModel:
+		return "model"
+	case TypeCollection:
+		return "collection"
+	}
+	return "error"
+}
@@ -0,0 +1,41 @@
+package rescache
+
+import "github.com/resgateio/resgate/server/codec"
+
+// SetUnsharedResources sets the resource patterns of unshared resources,
+// expected to have at most a single subscriber, such as per user resources.
+// Unshared resources are not retained during the unsubscribe delay, and do not
+// keep the JSON encoding of their values. It must be called before the cache
+// is started.
+func (c *Cache) SetUnsharedResources(patterns []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.unsharedPatterns = make([]ResourcePattern, 0, len(patterns))
+	for _, p := range patterns {
+		c.unsharedPatterns = append(c.unsharedPatterns, ParseResourcePattern(p))
+	}
+}
+
+// isUnshared returns true if the resource matches any unshared resource
+// pattern.
+// Cache mutex is held when called.
+func (c *Cache) isUnshared(rname string) bool {
+	for _, p := range c.unsharedPatterns {
+		if p.Match(rname) {
+			return true
+		}
+	}
+	return false
+}
+
+// newModel returns a model with the values. The JSON encoding of the model is
+// not kept for unshared resources.
+func (rs *ResourceSubscription) newModel(values map[string]codec.Value) *Model {
+	return &Model{Values: values, size: modelSize(values), unshared: rs.e.unshared}
+}
+
+// newCollection returns a collection with the values and total count. The JSON
+// encoding of the collection is not kept for unshared resources.
+func (rs *ResourceSubscription) newCollection(values []codec.Value, total int64) *Collection {
+	return &Collection{Values: values, Total: total, size: collectionSize(values), unshared: rs.e.unshared}
+}
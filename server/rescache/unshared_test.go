@@ -0,0 +1,126 @@
+package rescache_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server/rescache"
+)
+
+// startUnsharedTestCache starts a cache with a long unsubscribe delay, and
+// the resource patterns set as unshared.
+func startUnsharedTestCache(tb testing.TB, patterns ...string) *rescache.Cache {
+	return startCache(tb, newTestMQ(testGetResponse), 1, time.Hour, func(c *rescache.Cache) {
+		c.SetUnsharedResources(patterns)
+	})
+}
+
+// assertCacheResources waits for the number of cached resources to match n.
+func assertCacheResources(t *testing.T, c *rescache.Cache, n int) {
+	deadline := time.Now().Add(time.Second)
+	for c.Stats().Resources != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d cached resources, but got %d", n, c.Stats().Resources)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestUnshared_Unsubscribe_RemovedWithoutRetention(t *testing.T) {
+	c := startUnsharedTestCache(t, "test.>")
+	defer c.Stop()
+
+	sub := newTestSubscriber()
+	rs := sub.subscribe(t, c)
+	rs.Unsubscribe(sub)
+	assertCacheResources(t, c, 0)
+	assertRetentionStats(t, c, rescache.RetentionStats{})
+}
+
+func TestUnshared_NotMatchingPattern_Retained(t *testing.T) {
+	c := startUnsharedTestCache(t, "user.>")
+	defer c.Stop()
+
+	sub := newTestSubscriber()
+	rs := sub.subscribe(t, c)
+	rs.Unsubscribe(sub)
+	assertRetentionStats(t, c, rescache.RetentionStats{PendingTimers: 1, Retained: 1, RetainedBytes: 13})
+	assertCacheResources(t, c, 1)
+}
+
+func TestUnshared_MarshalModel_SameJSON(t *testing.T) {
+	c := startUnsharedTestCache(t, "test.>")
+	defer c.Stop()
+
+	sub := newTestSubscriber()
+	rs := sub.subscribe(t, c)
+	m, _ := rs.GetModel()
+	for i := 0; i < 2; i++ {
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != `{"foo":"bar"}` {
+			t.Fatalf("expected model to be marshaled as %s, but got %s", `{"foo":"bar"}`, data)
+		}
+	}
+	rs.Unsubscribe(sub)
+}
+
+// BenchmarkUnshared_100kSingleSubscriberResources measures the heap memory
+// per resource of 100k resources with a single subscriber each, with each
+// model marshaled once as for a subscribe response. The subscribed metric is
+// the memory while subscribed, and the retained metric the memory remaining
+// after all subscribers have unsubscribed.
+func BenchmarkUnshared_100kSingleSubscriberResources(b *testing.B) {
+	const count = 100000
+
+	for _, unshared := range []bool{false, true} {
+		name := "shared"
+		if unshared {
+			name = "unshared"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var patterns []string
+				if unshared {
+					patterns = []string{"user.*.settings"}
+				}
+				c := startUnsharedTestCache(b, patterns...)
+				before := heapAlloc()
+
+				subs := make([]*testSubscriber, count)
+				rss := make([]*rescache.ResourceSubscription, count)
+				for j := range subs {
+					subs[j] = newNamedTestSubscriber(fmt.Sprintf("user.%d.settings", j))
+					c.Subscribe(subs[j], nil, nil)
+				}
+				for j, sub := range subs {
+					rss[j] = <-sub.loaded
+					m, _ := rss[j].GetModel()
+					if _, err := json.Marshal(m); err != nil {
+						b.Fatal(err)
+					}
+				}
+				subscribed := heapAlloc()
+
+				for j, rs := range rss {
+					rs.Unsubscribe(subs[j])
+				}
+				rss = nil
+				for c.Stats().Subscriptions != 0 || (unshared && c.Stats().Resources != 0) {
+					time.Sleep(10 * time.Millisecond)
+				}
+				retained := heapAlloc()
+				runtime.KeepAlive(subs)
+
+				b.ReportMetric(float64(int64(subscribed)-int64(before))/count, "B/subscribed")
+				b.ReportMetric(float64(int64(retained)-int64(before))/count, "B/retained")
+				c.Stop()
+			}
+		})
+	}
+}
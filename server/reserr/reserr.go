@@ -48,11 +48,15 @@ const (
 	CodeUnsupportedProtocol = "system.unsupportedProtocol"
 	CodeSubjectTooLong      = "system.subjectTooLong"
 	CodeDeleted             = "system.deleted"
+	CodeSessionExpired      = "system.sessionExpired"
+	CodePayloadTooLarge     = "system.payloadTooLarge"
+	CodeResourceTooLarge    = "system.resourceTooLarge"
 	// HTTP only error codes
 	CodeBadRequest         = "system.badRequest"
 	CodeMethodNotAllowed   = "system.methodNotAllowed"
 	CodeServiceUnavailable = "system.serviceUnavailable"
 	CodeForbidden          = "system.forbidden"
+	CodePreconditionFailed = "system.preconditionFailed"
 )
 
 // Pre-defined RES errors
@@ -61,6 +65,7 @@ const (
 var (
 	ErrAccessDenied        = &Error{Code: CodeAccessDenied, Message: "Access denied"}
 	ErrDisposing           = &Error{Code: CodeInternalError, Message: "Internal error: disposing connection"}
+	ErrTypeMismatch        = &Error{Code: CodeInternalError, Message: "Internal error: resource type changed by service"}
 	ErrInternalError       = &Error{Code: CodeInternalError, Message: "Internal error"}
 	ErrInvalidParams       = &Error{Code: CodeInvalidParams, Message: "Invalid parameters"}
 	ErrInvalidQuery        = &Error{Code: CodeInvalidQuery, Message: "Invalid query"}
@@ -72,9 +77,13 @@ var (
 	ErrUnsupportedProtocol = &Error{Code: CodeUnsupportedProtocol, Message: "Unsupported protocol"}
 	ErrSubjectTooLong      = &Error{Code: CodeSubjectTooLong, Message: "Subject too long"}
 	ErrDeleted             = &Error{Code: CodeDeleted, Message: "Deleted"}
+	ErrSessionExpired      = &Error{Code: CodeSessionExpired, Message: "Session expired"}
+	ErrPayloadTooLarge     = &Error{Code: CodePayloadTooLarge, Message: "Payload too large"}
+	ErrResourceTooLarge    = &Error{Code: CodeResourceTooLarge, Message: "Resource too large"}
 	// HTTP only errors
 	ErrBadRequest         = &Error{Code: CodeBadRequest, Message: "Bad request"}
 	ErrMethodNotAllowed   = &Error{Code: CodeMethodNotAllowed, Message: "Method not allowed"}
 	ErrServiceUnavailable = &Error{Code: CodeServiceUnavailable, Message: "Service unavailable"}
 	ErrForbiddenOrigin    = &Error{Code: CodeForbidden, Message: "Forbidden origin"}
+	ErrPreconditionFailed = &Error{Code: CodePreconditionFailed, Message: "Precondition failed"}
 )
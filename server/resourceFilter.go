@@ -0,0 +1,22 @@
+package server
+
+import "github.com/resgateio/resgate/server/rescache"
+
+// isResourceAllowed reports whether a resource may be reached by clients.
+// If allowedResources is set, the resource name must match one of its
+// patterns. The resource name must not match any deniedResources pattern.
+func (s *Service) isResourceAllowed(rname string) bool {
+	if s.cfg.allowedResources != nil && !matchAnyPattern(s.cfg.allowedResources, rname) {
+		return false
+	}
+	return !matchAnyPattern(s.cfg.deniedResources, rname)
+}
+
+func matchAnyPattern(patterns []rescache.ResourcePattern, rname string) bool {
+	for _, p := range patterns {
+		if p.Match(rname) {
+			return true
+		}
+	}
+	return false
+}
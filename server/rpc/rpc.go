@@ -13,13 +13,14 @@ import (
 // Requester has the methods required to perform a rpc request
 type Requester interface {
 	Reply(data []byte)
-	GetResource(rid string, callback func(data *Resources, err error))
-	SubscribeResource(rid string, callback func(data *Resources, err error))
+	GetResource(rid string, lr *LoadRequest, callback func(data *Resources, err error))
+	SubscribeResource(rid string, lr *LoadRequest, callback func(data *Resources, err error))
 	UnsubscribeResource(rid string, count int, callback func(ok bool))
 	CallResource(rid, action string, params interface{}, callback func(result interface{}, err error))
 	AuthResource(rid, action string, params interface{}, callback func(result interface{}, err error))
 	NewResource(rid string, params interface{}, callback func(result interface{}, err error))
-	SetVersion(protocol string) (string, error)
+	OptionsResource(rid string, callback func(result *OptionsResult, err error))
+	SetVersion(vr VersionRequest) (VersionResult, error)
 	ProtocolVersion() int
 }
 
@@ -52,19 +53,25 @@ type ErrorResponse struct {
 
 // Resources holds a resource information to be sent to the client
 type Resources struct {
-	Models      map[string]interface{}   `json:"models,omitempty"`
-	Collections map[string]interface{}   `json:"collections,omitempty"`
-	Errors      map[string]*reserr.Error `json:"errors,omitempty"`
+	Models      map[string]interface{}                `json:"models,omitempty"`
+	Collections map[string]interface{}                `json:"collections,omitempty"`
+	Errors      map[string]*reserr.Error              `json:"errors,omitempty"`
+	Versions    map[string]uint64                     `json:"versions,omitempty"`
+	Totals      map[string]int64                      `json:"totals,omitempty"`
+	Meta        map[string]map[string]json.RawMessage `json:"meta,omitempty"`
 }
 
 // VersionRequest represents the params of a version request
 type VersionRequest struct {
-	Protocol string `json:"protocol"`
+	Protocol       string `json:"protocol"`
+	ReconnectToken string `json:"reconnectToken,omitempty"`
 }
 
 // VersionResult represents the results of a version request
 type VersionResult struct {
-	Protocol string `json:"protocol"`
+	Protocol       string `json:"protocol"`
+	ReconnectToken string `json:"reconnectToken,omitempty"`
+	Resumed        bool   `json:"resumed,omitempty"`
 }
 
 // AddEvent represents a RES-client collection add event
@@ -72,13 +79,22 @@ type VersionResult struct {
 type AddEvent struct {
 	Idx   int         `json:"idx"`
 	Value interface{} `json:"value"`
+	TS    string      `json:"ts,omitempty"`
 	*Resources
 }
 
+// RemoveEvent represents a RES-client collection remove event
+// https://github.com/resgateio/resgate/blob/master/docs/res-client-protocol.md#collection-remove-event
+type RemoveEvent struct {
+	Idx int    `json:"idx"`
+	TS  string `json:"ts,omitempty"`
+}
+
 // ChangeEvent represents a RES-client model change event
 // https://github.com/resgateio/resgate/blob/master/docs/res-client-protocol.md#model-change-event
 type ChangeEvent struct {
 	Values interface{} `json:"values"`
+	TS     string      `json:"ts,omitempty"`
 	*Resources
 }
 
@@ -86,6 +102,14 @@ type ChangeEvent struct {
 // https://github.com/resgateio/resgate/blob/master/docs/res-client-protocol.md#unsubscribe-event
 type UnsubscribeEvent struct {
 	Reason *reserr.Error `json:"reason"`
+	Count  int           `json:"count,omitempty"`
+}
+
+// EventOverflowEvent represents a RES-client system event overflow event
+// https://github.com/resgateio/resgate/blob/master/docs/res-client-protocol.md#event-overflow-event
+type EventOverflowEvent struct {
+	RID   string `json:"rid"`
+	Count int    `json:"count"`
 }
 
 // CallPayloadResult represents a RES-client result to a call or auth request with payload response
@@ -99,6 +123,22 @@ type CallResourceResult struct {
 	*Resources
 }
 
+// OptionsResult represents a RES-client result to an options request
+type OptionsResult struct {
+	Get  bool     `json:"get"`
+	Call []string `json:"call"`
+}
+
+// LoadRequest represents the params of a subscribe or get request
+type LoadRequest struct {
+	// Timeout in milliseconds for loading the resource and its references.
+	// Zero means no timeout.
+	Timeout int `json:"timeout"`
+	// Partial flags that resources loaded when the timeout expires should be
+	// returned, with system.timeout errors for the remaining resources.
+	Partial bool `json:"partial"`
+}
+
 // UnsubscribeRequest represents the params of an unsubscribe request
 type UnsubscribeRequest struct {
 	Count *int `json:"count"`
@@ -110,6 +150,20 @@ var (
 
 var nullBytes = []byte("null")
 
+// ReconnectToken returns the reconnect token of a version request, or empty
+// string if the data is not a version request with a reconnect token.
+func ReconnectToken(data []byte) string {
+	var r Request
+	if json.Unmarshal(data, &r) != nil || r.Method != "version" || len(r.Params) == 0 {
+		return ""
+	}
+	var vr VersionRequest
+	if json.Unmarshal(r.Params, &vr) != nil {
+		return ""
+	}
+	return vr.ReconnectToken
+}
+
 // HandleRequest unmarshals a request byte array and dispatches the request to the requester
 func HandleRequest(data []byte, req Requester) error {
 	r := &Request{}
@@ -133,12 +187,12 @@ func HandleRequest(data []byte, req Requester) error {
 					return nil
 				}
 			}
-			p, err := req.SetVersion(vr.Protocol)
+			result, err := req.SetVersion(vr)
 			if err != nil {
 				req.Reply(r.ErrorResponse(err))
 				return nil
 			}
-			req.Reply(r.SuccessResponse(VersionResult{Protocol: p}))
+			req.Reply(r.SuccessResponse(result))
 			return nil
 		}
 		req.Reply(r.ErrorResponse(reserr.ErrInvalidRequest))
@@ -156,21 +210,26 @@ func HandleRequest(data []byte, req Requester) error {
 			return nil
 		}
 		method = rid[idx+1:]
-		if !codec.IsValidRIDPart(method) {
-			req.Reply(r.ErrorResponse(reserr.ErrInvalidRequest))
+		rid = rid[:idx]
+		if err := codec.ValidateRIDPart(method, idx+1); err != nil {
+			req.Reply(r.ErrorResponse(err))
 			return nil
 		}
-		rid = rid[:idx]
 	}
 
-	if !codec.IsValidRID(rid, true) {
-		req.Reply(r.ErrorResponse(reserr.ErrInvalidRequest))
+	if err := codec.ValidateRID(rid, true); err != nil {
+		req.Reply(r.ErrorResponse(err))
 		return nil
 	}
 
 	switch action {
 	case "get":
-		req.GetResource(rid, func(data *Resources, err error) {
+		lr, err := parseLoadRequest(r.Params)
+		if err != nil {
+			req.Reply(r.ErrorResponse(err))
+			return nil
+		}
+		req.GetResource(rid, lr, func(data *Resources, err error) {
 			if err != nil {
 				req.Reply(r.ErrorResponse(err))
 			} else {
@@ -178,7 +237,12 @@ func HandleRequest(data []byte, req Requester) error {
 			}
 		})
 	case "subscribe":
-		req.SubscribeResource(rid, func(data *Resources, err error) {
+		lr, err := parseLoadRequest(r.Params)
+		if err != nil {
+			req.Reply(r.ErrorResponse(err))
+			return nil
+		}
+		req.SubscribeResource(rid, lr, func(data *Resources, err error) {
 			if err != nil {
 				req.Reply(r.ErrorResponse(err))
 			} else {
@@ -236,6 +300,15 @@ func HandleRequest(data []byte, req Requester) error {
 			}
 		})
 
+	case "options":
+		req.OptionsResource(rid, func(result *OptionsResult, err error) {
+			if err != nil {
+				req.Reply(r.ErrorResponse(err))
+			} else {
+				req.Reply(r.SuccessResponse(result))
+			}
+		})
+
 	default:
 		req.Reply(r.ErrorResponse(reserr.ErrInvalidRequest))
 	}
@@ -243,6 +316,19 @@ func HandleRequest(data []byte, req Requester) error {
 	return nil
 }
 
+// parseLoadRequest parses the optional params of a subscribe or get request.
+// Nil is returned if the request has no params.
+func parseLoadRequest(params json.RawMessage) (*LoadRequest, error) {
+	if len(params) == 0 || bytes.Equal(params, nullBytes) {
+		return nil, nil
+	}
+	var lr LoadRequest
+	if err := json.Unmarshal(params, &lr); err != nil || lr.Timeout < 0 {
+		return nil, reserr.ErrInvalidParams
+	}
+	return &lr, nil
+}
+
 // SuccessResponse encodes a result to a request response
 func (r *Request) SuccessResponse(result interface{}) []byte {
 	out, _ := json.Marshal(Response{Result: result, ID: r.ID})
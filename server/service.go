@@ -9,17 +9,26 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/resgateio/resgate/logger"
+	"github.com/resgateio/resgate/metrics"
 	"github.com/resgateio/resgate/server/mq"
 	"github.com/resgateio/resgate/server/rescache"
+	"github.com/resgateio/resgate/server/reserr"
 )
 
 // Service is a RES gateway implementation
 type Service struct {
-	cfg      Config
-	logger   logger.Logger
-	mu       sync.Mutex
-	stopping bool
-	stop     chan error
+	cfg              Config
+	logger           logger.Logger
+	payloadFormatter *logger.PayloadFormatter
+	cidGen           func() string
+	subscribeHook    func(cid, rid string) error
+	connTagger       func(r *http.Request) map[string]string
+	jwt              *jwtVerifier
+	onMQDisconnect   func()
+	onMQReconnect    func()
+	mu               sync.Mutex
+	stopping         bool
+	stop             chan error
 
 	mq    mq.Client
 	cache *rescache.Cache
@@ -27,7 +36,9 @@ type Service struct {
 	// httpServer
 	h        *http.Server
 	enc      APIEncoder
+	encs     map[string]APIEncoder
 	mimetype string
+	idem     *idempotencyStore
 
 	// metrics httpServer
 	m *http.Server
@@ -36,6 +47,16 @@ type Service struct {
 	upgrader websocket.Upgrader
 	conns    map[string]*wsConn // Connections by wsConn Id's
 	wg       sync.WaitGroup     // Wait for all connections to be disconnected
+
+	// Number of WebSocket connections, protected by mu, and the channels
+	// used to signal and stop the connection count goroutine.
+	wsCount     int
+	wsCountCh   chan struct{}
+	wsCountStop chan struct{}
+
+	// Suspended connections awaiting reconnect, protected by mu
+	suspended       map[string]*wsConn
+	reconnectSecret []byte
 }
 
 // NewService creates a new Service
@@ -51,6 +72,12 @@ func NewService(mq mq.Client, cfg Config) (*Service, error) {
 	s.initMetricsServer()
 	s.initHTTPServer()
 	s.initWSHandler()
+	if err := s.initReconnect(); err != nil {
+		return nil, err
+	}
+	if err := s.initJWTAuth(); err != nil {
+		return nil, err
+	}
 	s.initMQClient()
 	if err := s.initAPIHandler(); err != nil {
 		return nil, err
@@ -72,6 +99,140 @@ func (s *Service) SetLogger(l logger.Logger) *Service {
 	return s
 }
 
+// SetPayloadFormatter sets the formatter used for payloads in trace logging.
+// If not set, payloads are logged unchanged.
+func (s *Service) SetPayloadFormatter(f *logger.PayloadFormatter) *Service {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil {
+		panic("SetPayloadFormatter must be called before starting server")
+	}
+
+	s.payloadFormatter = f
+	return s
+}
+
+// SetConnectionIDGenerator sets the function used to generate connection
+// IDs (CID). Each ID must be a valid subject token, and unique among the
+// active connections. If not set, or if gen is nil, xid is used.
+func (s *Service) SetConnectionIDGenerator(gen func() string) *Service {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil {
+		panic("SetConnectionIDGenerator must be called before starting server")
+	}
+
+	s.cidGen = gen
+	return s
+}
+
+// SetSubscribeHook sets a function called when a client makes a direct
+// subscription to a resource, with the connection ID and the resource ID.
+// This includes getting a resource through the HTTP API. If the hook returns
+// an error, the subscription fails with that error. A *reserr.Error is sent
+// to the client as is, while other errors are sent as internal errors.
+//
+// The hook is called on the connection's goroutine and must not block. Any
+// slow validation should instead be done by the service in its access
+// response.
+func (s *Service) SetSubscribeHook(hook func(cid, rid string) error) *Service {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil {
+		panic("SetSubscribeHook must be called before starting server")
+	}
+
+	s.subscribeHook = hook
+	return s
+}
+
+// WithConnectionTagger sets a function called with the HTTP request of each
+// client connection, including the upgrade request of WebSocket connections,
+// returning tags to store on the connection. The tags are included in the
+// log entries of the connection, and in the resgate_ws_tagged_connections
+// metric. Tag values should be few, such as a client type or major version,
+// as each combination is a separate metric series.
+//
+// The tagger is called on the goroutine serving the request and must not
+// block.
+func (s *Service) WithConnectionTagger(tagger func(r *http.Request) map[string]string) *Service {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil {
+		panic("WithConnectionTagger must be called before starting server")
+	}
+
+	s.connTagger = tagger
+	return s
+}
+
+// WithNATSEventCallbacks sets functions called when the connection to NATS
+// is lost, and when it is reestablished, letting the operator act on it, for
+// example by notifying clients that services are unavailable. Either may be
+// nil. The callbacks are only called if the messaging client reconnects,
+// as set by the natsMaxReconnects setting. Otherwise a lost connection stops
+// the service. The reconnect callback is called after the cache has started
+// to resynchronize.
+//
+// The callbacks are called on the messaging client's goroutine and must not
+// block.
+func (s *Service) WithNATSEventCallbacks(onDisconnect, onReconnect func()) *Service {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil {
+		panic("WithNATSEventCallbacks must be called before starting server")
+	}
+
+	s.onMQDisconnect = onDisconnect
+	s.onMQReconnect = onReconnect
+	return s
+}
+
+// SetWebSocketOriginCheck sets a function called with the upgrade request
+// of each WebSocket connection, replacing the origin check of the
+// allowOrigin setting. If it returns false, the connection is rejected with
+// 403 Forbidden. Use AllowedOrigins to create a check for a list of origins.
+// If check is nil, the allowOrigin setting is used.
+func (s *Service) SetWebSocketOriginCheck(check func(r *http.Request) bool) *Service {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil {
+		panic("SetWebSocketOriginCheck must be called before starting server")
+	}
+
+	if check == nil {
+		check = s.allowOriginCheck()
+	}
+	s.upgrader.CheckOrigin = check
+	return s
+}
+
+// SetAccessPolicy sets the access policy for resources matching the resource
+// pattern, used instead of sending access requests to the services. It
+// replaces any policy set for the same pattern, including policies set by
+// the accessPolicies setting. If multiple patterns match a resource, the
+// longest applies. A nil policy removes the policy for the pattern.
+func (s *Service) SetAccessPolicy(pattern string, policy rescache.AccessPolicy) *Service {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil {
+		panic("SetAccessPolicy must be called before starting server")
+	}
+	if !rescache.ParseResourcePattern(pattern).IsValid() {
+		panic("SetAccessPolicy called with invalid resource pattern: " + pattern)
+	}
+
+	s.cache.SetAccessPolicy(pattern, policy)
+	return s
+}
+
 // Logf writes a formatted log message
 func (s *Service) Logf(format string, v ...interface{}) {
 	s.logger.Log(fmt.Sprintf(format, v...))
@@ -126,6 +287,7 @@ func (s *Service) start() error {
 	}
 
 	s.startMetricsServer()
+	s.startConnectionCount()
 
 	s.startHTTPServer()
 	s.Logf("Server ready")
@@ -151,6 +313,7 @@ func (s *Service) Stop(err error) {
 	s.stopMetricsServer()
 	s.stopWSHandler()
 	s.stopHTTPServer()
+	s.stopConnectionCount()
 	s.stopMQClient()
 
 	s.mu.Lock()
@@ -169,3 +332,36 @@ func (s *Service) StopChannel() <-chan error {
 	defer s.mu.Unlock()
 	return s.stop
 }
+
+// InstanceID returns the ID of the resgate instance, as set by the instanceId
+// setting, or generated by NewService if not set.
+func (s *Service) InstanceID() string {
+	return s.cfg.instanceID
+}
+
+// CacheStats returns statistics on the content of the resource cache.
+func (s *Service) CacheStats() rescache.Stats {
+	return s.cache.Stats()
+}
+
+// ForEachCachedResource calls cb with a snapshot of each loaded resource in
+// the cache with a resource name starting with prefix. Iteration stops if cb
+// returns false. See rescache.Cache.ForEachResource.
+func (s *Service) ForEachCachedResource(prefix string, cb func(r rescache.ResourceSnapshot) bool) {
+	s.cache.ForEachResource(prefix, cb)
+}
+
+// isMethodNotFound returns true if err is a system.methodNotFound error, or an
+// error with any of the codes configured as method not found aliases.
+func (s *Service) isMethodNotFound(err error) bool {
+	rerr, ok := err.(*reserr.Error)
+	return ok && s.cfg.methodNotFoundCodes[rerr.Code]
+}
+
+// countMethodNotFound increases the method not found metric for the request
+// subject if err is a method not found error.
+func (s *Service) countMethodNotFound(subj string, err error) {
+	if err != nil && s.isMethodNotFound(err) {
+		metrics.MethodNotFoundCount.WithLabelValues(metrics.SanitizedString(subj)).Inc()
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/resgateio/resgate/server/codec"
 	"github.com/resgateio/resgate/server/rescache"
@@ -19,15 +20,21 @@ type ConnSubscriber interface {
 	Debugf(format string, v ...interface{})
 	Errorf(format string, v ...interface{})
 	CID() string
+	RequestID() string
 	Token() json.RawMessage
 	Subscribe(rid string, direct bool, throttle *rescache.Throttle, headers map[string][]string) (*Subscription, error)
 	Unsubscribe(sub *Subscription, direct bool, count int, tryDelete bool)
-	Access(sub *Subscription, callback func(*rescache.Access))
+	Access(sub *Subscription, requestHeaders map[string][]string, callback func(*rescache.Access))
+	InvalidateAccessScopes(rname string)
 	Send(data []byte)
-	Enqueue(f func()) bool
+	EnqueueTask(category string, f func(), drop func()) bool
 	ExpandCID(string) string
 	Disconnect(reason string)
 	ProtocolVersion() int
+	MaxEventQueueSize() int
+	AccessRevalidateInterval() time.Duration
+	RequestHeaders() map[string][]string
+	Tags() map[string]string
 }
 
 // Subscription represents a resource subscription made by a client connection
@@ -50,12 +57,18 @@ type Subscription struct {
 	err             error
 	queueFlag       uint8
 	eventQueue      []*rescache.ResourceEvent
+	droppedEvents   int
 	access          *rescache.Access
 	accessCallbacks []func(*rescache.Access)
 	flags           uint8
 	throttle        *rescache.Throttle
 	traceparent     string
 
+	// Timer for the next access revalidation, and the number of consecutive
+	// access errors on revalidation.
+	revalidateTimer  *time.Timer
+	revalidateErrors uint
+
 	// Protected by conn
 	direct   int // Number of direct subscriptions
 	indirect int // Number of indirect subscriptions
@@ -95,6 +108,10 @@ const (
 var (
 	errSubscriptionLimitExceeded = &reserr.Error{Code: "system.subscriptionLimitExceeded", Message: "Subscription limit exceeded"}
 	errDisposedSubscription      = &reserr.Error{Code: "system.disposedSubscription", Message: "Resource subscription is disposed"}
+
+	// eventOverflowEvent is kept at the head of the event queue when queued
+	// events have been dropped.
+	eventOverflowEvent = &rescache.ResourceEvent{Event: "eventOverflow"}
 )
 
 // NewSubscription creates a new Subscription
@@ -144,6 +161,12 @@ func (s *Subscription) CID() string {
 	return s.c.CID()
 }
 
+// RequestID returns the ID of the client request currently handled by the
+// connection, to be sent in service requests.
+func (s *Subscription) RequestID() string {
+	return s.c.RequestID()
+}
+
 // IsReady returns true if the subscription and all of its dependencies are loaded.
 func (s *Subscription) IsReady() bool {
 	return s.state >= stateReady
@@ -154,6 +177,18 @@ func (s *Subscription) IsSent() bool {
 	return s.state == stateSent
 }
 
+// DirectCount returns the number of direct subscriptions made by the client
+// to the resource.
+func (s *Subscription) DirectCount() int {
+	return s.direct
+}
+
+// IndirectCount returns the number of indirect subscriptions to the resource,
+// made through references from other subscribed resources.
+func (s *Subscription) IndirectCount() int {
+	return s.indirect
+}
+
 // Error returns any error that occurred when loading the subscribed resource.
 func (s *Subscription) Error() error {
 	if s.state == stateDisposed {
@@ -187,7 +222,19 @@ func (s *Subscription) Ref(rid string) *Subscription {
 // If the resource was successfully loaded, err will be nil. If an error occurred
 // when loading the resource, resourceSub will be nil, and err will be the error.
 func (s *Subscription) Loaded(resourceSub *rescache.ResourceSubscription, responseHeaders map[string][]string, err error) {
-	if !s.c.Enqueue(func() {
+	var drop func()
+	if err == nil {
+		drop = func() { resourceSub.Unsubscribe(s) }
+	}
+	s.c.EnqueueTask(taskLoaded, func() {
+		// Loading was aborted, such as by a request deadline
+		if s.state == stateReady {
+			if err == nil {
+				resourceSub.Unsubscribe(s)
+			}
+			return
+		}
+
 		if err != nil {
 			s.err = err
 			s.doneLoading()
@@ -223,11 +270,7 @@ func (s *Subscription) Loaded(resourceSub *rescache.ResourceSubscription, respon
 		for _, rcb := range rcbs {
 			s.collectRefs(rcb)
 		}
-	}) {
-		if err == nil {
-			resourceSub.Unsubscribe(s)
-		}
-	}
+	}, drop)
 }
 
 // setResource is called after Loaded is called
@@ -323,6 +366,13 @@ func (s *Subscription) unqueueEvents(reason uint8) {
 	s.eventQueue = nil
 
 	for i, event := range eq {
+		// Release the processed event from the queue, as the backing array
+		// might be reused if queueing is activated again.
+		eq[i] = nil
+		if event == eventOverflowEvent {
+			s.processEventOverflow()
+			continue
+		}
 		s.processEvent(event)
 		// Did one of the events activate queueing again?
 		if s.queueFlag != 0 {
@@ -368,6 +418,9 @@ func (s *Subscription) populateResources(r *rpc.Resources) {
 		r.Models[s.rid] = s.model
 	}
 
+	s.populateVersion(r)
+	s.populateTotal(r)
+	s.populateMeta(r)
 	s.state = stateToSend
 
 	for _, sc := range s.refs {
@@ -410,6 +463,9 @@ func (s *Subscription) populateResourcesLegacy(r *rpc.Resources) {
 		r.Models[s.rid] = (*rescache.Legacy120Model)(s.model)
 	}
 
+	s.populateVersion(r)
+	s.populateTotal(r)
+	s.populateMeta(r)
 	s.state = stateToSend
 
 	for _, sc := range s.refs {
@@ -417,6 +473,47 @@ func (s *Subscription) populateResourcesLegacy(r *rpc.Resources) {
 	}
 }
 
+// populateVersion adds the resource version set by the service to the
+// rpc.Resources object, if the version is valid for the subscription's data.
+func (s *Subscription) populateVersion(r *rpc.Resources) {
+	v := s.resourceSub.VersionAt(s.version)
+	if v == 0 {
+		return
+	}
+	// Create Versions map if needed
+	if r.Versions == nil {
+		r.Versions = make(map[string]uint64)
+	}
+	r.Versions[s.rid] = v
+}
+
+// populateTotal adds the total count of a collection set by the service to the
+// rpc.Resources object, if any.
+func (s *Subscription) populateTotal(r *rpc.Resources) {
+	if s.typ != rescache.TypeCollection || s.collection.Total < 0 {
+		return
+	}
+	// Create Totals map if needed
+	if r.Totals == nil {
+		r.Totals = make(map[string]int64)
+	}
+	r.Totals[s.rid] = s.collection.Total
+}
+
+// populateMeta adds the metadata set by the service to the rpc.Resources
+// object, if any.
+func (s *Subscription) populateMeta(r *rpc.Resources) {
+	meta := s.resourceSub.Meta()
+	if len(meta) == 0 {
+		return
+	}
+	// Create Meta map if needed
+	if r.Meta == nil {
+		r.Meta = make(map[string]map[string]json.RawMessage)
+	}
+	r.Meta[s.rid] = meta
+}
+
 // setModel subscribes to all resource references in the model.
 func (s *Subscription) setModel() {
 	s.queueEvents(queueReasonLoading)
@@ -449,7 +546,7 @@ func (s *Subscription) setCollection() {
 // be unsubscribed, s.err set, s.doneLoading called, and false returned.
 // If v is not a resource reference, nothing will happen.
 func (s *Subscription) subscribeRef(v codec.Value) bool {
-	if v.Type != codec.ValueTypeReference {
+	if !v.IsReference() {
 		return true
 	}
 
@@ -546,6 +643,11 @@ func (s *Subscription) addReference(rid string) (*Subscription, error) {
 // event such as collection remove or model change.
 func (s *Subscription) removeReference(rid string) {
 	ref := s.refs[rid]
+	// The reference is missing if the event adding it was dropped on event
+	// queue overflow.
+	if ref == nil {
+		return
+	}
 	ref.count--
 	if ref.count == 0 {
 		s.c.Unsubscribe(ref.sub, false, 1, true)
@@ -555,7 +657,7 @@ func (s *Subscription) removeReference(rid string) {
 
 // Event passes an event to the subscription to be processed.
 func (s *Subscription) Event(event *rescache.ResourceEvent) {
-	s.c.Enqueue(func() {
+	s.c.EnqueueTask(taskEvent, func() {
 		if event.Event == "reaccess" {
 			s.reaccess(nil)
 			return
@@ -567,12 +669,86 @@ func (s *Subscription) Event(event *rescache.ResourceEvent) {
 		}
 
 		if s.queueFlag != 0 {
-			s.eventQueue = append(s.eventQueue, event)
+			s.queueEvent(event)
 			return
 		}
 
 		s.processEvent(event)
-	})
+	}, nil)
+}
+
+// queueEvent adds an event to the event queue. If the queue would exceed the
+// maximum event queue size, the oldest queued event is dropped, and a single
+// eventOverflowEvent is kept at the head of the queue to notify the client.
+// Delete events are never dropped.
+func (s *Subscription) queueEvent(event *rescache.ResourceEvent) {
+	eq := s.eventQueue
+	head := 0
+	if s.droppedEvents > 0 {
+		head = 1
+	}
+	if len(eq)-head < s.c.MaxEventQueueSize() {
+		s.eventQueue = append(eq, event)
+		return
+	}
+
+	idx := head
+	for idx < len(eq) && eq[idx].Event == "delete" {
+		idx++
+	}
+	if idx == len(eq) {
+		s.eventQueue = append(eq, event)
+		return
+	}
+
+	if head == 0 {
+		s.c.Debugf("Subscription %s: Event queue overflow", s.rid)
+		eq = append(eq, nil)
+		copy(eq[1:], eq)
+		eq[0] = eventOverflowEvent
+		idx++
+	}
+	s.dropEvent(eq[idx])
+	copy(eq[idx:], eq[idx+1:])
+	eq[len(eq)-1] = event
+	s.eventQueue = eq
+}
+
+// dropEvent drops a queued event without sending it to the client. The
+// version of the subscription is still updated, for the remaining queued
+// events to be processed. References added by the event are not subscribed,
+// as their resources would never be sent to the client, while references
+// removed by the event are released.
+func (s *Subscription) dropEvent(event *rescache.ResourceEvent) {
+	s.droppedEvents++
+
+	// Discard events targeting a different internal version
+	if s.version != event.Version {
+		return
+	}
+	if event.Update {
+		s.version++
+	}
+
+	switch event.Event {
+	case "remove":
+		if event.Value.IsReference() {
+			s.removeReference(event.Value.RID)
+		}
+	case "change":
+		for k := range event.Changed {
+			if ov, ok := event.OldValues[k]; ok && ov.IsReference() {
+				s.removeReference(ov.RID)
+			}
+		}
+	}
+}
+
+// processEventOverflow sends a system.eventOverflow event to the client with
+// the number of events dropped from the event queue.
+func (s *Subscription) processEventOverflow() {
+	s.c.Send(rpc.NewEvent("system", "eventOverflow", rpc.EventOverflowEvent{RID: s.rid, Count: s.droppedEvents}))
+	s.droppedEvents = 0
 }
 
 func (s *Subscription) processEvent(event *rescache.ResourceEvent) {
@@ -603,7 +779,7 @@ func (s *Subscription) processCollectionEvent(event *rescache.ResourceEvent) {
 		idx := event.Idx
 
 		switch v.Type {
-		case codec.ValueTypeReference:
+		case codec.ValueTypeReference, codec.ValueTypeLinkedResource:
 			rid := v.RID
 			sub, err := s.addReference(rid)
 			if err != nil {
@@ -614,7 +790,7 @@ func (s *Subscription) processCollectionEvent(event *rescache.ResourceEvent) {
 
 			// Quick exit if added resource is already sent to client
 			if sub.IsSent() {
-				s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.AddEvent{Idx: idx, Value: v.RawMessage}))
+				s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.AddEvent{Idx: idx, Value: v.RawMessage, TS: eventTS(event.Timestamp)}))
 				return
 			}
 
@@ -629,7 +805,7 @@ func (s *Subscription) processCollectionEvent(event *rescache.ResourceEvent) {
 				}
 
 				r := sub.GetRPCResources()
-				s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.AddEvent{Idx: idx, Value: v.RawMessage, Resources: r}))
+				s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.AddEvent{Idx: idx, Value: v.RawMessage, TS: eventTS(event.Timestamp), Resources: r}))
 				sub.ReleaseRPCResources()
 
 				s.unqueueEvents(queueReasonLoading)
@@ -638,27 +814,25 @@ func (s *Subscription) processCollectionEvent(event *rescache.ResourceEvent) {
 			fallthrough
 		case codec.ValueTypeSoftReference:
 			if s.c.ProtocolVersion() < versionSoftResourceReferenceAndDataValue {
-				s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.AddEvent{Idx: idx, Value: rescache.Legacy120Value(v)}))
+				s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.AddEvent{Idx: idx, Value: rescache.Legacy120Value(v), TS: eventTS(event.Timestamp)}))
 				break
 			}
 			fallthrough
 		case codec.ValueTypePrimitive:
-			s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.AddEvent{Idx: idx, Value: v.RawMessage}))
+			s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.AddEvent{Idx: idx, Value: v.RawMessage, TS: eventTS(event.Timestamp)}))
 		}
 
 	case "remove":
 		// Remove and unsubscribe to model
 		v := event.Value
 
-		if v.Type == codec.ValueTypeReference {
+		if v.IsReference() {
 			s.removeReference(v.RID)
 		}
-		s.c.Send(rpc.NewEvent(s.rid, event.Event, event.Payload))
+		s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.RemoveEvent{Idx: event.Idx, TS: eventTS(event.Timestamp)}))
 
 	case "delete":
-		s.state = stateDeleted
-		s.c.Send(rpc.NewEvent(s.rid, event.Event, event.Payload))
-		s.unsubscribeDirect(reserr.ErrDeleted)
+		s.processDeleteEvent(event)
 	default:
 		s.c.Send(rpc.NewEvent(s.rid, event.Event, event.Payload))
 	}
@@ -672,7 +846,7 @@ func (s *Subscription) processModelEvent(event *rescache.ResourceEvent) {
 		var subs []*Subscription
 
 		for _, v := range ch {
-			if v.Type == codec.ValueTypeReference {
+			if v.IsReference() {
 				sub, err := s.addReference(v.RID)
 				if err != nil {
 					s.c.Errorf("Subscription %s: Error subscribing to resource %s: %s", s.rid, v.RID, err)
@@ -691,7 +865,7 @@ func (s *Subscription) processModelEvent(event *rescache.ResourceEvent) {
 		// Check for removing changed references after adding references to avoid unsubscribing to
 		// a resource that is going to be subscribed again because it has moved between properties.
 		for k := range ch {
-			if ov, ok := old[k]; ok && ov.Type == codec.ValueTypeReference {
+			if ov, ok := old[k]; ok && ov.IsReference() {
 				s.removeReference(ov.RID)
 			}
 		}
@@ -700,9 +874,9 @@ func (s *Subscription) processModelEvent(event *rescache.ResourceEvent) {
 		if subs == nil {
 			// Legacy behavior
 			if s.c.ProtocolVersion() < versionSoftResourceReferenceAndDataValue {
-				s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.ChangeEvent{Values: rescache.Legacy120ValueMap(event.Changed)}))
+				s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.ChangeEvent{Values: rescache.Legacy120ValueMap(event.Changed), TS: eventTS(event.Timestamp)}))
 			} else {
-				s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.ChangeEvent{Values: event.Changed}))
+				s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.ChangeEvent{Values: event.Changed, TS: eventTS(event.Timestamp)}))
 			}
 			return
 		}
@@ -729,12 +903,12 @@ func (s *Subscription) processModelEvent(event *rescache.ResourceEvent) {
 					for _, sub := range subs {
 						sub.populateResourcesLegacy(r)
 					}
-					s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.ChangeEvent{Values: rescache.Legacy120ValueMap(event.Changed), Resources: r}))
+					s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.ChangeEvent{Values: rescache.Legacy120ValueMap(event.Changed), TS: eventTS(event.Timestamp), Resources: r}))
 				} else {
 					for _, sub := range subs {
 						sub.populateResources(r)
 					}
-					s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.ChangeEvent{Values: event.Changed, Resources: r}))
+					s.c.Send(rpc.NewEvent(s.rid, event.Event, rpc.ChangeEvent{Values: event.Changed, TS: eventTS(event.Timestamp), Resources: r}))
 				}
 				for _, sub := range subs {
 					sub.ReleaseRPCResources()
@@ -744,14 +918,35 @@ func (s *Subscription) processModelEvent(event *rescache.ResourceEvent) {
 			})
 		}
 	case "delete":
-		s.state = stateDeleted
-		s.c.Send(rpc.NewEvent(s.rid, event.Event, event.Payload))
-		s.unsubscribeDirect(reserr.ErrDeleted)
+		s.processDeleteEvent(event)
 	default:
 		s.c.Send(rpc.NewEvent(s.rid, event.Event, event.Payload))
 	}
 }
 
+// processDeleteEvent sets the subscription as deleted and sends a delete
+// event followed by an unsubscribe event to the client. If the event has a
+// reason, such as when the cache rejects a resource changing type, direct
+// subscriptions are instead only unsubscribed with that reason.
+func (s *Subscription) processDeleteEvent(event *rescache.ResourceEvent) {
+	s.state = stateDeleted
+	if event.Reason != nil && s.direct > 0 {
+		s.unsubscribeDirect(event.Reason)
+		return
+	}
+	s.c.Send(rpc.NewEvent(s.rid, event.Event, event.Payload))
+	s.unsubscribeDirect(reserr.ErrDeleted)
+}
+
+// eventTS returns the ts field value of a client event with the timestamp,
+// or an empty string if the timestamp is not set.
+func eventTS(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
 func (s *Subscription) handleReaccess(t *rescache.Throttle) {
 	s.access = nil
 	s.flags &= ^flagReaccess
@@ -774,6 +969,8 @@ func (s *Subscription) handleReaccess(t *rescache.Throttle) {
 }
 
 // validateAccess checks if subscription has get access, or else unsubscribes.
+// An error response to the access request is used as unsubscribe reason
+// unaltered, with its code, message, and data.
 func (s *Subscription) validateAccess(a *rescache.Access) {
 	err := a.CanGet()
 	if err != nil {
@@ -782,11 +979,18 @@ func (s *Subscription) validateAccess(a *rescache.Access) {
 }
 
 // unsubscribeDirect removes any direct subscription of the resource and sends
-// an unsubscribe event if any direct subscriptions existed.
+// an unsubscribe event if any direct subscriptions existed. The number of
+// removed direct subscriptions is only included if more than one, leaving
+// the event unchanged for the common case of a single subscription.
 func (s *Subscription) unsubscribeDirect(reason *reserr.Error) {
 	if s.direct > 0 {
-		s.c.Unsubscribe(s, true, s.direct, true)
-		s.c.Send(rpc.NewEvent(s.rid, "unsubscribe", rpc.UnsubscribeEvent{Reason: reason}))
+		count := s.direct
+		s.c.Unsubscribe(s, true, count, true)
+		ev := rpc.UnsubscribeEvent{Reason: reason}
+		if count > 1 {
+			ev.Count = count
+		}
+		s.c.Send(rpc.NewEvent(s.rid, "unsubscribe", ev))
 	}
 }
 
@@ -799,6 +1003,7 @@ func (s *Subscription) Dispose() {
 
 	state := s.state
 	s.state = stateDisposed
+	s.stopRevalidation()
 	s.readyCallbacks = nil
 	s.eventQueue = nil
 	s.throttle = nil
@@ -826,10 +1031,42 @@ func (s *Subscription) doneLoading() {
 	}
 }
 
+// abortLoading sets err as the error of any subscription in the tree that is
+// still loading, and marks it as ready. Any ready callback awaiting the
+// aborted subscriptions is called. A resource loaded after being aborted is
+// released.
+func (s *Subscription) abortLoading(err error) {
+	var loading []*Subscription
+	s.collectLoading(make(map[*Subscription]bool), &loading)
+	for _, sub := range loading {
+		// Callbacks of a previous subscription might have disposed it
+		if sub.state == stateLoading {
+			sub.err = err
+			sub.doneLoading()
+		}
+	}
+}
+
+// collectLoading adds any subscription in the tree that is still loading to
+// loading.
+func (s *Subscription) collectLoading(visited map[*Subscription]bool, loading *[]*Subscription) {
+	if visited[s] {
+		return
+	}
+	visited[s] = true
+	if s.state == stateLoading {
+		*loading = append(*loading, s)
+		return
+	}
+	for _, ref := range s.refs {
+		ref.sub.collectLoading(visited, loading)
+	}
+}
+
 // Reaccess adds a reaccess event to the eventQueue,
 // triggering a new access request to be sent to the service.
 func (s *Subscription) Reaccess(t *rescache.Throttle) {
-	s.c.Enqueue(func() { s.reaccess(t) })
+	s.c.EnqueueTask(taskEvent, func() { s.reaccess(t) }, nil)
 }
 
 func (s *Subscription) reaccess(t *rescache.Throttle) {
@@ -837,6 +1074,8 @@ func (s *Subscription) reaccess(t *rescache.Throttle) {
 		return
 	}
 
+	s.c.InvalidateAccessScopes(s.resourceName)
+
 	if s.queueFlag != 0 {
 		s.flags |= flagReaccess
 		return
@@ -867,11 +1106,14 @@ func (s *Subscription) loadAccess(cb func(*rescache.Access), t *rescache.Throttl
 	}
 
 	s.flags |= flagAccessCalled
+	// The request headers are read on the connection's goroutine, as the
+	// access request may be sent later by the throttle.
+	requestHeaders := s.c.RequestHeaders()
 
 	if t != nil {
 		t.Add(func() {
-			s.c.Access(s, func(access *rescache.Access) {
-				s.c.Enqueue(func() {
+			s.c.Access(s, requestHeaders, func(access *rescache.Access) {
+				s.c.EnqueueTask(taskAccess, func() {
 					if s.state == stateDisposed {
 						return
 					}
@@ -887,13 +1129,13 @@ func (s *Subscription) loadAccess(cb func(*rescache.Access), t *rescache.Throttl
 					for _, cb := range cbs {
 						cb(access)
 					}
-				})
+				}, nil)
 				t.Done()
 			})
 		})
 	} else {
-		s.c.Access(s, func(access *rescache.Access) {
-			s.c.Enqueue(func() {
+		s.c.Access(s, requestHeaders, func(access *rescache.Access) {
+			s.c.EnqueueTask(taskAccess, func() {
 				if s.state == stateDisposed {
 					return
 				}
@@ -909,7 +1151,7 @@ func (s *Subscription) loadAccess(cb func(*rescache.Access), t *rescache.Throttl
 				for _, cb := range cbs {
 					cb(access)
 				}
-			})
+			}, nil)
 		})
 	}
 }
@@ -925,9 +1167,9 @@ func (s *Subscription) CanGet(cb func(err error)) {
 }
 
 // CanCall checks asynchronously if the client connection has access to call
-// the actionn. If access is denied, the callback will be called with an error
-// describing the reason. If access is granted, the callback will be called with
-// err being nil.
+// the actionn, or any action if action is "*". If access is denied, the
+// callback will be called with an error describing the reason. If access is
+// granted, the callback will be called with err being nil.
 func (s *Subscription) CanCall(action string, cb func(err error)) {
 	s.loadAccess(func(a *rescache.Access) {
 		cb(a.CanCall(action))
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/resgateio/resgate/logger"
+	"github.com/resgateio/resgate/server/rescache"
+)
+
+// newCountTestConn returns a connection with default settings, for testing
+// the subscription counts without any cache.
+func newCountTestConn(t *testing.T) *wsConn {
+	cfg := Config{}
+	cfg.SetDefault()
+	if err := cfg.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	return &wsConn{serv: &Service{cfg: cfg}}
+}
+
+func TestSubscriptionCount_DirectAndIndirect_ReturnsCounts(t *testing.T) {
+	type step struct {
+		Add      bool // Add a count, or else remove one
+		Direct   bool
+		Expected [2]int // Expected direct and indirect count
+	}
+	tbl := []struct {
+		Name  string
+		Steps []step
+	}{
+		{"referenced twice", []step{
+			{true, false, [2]int{0, 1}},
+			{true, false, [2]int{0, 2}},
+			{false, false, [2]int{0, 1}},
+			{false, false, [2]int{0, 0}},
+		}},
+		{"subscribed and referenced", []step{
+			{true, true, [2]int{1, 0}},
+			{true, false, [2]int{1, 1}},
+			{false, true, [2]int{0, 1}},
+			{false, false, [2]int{0, 0}},
+		}},
+		{"subscribed twice and referenced", []step{
+			{true, true, [2]int{1, 0}},
+			{true, false, [2]int{1, 1}},
+			{true, true, [2]int{2, 1}},
+			{false, false, [2]int{2, 0}},
+		}},
+	}
+	for _, l := range tbl {
+		c := newCountTestConn(t)
+		s := NewSubscription(c, "test.model", nil)
+		for i, st := range l.Steps {
+			if st.Add {
+				if err := c.addCount(s, st.Direct); err != nil {
+					t.Fatalf("expected no error adding count in step %d of %s, but got %s", i+1, l.Name, err)
+				}
+			} else {
+				c.removeCount(s, st.Direct, 1, false)
+			}
+			if got := [2]int{s.DirectCount(), s.IndirectCount()}; got != st.Expected {
+				t.Errorf("expected direct and indirect count %v in step %d of %s, but got %v", st.Expected, i+1, l.Name, got)
+			}
+		}
+	}
+}
+
+func TestSubscriptionQueueEvent_QueueExceededAfterDeleteEvent_KeepsDeleteEvent(t *testing.T) {
+	c := newCountTestConn(t)
+	c.serv.cfg.maxEventQueueSize = 2
+	c.serv.logger = logger.NewMemLogger(false, false)
+	s := NewSubscription(c, "test.model", nil)
+
+	change := &rescache.ResourceEvent{Event: "change", Update: true, Version: 0}
+	del := &rescache.ResourceEvent{Event: "delete", Version: 1}
+	custom1 := &rescache.ResourceEvent{Event: "custom", Version: 1}
+	custom2 := &rescache.ResourceEvent{Event: "custom", Version: 1}
+	for _, ev := range []*rescache.ResourceEvent{change, del, custom1, custom2} {
+		s.queueEvent(ev)
+	}
+
+	expected := []*rescache.ResourceEvent{eventOverflowEvent, del, custom2}
+	if len(s.eventQueue) != len(expected) {
+		t.Fatalf("expected %d queued events, but got %d", len(expected), len(s.eventQueue))
+	}
+	for i, ev := range expected {
+		if s.eventQueue[i] != ev {
+			t.Errorf("expected queued event %d to be %#v, but got %#v", i, ev.Event, s.eventQueue[i].Event)
+		}
+	}
+	if s.droppedEvents != 2 {
+		t.Errorf("expected 2 dropped events, but got %d", s.droppedEvents)
+	}
+	if s.version != 1 {
+		t.Errorf("expected version 1, but got %d", s.version)
+	}
+}
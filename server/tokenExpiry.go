@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/resgateio/resgate/server/codec"
+)
+
+// maxTokenTTL is the largest token TTL, in milliseconds, that can be held by a
+// time.Duration. Longer TTLs are treated as no expiry.
+const maxTokenTTL = math.MaxInt64 / int64(time.Millisecond)
+
+// setTokenExpiry starts a timer expiring the connection token after ttl
+// milliseconds, replacing any previously started timer. A ttl of zero means
+// the token does not expire.
+func (c *wsConn) setTokenExpiry(ttl int64) {
+	c.stopTokenTimer()
+	if ttl <= 0 || ttl > maxTokenTTL {
+		return
+	}
+	gen := c.tokenGen
+	c.tokenTimer = time.AfterFunc(time.Duration(ttl)*time.Millisecond, func() {
+		c.EnqueueTask(taskToken, func() {
+			// Discard if the token has been replaced since the timer started
+			if c.tokenGen != gen {
+				return
+			}
+			c.tokenTimer = nil
+			c.expireToken()
+		}, nil)
+	})
+}
+
+// stopTokenTimer stops any token expiry timer, and invalidates any expiry
+// already queued.
+func (c *wsConn) stopTokenTimer() {
+	c.tokenGen++
+	if c.tokenTimer != nil {
+		c.tokenTimer.Stop()
+		c.tokenTimer = nil
+	}
+}
+
+// expireToken handles the expiry of the connection token. If the tokenRefresh
+// setting is set, an auth request is sent on behalf of the client, letting the
+// service replace the token with a token event. If the token is not replaced,
+// it is cleared, and access is reevaluated for all subscriptions.
+func (c *wsConn) expireToken() {
+	if c.disposing {
+		return
+	}
+	cfg := c.serv.cfg
+	if cfg.TokenRefresh == nil {
+		c.Debugf("Token expired")
+		c.setToken(nil, "")
+		return
+	}
+
+	c.Debugf("Token expired: refreshing with %s", *cfg.TokenRefresh)
+	gen := c.tokenGen
+	c.auth(cfg.tokenRefreshRID, cfg.tokenRefreshAction, nil, func(_ json.RawMessage, _ string, _ *codec.Meta, err error) {
+		if err != nil {
+			c.Debugf("Token refresh failed: %s", err)
+		}
+		// Clear the token unless replaced during the auth request
+		if c.tokenGen == gen && !c.disposing {
+			c.setToken(nil, "")
+		}
+	})
+}
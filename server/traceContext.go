@@ -0,0 +1,109 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// W3C trace context header names.
+// https://www.w3.org/TR/trace-context/
+const (
+	traceparentHeader = "traceparent"
+	tracestateHeader  = "tracestate"
+)
+
+// traceContext is the W3C trace context of the HTTP request of a connection,
+// used as parent of the span created for each client request.
+type traceContext struct {
+	traceID string // Trace ID, or empty string to start a new trace per span
+	flags   string
+	state   string
+}
+
+// newTraceContext returns the trace context of the HTTP request, or nil if
+// the traceContext setting is not enabled. If the request has no valid
+// traceparent header, each span starts a new trace.
+func (s *Service) newTraceContext(r *http.Request) *traceContext {
+	if !s.cfg.TraceContext {
+		return nil
+	}
+	tc := &traceContext{flags: "01"}
+	if traceID, flags, ok := parseTraceparent(r.Header.Get(traceparentHeader)); ok {
+		tc.traceID = traceID
+		tc.flags = flags
+		tc.state = r.Header.Get(tracestateHeader)
+	}
+	return tc
+}
+
+// newSpan returns the trace context headers for a new span, to be set on the
+// service requests sent on behalf of a client request. Nil is returned if tc
+// is nil.
+func (tc *traceContext) newSpan() map[string][]string {
+	if tc == nil {
+		return nil
+	}
+	traceID := tc.traceID
+	if traceID == "" {
+		traceID = randomHex(16)
+	}
+	h := map[string][]string{
+		traceparentHeader: {"00-" + traceID + "-" + randomHex(8) + "-" + tc.flags},
+	}
+	if tc.state != "" {
+		h[tracestateHeader] = []string{tc.state}
+	}
+	return h
+}
+
+// parseTraceparent parses a traceparent header value, and returns the trace
+// ID and trace flags. False is returned if the value is not valid.
+func parseTraceparent(v string) (traceID string, flags string, ok bool) {
+	// version "-" trace-id "-" parent-id "-" trace-flags
+	if len(v) < 55 || v[2] != '-' || v[35] != '-' || v[52] != '-' {
+		return "", "", false
+	}
+	version := v[:2]
+	if !isLowerHex(version) || version == "ff" {
+		return "", "", false
+	}
+	// Version 00 has no additional fields, while later versions may have.
+	if len(v) > 55 && (version == "00" || v[55] != '-') {
+		return "", "", false
+	}
+	traceID, parentID, flags := v[3:35], v[36:52], v[53:55]
+	if !isLowerHex(traceID) || !isLowerHex(parentID) || !isLowerHex(flags) ||
+		isZeros(traceID) || isZeros(parentID) {
+		return "", "", false
+	}
+	return traceID, flags, true
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isZeros(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '0' {
+			return false
+		}
+	}
+	return true
+}
+
+// randomHex returns n random bytes encoded as lower case hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic("server: failed to read random bytes: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
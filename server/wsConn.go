@@ -8,8 +8,11 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/websocket"
+	"github.com/resgateio/resgate/metrics"
 	"github.com/resgateio/resgate/server/codec"
 	"github.com/resgateio/resgate/server/mq"
 	"github.com/resgateio/resgate/server/rescache"
@@ -18,6 +21,17 @@ import (
 	"github.com/rs/xid"
 )
 
+// Task categories used when counting tasks dropped by a disposing connection.
+const (
+	taskRequest  = "request"
+	taskResponse = "response"
+	taskAccess   = "access"
+	taskLoaded   = "loaded"
+	taskEvent    = "event"
+	taskSession  = "session"
+	taskToken    = "token"
+)
+
 type wsConn struct {
 	cid         string
 	ws          *websocket.Conn
@@ -30,6 +44,45 @@ type wsConn struct {
 	mqSub       mq.Unsubscriber
 	connStr     string
 	protocolVer int
+	reqID       string              // ID of the client request being handled
+	reqHeaders  map[string][]string // Headers set on all service requests
+	trace       *traceContext       // Trace context of the HTTP request, or nil
+	reqTrace    map[string][]string // Trace context headers of the client request being handled
+	authQuery   map[string][]string // Connection URL query parameters sent with auth requests
+	tags        map[string]string   // Tags set by the connection tagger, or nil
+	// Resource version expected by the HTTP call request being handled, or
+	// zero if no version is expected.
+	expectedVersion uint64
+
+	// Protected by the listen goroutine
+	sessionTimer *time.Timer
+
+	// Token expiry timer, and a generation counter incremented each time
+	// the timer is replaced, to discard any expiry already queued.
+	tokenTimer *time.Timer
+	tokenGen   uint
+
+	// Reconnect token issued on the last version request, and the timer
+	// disposing the connection once suspended for longer than the reconnect
+	// window.
+	reconnectToken string
+	suspendTimer   *time.Timer
+	suspendedAt    time.Time // Protected by Service.mu
+	resumed        bool      // True if resumed, awaiting the version request
+
+	// Mutex protected. The ws is only replaced by the worker goroutine.
+	closing    bool     // True once Disconnect is called
+	events     [][]byte // Events buffered while suspended, or nil
+	eventsLost bool     // True if events were lost while suspended
+
+	// Mutex protected. Time of the last incoming message or ping, checked
+	// before expiring the session.
+	lastActivity time.Time
+
+	// Mutex protected. Access scopes, ordered by pattern length, longest
+	// first, and a generation counter incremented when scopes are removed.
+	accessScopes   []accessScope
+	accessScopeGen uint
 
 	queue []func()
 	work  chan struct{}
@@ -37,30 +90,91 @@ type wsConn struct {
 	mu sync.Mutex
 }
 
+// clientRequest is the requester of service requests sent on behalf of a
+// single client request, keeping its request ID for requests sent after the
+// connection has moved on to handle other client requests.
+type clientRequest struct {
+	*wsConn
+	reqID           string
+	trace           map[string][]string
+	expectedVersion uint64
+}
+
+// RequestID returns the ID of the client request, or empty string if the
+// sendRequestId setting is not enabled.
+func (r clientRequest) RequestID() string {
+	if !r.serv.cfg.SendRequestID {
+		return ""
+	}
+	return r.reqID
+}
+
+// ExpectedVersion returns the resource version expected by the client
+// request, or zero if no version is expected.
+func (r clientRequest) ExpectedVersion() uint64 {
+	return r.expectedVersion
+}
+
+// RequestHeaders returns the headers to set on requests sent on behalf of the
+// client request, or nil if there are none.
+func (r clientRequest) RequestHeaders() map[string][]string {
+	return r.requestHeaders(r.trace)
+}
+
 var (
 	errInvalidNewResourceResponse = reserr.InternalError(errors.New("non-resource response on new request"))
 )
 
-func (s *Service) newWSConn(ws *websocket.Conn, request *http.Request, protocol int) *wsConn {
+func (s *Service) newWSConn(ws *websocket.Conn, request *http.Request, protocol int) (*wsConn, error) {
+	// The tagger is not modified once started
+	var tags map[string]string
+	if s.connTagger != nil {
+		tags = s.connTagger(request)
+	}
+	// The JWT is validated without holding the lock, as the key set may be
+	// fetched.
+	token := s.jwtToken(request)
+	// The connection ID generator is not modified once started, and is
+	// called without holding the lock.
+	cid, err := s.newCID()
+	if err != nil {
+		return nil, err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	// Check if we are stopped or are stopping
 	if s.stop == nil || s.stopping {
-		return nil
+		return nil, reserr.ErrServiceUnavailable
+	}
+
+	if _, ok := s.conns[cid]; ok {
+		return nil, fmt.Errorf("connection ID collision: %s", cid)
+	}
+
+	var authQuery map[string][]string
+	if ws != nil {
+		authQuery, request = s.authQueryParams(request)
 	}
 
 	conn := &wsConn{
-		cid:         xid.New().String(),
+		cid:         cid,
 		ws:          ws,
 		request:     request,
+		authQuery:   authQuery,
 		serv:        s,
 		subs:        make(map[string]*Subscription),
 		queue:       make([]func(), 0, WSConnWorkerQueueSize),
 		work:        make(chan struct{}, 1),
 		protocolVer: protocol,
+		reqHeaders:  s.traceHeaders(request),
+		trace:       s.newTraceContext(request),
+		tags:        tags,
+		token:       token,
 	}
-	conn.connStr = "[" + conn.cid + "]"
+	conn.connStr = "[" + conn.cid + formatTags(tags) + "]"
+	addTaggedConn(tags)
 
 	s.conns[conn.cid] = conn
 	s.wg.Add(1)
@@ -72,46 +186,287 @@ func (s *Service) newWSConn(ws *websocket.Conn, request *http.Request, protocol
 	conn.subscribeConn()
 	s.cache.AddConn(conn)
 
-	return conn
+	return conn, nil
+}
+
+// traceHeaders returns the trace ID header of the HTTP request, to be set on
+// all service requests sent on behalf of the connection. Nil is returned if
+// the traceIdHeader setting is not set, or if the request has no such header.
+func (s *Service) traceHeaders(r *http.Request) map[string][]string {
+	h := s.cfg.traceIDHeader
+	if h == "" {
+		return nil
+	}
+	v := r.Header.Get(h)
+	if v == "" {
+		return nil
+	}
+	return map[string][]string{h: {v}}
+}
+
+// newCID generates a connection ID using the connection ID generator, if
+// set. An error is returned if the ID is not a valid subject token. Any
+// collision with the ID of an active connection is checked by the caller,
+// while holding the lock.
+func (s *Service) newCID() (string, error) {
+	if s.cidGen == nil {
+		return xid.New().String(), nil
+	}
+	cid := s.cidGen()
+	if !codec.IsValidRIDPart(cid) {
+		return "", fmt.Errorf("invalid connection ID %#v: must be a valid subject token", cid)
+	}
+	return cid, nil
 }
 
 func (c *wsConn) CID() string {
 	return c.cid
 }
 
+// RequestID returns the ID of the client request being handled, or empty
+// string if the sendRequestId setting is not enabled.
+func (c *wsConn) RequestID() string {
+	if !c.serv.cfg.SendRequestID {
+		return ""
+	}
+	return c.reqID
+}
+
+// withRequest calls f with reqID set as the ID, and trace as the trace context
+// headers, of the client request being handled.
+func (c *wsConn) withRequest(reqID string, trace map[string][]string, f func()) {
+	prevID, prevTrace := c.reqID, c.reqTrace
+	c.reqID, c.reqTrace = reqID, trace
+	f()
+	c.reqID, c.reqTrace = prevID, prevTrace
+}
+
 func (c *wsConn) Token() json.RawMessage {
 	return c.token
 }
 
+// hasToken returns true if the connection has an access token set.
+func (c *wsConn) hasToken() bool {
+	return len(c.token) > 0 && string(c.token) != "null"
+}
+
 func (c *wsConn) HTTPRequest() *http.Request {
 	return c.request
 }
 
+// QueryParams returns the query parameters of the WebSocket connection URL
+// to include in auth requests, or nil if there are none.
+func (c *wsConn) QueryParams() map[string][]string {
+	return c.authQuery
+}
+
+// RequestHeaders returns the headers to set on requests sent on behalf of
+// the connection and the client request being handled, or nil if there are
+// none.
+func (c *wsConn) RequestHeaders() map[string][]string {
+	return c.requestHeaders(c.reqTrace)
+}
+
+// requestHeaders returns the connection's request headers together with the
+// trace context headers.
+func (c *wsConn) requestHeaders(trace map[string][]string) map[string][]string {
+	return mergeHeaders(trace, c.reqHeaders)
+}
+
+// withRequestHeaders returns the headers h together with the connection's
+// request headers. Trace context headers in h, such as a traceparent set by
+// the service of a referencing resource, takes precedence over those of the
+// client request.
+func (c *wsConn) withRequestHeaders(h map[string][]string) map[string][]string {
+	return mergeHeaders(mergeHeaders(c.reqTrace, h), c.reqHeaders)
+}
+
+// mergeHeaders returns the headers a together with the headers b, where b
+// takes precedence. Neither a or b is modified.
+func mergeHeaders(a, b map[string][]string) map[string][]string {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+	m := make(map[string][]string, len(a)+len(b))
+	for k, v := range a {
+		m[k] = v
+	}
+	for k, v := range b {
+		m[k] = v
+	}
+	return m
+}
+
+// TokenCookie returns the value of the token cookie sent with the HTTP
+// request, or empty string if the tokenCookie setting is not set.
+func (c *wsConn) TokenCookie() string {
+	name := c.serv.cfg.TokenCookie
+	if name == nil {
+		return ""
+	}
+	cookie, err := c.request.Cookie(*name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
 func (c *wsConn) ProtocolVersion() int {
 	return c.protocolVer
 }
 
+// Tags returns the tags set by the connection tagger, or nil if there are
+// none. The map must not be modified.
+func (c *wsConn) Tags() map[string]string {
+	return c.tags
+}
+
+// MaxEventQueueSize returns the maximum number of events queued by a
+// subscription while waiting for referenced resources to load.
+func (c *wsConn) MaxEventQueueSize() int {
+	return c.serv.cfg.maxEventQueueSize
+}
+
+func (c *wsConn) AccessRevalidateInterval() time.Duration {
+	return c.serv.cfg.accessRevalidateInterval
+}
+
 func (c *wsConn) listen() {
+	c.serve(c.ws, nil)
+}
+
+// serve reads and handles requests from the WebSocket connection until an
+// error is returned when reading. If first is not nil, it is handled as the
+// first request. If the first request resumes a suspended connection, the
+// WebSocket connection is handed over to the suspended connection.
+func (c *wsConn) serve(ws *websocket.Conn, first []byte) {
 	var in []byte
 	var err error
 
+	c.startSessionTimer(ws)
+	resumable := first == nil
+
 	// Loop until an error is returned when reading
 	for {
-		if _, in, err = c.ws.ReadMessage(); err != nil {
-			break
+		if first != nil {
+			in, first = first, nil
+		} else {
+			if _, in, err = ws.ReadMessage(); err != nil {
+				break
+			}
+			c.resetSessionTimer()
+			c.tracePayload("-->", in)
+			if resumable {
+				resumable = false
+				if sc := c.serv.takeSuspended(rpc.ReconnectToken(in)); sc != nil {
+					c.stopSessionTimer()
+					c.handOver()
+					sc.resume(ws)
+					sc.serve(ws, in)
+					return
+				}
+			}
 		}
 
-		c.Tracef("--> %s", in)
 		in := in
-		c.Enqueue(func() {
-			rpc.HandleRequest(in, c)
-		})
+		c.EnqueueTask(taskRequest, func() {
+			c.withRequest(xid.New().String(), c.trace.newSpan(), func() {
+				rpc.HandleRequest(in, c)
+			})
+		}, nil)
 	}
 
-	c.Dispose()
+	c.stopSessionTimer()
+	if !c.suspend() {
+		c.Dispose()
+	}
 	c.Tracef("Disconnected: %s", err)
 }
 
+// startSessionTimer starts the timer that expires the session once the
+// connection has been idle for longer than the configured session TTL.
+// Incoming pings are considered activity and will reset the timer.
+func (c *wsConn) startSessionTimer(ws *websocket.Conn) {
+	ttl := c.sessionTTL()
+	if ttl == 0 {
+		return
+	}
+
+	c.setLastActivity()
+	c.sessionTimer = time.AfterFunc(ttl, func() {
+		c.EnqueueTask(taskSession, c.expireSession, nil)
+	})
+
+	ws.SetPingHandler(func(data string) error {
+		c.resetSessionTimer()
+		err := ws.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+}
+
+// resetSessionTimer restarts the session timer, if one is running.
+func (c *wsConn) resetSessionTimer() {
+	if c.sessionTimer != nil {
+		c.setLastActivity()
+		c.sessionTimer.Reset(c.sessionTTL())
+	}
+}
+
+// setLastActivity sets the time of the last activity to now.
+func (c *wsConn) setLastActivity() {
+	c.mu.Lock()
+	c.lastActivity = time.Now()
+	c.mu.Unlock()
+}
+
+// stopSessionTimer stops the session timer, if one is running.
+func (c *wsConn) stopSessionTimer() {
+	if c.sessionTimer != nil {
+		c.sessionTimer.Stop()
+		c.sessionTimer = nil
+	}
+}
+
+func (c *wsConn) sessionTTL() time.Duration {
+	return time.Duration(c.serv.cfg.SessionTTL) * time.Millisecond
+}
+
+// expireSession sends an unsubscribe event for all directly subscribed
+// resources, with the reason system.sessionExpired, before disconnecting.
+func (c *wsConn) expireSession() {
+	if c.disposing {
+		return
+	}
+	// Activity may have arrived after the timer fired but before the task
+	// was handled, in which case the timer has already been reset.
+	c.mu.Lock()
+	idle := time.Since(c.lastActivity)
+	c.mu.Unlock()
+	if idle < c.sessionTTL() {
+		return
+	}
+
+	c.Debugf("Session expired after %s of inactivity", c.sessionTTL())
+
+	subs := make([]*Subscription, 0, len(c.subs))
+	for _, sub := range c.subs {
+		if sub.direct > 0 {
+			subs = append(subs, sub)
+		}
+	}
+	for _, sub := range subs {
+		sub.unsubscribeDirect(reserr.ErrSessionExpired)
+	}
+
+	c.Disconnect("Session expired")
+}
+
 // dispose closes the wsConn worker and disposes all subscription.
 // Returns false if dispose has already been called, otherwise true.
 func (c *wsConn) dispose() {
@@ -125,7 +480,10 @@ func (c *wsConn) dispose() {
 	c.mu.Unlock()
 
 	c.serv.cache.RemoveConn(c)
+	removeTaggedConn(c.tags)
 	c.unsubscribeConn()
+	c.stopTokenTimer()
+	c.stopSuspendTimer()
 
 	subs := c.subs
 	c.subs = nil
@@ -159,9 +517,14 @@ func (c *wsConn) Logf(format string, v ...interface{}) {
 	c.serv.logger.Log(fmt.Sprintf(c.connStr+" "+format, v...))
 }
 
-// Errorf writes a formatted log message
+// Errorf writes a formatted log message, including the ID of any client
+// request being handled.
 func (c *wsConn) Errorf(format string, v ...interface{}) {
-	c.serv.logger.Error(fmt.Sprintf(c.connStr+" "+format, v...))
+	prefix := c.connStr
+	if c.reqID != "" {
+		prefix += " [" + c.reqID + "]"
+	}
+	c.serv.logger.Error(fmt.Sprintf(prefix+" "+format, v...))
 }
 
 // Debugf writes a formatted log message
@@ -171,6 +534,15 @@ func (c *wsConn) Debugf(format string, v ...interface{}) {
 	}
 }
 
+// tracePayload writes a trace message with the prefix followed by the payload,
+// formatted by the payload formatter. The payload is only formatted if trace
+// logging is active.
+func (c *wsConn) tracePayload(prefix string, payload []byte) {
+	if c.serv.logger.IsTrace() {
+		c.serv.logger.Trace(c.connStr + " " + prefix + " " + c.serv.payloadFormatter.Format(payload))
+	}
+}
+
 // Tracef writes a formatted trace message
 func (c *wsConn) Tracef(format string, v ...interface{}) {
 	if c.serv.logger.IsTrace() {
@@ -178,18 +550,44 @@ func (c *wsConn) Tracef(format string, v ...interface{}) {
 	}
 }
 
-// Disconnect closes the websocket connection.
+// Disconnect sends a close message with the reason to the client, and closes
+// the WebSocket connection.
 func (c *wsConn) Disconnect(reason string) {
-	if c.ws != nil {
+	c.mu.Lock()
+	c.closing = true
+	ws := c.ws
+	c.mu.Unlock()
+	if ws != nil {
 		c.Tracef("Disconnecting - %s", reason)
-		c.ws.Close()
+		msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, truncateCloseReason(reason))
+		ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(WSTimeout))
+		ws.Close()
+	} else {
+		// A suspended connection is disposed without awaiting a reconnect.
+		go c.expireSuspend()
 	}
 }
 
+// truncateCloseReason truncates a close reason to fit within a close message,
+// without splitting any UTF-8 encoded character.
+func truncateCloseReason(reason string) string {
+	if len(reason) <= MaxCloseReasonLength {
+		return reason
+	}
+	i := MaxCloseReasonLength
+	for i > 0 && !utf8.RuneStart(reason[i]) {
+		i--
+	}
+	return reason[:i]
+}
+
 // Enqueue puts the callback function in queue to be called
 // by the wsConn worker goroutine.
 // It returns false if the function was not queued due to
 // either the connection is disposing, or it is a slow consumer.
+//
+// Enqueue is only used where a false return is expected, such as when
+// disposing. Any other task is queued with EnqueueTask.
 func (c *wsConn) Enqueue(f func()) bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -200,6 +598,23 @@ func (c *wsConn) Enqueue(f func()) bool {
 	return true
 }
 
+// EnqueueTask puts the callback function in queue, same as Enqueue, but
+// counts the task as dropped by category if the connection is disposing. If
+// the task is dropped, the drop function is called, unless nil, to release
+// any resources held by the task.
+// It returns false if the task was dropped.
+func (c *wsConn) EnqueueTask(category string, f func(), drop func()) bool {
+	if c.Enqueue(f) {
+		return true
+	}
+	metrics.WSDroppedTasks.WithLabelValues(category).Inc()
+	c.Debugf("Dropped %s task on disposed connection", category)
+	if drop != nil {
+		drop()
+	}
+	return false
+}
+
 func (c *wsConn) enqueue(f func()) {
 	count := len(c.queue)
 	c.queue = append(c.queue, f)
@@ -211,34 +626,50 @@ func (c *wsConn) enqueue(f func()) {
 }
 
 func (c *wsConn) Send(data []byte) {
+	if c.bufferEvent(data) {
+		return
+	}
 	if c.ws != nil {
-		c.Tracef("<<- %s", data)
+		c.tracePayload("<<-", data)
 		c.ws.WriteMessage(websocket.TextMessage, data)
 	}
 }
 
 func (c *wsConn) Reply(data []byte) {
 	if c.ws != nil {
-		c.Tracef("<-- %s", data)
+		c.tracePayload("<--", data)
 		c.ws.WriteMessage(websocket.TextMessage, data)
 	}
 }
 
-func (c *wsConn) GetResource(rid string, cb func(data *rpc.Resources, err error)) {
+func (c *wsConn) GetResource(rid string, lr *rpc.LoadRequest, cb func(data *rpc.Resources, err error)) {
 	sub, err := c.Subscribe(rid, true, nil, nil)
 	if err != nil {
 		cb(nil, err)
 		return
 	}
 
+	d := c.startLoadDeadline(lr, sub, func() {
+		cb(nil, reserr.ErrTimeout)
+		c.Unsubscribe(sub, true, 1, true)
+	})
+
 	sub.CanGet(func(err error) {
+		if d.expired() {
+			return
+		}
 		if err != nil {
+			d.finish()
 			cb(nil, err)
 			c.Unsubscribe(sub, true, 1, true)
 			return
 		}
 
+		d.awaitReady()
 		sub.OnReady(func() {
+			if !d.finish() {
+				return
+			}
 			err := sub.Error()
 			if err != nil {
 				cb(nil, err)
@@ -252,34 +683,55 @@ func (c *wsConn) GetResource(rid string, cb func(data *rpc.Resources, err error)
 	})
 }
 
-func (c *wsConn) SetVersion(protocol string) (string, error) {
-	// Quick exit on empty protocol
-	if protocol == "" {
-		return ProtocolVersion, nil
+func (c *wsConn) SetVersion(vr rpc.VersionRequest) (rpc.VersionResult, error) {
+	result := rpc.VersionResult{Protocol: ProtocolVersion}
+	// Replay buffered events after the version response of a resumed
+	// connection.
+	if c.resumed {
+		c.resumed = false
+		result.Resumed = true
+		c.Enqueue(c.replayEvents)
 	}
 
+	if vr.Protocol != "" {
+		v, err := parseProtocolVersion(vr.Protocol)
+		if err != nil {
+			return rpc.VersionResult{}, err
+		}
+		c.protocolVer = v
+	}
+
+	if c.serv.cfg.reconnectWindow > 0 {
+		c.reconnectToken = c.serv.newReconnectToken(c.cid)
+		result.ReconnectToken = c.reconnectToken
+	}
+
+	return result, nil
+}
+
+// parseProtocolVersion parses a protocol version string in the format
+// "[MAJOR].[MINOR].[PATCH]", returning the version as an integer.
+func parseProtocolVersion(protocol string) (int, error) {
 	parts := strings.Split(protocol, ".")
 	if len(parts) != 3 {
-		return "", reserr.ErrInvalidParams
+		return 0, reserr.ErrInvalidParams
 	}
 
 	v := 0
 	for i := 0; i < 3; i++ {
 		p, err := strconv.Atoi(parts[i])
 		if err != nil || p >= 1000 {
-			return "", reserr.ErrInvalidParams
+			return 0, reserr.ErrInvalidParams
 		}
 		v *= 1000
 		v += p
 	}
 
 	if v < 1000000 || v >= 2000000 {
-		return "", reserr.ErrUnsupportedProtocol
+		return 0, reserr.ErrUnsupportedProtocol
 	}
 
-	c.protocolVer = v
-
-	return ProtocolVersion, nil
+	return v, nil
 }
 
 func (c *wsConn) GetSubscription(rid string, cb func(sub *Subscription, err error)) {
@@ -309,21 +761,34 @@ func (c *wsConn) GetSubscription(rid string, cb func(sub *Subscription, err erro
 	})
 }
 
-func (c *wsConn) SubscribeResource(rid string, cb func(data *rpc.Resources, err error)) {
+func (c *wsConn) SubscribeResource(rid string, lr *rpc.LoadRequest, cb func(data *rpc.Resources, err error)) {
 	sub, err := c.Subscribe(rid, true, nil, nil)
 	if err != nil {
 		cb(nil, err)
 		return
 	}
 
+	d := c.startLoadDeadline(lr, sub, func() {
+		cb(nil, reserr.ErrTimeout)
+		c.Unsubscribe(sub, true, 1, true)
+	})
+
 	sub.CanGet(func(err error) {
+		if d.expired() {
+			return
+		}
 		if err != nil {
+			d.finish()
 			cb(nil, err)
 			c.Unsubscribe(sub, true, 1, true)
 			return
 		}
 
+		d.awaitReady()
 		sub.OnReady(func() {
+			if !d.finish() {
+				return
+			}
 			err := sub.Error()
 			if err != nil {
 				cb(nil, err)
@@ -337,54 +802,117 @@ func (c *wsConn) SubscribeResource(rid string, cb func(data *rpc.Resources, err
 	})
 }
 
+// OptionsResource returns the get and call access granted to the client on
+// the resource. The access is loaded as for any other request, and cached on
+// the subscription until a reaccess event is received.
+func (c *wsConn) OptionsResource(rid string, cb func(result *rpc.OptionsResult, err error)) {
+	sub, ok := c.subs[rid]
+	if !ok {
+		sub = NewSubscription(c, rid, nil)
+	}
+	sub.loadAccess(func(a *rescache.Access) {
+		if a.Error != nil && a.Error.Code != reserr.CodeAccessDenied {
+			cb(nil, a.Error)
+			return
+		}
+		cb(&rpc.OptionsResult{
+			Get:  a.CanGet() == nil,
+			Call: a.CallActions(),
+		}, nil)
+	}, nil)
+}
+
+// CallResource sends a call request for the resource. Any response meta
+// object is ignored.
 func (c *wsConn) CallResource(rid, action string, params interface{}, cb func(result interface{}, err error)) {
-	c.call(rid, action, params, func(result json.RawMessage, refRID string, err error) {
+	c.call(rid, action, params, func(result json.RawMessage, refRID string, _ *codec.Meta, err error) {
 		c.handleCallAuthResponse(result, refRID, err, cb)
 	})
 }
 
-func (c *wsConn) CallHTTPResource(rid, prefix, action string, params interface{}, cb func(result json.RawMessage, href string, err error)) {
-	c.call(rid, action, params, func(result json.RawMessage, refRID string, err error) {
+// CallHTTPResource sends a call request for the resource on behalf of an HTTP
+// request. Any response meta object is passed to the callback, both on success
+// and on error.
+func (c *wsConn) CallHTTPResource(rid, prefix, action string, params interface{}, cb func(result json.RawMessage, href string, meta *codec.Meta, err error)) {
+	c.call(rid, action, params, func(result json.RawMessage, refRID string, meta *codec.Meta, err error) {
 		if err != nil {
-			cb(nil, "", err)
+			cb(nil, "", meta, err)
 		} else if refRID != "" {
-			cb(nil, RIDToPath(refRID, prefix), nil)
+			cb(nil, RIDToPath(refRID, prefix), meta, nil)
 		} else {
-			cb(result, "", nil)
+			cb(result, "", meta, nil)
 		}
 	})
 }
 
-func (c *wsConn) call(rid, action string, params interface{}, cb func(result json.RawMessage, refRID string, err error)) {
+func (c *wsConn) call(rid, action string, params interface{}, cb func(result json.RawMessage, refRID string, meta *codec.Meta, err error)) {
 	sub, ok := c.subs[rid]
 	if !ok {
 		sub = NewSubscription(c, rid, nil)
 	}
 
+	req := clientRequest{wsConn: c, reqID: c.reqID, trace: c.reqTrace}
+	// An expected version is either checked against the cached resource, or
+	// sent to the service to decide.
+	localVersion := c.expectedVersion
+	if !c.serv.cfg.LocalIfMatch {
+		req.expectedVersion, localVersion = localVersion, 0
+	}
 	sub.CanCall(action, func(err error) {
+		if err == nil && localVersion != 0 && c.serv.cache.Version(sub.ResourceName(), sub.ResourceQuery()) != localVersion {
+			err = reserr.ErrPreconditionFailed
+		}
 		if err != nil {
-			cb(nil, "", err)
+			cb(nil, "", nil, err)
 			return
 		}
-		c.serv.cache.Call(c, sub.ResourceName(), sub.ResourceQuery(), action, c.token, params, func(result json.RawMessage, refRID string, err error) {
-			c.Enqueue(func() {
-				cb(result, refRID, err)
-			})
+		c.serv.cache.Call(req, sub.ResourceName(), sub.ResourceQuery(), action, c.token, params, func(result json.RawMessage, refRID string, meta *codec.Meta, err error) {
+			c.serv.countMethodNotFound("call."+sub.ResourceName()+"."+action, err)
+			c.EnqueueTask(taskResponse, func() {
+				c.withRequest(req.reqID, req.trace, func() {
+					cb(result, refRID, meta, err)
+				})
+			}, nil)
 		})
 	})
 }
 
+// AuthResource sends an auth request for the resource. Any response meta
+// object is ignored.
 func (c *wsConn) AuthResource(rid, action string, params interface{}, cb func(result interface{}, err error)) {
+	c.auth(rid, action, params, func(result json.RawMessage, refRID string, _ *codec.Meta, err error) {
+		c.handleCallAuthResponse(result, refRID, err, cb)
+	})
+}
+
+// AuthHTTPResource sends an auth request for the resource on behalf of an
+// HTTP request. The result is discarded, but any response meta object is
+// passed to the callback, both on success and on error.
+func (c *wsConn) AuthHTTPResource(rid, action string, params interface{}, cb func(meta *codec.Meta, err error)) {
+	c.auth(rid, action, params, func(_ json.RawMessage, _ string, meta *codec.Meta, err error) {
+		cb(meta, err)
+	})
+}
+
+func (c *wsConn) auth(rid, action string, params interface{}, cb func(result json.RawMessage, refRID string, meta *codec.Meta, err error)) {
 	rname, query := parseRID(c.ExpandCID(rid))
-	c.serv.cache.Auth(c, rname, query, action, c.token, params, func(result json.RawMessage, refRID string, err error) {
-		c.Enqueue(func() {
-			c.handleCallAuthResponse(result, refRID, err, cb)
-		})
+	if !c.serv.isResourceAllowed(rname) {
+		cb(nil, "", nil, reserr.ErrAccessDenied)
+		return
+	}
+	reqID, trace := c.reqID, c.reqTrace
+	c.serv.cache.Auth(clientRequest{wsConn: c, reqID: reqID, trace: trace}, rname, query, action, c.token, params, func(result json.RawMessage, refRID string, meta *codec.Meta, err error) {
+		c.serv.countMethodNotFound("auth."+rname+"."+action, err)
+		c.EnqueueTask(taskResponse, func() {
+			c.withRequest(reqID, trace, func() {
+				cb(result, refRID, meta, err)
+			})
+		}, nil)
 	})
 }
 
 func (c *wsConn) NewResource(rid string, params interface{}, cb func(result interface{}, err error)) {
-	c.call(rid, "new", params, func(result json.RawMessage, refRID string, err error) {
+	c.call(rid, "new", params, func(result json.RawMessage, refRID string, _ *codec.Meta, err error) {
 		if err != nil {
 			cb(nil, err)
 			return
@@ -484,7 +1012,12 @@ func (c *wsConn) subscribe(rid string, direct bool, t *rescache.Throttle, reques
 
 	sub = NewSubscription(c, rid, t)
 	_ = c.addCount(sub, direct)
-	c.serv.cache.Subscribe(sub, t, requestHeaders)
+	if c.serv.isResourceAllowed(sub.ResourceName()) {
+		c.serv.cache.Subscribe(sub, t, c.withRequestHeaders(requestHeaders))
+	} else {
+		c.Debugf("Subscription %s: Resource not allowed", rid)
+		sub.Loaded(nil, nil, reserr.ErrAccessDenied)
+	}
 
 	c.subs[rid] = sub
 	return sub, nil
@@ -496,6 +1029,12 @@ func (c *wsConn) Subscribe(rid string, direct bool, t *rescache.Throttle, reques
 	if c.disposing {
 		return nil, reserr.ErrDisposing
 	}
+	if direct && c.serv.subscribeHook != nil {
+		if err := c.serv.subscribeHook(c.cid, rid); err != nil {
+			c.Debugf("Subscription %s: Rejected by subscribe hook: %s", rid, err)
+			return nil, err
+		}
+	}
 
 	return c.subscribe(rid, direct, t, requestHeaders)
 }
@@ -532,6 +1071,7 @@ func (c *wsConn) addCount(s *Subscription, direct bool) error {
 		}
 
 		s.direct++
+		s.scheduleRevalidation()
 	} else {
 		s.indirect++
 	}
@@ -548,6 +1088,9 @@ func (c *wsConn) removeCount(s *Subscription, direct bool, count int, tryDelete
 
 	if direct {
 		s.direct -= count
+		if s.direct == 0 {
+			s.stopRevalidation()
+		}
 	} else {
 		s.indirect -= count
 	}
@@ -559,6 +1102,8 @@ func (c *wsConn) removeCount(s *Subscription, direct bool, count int, tryDelete
 
 func (c *wsConn) setToken(token json.RawMessage, tid string) {
 	c.tid = tid
+	c.stopTokenTimer()
+	c.clearAccessScopes()
 
 	if c.token == nil {
 		// No need to revalidate nil token access
@@ -566,14 +1111,35 @@ func (c *wsConn) setToken(token json.RawMessage, tid string) {
 		return
 	}
 
+	c.serv.cache.InvalidateAccessToken(c.token)
 	c.token = token
 	for _, sub := range c.subs {
 		sub.reaccess(nil)
 	}
 }
 
-func (c *wsConn) Access(s *Subscription, cb func(*rescache.Access)) {
-	c.serv.cache.Access(s, c.token, cb)
+func (c *wsConn) Access(s *Subscription, requestHeaders map[string][]string, cb func(*rescache.Access)) {
+	rname := s.ResourceName()
+	if !c.serv.isResourceAllowed(rname) {
+		cb(&rescache.Access{Error: reserr.ErrAccessDenied})
+		return
+	}
+
+	c.mu.Lock()
+	a := c.scopedAccess(rname)
+	gen := c.accessScopeGen
+	c.mu.Unlock()
+	if a != nil {
+		cb(a)
+		return
+	}
+
+	c.serv.cache.Access(s, c.token, requestHeaders, func(a *rescache.Access) {
+		if a.Error == nil && a.Scope != "" {
+			c.addAccessScope(rname, gen, a)
+		}
+		cb(a)
+	})
 }
 
 func (c *wsConn) outputWorker() {
@@ -602,7 +1168,7 @@ func (c *wsConn) outputWorker() {
 
 func (c *wsConn) subscribeConn() {
 	mqSub, err := c.serv.mq.Subscribe("conn."+c.cid, func(subj string, payload []byte, responseHeaders map[string][]string, _ error) {
-		c.Enqueue(func() {
+		c.EnqueueTask(taskEvent, func() {
 			idx := len(c.cid) + 6 // Length of "conn." + "."
 			if idx >= len(subj) {
 				c.Errorf("Error processing conn event %s: malformed event subject", subj)
@@ -614,8 +1180,10 @@ func (c *wsConn) subscribeConn() {
 			switch event {
 			case "token":
 				c.handleConnToken(payload)
+			case "disconnect":
+				c.handleConnDisconnect(payload)
 			}
-		})
+		}, nil)
 	})
 
 	if err != nil {
@@ -639,6 +1207,21 @@ func (c *wsConn) handleConnToken(payload []byte) {
 	}
 
 	c.setToken(te.Token, te.TID)
+	c.setTokenExpiry(te.TTL)
+}
+
+func (c *wsConn) handleConnDisconnect(payload []byte) {
+	de, err := codec.DecodeConnDisconnectEvent(payload)
+	if err != nil {
+		c.Errorf("Error processing disconnect event: malformed event payload: %s", err)
+		return
+	}
+
+	reason := de.Reason
+	if reason == "" {
+		reason = "Disconnected by service"
+	}
+	c.Disconnect(reason)
 }
 
 func (c *wsConn) ExpandCID(rid string) string {
@@ -646,16 +1229,42 @@ func (c *wsConn) ExpandCID(rid string) string {
 }
 
 func (c *wsConn) TokenReset(tids map[string]bool, subject string) {
-	c.Enqueue(func() {
+	c.EnqueueTask(taskEvent, func() {
 		// Exit if no token ID is set, or if it isn't affected.
-		if c.tid == "" || !tids[c.tid] {
+		if c.tid == "" || !tids[c.tid] || c.disposing {
 			return
 		}
-		c.serv.cache.CustomAuth(c, subject, "", c.token, nil, func(_ json.RawMessage, _ string, err error) {
+		c.serv.cache.CustomAuth(c, subject, "", c.token, nil, func(_ json.RawMessage, _ string, _ *codec.Meta, err error) {
 			// Discard response, but log an error if auth request timed out.
 			if err == mq.ErrRequestTimeout {
 				c.Errorf("Token reset auth request timeout on subject: %s", subject)
 			}
 		})
-	})
+	}, nil)
+}
+
+func (c *wsConn) TokenRevoke(tids map[string]bool) {
+	c.EnqueueTask(taskEvent, func() {
+		// Exit if no token ID is set, or if it isn't affected.
+		if c.tid == "" || !tids[c.tid] || c.disposing {
+			return
+		}
+		c.Debugf("Token revoked: %s", c.tid)
+		c.setToken(nil, "")
+	}, nil)
+}
+
+func (c *wsConn) TokenExpired(tids map[string]bool) {
+	c.EnqueueTask(taskEvent, func() {
+		// Exit if no token ID is set, or if it isn't affected.
+		if c.tid == "" || !tids[c.tid] || c.disposing {
+			return
+		}
+		c.Debugf("Token expired: %s", c.tid)
+		c.clearAccessScopes()
+		c.serv.cache.InvalidateAccessToken(c.token)
+		for _, sub := range c.subs {
+			sub.reaccess(nil)
+		}
+	}, nil)
 }
@@ -6,34 +6,55 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/resgateio/resgate/server/reserr"
 )
 
 func (s *Service) initWSHandler() {
-	var co func(r *http.Request) bool
-	switch s.cfg.allowOrigin[0] {
-	case "*":
-		co = func(r *http.Request) bool {
-			return true
-		}
-	default:
-		origins := s.cfg.allowOrigin
-		co = func(r *http.Request) bool {
-			origin := r.Header["Origin"]
-			if len(origin) == 0 || origin[0] == "null" {
-				return true
-			}
-			return matchesOrigins(origins, origin[0])
-		}
-	}
 	s.upgrader = websocket.Upgrader{
 		ReadBufferSize:    1024,
 		WriteBufferSize:   1024,
-		CheckOrigin:       co,
+		CheckOrigin:       s.allowOriginCheck(),
 		EnableCompression: s.cfg.WSCompression,
 	}
 	s.conns = make(map[string]*wsConn)
 }
 
+// allowOriginCheck returns the WebSocket origin check of the allowOrigin
+// setting.
+func (s *Service) allowOriginCheck() func(r *http.Request) bool {
+	if s.cfg.allowOrigin[0] == "*" {
+		return func(r *http.Request) bool {
+			return true
+		}
+	}
+	origins := s.cfg.allowOrigin
+	return func(r *http.Request) bool {
+		origin := r.Header["Origin"]
+		if len(origin) == 0 || origin[0] == "null" {
+			return true
+		}
+		return matchesOrigins(origins, origin[0])
+	}
+}
+
+// AllowedOrigins returns a WebSocket origin check, to be used with
+// SetWebSocketOriginCheck, that accepts requests with an Origin header
+// matching any of the origins, compared case-insensitively. Requests without
+// an Origin header are accepted, as they are not sent by browsers.
+func AllowedOrigins(origins ...string) func(r *http.Request) bool {
+	os := make([]string, len(origins))
+	for i, o := range origins {
+		os[i] = toLowerASCII(o)
+	}
+	return func(r *http.Request) bool {
+		origin := r.Header["Origin"]
+		if len(origin) == 0 {
+			return true
+		}
+		return matchesOrigins(os, origin[0])
+	}
+}
+
 // GetWSHandlerFunc returns the websocket http.Handler
 // Used for testing purposes
 func (s *Service) GetWSHandlerFunc() http.Handler {
@@ -41,21 +62,35 @@ func (s *Service) GetWSHandlerFunc() http.Handler {
 }
 
 func (s *Service) wsHandler(w http.ResponseWriter, r *http.Request) {
+	// Set Access-Control-* headers on all responses, including the upgrade
+	// response. Origin mismatches are rejected by the upgrader.
+	_ = s.setCommonHeaders(w, r)
+	if isPreflight(r) {
+		setPreflightHeaders(w, r, "GET, OPTIONS")
+		return
+	}
+
 	// Upgrade to gorilla websocket
-	ws, err := s.upgrader.Upgrade(w, r, nil)
+	ws, err := s.upgrader.Upgrade(w, r, w.Header())
 	if err != nil {
 		s.Debugf("Failed to upgrade connection from %s: %s", r.RemoteAddr, err.Error())
 		return
 	}
 
-	conn := s.newWSConn(ws, r, versionLegacy)
-	if conn == nil {
+	conn, err := s.newWSConn(ws, r, versionLegacy)
+	if err != nil {
+		if err != reserr.ErrServiceUnavailable {
+			s.Errorf("Failed to create connection for %s: %s", ws.RemoteAddr(), err)
+		}
+		ws.Close()
 		return
 	}
 
 	conn.Tracef("Connected: %s", ws.RemoteAddr())
 
+	s.addWSConnCount(1)
 	conn.listen()
+	s.addWSConnCount(-1)
 }
 
 // stopWSHandler disconnects all ws connections.
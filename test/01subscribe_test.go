@@ -551,3 +551,23 @@ func TestSubscribe_WithThrottleOnNestedReferences_ThrottlesRequests(t *testing.T
 		c.ReferenceThrottle = referenceThrottle
 	})
 }
+
+// Test that subscribing to a resource that is part of a two-node reference
+// cycle completes, and that both resources are sent to the client.
+func TestSubscribe_TwoNodeReferenceCycle_CompletesLoading(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.m.b", nil)
+
+		// Handle model get and access request
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.m.b").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.m.b").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.m.b") + `}`))
+		// Handle the referenced model, which references back to the first
+		s.GetRequest(t).AssertSubject(t, "get.test.m.c").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.m.c") + `}`))
+
+		// Validate client response
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.m.b":`+resourceData("test.m.b")+`,"test.m.c":`+resourceData("test.m.c")+`}}`))
+		s.AssertCacheSize(t, 2).AssertSubscriptionCount(t, 2)
+	})
+}
@@ -532,3 +532,30 @@ func TestCall_LongResourceID_ReturnsErrSubjectTooLong(t *testing.T) {
 			AssertError(t, reserr.ErrSubjectTooLong)
 	})
 }
+
+// Test that multiple calls on a subscribed resource are sent concurrently, and
+// that events on the resource are not held while the calls are in progress.
+func TestCall_MultipleCallsOnSubscribedResource_ProceedConcurrently(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		creq.GetResponse(t)
+
+		creq1 := c.Request("call.test.model.foo", nil)
+		creq2 := c.Request("call.test.model.bar", nil)
+		mreqs = s.GetParallelRequests(t, 2)
+
+		// Send event while calls are in progress
+		s.ResourceEvent("test.model", "custom", json.RawMessage(`{"zoo":"baz"}`))
+		c.GetEvent(t).Equals(t, "test.model.custom", json.RawMessage(`{"zoo":"baz"}`))
+
+		// Respond in reverse order
+		mreqs.GetRequest(t, "call.test.model.bar").RespondSuccess(json.RawMessage(`"bar"`))
+		creq2.GetResponse(t).AssertResult(t, json.RawMessage(`{"payload":"bar"}`))
+		mreqs.GetRequest(t, "call.test.model.foo").RespondSuccess(json.RawMessage(`"foo"`))
+		creq1.GetResponse(t).AssertResult(t, json.RawMessage(`{"payload":"foo"}`))
+	})
+}
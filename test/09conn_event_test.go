@@ -2,8 +2,11 @@ package test
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/gorilla/websocket"
 	"github.com/resgateio/resgate/server/reserr"
 )
 
@@ -191,3 +194,57 @@ func TestTokenEventTriggersUnsubscribeOnDeniedAccessCall(t *testing.T) {
 		c.AssertNoEvent(t, "test.collection")
 	})
 }
+
+// Test that a disconnect event closes the connection with the reason
+func TestDisconnectEvent_WithReason_ClosesConnection(t *testing.T) {
+	tbl := []struct {
+		Payload  interface{} // Disconnect event payload
+		Expected string      // Expected close reason
+	}{
+		{json.RawMessage(`{"reason":"Kicked"}`), "Kicked"},
+		{json.RawMessage(`{"reason":"Köpt"}`), "Köpt"},
+		{json.RawMessage(`{}`), "Disconnected by service"},
+		{nil, "Disconnected by service"},
+		{[]byte{}, "Disconnected by service"},
+		{json.RawMessage(`{"reason":"` + strings.Repeat("a", 200) + `"}`), strings.Repeat("a", 123)},
+		{json.RawMessage(`{"reason":"` + strings.Repeat("a", 122) + `ö"}`), strings.Repeat("a", 122)},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			cid := getCID(t, s, c)
+
+			s.ConnEvent(cid, "disconnect", l.Payload)
+			c.AssertClosedWithReason(t, websocket.CloseNormalClosure, l.Expected)
+		})
+	}
+}
+
+// Test that a disconnect event with a malformed payload is ignored
+func TestDisconnectEvent_MalformedPayload_KeepsConnection(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		cid := getCID(t, s, c)
+
+		s.ConnEvent(cid, "disconnect", json.RawMessage(`{"reason":42}`))
+		// Validate the connection is still open
+		getCID(t, s, c)
+		s.AssertErrorsLogged(t, 1)
+	})
+}
+
+// Test that a disconnect event for another connection is ignored
+func TestDisconnectEvent_OtherConnection_KeepsConnection(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c1 := s.Connect()
+		cid1 := getCID(t, s, c1)
+		c2 := s.Connect()
+		getCID(t, s, c2)
+
+		s.ConnEvent(cid1, "disconnect", json.RawMessage(`{"reason":"Kicked"}`))
+		c1.AssertClosedWithReason(t, websocket.CloseNormalClosure, "Kicked")
+		// Validate the other connection is still open
+		getCID(t, s, c2)
+	})
+}
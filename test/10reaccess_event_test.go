@@ -3,6 +3,8 @@ package test
 import (
 	"encoding/json"
 	"testing"
+
+	"github.com/resgateio/resgate/server/reserr"
 )
 
 // Test reaccess event
@@ -285,3 +287,38 @@ func TestReaccessEventOnIndirectResources(t *testing.T) {
 		c.GetEvent(t).Equals(t, "test.model.custom", event)
 	})
 }
+
+// Test that an access error response to a reaccess results in an unsubscribe
+// event with the error code, message, and data of the response, and the
+// number of removed direct subscriptions.
+func TestReaccessEventWithAccessErrorData_UnsubscribeEventIncludesErrorData(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+		c.Request("subscribe.test.model", nil).GetResponse(t)
+
+		s.ResourceEvent("test.model", "reaccess", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondError(&reserr.Error{Code: "plan.downgraded", Message: "Plan downgraded", Data: json.RawMessage(`{"plan":"free"}`)})
+
+		c.GetEvent(t).Equals(t, "test.model.unsubscribe", json.RawMessage(`{"reason":{"code":"plan.downgraded","message":"Plan downgraded","data":{"plan":"free"}},"count":2}`))
+	})
+}
+
+// Test that an error response with data, to a get request for a referenced
+// resource, is included with its data in the subscribe response errors.
+func TestSubscribeWithReferenceGetErrorData_ResponseIncludesErrorData(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model.parent", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model.parent").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model.parent").RespondSuccess(json.RawMessage(`{"model":{"name":"parent","child":{"rid":"test.model"}}}`))
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondError(&reserr.Error{Code: "custom.unavailable", Message: "Unavailable", Data: json.RawMessage(`{"retry":30}`)})
+
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model.parent":{"name":"parent","child":{"rid":"test.model"}}},"errors":{"test.model":{"code":"custom.unavailable","message":"Unavailable","data":{"retry":30}}}}`))
+	})
+}
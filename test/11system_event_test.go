@@ -10,6 +10,10 @@ import (
 	"github.com/resgateio/resgate/server/reserr"
 )
 
+func withTypeMismatchUnsubscribe(cfg *server.Config) {
+	cfg.TypeMismatchAction = "unsubscribe"
+}
+
 // Test system reset event
 func TestSystemResetEvent(t *testing.T) {
 	runTest(t, func(s *Session) {
@@ -302,7 +306,7 @@ func TestSystemReset_InternalErrorResponseOnCollection_LogsError(t *testing.T) {
 	})
 }
 
-func TestSystemReset_MismatchingResourceTypeResponseOnModel_LogsError(t *testing.T) {
+func TestSystemReset_MismatchingResourceTypeResponseOnModel_DeletesResource(t *testing.T) {
 	runTest(t, func(s *Session) {
 		c := s.Connect()
 		// Get model
@@ -311,17 +315,40 @@ func TestSystemReset_MismatchingResourceTypeResponseOnModel_LogsError(t *testing
 		s.SystemEvent("reset", json.RawMessage(`{"resources":["test.>"]}`))
 		// Respond to get request with mismatching type
 		s.GetRequest(t).AssertSubject(t, "get.test.model").RespondSuccess(json.RawMessage(`{"collection":["foo",42,true,null]}`))
-		// Validate no delete event is sent to client
-		c.AssertNoEvent(t, "test.model")
-		// Validate subsequent events are sent to client
+		// Validate delete event is sent to client
+		c.GetEvent(t).Equals(t, "test.model.delete", nil)
+		c.GetEvent(t).Equals(t, "test.model.unsubscribe", mock.UnsubscribeReasonDeleted)
+		// Validate subsequent events are not sent to client
 		s.ResourceEvent("test.model", "custom", common.CustomEvent())
-		c.GetEvent(t).Equals(t, "test.model.custom", common.CustomEvent())
+		c.AssertNoEvent(t, "test.model")
 		// Assert error is logged
 		s.AssertErrorsLogged(t, 1)
 	})
 }
 
-func TestSystemReset_MismatchingResourceTypeResponseOnCollection_LogsError(t *testing.T) {
+func TestSystemReset_MismatchingResourceTypeResponseOnModelWithUnsubscribeAction_UnsubscribesResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		// Get model
+		subscribeToTestModel(t, s, c)
+		// Send system reset
+		s.SystemEvent("reset", json.RawMessage(`{"resources":["test.>"]}`))
+		// Respond to get request with mismatching type
+		s.GetRequest(t).AssertSubject(t, "get.test.model").RespondSuccess(json.RawMessage(`{"collection":["foo",42,true,null]}`))
+		// Validate unsubscribe event is sent to client
+		c.GetEvent(t).Equals(t, "test.model.unsubscribe", mock.UnsubscribeReasonTypeMismatch)
+		// Validate subsequent subscribe makes a new get request
+		creq := c.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"collection":["foo",42,true,null]}`))
+		creq.GetResponse(t)
+		// Assert error is logged
+		s.AssertErrorsLogged(t, 1)
+	}, withTypeMismatchUnsubscribe)
+}
+
+func TestSystemReset_MismatchingResourceTypeResponseOnCollection_DeletesResource(t *testing.T) {
 	runTest(t, func(s *Session) {
 		c := s.Connect()
 		// Get collection
@@ -330,16 +357,39 @@ func TestSystemReset_MismatchingResourceTypeResponseOnCollection_LogsError(t *te
 		s.SystemEvent("reset", json.RawMessage(`{"resources":["test.>"]}`))
 		// Respond to get request with mismatching type
 		s.GetRequest(t).AssertSubject(t, "get.test.collection").RespondSuccess(json.RawMessage(`{"model":{"string":"foo","int":42,"bool":true,"null":null}}`))
-		// Validate no delete event is sent to client
-		c.AssertNoEvent(t, "test.collection")
-		// Validate subsequent events are sent to client
+		// Validate delete event is sent to client
+		c.GetEvent(t).Equals(t, "test.collection.delete", nil)
+		c.GetEvent(t).Equals(t, "test.collection.unsubscribe", mock.UnsubscribeReasonDeleted)
+		// Validate subsequent events are not sent to client
 		s.ResourceEvent("test.collection", "custom", common.CustomEvent())
-		c.GetEvent(t).Equals(t, "test.collection.custom", common.CustomEvent())
+		c.AssertNoEvent(t, "test.collection")
 		// Assert error is logged
 		s.AssertErrorsLogged(t, 1)
 	})
 }
 
+func TestSystemReset_MismatchingResourceTypeResponseOnCollectionWithUnsubscribeAction_UnsubscribesResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		// Get collection
+		subscribeToTestCollection(t, s, c)
+		// Send system reset
+		s.SystemEvent("reset", json.RawMessage(`{"resources":["test.>"]}`))
+		// Respond to get request with mismatching type
+		s.GetRequest(t).AssertSubject(t, "get.test.collection").RespondSuccess(json.RawMessage(`{"model":{"string":"foo","int":42,"bool":true,"null":null}}`))
+		// Validate unsubscribe event is sent to client
+		c.GetEvent(t).Equals(t, "test.collection.unsubscribe", mock.UnsubscribeReasonTypeMismatch)
+		// Validate subsequent subscribe makes a new get request
+		creq := c.Request("subscribe.test.collection", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.collection").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.collection").RespondSuccess(json.RawMessage(`{"model":{"string":"foo","int":42,"bool":true,"null":null}}`))
+		creq.GetResponse(t)
+		// Assert error is logged
+		s.AssertErrorsLogged(t, 1)
+	}, withTypeMismatchUnsubscribe)
+}
+
 func TestSystemReset_WithThrottle_ThrottlesRequests(t *testing.T) {
 	const subscriptionCount = 10
 	const resetThrottle = 3
@@ -796,3 +846,129 @@ func TestSystemTokenReset_WithTimeoutOnAuthRequest_LogsError(t *testing.T) {
 		s.AssertErrorsLogged(t, 1)
 	})
 }
+
+func TestSystemTokenRevoke_WithMatchingTokenID_ClearsTokenOnAllConnections(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c1 := s.Connect()
+		c2 := s.Connect()
+		token := json.RawMessage(`{"user":"foo"}`)
+
+		// Subscribe to restricted resources
+		subscribeToTestModel(t, s, c1)
+		subscribeToTestCollection(t, s, c2)
+
+		// Send token events with a shared token ID
+		s.ConnEvent(getCID(t, s, c1), "token", json.RawMessage(`{"token":`+string(token)+`,"tid":"foo"}`))
+		s.ConnEvent(getCID(t, s, c2), "token", json.RawMessage(`{"token":`+string(token)+`,"tid":"foo"}`))
+
+		// Send system token revoke
+		s.SystemEvent("tokenRevoke", json.RawMessage(`{"tids":["bar","foo"]}`))
+
+		// Validate access requests are sent without token
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").
+			AssertPathPayload(t, "token", nil).
+			RespondError(reserr.ErrAccessDenied)
+		mreqs.GetRequest(t, "access.test.collection").
+			AssertPathPayload(t, "token", nil).
+			RespondError(reserr.ErrAccessDenied)
+
+		// Validate both connections are unsubscribed
+		c1.GetEvent(t).Equals(t, "test.model.unsubscribe", reasonAccessDenied)
+		c2.GetEvent(t).Equals(t, "test.collection.unsubscribe", reasonAccessDenied)
+	})
+}
+
+func TestSystemTokenExpired_WithMatchingTokenID_SendsAccessRequestsOnAllConnections(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c1 := s.Connect()
+		c2 := s.Connect()
+		token := json.RawMessage(`{"user":"foo"}`)
+
+		// Subscribe to restricted resources
+		subscribeToTestModel(t, s, c1)
+		subscribeToTestCollection(t, s, c2)
+
+		// Send token events with a shared token ID
+		s.ConnEvent(getCID(t, s, c1), "token", json.RawMessage(`{"token":`+string(token)+`,"tid":"foo"}`))
+		s.ConnEvent(getCID(t, s, c2), "token", json.RawMessage(`{"token":`+string(token)+`,"tid":"foo"}`))
+
+		// Send system token expired
+		s.SystemEvent("tokenExpired", json.RawMessage(`{"tids":["bar","foo"]}`))
+
+		// Validate access requests are sent with the expired token
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").
+			AssertPathPayload(t, "token.user", "foo").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "access.test.collection").
+			AssertPathPayload(t, "token.user", "foo").
+			RespondError(reserr.ErrAccessDenied)
+
+		// Validate only the denied subscription is unsubscribed
+		c2.GetEvent(t).Equals(t, "test.collection.unsubscribe", reasonAccessDenied)
+		c1.AssertNoEvent(t, "test.model")
+	})
+}
+
+// tokenIDEvents are the system events affecting connections by token ID,
+// other than tokenReset.
+var tokenIDEvents = []string{"tokenRevoke", "tokenExpired"}
+
+func TestSystemTokenIDEvent_WithMismatchingTokenIDs_SendsNoRequest(t *testing.T) {
+	for _, event := range tokenIDEvents {
+		runNamedTest(t, event, func(s *Session) {
+			c := s.Connect()
+
+			// Get model
+			subscribeToTestModel(t, s, c)
+			cid := getCID(t, s, c)
+
+			// Send token event
+			s.ConnEvent(cid, "token", json.RawMessage(`{"token":{"user":"foo"},"tid":"foo"}`))
+
+			// Send system event
+			s.SystemEvent(event, json.RawMessage(`{"tids":["bar","baz"]}`))
+
+			// Validate no request
+			c.AssertNoNATSRequest(t, "test.model")
+		})
+	}
+}
+
+func TestSystemTokenIDEvent_WithReplacedTokenID_SendsNoRequest(t *testing.T) {
+	for _, event := range tokenIDEvents {
+		runNamedTest(t, event, func(s *Session) {
+			c := s.Connect()
+
+			// Get model
+			subscribeToTestModel(t, s, c)
+			cid := getCID(t, s, c)
+
+			// Send token events, replacing the token ID
+			s.ConnEvent(cid, "token", json.RawMessage(`{"token":{"user":"foo"},"tid":"foo"}`))
+			s.ConnEvent(cid, "token", json.RawMessage(`{"token":{"user":"bar"},"tid":"bar"}`))
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				AssertPathPayload(t, "token.user", "bar").
+				RespondSuccess(json.RawMessage(`{"get":true}`))
+
+			// Send system event on the replaced token ID
+			s.SystemEvent(event, json.RawMessage(`{"tids":["foo"]}`))
+
+			// Validate no request
+			c.AssertNoNATSRequest(t, "test.model")
+		})
+	}
+}
+
+func TestSystemTokenIDEvent_WithBrokenEvent_LogsError(t *testing.T) {
+	for _, event := range tokenIDEvents {
+		runNamedTest(t, event, func(s *Session) {
+			// Send system event
+			s.SystemEvent(event, json.RawMessage(`{"tids":"foo"}`))
+			// Validate logged errors
+			s.AssertErrorsLogged(t, 1)
+		})
+	}
+}
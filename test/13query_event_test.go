@@ -90,6 +90,7 @@ func TestModelQueryEventOnSameNormalizedQueryResultsInSingleQueryRequest(t *test
 		// Validate no events was sent to the client
 		c.AssertNoEvent(t, "test.model")
 		c.AssertNoNATSRequest(t, "test.model")
+		s.AssertNATSRequestCount(t, "_EVENT_01_", 1)
 	})
 }
 
@@ -524,7 +525,7 @@ func TestQueryEvent_CollectionResponse_CausesAddRemoveEvents(t *testing.T) {
 	})
 }
 
-func TestQueryEvent_CollectionResponseOnModel_CausesErrorLog(t *testing.T) {
+func TestQueryEvent_CollectionResponseOnModel_DeletesResource(t *testing.T) {
 	runTest(t, func(s *Session) {
 		c := s.Connect()
 		subscribeToTestQueryModel(t, s, c, "q=foo&f=bar", "q=foo&f=bar")
@@ -534,13 +535,33 @@ func TestQueryEvent_CollectionResponseOnModel_CausesErrorLog(t *testing.T) {
 		// Respond to query request with a collection
 		s.GetRequest(t).RespondSuccess(json.RawMessage(`{"collection":["foo","bar",42,true]}`))
 
-		// Validate no events was sent to client and an error was logged
-		c.AssertNoEvent(t, "test.model")
+		// Validate delete event was sent to client and an error was logged
+		c.GetEvent(t).Equals(t, "test.model?q=foo&f=bar.delete", nil)
+		c.GetEvent(t).Equals(t, "test.model?q=foo&f=bar.unsubscribe", mock.UnsubscribeReasonDeleted)
 		s.AssertErrorsLogged(t, 1)
+		// Validate subsequent query events does not send request
+		s.ResourceEvent("test.model", "query", json.RawMessage(`{"subject":"_EVENT_02_"}`))
+		c.AssertNoNATSRequest(t, "test.model")
 	})
 }
 
-func TestQueryEvent_ModelResponseOnCollection_CausesErrorLog(t *testing.T) {
+func TestQueryEvent_CollectionResponseOnModelWithUnsubscribeAction_UnsubscribesResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestQueryModel(t, s, c, "q=foo&f=bar", "q=foo&f=bar")
+
+		// Send query event
+		s.ResourceEvent("test.model", "query", json.RawMessage(`{"subject":"_EVENT_01_"}`))
+		// Respond to query request with a collection
+		s.GetRequest(t).RespondSuccess(json.RawMessage(`{"collection":["foo","bar",42,true]}`))
+
+		// Validate unsubscribe event was sent to client and an error was logged
+		c.GetEvent(t).Equals(t, "test.model?q=foo&f=bar.unsubscribe", mock.UnsubscribeReasonTypeMismatch)
+		s.AssertErrorsLogged(t, 1)
+	}, withTypeMismatchUnsubscribe)
+}
+
+func TestQueryEvent_ModelResponseOnCollection_DeletesResource(t *testing.T) {
 	runTest(t, func(s *Session) {
 		c := s.Connect()
 		subscribeToTestQueryCollection(t, s, c, "q=foo&f=bar", "q=foo&f=bar")
@@ -550,19 +571,38 @@ func TestQueryEvent_ModelResponseOnCollection_CausesErrorLog(t *testing.T) {
 		// Respond to query request with a model
 		s.GetRequest(t).RespondSuccess(json.RawMessage(`{"model":{"string":"bar","int":-12,"bool":true}}`))
 
-		// Validate no events was sent to client and an error was logged
-		c.AssertNoEvent(t, "test.collection")
+		// Validate delete event was sent to client and an error was logged
+		c.GetEvent(t).Equals(t, "test.collection?q=foo&f=bar.delete", nil)
+		c.GetEvent(t).Equals(t, "test.collection?q=foo&f=bar.unsubscribe", mock.UnsubscribeReasonDeleted)
 		s.AssertErrorsLogged(t, 1)
+		// Validate subsequent query events does not send request
+		s.ResourceEvent("test.collection", "query", json.RawMessage(`{"subject":"_EVENT_02_"}`))
+		c.AssertNoNATSRequest(t, "test.collection")
 	})
 }
 
+func TestQueryEvent_ModelResponseOnCollectionWithUnsubscribeAction_UnsubscribesResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestQueryCollection(t, s, c, "q=foo&f=bar", "q=foo&f=bar")
+
+		// Send query event
+		s.ResourceEvent("test.collection", "query", json.RawMessage(`{"subject":"_EVENT_01_"}`))
+		// Respond to query request with a model
+		s.GetRequest(t).RespondSuccess(json.RawMessage(`{"model":{"string":"bar","int":-12,"bool":true}}`))
+
+		// Validate unsubscribe event was sent to client and an error was logged
+		c.GetEvent(t).Equals(t, "test.collection?q=foo&f=bar.unsubscribe", mock.UnsubscribeReasonTypeMismatch)
+		s.AssertErrorsLogged(t, 1)
+	}, withTypeMismatchUnsubscribe)
+}
+
 func TestQueryEvent_InvalidResponseOnModelResource_CausesErrorLog(t *testing.T) {
 	tbl := []struct {
 		InvalidQueryResponse string // Raw query event payload
 	}{
 		{`{"events":"foo"}`},
 		{`{"model":[]}`},
-		{`{"collection":[]}`},
 		{`{"model":{},"events":[]}`},
 		{`{"model":{"string":"bar"},"events":[]}`},
 		{`{"model":{},"events":[{"event":"change","data":{"values":{"string":"bar","int":-12}}}]}`},
@@ -592,7 +632,6 @@ func TestQueryEvent_InvalidResponseOnCollectionResource_CausesErrorLog(t *testin
 	}{
 		{`{"events":"foo"}`},
 		{`{"collection":{}}`},
-		{`{"model":{}}`},
 		{`{"collection":[],"events":[]}`},
 		{`{"collection":["foo","bar"],"events":[]}`},
 		{`{"collection":[],"events":[{"event":"add","data":{"idx":1,"value":"bar"}}]}`},
@@ -691,6 +730,7 @@ func TestQueryEvent_DeleteEventOnModel_DeletesFromCache(t *testing.T) {
 	runTest(t, func(s *Session) {
 		c := s.Connect()
 		subscribeToTestQueryModel(t, s, c, "q=foo&f=bar", "q=foo&f=bar")
+		s.AssertCacheSize(t, 1).AssertSubscriptionCount(t, 1)
 		// Send query event
 		s.ResourceEvent("test.model", "query", json.RawMessage(`{"subject":"_EVENT_01_"}`))
 		// Respond to query request with an error
@@ -699,6 +739,8 @@ func TestQueryEvent_DeleteEventOnModel_DeletesFromCache(t *testing.T) {
 		c.GetEvent(t).Equals(t, "test.model?q=foo&f=bar.delete", nil)
 		c.GetEvent(t).Equals(t, "test.model?q=foo&f=bar.unsubscribe", mock.UnsubscribeReasonDeleted)
 		c.AssertNoEvent(t, "test.model")
+		// Validate the query resource is removed from the cache
+		s.AssertCacheSize(t, 0).AssertSubscriptionCount(t, 0)
 		// Validate subsequent query events does not send request
 		s.ResourceEvent("test.model", "query", json.RawMessage(`{"subject":"_EVENT_02_"}`))
 		c.AssertNoNATSRequest(t, "test.model")
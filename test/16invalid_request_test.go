@@ -20,24 +20,29 @@ func TestResponseOnInvalidRequests(t *testing.T) {
 		{"unknown.test", nil, reserr.ErrInvalidRequest},
 		{"call.test", nil, reserr.ErrInvalidRequest},
 		{"call.test", nil, reserr.ErrInvalidRequest},
-		{"call.test.methöd", nil, reserr.ErrInvalidRequest},
+		{"call.test.methöd", nil, invalidRIDError(9, "illegal character")},
 		{"call.test?foo", nil, reserr.ErrInvalidRequest},
-		{"call.test.method?foo", nil, reserr.ErrInvalidRequest},
+		{"call.test.method?foo", nil, invalidRIDError(11, "illegal character")},
 		{"auth.test", nil, reserr.ErrInvalidRequest},
-		{"subscribe..test.model", nil, reserr.ErrInvalidRequest},
-		{"subscribe.test..model", nil, reserr.ErrInvalidRequest},
-		{"subscribe.test.model.", nil, reserr.ErrInvalidRequest},
+		{"subscribe..test.model", nil, invalidRIDError(0, "empty segment")},
+		{"subscribe.test..model", nil, invalidRIDError(5, "empty segment")},
+		{"subscribe.test.model.", nil, invalidRIDError(11, "empty segment")},
 		{".subscribe.test.model", nil, reserr.ErrInvalidRequest},
 		{"subscribe?foo=bar", nil, reserr.ErrInvalidRequest},
-		{"subscribe.test\tmodel", nil, reserr.ErrInvalidRequest},
-		{"subscribe.test\nmodel", nil, reserr.ErrInvalidRequest},
-		{"subscribe.test\rmodel", nil, reserr.ErrInvalidRequest},
-		{"subscribe.test model", nil, reserr.ErrInvalidRequest},
-		{"subscribe.test\ufffdmodel", nil, reserr.ErrInvalidRequest},
-		{"subscribe.täst.model", nil, reserr.ErrInvalidRequest},
-		{"subscribe.test.*.model", nil, reserr.ErrInvalidRequest},
-		{"subscribe.test.>.model", nil, reserr.ErrInvalidRequest},
-		{"subscribe.test.model.>", nil, reserr.ErrInvalidRequest},
+		{"subscribe.test\tmodel", nil, invalidRIDError(4, "illegal character")},
+		{"subscribe.test\nmodel", nil, invalidRIDError(4, "illegal character")},
+		{"subscribe.test\rmodel", nil, invalidRIDError(4, "illegal character")},
+		{"subscribe.test model", nil, invalidRIDError(4, "illegal character")},
+		{"subscribe.test\ufffdmodel", nil, invalidRIDError(4, "illegal character")},
+		{"subscribe.täst.model", nil, invalidRIDError(1, "illegal character")},
+		{"subscribe.test.*.model", nil, invalidRIDError(5, "illegal character")},
+		{"subscribe.test.>.model", nil, invalidRIDError(5, "illegal character")},
+		{"subscribe.test.model.>", nil, invalidRIDError(11, "illegal character")},
+		{"get.test.*", nil, invalidRIDError(5, "illegal character")},
+		{"call.test.>.method", nil, invalidRIDError(5, "illegal character")},
+		{"auth.test.model.*", nil, invalidRIDError(11, "illegal character")},
+		{"call.test model.method", nil, invalidRIDError(4, "illegal character")},
+		{"auth.test.model.", nil, invalidRIDError(11, "empty segment")},
 	}
 
 	for i, l := range tbl {
@@ -57,3 +62,13 @@ func TestResponseOnInvalidRequests(t *testing.T) {
 		})
 	}
 }
+
+// invalidRIDError returns the expected error for an invalid resource ID, with
+// pos being the position within the resource ID part of the request method.
+func invalidRIDError(pos int, reason string) *reserr.Error {
+	return &reserr.Error{
+		Code:    reserr.CodeInvalidRequest,
+		Message: fmt.Sprintf("Invalid resource ID: %s at position %d", reason, pos),
+		Data:    map[string]interface{}{"pos": float64(pos)},
+	}
+}
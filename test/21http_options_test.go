@@ -1,13 +1,21 @@
 package test
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"testing"
 
 	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
 )
 
+// preflight sets the Access-Control-Request-Method header, making the request
+// a CORS preflight request.
+func preflight(req *http.Request) {
+	req.Header.Set("Access-Control-Request-Method", "POST")
+}
+
 func TestHTTPOptions_AllowOrigin_ExpectedResponseHeaders(t *testing.T) {
 	tbl := []struct {
 		Origin                 string            // Request's Origin header. Empty means no Origin header.
@@ -27,7 +35,7 @@ func TestHTTPOptions_AllowOrigin_ExpectedResponseHeaders(t *testing.T) {
 	for i, l := range tbl {
 		l := l
 		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
-			hreq := s.HTTPRequest("OPTIONS", "/api/test/model", nil, func(req *http.Request) {
+			hreq := s.HTTPRequest("OPTIONS", "/api/test/model", nil, preflight, func(req *http.Request) {
 				if l.Origin != "" {
 					req.Header.Set("Origin", l.Origin)
 				}
@@ -58,7 +66,7 @@ func TestHTTPOptions_RequestHeaders_ExpectedResponseHeaders(t *testing.T) {
 	for i, l := range tbl {
 		l := l
 		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
-			hreq := s.HTTPRequest("OPTIONS", "/api/test/model", nil, func(req *http.Request) {
+			hreq := s.HTTPRequest("OPTIONS", "/api/test/model", nil, preflight, func(req *http.Request) {
 				if len(l.RequestHeaders) > 0 {
 					req.Header["Access-Control-Request-Headers"] = l.RequestHeaders
 				}
@@ -75,7 +83,7 @@ func TestHTTPOptions_RequestHeaders_ExpectedResponseHeaders(t *testing.T) {
 func TestHTTPOptions_HeaderAuth_HasExpectedResponseHeaders(t *testing.T) {
 
 	runTest(t, func(s *Session) {
-		hreq := s.HTTPRequest("OPTIONS", "/api/test/model", nil)
+		hreq := s.HTTPRequest("OPTIONS", "/api/test/model", nil, preflight)
 		// Validate http response
 		hreq.GetResponse(t).
 			Equals(t, http.StatusOK, nil).
@@ -85,3 +93,72 @@ func TestHTTPOptions_HeaderAuth_HasExpectedResponseHeaders(t *testing.T) {
 		cfg.HeaderAuth = &headerAuth
 	})
 }
+
+func TestHTTPOptions_Preflight_RespondsWithoutAccessRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		s.HTTPRequest("OPTIONS", "/api/test/model", nil, preflight).
+			GetResponse(t).
+			Equals(t, http.StatusOK, nil).
+			AssertHeaders(t, map[string]string{"Access-Control-Allow-Methods": "GET, HEAD, OPTIONS, POST"}).
+			AssertMissingHeaders(t, []string{"Allow"})
+		s.Connect().AssertNoNATSRequest(t, "test.model")
+	})
+}
+
+func TestHTTPOptions_Access_ExpectedAllowHeader(t *testing.T) {
+	tbl := []struct {
+		Access   string // Access response
+		Expected string // Expected Allow header
+	}{
+		{`{"get":true,"call":"*"}`, "GET, HEAD, POST, PUT, DELETE, PATCH, OPTIONS"},
+		{`{"get":true}`, "GET, HEAD, OPTIONS"},
+		{`{"get":false,"call":"*"}`, "POST, PUT, DELETE, PATCH, OPTIONS"},
+		{`{"call":"set,delete"}`, "POST, PUT, DELETE, OPTIONS"},
+		{`{"call":"foo"}`, "POST, OPTIONS"},
+		{`{"get":true,"call":"patch"}`, "GET, HEAD, POST, PATCH, OPTIONS"},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			hreq := s.HTTPRequest("OPTIONS", "/api/test/model", nil)
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				RespondSuccess(json.RawMessage(l.Access))
+			hreq.GetResponse(t).
+				Equals(t, http.StatusOK, nil).
+				AssertHeaders(t, map[string]string{"Allow": l.Expected})
+		}, func(cfg *server.Config) {
+			putMethod, deleteMethod, patchMethod := "set", "delete", "patch"
+			cfg.PUTMethod = &putMethod
+			cfg.DELETEMethod = &deleteMethod
+			cfg.PATCHMethod = &patchMethod
+		})
+	}
+}
+
+func TestHTTPOptions_AccessDenied_RespondsWithForbidden(t *testing.T) {
+	for i, access := range []string{`{"get":false}`, `{}`} {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			hreq := s.HTTPRequest("OPTIONS", "/api/test/model", nil)
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				RespondSuccess(json.RawMessage(access))
+			hreq.GetResponse(t).
+				AssertStatusCode(t, http.StatusForbidden).
+				AssertError(t, reserr.ErrAccessDenied).
+				AssertMissingHeaders(t, []string{"Allow"})
+		})
+	}
+}
+
+func TestHTTPOptions_AccessError_RespondsWithError(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("OPTIONS", "/api/test/model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondError(reserr.ErrInternalError)
+		hreq.GetResponse(t).
+			AssertStatusCode(t, http.StatusInternalServerError).
+			AssertError(t, reserr.ErrInternalError)
+	})
+}
@@ -48,11 +48,11 @@ func TestHTTPHead_OnSuccess_NoBody(t *testing.T) {
 		req.RespondSuccess(json.RawMessage(`{"model":` + model + `}`))
 
 		// Validate http response
-		hreq.GetResponse(t).
+		hresp := hreq.GetResponse(t).
 			AssertStatusCode(t, http.StatusOK)
-		// We don't check the Body as the httptest.ResponseRecorder
-		// does not discard the written bytes to the body, unlike the
-		// actual http package.
+		if hresp.Body.Len() != 0 {
+			t.Fatalf("expected body to be empty, but got:\n%s", hresp.Body.String())
+		}
 	})
 }
 
@@ -75,3 +75,56 @@ func TestHTTPHead_OnError_NoBody(t *testing.T) {
 		// actual http package.
 	})
 }
+
+// Test that HTTP HEAD requests get the same status and headers as GET
+// requests, with Content-Length set to the length of the GET body.
+func TestHTTPHead_ComparedToGet_SameStatusAndHeaders(t *testing.T) {
+	tbl := []struct {
+		AccessResponse interface{} // Response on access request. nil means timeout
+		GetResponse    interface{} // Response on get request. nil means timeout
+	}{
+		{json.RawMessage(`{"get":true}`), json.RawMessage(`{"model":{"foo":"bar"}}`)},
+		{json.RawMessage(`{"get":true}`), reserr.ErrNotFound},
+		{json.RawMessage(`{"get":false}`), json.RawMessage(`{"model":{"foo":"bar"}}`)},
+		{reserr.ErrAccessDenied, json.RawMessage(`{"model":{"foo":"bar"}}`)},
+	}
+
+	respond := func(req *Request, r interface{}) {
+		if err, ok := r.(*reserr.Error); ok {
+			req.RespondError(err)
+		} else {
+			req.RespondSuccess(r)
+		}
+	}
+
+	for i, l := range tbl {
+		responses := make(map[string]*HTTPResponse)
+		for _, method := range []string{"GET", "HEAD"} {
+			runNamedTest(t, fmt.Sprintf("#%d %s", i+1, method), func(s *Session) {
+				hreq := s.HTTPRequest(method, "/api/test/model", nil)
+				mreqs := s.GetParallelRequests(t, 2)
+				respond(mreqs.GetRequest(t, "access.test.model"), l.AccessResponse)
+				respond(mreqs.GetRequest(t, "get.test.model"), l.GetResponse)
+				responses[method] = hreq.GetResponse(t)
+			})
+		}
+
+		get, head := responses["GET"], responses["HEAD"]
+		if head.Code != get.Code {
+			t.Fatalf("expected HEAD status to be %d, but got %d, in test #%d", get.Code, head.Code, i+1)
+		}
+		for _, h := range []string{"Content-Type", "Cache-Control", "ETag", "Last-Modified"} {
+			if head.Header().Get(h) != get.Header().Get(h) {
+				t.Fatalf("expected HEAD %s header to be %#v, but got %#v, in test #%d", h, get.Header().Get(h), head.Header().Get(h), i+1)
+			}
+		}
+		if get.Code == http.StatusOK {
+			if cl := head.Header().Get("Content-Length"); cl != fmt.Sprint(get.Body.Len()) {
+				t.Fatalf("expected HEAD Content-Length header to be %d, but got %#v, in test #%d", get.Body.Len(), cl, i+1)
+			}
+			if head.Body.Len() != 0 {
+				t.Fatalf("expected HEAD body to be empty, but got:\n%s\nin test #%d", head.Body.String(), i+1)
+			}
+		}
+	}
+}
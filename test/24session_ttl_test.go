@@ -0,0 +1,51 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+)
+
+// Test that an idle connection receives unsubscribe events for its direct
+// subscriptions before being closed, once the session TTL has passed.
+func TestSessionTTL_IdleConnection_SendsUnsubscribeAndCloses(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		c.GetEvent(t).Equals(t, "test.model.unsubscribe", mock.UnsubscribeReasonExpired)
+		c.AssertClosed(t)
+	}, func(cfg *server.Config) {
+		cfg.SessionTTL = 200
+	})
+}
+
+// Test that indirectly subscribed resources does not get unsubscribe events on
+// session expiration.
+func TestSessionTTL_IndirectSubscription_SendsUnsubscribeOnlyForDirect(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModelParent(t, s, c, false)
+
+		c.GetEvent(t).Equals(t, "test.model.parent.unsubscribe", mock.UnsubscribeReasonExpired)
+		c.AssertClosed(t)
+	}, func(cfg *server.Config) {
+		cfg.SessionTTL = 200
+	})
+}
+
+// Test that incoming messages reset the session TTL.
+func TestSessionTTL_ActiveConnection_DoesNotExpire(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		for i := 0; i < 4; i++ {
+			time.Sleep(100 * time.Millisecond)
+			c.AssertNoEvent(t, "test.model")
+		}
+	}, func(cfg *server.Config) {
+		cfg.SessionTTL = 300
+	})
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+// Test selecting model fields with a HTTP GET request
+func TestHTTPGet_WithFields_ReturnsSelectedFields(t *testing.T) {
+	runTest(t, func(s *Session) {
+		model := resourceData("test.model")
+
+		hreq := s.HTTPRequest("GET", "/api/test/model?_fields=string,int,missing", nil)
+
+		// Handle model get and access request
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.
+			GetRequest(t, "get.test.model").
+			AssertPayload(t, json.RawMessage(`{}`)).
+			RespondSuccess(json.RawMessage(`{"model":` + model + `}`))
+
+		// Validate http response
+		hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(`{"string":"foo","int":42}`))
+	})
+}
+
+// Test that the fields query parameter is stripped from the query passed to
+// the service for query resources.
+func TestHTTPGet_WithFieldsOnQueryModel_StripsFieldsFromQuery(t *testing.T) {
+	runTest(t, func(s *Session) {
+		model := resourceData("test.model")
+
+		hreq := s.HTTPRequest("GET", "/api/test/model?q=foo&_fields=bool&f=bar", nil)
+
+		// Handle model get and access request
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.
+			GetRequest(t, "access.test.model").
+			AssertPathPayload(t, "query", "q=foo&f=bar").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.
+			GetRequest(t, "get.test.model").
+			AssertPathPayload(t, "query", "q=foo&f=bar").
+			RespondSuccess(json.RawMessage(`{"model":` + model + `,"query":"q=foo&f=bar"}`))
+
+		// Validate http response
+		hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(`{"bool":true}`))
+	})
+}
+
+// Test selecting nested fields through model references with a HTTP GET request
+func TestHTTPGet_WithNestedFields_ReturnsSelectedFields(t *testing.T) {
+	tbl := []struct {
+		APIEncoding string
+		Expected    string
+	}{
+		{"json", `{"name":"grandparent","child":{"href":"/api/test/model/parent","model":{"child":{"href":"/api/test/model","model":{"string":"foo","int":42,"bool":true,"null":null}}}}}`},
+		{"jsonFlat", `{"name":"grandparent","child":{"child":{"string":"foo","int":42,"bool":true,"null":null}}}`},
+	}
+
+	for _, l := range tbl {
+		runNamedTest(t, l.APIEncoding, func(s *Session) {
+			hreq := s.HTTPRequest("GET", "/api/test/model/grandparent?_fields=name,child.child", nil)
+
+			// Handle model get and access request
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.model.grandparent").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.model.grandparent").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model.grandparent") + `}`))
+			// Handle referenced resources
+			s.GetRequest(t).AssertSubject(t, "get.test.model.parent").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model.parent") + `}`))
+			s.GetRequest(t).AssertSubject(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+
+			// Validate http response
+			hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(l.Expected))
+		}, func(c *server.Config) {
+			c.APIEncoding = l.APIEncoding
+		})
+	}
+}
+
+// Test selecting fields on a collection applies the selection to each model
+// reference element.
+func TestHTTPGet_WithFieldsOnCollection_ReturnsSelectedFieldsOfModels(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/collection/models?_fields=name,child.int", nil)
+
+		// Handle collection get and access request
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.collection.models").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.collection.models").RespondSuccess(json.RawMessage(`{"collection":["foo",{"rid":"test.model.parent"},{"rid":"test.collection"}]}`))
+		// Handle referenced resources
+		rreqs := s.GetParallelRequests(t, 2)
+		rreqs.GetRequest(t, "get.test.model.parent").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model.parent") + `}`))
+		rreqs.GetRequest(t, "get.test.collection").RespondSuccess(json.RawMessage(`{"collection":` + resourceData("test.collection") + `}`))
+		s.GetRequest(t).AssertSubject(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+
+		// Validate http response
+		hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(`["foo",{"href":"/api/test/model/parent","model":{"name":"parent","child":{"href":"/api/test/model","model":{"int":42}}}},{"href":"/api/test/collection","collection":["foo",42,true,null]}]`))
+	})
+}
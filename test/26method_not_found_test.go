@@ -0,0 +1,132 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/resgateio/resgate/metrics"
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+var errNoSuchMethod = &reserr.Error{Code: "test.noSuchMethod", Message: "No such method"}
+
+// Test that method not found responses, and configured aliases, on WebSocket
+// call and auth requests are passed to the client with the code intact, and
+// counted in metrics.
+func TestMethodNotFound_WebSocket_ReturnsErrorAndCountsMetric(t *testing.T) {
+	tbl := []struct {
+		Type         string        // Request type. Either call or auth
+		Response     *reserr.Error // Error response on the request
+		ExpectedInc  float64       // Expected metric increase
+		MetricMethod string        // Sanitized metric label
+	}{
+		{"call", reserr.ErrMethodNotFound, 1, "call.test.model.method"},
+		{"call", errNoSuchMethod, 1, "call.test.model.method"},
+		{"call", reserr.ErrInvalidParams, 0, "call.test.model.method"},
+		{"auth", reserr.ErrMethodNotFound, 1, "auth.test.model.method"},
+		{"auth", errNoSuchMethod, 1, "auth.test.model.method"},
+		{"auth", reserr.ErrInvalidParams, 0, "auth.test.model.method"},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			counter := metrics.MethodNotFoundCount.WithLabelValues(l.MetricMethod)
+			before := counterValue(t, counter)
+
+			c := s.Connect()
+			creq := c.Request(l.Type+".test.model.method", nil)
+
+			if l.Type == "call" {
+				s.GetRequest(t).
+					AssertSubject(t, "access.test.model").
+					RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+			}
+			s.GetRequest(t).
+				AssertSubject(t, l.Type+".test.model.method").
+				RespondError(l.Response)
+
+			creq.GetResponse(t).AssertError(t, l.Response)
+
+			if inc := counterValue(t, counter) - before; inc != l.ExpectedInc {
+				t.Fatalf("expected method not found metric to increase by %v, but got %v", l.ExpectedInc, inc)
+			}
+		}, func(cfg *server.Config) {
+			cfg.MethodNotFoundAliases = []string{errNoSuchMethod.Code}
+		})
+	}
+}
+
+// Test that method not found responses, and configured aliases, on HTTP POST
+// requests are returned with the configured status code, and counted in
+// metrics.
+func TestMethodNotFound_HTTPPost_ExpectedResponse(t *testing.T) {
+	tbl := []struct {
+		Aliases      []string      // Configured method not found aliases
+		Status       int           // Configured method not found status
+		Response     *reserr.Error // Error response on the call request
+		ExpectedCode int           // Expected response status code
+		ExpectedInc  float64       // Expected metric increase
+	}{
+		{nil, 0, reserr.ErrMethodNotFound, http.StatusNotFound, 1},
+		{nil, http.StatusNotFound, reserr.ErrMethodNotFound, http.StatusNotFound, 1},
+		{nil, http.StatusMethodNotAllowed, reserr.ErrMethodNotFound, http.StatusMethodNotAllowed, 1},
+		{nil, 0, errNoSuchMethod, http.StatusBadRequest, 0},
+		{[]string{errNoSuchMethod.Code}, 0, errNoSuchMethod, http.StatusNotFound, 1},
+		{[]string{errNoSuchMethod.Code}, http.StatusMethodNotAllowed, errNoSuchMethod, http.StatusMethodNotAllowed, 1},
+		{[]string{errNoSuchMethod.Code}, http.StatusMethodNotAllowed, reserr.ErrMethodNotFound, http.StatusMethodNotAllowed, 1},
+		{[]string{errNoSuchMethod.Code}, http.StatusMethodNotAllowed, reserr.ErrInvalidParams, http.StatusBadRequest, 0},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			counter := metrics.MethodNotFoundCount.WithLabelValues("call.test.model.method")
+			before := counterValue(t, counter)
+
+			hreq := s.HTTPRequest("POST", "/api/test/model/method", nil)
+
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+			s.GetRequest(t).
+				AssertSubject(t, "call.test.model.method").
+				RespondError(l.Response)
+
+			hreq.GetResponse(t).
+				AssertStatusCode(t, l.ExpectedCode).
+				AssertError(t, l.Response)
+
+			if inc := counterValue(t, counter) - before; inc != l.ExpectedInc {
+				t.Fatalf("expected method not found metric to increase by %v, but got %v", l.ExpectedInc, inc)
+			}
+		}, func(cfg *server.Config) {
+			cfg.MethodNotFoundAliases = l.Aliases
+			cfg.MethodNotFoundStatus = l.Status
+		})
+	}
+}
+
+// Test that configured method not found aliases on mapped HTTP methods are
+// returned as system.methodNotAllowed.
+func TestMethodNotFound_HTTPMappedMethodWithAlias_ReturnsMethodNotAllowed(t *testing.T) {
+	method := "method"
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("PUT", "/api/test/model", nil)
+
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.method").
+			RespondError(errNoSuchMethod)
+
+		hreq.GetResponse(t).
+			AssertStatusCode(t, http.StatusMethodNotAllowed).
+			AssertError(t, reserr.ErrMethodNotAllowed)
+	}, func(cfg *server.Config) {
+		cfg.PUTMethod = &method
+		cfg.MethodNotFoundAliases = []string{errNoSuchMethod.Code}
+	})
+}
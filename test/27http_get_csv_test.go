@@ -0,0 +1,114 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+func acceptCSV(r *http.Request) {
+	r.Header.Set("Accept", "text/csv")
+}
+
+// Test getting a collection of model references as CSV, with a stable header
+// order and quoted values.
+func TestHTTPGet_CSVCollectionOfModels_ReturnsRows(t *testing.T) {
+	collection := `[{"rid":"test.model.a"},{"rid":"test.model.b"}]`
+	modelA := `{"name":"Alice, \"A\"","age":42,"child":{"rid":"test.model"}}`
+	modelB := `{"note":"line1\nline2","name":"Bob","age":null,"active":true}`
+	expected := "age,child,name,active,note\n" +
+		"42,test.model,\"Alice, \"\"A\"\"\",,\n" +
+		",,Bob,true,\"line1\nline2\""
+
+	tbl := []struct {
+		URL  string
+		Opts []func(r *http.Request)
+	}{
+		{"/api/test/collection/models?format=csv", nil},
+		{"/api/test/collection/models", []func(r *http.Request){acceptCSV}},
+	}
+
+	for i, l := range tbl {
+		// Repeat to ensure header order does not depend on map iteration order
+		for j := 0; j < 3; j++ {
+			runNamedTest(t, fmt.Sprintf("#%d-%d", i+1, j+1), func(s *Session) {
+				hreq := s.HTTPRequest("GET", l.URL, nil, l.Opts...)
+
+				// Handle collection get and access request
+				mreqs := s.GetParallelRequests(t, 2)
+				mreqs.GetRequest(t, "access.test.collection.models").RespondSuccess(json.RawMessage(`{"get":true}`))
+				mreqs.
+					GetRequest(t, "get.test.collection.models").
+					AssertPayload(t, json.RawMessage(`{}`)).
+					RespondSuccess(json.RawMessage(`{"collection":` + collection + `}`))
+				// Handle referenced models
+				rreqs := s.GetParallelRequests(t, 2)
+				rreqs.GetRequest(t, "get.test.model.a").RespondSuccess(json.RawMessage(`{"model":` + modelA + `}`))
+				rreqs.GetRequest(t, "get.test.model.b").RespondSuccess(json.RawMessage(`{"model":` + modelB + `}`))
+				s.GetRequest(t).AssertSubject(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+
+				// Validate http response
+				hreq.GetResponse(t).
+					AssertStatusCode(t, http.StatusOK).
+					AssertHeaders(t, map[string]string{"Content-Type": "text/csv; charset=utf-8"}).
+					AssertBody(t, []byte(expected))
+			})
+		}
+	}
+}
+
+// Test getting a primitive collection as CSV returns a single column.
+func TestHTTPGet_CSVPrimitiveCollection_ReturnsSingleColumn(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/collection?q=foo&format=csv", nil)
+
+		// Handle collection get and access request
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.collection").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.
+			GetRequest(t, "get.test.collection").
+			AssertPathPayload(t, "query", "q=foo").
+			RespondSuccess(json.RawMessage(`{"collection":["foo",42,true,null,"a \"quoted\" value"],"query":"q=foo"}`))
+
+		// Validate http response
+		hreq.GetResponse(t).
+			AssertStatusCode(t, http.StatusOK).
+			AssertBody(t, []byte("value\nfoo\n42\ntrue\n\"\"\n\"a \"\"quoted\"\" value\""))
+	})
+}
+
+// Test getting a model with the CSV format parameter returns an error.
+func TestHTTPGet_CSVFormatOnModel_ReturnsBadRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/model?format=csv", nil)
+
+		// Handle model get and access request
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+
+		// Validate http response
+		hreq.GetResponse(t).
+			AssertStatusCode(t, http.StatusBadRequest).
+			AssertErrorCode(t, reserr.CodeBadRequest)
+	})
+}
+
+// Test getting a model while accepting CSV falls back to the API encoding.
+func TestHTTPGet_AcceptCSVOnModel_ReturnsJSON(t *testing.T) {
+	runTest(t, func(s *Session) {
+		model := resourceData("test.model")
+		hreq := s.HTTPRequest("GET", "/api/test/model", nil, acceptCSV)
+
+		// Handle model get and access request
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + model + `}`))
+
+		// Validate http response
+		hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(model))
+	})
+}
@@ -0,0 +1,123 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// Test that a meta object in a call response sets the status and allowed
+// headers of an HTTP POST response.
+func TestCallMeta_HTTPPost_ExpectedResponse(t *testing.T) {
+	tbl := []struct {
+		Response        string            // Raw call response
+		ExpectedCode    int               // Expected response status code
+		ExpectedBody    interface{}       // Expected response body. Nil means empty body.
+		ExpectedHeaders map[string]string // Expected response headers
+		MissingHeaders  []string          // Headers expected to be missing
+	}{
+		// Without meta
+		{`{"result":{"foo":"bar"}}`, http.StatusOK, json.RawMessage(`{"foo":"bar"}`), nil, []string{"Location", "Set-Cookie"}},
+		{`{"result":null}`, http.StatusNoContent, nil, nil, []string{"Location"}},
+		// Redirect
+		{`{"result":null,"meta":{"status":303,"header":{"Location":["/foo"]}}}`, http.StatusSeeOther, nil, map[string]string{"Location": "/foo"}, nil},
+		{`{"result":{"foo":"bar"},"meta":{"status":303,"header":{"location":["/foo"]}}}`, http.StatusSeeOther, json.RawMessage(`{"foo":"bar"}`), map[string]string{"Location": "/foo"}, nil},
+		// Set cookie
+		{`{"result":{"foo":"bar"},"meta":{"header":{"Set-Cookie":["session=abc; HttpOnly"]}}}`, http.StatusOK, json.RawMessage(`{"foo":"bar"}`), map[string]string{"Set-Cookie": "session=abc; HttpOnly"}, nil},
+		{`{"result":null,"meta":{"header":{"Set-Cookie":["session=abc"],"X-Custom":["foo"]}}}`, http.StatusNoContent, nil, map[string]string{"Set-Cookie": "session=abc", "X-Custom": "foo"}, nil},
+		// Status only
+		{`{"result":{"foo":"bar"},"meta":{"status":201}}`, http.StatusCreated, json.RawMessage(`{"foo":"bar"}`), nil, nil},
+		{`{"result":{"foo":"bar"},"meta":{}}`, http.StatusOK, json.RawMessage(`{"foo":"bar"}`), nil, nil},
+		// Resource response
+		{`{"resource":{"rid":"test.model"},"meta":{"status":201,"header":{"Set-Cookie":["session=abc"]}}}`, http.StatusCreated, nil, map[string]string{"Location": "/api/test/model", "Set-Cookie": "session=abc"}, nil},
+		// Error response
+		{`{"error":{"code":"system.accessDenied","message":"Access denied"},"meta":{"status":303,"header":{"Location":["/login"]}}}`, http.StatusSeeOther, reserr.ErrAccessDenied, map[string]string{"Location": "/login"}, nil},
+		// Headers not allowed and invalid status
+		{`{"result":{"foo":"bar"},"meta":{"status":99,"header":{"Access-Control-Allow-Origin":["evil.com"],"Content-Type":["text/html"],"X-":["foo"]}}}`, http.StatusOK, json.RawMessage(`{"foo":"bar"}`), map[string]string{"Access-Control-Allow-Origin": "*", "Content-Type": "application/json; charset=utf-8"}, []string{"X-"}},
+		{`{"result":{"foo":"bar"},"meta":{"status":600}}`, http.StatusOK, json.RawMessage(`{"foo":"bar"}`), nil, nil},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			hreq := s.HTTPRequest("POST", "/api/test/model/method", nil)
+
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+			s.GetRequest(t).
+				AssertSubject(t, "call.test.model.method").
+				RespondRaw([]byte(l.Response))
+
+			hresp := hreq.GetResponse(t).AssertStatusCode(t, l.ExpectedCode)
+			if err, ok := l.ExpectedBody.(*reserr.Error); ok {
+				hresp.AssertError(t, err)
+			} else if l.ExpectedBody != nil {
+				hresp.AssertBody(t, l.ExpectedBody)
+			} else {
+				hresp.AssertBody(t, []byte(""))
+			}
+			hresp.
+				AssertHeaders(t, l.ExpectedHeaders).
+				AssertMissingHeaders(t, l.MissingHeaders)
+		})
+	}
+}
+
+// Test that a meta object in a header auth response sets the allowed headers,
+// but not the status, of an HTTP POST response.
+func TestCallMeta_HeaderAuth_SetsHeaders(t *testing.T) {
+	tbl := []struct {
+		AuthResponse    string            // Raw auth response
+		ExpectedHeaders map[string]string // Expected response headers
+		MissingHeaders  []string          // Headers expected to be missing
+	}{
+		{`{"result":null}`, nil, []string{"Set-Cookie"}},
+		{`{"result":null,"meta":{"status":303,"header":{"Set-Cookie":["session=abc"]}}}`, map[string]string{"Set-Cookie": "session=abc"}, nil},
+		{`{"error":{"code":"system.accessDenied","message":"Access denied"},"meta":{"header":{"Set-Cookie":["session=; Max-Age=0"]}}}`, map[string]string{"Set-Cookie": "session=; Max-Age=0"}, nil},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			hreq := s.HTTPRequest("POST", "/api/test/model/method", nil)
+
+			s.GetRequest(t).
+				AssertSubject(t, "auth.vault.method").
+				RespondRaw([]byte(l.AuthResponse))
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+			s.GetRequest(t).
+				AssertSubject(t, "call.test.model.method").
+				RespondSuccess(json.RawMessage(`{"foo":"bar"}`))
+
+			hreq.GetResponse(t).
+				Equals(t, http.StatusOK, json.RawMessage(`{"foo":"bar"}`)).
+				AssertHeaders(t, l.ExpectedHeaders).
+				AssertMissingHeaders(t, l.MissingHeaders)
+		}, func(cfg *server.Config) {
+			headerAuth := "vault.method"
+			cfg.HeaderAuth = &headerAuth
+		})
+	}
+}
+
+// Test that a meta object in a call response over WebSocket is ignored.
+func TestCallMeta_WebSocket_IsIgnored(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("call.test.model.method", nil)
+
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.method").
+			RespondRaw([]byte(`{"result":{"foo":"bar"},"meta":{"status":303,"header":{"Location":["/foo"]}}}`))
+
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"payload":{"foo":"bar"}}`))
+	})
+}
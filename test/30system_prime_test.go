@@ -0,0 +1,176 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+// Test that a primed resource is served from the cache on subscribe, without
+// any get request.
+func TestSystemPrime_SubscribeAfterPrime_NoGetRequest(t *testing.T) {
+	tbl := []struct {
+		RID   string
+		Prime string
+		Data  string
+	}{
+		{"test.model", `{"rid":"test.model","model":{"string":"primed","int":12}}`, `{"models":{"test.model":{"string":"primed","int":12}}}`},
+		{"test.collection", `{"rid":"test.collection","collection":["primed",12,null]}`, `{"collections":{"test.collection":["primed",12,null]}}`},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			s.SystemEvent("prime", []byte(l.Prime))
+			s.AssertCacheSize(t, 1).AssertSubscriptionCount(t, 0)
+
+			c := s.Connect()
+			creq := c.Request("subscribe."+l.RID, nil)
+
+			// Handle access request
+			s.GetRequest(t).
+				AssertSubject(t, "access."+l.RID).
+				RespondSuccess(json.RawMessage(`{"get":true}`))
+
+			// Validate client response and that no get request is sent
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(l.Data))
+			c.AssertNoNATSRequest(t, l.RID)
+			s.AssertSubscriptionCount(t, 1)
+		})
+	}
+}
+
+// Test that events on a primed resource without subscribers update the cache.
+func TestSystemPrime_EventOnPrimedResource_UpdatesCache(t *testing.T) {
+	runTest(t, func(s *Session) {
+		s.SystemEvent("prime", []byte(`{"rid":"test.model","model":{"string":"primed","int":12}}`))
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"changed"}}`))
+
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+
+		// Handle access request
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+
+		// Validate client response
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":{"string":"changed","int":12}}}`))
+	})
+}
+
+// Test that a prime on a cached resource is applied using the same diff rules
+// as a system reset, sending events only for differences.
+func TestSystemPrime_OnCachedResource_GeneratesEvents(t *testing.T) {
+	type event struct {
+		Event   string
+		Payload string
+	}
+	tbl := []struct {
+		RID            string
+		Prime          string
+		ExpectedEvents []event
+	}{
+		{"test.model", `{"rid":"test.model","model":{"string":"foo","int":42,"bool":true,"null":null}}`, []event{}},
+		{"test.model", `{"rid":"test.model","model":{"string":"bar","int":42,"bool":true}}`, []event{
+			{"change", `{"values":{"string":"bar","null":{"action":"delete"}}}`},
+		}},
+		{"test.collection", `{"rid":"test.collection","collection":["foo",42,true,null]}`, []event{}},
+		{"test.collection", `{"rid":"test.collection","collection":["foo",42,"bar",true,null]}`, []event{
+			{"add", `{"idx":2,"value":"bar"}`},
+		}},
+		{"test.collection", `{"rid":"test.collection","collection":[42,true]}`, []event{
+			{"remove", `{"idx":3}`},
+			{"remove", `{"idx":0}`},
+		}},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			subscribeToResource(t, s, c, l.RID)
+
+			s.SystemEvent("prime", []byte(l.Prime))
+
+			for _, ev := range l.ExpectedEvents {
+				c.GetEvent(t).Equals(t, l.RID+"."+ev.Event, json.RawMessage(ev.Payload))
+			}
+			c.AssertNoEvent(t, l.RID)
+			c.AssertNoNATSRequest(t, l.RID)
+		})
+	}
+}
+
+// Test that a prime with a resource type not matching the cached resource is
+// logged as an error and ignored.
+func TestSystemPrime_MismatchingType_LogsError(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.SystemEvent("prime", json.RawMessage(`{"rid":"test.model","collection":["foo"]}`))
+
+		c.AssertNoEvent(t, "test.model")
+		s.AssertErrorsLogged(t, 1)
+	})
+}
+
+// Test that invalid prime events are logged as errors, and does not cache the
+// resource.
+func TestSystemPrime_InvalidPrime_LogsError(t *testing.T) {
+	tbl := []struct {
+		Prime string
+	}{
+		{`{]`},
+		{`{"model":{"foo":"bar"}}`},
+		{`{"rid":"test.model?q=foo","model":{"foo":"bar"}}`},
+		{`{"rid":"test.*","model":{"foo":"bar"}}`},
+		{`{"rid":"test.model"}`},
+		{`{"rid":"test.model","model":{"foo":"bar"},"collection":["foo"]}`},
+		{`{"rid":"test.model","model":{"foo":{"bar":42}}}`},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			s.SystemEvent("prime", []byte(l.Prime))
+			s.AssertErrorsLogged(t, 1)
+			s.AssertCacheSize(t, 0)
+			s.NoSubscriptions(t, "test.model")
+		})
+	}
+}
+
+// Test that prime events exceeding the configured size limit are rejected.
+func TestSystemPrime_ExceedingMaxSize_LogsError(t *testing.T) {
+	runTest(t, func(s *Session) {
+		s.SystemEvent("prime", json.RawMessage(`{"rid":"test.model","model":{"string":"`+strings.Repeat("x", 64)+`"}}`))
+		s.AssertErrorsLogged(t, 1)
+
+		// Validate the resource is fetched on subscribe
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+	}, func(cfg *server.Config) {
+		cfg.PrimeMaxSize = 64
+	})
+}
+
+// Test that prime events exceeding the configured rate limit for a service
+// name are rejected, while other service names are unaffected.
+func TestSystemPrime_ExceedingRateLimit_LogsError(t *testing.T) {
+	runTest(t, func(s *Session) {
+		s.SystemEvent("prime", json.RawMessage(`{"rid":"test.model","model":{"string":"primed"}}`))
+		s.SystemEvent("prime", json.RawMessage(`{"rid":"test.collection","collection":["primed"]}`))
+		s.SystemEvent("prime", json.RawMessage(`{"rid":"other.model","model":{"string":"primed"}}`))
+		s.AssertErrorsLogged(t, 1)
+		s.AssertCacheSize(t, 2)
+		s.NoSubscriptions(t, "test.collection")
+
+		// Validate the rejected resource is fetched on subscribe
+		c := s.Connect()
+		subscribeToTestCollection(t, s, c)
+	}, func(cfg *server.Config) {
+		cfg.PrimeRateLimit = 1
+	})
+}
@@ -0,0 +1,269 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// goldenVersions are the client protocol versions covered by the golden tests.
+var goldenVersions = []struct {
+	Name    string
+	Connect func(s *Session) *Conn
+}{
+	{"latest", func(s *Session) *Conn { return s.Connect() }},
+	{"v1.2.0", func(s *Session) *Conn { return s.ConnectWithVersion("1.2.0") }},
+	{"v1.1.1", func(s *Session) *Conn { return s.ConnectWithoutVersion() }},
+}
+
+// goldenService responds to any request sent by the gateway during a golden
+// test, using the resources in the resources map.
+type goldenService struct {
+	s      *Session
+	denied map[string]bool // Resource names for which access is denied
+}
+
+func newGoldenService(s *Session) *goldenService {
+	return &goldenService{s: s, denied: make(map[string]bool)}
+}
+
+func (gs *goldenService) respond(r *Request) {
+	subj := r.Subject
+	switch {
+	case strings.HasPrefix(subj, "access."):
+		if gs.denied[subj[len("access."):]] {
+			r.RespondSuccess(json.RawMessage(`{"get":false}`))
+		} else {
+			r.RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		}
+	case strings.HasPrefix(subj, "get."):
+		rid := subj[len("get."):]
+		rsrc, ok := resources[rid]
+		if !ok {
+			panic("test: no resource named " + rid)
+		}
+		switch rsrc.typ {
+		case typeModel:
+			r.RespondSuccess(json.RawMessage(`{"model":` + rsrc.data + `}`))
+		case typeCollection:
+			r.RespondSuccess(json.RawMessage(`{"collection":` + rsrc.data + `}`))
+		default:
+			r.RespondError(rsrc.err)
+		}
+	case subj == "call.test.model.method" || subj == "auth.test.model.method":
+		r.RespondSuccess(json.RawMessage(`{"foo":"bar"}`))
+	case subj == "call.test.model.null":
+		r.RespondSuccess(nil)
+	case subj == "call.test.model.resource":
+		r.RespondResource("test.model.parent")
+	case subj == "call.test.model.error":
+		r.RespondError(reserr.ErrInvalidParams)
+	default:
+		panic("test: unexpected request " + subj)
+	}
+}
+
+// Response serves any requests until the client request gets a response.
+func (gs *goldenService) Response(t *testing.T, creq *ClientRequest) *ClientResponse {
+	for {
+		select {
+		case resp := <-creq.ch:
+			return resp
+		case r := <-gs.s.reqs:
+			gs.respond(r)
+		case <-time.After(timeoutSeconds * time.Second):
+			t.Fatalf("expected a response to client request %#v, but found none", creq.Method)
+		}
+	}
+}
+
+// Event serves any requests until the client gets an event.
+func (gs *goldenService) Event(t *testing.T, c *Conn) *ClientEvent {
+	for {
+		select {
+		case ev := <-c.evs:
+			return ev
+		case r := <-gs.s.reqs:
+			gs.respond(r)
+		case <-time.After(timeoutSeconds * time.Second):
+			t.Fatal("expected an event, but found none")
+		}
+	}
+}
+
+// HTTP serves any requests until the HTTP request gets a response.
+func (gs *goldenService) HTTP(t *testing.T, hreq *HTTPRequest) *HTTPResponse {
+	for {
+		select {
+		case resp := <-hreq.ch:
+			return resp
+		case r := <-gs.s.reqs:
+			gs.respond(r)
+		case <-time.After(timeoutSeconds * time.Second):
+			t.Fatalf("expected a response to http request %#v, but found none", hreq.req.URL.Path)
+		}
+	}
+}
+
+// Test the client visible messages of version requests.
+func TestGolden_Version(t *testing.T) {
+	runTest(t, func(s *Session) {
+		var g Golden
+		for _, params := range []string{
+			`{"protocol":"1.999.999"}`,
+			`{"protocol":"1.2.0"}`,
+			`{"protocol":"1.1.1"}`,
+			`{"protocol":"2.0.0"}`,
+			`"1.0.0"`,
+		} {
+			c := s.ConnectWithoutVersion()
+			g.Response(c.Request("version", json.RawMessage(params)).GetResponse(t))
+		}
+		g.Assert(t, "version")
+	})
+}
+
+// Test the client visible messages of subscribe, get, and unsubscribe
+// requests, for each protocol version.
+func TestGolden_Subscribe(t *testing.T) {
+	for _, v := range goldenVersions {
+		runNamedTest(t, v.Name, func(s *Session) {
+			var g Golden
+			gs := newGoldenService(s)
+			c := v.Connect(s)
+			for _, rid := range []string{
+				"test.model.parent",
+				"test.collection.soft.parent",
+				"test.model.data.parent",
+				"test.collection.data",
+				"test.model.brokenchild",
+				"test.err.notFound",
+				"test.c.b",
+			} {
+				g.Response(gs.Response(t, c.Request("subscribe."+rid, nil)))
+			}
+			g.Response(gs.Response(t, c.Request("get.test.model.grandparent", nil)))
+			g.Response(gs.Response(t, c.Request("unsubscribe.test.model.parent", nil)))
+			g.Response(gs.Response(t, c.Request("unsubscribe.test.model.parent", nil)))
+			g.Assert(t, "subscribe_"+v.Name)
+		})
+	}
+}
+
+// Test the client visible messages of resource events, for each protocol
+// version.
+func TestGolden_Events(t *testing.T) {
+	type action struct {
+		RID     string
+		Event   string
+		Payload string
+		Events  int // Number of events sent to the client
+	}
+	actions := []action{
+		{"test.model", "change", `{"values":{"string":"bar","int":-12}}`, 1},
+		{"test.model", "change", `{"values":{"null":{"action":"delete"}}}`, 1},
+		{"test.model", "change", `{"values":{"child":{"rid":"test.model.parent"}}}`, 1},
+		{"test.model", "change", `{"values":{"soft":{"rid":"test.model.soft","soft":true},"data":{"data":{"foo":["bar"]}}}}`, 1},
+		{"test.model", "custom", `{"foo":"bar"}`, 1},
+		{"test.collection", "add", `{"idx":1,"value":"bar"}`, 1},
+		{"test.collection", "add", `{"idx":0,"value":{"rid":"test.collection.parent"}}`, 1},
+		{"test.collection", "add", `{"idx":0,"value":{"data":[1,2]}}`, 1},
+		{"test.collection", "remove", `{"idx":0}`, 1},
+		{"test.collection", "delete", ``, 2},
+	}
+
+	for _, v := range goldenVersions {
+		runNamedTest(t, v.Name, func(s *Session) {
+			var g Golden
+			gs := newGoldenService(s)
+			c := v.Connect(s)
+			g.Response(gs.Response(t, c.Request("subscribe.test.model", nil)))
+			g.Response(gs.Response(t, c.Request("subscribe.test.collection", nil)))
+
+			for _, a := range actions {
+				var payload interface{}
+				if a.Payload != "" {
+					payload = json.RawMessage(a.Payload)
+				}
+				s.ResourceEvent(a.RID, a.Event, payload)
+				for i := 0; i < a.Events; i++ {
+					g.Event(gs.Event(t, c))
+				}
+			}
+
+			// Reaccess with access denied
+			gs.denied["test.model"] = true
+			s.ResourceEvent("test.model", "reaccess", nil)
+			g.Event(gs.Event(t, c))
+
+			c.AssertNoEvent(t, "test.model")
+			c.AssertNoEvent(t, "test.collection")
+			g.Assert(t, "events_"+v.Name)
+		})
+	}
+}
+
+// Test the client visible messages of call, auth, and new requests, for each
+// protocol version.
+func TestGolden_Call(t *testing.T) {
+	for _, v := range goldenVersions {
+		runNamedTest(t, v.Name, func(s *Session) {
+			var g Golden
+			gs := newGoldenService(s)
+			c := v.Connect(s)
+			for _, method := range []string{
+				"call.test.model.method",
+				"call.test.model.null",
+				"call.test.model.resource",
+				"call.test.model.error",
+				"auth.test.model.method",
+				"call.test.model.",
+			} {
+				g.Response(gs.Response(t, c.Request(method, json.RawMessage(`{"value":42}`))))
+			}
+			gs.denied["test.model.secondparent"] = true
+			g.Response(gs.Response(t, c.Request("call.test.model.secondparent.method", nil)))
+			g.Response(gs.Response(t, c.Request("subscribe.test.model.secondparent", nil)))
+			g.Assert(t, "call_"+v.Name)
+		})
+	}
+}
+
+// Test the client visible messages of HTTP API requests, for each API
+// encoding.
+func TestGolden_HTTP(t *testing.T) {
+	for _, enc := range []string{"json", "jsonflat"} {
+		runNamedTest(t, enc, func(s *Session) {
+			var g Golden
+			gs := newGoldenService(s)
+			for _, r := range []struct {
+				Method string
+				URL    string
+			}{
+				{"GET", "/api/test/model/parent"},
+				{"GET", "/api/test/collection/soft/parent"},
+				{"GET", "/api/test/model/data/parent"},
+				{"GET", "/api/test/collection/data"},
+				{"GET", "/api/test/model/brokenchild"},
+				{"GET", "/api/test/c/b"},
+				{"GET", "/api/test/err/notFound"},
+				{"GET", "/api/test/model/"},
+				{"POST", "/api/test/model/method"},
+				{"POST", "/api/test/model/null"},
+				{"POST", "/api/test/model/resource"},
+				{"POST", "/api/test/model/error"},
+				{"PUT", "/api/test/model"},
+			} {
+				g.HTTP(gs.HTTP(t, s.HTTPRequest(r.Method, r.URL, nil)))
+			}
+			g.Assert(t, fmt.Sprintf("http_%s", enc))
+		}, func(cfg *server.Config) {
+			cfg.APIEncoding = enc
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+const httpRequestTimeout = 100 // Milliseconds
+
+func withHTTPRequestTimeout(cfg *server.Config) {
+	cfg.HTTPRequestTimeout = httpRequestTimeout
+}
+
+// assertTimeoutDuration asserts that the time elapsed since start is at least
+// the HTTP request timeout.
+func assertTimeoutDuration(t *testing.T, start time.Time) {
+	if d := time.Since(start); d < httpRequestTimeout*time.Millisecond {
+		t.Fatalf("expected response after at least %dms, but got it after %s", httpRequestTimeout, d)
+	}
+}
+
+// Test that an HTTP GET request to a silent service responds with 504
+// Gateway Timeout once the HTTP request timeout has passed, and that late
+// responses are cached.
+func TestHTTPRequestTimeout_GetWithSilentService_RespondsWithGatewayTimeout(t *testing.T) {
+	runTest(t, func(s *Session) {
+		model := resourceData("test.model")
+
+		start := time.Now()
+		hreq := s.HTTPRequest("GET", "/api/test/model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+
+		hreq.GetResponse(t).
+			AssertStatusCode(t, http.StatusGatewayTimeout).
+			AssertError(t, reserr.ErrTimeout)
+		assertTimeoutDuration(t, start)
+
+		// Late responses
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + model + `}`))
+		s.AssertCacheSize(t, 1)
+
+		// Validate the resource is served from cache
+		hreq = s.HTTPRequest("GET", "/api/test/model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(model))
+	}, withHTTPRequestTimeout)
+}
+
+// Test that an HTTP POST request to a silent service responds with 504
+// Gateway Timeout once the HTTP request timeout has passed, and that a late
+// response is discarded.
+func TestHTTPRequestTimeout_PostWithSilentService_RespondsWithGatewayTimeout(t *testing.T) {
+	runTest(t, func(s *Session) {
+		start := time.Now()
+		hreq := s.HTTPRequest("POST", "/api/test/model/method", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		req := s.GetRequest(t).AssertSubject(t, "call.test.model.method")
+
+		hreq.GetResponse(t).
+			AssertStatusCode(t, http.StatusGatewayTimeout).
+			AssertError(t, reserr.ErrTimeout)
+		assertTimeoutDuration(t, start)
+
+		// Late response
+		req.RespondSuccess(json.RawMessage(`{"foo":"bar"}`))
+
+		// Validate the gateway still handles requests
+		hreq = s.HTTPRequest("POST", "/api/test/model/method", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.method").
+			RespondSuccess(json.RawMessage(`{"foo":"bar"}`))
+		hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(`{"foo":"bar"}`))
+	}, withHTTPRequestTimeout)
+}
+
+// Test that an HTTP request responded to before the HTTP request timeout
+// gets the service response.
+func TestHTTPRequestTimeout_ResponseBeforeTimeout_RespondsWithResult(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("POST", "/api/test/model/method", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.method").
+			RespondSuccess(json.RawMessage(`{"foo":"bar"}`))
+		hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(`{"foo":"bar"}`))
+		// Wait past the timeout to ensure nothing is written twice
+		time.Sleep(2 * httpRequestTimeout * time.Millisecond)
+	}, withHTTPRequestTimeout)
+}
+
+// Test that a NATS request timeout before the HTTP request timeout results
+// in the regular timeout error response.
+func TestHTTPRequestTimeout_NATSTimeoutBeforeHTTPTimeout_RespondsWithTimeoutError(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("POST", "/api/test/model/method", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.method").
+			Timeout()
+		hreq.GetResponse(t).
+			AssertStatusCode(t, http.StatusNotFound).
+			AssertError(t, reserr.ErrTimeout)
+	}, withHTTPRequestTimeout)
+}
@@ -0,0 +1,108 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// Test that a version in a get response is included in the subscribe
+// response.
+func TestResourceVersion_SubscribeWithVersion_IncludesVersion(t *testing.T) {
+	tbl := []struct {
+		RID         string // Resource ID
+		GetResponse string // Raw get response result
+		Expected    string // Expected subscribe response result
+	}{
+		{"test.model", `{"model":{"foo":"bar"},"version":42}`, `{"models":{"test.model":{"foo":"bar"}},"versions":{"test.model":42}}`},
+		{"test.collection", `{"collection":["foo","bar"],"version":7}`, `{"collections":{"test.collection":["foo","bar"]},"versions":{"test.collection":7}}`},
+		{"test.model", `{"model":{"foo":"bar"},"version":0}`, `{"models":{"test.model":{"foo":"bar"}}}`},
+		{"test.model", `{"model":{"foo":"bar"}}`, `{"models":{"test.model":{"foo":"bar"}}}`},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			creq := c.Request("subscribe."+l.RID, nil)
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access."+l.RID).RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get."+l.RID).RespondSuccess(json.RawMessage(l.GetResponse))
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(l.Expected))
+		})
+	}
+}
+
+// Test that versions of referenced resources are included in the subscribe
+// response.
+func TestResourceVersion_SubscribeWithReferences_IncludesVersionOfEachResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model.parent", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model.parent").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model.parent").RespondSuccess(json.RawMessage(`{"model":{"child":{"rid":"test.model"}},"version":1}`))
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"},"version":2}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":{"foo":"bar"},"test.model.parent":{"child":{"rid":"test.model"}}},"versions":{"test.model":2,"test.model.parent":1}}`))
+	})
+}
+
+// Test that a version is not included once the resource has been modified by
+// an event.
+func TestResourceVersion_SubscribeAfterChangeEvent_ExcludesVersion(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"},"version":42}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":{"foo":"bar"}},"versions":{"test.model":42}}`))
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"foo":"baz"}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"foo":"baz"}}`))
+
+		c2 := s.Connect()
+		creq = c2.Request("subscribe.test.model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":{"foo":"baz"}}}`))
+	})
+}
+
+// Test that a version in a get response on a system reset replaces the
+// previous version.
+func TestResourceVersion_SystemReset_UpdatesVersion(t *testing.T) {
+	tbl := []struct {
+		ResetResponse string // Raw get response result on system reset
+		Expected      string // Expected subscribe response result after the reset
+	}{
+		{`{"model":{"foo":"bar"},"version":43}`, `{"models":{"test.model":{"foo":"bar"}},"versions":{"test.model":43}}`},
+		{`{"model":{"foo":"baz"},"version":43}`, `{"models":{"test.model":{"foo":"baz"}},"versions":{"test.model":43}}`},
+		{`{"model":{"foo":"bar"}}`, `{"models":{"test.model":{"foo":"bar"}}}`},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			creq := c.Request("subscribe.test.model", nil)
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"},"version":42}`))
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":{"foo":"bar"}},"versions":{"test.model":42}}`))
+
+			s.SystemEvent("reset", json.RawMessage(`{"resources":["test.>"]}`))
+			s.GetRequest(t).
+				AssertSubject(t, "get.test.model").
+				RespondSuccess(json.RawMessage(l.ResetResponse))
+
+			c2 := s.Connect()
+			creq = c2.Request("subscribe.test.model", nil)
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				RespondSuccess(json.RawMessage(`{"get":true}`))
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(l.Expected))
+		})
+	}
+}
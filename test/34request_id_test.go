@@ -0,0 +1,151 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+func withSendRequestID(cfg *server.Config) {
+	cfg.SendRequestID = true
+}
+
+// requestID returns the reqId of the request payload, or empty string if
+// missing.
+func requestID(t *testing.T, r *Request) string {
+	p, ok := r.Payload.(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected request payload to be an object, but got %#v", r.Payload)
+	}
+	id, _ := p["reqId"].(string)
+	return id
+}
+
+// Test that the X-Request-Id header of an HTTP request is sent as reqId in
+// service requests and returned in the response header.
+func TestRequestID_HTTPRequestWithHeader_UsesHeaderID(t *testing.T) {
+	setHeader := func(id string) func(r *http.Request) {
+		return func(r *http.Request) { r.Header.Set("X-Request-Id", id) }
+	}
+	tbl := []struct {
+		Header   string // X-Request-Id header of the request
+		Expected bool   // Expected the header ID to be used
+	}{
+		{"abc-123", true},
+		{"b6b2aa4a-3a2d-4b7c-8d7e-0a3c2f1e9b11", true},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+		{"foo bar", false},
+		{"föö", false},
+	}
+
+	for _, l := range tbl {
+		runNamedTest(t, l.Header, func(s *Session) {
+			hreq := s.HTTPRequest("POST", "/api/test/model/method", nil, setHeader(l.Header))
+			access := s.GetRequest(t).AssertSubject(t, "access.test.model")
+			id := requestID(t, access)
+			access.RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+			call := s.GetRequest(t).AssertSubject(t, "call.test.model.method")
+			if callID := requestID(t, call); callID != id {
+				t.Errorf("expected call request reqId to be %#v, but got %#v", id, callID)
+			}
+			call.RespondSuccess(json.RawMessage(`{"foo":"bar"}`))
+
+			hreq.GetResponse(t).
+				AssertStatusCode(t, http.StatusOK).
+				AssertHeaders(t, map[string]string{"X-Request-Id": id})
+			if l.Expected && id != l.Header {
+				t.Errorf("expected reqId to be %#v, but got %#v", l.Header, id)
+			}
+			if !l.Expected && (id == l.Header || id == "") {
+				t.Errorf("expected reqId to be generated, but got %#v", id)
+			}
+		}, withSendRequestID)
+	}
+}
+
+// Test that an HTTP request without X-Request-Id header gets a generated
+// request ID, sent in all service requests, including header auth requests.
+func TestRequestID_HTTPRequestWithHeaderAuth_SendsSameIDInAllRequests(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/model", nil)
+
+		auth := s.GetRequest(t).AssertSubject(t, "auth.vault.method")
+		id := requestID(t, auth)
+		if id == "" {
+			t.Fatal("expected auth request to have a reqId, but got none")
+		}
+		auth.RespondSuccess(nil)
+
+		mreqs := s.GetParallelRequests(t, 2)
+		access := mreqs.GetRequest(t, "access.test.model")
+		if accessID := requestID(t, access); accessID != id {
+			t.Errorf("expected access request reqId to be %#v, but got %#v", id, accessID)
+		}
+		access.RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+
+		hreq.GetResponse(t).
+			AssertStatusCode(t, http.StatusOK).
+			AssertHeaders(t, map[string]string{"X-Request-Id": id})
+	}, withSendRequestID, func(cfg *server.Config) {
+		headerAuth := "vault.method"
+		cfg.HeaderAuth = &headerAuth
+	})
+}
+
+// Test that the request ID is returned in the X-Request-Id header, but not
+// sent to services, when the sendRequestId setting is disabled.
+func TestRequestID_SendRequestIDDisabled_OnlySetsHeader(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("POST", "/api/test/model/method", nil, func(r *http.Request) {
+			r.Header.Set("X-Request-Id", "abc-123")
+		})
+		access := s.GetRequest(t).AssertSubject(t, "access.test.model")
+		if id := requestID(t, access); id != "" {
+			t.Errorf("expected access request to have no reqId, but got %#v", id)
+		}
+		access.RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		call := s.GetRequest(t).AssertSubject(t, "call.test.model.method")
+		if id := requestID(t, call); id != "" {
+			t.Errorf("expected call request to have no reqId, but got %#v", id)
+		}
+		call.RespondSuccess(nil)
+
+		hreq.GetResponse(t).
+			AssertStatusCode(t, http.StatusNoContent).
+			AssertHeaders(t, map[string]string{"X-Request-Id": "abc-123"})
+	})
+}
+
+// Test that service requests caused by the same WebSocket client request get
+// the same request ID, and that each client request gets a new ID.
+func TestRequestID_WebSocketCall_SendsSameIDPerClientRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+
+		var ids []string
+		for i := 0; i < 2; i++ {
+			creq := c.Request("call.test.model.method", nil)
+			access := s.GetRequest(t).AssertSubject(t, "access.test.model")
+			ids = append(ids, requestID(t, access))
+			access.RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+			call := s.GetRequest(t).AssertSubject(t, "call.test.model.method")
+			ids = append(ids, requestID(t, call))
+			call.RespondSuccess(nil)
+			creq.GetResponse(t)
+		}
+
+		for i := 0; i < len(ids); i += 2 {
+			if ids[i] == "" || ids[i] != ids[i+1] {
+				t.Errorf("expected access and call request to have the same reqId, but got %#v and %#v", ids[i], ids[i+1])
+			}
+		}
+		if ids[0] == ids[2] {
+			t.Errorf("expected second client request to have a new reqId, but got %#v", ids[2])
+		}
+	}, withSendRequestID)
+}
@@ -0,0 +1,191 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+const idempotencyTTL = 100 // Milliseconds
+
+func withIdempotencyTTL(cfg *server.Config) {
+	cfg.IdempotencyTTL = idempotencyTTL
+}
+
+func idempotencyKey(key string) func(r *http.Request) {
+	return func(r *http.Request) { r.Header.Set("Idempotency-Key", key) }
+}
+
+// callWithIdempotencyKey sends an HTTP POST call request with the idempotency
+// key, responds to the access and call requests, and returns the HTTP
+// response.
+func callWithIdempotencyKey(t *testing.T, s *Session, key string, result string) *HTTPResponse {
+	hreq := s.HTTPRequest("POST", "/api/test/model/method", nil, idempotencyKey(key))
+	s.GetRequest(t).
+		AssertSubject(t, "access.test.model").
+		RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+	s.GetRequest(t).
+		AssertSubject(t, "call.test.model.method").
+		RespondSuccess(json.RawMessage(result))
+	return hreq.GetResponse(t)
+}
+
+// Test that an HTTP call request with the same idempotency key within the TTL
+// gets the stored response without any request to the service.
+func TestIdempotencyKey_ReplayWithinTTL_RespondsWithStoredResponse(t *testing.T) {
+	runTest(t, func(s *Session) {
+		callWithIdempotencyKey(t, s, "abc", `{"foo":"bar"}`).
+			Equals(t, http.StatusOK, json.RawMessage(`{"foo":"bar"}`)).
+			AssertMissingHeaders(t, []string{"Idempotent-Replayed"})
+
+		s.HTTPRequest("POST", "/api/test/model/method", nil, idempotencyKey("abc")).
+			GetResponse(t).
+			Equals(t, http.StatusOK, json.RawMessage(`{"foo":"bar"}`)).
+			AssertHeaders(t, map[string]string{"Idempotent-Replayed": "true"})
+		s.Connect().AssertNoNATSRequest(t, "test.model")
+
+		// A different key results in a new call
+		callWithIdempotencyKey(t, s, "def", `{"foo":"baz"}`).
+			Equals(t, http.StatusOK, json.RawMessage(`{"foo":"baz"}`))
+	}, withIdempotencyTTL)
+}
+
+// Test that an HTTP call request with the same idempotency key after the TTL
+// has passed results in a new call request to the service.
+func TestIdempotencyKey_ReplayAfterTTL_CallsService(t *testing.T) {
+	runTest(t, func(s *Session) {
+		callWithIdempotencyKey(t, s, "abc", `{"foo":"bar"}`).
+			Equals(t, http.StatusOK, json.RawMessage(`{"foo":"bar"}`))
+
+		time.Sleep(2 * idempotencyTTL * time.Millisecond)
+
+		callWithIdempotencyKey(t, s, "abc", `{"foo":"baz"}`).
+			Equals(t, http.StatusOK, json.RawMessage(`{"foo":"baz"}`)).
+			AssertMissingHeaders(t, []string{"Idempotent-Replayed"})
+	}, withIdempotencyTTL)
+}
+
+// Test that concurrent HTTP call requests with the same idempotency key
+// result in a single call request to the service.
+func TestIdempotencyKey_ConcurrentDuplicates_CoalesceOnSingleCall(t *testing.T) {
+	runTest(t, func(s *Session) {
+		const n = 5
+		hreqs := make([]*HTTPRequest, n)
+		for i := range hreqs {
+			hreqs[i] = s.HTTPRequest("POST", "/api/test/model/method", nil, idempotencyKey("abc"))
+		}
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.method").
+			RespondSuccess(json.RawMessage(`{"foo":"bar"}`))
+
+		replayed := 0
+		for _, hreq := range hreqs {
+			hresp := hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(`{"foo":"bar"}`))
+			if hresp.Header().Get("Idempotent-Replayed") == "true" {
+				replayed++
+			}
+		}
+		if replayed != n-1 {
+			t.Errorf("expected %d replayed responses, but got %d", n-1, replayed)
+		}
+		s.Connect().AssertNoNATSRequest(t, "test.model")
+	}, withIdempotencyTTL)
+}
+
+// Test that idempotency keys are scoped per resource and method.
+func TestIdempotencyKey_DifferentResourceOrMethod_CallsService(t *testing.T) {
+	runTest(t, func(s *Session) {
+		callWithIdempotencyKey(t, s, "abc", `{"foo":"bar"}`)
+
+		for _, l := range []struct{ URL, RID, Method string }{
+			{"/api/test/model/other", "test.model", "other"},
+			{"/api/test/model/parent/method", "test.model.parent", "method"},
+		} {
+			hreq := s.HTTPRequest("POST", l.URL, nil, idempotencyKey("abc"))
+			s.GetRequest(t).
+				AssertSubject(t, "access."+l.RID).
+				RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+			s.GetRequest(t).
+				AssertSubject(t, "call."+l.RID+"."+l.Method).
+				RespondSuccess(json.RawMessage(`{"foo":"baz"}`))
+			hreq.GetResponse(t).
+				Equals(t, http.StatusOK, json.RawMessage(`{"foo":"baz"}`)).
+				AssertMissingHeaders(t, []string{"Idempotent-Replayed"})
+		}
+	}, withIdempotencyTTL)
+}
+
+// Test that a timeout response is not stored for replay.
+func TestIdempotencyKey_ReplayAfterTimeout_CallsService(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("POST", "/api/test/model/method", nil, idempotencyKey("abc"))
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.method").
+			Timeout()
+		hreq.GetResponse(t).
+			AssertStatusCode(t, http.StatusNotFound).
+			AssertError(t, reserr.ErrTimeout)
+
+		callWithIdempotencyKey(t, s, "abc", `{"foo":"bar"}`).
+			Equals(t, http.StatusOK, json.RawMessage(`{"foo":"bar"}`)).
+			AssertMissingHeaders(t, []string{"Idempotent-Replayed"})
+	}, withIdempotencyTTL)
+}
+
+// Test that an invalid idempotency key results in a 400 Bad Request.
+func TestIdempotencyKey_InvalidKey_RespondsWithBadRequest(t *testing.T) {
+	for _, key := range []string{"foo bar", "föö", strings.Repeat("a", 256)} {
+		runNamedTest(t, key, func(s *Session) {
+			s.HTTPRequest("POST", "/api/test/model/method", nil, idempotencyKey(key)).
+				GetResponse(t).
+				AssertStatusCode(t, http.StatusBadRequest).
+				AssertErrorCode(t, "system.badRequest")
+		}, withIdempotencyTTL)
+	}
+}
+
+// Test that idempotency keys are not shared between requests with different
+// access tokens.
+func TestIdempotencyKey_DifferentToken_CallsService(t *testing.T) {
+	runTest(t, func(s *Session) {
+		for _, token := range []string{"alice", "bob"} {
+			hreq := s.HTTPRequest("POST", "/api/test/model/method", nil, idempotencyKey("abc"))
+			req := s.GetRequest(t).AssertSubject(t, "auth.vault.method")
+			s.ConnEvent(req.PathPayload(t, "cid").(string), "token", json.RawMessage(`{"token":{"user":"`+token+`"}}`))
+			req.RespondSuccess(nil)
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+			s.GetRequest(t).
+				AssertSubject(t, "call.test.model.method").
+				RespondSuccess(json.RawMessage(`{"user":"` + token + `"}`))
+			hreq.GetResponse(t).
+				Equals(t, http.StatusOK, json.RawMessage(`{"user":"`+token+`"}`)).
+				AssertMissingHeaders(t, []string{"Idempotent-Replayed"})
+		}
+	}, withIdempotencyTTL, func(cfg *server.Config) {
+		headerAuth := "vault.method"
+		cfg.HeaderAuth = &headerAuth
+	})
+}
+
+// Test that idempotency keys are ignored when no idempotency TTL is set.
+func TestIdempotencyKey_TTLDisabled_CallsService(t *testing.T) {
+	runTest(t, func(s *Session) {
+		for i := 0; i < 2; i++ {
+			callWithIdempotencyKey(t, s, "abc", `{"foo":"bar"}`).
+				AssertMissingHeaders(t, []string{"Idempotent-Replayed"})
+		}
+	})
+}
@@ -0,0 +1,191 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+)
+
+const eventRateLimit = 2 // Events per second
+
+func withEventRateLimit(cfg *server.Config) {
+	cfg.EventRateLimit = eventRateLimit
+}
+
+// assertEventRateLimitNotice asserts that the next NATS message is an event
+// rate limit notice for the resource.
+func assertEventRateLimitNotice(t *testing.T, s *Session, rid string) {
+	s.GetRequest(t).
+		AssertSubject(t, "resgate.eventRateLimit."+rid).
+		AssertPayload(t, json.RawMessage(fmt.Sprintf(`{"rid":%q,"limit":%d}`, rid, eventRateLimit)))
+}
+
+// Test that a flood of change events beyond the limit is coalesced into a
+// single change event, and that the cache holds the latest state.
+func TestEventRateLimit_ChangeEventFlood_CoalescesChanges(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		for i := 0; i < 50; i++ {
+			s.ResourceEvent("test.model", "change", json.RawMessage(fmt.Sprintf(`{"values":{"int":%d}}`, i)))
+		}
+		assertEventRateLimitNotice(t, s, "test.model")
+
+		// Events within the limit
+		for i := 0; i < eventRateLimit; i++ {
+			c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(fmt.Sprintf(`{"values":{"int":%d}}`, i)))
+		}
+		// Coalesced event
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"int":49}}`))
+		c.AssertNoEvent(t, "test.model")
+
+		// Validate the cache holds the latest state
+		c2 := s.Connect()
+		creq := c2.Request("subscribe.test.model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":{"string":"foo","int":49,"bool":true,"null":null}}}`))
+		s.AssertErrorsLogged(t, 1)
+	}, withEventRateLimit)
+}
+
+// Test that coalesced change events are merged, keeping the latest value of
+// each property, and that a change back to the original value is not sent.
+func TestEventRateLimit_CoalescedChanges_MergesValues(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		for i := 0; i < eventRateLimit; i++ {
+			s.ResourceEvent("test.model", "change", json.RawMessage(fmt.Sprintf(`{"values":{"int":%d}}`, i)))
+		}
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar","bool":false}}`))
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"baz","null":{"action":"delete"}}}`))
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"bool":true}}`))
+		assertEventRateLimitNotice(t, s, "test.model")
+
+		for i := 0; i < eventRateLimit; i++ {
+			c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(fmt.Sprintf(`{"values":{"int":%d}}`, i)))
+		}
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"baz","null":{"action":"delete"}}}`))
+		c.AssertNoEvent(t, "test.model")
+		s.AssertErrorsLogged(t, 1)
+	}, withEventRateLimit)
+}
+
+// Test that a flood of custom events beyond the limit is dropped.
+func TestEventRateLimit_CustomEventFlood_DropsEvents(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		for i := 0; i < 10; i++ {
+			s.ResourceEvent("test.model", "custom", json.RawMessage(fmt.Sprintf(`{"i":%d}`, i)))
+		}
+		assertEventRateLimitNotice(t, s, "test.model")
+
+		for i := 0; i < eventRateLimit; i++ {
+			c.GetEvent(t).Equals(t, "test.model.custom", json.RawMessage(fmt.Sprintf(`{"i":%d}`, i)))
+		}
+		c.AssertNoEvent(t, "test.model")
+		s.AssertErrorsLogged(t, 1)
+	}, withEventRateLimit)
+}
+
+// Test that a flood of add events beyond the limit is dropped, and that the
+// cache holds the state of the applied events.
+func TestEventRateLimit_AddEventFlood_KeepsCacheConsistent(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestCollection(t, s, c)
+
+		for i := 0; i < 10; i++ {
+			s.ResourceEvent("test.collection", "add", json.RawMessage(fmt.Sprintf(`{"idx":0,"value":%d}`, i)))
+		}
+		assertEventRateLimitNotice(t, s, "test.collection")
+
+		for i := 0; i < eventRateLimit; i++ {
+			c.GetEvent(t).Equals(t, "test.collection.add", json.RawMessage(fmt.Sprintf(`{"idx":0,"value":%d}`, i)))
+		}
+		c.AssertNoEvent(t, "test.collection")
+
+		c2 := s.Connect()
+		creq := c2.Request("subscribe.test.collection", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.collection").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"collections":{"test.collection":[1,0,"foo",42,true,null]}}`))
+		s.AssertErrorsLogged(t, 1)
+	}, withEventRateLimit)
+}
+
+// Test that only a single notice is published when the limit is exceeded
+// again within the notify interval.
+func TestEventRateLimit_RepeatedFlood_PublishesSingleNotice(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		for n := 0; n < 2; n++ {
+			for i := 0; i < 5; i++ {
+				s.ResourceEvent("test.model", "custom", json.RawMessage(fmt.Sprintf(`{"i":%d}`, i)))
+			}
+			if n == 0 {
+				assertEventRateLimitNotice(t, s, "test.model")
+			}
+			for i := 0; i < eventRateLimit; i++ {
+				c.GetEvent(t).Equals(t, "test.model.custom", json.RawMessage(fmt.Sprintf(`{"i":%d}`, i)))
+			}
+			c.AssertNoEvent(t, "test.model")
+			// Wait for the limit to be fully restored
+			time.Sleep(time.Second + 100*time.Millisecond)
+		}
+		// An error is logged on each activation
+		s.AssertErrorsLogged(t, 2)
+	}, withEventRateLimit)
+}
+
+// Test that event rate limit overrides apply to resources matching the
+// pattern.
+func TestEventRateLimit_WithOverrides_AppliesLongestMatchingPattern(t *testing.T) {
+	tbl := []struct {
+		Overrides map[string]int // Event rate limit overrides
+		Expected  int            // Expected number of events sent to the client
+	}{
+		{nil, eventRateLimit},
+		{map[string]int{"test.>": 0}, 10},
+		{map[string]int{"test.>": 5}, 5},
+		{map[string]int{"test.model": 0, "test.>": 5}, 10},
+		{map[string]int{"test.model": 3, "test.*": 0}, 3},
+		{map[string]int{"other.>": 0}, eventRateLimit},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			subscribeToTestModel(t, s, c)
+
+			for i := 0; i < 10; i++ {
+				s.ResourceEvent("test.model", "custom", json.RawMessage(fmt.Sprintf(`{"i":%d}`, i)))
+			}
+			throttled := l.Expected < 10
+			if throttled {
+				s.GetRequest(t).AssertSubject(t, "resgate.eventRateLimit.test.model")
+			}
+			for i := 0; i < l.Expected; i++ {
+				c.GetEvent(t).Equals(t, "test.model.custom", json.RawMessage(fmt.Sprintf(`{"i":%d}`, i)))
+			}
+			c.AssertNoEvent(t, "test.model")
+			if throttled {
+				s.AssertErrorsLogged(t, 1)
+			}
+		}, withEventRateLimit, func(cfg *server.Config) {
+			cfg.EventRateLimitOverrides = l.Overrides
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+)
+
+// getTestModelOverHTTP sends an HTTP GET request for test.model, responds to
+// the access and get requests, and returns the HTTP response.
+func getTestModelOverHTTP(t *testing.T, s *Session) *HTTPResponse {
+	hreq := s.HTTPRequest("GET", "/api/test/model", nil)
+	mreqs := s.GetParallelRequests(t, 2)
+	mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+	mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+	return hreq.GetResponse(t).AssertStatusCode(t, http.StatusOK)
+}
+
+// Test that a successful HTTP GET request sets the Cache-Control header for
+// resources matching a cacheMaxAge pattern.
+func TestHTTPCacheControl_GetWithCacheMaxAge_SetsCacheControlHeader(t *testing.T) {
+	tbl := []struct {
+		CacheMaxAge map[string]int // Cache max-age setting
+		Expected    string         // Expected Cache-Control header, or empty if missing
+	}{
+		{nil, ""},
+		{map[string]int{"test.>": 60}, "public, max-age=60"},
+		{map[string]int{"test.model": 30, "test.>": 60}, "public, max-age=30"},
+		{map[string]int{"test.model": 0, "test.>": 60}, ""},
+		{map[string]int{"test.*.foo": 60}, ""},
+		{map[string]int{"other.>": 60}, ""},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			hresp := getTestModelOverHTTP(t, s)
+			if l.Expected == "" {
+				hresp.AssertMissingHeaders(t, []string{"Cache-Control", "Last-Modified"})
+			} else {
+				hresp.AssertHeaders(t, map[string]string{"Cache-Control": l.Expected})
+			}
+		}, func(cfg *server.Config) {
+			cfg.CacheMaxAge = l.CacheMaxAge
+		})
+	}
+}
+
+// Test that a successful HTTP GET request sets the Last-Modified header to
+// when the resource was loaded into the cache.
+func TestHTTPCacheControl_GetWithCacheMaxAge_SetsLastModifiedHeader(t *testing.T) {
+	runTest(t, func(s *Session) {
+		before := time.Now().Truncate(time.Second)
+		hresp := getTestModelOverHTTP(t, s)
+		after := time.Now()
+
+		lm, err := http.ParseTime(hresp.Header().Get("Last-Modified"))
+		if err != nil {
+			t.Fatalf("expected a valid Last-Modified header, but got error: %s", err)
+		}
+		if lm.Before(before) || lm.After(after) {
+			t.Errorf("expected Last-Modified header to be between %s and %s, but got %s", before, after, lm)
+		}
+	}, func(cfg *server.Config) {
+		cfg.CacheMaxAge = map[string]int{"test.>": 60}
+	})
+}
+
+// Test that an HTTP GET request made with an access token sets the
+// Cache-Control header to private, no-store.
+func TestHTTPCacheControl_GetWithToken_SetsNoStore(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/model", nil)
+		req := s.GetRequest(t).AssertSubject(t, "auth.vault.method")
+		s.ConnEvent(req.PathPayload(t, "cid").(string), "token", json.RawMessage(`{"token":{"user":"foo"}}`))
+		req.RespondSuccess(nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		hreq.GetResponse(t).
+			AssertStatusCode(t, http.StatusOK).
+			AssertHeaders(t, map[string]string{"Cache-Control": "private, no-store"}).
+			AssertMissingHeaders(t, []string{"Last-Modified"})
+	}, func(cfg *server.Config) {
+		headerAuth := "vault.method"
+		cfg.HeaderAuth = &headerAuth
+		cfg.CacheMaxAge = map[string]int{"test.>": 60}
+	})
+}
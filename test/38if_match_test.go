@@ -0,0 +1,216 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+func withMappedMethods(cfg *server.Config) {
+	patchMethod, deleteMethod := "patch", "delete"
+	cfg.PATCHMethod = &patchMethod
+	cfg.DELETEMethod = &deleteMethod
+}
+
+func withLocalIfMatch(cfg *server.Config) {
+	cfg.LocalIfMatch = true
+}
+
+func ifMatch(etag string) func(r *http.Request) {
+	return func(r *http.Request) { r.Header.Set("If-Match", etag) }
+}
+
+// expectedVersion returns the expectedVersion of the request payload, or nil
+// if missing.
+func expectedVersion(t *testing.T, r *Request) interface{} {
+	p, ok := r.Payload.(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected request payload to be an object, but got %#v", r.Payload)
+	}
+	return p["expectedVersion"]
+}
+
+// subscribeToVersionedTestModel subscribes to test.model, with the get
+// response setting the resource version.
+func subscribeToVersionedTestModel(t *testing.T, s *Session, c *Conn, version uint64) {
+	creq := c.Request("subscribe.test.model", nil)
+	mreqs := s.GetParallelRequests(t, 2)
+	mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+	mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(fmt.Sprintf(`{"model":%s,"version":%d}`, resourceData("test.model"), version)))
+	creq.GetResponse(t)
+}
+
+// Test that the If-Match header of HTTP PATCH and DELETE requests is sent
+// as expectedVersion in the call request.
+func TestIfMatch_ForwardMode_SendsExpectedVersion(t *testing.T) {
+	tbl := []struct {
+		Method   string      // HTTP method
+		IfMatch  string      // If-Match header
+		Action   string      // Expected call method
+		Expected interface{} // Expected expectedVersion in call request, or nil if missing
+	}{
+		{"PATCH", `"7"`, "patch", float64(7)},
+		{"DELETE", `"7"`, "delete", float64(7)},
+		{"PATCH", ` "18446744073709551615" `, "patch", float64(18446744073709551615)},
+		{"PATCH", "", "patch", nil},
+		{"PATCH", "*", "patch", nil},
+		{"POST", `"7"`, "method", nil},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			url := "/api/test/model"
+			if l.Method == "POST" {
+				url += "/method"
+			}
+			hreq := s.HTTPRequest(l.Method, url, []byte(`{"foo":"bar"}`), ifMatch(l.IfMatch))
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+			req := s.GetRequest(t).
+				AssertSubject(t, "call.test.model."+l.Action).
+				AssertPathPayload(t, "params", json.RawMessage(`{"foo":"bar"}`))
+			if v := expectedVersion(t, req); v != l.Expected {
+				t.Errorf("expected expectedVersion to be %#v, but got %#v", l.Expected, v)
+			}
+			req.RespondSuccess(nil)
+			hreq.GetResponse(t).AssertStatusCode(t, http.StatusNoContent)
+		}, withMappedMethods)
+	}
+}
+
+// Test that a precondition failed error from the service results in 412
+// Precondition Failed.
+func TestIfMatch_ForwardModeWithServiceMismatch_RespondsWithPreconditionFailed(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("PATCH", "/api/test/model", nil, ifMatch(`"7"`))
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.patch").
+			RespondError(reserr.ErrPreconditionFailed)
+		hreq.GetResponse(t).
+			AssertStatusCode(t, http.StatusPreconditionFailed).
+			AssertError(t, reserr.ErrPreconditionFailed)
+	}, withMappedMethods)
+}
+
+// Test that an invalid If-Match header results in 400 Bad Request.
+func TestIfMatch_InvalidHeader_RespondsWithBadRequest(t *testing.T) {
+	for _, h := range []string{"7", `W/"7"`, `"0"`, `"-1"`, `"rev-7"`, `"7", "8"`, `""`} {
+		runNamedTest(t, h, func(s *Session) {
+			s.HTTPRequest("PATCH", "/api/test/model", nil, ifMatch(h)).
+				GetResponse(t).
+				AssertStatusCode(t, http.StatusBadRequest).
+				AssertErrorCode(t, "system.badRequest")
+		}, withMappedMethods)
+	}
+}
+
+// Test that the If-Match header is checked against the cached resource
+// version in local mode.
+func TestIfMatch_LocalMode_ChecksCachedVersion(t *testing.T) {
+	tbl := []struct {
+		Method   string // HTTP method
+		IfMatch  string // If-Match header
+		Expected bool   // Expected the call request to be sent
+	}{
+		{"PATCH", `"7"`, true},
+		{"DELETE", `"7"`, true},
+		{"PATCH", `"6"`, false},
+		{"DELETE", `"8"`, false},
+		{"PATCH", "", true},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			subscribeToVersionedTestModel(t, s, c, 7)
+
+			hreq := s.HTTPRequest(l.Method, "/api/test/model", nil, ifMatch(l.IfMatch))
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+			if !l.Expected {
+				hreq.GetResponse(t).
+					AssertStatusCode(t, http.StatusPreconditionFailed).
+					AssertError(t, reserr.ErrPreconditionFailed)
+				c.AssertNoNATSRequest(t, "test.model")
+				return
+			}
+			req := s.GetRequest(t).AssertSubject(t, "call.test.model."+map[string]string{"PATCH": "patch", "DELETE": "delete"}[l.Method])
+			if v := expectedVersion(t, req); v != nil {
+				t.Errorf("expected no expectedVersion in local mode, but got %#v", v)
+			}
+			req.RespondSuccess(nil)
+			hreq.GetResponse(t).AssertStatusCode(t, http.StatusNoContent)
+		}, withMappedMethods, withLocalIfMatch)
+	}
+}
+
+// Test that an If-Match header results in 412 Precondition Failed in local
+// mode if the resource has no cached version.
+func TestIfMatch_LocalModeWithMissingVersion_RespondsWithPreconditionFailed(t *testing.T) {
+	tbl := []struct {
+		Name  string
+		Setup func(t *testing.T, s *Session, c *Conn)
+	}{
+		{"not cached", func(t *testing.T, s *Session, c *Conn) {}},
+		{"no version", func(t *testing.T, s *Session, c *Conn) {
+			subscribeToTestModel(t, s, c)
+		}},
+		{"modified by event", func(t *testing.T, s *Session, c *Conn) {
+			subscribeToVersionedTestModel(t, s, c, 7)
+			s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+			c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		}},
+	}
+
+	for _, l := range tbl {
+		runNamedTest(t, l.Name, func(s *Session) {
+			c := s.Connect()
+			l.Setup(t, s, c)
+
+			hreq := s.HTTPRequest("PATCH", "/api/test/model", nil, ifMatch(`"7"`))
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+			hreq.GetResponse(t).
+				AssertStatusCode(t, http.StatusPreconditionFailed).
+				AssertError(t, reserr.ErrPreconditionFailed)
+			c.AssertNoNATSRequest(t, "test.model")
+		}, withMappedMethods, withLocalIfMatch)
+	}
+}
+
+// Test that an HTTP GET request on a resource with a version sets the ETag
+// header.
+func TestIfMatch_GetWithVersion_SetsETagHeader(t *testing.T) {
+	tbl := []struct {
+		GetResponse string // Raw get response result
+		Expected    string // Expected ETag header, or empty if missing
+	}{
+		{`{"model":{"foo":"bar"},"version":7}`, `"7"`},
+		{`{"model":{"foo":"bar"}}`, ""},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			hreq := s.HTTPRequest("GET", "/api/test/model", nil)
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(l.GetResponse))
+			hresp := hreq.GetResponse(t).AssertStatusCode(t, http.StatusOK)
+			if l.Expected == "" {
+				hresp.AssertMissingHeaders(t, []string{"ETag"})
+			} else {
+				hresp.AssertHeaders(t, map[string]string{"ETag": l.Expected})
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+func withNegativeCacheTTL(ttl int) func(cfg *server.Config) {
+	return func(cfg *server.Config) {
+		cfg.NegativeCacheTTL = ttl
+	}
+}
+
+// subscribeToNotFoundTestModel subscribes to test.model, with the get request
+// responding with a system.notFound error.
+func subscribeToNotFoundTestModel(t *testing.T, s *Session, c *Conn) {
+	creq := c.Request("subscribe.test.model", nil)
+	mreqs := s.GetParallelRequests(t, 2)
+	mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+	mreqs.GetRequest(t, "get.test.model").RespondError(reserr.ErrNotFound)
+	creq.GetResponse(t).AssertError(t, reserr.ErrNotFound)
+}
+
+// subscribeToCachedNotFoundTestModel subscribes to test.model, expecting a
+// system.notFound error to be served from the cache without a get request.
+func subscribeToCachedNotFoundTestModel(t *testing.T, s *Session, c *Conn) {
+	creq := c.Request("subscribe.test.model", nil)
+	s.GetRequest(t).
+		AssertSubject(t, "access.test.model").
+		RespondSuccess(json.RawMessage(`{"get":true}`))
+	creq.GetResponse(t).AssertError(t, reserr.ErrNotFound)
+	c.AssertNoNATSRequest(t, "test.model")
+}
+
+// Test that a not found resource is served from the cache without a new get
+// request.
+func TestNegativeCache_SubscribeToNotFoundResource_ServedFromCache(t *testing.T) {
+	runTest(t, func(s *Session) {
+		subscribeToNotFoundTestModel(t, s, s.Connect())
+		// Subscribe using the same and another connection
+		for _, c := range []*Conn{s.Connect(), s.Connect()} {
+			subscribeToCachedNotFoundTestModel(t, s, c)
+		}
+		s.AssertNATSRequestCount(t, "get.test.model", 1)
+	})
+}
+
+// Test that a not found resource is requested again once the negative cache
+// TTL has expired.
+func TestNegativeCache_AfterTTL_SendsGetRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToNotFoundTestModel(t, s, c)
+		time.Sleep(100 * time.Millisecond)
+		subscribeToTestModel(t, s, c)
+	}, withNegativeCacheTTL(20))
+}
+
+// Test that a not found resource is not cached when negative caching is
+// disabled.
+func TestNegativeCache_Disabled_SendsGetRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToNotFoundTestModel(t, s, c)
+		subscribeToTestModel(t, s, c)
+	}, withNegativeCacheTTL(-1))
+}
+
+// Test that get errors other than system.notFound are not cached.
+func TestNegativeCache_OtherError_NotCached(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondError(reserr.ErrInternalError)
+		creq.GetResponse(t).AssertError(t, reserr.ErrInternalError)
+
+		subscribeToTestModel(t, s, c)
+	})
+}
+
+// Test that a system reset evicts a cached not found resource without
+// sending a get request.
+func TestNegativeCache_SystemReset_EvictsCachedResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToNotFoundTestModel(t, s, c)
+		s.SystemEvent("reset", json.RawMessage(`{"resources":["test.>"]}`))
+		c.AssertNoNATSRequest(t, "test.model")
+		subscribeToTestModel(t, s, c)
+		s.AssertNATSRequestCount(t, "get.test.model", 2)
+	})
+}
+
+// Test that a system prime replaces a cached not found resource.
+func TestNegativeCache_SystemPrime_ReplacesCachedResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToNotFoundTestModel(t, s, c)
+		s.SystemEvent("prime", []byte(`{"rid":"test.model","model":{"string":"primed","int":12}}`))
+
+		creq := c.Request("subscribe.test.model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":{"string":"primed","int":12}}}`))
+	})
+}
@@ -0,0 +1,171 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+func acceptJSONLines(r *http.Request) {
+	r.Header.Set("Accept", "application/x-ndjson")
+}
+
+// assertJSONLines asserts that the response body consists of the expected
+// JSON encoded lines.
+func assertJSONLines(t *testing.T, hresp *HTTPResponse, expected []string) {
+	body := hresp.Body.String()
+	if !strings.HasSuffix(body, "\n") {
+		t.Fatalf("expected response body to end with a newline, but got:\n%s", body)
+	}
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, but got %d:\n%s", len(expected), len(lines), body)
+	}
+	for i, line := range lines {
+		var v, ev interface{}
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			t.Fatalf("expected line %d to be valid JSON, but got:\n%s", i+1, line)
+		}
+		if err := json.Unmarshal([]byte(expected[i]), &ev); err != nil {
+			panic("test: invalid expected line: " + expected[i])
+		}
+		if !reflect.DeepEqual(v, ev) {
+			t.Fatalf("expected line %d to be:\n%s\nbut got:\n%s", i+1, expected[i], line)
+		}
+	}
+}
+
+// Test getting a primitive collection as JSON Lines returns one line per
+// value.
+func TestHTTPGet_JSONLinesPrimitiveCollection_ReturnsLines(t *testing.T) {
+	tbl := []struct {
+		URL  string
+		Opts []func(r *http.Request)
+	}{
+		{"/api/test/collection?q=foo&format=jsonlines", nil},
+		{"/api/test/collection?q=foo", []func(r *http.Request){acceptJSONLines}},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			hreq := s.HTTPRequest("GET", l.URL, nil, l.Opts...)
+
+			// Handle collection get and access request
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.collection").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.
+				GetRequest(t, "get.test.collection").
+				AssertPathPayload(t, "query", "q=foo").
+				RespondSuccess(json.RawMessage(`{"collection":["foo",42,true,null,{"data":{"foo":["bar"]}},{"rid":"test.soft","soft":true}],"query":"q=foo"}`))
+
+			// Validate http response
+			hresp := hreq.GetResponse(t).
+				AssertStatusCode(t, http.StatusOK).
+				AssertHeaders(t, map[string]string{"Content-Type": "application/x-ndjson"})
+			assertJSONLines(t, hresp, []string{`"foo"`, `42`, `true`, `null`, `{"foo":["bar"]}`, `{"href":"/api/test/soft"}`})
+		})
+	}
+}
+
+// Test getting a collection of references as JSON Lines returns one line per
+// referenced resource, keyed by resource ID.
+func TestHTTPGet_JSONLinesCollectionOfReferences_ReturnsResourcesByRID(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/collection/models?format=jsonlines", nil)
+
+		// Handle collection get and access request
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.collection.models").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.collection.models").RespondSuccess(json.RawMessage(`{"collection":[{"rid":"test.model.a"},{"rid":"test.collection.models"},{"rid":"test.model.b"}]}`))
+		// Handle referenced models
+		rreqs := s.GetParallelRequests(t, 2)
+		rreqs.GetRequest(t, "get.test.model.a").RespondSuccess(json.RawMessage(`{"model":{"name":"Alice","parent":{"rid":"test.collection.models"}}}`))
+		rreqs.GetRequest(t, "get.test.model.b").RespondError(reserr.ErrNotFound)
+
+		// Validate http response
+		hresp := hreq.GetResponse(t).AssertStatusCode(t, http.StatusOK)
+		assertJSONLines(t, hresp, []string{
+			`{"test.model.a":{"href":"/api/test/model/a","model":{"name":"Alice","parent":{"href":"/api/test/collection/models"}}}}`,
+			`{"test.collection.models":{"href":"/api/test/collection/models"}}`,
+			`{"test.model.b":{"href":"/api/test/model/b","error":{"code":"system.notFound","message":"Not found"}}}`,
+		})
+		s.AssertErrorsLogged(t, 0)
+	})
+}
+
+// Test getting a model with the JSON Lines format parameter returns an error,
+// while accepting JSON Lines falls back to the API encoding.
+func TestHTTPGet_JSONLinesOnModel_ReturnsBadRequestOrJSON(t *testing.T) {
+	model := resourceData("test.model")
+	tbl := []struct {
+		URL          string
+		Opts         []func(r *http.Request)
+		ExpectedCode int
+	}{
+		{"/api/test/model?format=jsonlines", nil, http.StatusBadRequest},
+		{"/api/test/model", []func(r *http.Request){acceptJSONLines}, http.StatusOK},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			hreq := s.HTTPRequest("GET", l.URL, nil, l.Opts...)
+
+			// Handle model get and access request
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + model + `}`))
+
+			// Validate http response
+			hresp := hreq.GetResponse(t).AssertStatusCode(t, l.ExpectedCode)
+			if l.ExpectedCode == http.StatusOK {
+				hresp.AssertBody(t, json.RawMessage(model))
+			} else {
+				hresp.AssertErrorCode(t, reserr.CodeBadRequest)
+			}
+		})
+	}
+}
+
+// Test that a large collection is delivered incrementally, with each line
+// flushed once written.
+func TestHTTPGet_JSONLinesLargeCollection_FlushesEachLine(t *testing.T) {
+	const size = 10000
+	runTest(t, func(s *Session) {
+		vals := make([]string, size)
+		for i := range vals {
+			vals[i] = fmt.Sprintf(`{"id":%d}`, i)
+		}
+		collection := make([]string, size)
+		for i, v := range vals {
+			collection[i] = fmt.Sprintf(`{"data":%s}`, v)
+		}
+
+		hreq := s.HTTPRequest("GET", "/api/test/collection?format=jsonlines", nil)
+
+		// Handle collection get and access request
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.collection").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.collection").RespondSuccess(json.RawMessage(`{"collection":[` + strings.Join(collection, ",") + `]}`))
+
+		// Validate http response
+		hresp := hreq.GetResponse(t).AssertStatusCode(t, http.StatusOK)
+		assertJSONLines(t, hresp, vals)
+
+		// Validate each flush happened at the end of the next line
+		if len(hresp.Flushes) != size {
+			t.Fatalf("expected %d flushes, but got %d", size, len(hresp.Flushes))
+		}
+		n := 0
+		for i, f := range hresp.Flushes {
+			n += len(vals[i]) + 1
+			if f != n {
+				t.Fatalf("expected flush %d at body length %d, but got %d", i+1, n, f)
+			}
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+func contentType(ct string) func(r *http.Request) {
+	return func(r *http.Request) { r.Header.Set("Content-Type", ct) }
+}
+
+// multipartForm returns a multipart/form-data body and its content type.
+// Each part is a field name and value. Values of type []byte are written as
+// files.
+func multipartForm(parts ...[2]interface{}) ([]byte, string) {
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	for _, p := range parts {
+		name := p[0].(string)
+		switch v := p[1].(type) {
+		case string:
+			mw.WriteField(name, v)
+		case []byte:
+			fw, _ := mw.CreateFormFile(name, name+".bin")
+			fw.Write(v)
+		}
+	}
+	mw.Close()
+	return b.Bytes(), mw.FormDataContentType()
+}
+
+// Test that form bodies on HTTP POST requests are sent as params in the call
+// request.
+func TestHTTPPostForm_ValidBody_SendsConvertedParams(t *testing.T) {
+	multipartBody, multipartContentType := multipartForm(
+		[2]interface{}{"foo", "bar"},
+		[2]interface{}{"tag", "a"},
+		[2]interface{}{"tag", "b"},
+		[2]interface{}{"file", []byte("hello")},
+	)
+
+	tbl := []struct {
+		ContentType string // Content-Type header
+		Body        []byte // Request body
+		Expected    string // Expected params in call request
+	}{
+		{"application/x-www-form-urlencoded", []byte("foo=bar&tag=a&tag=b&empty="), `{"foo":"bar","tag":["a","b"],"empty":""}`},
+		{"application/x-www-form-urlencoded; charset=utf-8", []byte("name=J%C3%B6rgen+S"), `{"name":"Jörgen S"}`},
+		{"application/x-www-form-urlencoded", nil, `{}`},
+		{multipartContentType, multipartBody, `{"foo":"bar","tag":["a","b"],"file":"aGVsbG8="}`},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			hreq := s.HTTPRequest("POST", "/api/test/model/method", l.Body, contentType(l.ContentType))
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				RespondSuccess(json.RawMessage(`{"call":"method"}`))
+			s.GetRequest(t).
+				AssertSubject(t, "call.test.model.method").
+				AssertPathPayload(t, "params", json.RawMessage(l.Expected)).
+				RespondSuccess(nil)
+			hreq.GetResponse(t).AssertStatusCode(t, http.StatusNoContent)
+		})
+	}
+}
+
+// Test that bodies with a non-form content type are decoded as JSON.
+func TestHTTPPostForm_NonFormContentType_DecodesJSON(t *testing.T) {
+	for _, ct := range []string{"", "application/json", "text/plain", "application/x-www-form-urlencoded-extra", "multipart/mixed; boundary=foo"} {
+		runNamedTest(t, ct, func(s *Session) {
+			hreq := s.HTTPRequest("POST", "/api/test/model/method", []byte(`{"foo":"bar"}`), contentType(ct))
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				RespondSuccess(json.RawMessage(`{"call":"method"}`))
+			s.GetRequest(t).
+				AssertSubject(t, "call.test.model.method").
+				AssertPathPayload(t, "params", json.RawMessage(`{"foo":"bar"}`)).
+				RespondSuccess(nil)
+			hreq.GetResponse(t).AssertStatusCode(t, http.StatusNoContent)
+		})
+	}
+}
+
+// Test that invalid form bodies, or files larger than the limit, result in
+// 400 Bad Request without any request to NATS.
+func TestHTTPPostForm_InvalidBody_RespondsWithBadRequest(t *testing.T) {
+	smallBody, smallContentType := multipartForm([2]interface{}{"file", []byte("0123456789")})
+	largeBody, largeContentType := multipartForm([2]interface{}{"file", []byte("0123456789A")})
+
+	tbl := []struct {
+		ContentType string // Content-Type header
+		Body        []byte // Request body
+		Expected    bool   // Expected the call request to be sent
+	}{
+		{"application/x-www-form-urlencoded", []byte("foo=%zz"), false},
+		{"multipart/form-data", []byte("foo"), false},
+		{"multipart/form-data; boundary=foo", []byte("--bar"), false},
+		{smallContentType, smallBody, true},
+		{largeContentType, largeBody, false},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			hreq := s.HTTPRequest("POST", "/api/test/model/method", l.Body, contentType(l.ContentType))
+			if l.Expected {
+				s.GetRequest(t).
+					AssertSubject(t, "access.test.model").
+					RespondSuccess(json.RawMessage(`{"call":"method"}`))
+				s.GetRequest(t).
+					AssertSubject(t, "call.test.model.method").
+					AssertPathPayload(t, "params", json.RawMessage(`{"file":"MDEyMzQ1Njc4OQ=="}`)).
+					RespondSuccess(nil)
+				hreq.GetResponse(t).AssertStatusCode(t, http.StatusNoContent)
+				return
+			}
+			hreq.GetResponse(t).
+				AssertStatusCode(t, http.StatusBadRequest).
+				AssertErrorCode(t, reserr.CodeBadRequest)
+		}, func(cfg *server.Config) {
+			cfg.FormFileMaxSize = 10
+		})
+	}
+}
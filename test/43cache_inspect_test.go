@@ -0,0 +1,100 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+const (
+	cacheInspectSubject = "resgate.cache.gw1"
+	cacheInspectReply   = "_INBOX.inspect"
+	cacheInspectSecret  = "s3cret"
+)
+
+func withCacheInspect(cfg *server.Config) {
+	cfg.InstanceID = "gw1"
+	cfg.CacheInspectSecret = cacheInspectSecret
+}
+
+// inspectCache sends a cache inspection request for a resource and returns
+// the published response.
+func inspectCache(t *testing.T, s *Session, secret string, rid string) *Request {
+	s.ServiceRequest(cacheInspectSubject, cacheInspectReply, json.RawMessage(`{"secret":"`+secret+`","rid":"`+rid+`"}`))
+	return s.GetRequest(t).AssertSubject(t, cacheInspectReply)
+}
+
+// Test that inspecting a cached resource returns its type, values, and
+// subscriber count.
+func TestCacheInspect_CachedResource_ReturnsValues(t *testing.T) {
+	tbl := []struct {
+		RID       string
+		Subscribe func(t *testing.T, s *Session, c *Conn) string
+		Type      string
+	}{
+		{"test.model", subscribeToTestModel, "model"},
+		{"test.collection", subscribeToTestCollection, "collection"},
+	}
+
+	for _, l := range tbl {
+		runNamedTest(t, l.RID, func(s *Session) {
+			l.Subscribe(t, s, s.Connect())
+			inspectCache(t, s, cacheInspectSecret, l.RID).
+				AssertPathPayload(t, "result.rid", l.RID).
+				AssertPathPayload(t, "result.cached", true).
+				AssertPathPayload(t, "result.type", l.Type).
+				AssertPathPayload(t, "result."+l.Type, json.RawMessage(resourceData(l.RID))).
+				AssertPathPayload(t, "result.subscribers", 1).
+				AssertPathType(t, "result.lastModified", "")
+		}, withCacheInspect)
+	}
+}
+
+// Test that inspecting a resource not in the cache returns a not cached
+// result.
+func TestCacheInspect_NotCachedResource_ReturnsNotCached(t *testing.T) {
+	runTest(t, func(s *Session) {
+		subscribeToTestModel(t, s, s.Connect())
+		inspectCache(t, s, cacheInspectSecret, "test.model.other").
+			AssertPayload(t, json.RawMessage(`{"result":{"rid":"test.model.other","cached":false}}`))
+	}, withCacheInspect)
+}
+
+// Test that model values beyond the configured size are left out of the
+// result, which is marked as truncated.
+func TestCacheInspect_LargeModel_ReturnsTruncatedValues(t *testing.T) {
+	runTest(t, func(s *Session) {
+		subscribeToTestModel(t, s, s.Connect())
+		inspectCache(t, s, cacheInspectSecret, "test.model").
+			AssertPathPayload(t, "result.model", json.RawMessage(`{"bool":true,"int":42}`)).
+			AssertPathPayload(t, "result.truncated", true)
+	}, withCacheInspect, func(cfg *server.Config) {
+		cfg.CacheInspectMaxSize = 30
+	})
+}
+
+// Test that a cache inspection request with a missing or invalid secret is
+// responded with an access denied error.
+func TestCacheInspect_InvalidSecret_RespondsWithAccessDenied(t *testing.T) {
+	for _, secret := range []string{"", "wrong", cacheInspectSecret + "x"} {
+		runNamedTest(t, secret, func(s *Session) {
+			subscribeToTestModel(t, s, s.Connect())
+			inspectCache(t, s, secret, "test.model").
+				AssertPayload(t, map[string]interface{}{"error": reserr.ErrAccessDenied})
+		}, withCacheInspect)
+	}
+}
+
+// Test that cache inspection is not subscribed to unless a secret is
+// configured.
+func TestCacheInspect_NoSecret_NotSubscribed(t *testing.T) {
+	runTest(t, func(s *Session) {
+		AssertPanic(t, func() {
+			s.ServiceRequest(cacheInspectSubject, cacheInspectReply, json.RawMessage(`{}`))
+		})
+	}, func(cfg *server.Config) {
+		cfg.InstanceID = "gw1"
+	})
+}
@@ -0,0 +1,114 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// Test that an options request on a resource not subscribed to sends an
+// access request, and returns the access granted.
+func TestOptions_OnResource_ReturnsAccess(t *testing.T) {
+	tbl := []struct {
+		Access   string // Access response
+		Expected string // Expected options result
+	}{
+		{`{"get":true}`, `{"get":true,"call":[]}`},
+		{`{"get":true,"call":"set,delete"}`, `{"get":true,"call":["set","delete"]}`},
+		{`{"get":false,"call":"*"}`, `{"get":false,"call":["*"]}`},
+		{`{}`, `{"get":false,"call":[]}`},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			creq := c.Request("options.test.model", nil)
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				RespondSuccess(json.RawMessage(l.Access))
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(l.Expected))
+		})
+	}
+}
+
+// Test that an options request responds with an error if the access request
+// fails with an error other than access denied.
+func TestOptions_AccessError_RespondsWithError(t *testing.T) {
+	tbl := []struct {
+		Err      *reserr.Error
+		Expected string
+	}{
+		{reserr.ErrAccessDenied, `{"get":false,"call":[]}`},
+		{reserr.ErrInternalError, ""},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			creq := c.Request("options.test.model", nil)
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				RespondError(l.Err)
+			if l.Expected == "" {
+				creq.GetResponse(t).AssertError(t, l.Err)
+			} else {
+				creq.GetResponse(t).AssertResult(t, json.RawMessage(l.Expected))
+			}
+		})
+	}
+}
+
+// Test that an options request on a subscribed resource uses the cached
+// access without sending an access request.
+func TestOptions_OnSubscribedResource_UsesCachedAccess(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		c.Request("options.test.model", nil).
+			GetResponse(t).
+			AssertResult(t, json.RawMessage(`{"get":true,"call":[]}`))
+		c.AssertNoNATSRequest(t, "test.model")
+	})
+}
+
+// Test that a reaccess event clears the cached access, and that a following
+// options request returns the new access.
+func TestOptions_AfterReaccessEvent_ReturnsNewAccess(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		// Send reaccess event and respond with new access
+		s.ResourceEvent("test.model", "reaccess", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"set"}`))
+		c.AssertNoEvent(t, "test.model")
+
+		c.Request("options.test.model", nil).
+			GetResponse(t).
+			AssertResult(t, json.RawMessage(`{"get":true,"call":["set"]}`))
+		c.AssertNoNATSRequest(t, "test.model")
+	})
+}
+
+// Test that an options request made while a reaccess is pending awaits the
+// new access response.
+func TestOptions_DuringReaccess_AwaitsNewAccess(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		// Send reaccess event and options request before responding
+		s.ResourceEvent("test.model", "reaccess", nil)
+		req := s.GetRequest(t).AssertSubject(t, "access.test.model")
+		creq := c.Request("options.test.model", nil)
+		req.RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"get":true,"call":["*"]}`))
+		c.AssertNoNATSRequest(t, "test.model")
+	})
+}
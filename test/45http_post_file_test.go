@@ -0,0 +1,128 @@
+package test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// binaryTestData returns bytes with all values from 0 to 255.
+func binaryTestData() []byte {
+	b := make([]byte, 256)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return b
+}
+
+// Test that a call result flagged as file is written as the raw response body
+// on HTTP POST requests.
+func TestHTTPPostFile_FileResult_WritesRawBody(t *testing.T) {
+	data := binaryTestData()
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	tbl := []struct {
+		Response        string            // Raw call response
+		ExpectedCode    int               // Expected response status code
+		ExpectedHeaders map[string]string // Expected response headers
+	}{
+		{`{"result":{"contentType":"application/pdf","data":"` + encoded + `"},"meta":{"file":true}}`, http.StatusOK, map[string]string{"Content-Type": "application/pdf", "Content-Length": "256"}},
+		{`{"result":{"contentType":"application/octet-stream","filename":"report 1.bin","data":"` + encoded + `"},"meta":{"file":true}}`, http.StatusOK, map[string]string{"Content-Type": "application/octet-stream", "Content-Disposition": `attachment; filename="report 1.bin"`}},
+		{`{"result":{"contentType":"application/pdf","filename":"a.pdf","data":"` + encoded + `"},"meta":{"file":true,"status":201,"header":{"Content-Disposition":["inline"]}}}`, http.StatusCreated, map[string]string{"Content-Disposition": "inline"}},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			hreq := s.HTTPRequest("POST", "/api/test/model/method", nil)
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+			s.GetRequest(t).
+				AssertSubject(t, "call.test.model.method").
+				RespondRaw([]byte(l.Response))
+
+			hresp := hreq.GetResponse(t).
+				AssertStatusCode(t, l.ExpectedCode).
+				AssertHeaders(t, l.ExpectedHeaders)
+			if !bytes.Equal(hresp.Body.Bytes(), data) {
+				t.Fatalf("expected body to be:\n%v\nbut got:\n%v", data, hresp.Body.Bytes())
+			}
+		})
+	}
+}
+
+// Test that a call result flagged as file is sent as JSON to WebSocket
+// clients.
+func TestHTTPPostFile_FileResultOverWebSocket_SendsJSON(t *testing.T) {
+	runTest(t, func(s *Session) {
+		result := `{"contentType":"application/pdf","data":"AAEC"}`
+		c := s.Connect()
+		creq := c.Request("call.test.model.method", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.method").
+			RespondRaw([]byte(`{"result":` + result + `,"meta":{"file":true}}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"payload":`+result+`}`))
+	})
+}
+
+// Test that an invalid or oversized file result is responded with 502 Bad
+// Gateway.
+func TestHTTPPostFile_InvalidFileResult_RespondsWithBadGateway(t *testing.T) {
+	tbl := []struct {
+		Result string // Call result
+	}{
+		{`{"contentType":"application/pdf","data":"not base64!"}`},
+		{`{"contentType":"application/pdf"}`},
+		{`{"contentType":"","data":"AAEC"}`},
+		{`{"contentType":"application/pdf","data":42}`},
+		{`"AAEC"`},
+		{`{"contentType":"application/pdf","data":"` + base64.StdEncoding.EncodeToString(make([]byte, 11)) + `"}`},
+		{`{"contentType":"application/pdf","data":"` + base64.StdEncoding.EncodeToString(make([]byte, 13)) + `"}`},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			hreq := s.HTTPRequest("POST", "/api/test/model/method", nil)
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+			s.GetRequest(t).
+				AssertSubject(t, "call.test.model.method").
+				RespondRaw([]byte(`{"result":` + l.Result + `,"meta":{"file":true}}`))
+			hreq.GetResponse(t).
+				AssertStatusCode(t, http.StatusBadGateway).
+				AssertErrorCode(t, reserr.CodeInternalError)
+		}, func(cfg *server.Config) {
+			cfg.FileResultMaxSize = 10
+		})
+	}
+}
+
+// Test that a file result at the configured size limit is written.
+func TestHTTPPostFile_FileResultAtMaxSize_WritesRawBody(t *testing.T) {
+	runTest(t, func(s *Session) {
+		data := binaryTestData()[:10]
+		hreq := s.HTTPRequest("POST", "/api/test/model/method", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.method").
+			RespondRaw([]byte(`{"result":{"contentType":"image/png","data":"` + base64.StdEncoding.EncodeToString(data) + `"},"meta":{"file":true}}`))
+		hresp := hreq.GetResponse(t).AssertStatusCode(t, http.StatusOK)
+		if !bytes.Equal(hresp.Body.Bytes(), data) {
+			t.Fatalf("expected body to be:\n%v\nbut got:\n%v", data, hresp.Body.Bytes())
+		}
+	}, func(cfg *server.Config) {
+		cfg.FileResultMaxSize = 10
+	})
+}
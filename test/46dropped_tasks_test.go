@@ -0,0 +1,94 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/metrics"
+)
+
+// droppedTasks returns the number of tasks dropped by disposing connections
+// for a task category.
+func droppedTasks(t *testing.T, category string) float64 {
+	return counterValue(t, metrics.WSDroppedTasks.WithLabelValues(category))
+}
+
+// Test that a loaded resource responded to a disconnected client is counted
+// as a dropped task, and that the resource subscription is released.
+func TestDroppedTasks_LoadedAfterDisconnect_ReleasesSubscription(t *testing.T) {
+	runTest(t, func(s *Session) {
+		loaded := droppedTasks(t, "loaded")
+		access := droppedTasks(t, "access")
+
+		c := s.Connect()
+		c.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		c.Disconnect()
+		s.AssertConnCount(t, 0)
+
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+
+		s.AssertCacheSize(t, 1)
+		s.AssertSubscriptionCount(t, 0)
+		assertDroppedTasks(t, "loaded", loaded+1)
+		assertDroppedTasks(t, "access", access+1)
+	})
+}
+
+// Test that a call response to a disconnected client is counted as a dropped
+// task.
+func TestDroppedTasks_CallResponseAfterDisconnect_CountsDroppedTask(t *testing.T) {
+	runTest(t, func(s *Session) {
+		response := droppedTasks(t, "response")
+
+		c := s.Connect()
+		c.Request("call.test.model.method", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		req := s.GetRequest(t).AssertSubject(t, "call.test.model.method")
+		c.Disconnect()
+		s.AssertConnCount(t, 0)
+
+		req.RespondSuccess(nil)
+		assertDroppedTasks(t, "response", response+1)
+		s.AssertSubscriptionCount(t, 0)
+	})
+}
+
+// Test that an access response to a disconnected client is counted as a
+// dropped task.
+func TestDroppedTasks_AccessResponseAfterDisconnect_CountsDroppedTask(t *testing.T) {
+	runTest(t, func(s *Session) {
+		access := droppedTasks(t, "access")
+
+		c := s.Connect()
+		c.Request("call.test.model.method", nil)
+		req := s.GetRequest(t).AssertSubject(t, "access.test.model")
+		c.Disconnect()
+		s.AssertConnCount(t, 0)
+
+		req.RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		assertDroppedTasks(t, "access", access+1)
+		s.AssertSubscriptionCount(t, 0)
+	})
+}
+
+// assertDroppedTasks polls the dropped task counter for a category until it
+// equals n, or fails the test on timeout. Polling is needed as responses are
+// handled asynchronously.
+func assertDroppedTasks(t *testing.T, category string, n float64) {
+	deadline := time.Now().Add(timeoutSeconds * time.Second)
+	for {
+		v := droppedTasks(t, category)
+		if v == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected dropped %s tasks to be %v, but got %v", category, n, v)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,127 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// Test that metadata in a get response is included in the subscribe
+// response.
+func TestResourceMeta_SubscribeWithMeta_IncludesMeta(t *testing.T) {
+	tbl := []struct {
+		RID         string // Resource ID
+		GetResponse string // Raw get response result
+		Expected    string // Expected subscribe response result
+	}{
+		{"test.model", `{"model":{"foo":"bar"},"meta":{"traceId":"abc","latency":12}}`, `{"models":{"test.model":{"foo":"bar"}},"meta":{"test.model":{"traceId":"abc","latency":12}}}`},
+		{"test.collection", `{"collection":["foo","bar"],"meta":{"tier":"hot"}}`, `{"collections":{"test.collection":["foo","bar"]},"meta":{"test.collection":{"tier":"hot"}}}`},
+		{"test.model", `{"model":{"foo":"bar"},"version":42,"meta":{"tier":"hot"}}`, `{"models":{"test.model":{"foo":"bar"}},"versions":{"test.model":42},"meta":{"test.model":{"tier":"hot"}}}`},
+		{"test.model", `{"model":{"foo":"bar"},"meta":{}}`, `{"models":{"test.model":{"foo":"bar"}}}`},
+		{"test.model", `{"model":{"foo":"bar"},"meta":null}`, `{"models":{"test.model":{"foo":"bar"}}}`},
+		{"test.model", `{"model":{"foo":"bar"}}`, `{"models":{"test.model":{"foo":"bar"}}}`},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			creq := c.Request("subscribe."+l.RID, nil)
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access."+l.RID).RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get."+l.RID).RespondSuccess(json.RawMessage(l.GetResponse))
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(l.Expected))
+		})
+	}
+}
+
+// Test that a get response with metadata that is not an object is responded
+// with an internal error.
+func TestResourceMeta_InvalidMeta_RespondsWithInternalError(t *testing.T) {
+	for i, meta := range []string{`"foo"`, `42`, `["foo"]`} {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			creq := c.Request("subscribe.test.model", nil)
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"},"meta":` + meta + `}`))
+			creq.GetResponse(t).AssertErrorCode(t, reserr.CodeInternalError)
+		})
+	}
+}
+
+// Test that metadata of referenced resources is included in the subscribe
+// response.
+func TestResourceMeta_SubscribeWithReferences_IncludesMetaOfEachResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model.parent", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model.parent").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model.parent").RespondSuccess(json.RawMessage(`{"model":{"child":{"rid":"test.model"}},"meta":{"traceId":"parent"}}`))
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"},"meta":{"traceId":"child"}}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":{"foo":"bar"},"test.model.parent":{"child":{"rid":"test.model"}}},"meta":{"test.model":{"traceId":"child"},"test.model.parent":{"traceId":"parent"}}}`))
+	})
+}
+
+// Test that cached metadata is included in the subscribe response of a
+// client subscribing to an already cached resource, also after the resource
+// has been modified by an event.
+func TestResourceMeta_SubscribeAfterChangeEvent_IncludesCachedMeta(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"},"meta":{"tier":"hot"}}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":{"foo":"bar"}},"meta":{"test.model":{"tier":"hot"}}}`))
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"foo":"baz"}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"foo":"baz"}}`))
+
+		c2 := s.Connect()
+		creq = c2.Request("subscribe.test.model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":{"foo":"baz"}},"meta":{"test.model":{"tier":"hot"}}}`))
+	})
+}
+
+// Test that metadata in a get response on a system reset replaces the
+// previous metadata.
+func TestResourceMeta_SystemReset_ReplacesMeta(t *testing.T) {
+	tbl := []struct {
+		ResetResponse string // Raw get response result on system reset
+		Expected      string // Expected subscribe response result after the reset
+	}{
+		{`{"model":{"foo":"bar"},"meta":{"tier":"cold"}}`, `{"models":{"test.model":{"foo":"bar"}},"meta":{"test.model":{"tier":"cold"}}}`},
+		{`{"model":{"foo":"bar"}}`, `{"models":{"test.model":{"foo":"bar"}}}`},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			creq := c.Request("subscribe.test.model", nil)
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"},"meta":{"tier":"hot"}}`))
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":{"foo":"bar"}},"meta":{"test.model":{"tier":"hot"}}}`))
+
+			s.SystemEvent("reset", json.RawMessage(`{"resources":["test.>"]}`))
+			s.GetRequest(t).
+				AssertSubject(t, "get.test.model").
+				RespondSuccess(json.RawMessage(l.ResetResponse))
+
+			c2 := s.Connect()
+			creq = c2.Request("subscribe.test.model", nil)
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				RespondSuccess(json.RawMessage(`{"get":true}`))
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(l.Expected))
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+// publicPathPrefixTests holds the prefix settings, forwarded prefix header,
+// and the expected path prefix of generated hrefs.
+var publicPathPrefixTests = []struct {
+	PublicPathPrefix string // publicPathPrefix setting
+	ForwardedPrefix  bool   // forwardedPrefix setting
+	Header           string // X-Forwarded-Prefix header value
+	Expected         string // Expected API path prefix
+}{
+	{"", false, "", "/api/"},
+	{"/gateway", false, "", "/gateway/api/"},
+	{"/gateway/", false, "", "/gateway/api/"},
+	{"", false, "/proxy", "/api/"},
+	{"/gateway", false, "/proxy", "/gateway/api/"},
+	{"", true, "/proxy", "/proxy/api/"},
+	{"/gateway", true, "/proxy/", "/proxy/api/"},
+	{"/gateway", true, "", "/gateway/api/"},
+	{"/gateway", true, "proxy", "/gateway/api/"},
+	{"/gateway", true, "/proxy?x=1", "/gateway/api/"},
+}
+
+// withForwardedPrefix returns an HTTP request option setting the
+// X-Forwarded-Prefix header, unless prefix is empty.
+func withForwardedPrefix(prefix string) func(r *http.Request) {
+	return func(r *http.Request) {
+		if prefix != "" {
+			r.Header.Set("X-Forwarded-Prefix", prefix)
+		}
+	}
+}
+
+// Test that hrefs of resource references in HTTP GET responses include the
+// public path prefix.
+func TestPublicPathPrefix_HTTPGet_IncludesPrefixInHref(t *testing.T) {
+	for i, l := range publicPathPrefixTests {
+		for _, enc := range []string{"json", "jsonflat"} {
+			runNamedTest(t, fmt.Sprintf("#%d %s", i+1, enc), func(s *Session) {
+				hreq := s.HTTPRequest("GET", "/api/test/model/parent", nil, withForwardedPrefix(l.Header))
+				mreqs := s.GetParallelRequests(t, 2)
+				mreqs.GetRequest(t, "access.test.model.parent").RespondSuccess(json.RawMessage(`{"get":true}`))
+				mreqs.GetRequest(t, "get.test.model.parent").RespondSuccess(json.RawMessage(`{"model":{"child":{"rid":"test.model"},"soft":{"rid":"test.model.soft","soft":true}}}`))
+				s.GetRequest(t).
+					AssertSubject(t, "get.test.model").
+					RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+
+				expected := `{"child":{"href":"` + l.Expected + `test/model","model":{"foo":"bar"}},"soft":{"href":"` + l.Expected + `test/model/soft"}}`
+				if enc == "jsonflat" {
+					expected = `{"child":{"foo":"bar"},"soft":{"href":"` + l.Expected + `test/model/soft"}}`
+				}
+				hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(expected))
+			}, func(cfg *server.Config) {
+				cfg.APIEncoding = enc
+				cfg.PublicPathPrefix = l.PublicPathPrefix
+				cfg.ForwardedPrefix = l.ForwardedPrefix
+			})
+		}
+	}
+}
+
+// Test that hrefs in HTTP GET JSON Lines responses include the public path
+// prefix.
+func TestPublicPathPrefix_HTTPGetJSONLines_IncludesPrefixInHref(t *testing.T) {
+	for i, l := range publicPathPrefixTests {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			hreq := s.HTTPRequest("GET", "/api/test/collection/models?format=jsonlines", nil, withForwardedPrefix(l.Header))
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.collection.models").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.collection.models").RespondSuccess(json.RawMessage(`{"collection":[{"rid":"test.model"}]}`))
+			s.GetRequest(t).
+				AssertSubject(t, "get.test.model").
+				RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+
+			hresp := hreq.GetResponse(t).AssertStatusCode(t, http.StatusOK)
+			assertJSONLines(t, hresp, []string{
+				`{"test.model":{"href":"` + l.Expected + `test/model","model":{"foo":"bar"}}}`,
+			})
+		}, func(cfg *server.Config) {
+			cfg.PublicPathPrefix = l.PublicPathPrefix
+			cfg.ForwardedPrefix = l.ForwardedPrefix
+		})
+	}
+}
+
+// Test that the Location header of HTTP POST resource responses includes the
+// public path prefix.
+func TestPublicPathPrefix_HTTPPostResourceResponse_IncludesPrefixInLocation(t *testing.T) {
+	for i, l := range publicPathPrefixTests {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			hreq := s.HTTPRequest("POST", "/api/test/model/method", nil, withForwardedPrefix(l.Header))
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+			s.GetRequest(t).
+				AssertSubject(t, "call.test.model.method").
+				RespondRaw([]byte(`{"resource":{"rid":"test.model.new"},"meta":{"status":201}}`))
+			hreq.GetResponse(t).
+				AssertStatusCode(t, http.StatusCreated).
+				AssertHeaders(t, map[string]string{"Location": l.Expected + "test/model/new"})
+		}, func(cfg *server.Config) {
+			cfg.PublicPathPrefix = l.PublicPathPrefix
+			cfg.ForwardedPrefix = l.ForwardedPrefix
+		})
+	}
+}
+
+// Test that HTTP GET responses vary by the X-Forwarded-Prefix header only if
+// the forwardedPrefix setting is enabled.
+func TestPublicPathPrefix_HTTPGet_SetsVaryHeader(t *testing.T) {
+	for _, forwardedPrefix := range []bool{true, false} {
+		runNamedTest(t, fmt.Sprint(forwardedPrefix), func(s *Session) {
+			hreq := s.HTTPRequest("GET", "/api/test/model", nil, withForwardedPrefix("/proxy"))
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+			hresp := hreq.GetResponse(t).AssertStatusCode(t, http.StatusOK)
+			vary := false
+			for _, v := range hresp.HeaderMap["Vary"] {
+				if v == "X-Forwarded-Prefix" {
+					vary = true
+				}
+			}
+			if vary != forwardedPrefix {
+				t.Fatalf("expected Vary to include X-Forwarded-Prefix to be %v, but got Vary: %v", forwardedPrefix, hresp.HeaderMap["Vary"])
+			}
+		}, func(cfg *server.Config) {
+			cfg.ForwardedPrefix = forwardedPrefix
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// Test that a subscribe or get request with a client timeout is responded to
+// with a timeout error if a referenced resource is not loaded in time, and
+// that a late get response is released.
+func TestClientTimeout_ReferenceNotLoaded_RespondsWithTimeoutError(t *testing.T) {
+	for _, method := range []string{"subscribe", "get"} {
+		runNamedTest(t, method, func(s *Session) {
+			c := s.Connect()
+			creq := c.Request(method+".test.model.parent", json.RawMessage(`{"timeout":100}`))
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.model.parent").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.model.parent").RespondSuccess(json.RawMessage(`{"model":{"child":{"rid":"test.model"}}}`))
+			req := s.GetRequest(t).AssertSubject(t, "get.test.model")
+			creq.GetResponse(t).AssertError(t, reserr.ErrTimeout)
+
+			req.RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+			s.AssertSubscriptionCount(t, 0)
+		})
+	}
+}
+
+// Test that a subscribe or get request with a client timeout and the partial
+// flag is responded to with the loaded resources, with a timeout error for
+// resources not loaded in time.
+func TestClientTimeout_PartialWithReferenceNotLoaded_RespondsWithLoadedResources(t *testing.T) {
+	for _, method := range []string{"subscribe", "get"} {
+		runNamedTest(t, method, func(s *Session) {
+			c := s.Connect()
+			creq := c.Request(method+".test.model.parent", json.RawMessage(`{"timeout":100,"partial":true}`))
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.model.parent").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.model.parent").RespondSuccess(json.RawMessage(`{"model":{"child":{"rid":"test.model"}}}`))
+			req := s.GetRequest(t).AssertSubject(t, "get.test.model")
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model.parent":{"child":{"rid":"test.model"}}},"errors":{"test.model":{"code":"system.timeout","message":"Request timeout"}}}`))
+
+			req.RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+			if method == "get" {
+				s.AssertSubscriptionCount(t, 0)
+			} else {
+				s.AssertSubscriptionCount(t, 1)
+			}
+		})
+	}
+}
+
+// Test that a subscribe request with a client timeout is responded to with a
+// timeout error if the access request is not responded to in time, also with
+// the partial flag.
+func TestClientTimeout_AccessNotResponded_RespondsWithTimeoutError(t *testing.T) {
+	for _, partial := range []bool{false, true} {
+		runNamedTest(t, fmt.Sprint(partial), func(s *Session) {
+			c := s.Connect()
+			creq := c.Request("subscribe.test.model", json.RawMessage(fmt.Sprintf(`{"timeout":100,"partial":%v}`, partial)))
+			mreqs := s.GetParallelRequests(t, 2)
+			creq.GetResponse(t).AssertError(t, reserr.ErrTimeout)
+
+			mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+			s.AssertSubscriptionCount(t, 0)
+		})
+	}
+}
+
+// Test that a subscribe request with a client timeout loaded in time is
+// responded to as without a timeout.
+func TestClientTimeout_LoadedInTime_RespondsWithResources(t *testing.T) {
+	for i, params := range []string{`{"timeout":5000}`, `{"timeout":0}`, `{"partial":true}`, `{}`, `null`} {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			creq := c.Request("subscribe.test.model", json.RawMessage(params))
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":{"foo":"bar"}}}`))
+		})
+	}
+}
+
+// Test that subscribe and get requests with invalid load parameters are
+// responded to with an invalid params error.
+func TestClientTimeout_InvalidParams_RespondsWithInvalidParamsError(t *testing.T) {
+	for _, method := range []string{"subscribe", "get"} {
+		for i, params := range []string{`{"timeout":-1}`, `{"timeout":"100"}`, `{"partial":"yes"}`, `"foo"`} {
+			runNamedTest(t, fmt.Sprintf("%s #%d", method, i+1), func(s *Session) {
+				c := s.Connect()
+				c.Request(method+".test.model", json.RawMessage(params)).
+					GetResponse(t).
+					AssertErrorCode(t, reserr.CodeInvalidParams)
+			})
+		}
+	}
+}
+
+// Test that a client timeout larger than the clientTimeoutMax setting is
+// capped.
+func TestClientTimeout_ExceedingMax_IsCapped(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", json.RawMessage(`{"timeout":3600000}`))
+		mreqs := s.GetParallelRequests(t, 2)
+		creq.GetResponse(t).AssertError(t, reserr.ErrTimeout)
+
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+		s.AssertSubscriptionCount(t, 0)
+	}, func(cfg *server.Config) {
+		cfg.ClientTimeoutMax = 100
+	})
+}
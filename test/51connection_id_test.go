@@ -0,0 +1,83 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+// sequenceCIDGenerator returns a deterministic connection ID generator,
+// returning conn1, conn2, and so on.
+func sequenceCIDGenerator() func() string {
+	n := 0
+	return func() string {
+		n++
+		return fmt.Sprintf("conn%d", n)
+	}
+}
+
+// Test that connection IDs are created by a custom connection ID generator,
+// and used in log output and NATS requests.
+func TestConnectionID_CustomGenerator_UsesGeneratedCID(t *testing.T) {
+	runServiceTest(t, "", func(serv *server.Service) {
+		serv.SetConnectionIDGenerator(sequenceCIDGenerator())
+	}, func(s *Session) {
+		for _, expected := range []string{"conn1", "conn2"} {
+			c := s.Connect()
+			if cid := getCID(t, s, c); cid != expected {
+				t.Fatalf("expected cid to be %#v, but got %#v", expected, cid)
+			}
+
+			creq := c.Request("subscribe.test.{cid}.model", nil)
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test."+expected+".model").
+				AssertPathPayload(t, "cid", expected).
+				RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test."+expected+".model").
+				RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+			creq.GetResponse(t)
+
+			if !strings.Contains(s.String(), "["+expected+"]") {
+				t.Fatalf("expected log output to contain [%s], but it did not", expected)
+			}
+		}
+	})
+}
+
+// Test that a connection is closed and an error is logged if the custom
+// connection ID generator returns an invalid ID, or an ID colliding with an
+// active connection.
+func TestConnectionID_InvalidOrCollidingCID_ClosesConnection(t *testing.T) {
+	tbl := []struct {
+		CIDs []string // Generated connection IDs
+	}{
+		{[]string{"conn1", "conn1"}},
+		{[]string{"conn1", ""}},
+		{[]string{"conn1", "conn.2"}},
+		{[]string{"conn1", "conn>"}},
+	}
+
+	for i, l := range tbl {
+		n := 0
+		runServiceTest(t, fmt.Sprintf("#%d", i+1), func(serv *server.Service) {
+			serv.SetConnectionIDGenerator(func() string {
+				cid := l.CIDs[n]
+				n++
+				return cid
+			})
+		}, func(s *Session) {
+			c := s.Connect()
+			c2 := s.ConnectWithChannel(make(chan *ClientEvent, 256))
+			c2.AssertClosed(t)
+			s.AssertErrorsLogged(t, 1)
+
+			// Assert the first connection is unaffected
+			if cid := getCID(t, s, c); cid != "conn1" {
+				t.Fatalf("expected cid to be %#v, but got %#v", "conn1", cid)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+// Test that HTTP API requests carrying one of the headerAuthHeaders trigger
+// an auth request prior to the access request, with the token set by the
+// auth request included in the access request.
+func TestHTTPHeaderAuth_WithHeader_AuthBeforeAccess(t *testing.T) {
+	token := json.RawMessage(`{"user":"foo"}`)
+	for i, header := range []string{"Authorization", "authorization", "X-Api-Key"} {
+		for _, method := range []string{"GET", "POST"} {
+			runNamedTest(t, fmt.Sprintf("#%d %s", i+1, method), func(s *Session) {
+				url := "/api/test/model/method"
+				if method == "GET" {
+					url = "/api/test/model"
+				}
+				hreq := s.HTTPRequest(method, url, nil, func(r *http.Request) {
+					r.Header.Set(header, "Bearer secret")
+				})
+
+				req := s.GetRequest(t).
+					AssertSubject(t, "auth.vault.login").
+					AssertPathPayload(t, "header."+http.CanonicalHeaderKey(header), []string{"Bearer secret"})
+				cid := req.PathPayload(t, "cid").(string)
+				s.ConnEvent(cid, "token", struct {
+					Token interface{} `json:"token"`
+				}{token})
+				req.RespondSuccess(nil)
+
+				if method == "GET" {
+					mreqs := s.GetParallelRequests(t, 2)
+					mreqs.GetRequest(t, "access.test.model").
+						AssertPathPayload(t, "token", token).
+						RespondSuccess(json.RawMessage(`{"get":true}`))
+					mreqs.GetRequest(t, "get.test.model").
+						RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+					hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(`{"foo":"bar"}`))
+				} else {
+					s.GetRequest(t).
+						AssertSubject(t, "access.test.model").
+						AssertPathPayload(t, "token", token).
+						RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+					s.GetRequest(t).
+						AssertSubject(t, "call.test.model.method").
+						AssertPathPayload(t, "token", token).
+						RespondSuccess(json.RawMessage(`{"foo":"bar"}`))
+					hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(`{"foo":"bar"}`))
+				}
+			}, func(cfg *server.Config) {
+				headerAuth := "vault.login"
+				cfg.HeaderAuth = &headerAuth
+				cfg.HeaderAuthHeaders = []string{"Authorization", "x-api-key"}
+			})
+		}
+	}
+}
+
+// Test that HTTP API requests without any of the headerAuthHeaders proceed
+// to the access request without an auth request or token.
+func TestHTTPHeaderAuth_WithoutHeader_NoAuthRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/model", nil, func(r *http.Request) {
+			r.Header.Set("Cookie", "session=secret")
+		})
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").
+			AssertPathPayload(t, "token", nil).
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+		hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(`{"foo":"bar"}`))
+	}, func(cfg *server.Config) {
+		headerAuth := "vault.login"
+		cfg.HeaderAuth = &headerAuth
+		cfg.HeaderAuthHeaders = []string{"Authorization"}
+	})
+}
@@ -0,0 +1,82 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// withUnsharedResources sets the unsharedResources setting to test.>.
+func withUnsharedResources(cfg *server.Config) {
+	cfg.UnsharedResources = []string{"test.>"}
+}
+
+// Test that an unshared resource is removed from the cache without delay once
+// unsubscribed.
+func TestUnsharedResources_Unsubscribe_RemovedFromCache(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+		s.AssertCacheSize(t, 1)
+
+		c.Request("unsubscribe.test.model", nil).GetResponse(t)
+		s.AssertCacheSize(t, 0)
+	}, withUnsharedResources)
+}
+
+// Test that an unshared resource is removed from the cache without delay once
+// the subscribing client disconnects, and loaded again on a new subscription.
+func TestUnsharedResources_DisconnectAndResubscribe_LoadsResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+		c.Disconnect()
+		s.AssertCacheSize(t, 0)
+
+		c = s.Connect()
+		subscribeToTestModel(t, s, c)
+		s.AssertCacheSize(t, 1)
+	}, withUnsharedResources)
+}
+
+// Test that events on an unshared resource are sent to the subscriber, also
+// for subscriptions made after the resource was modified.
+func TestUnsharedResources_ChangeEvent_SentToSubscriber(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar"}}`))
+
+		// A second subscription gets the modified model from the cache
+		c2 := s.Connect()
+		creq := c2.Request("subscribe.test.model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":{"string":"bar","int":42,"bool":true,"null":null}}}`))
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"int":12}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"int":12}}`))
+		c2.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"int":12}}`))
+	}, withUnsharedResources)
+}
+
+// Test that a reaccess event on an unshared resource triggers a new access
+// request, unsubscribing the client if access is denied.
+func TestUnsharedResources_ReaccessEvent_UnsubscribesOnDeniedAccess(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.ResourceEvent("test.model", "reaccess", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondError(reserr.ErrAccessDenied)
+		c.GetEvent(t).Equals(t, "test.model.unsubscribe", json.RawMessage(`{"reason":{"code":"system.accessDenied","message":"Access denied"}}`))
+		s.AssertCacheSize(t, 0)
+	}, withUnsharedResources)
+}
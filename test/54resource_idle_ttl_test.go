@@ -0,0 +1,47 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+)
+
+// Test that a resource without subscribers is evicted from the cache after
+// the resourceIdleTTL, and that a new subscription sends a new get request.
+func TestResourceIdleTTL_AfterExpiry_EvictsResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+		c.Request("unsubscribe.test.model", nil).GetResponse(t)
+		s.AssertCacheSize(t, 0)
+
+		// Subscribing after eviction gets the resource anew
+		subscribeToTestModel(t, s, c)
+	}, func(cfg *server.Config) {
+		cfg.ResourceIdleTTL = 100
+	})
+}
+
+// Test that a resource without subscribers is kept in the cache until the
+// resourceIdleTTL expires, and that a new subscription before expiry uses the
+// cached resource.
+func TestResourceIdleTTL_BeforeExpiry_UsesCachedResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+		c.Request("unsubscribe.test.model", nil).GetResponse(t)
+
+		time.Sleep(200 * time.Millisecond)
+		s.AssertCacheSize(t, 1)
+
+		creq := c.Request("subscribe.test.model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":`+resourceData("test.model")+`}}`))
+	}, func(cfg *server.Config) {
+		cfg.ResourceIdleTTL = 60000
+	})
+}
@@ -0,0 +1,126 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+const testAdminToken = "secret"
+
+// withAdminToken sets the adminToken setting.
+func withAdminToken(cfg *server.Config) {
+	cfg.AdminToken = testAdminToken
+}
+
+// withAuthorization returns an HTTP request option setting the Authorization
+// header, unless auth is empty.
+func withAuthorization(auth string) func(r *http.Request) {
+	return func(r *http.Request) {
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+	}
+}
+
+// Test that an event injected through the admin API is sent to subscribers.
+func TestAdminEvent_InjectEvent_SentToSubscribers(t *testing.T) {
+	tbl := []struct {
+		Event         string // Event name
+		Data          string // Event data
+		ExpectedEvent string // Expected client event name
+		ExpectedData  string // Expected client event data
+	}{
+		{"change", `{"values":{"string":"bar"}}`, "test.model.change", `{"values":{"string":"bar"}}`},
+		{"custom", `{"foo":"bar"}`, "test.model.custom", `{"foo":"bar"}`},
+		{"custom", `null`, "test.model.custom", `null`},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			subscribeToTestModel(t, s, c)
+
+			body := []byte(`{"rid":"test.model","event":"` + l.Event + `","data":` + l.Data + `}`)
+			s.HTTPRequest("POST", "/admin/event", body, withAuthorization("Bearer "+testAdminToken)).
+				GetResponse(t).
+				AssertStatusCode(t, http.StatusNoContent)
+			c.GetEvent(t).Equals(t, l.ExpectedEvent, json.RawMessage(l.ExpectedData))
+		}, withAdminToken)
+	}
+}
+
+// Test that a reaccess event injected through the admin API triggers an
+// access request.
+func TestAdminEvent_InjectReaccessEvent_SendsAccessRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.HTTPRequest("POST", "/admin/event", []byte(`{"rid":"test.model","event":"reaccess"}`), withAuthorization("Bearer "+testAdminToken)).
+			GetResponse(t).
+			AssertStatusCode(t, http.StatusNoContent)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		c.AssertNoEvent(t, "test.model")
+	}, withAdminToken)
+}
+
+// Test that admin API requests without a valid admin token are denied,
+// without injecting the event.
+func TestAdminEvent_InvalidToken_RespondsWithUnauthorized(t *testing.T) {
+	for i, auth := range []string{"", "Bearer", "Bearer ", "Bearer wrong", "Basic " + testAdminToken, testAdminToken} {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			subscribeToTestModel(t, s, c)
+
+			s.HTTPRequest("POST", "/admin/event", []byte(`{"rid":"test.model","event":"custom","data":{}}`), withAuthorization(auth)).
+				GetResponse(t).
+				AssertStatusCode(t, http.StatusUnauthorized).
+				AssertHeaders(t, map[string]string{"WWW-Authenticate": "Bearer"})
+			c.AssertNoEvent(t, "test.model")
+		}, withAdminToken)
+	}
+}
+
+// Test that invalid admin API event requests are responded to with an error
+// status.
+func TestAdminEvent_InvalidRequest_RespondsWithErrorStatus(t *testing.T) {
+	tbl := []struct {
+		Method       string // HTTP method
+		Body         string // Request body
+		ExpectedCode int    // Expected status code
+	}{
+		{"GET", ``, http.StatusMethodNotAllowed},
+		{"PUT", `{"rid":"test.model","event":"custom"}`, http.StatusMethodNotAllowed},
+		{"POST", ``, http.StatusBadRequest},
+		{"POST", `{]`, http.StatusBadRequest},
+		{"POST", `{"rid":"test..model","event":"custom"}`, http.StatusBadRequest},
+		{"POST", `{"rid":"test.model?foo=bar","event":"custom"}`, http.StatusBadRequest},
+		{"POST", `{"rid":"test.model","event":""}`, http.StatusBadRequest},
+		{"POST", `{"rid":"test.model","event":"custom.event"}`, http.StatusBadRequest},
+		{"POST", `{"rid":"test.model","event":"custom","data":{]}`, http.StatusBadRequest},
+		{"POST", `{"rid":"test.notcached","event":"custom"}`, http.StatusNotFound},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			s.HTTPRequest(l.Method, "/admin/event", []byte(l.Body), withAuthorization("Bearer "+testAdminToken)).
+				GetResponse(t).
+				AssertStatusCode(t, l.ExpectedCode)
+		}, withAdminToken)
+	}
+}
+
+// Test that the admin API is disabled if no admin token is set.
+func TestAdminEvent_NoAdminToken_RespondsWithNotFound(t *testing.T) {
+	runTest(t, func(s *Session) {
+		s.HTTPRequest("POST", "/admin/event", []byte(`{"rid":"test.model","event":"custom"}`), withAuthorization("Bearer ")).
+			GetResponse(t).
+			AssertStatusCode(t, http.StatusNotFound)
+	})
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+func acceptProfile(profile string) func(r *http.Request) {
+	return func(r *http.Request) {
+		r.Header.Set("Accept", "application/json; profile="+profile)
+	}
+}
+
+// Test that the API encoding of an HTTP GET response is selected by the format
+// query parameter or the Accept header profile, falling back to the
+// apiEncoding setting.
+func TestHTTPGet_SelectedAPIEncoding_ReturnsEncodedResource(t *testing.T) {
+	nested := json.RawMessage(`{"name":"parent","child":{"href":"/api/test/model","model":` + resourceData("test.model") + `}}`)
+	flat := json.RawMessage(`{"name":"parent","child":` + resourceData("test.model") + `}`)
+
+	tbl := []struct {
+		APIEncoding string
+		URL         string
+		Opts        []func(r *http.Request)
+		Expected    json.RawMessage
+	}{
+		{"json", "/api/test/model/parent", nil, nested},
+		{"json", "/api/test/model/parent?format=jsonflat", nil, flat},
+		{"json", "/api/test/model/parent?format=jsonFlat", nil, flat},
+		{"json", "/api/test/model/parent", []func(r *http.Request){acceptProfile("flat")}, flat},
+		{"json", "/api/test/model/parent", []func(r *http.Request){acceptProfile("unknown")}, nested},
+		{"jsonflat", "/api/test/model/parent", nil, flat},
+		{"jsonflat", "/api/test/model/parent?format=json", nil, nested},
+		{"jsonflat", "/api/test/model/parent", []func(r *http.Request){acceptProfile("nested")}, nested},
+		{"jsonflat", "/api/test/model/parent?format=json", []func(r *http.Request){acceptProfile("flat")}, nested},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			hreq := s.HTTPRequest("GET", l.URL, nil, l.Opts...)
+
+			// Handle parent get and access request
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.model.parent").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.
+				GetRequest(t, "get.test.model.parent").
+				AssertPayload(t, json.RawMessage(`{}`)).
+				RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model.parent") + `}`))
+			// Handle referenced model
+			s.GetRequest(t).AssertSubject(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+
+			// Validate http response
+			hreq.GetResponse(t).Equals(t, http.StatusOK, l.Expected)
+		}, func(c *server.Config) {
+			c.APIEncoding = l.APIEncoding
+		})
+	}
+}
+
+// Test that the same resource fetched with both API encodings in one session
+// holds the same structure, with references nested with href in the json
+// encoding, and inlined in the jsonflat encoding.
+func TestHTTPGet_BothAPIEncodings_ReturnSameStructure(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/model/parent", nil, acceptProfile("nested"))
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model.parent").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model.parent").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model.parent") + `}`))
+		s.GetRequest(t).AssertSubject(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		nestedResp := hreq.GetResponse(t).AssertStatusCode(t, http.StatusOK)
+
+		// The resources are cached, so only access is requested
+		hreq = s.HTTPRequest("GET", "/api/test/model/parent?format=jsonflat", nil)
+		s.GetRequest(t).AssertSubject(t, "access.test.model.parent").RespondSuccess(json.RawMessage(`{"get":true}`))
+		flatResp := hreq.GetResponse(t).AssertStatusCode(t, http.StatusOK)
+
+		var nested, flat map[string]interface{}
+		if err := json.Unmarshal(nestedResp.Body.Bytes(), &nested); err != nil {
+			t.Fatalf("error unmarshaling json response: %s", err)
+		}
+		if err := json.Unmarshal(flatResp.Body.Bytes(), &flat); err != nil {
+			t.Fatalf("error unmarshaling flat response: %s", err)
+		}
+
+		child, ok := nested["child"].(map[string]interface{})
+		if !ok {
+			t.Fatalf("expected json child to be an object, but got %#v", nested["child"])
+		}
+		if child["href"] != "/api/test/model" {
+			t.Fatalf("expected json child href to be %#v, but got %#v", "/api/test/model", child["href"])
+		}
+		if !reflect.DeepEqual(child["model"], flat["child"]) {
+			t.Fatalf("expected json child model to equal jsonflat child, but got:\n%#v\n%#v", child["model"], flat["child"])
+		}
+		if nested["name"] != flat["name"] {
+			t.Fatalf("expected json name to equal jsonflat name, but got %#v and %#v", nested["name"], flat["name"])
+		}
+	})
+}
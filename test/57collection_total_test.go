@@ -0,0 +1,146 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// Test that the total count in a collection get response is included in the
+// subscribe and get responses.
+func TestCollectionTotal_WithTotal_IncludesTotal(t *testing.T) {
+	tbl := []struct {
+		GetResponse string // Raw get response result
+		Expected    string // Expected response result
+	}{
+		{`{"collection":["foo","bar"],"total":100}`, `{"collections":{"test.collection":["foo","bar"]},"totals":{"test.collection":100}}`},
+		{`{"collection":[],"total":0}`, `{"collections":{"test.collection":[]},"totals":{"test.collection":0}}`},
+		{`{"collection":["foo","bar"],"version":3,"total":100}`, `{"collections":{"test.collection":["foo","bar"]},"versions":{"test.collection":3},"totals":{"test.collection":100}}`},
+		{`{"collection":["foo","bar"],"total":null}`, `{"collections":{"test.collection":["foo","bar"]}}`},
+		{`{"collection":["foo","bar"]}`, `{"collections":{"test.collection":["foo","bar"]}}`},
+	}
+
+	for _, method := range []string{"subscribe", "get"} {
+		for i, l := range tbl {
+			runNamedTest(t, fmt.Sprintf("%s #%d", method, i+1), func(s *Session) {
+				c := s.Connect()
+				creq := c.Request(method+".test.collection", nil)
+				mreqs := s.GetParallelRequests(t, 2)
+				mreqs.GetRequest(t, "access.test.collection").RespondSuccess(json.RawMessage(`{"get":true}`))
+				mreqs.GetRequest(t, "get.test.collection").RespondSuccess(json.RawMessage(l.GetResponse))
+				creq.GetResponse(t).AssertResult(t, json.RawMessage(l.Expected))
+			})
+		}
+	}
+}
+
+// Test that a get response with an invalid total count is responded to with
+// an internal error.
+func TestCollectionTotal_InvalidTotal_RespondsWithInternalError(t *testing.T) {
+	for i, total := range []string{`-1`, `"100"`, `1.5`} {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			creq := c.Request("subscribe.test.collection", nil)
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.collection").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.collection").RespondSuccess(json.RawMessage(`{"collection":["foo"],"total":` + total + `}`))
+			creq.GetResponse(t).AssertErrorCode(t, reserr.CodeInternalError)
+		})
+	}
+}
+
+// Test that the cached total count is preserved when the collection page is
+// modified by add and remove events.
+func TestCollectionTotal_AddAndRemoveEvents_PreservesTotal(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.collection", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.collection").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.collection").RespondSuccess(json.RawMessage(`{"collection":["foo","bar"],"total":100}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"collections":{"test.collection":["foo","bar"]},"totals":{"test.collection":100}}`))
+
+		s.ResourceEvent("test.collection", "add", json.RawMessage(`{"idx":1,"value":"baz"}`))
+		c.GetEvent(t).Equals(t, "test.collection.add", json.RawMessage(`{"idx":1,"value":"baz"}`))
+		s.ResourceEvent("test.collection", "remove", json.RawMessage(`{"idx":0}`))
+		c.GetEvent(t).Equals(t, "test.collection.remove", json.RawMessage(`{"idx":0}`))
+
+		c2 := s.Connect()
+		creq = c2.Request("subscribe.test.collection", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.collection").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"collections":{"test.collection":["baz","bar"]},"totals":{"test.collection":100}}`))
+	})
+}
+
+// Test that add and remove events caused by a query event response do not
+// modify the cached total count of a query collection.
+func TestCollectionTotal_QueryEvent_PreservesTotal(t *testing.T) {
+	for i, queryResponse := range []string{
+		`{"events":[{"event":"remove","data":{"idx":0}},{"event":"add","data":{"idx":1,"value":"baz"}}]}`,
+		`{"collection":["bar","baz"]}`,
+		`{"collection":["bar","baz"],"total":5}`,
+	} {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			creq := c.Request("subscribe.test.collection?q=foo", nil)
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.collection").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.collection").RespondSuccess(json.RawMessage(`{"collection":["foo","bar"],"query":"q=foo","total":100}`))
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"collections":{"test.collection?q=foo":["foo","bar"]},"totals":{"test.collection?q=foo":100}}`))
+
+			s.ResourceEvent("test.collection", "query", json.RawMessage(`{"subject":"_EVENT_01_"}`))
+			s.GetRequest(t).
+				Equals(t, "_EVENT_01_", json.RawMessage(`{"query":"q=foo"}`)).
+				RespondSuccess(json.RawMessage(queryResponse))
+			c.GetEvent(t).Equals(t, "test.collection?q=foo.remove", json.RawMessage(`{"idx":0}`))
+			c.GetEvent(t).Equals(t, "test.collection?q=foo.add", json.RawMessage(`{"idx":1,"value":"baz"}`))
+
+			c2 := s.Connect()
+			creq = c2.Request("subscribe.test.collection?q=foo", nil)
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.collection").
+				RespondSuccess(json.RawMessage(`{"get":true}`))
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"collections":{"test.collection?q=foo":["bar","baz"]},"totals":{"test.collection?q=foo":100}}`))
+		})
+	}
+}
+
+// Test that the total count in a get response on a system reset replaces the
+// previous total count.
+func TestCollectionTotal_SystemReset_ReplacesTotal(t *testing.T) {
+	tbl := []struct {
+		ResetResponse string // Raw get response result on system reset
+		Expected      string // Expected subscribe response result after the reset
+	}{
+		{`{"collection":["foo","bar"],"total":120}`, `{"collections":{"test.collection":["foo","bar"]},"totals":{"test.collection":120}}`},
+		{`{"collection":["foo","baz"],"total":120}`, `{"collections":{"test.collection":["foo","baz"]},"totals":{"test.collection":120}}`},
+		{`{"collection":["foo","bar"]}`, `{"collections":{"test.collection":["foo","bar"]}}`},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			creq := c.Request("subscribe.test.collection", nil)
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.collection").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.collection").RespondSuccess(json.RawMessage(`{"collection":["foo","bar"],"total":100}`))
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"collections":{"test.collection":["foo","bar"]},"totals":{"test.collection":100}}`))
+
+			s.SystemEvent("reset", json.RawMessage(`{"resources":["test.>"]}`))
+			s.GetRequest(t).
+				AssertSubject(t, "get.test.collection").
+				RespondSuccess(json.RawMessage(l.ResetResponse))
+
+			c2 := s.Connect()
+			creq = c2.Request("subscribe.test.collection", nil)
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.collection").
+				RespondSuccess(json.RawMessage(`{"get":true}`))
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(l.Expected))
+		})
+	}
+}
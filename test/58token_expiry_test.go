@@ -0,0 +1,153 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+var reasonAccessDenied = json.RawMessage(`{"reason":{"code":"system.accessDenied","message":"Access denied"}}`)
+
+// Test that an expired token is cleared, and that access is reevaluated for
+// subscribed resources, unsubscribing resources when denied.
+func TestTokenExpiry_Expired_ReaccessesWithoutToken(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		cid := getCID(t, s, c)
+		s.ConnEvent(cid, "token", json.RawMessage(`{"token":{"user":"foo"},"ttl":100}`))
+		subscribeToTestModel(t, s, c)
+
+		// Validate access is reevaluated without token on expiry
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			AssertPathPayload(t, "token", nil).
+			RespondError(reserr.ErrAccessDenied)
+		c.GetEvent(t).Equals(t, "test.model.unsubscribe", reasonAccessDenied)
+	})
+}
+
+// Test that a token replaced before it expires is not expired, and that a
+// replacing token with a ttl expires after its own ttl.
+func TestTokenExpiry_ReplacedBeforeExpiry_NotExpired(t *testing.T) {
+	for i, payload := range []string{
+		`{"token":{"user":"bar"}}`,
+		`{"token":{"user":"bar"},"ttl":0}`,
+		`{"token":{"user":"bar"},"ttl":600}`,
+	} {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			cid := getCID(t, s, c)
+			s.ConnEvent(cid, "token", json.RawMessage(`{"token":{"user":"foo"},"ttl":200}`))
+			subscribeToTestModel(t, s, c)
+
+			s.ConnEvent(cid, "token", json.RawMessage(payload))
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				AssertPathPayload(t, "token.user", "bar").
+				RespondSuccess(json.RawMessage(`{"get":true}`))
+
+			// Validate no access request after the first token's ttl
+			time.Sleep(300 * time.Millisecond)
+			c.AssertNoNATSRequest(t, "test.model")
+		})
+	}
+}
+
+// Test that an expired token is refreshed with an auth request on the
+// tokenRefresh resource method, keeping the token set by the service.
+func TestTokenExpiry_WithTokenRefresh_RefreshesToken(t *testing.T) {
+	refresh := "test.auth.refresh"
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		cid := getCID(t, s, c)
+		s.ConnEvent(cid, "token", json.RawMessage(`{"token":{"user":"foo"},"ttl":100}`))
+		subscribeToTestModel(t, s, c)
+
+		// Handle refresh auth request by setting a new token
+		req := s.GetRequest(t).
+			AssertSubject(t, "auth.test.auth.refresh").
+			AssertPathPayload(t, "token.user", "foo").
+			AssertPathPayload(t, "cid", cid)
+		s.ConnEvent(cid, "token", json.RawMessage(`{"token":{"user":"bar"},"ttl":60000}`))
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			AssertPathPayload(t, "token.user", "bar").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		req.RespondSuccess(nil)
+
+		// Validate the new token is kept
+		c.AssertNoEvent(t, "test.model")
+		c.AssertNoNATSRequest(t, "test.model")
+	}, func(cfg *server.Config) {
+		cfg.TokenRefresh = &refresh
+	})
+}
+
+// Test that an expired token is cleared if the tokenRefresh auth request does
+// not set a new token.
+func TestTokenExpiry_WithTokenRefreshNotSettingToken_ReaccessesWithoutToken(t *testing.T) {
+	refresh := "test.auth.refresh"
+	for i, respond := range []func(r *Request){
+		func(r *Request) { r.RespondSuccess(nil) },
+		func(r *Request) { r.RespondError(reserr.ErrAccessDenied) },
+		func(r *Request) { r.RespondError(reserr.ErrMethodNotFound) },
+	} {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			cid := getCID(t, s, c)
+			s.ConnEvent(cid, "token", json.RawMessage(`{"token":{"user":"foo"},"ttl":100}`))
+			subscribeToTestModel(t, s, c)
+
+			respond(s.GetRequest(t).AssertSubject(t, "auth.test.auth.refresh"))
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				AssertPathPayload(t, "token", nil).
+				RespondError(reserr.ErrAccessDenied)
+			c.GetEvent(t).Equals(t, "test.model.unsubscribe", reasonAccessDenied)
+		}, func(cfg *server.Config) {
+			cfg.TokenRefresh = &refresh
+		})
+	}
+}
+
+// Test that a token with a zero ttl, or a ttl too large to be held as a
+// duration, does not expire.
+func TestTokenExpiry_ZeroOrLargeTTL_NotExpired(t *testing.T) {
+	for _, ttl := range []string{"0", "9223372036854", "9223372036855", "9223372036854775807"} {
+		runNamedTest(t, ttl, func(s *Session) {
+			c := s.Connect()
+			cid := getCID(t, s, c)
+			s.ConnEvent(cid, "token", json.RawMessage(`{"token":{"user":"foo"},"ttl":`+ttl+`}`))
+			subscribeToTestModel(t, s, c)
+
+			time.Sleep(100 * time.Millisecond)
+			c.AssertNoEvent(t, "test.model")
+			c.AssertNoNATSRequest(t, "test.model")
+		})
+	}
+}
+
+// Test that a token event with an invalid ttl is discarded, and an error is
+// logged.
+func TestTokenExpiry_InvalidTTL_DiscardsTokenEvent(t *testing.T) {
+	for _, ttl := range []string{"-1", `"100"`, "1.5"} {
+		runNamedTest(t, ttl, func(s *Session) {
+			c := s.Connect()
+			cid := getCID(t, s, c)
+			s.ConnEvent(cid, "token", json.RawMessage(`{"token":{"user":"foo"},"ttl":`+ttl+`}`))
+
+			creq := c.Request("subscribe.test.model", nil)
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.model").
+				AssertPathPayload(t, "token", nil).
+				RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+			creq.GetResponse(t)
+			s.AssertErrorsLogged(t, 1)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// Test that a linked resource reference in a model is subscribed to, and that
+// the relationship label is included in the subscribe response.
+func TestLinkedResource_SubscribeModel_IncludesLinkedResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model.linked", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model.linked").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model.linked").RespondSuccess(json.RawMessage(`{"model":{"name":"linked","owner":{"rid":"test.model","rel":"owner"}}}`))
+		s.GetRequest(t).AssertSubject(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model.linked":{"name":"linked","owner":{"rid":"test.model","rel":"owner"}},"test.model":`+resourceData("test.model")+`}}`))
+	})
+}
+
+// Test that a change event only modifying the relationship label of a linked
+// resource reference is sent to the client, and keeps the referenced resource
+// subscribed.
+func TestLinkedResource_ChangeEventWithNewRel_KeepsReferenceSubscribed(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToLinkedModel(t, s, c)
+
+		s.ResourceEvent("test.model.linked", "change", json.RawMessage(`{"values":{"owner":{"rid":"test.model","rel":"creator"}}}`))
+		c.GetEvent(t).Equals(t, "test.model.linked.change", json.RawMessage(`{"values":{"owner":{"rid":"test.model","rel":"creator"}}}`))
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar"}}`))
+	})
+}
+
+// Test that a change event replacing a linked resource reference with a
+// primitive value unsubscribes the referenced resource.
+func TestLinkedResource_ChangeEventRemovingReference_UnsubscribesResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToLinkedModel(t, s, c)
+
+		s.ResourceEvent("test.model.linked", "change", json.RawMessage(`{"values":{"owner":null}}`))
+		c.GetEvent(t).Equals(t, "test.model.linked.change", json.RawMessage(`{"values":{"owner":null}}`))
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		c.AssertNoEvent(t, "test.model")
+	})
+}
+
+// Test that a collection add event with a linked resource reference includes
+// the referenced resource in the event.
+func TestLinkedResource_CollectionAddEvent_IncludesLinkedResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestCollection(t, s, c)
+
+		s.ResourceEvent("test.collection", "add", json.RawMessage(`{"idx":1,"value":{"rid":"test.model","rel":"member"}}`))
+		s.GetRequest(t).AssertSubject(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		c.GetEvent(t).Equals(t, "test.collection.add", json.RawMessage(`{"idx":1,"value":{"rid":"test.model","rel":"member"},"models":{"test.model":`+resourceData("test.model")+`}}`))
+	})
+}
+
+// Test that a model with an invalid linked resource reference is responded to
+// with an internal error.
+func TestLinkedResource_InvalidValue_RespondsWithInternalError(t *testing.T) {
+	for i, v := range []string{
+		`{"rid":"test.model","rel":""}`,
+		`{"rid":"test.model","rel":"owner","soft":true}`,
+		`{"rid":"test.model","rel":42}`,
+	} {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			creq := c.Request("subscribe.test.model.linked", nil)
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.model.linked").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.model.linked").RespondSuccess(json.RawMessage(`{"model":{"owner":` + v + `}}`))
+			creq.GetResponse(t).AssertErrorCode(t, reserr.CodeInternalError)
+		})
+	}
+}
+
+// Test that a linked resource reference is encoded as a nested resource in
+// HTTP GET responses.
+func TestLinkedResource_HTTPGet_EncodesNestedResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/model/linked", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model.linked").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model.linked").RespondSuccess(json.RawMessage(`{"model":{"name":"linked","owner":{"rid":"test.model","rel":"owner"}}}`))
+		s.GetRequest(t).AssertSubject(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		hreq.GetResponse(t).Equals(t, 200, json.RawMessage(`{"name":"linked","owner":{"href":"/api/test/model","model":`+resourceData("test.model")+`}}`))
+	})
+}
+
+func subscribeToLinkedModel(t *testing.T, s *Session, c *Conn) {
+	creq := c.Request("subscribe.test.model.linked", nil)
+	mreqs := s.GetParallelRequests(t, 2)
+	mreqs.GetRequest(t, "access.test.model.linked").RespondSuccess(json.RawMessage(`{"get":true}`))
+	mreqs.GetRequest(t, "get.test.model.linked").RespondSuccess(json.RawMessage(`{"model":{"name":"linked","owner":{"rid":"test.model","rel":"owner"}}}`))
+	s.GetRequest(t).AssertSubject(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+	creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model.linked":{"name":"linked","owner":{"rid":"test.model","rel":"owner"}},"test.model":`+resourceData("test.model")+`}}`))
+}
@@ -0,0 +1,127 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+)
+
+// Test that events queued while waiting for a referenced resource to load are
+// sent to the client when the queue is not exceeded.
+func TestEventQueueOverflow_QueueNotExceeded_SendsQueuedEvents(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		// Add a reference to a resource not yet loaded, causing events to be queued
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"ref":{"rid":"test.collection"}}}`))
+		req := s.GetRequest(t).AssertSubject(t, "get.test.collection")
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"baz"}}`))
+		// Allow the events to be queued before the reference is loaded
+		time.Sleep(50 * time.Millisecond)
+		req.RespondSuccess(json.RawMessage(`{"collection":` + resourceData("test.collection") + `}`))
+
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"ref":{"rid":"test.collection"}},"collections":{"test.collection":`+resourceData("test.collection")+`}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"baz"}}`))
+	}, func(cfg *server.Config) {
+		cfg.MaxEventQueueSize = 2
+	})
+}
+
+// Test that exceeding the event queue size drops the oldest queued events,
+// sends a system.eventOverflow event in their place, and that the remaining
+// and subsequent events are sent to the client.
+func TestEventQueueOverflow_QueueExceeded_SendsEventOverflowEvent(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		// Add a reference to a resource not yet loaded, causing events to be queued
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"ref":{"rid":"test.collection"}}}`))
+		req := s.GetRequest(t).AssertSubject(t, "get.test.collection")
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		s.ResourceEvent("test.model", "custom", json.RawMessage(`{"foo":"bar"}`))
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"int":12}}`))
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"bool":false}}`))
+		// Allow the events to be queued before the reference is loaded
+		time.Sleep(50 * time.Millisecond)
+		req.RespondSuccess(json.RawMessage(`{"collection":` + resourceData("test.collection") + `}`))
+
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"ref":{"rid":"test.collection"}},"collections":{"test.collection":`+resourceData("test.collection")+`}}`))
+		c.GetEvent(t).Equals(t, "system.eventOverflow", json.RawMessage(`{"rid":"test.model","count":2}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"int":12}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"bool":false}}`))
+
+		// Validate subsequent events are sent
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"baz"}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"baz"}}`))
+		s.ResourceEvent("test.collection", "add", json.RawMessage(`{"idx":0,"value":"bar"}`))
+		c.GetEvent(t).Equals(t, "test.collection.add", json.RawMessage(`{"idx":0,"value":"bar"}`))
+	}, func(cfg *server.Config) {
+		cfg.MaxEventQueueSize = 2
+	})
+}
+
+// Test that references added by dropped events are not subscribed, and that
+// references removed by dropped events are unsubscribed, on event queue
+// overflow.
+func TestEventQueueOverflow_QueueExceeded_UpdatesReferences(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModelParent(t, s, c, false)
+
+		// Add a reference to a resource not yet loaded, causing events to be queued
+		s.ResourceEvent("test.model.parent", "change", json.RawMessage(`{"values":{"ref":{"rid":"test.collection"}}}`))
+		req := s.GetRequest(t).AssertSubject(t, "get.test.collection")
+		s.ResourceEvent("test.model.parent", "change", json.RawMessage(`{"values":{"child":null}}`))
+		s.ResourceEvent("test.model.parent", "change", json.RawMessage(`{"values":{"other":{"rid":"test.collection.parent"}}}`))
+		s.ResourceEvent("test.model.parent", "change", json.RawMessage(`{"values":{"other":null}}`))
+		s.ResourceEvent("test.model.parent", "change", json.RawMessage(`{"values":{"name":"foo"}}`))
+		// Allow the events to be queued before the reference is loaded
+		time.Sleep(50 * time.Millisecond)
+		req.RespondSuccess(json.RawMessage(`{"collection":` + resourceData("test.collection") + `}`))
+
+		c.GetEvent(t).Equals(t, "test.model.parent.change", json.RawMessage(`{"values":{"ref":{"rid":"test.collection"}},"collections":{"test.collection":`+resourceData("test.collection")+`}}`))
+		c.GetEvent(t).Equals(t, "system.eventOverflow", json.RawMessage(`{"rid":"test.model.parent","count":2}`))
+		c.GetEvent(t).Equals(t, "test.model.parent.change", json.RawMessage(`{"values":{"other":null}}`))
+		c.GetEvent(t).Equals(t, "test.model.parent.change", json.RawMessage(`{"values":{"name":"foo"}}`))
+
+		// Validate references removed by dropped and sent events are unsubscribed
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		c.AssertNoEvent(t, "test.model")
+		// Validate reference added by dropped event is never subscribed
+		s.AssertNATSRequestCount(t, "get.test.collection.parent", 0)
+	}, func(cfg *server.Config) {
+		cfg.MaxEventQueueSize = 2
+	})
+}
+
+// Test that a delete event is sent after a system.eventOverflow event on
+// event queue overflow.
+func TestEventQueueOverflow_QueueExceededWithDeleteEvent_SendsDeleteEvent(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		// Add a reference to a resource not yet loaded, causing events to be queued
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"ref":{"rid":"test.collection"}}}`))
+		req := s.GetRequest(t).AssertSubject(t, "get.test.collection")
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"int":12}}`))
+		s.ResourceEvent("test.model", "delete", nil)
+		// Allow the events to be queued before the reference is loaded
+		time.Sleep(50 * time.Millisecond)
+		req.RespondSuccess(json.RawMessage(`{"collection":` + resourceData("test.collection") + `}`))
+
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"ref":{"rid":"test.collection"}},"collections":{"test.collection":`+resourceData("test.collection")+`}}`))
+		c.GetEvent(t).Equals(t, "system.eventOverflow", json.RawMessage(`{"rid":"test.model","count":1}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"int":12}}`))
+		c.GetEvent(t).Equals(t, "test.model.delete", nil)
+	}, func(cfg *server.Config) {
+		cfg.MaxEventQueueSize = 2
+	})
+}
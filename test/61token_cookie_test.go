@@ -0,0 +1,145 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+func withTokenCookie(cfg *server.Config) {
+	headerAuth := "vault.login"
+	tokenCookie := "resgate-token"
+	cfg.HeaderAuth = &headerAuth
+	cfg.TokenCookie = &tokenCookie
+}
+
+// Test that a cookie in the meta object of a header auth response sets the
+// token cookie on the HTTP response, using the configured cookie attributes.
+func TestTokenCookie_HeaderAuthWithMetaCookie_SetsCookie(t *testing.T) {
+	tbl := []struct {
+		Cookie   string               // Meta cookie value
+		Config   func(*server.Config) // Additional config
+		Expected string               // Expected Set-Cookie header
+	}{
+		{`"abc"`, nil, "resgate-token=abc; Path=/; HttpOnly; Secure; SameSite=Lax"},
+		{`""`, nil, "resgate-token=; Path=/; Max-Age=0; HttpOnly; Secure; SameSite=Lax"},
+		{`"abc"`, func(cfg *server.Config) {
+			cfg.TokenCookieDomain = "example.com"
+			cfg.TokenCookieSameSite = "strict"
+			cfg.TokenCookieMaxAge = 3600
+		}, "resgate-token=abc; Path=/; Domain=example.com; Max-Age=3600; HttpOnly; Secure; SameSite=Strict"},
+		{`"abc"`, func(cfg *server.Config) {
+			cfg.TokenCookieSameSite = "none"
+		}, "resgate-token=abc; Path=/; HttpOnly; Secure; SameSite=None"},
+	}
+
+	for i, l := range tbl {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			hreq := s.HTTPRequest("GET", "/api/test/model", nil)
+
+			s.GetRequest(t).
+				AssertSubject(t, "auth.vault.login").
+				RespondRaw([]byte(`{"result":null,"meta":{"cookie":` + l.Cookie + `}}`))
+
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+			hreq.GetResponse(t).
+				Equals(t, http.StatusOK, json.RawMessage(`{"foo":"bar"}`)).
+				AssertHeaders(t, map[string]string{"Set-Cookie": l.Expected})
+		}, func(cfg *server.Config) {
+			withTokenCookie(cfg)
+			if l.Config != nil {
+				l.Config(cfg)
+			}
+		})
+	}
+}
+
+// Test that a cookie in the meta object of a header auth response is ignored
+// if the tokenCookie setting is not set.
+func TestTokenCookie_HeaderAuthWithMetaCookieWithoutSetting_SetsNoCookie(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/model", nil)
+
+		s.GetRequest(t).
+			AssertSubject(t, "auth.vault.login").
+			RespondRaw([]byte(`{"result":null,"meta":{"cookie":"abc"}}`))
+
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+		hreq.GetResponse(t).
+			Equals(t, http.StatusOK, json.RawMessage(`{"foo":"bar"}`)).
+			AssertMissingHeaders(t, []string{"Set-Cookie"})
+	}, func(cfg *server.Config) {
+		headerAuth := "vault.login"
+		cfg.HeaderAuth = &headerAuth
+	})
+}
+
+// Test that the token cookie value sent by an HTTP client is included in the
+// header auth request.
+func TestTokenCookie_HTTPRequestWithCookie_IncludesCookieInAuthRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/model", nil, func(r *http.Request) {
+			r.Header.Set("Cookie", "other=foo; resgate-token=abc")
+		})
+
+		s.GetRequest(t).
+			AssertSubject(t, "auth.vault.login").
+			AssertPathPayload(t, "cookie", "abc").
+			RespondSuccess(nil)
+
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+		hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(`{"foo":"bar"}`))
+	}, withTokenCookie)
+}
+
+// Test that the token cookie value sent on the WebSocket upgrade request is
+// included in auth requests made by the client.
+func TestTokenCookie_WebSocketWithCookie_IncludesCookieInAuthRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.ConnectWithHeader(http.Header{"Cookie": {"resgate-token=abc"}})
+
+		creq := c.Request("auth.test.model.login", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "auth.test.model.login").
+			AssertPathPayload(t, "cookie", "abc").
+			RespondSuccess(nil)
+		creq.GetResponse(t)
+	}, withTokenCookie)
+}
+
+// Test that auth requests contain no cookie value if the token cookie is not
+// sent, or if the tokenCookie setting is not set.
+func TestTokenCookie_WithoutCookie_OmitsCookieInAuthRequest(t *testing.T) {
+	for i, l := range []struct {
+		Header http.Header
+		Config func(*server.Config)
+	}{
+		{http.Header{"Cookie": {"other=abc"}}, withTokenCookie},
+		{http.Header{"Cookie": {"resgate-token=abc"}}, nil},
+	} {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.ConnectWithHeader(l.Header)
+
+			creq := c.Request("auth.test.model.login", nil)
+			req := s.GetRequest(t).AssertSubject(t, "auth.test.model.login")
+			if _, ok := req.Payload.(map[string]interface{})["cookie"]; ok {
+				t.Fatalf("expected auth request to have no cookie, but got %v", req.Payload)
+			}
+			req.RespondSuccess(nil)
+			creq.GetResponse(t)
+		}, func(cfg *server.Config) {
+			if l.Config != nil {
+				l.Config(cfg)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+const traceIDHeader = "X-Trace-Id"
+
+func withTraceIDHeader(cfg *server.Config) {
+	cfg.TraceIDHeader = "X-Trace-ID"
+}
+
+// Test that the trace ID header of the WebSocket upgrade request is set on
+// get and access requests for subscribed resources, including referenced
+// resources.
+func TestTraceIDHeader_Subscribe_SetsHeaderOnRequests(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.ConnectWithHeader(http.Header{"X-Trace-ID": {"trace42"}})
+
+		creq := c.Request("subscribe.test.model.parent", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model.parent").
+			AssertHeader(t, traceIDHeader, "trace42").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model.parent").
+			AssertHeader(t, traceIDHeader, "trace42").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model.parent") + `}`))
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			AssertHeader(t, traceIDHeader, "trace42").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		creq.GetResponse(t)
+	}, withTraceIDHeader)
+}
+
+// Test that the trace ID header of the WebSocket upgrade request is set on
+// call and auth requests.
+func TestTraceIDHeader_CallAndAuth_SetsHeaderOnRequests(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.ConnectWithHeader(http.Header{"X-Trace-ID": {"trace42"}})
+
+		creq := c.Request("call.test.model.method", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			AssertHeader(t, traceIDHeader, "trace42").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.method").
+			AssertHeader(t, traceIDHeader, "trace42").
+			RespondSuccess(nil)
+		creq.GetResponse(t)
+
+		creq = c.Request("auth.test.model.login", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "auth.test.model.login").
+			AssertHeader(t, traceIDHeader, "trace42").
+			RespondSuccess(nil)
+		creq.GetResponse(t)
+	}, withTraceIDHeader)
+}
+
+// Test that the trace ID header of an HTTP API request is set on the get and
+// access requests.
+func TestTraceIDHeader_HTTPGet_SetsHeaderOnRequests(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/model", nil, func(r *http.Request) {
+			r.Header.Set("X-Trace-ID", "trace42")
+		})
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").
+			AssertHeader(t, traceIDHeader, "trace42").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").
+			AssertHeader(t, traceIDHeader, "trace42").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(resourceData("test.model")))
+	}, withTraceIDHeader)
+}
+
+// Test that no trace ID header is set on requests if the connection has no
+// trace ID header, or if the traceIdHeader setting is not set.
+func TestTraceIDHeader_WithoutHeaderOrSetting_SetsNoHeader(t *testing.T) {
+	for i, l := range []struct {
+		Header http.Header
+		Config func(*server.Config)
+	}{
+		{nil, withTraceIDHeader},
+		{http.Header{"X-Trace-ID": {"trace42"}}, nil},
+	} {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.ConnectWithHeader(l.Header)
+
+			creq := c.Request("subscribe.test.model", nil)
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access.test.model").
+				AssertHeader(t, traceIDHeader, "").
+				RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get.test.model").
+				AssertHeader(t, traceIDHeader, "").
+				RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+			creq.GetResponse(t)
+		}, func(cfg *server.Config) {
+			if l.Config != nil {
+				l.Config(cfg)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+func withAccessCache(cfg *server.Config) {
+	cfg.AccessCacheTTL = 60000
+}
+
+// subscribeToTestModelFromConns subscribes to test.model from all
+// connections, expecting only the first subscription to result in an access
+// and get request.
+func subscribeToTestModelFromConns(t *testing.T, s *Session, cs []*Conn) {
+	subscribeToTestModel(t, s, cs[0])
+	creqs := make([]*ClientRequest, len(cs)-1)
+	for i, c := range cs[1:] {
+		creqs[i] = c.Request("subscribe.test.model", nil)
+	}
+	for _, creq := range creqs {
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":`+resourceData("test.model")+`}}`))
+	}
+	cs[0].AssertNoNATSRequest(t, "test.model")
+}
+
+// Test that subscribing to the same resource from many connections with the
+// same token results in a single access request.
+func TestAccessCache_SubscribeFromManyConns_SingleAccessRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		cs := make([]*Conn, 5)
+		for i := range cs {
+			cs[i] = s.Connect()
+		}
+		subscribeToTestModelFromConns(t, s, cs)
+	}, withAccessCache)
+}
+
+// Test that access responses are not shared between connections when the
+// access cache is disabled.
+func TestAccessCache_Disabled_AccessRequestPerConn(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c1 := s.Connect()
+		subscribeToTestModel(t, s, c1)
+
+		c2 := s.Connect()
+		creq := c2.Request("subscribe.test.model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t)
+	})
+}
+
+// Test that access responses are not shared between connections with
+// different tokens.
+func TestAccessCache_DifferentTokens_AccessRequestPerToken(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c1 := s.Connect()
+		s.ConnEvent(getCID(t, s, c1), "token", json.RawMessage(`{"token":{"user":"foo"}}`))
+		subscribeToTestModel(t, s, c1)
+
+		c2 := s.Connect()
+		s.ConnEvent(getCID(t, s, c2), "token", json.RawMessage(`{"token":{"user":"bar"}}`))
+		creq := c2.Request("subscribe.test.model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			AssertPathPayload(t, "token", json.RawMessage(`{"user":"bar"}`)).
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t)
+	}, withAccessCache)
+}
+
+// Test that a reaccess event clears the access cache, resulting in a single
+// new access request for all connections.
+func TestAccessCache_ReaccessEvent_ClearsCache(t *testing.T) {
+	runTest(t, func(s *Session) {
+		cs := []*Conn{s.Connect(), s.Connect(), s.Connect()}
+		subscribeToTestModelFromConns(t, s, cs)
+
+		s.ResourceEvent("test.model", "reaccess", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":false}`))
+		for _, c := range cs {
+			c.GetEvent(t).Equals(t, "test.model.unsubscribe", reasonAccessDenied)
+		}
+
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		creq.GetResponse(t).AssertError(t, reserr.ErrAccessDenied)
+		c.AssertNoNATSRequest(t, "test.model")
+	}, withAccessCache)
+}
+
+// Test that a system reset of access clears the access cache.
+func TestAccessCache_SystemResetAccess_ClearsCache(t *testing.T) {
+	runTest(t, func(s *Session) {
+		cs := []*Conn{s.Connect(), s.Connect()}
+		subscribeToTestModelFromConns(t, s, cs)
+
+		s.SystemEvent("reset", json.RawMessage(`{"access":["test.>"]}`))
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		for _, c := range cs {
+			c.AssertNoEvent(t, "test.model")
+		}
+	}, withAccessCache)
+}
+
+// Test that a token change on a connection clears the access cache for the
+// replaced token.
+func TestAccessCache_TokenChange_ClearsCacheForToken(t *testing.T) {
+	runTest(t, func(s *Session) {
+		cs := []*Conn{s.Connect(), s.Connect()}
+		cids := make([]string, len(cs))
+		for i, c := range cs {
+			cids[i] = getCID(t, s, c)
+			s.ConnEvent(cids[i], "token", json.RawMessage(`{"token":{"user":"foo"}}`))
+		}
+		subscribeToTestModelFromConns(t, s, cs)
+
+		s.ConnEvent(cids[0], "token", json.RawMessage(`{"token":{"user":"bar"}}`))
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			AssertPathPayload(t, "token", json.RawMessage(`{"user":"bar"}`)).
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+
+		c := s.Connect()
+		s.ConnEvent(getCID(t, s, c), "token", json.RawMessage(`{"token":{"user":"foo"}}`))
+		creq := c.Request("subscribe.test.model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			AssertPathPayload(t, "token", json.RawMessage(`{"user":"foo"}`)).
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t)
+	}, withAccessCache)
+}
+
+// Test that access errors are cached only if they are system.accessDenied.
+func TestAccessCache_AccessError_CachedOnlyIfAccessDenied(t *testing.T) {
+	for i, l := range []struct {
+		Err    *reserr.Error
+		Cached bool
+	}{
+		{reserr.ErrAccessDenied, true},
+		{reserr.ErrInternalError, false},
+		{reserr.ErrTimeout, false},
+	} {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			for j := 0; j < 2; j++ {
+				c := s.Connect()
+				creq := c.Request("subscribe.test.model", nil)
+				if j == 0 || !l.Cached {
+					mreqs := s.GetParallelRequests(t, 2-j)
+					mreqs.GetRequest(t, "access.test.model").RespondError(l.Err)
+					if j == 0 {
+						mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+					}
+				}
+				creq.GetResponse(t).AssertError(t, l.Err)
+			}
+		}, withAccessCache)
+	}
+}
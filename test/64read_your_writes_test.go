@@ -0,0 +1,143 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+func withReadYourWrites(cfg *server.Config) {
+	cfg.ReadYourWrites = true
+}
+
+// callTestModelSet makes a successful call to test.model.set.
+func callTestModelSet(t *testing.T, s *Session, c *Conn) {
+	creq := c.Request("call.test.model.set", json.RawMessage(`{"string":"bar"}`))
+	s.GetRequest(t).
+		AssertSubject(t, "access.test.model").
+		RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+	s.GetRequest(t).
+		AssertSubject(t, "call.test.model.set").
+		RespondSuccess(nil)
+	creq.GetResponse(t)
+}
+
+// Test that a subscription made after a call, before the service's change
+// event is received, is served the stale cached resource if read-your-writes
+// is disabled.
+func TestReadYourWrites_Disabled_SubscribeAfterCall_ServedFromCache(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c1 := s.Connect()
+		subscribeToTestModel(t, s, c1)
+
+		c2 := s.Connect()
+		callTestModelSet(t, s, c2)
+
+		creq := c2.Request("subscribe.test.model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":`+resourceData("test.model")+`}}`))
+	})
+}
+
+// Test that a subscription made after a call makes a new get request, and
+// is served the updated resource, with existing subscribers getting a change
+// event.
+func TestReadYourWrites_SubscribeAfterCall_MakesNewGetRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c1 := s.Connect()
+		subscribeToTestModel(t, s, c1)
+
+		c2 := s.Connect()
+		callTestModelSet(t, s, c2)
+
+		model := `{"string":"bar","int":42,"bool":true,"null":null}`
+		creq := c2.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + model + `}`))
+		c1.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":`+model+`}}`))
+
+		// Only the next subscription makes a new get request
+		c3 := s.Connect()
+		creq = c3.Request("subscribe.test.model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":`+model+`}}`))
+	}, withReadYourWrites)
+}
+
+// Test that a subscription made after the read-your-writes window has passed
+// is served from cache.
+func TestReadYourWrites_SubscribeAfterWindow_ServedFromCache(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c1 := s.Connect()
+		subscribeToTestModel(t, s, c1)
+
+		c2 := s.Connect()
+		callTestModelSet(t, s, c2)
+		time.Sleep(100 * time.Millisecond)
+
+		creq := c2.Request("subscribe.test.model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":`+resourceData("test.model")+`}}`))
+	}, func(cfg *server.Config) {
+		cfg.ReadYourWrites = true
+		cfg.ReadYourWritesWindow = 20
+	})
+}
+
+// Test that a subscription made after a failed call is served from cache.
+func TestReadYourWrites_SubscribeAfterCallError_ServedFromCache(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c1 := s.Connect()
+		subscribeToTestModel(t, s, c1)
+
+		c2 := s.Connect()
+		creq := c2.Request("call.test.model.set", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.set").
+			RespondError(reserr.ErrInvalidParams)
+		creq.GetResponse(t).AssertError(t, reserr.ErrInvalidParams)
+
+		creq = c2.Request("subscribe.test.model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":`+resourceData("test.model")+`}}`))
+	}, withReadYourWrites)
+}
+
+// Test that a subscription made after a call to a resource that is deleted
+// while the new get request is pending, gets a not found error.
+func TestReadYourWrites_DeleteDuringNewGetRequest_SubscribeFails(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c1 := s.Connect()
+		subscribeToTestModel(t, s, c1)
+
+		c2 := s.Connect()
+		callTestModelSet(t, s, c2)
+
+		creq := c2.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		s.ResourceEvent("test.model", "delete", nil)
+		c1.GetEvent(t).Equals(t, "test.model.delete", nil)
+		mreqs.GetRequest(t, "get.test.model").RespondError(reserr.ErrNotFound)
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondError(reserr.ErrNotFound)
+		creq.GetResponse(t).AssertError(t, reserr.ErrNotFound)
+	}, withReadYourWrites)
+}
@@ -0,0 +1,205 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+func withReconnectWindow(cfg *server.Config) {
+	cfg.ReconnectWindow = 60000
+}
+
+// connectWithReconnectToken makes a new connection, sending a version request
+// with the reconnect token, unless empty. It returns the connection, the
+// reconnect token of the response, and whether the session was resumed.
+func connectWithReconnectToken(t *testing.T, s *Session, token string) (*Conn, string, bool) {
+	c := s.ConnectWithoutVersion()
+	params := map[string]interface{}{"protocol": "1.999.999"}
+	if token != "" {
+		params["reconnectToken"] = token
+	}
+	result, ok := c.Request("version", params).GetResponse(t).Result.(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected version result to be an object")
+	}
+	if result["protocol"] != server.ProtocolVersion {
+		t.Fatalf("expected protocol to be %#v, but got %#v", server.ProtocolVersion, result["protocol"])
+	}
+	newToken, _ := result["reconnectToken"].(string)
+	resumed, _ := result["resumed"].(bool)
+	return c, newToken, resumed
+}
+
+// disconnectAndWait disconnects the client, and waits for the gateway to
+// detect the lost connection.
+func disconnectAndWait(c *Conn) {
+	c.Disconnect()
+	time.Sleep(50 * time.Millisecond)
+}
+
+// Test that the version response has a reconnect token only if reconnectWindow is set.
+func TestReconnect_VersionResponse_HasReconnectToken(t *testing.T) {
+	for i, l := range []struct {
+		Config   func(*server.Config)
+		HasToken bool
+	}{
+		{nil, false},
+		{withReconnectWindow, true},
+	} {
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			_, token, resumed := connectWithReconnectToken(t, s, "")
+			if (token != "") != l.HasToken {
+				t.Errorf("expected reconnect token to be set: %v, but got %#v", l.HasToken, token)
+			}
+			if resumed {
+				t.Errorf("expected resumed to be false")
+			}
+		}, func(cfg *server.Config) {
+			if l.Config != nil {
+				l.Config(cfg)
+			}
+		})
+	}
+}
+
+// Test that reconnecting within the reconnect window resumes the session,
+// replaying events sent while disconnected, and keeping the subscriptions.
+func TestReconnect_WithinWindow_ResumesSessionAndReplaysEvents(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c1, token, _ := connectWithReconnectToken(t, s, "")
+		subscribeToTestModel(t, s, c1)
+		disconnectAndWait(c1)
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"int":-12}}`))
+
+		c2, newToken, resumed := connectWithReconnectToken(t, s, token)
+		if !resumed {
+			t.Fatalf("expected session to be resumed")
+		}
+		if newToken == "" || newToken == token {
+			t.Errorf("expected a new reconnect token, but got %#v", newToken)
+		}
+		c2.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		c2.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"int":-12}}`))
+
+		// Events after resume are sent directly
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"bool":false}}`))
+		c2.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"bool":false}}`))
+
+		// Subscription is kept
+		c2.Request("unsubscribe.test.model", nil).GetResponse(t)
+	}, withReconnectWindow)
+}
+
+// Test that a resumed session can be resumed again using the new reconnect
+// token, but not with the previous one.
+func TestReconnect_ResumedSession_RequiresNewReconnectToken(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c1, token, _ := connectWithReconnectToken(t, s, "")
+		subscribeToTestModel(t, s, c1)
+		disconnectAndWait(c1)
+
+		c2, newToken, resumed := connectWithReconnectToken(t, s, token)
+		if !resumed {
+			t.Fatalf("expected session to be resumed")
+		}
+		disconnectAndWait(c2)
+
+		_, _, resumed = connectWithReconnectToken(t, s, token)
+		if resumed {
+			t.Fatalf("expected session not to be resumed with previous token")
+		}
+
+		c4, _, resumed := connectWithReconnectToken(t, s, newToken)
+		if !resumed {
+			t.Fatalf("expected session to be resumed with new token")
+		}
+		c4.Request("unsubscribe.test.model", nil).GetResponse(t)
+	}, withReconnectWindow)
+}
+
+// Test that reconnecting with an invalid token does not resume any session.
+func TestReconnect_InvalidToken_NotResumed(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c1, token, _ := connectWithReconnectToken(t, s, "")
+		subscribeToTestModel(t, s, c1)
+		disconnectAndWait(c1)
+
+		for _, invalid := range []string{
+			"foo",
+			token + "x",
+			token[:len(token)-1],
+			"a" + token,
+		} {
+			c, _, resumed := connectWithReconnectToken(t, s, invalid)
+			if resumed {
+				t.Fatalf("expected session not to be resumed with token %#v", invalid)
+			}
+			c.Request("unsubscribe.test.model", nil).GetResponse(t).AssertError(t, reserr.ErrNoSubscription)
+		}
+	}, withReconnectWindow)
+}
+
+// Test that reconnecting after the reconnect window has expired does not
+// resume the session.
+func TestReconnect_AfterWindow_NotResumed(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c1, token, _ := connectWithReconnectToken(t, s, "")
+		subscribeToTestModel(t, s, c1)
+		disconnectAndWait(c1)
+		time.Sleep(100 * time.Millisecond)
+
+		c2, _, resumed := connectWithReconnectToken(t, s, token)
+		if resumed {
+			t.Fatalf("expected session not to be resumed")
+		}
+		c2.Request("unsubscribe.test.model", nil).GetResponse(t).AssertError(t, reserr.ErrNoSubscription)
+	}, func(cfg *server.Config) {
+		cfg.ReconnectWindow = 20
+	})
+}
+
+// Test that a session is not resumed if more events were sent while
+// disconnected than can be buffered.
+func TestReconnect_BufferExceeded_NotResumed(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c1, token, _ := connectWithReconnectToken(t, s, "")
+		subscribeToTestModel(t, s, c1)
+		disconnectAndWait(c1)
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"int":-12}}`))
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"bool":false}}`))
+
+		c2, _, resumed := connectWithReconnectToken(t, s, token)
+		if resumed {
+			t.Fatalf("expected session not to be resumed")
+		}
+		c2.AssertNoEvent(t, "test.model")
+	}, func(cfg *server.Config) {
+		cfg.ReconnectWindow = 60000
+		cfg.ReconnectBufferSize = 2
+	})
+}
+
+// Test that a connection disconnected by a service is not suspended.
+func TestReconnect_DisconnectedByService_NotResumed(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c1, token, _ := connectWithReconnectToken(t, s, "")
+		cid := getCID(t, s, c1)
+		s.ConnEvent(cid, "disconnect", nil)
+		c1.AssertClosed(t)
+		time.Sleep(50 * time.Millisecond)
+
+		_, _, resumed := connectWithReconnectToken(t, s, token)
+		if resumed {
+			t.Fatalf("expected session not to be resumed")
+		}
+	}, withReconnectWindow)
+}
@@ -0,0 +1,67 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+const accessRevalidateInterval = 100 * time.Millisecond
+
+func withAccessRevalidate(cfg *server.Config) {
+	cfg.AccessRevalidateInterval = int(accessRevalidateInterval / time.Millisecond)
+}
+
+// Test that access to a directly subscribed resource is revalidated, and that
+// the resource is unsubscribed if access is denied.
+func TestAccessRevalidate_AccessDenied_UnsubscribesResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		reasonAccessDenied := json.RawMessage(`{"reason":{"code":"system.accessDenied","message":"Access denied"}}`)
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":false}`))
+		c.GetEvent(t).Equals(t, "test.model.unsubscribe", reasonAccessDenied)
+	}, withAccessRevalidate)
+}
+
+// Test that access is revalidated repeatedly while access is granted.
+func TestAccessRevalidate_AccessGranted_RevalidatesRepeatedly(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		for i := 0; i < 2; i++ {
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				RespondSuccess(json.RawMessage(`{"get":true}`))
+		}
+	}, withAccessRevalidate)
+}
+
+// Test that an access error other than access denied keeps the subscription,
+// and doubles the interval until the next revalidation.
+func TestAccessRevalidate_AccessError_BacksOff(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondError(reserr.ErrInternalError)
+		start := time.Now()
+
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		if d := time.Since(start); d < accessRevalidateInterval*2*9/10 {
+			t.Fatalf("expected revalidation to back off to at least %s, but got %s", accessRevalidateInterval*2*9/10, d)
+		}
+		c.AssertNoEvent(t, "test.model")
+	}, withAccessRevalidate)
+}
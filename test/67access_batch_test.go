@@ -0,0 +1,119 @@
+package test
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// Client result of a subscription to test.model.data
+var batchModelDataResult = json.RawMessage(`{"models":{"test.model.data":{"name":"data","primitive":12,"object":{"data":{"foo":["bar"]}},"array":{"data":[{"foo":"bar"}]}}}}`)
+
+func withAccessBatch(cfg *server.Config) {
+	cfg.AccessBatchWindow = 20
+}
+
+// subscribeAdvertisingAccessBatch subscribes to test.model, responding to the
+// access request with a result that sets the batch flag if batch is true.
+func subscribeAdvertisingAccessBatch(t *testing.T, s *Session, c *Conn, batch bool) {
+	creq := c.Request("subscribe.test.model", nil)
+	mreqs := s.GetParallelRequests(t, 2)
+	mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true,"batch":` + strconv.FormatBool(batch) + `}`))
+	mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+	creq.GetResponse(t)
+}
+
+// subscribeToBatchResources sends subscribe requests for test.collection and
+// test.model.data, responding to the get requests, and returns the requests
+// along with the remaining access requests.
+func subscribeToBatchResources(t *testing.T, s *Session, c *Conn, n int) ([]*ClientRequest, ParallelRequests) {
+	creqs := []*ClientRequest{
+		c.Request("subscribe.test.collection", nil),
+		c.Request("subscribe.test.model.data", nil),
+	}
+	mreqs := s.GetParallelRequests(t, n+2)
+	mreqs.GetRequest(t, "get.test.collection").RespondSuccess(json.RawMessage(`{"collection":` + resourceData("test.collection") + `}`))
+	mreqs.GetRequest(t, "get.test.model.data").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model.data") + `}`))
+	return creqs, mreqs
+}
+
+// Test that access requests to a service advertising batch support are sent
+// as a single access batch request.
+func TestAccessBatch_ServiceAdvertisesBatch_SendsAccessBatchRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeAdvertisingAccessBatch(t, s, c, true)
+
+		creqs, mreqs := subscribeToBatchResources(t, s, c, 1)
+		mreqs.GetRequest(t, "accessbatch.test").
+			AssertPathPayload(t, "resources", json.RawMessage(`[{"rid":"test.collection"},{"rid":"test.model.data"}]`)).
+			AssertPathPayload(t, "cid", getCID(t, s, c)).
+			RespondSuccess(json.RawMessage(`{"resources":[{"result":{"get":true}},{"result":{"get":true}}]}`))
+
+		creqs[0].GetResponse(t).AssertResult(t, json.RawMessage(`{"collections":{"test.collection":`+resourceData("test.collection")+`}}`))
+		creqs[1].GetResponse(t).AssertResult(t, batchModelDataResult)
+	}, withAccessBatch)
+}
+
+// Test that an error for a single resource in an access batch response is
+// passed only to the subscription of that resource.
+func TestAccessBatch_PartialError_DemultiplexesResponses(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeAdvertisingAccessBatch(t, s, c, true)
+
+		creqs, mreqs := subscribeToBatchResources(t, s, c, 1)
+		mreqs.GetRequest(t, "accessbatch.test").
+			RespondSuccess(json.RawMessage(`{"resources":[{"error":{"code":"system.accessDenied","message":"Access denied"}},{"result":{"get":true}}]}`))
+
+		creqs[0].GetResponse(t).AssertError(t, reserr.ErrAccessDenied)
+		creqs[1].GetResponse(t).AssertResult(t, batchModelDataResult)
+	}, withAccessBatch)
+}
+
+// Test that a failed access batch request results in separate access
+// requests, and that later access requests are no longer batched.
+func TestAccessBatch_BatchRequestError_FallsBackToSeparateRequests(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeAdvertisingAccessBatch(t, s, c, true)
+
+		creqs, mreqs := subscribeToBatchResources(t, s, c, 1)
+		mreqs.GetRequest(t, "accessbatch.test").RespondError(reserr.ErrNotFound)
+		areqs := s.GetParallelRequests(t, 2)
+		areqs.GetRequest(t, "access.test.collection").RespondSuccess(json.RawMessage(`{"get":true}`))
+		areqs.GetRequest(t, "access.test.model.data").RespondSuccess(json.RawMessage(`{"get":true}`))
+		creqs[0].GetResponse(t).AssertResult(t, json.RawMessage(`{"collections":{"test.collection":`+resourceData("test.collection")+`}}`))
+		creqs[1].GetResponse(t).AssertResult(t, batchModelDataResult)
+
+		creqs = []*ClientRequest{
+			c.Request("subscribe.test.model.parent", nil),
+			c.Request("subscribe.test.collection.parent", nil),
+		}
+		mreqs = s.GetParallelRequests(t, 4)
+		mreqs.GetRequest(t, "access.test.model.parent").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "access.test.collection.parent").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model.parent").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model.parent") + `}`))
+		mreqs.GetRequest(t, "get.test.collection.parent").RespondSuccess(json.RawMessage(`{"collection":` + resourceData("test.collection.parent") + `}`))
+		creqs[0].GetResponse(t)
+		creqs[1].GetResponse(t)
+	}, withAccessBatch)
+}
+
+// Test that access requests to a service not advertising batch support are
+// sent separately.
+func TestAccessBatch_ServiceWithoutBatch_SendsSeparateRequests(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeAdvertisingAccessBatch(t, s, c, false)
+
+		creqs, mreqs := subscribeToBatchResources(t, s, c, 2)
+		mreqs.GetRequest(t, "access.test.collection").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "access.test.model.data").RespondSuccess(json.RawMessage(`{"get":true}`))
+		creqs[0].GetResponse(t).AssertResult(t, json.RawMessage(`{"collections":{"test.collection":`+resourceData("test.collection")+`}}`))
+		creqs[1].GetResponse(t).AssertResult(t, batchModelDataResult)
+	}, withAccessBatch)
+}
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/codec"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// Test that subscribing to a resource with a publicGet access policy sends
+// no access request.
+func TestAccessPolicy_PublicGet_NoAccessRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":`+resourceData("test.model")+`}}`))
+		c.AssertNoNATSRequest(t, "test.model")
+	}, func(cfg *server.Config) {
+		cfg.AccessPolicies = map[string]string{"test.model": "publicGet"}
+	})
+}
+
+// Test that a publicGet access policy denies call access without sending an
+// access request.
+func TestAccessPolicy_PublicGet_DeniesCall(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("call.test.model.method", nil)
+		creq.GetResponse(t).AssertError(t, reserr.ErrAccessDenied)
+		c.AssertNoNATSRequest(t, "test.model")
+	}, func(cfg *server.Config) {
+		cfg.AccessPolicies = map[string]string{"test.>": "publicGet"}
+	})
+}
+
+// Test that a denyAll access policy denies a subscription without sending an
+// access request.
+func TestAccessPolicy_DenyAll_DeniesSubscription(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		creq.GetResponse(t).AssertError(t, reserr.ErrAccessDenied)
+		c.AssertNoNATSRequest(t, "test.model")
+	}, func(cfg *server.Config) {
+		cfg.AccessPolicies = map[string]string{"test.model": "denyAll"}
+	})
+}
+
+// Test that the longest matching access policy pattern applies.
+func TestAccessPolicy_OverlappingPatterns_LongestApplies(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("call.test.model.method", nil)
+		creq.GetResponse(t).AssertError(t, reserr.ErrAccessDenied)
+		c.AssertNoNATSRequest(t, "test.model")
+	}, func(cfg *server.Config) {
+		cfg.AccessPolicies = map[string]string{"test.>": "publicGet", "test.model": "denyAll"}
+	})
+}
+
+// Test that resources referenced by a resource with an access policy are
+// subscribed without any access requests.
+func TestAccessPolicy_IndirectSubscription_NoAccessRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model.parent", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model.parent").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model.parent") + `}`))
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":`+resourceData("test.model")+`,"test.model.parent":`+resourceData("test.model.parent")+`}}`))
+		c.AssertNoNATSRequest(t, "test.model")
+
+		// Access policy applies when subscribing to the indirectly subscribed resource
+		creq = c.Request("subscribe.test.model", nil)
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{}`))
+		c.AssertNoNATSRequest(t, "test.model")
+	}, func(cfg *server.Config) {
+		cfg.AccessPolicies = map[string]string{"test.model.>": "publicGet", "test.model": "publicGet"}
+	})
+}
+
+// Test that a custom access policy set with SetAccessPolicy is called with
+// the resource and token, and that returning nil sends an access request.
+func TestAccessPolicy_CustomPolicy(t *testing.T) {
+	policy := func(rname, query string, token interface{}) *codec.AccessResult {
+		if rname == "test.model" {
+			return &codec.AccessResult{Get: true, Call: "method"}
+		}
+		return nil
+	}
+	runServiceTest(t, "", func(serv *server.Service) {
+		serv.SetAccessPolicy("test.>", policy)
+	}, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("call.test.model.method", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.method").
+			RespondSuccess(json.RawMessage(`{"foo":"bar"}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"payload":{"foo":"bar"}}`))
+
+		creq = c.Request("call.test.collection.method", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.collection").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t).AssertError(t, reserr.ErrAccessDenied)
+	})
+}
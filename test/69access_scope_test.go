@@ -0,0 +1,105 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// subscribeWithAccessScope subscribes to the resource, responding to the
+// access request with the access result.
+func subscribeWithAccessScope(t *testing.T, s *Session, c *Conn, rid string, access string) *ClientResponse {
+	creq := c.Request("subscribe."+rid, nil)
+	mreqs := s.GetParallelRequests(t, 2)
+	mreqs.GetRequest(t, "access."+rid).RespondSuccess(json.RawMessage(access))
+	mreqs.GetRequest(t, "get."+rid).RespondSuccess(json.RawMessage(`{"model":` + resourceData(rid) + `}`))
+	return creq.GetResponse(t)
+}
+
+// subscribeWithoutAccessRequest subscribes to test.collection, expecting
+// only a get request.
+func subscribeWithoutAccessRequest(t *testing.T, s *Session, c *Conn) {
+	creq := c.Request("subscribe.test.collection", nil)
+	s.GetRequest(t).
+		AssertSubject(t, "get.test.collection").
+		RespondSuccess(json.RawMessage(`{"collection":` + resourceData("test.collection") + `}`))
+	creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"collections":{"test.collection":`+resourceData("test.collection")+`}}`))
+}
+
+// subscribeWithAccessRequest subscribes to test.collection, expecting an
+// access request and a get request.
+func subscribeWithAccessRequest(t *testing.T, s *Session, c *Conn) {
+	creq := c.Request("subscribe.test.collection", nil)
+	mreqs := s.GetParallelRequests(t, 2)
+	mreqs.GetRequest(t, "access.test.collection").RespondSuccess(json.RawMessage(`{"get":true}`))
+	mreqs.GetRequest(t, "get.test.collection").RespondSuccess(json.RawMessage(`{"collection":` + resourceData("test.collection") + `}`))
+	creq.GetResponse(t)
+}
+
+// Test that an access result with a scope is used for other resources
+// matching the scope pattern, without sending access requests.
+func TestAccessScope_ScopeGranted_NoAccessRequestForMatchingResources(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeWithAccessScope(t, s, c, "test.model", `{"get":true,"scope":"test.>"}`)
+		subscribeWithoutAccessRequest(t, s, c)
+
+		creq := c.Request("subscribe.test.model.data", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model.data").
+			RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model.data") + `}`))
+		creq.GetResponse(t)
+		c.AssertNoNATSRequest(t, "test.model")
+	})
+}
+
+// Test that the access of the longest matching scope pattern applies.
+func TestAccessScope_OverlappingScopes_MoreSpecificApplies(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeWithAccessScope(t, s, c, "test.model.data", `{"get":false,"scope":"test.model.>"}`).
+			AssertError(t, reserr.ErrAccessDenied)
+		subscribeWithAccessScope(t, s, c, "test.model", `{"get":true,"scope":"test.>"}`)
+
+		// Covered by the more specific scope, denying access
+		c.Request("subscribe.test.model.data", nil).GetResponse(t).AssertError(t, reserr.ErrAccessDenied)
+		// Covered by the wider scope only, granting access
+		subscribeWithoutAccessRequest(t, s, c)
+	})
+}
+
+// Test that a reaccess event on a resource within a scope removes the scope.
+func TestAccessScope_ReaccessEvent_RemovesScope(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeWithAccessScope(t, s, c, "test.model", `{"get":true,"scope":"test.>"}`)
+
+		s.ResourceEvent("test.model", "reaccess", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		subscribeWithAccessRequest(t, s, c)
+	})
+}
+
+// Test that a token change removes all scopes.
+func TestAccessScope_TokenChange_RemovesScopes(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeWithAccessScope(t, s, c, "test.model", `{"get":true,"scope":"test.>"}`)
+
+		s.ConnEvent(getCID(t, s, c), "token", json.RawMessage(`{"token":{"user":"foo"}}`))
+		subscribeWithAccessRequest(t, s, c)
+	})
+}
+
+// Test that a scope not matching the requested resource's service name is
+// ignored.
+func TestAccessScope_OtherServiceScope_Ignored(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeWithAccessScope(t, s, c, "test.model", `{"get":true,"scope":"*.>"}`)
+		subscribeWithAccessRequest(t, s, c)
+	})
+}
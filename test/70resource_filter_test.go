@@ -0,0 +1,74 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+func withDeniedTestModel(cfg *server.Config) {
+	cfg.DeniedResources = []string{"test.model"}
+}
+
+// Test that subscribing to a denied resource is rejected without any
+// requests to the services.
+func TestResourceFilter_SubscribeDeniedResource_AccessDenied(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		c.Request("subscribe.test.model", nil).GetResponse(t).AssertError(t, reserr.ErrAccessDenied)
+		c.AssertNoNATSRequest(t, "test.collection")
+	}, withDeniedTestModel)
+}
+
+// Test that subscribing to a resource not matching any allowed resource
+// pattern is rejected without any requests to the services.
+func TestResourceFilter_SubscribeNotAllowedResource_AccessDenied(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		c.Request("subscribe.test.model", nil).GetResponse(t).AssertError(t, reserr.ErrAccessDenied)
+		c.AssertNoNATSRequest(t, "test.collection")
+
+		subscribeToTestCollection(t, s, c)
+	}, func(cfg *server.Config) {
+		cfg.AllowedResources = []string{"test.collection", "test.model.*"}
+	})
+}
+
+// Test that calling a method on a denied resource is rejected without any
+// requests to the services.
+func TestResourceFilter_CallDeniedResource_AccessDenied(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		c.Request("call.test.model.method", nil).GetResponse(t).AssertError(t, reserr.ErrAccessDenied)
+		c.Request("auth.test.model.method", nil).GetResponse(t).AssertError(t, reserr.ErrAccessDenied)
+		c.AssertNoNATSRequest(t, "test.collection")
+	}, withDeniedTestModel)
+}
+
+// Test that an HTTP GET request for a denied resource is rejected without
+// any requests to the services.
+func TestResourceFilter_HTTPGetDeniedResource_AccessDenied(t *testing.T) {
+	runTest(t, func(s *Session) {
+		s.HTTPRequest("GET", "/api/test/model", nil).GetResponse(t).
+			AssertStatusCode(t, http.StatusUnauthorized).
+			AssertError(t, reserr.ErrAccessDenied)
+		s.Connect().AssertNoNATSRequest(t, "test.collection")
+	}, withDeniedTestModel)
+}
+
+// Test that a reference to a denied resource is sent as an error, without
+// affecting the referencing resource.
+func TestResourceFilter_ReferenceToDeniedResource_ErrorValue(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model.parent", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model.parent").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model.parent").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model.parent") + `}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model.parent":`+resourceData("test.model.parent")+`},"errors":{"test.model":{"code":"system.accessDenied","message":"Access denied"}}}`))
+		c.AssertNoNATSRequest(t, "test.collection")
+	}, withDeniedTestModel)
+}
@@ -0,0 +1,93 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/posener/wstest"
+	"github.com/resgateio/resgate/server"
+)
+
+// dialWS makes a WebSocket upgrade request with the Origin header, and
+// returns the response. Any established connection is closed.
+func dialWS(s *Session, origin string) *http.Response {
+	d := wstest.NewDialer(s.s.GetWSHandlerFunc())
+	c, resp, _ := d.Dial("ws://example.org/", http.Header{"Origin": {origin}})
+	if c != nil {
+		c.Close()
+	}
+	return resp
+}
+
+// Test that the WebSocket upgrade response has Access-Control-* headers set
+// according to the allowOrigin setting.
+func TestWSCORS_UpgradeResponse_HasCORSHeaders(t *testing.T) {
+	tbl := []struct {
+		AllowOrigin    string
+		Origin         string
+		ExpectedStatus int
+		ExpectedOrigin string
+	}{
+		{"*", "https://resgate.io", http.StatusSwitchingProtocols, "*"},
+		{"https://resgate.io", "https://resgate.io", http.StatusSwitchingProtocols, "https://resgate.io"},
+		{"https://api.resgate.io;https://resgate.io", "https://resgate.io", http.StatusSwitchingProtocols, "https://resgate.io"},
+		{"https://resgate.io", "https://other.io", http.StatusForbidden, "https://resgate.io"},
+	}
+
+	for i, l := range tbl {
+		l := l
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			resp := dialWS(s, l.Origin)
+			if resp == nil {
+				t.Fatal("expected a response, but got none")
+			}
+			if resp.StatusCode != l.ExpectedStatus {
+				t.Errorf("expected status code %d, but got %d", l.ExpectedStatus, resp.StatusCode)
+			}
+			if v := resp.Header.Get("Access-Control-Allow-Origin"); v != l.ExpectedOrigin {
+				t.Errorf("expected Access-Control-Allow-Origin to be %#v, but got %#v", l.ExpectedOrigin, v)
+			}
+		}, func(cfg *server.Config) {
+			cfg.AllowOrigin = &l.AllowOrigin
+		})
+	}
+}
+
+// Test that a CORS preflight request to the WebSocket path is responded to
+// with Access-Control-* headers.
+func TestWSCORS_PreflightRequest_HasCORSHeaders(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("OPTIONS", "/", nil, func(r *http.Request) {
+			r.Header.Set("Origin", "https://resgate.io")
+			r.Header.Set("Access-Control-Request-Method", "GET")
+			r.Header.Set("Access-Control-Request-Headers", "Authorization")
+		})
+		hreq.GetResponse(t).
+			AssertStatusCode(t, http.StatusOK).
+			AssertHeaders(t, map[string]string{
+				"Access-Control-Allow-Origin":  "https://resgate.io",
+				"Access-Control-Allow-Methods": "GET, OPTIONS",
+				"Access-Control-Allow-Headers": "Authorization",
+			})
+	}, func(cfg *server.Config) {
+		origin := "https://resgate.io"
+		cfg.AllowOrigin = &origin
+	})
+}
+
+// Test that a non-upgrade request to the WebSocket path is responded to
+// with Access-Control-* headers.
+func TestWSCORS_NonUpgradeRequest_HasCORSHeaders(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/", nil, func(r *http.Request) {
+			r.Header.Set("Origin", "https://resgate.io")
+		})
+		hreq.GetResponse(t).
+			AssertStatusCode(t, http.StatusBadRequest).
+			AssertHeaders(t, map[string]string{"Access-Control-Allow-Origin": "https://resgate.io"})
+	}, func(cfg *server.Config) {
+		origin := "https://resgate.io"
+		cfg.AllowOrigin = &origin
+	})
+}
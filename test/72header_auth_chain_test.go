@@ -0,0 +1,109 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+func withHeaderAuthChain(cfg *server.Config) {
+	cfg.HeaderAuthChain = []server.HeaderAuthMethod{
+		{Header: "Authorization", Method: "vault.jwt"},
+		{Header: "Authorization", Method: "vault.apikey"},
+		{Header: "X-Api-Key", Method: "vault.legacy"},
+	}
+}
+
+// respondHeaderAuthWithToken sets a token on the connection of the auth
+// request, and responds with success.
+func respondHeaderAuthWithToken(t *testing.T, req *Request, s *Session, token json.RawMessage) {
+	cid := req.PathPayload(t, "cid").(string)
+	s.ConnEvent(cid, "token", struct {
+		Token interface{} `json:"token"`
+	}{token})
+	req.RespondSuccess(nil)
+}
+
+// assertHeaderAuthAccess asserts the access request is made with the token,
+// and that the HTTP response is successful.
+func assertHeaderAuthAccess(t *testing.T, s *Session, hreq *HTTPRequest, token interface{}) {
+	mreqs := s.GetParallelRequests(t, 2)
+	mreqs.GetRequest(t, "access.test.model").
+		AssertPathPayload(t, "token", token).
+		RespondSuccess(json.RawMessage(`{"get":true}`))
+	mreqs.GetRequest(t, "get.test.model").
+		RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+	hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(`{"foo":"bar"}`))
+}
+
+// Test that the next header auth method is called when the previous one
+// fails, and that the chain stops at the first method setting a token.
+func TestHeaderAuthChain_FirstMethodFails_CallsNextMethod(t *testing.T) {
+	token := json.RawMessage(`{"user":"foo"}`)
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/model", nil, func(r *http.Request) {
+			r.Header.Set("Authorization", "ApiKey secret")
+		})
+		s.GetRequest(t).
+			AssertSubject(t, "auth.vault.jwt").
+			AssertPathPayload(t, "header.Authorization", []string{"ApiKey secret"}).
+			RespondError(reserr.ErrAccessDenied)
+		req := s.GetRequest(t).
+			AssertSubject(t, "auth.vault.apikey").
+			AssertPathPayload(t, "header.Authorization", []string{"ApiKey secret"})
+		respondHeaderAuthWithToken(t, req, s, token)
+		assertHeaderAuthAccess(t, s, hreq, token)
+	}, withHeaderAuthChain)
+}
+
+// Test that the next header auth method is called when the previous one
+// responds successfully without setting a token.
+func TestHeaderAuthChain_FirstMethodSetsNoToken_CallsNextMethod(t *testing.T) {
+	token := json.RawMessage(`{"user":"foo"}`)
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/model", nil, func(r *http.Request) {
+			r.Header.Set("Authorization", "ApiKey secret")
+		})
+		s.GetRequest(t).AssertSubject(t, "auth.vault.jwt").RespondSuccess(nil)
+		req := s.GetRequest(t).AssertSubject(t, "auth.vault.apikey")
+		respondHeaderAuthWithToken(t, req, s, token)
+		assertHeaderAuthAccess(t, s, hreq, token)
+	}, withHeaderAuthChain)
+}
+
+// Test that methods for headers not carried by the request are skipped.
+func TestHeaderAuthChain_WithoutHeader_SkipsMethod(t *testing.T) {
+	token := json.RawMessage(`{"user":"foo"}`)
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/model", nil, func(r *http.Request) {
+			r.Header.Set("X-Api-Key", "secret")
+		})
+		req := s.GetRequest(t).AssertSubject(t, "auth.vault.legacy")
+		respondHeaderAuthWithToken(t, req, s, token)
+		assertHeaderAuthAccess(t, s, hreq, token)
+	}, withHeaderAuthChain)
+}
+
+// Test that the access request is made without a token when all header auth
+// methods fail.
+func TestHeaderAuthChain_AllMethodsFail_AccessWithoutToken(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/model", nil, func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer secret")
+		})
+		s.GetRequest(t).AssertSubject(t, "auth.vault.jwt").RespondError(reserr.ErrAccessDenied)
+		s.GetRequest(t).AssertSubject(t, "auth.vault.apikey").RespondError(reserr.ErrTimeout)
+		assertHeaderAuthAccess(t, s, hreq, nil)
+	}, withHeaderAuthChain)
+}
+
+// Test that requests without any of the chain's headers make no auth request.
+func TestHeaderAuthChain_WithoutAnyHeader_NoAuthRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/model", nil)
+		assertHeaderAuthAccess(t, s, hreq, nil)
+	}, withHeaderAuthChain)
+}
@@ -0,0 +1,91 @@
+package test
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+// subscribeHookCalls records the calls to a subscribe hook.
+type subscribeHookCalls struct {
+	mu    sync.Mutex
+	calls [][2]string
+}
+
+func (h *subscribeHookCalls) hook(err error) func(cid, rid string) error {
+	return func(cid, rid string) error {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.calls = append(h.calls, [2]string{cid, rid})
+		return err
+	}
+}
+
+func (h *subscribeHookCalls) assertRIDs(t *testing.T, rids ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.calls) != len(rids) {
+		t.Fatalf("expected subscribe hook to be called for %+v, but got %+v", rids, h.calls)
+	}
+	for i, rid := range rids {
+		if h.calls[i][1] != rid {
+			t.Fatalf("expected subscribe hook to be called for %+v, but got %+v", rids, h.calls)
+		}
+	}
+}
+
+// Test that the subscribe hook is called with the connection ID and resource
+// ID on a direct subscription, but not for indirectly subscribed resources.
+func TestSubscribeHook_DirectSubscription_CalledWithCIDAndRID(t *testing.T) {
+	var h subscribeHookCalls
+	runServiceTest(t, "", func(serv *server.Service) {
+		serv.SetSubscribeHook(h.hook(nil))
+	}, func(s *Session) {
+		c := s.Connect()
+		cid := subscribeToTestModelParent(t, s, c, false)
+		h.assertRIDs(t, "test.model.parent")
+		if h.calls[0][0] != cid {
+			t.Fatalf("expected subscribe hook to be called with cid %#v, but got %#v", cid, h.calls[0][0])
+		}
+	})
+}
+
+// Test that a subscribe hook error is sent as the subscribe response error,
+// without any request to the services.
+func TestSubscribeHook_ReturnsError_SubscribeFails(t *testing.T) {
+	quotaErr := &reserr.Error{Code: "custom.quotaExceeded", Message: "Quota exceeded", Data: map[string]interface{}{"max": float64(10)}}
+	runServiceTest(t, "", func(serv *server.Service) {
+		serv.SetSubscribeHook(func(cid, rid string) error { return quotaErr })
+	}, func(s *Session) {
+		c := s.Connect()
+		c.Request("subscribe.test.model", nil).GetResponse(t).AssertError(t, quotaErr)
+		c.AssertNoNATSRequest(t, "test.model")
+	})
+}
+
+// Test that a subscribe hook error not being a RES error is sent as an
+// internal error.
+func TestSubscribeHook_ReturnsNonRESError_InternalError(t *testing.T) {
+	runServiceTest(t, "", func(serv *server.Service) {
+		serv.SetSubscribeHook(func(cid, rid string) error { return errors.New("feature disabled") })
+	}, func(s *Session) {
+		c := s.Connect()
+		c.Request("subscribe.test.model", nil).GetResponse(t).AssertErrorCode(t, reserr.CodeInternalError)
+	})
+}
+
+// Test that a subscribe hook error is sent as the HTTP response error for a
+// HTTP GET request.
+func TestSubscribeHook_ReturnsErrorOnHTTPGet_HTTPError(t *testing.T) {
+	runServiceTest(t, "", func(serv *server.Service) {
+		serv.SetSubscribeHook(func(cid, rid string) error { return reserr.ErrAccessDenied })
+	}, func(s *Session) {
+		s.HTTPRequest("GET", "/api/test/model", nil).GetResponse(t).
+			AssertStatusCode(t, http.StatusUnauthorized).
+			AssertError(t, reserr.ErrAccessDenied)
+	})
+}
@@ -0,0 +1,87 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/posener/wstest"
+	"github.com/resgateio/resgate/server"
+)
+
+func withAuthQueryParams(cfg *server.Config) {
+	cfg.AuthQueryParams = []string{"code"}
+}
+
+// connectWithURL makes a new mock client websocket connection to the URL,
+// that handshakes with version v1.999.999.
+func connectWithURL(s *Session, url string) *Conn {
+	d := wstest.NewDialer(s.s.GetWSHandlerFunc())
+	wc, _, err := d.Dial(url, nil)
+	if err != nil {
+		panic(err)
+	}
+	c := NewConn(s, d, wc, make(chan *ClientEvent, 256))
+	s.conns[c] = struct{}{}
+	c.Request("version", versionRequest).GetResponse(s.t).AssertResult(s.t, versionResult)
+	return c
+}
+
+// Test that the configured query parameters of the connection URL are
+// included in auth requests, and removed from the uri.
+func TestAuthQueryParams_AuthRequest_IncludesQueryParams(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := connectWithURL(s, "ws://example.org/?code=secret&lang=en")
+		creq := c.Request("auth.test.model.login", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "auth.test.model.login").
+			AssertPathPayload(t, "queryParams", map[string][]string{"code": {"secret"}}).
+			AssertPathPayload(t, "uri", "/?lang=en").
+			RespondSuccess(nil)
+		creq.GetResponse(t)
+	}, withAuthQueryParams)
+}
+
+// Test that the configured query parameters of the connection URL are not
+// included in access or call requests.
+func TestAuthQueryParams_CallRequest_ExcludesQueryParams(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := connectWithURL(s, "ws://example.org/?code=secret")
+		creq := c.Request("call.test.model.method", nil)
+		for _, subj := range []string{"access.test.model", "call.test.model.method"} {
+			req := s.GetRequest(t).AssertSubject(t, subj)
+			if bytes.Contains(req.RawPayload, []byte("secret")) {
+				t.Fatalf("expected %s request payload not to contain query parameter, but got:\n%s", subj, req.RawPayload)
+			}
+			if subj == "access.test.model" {
+				req.RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+			} else {
+				req.RespondSuccess(nil)
+			}
+		}
+		creq.GetResponse(t)
+	}, withAuthQueryParams)
+}
+
+// Test that auth requests have no queryParams property, and an unmodified
+// uri, if the connection URL has none of the configured query parameters.
+func TestAuthQueryParams_WithoutQueryParams_NoQueryParamsProperty(t *testing.T) {
+	for _, withSetting := range []bool{true, false} {
+		runTest(t, func(s *Session) {
+			c := connectWithURL(s, "ws://example.org/?lang=en")
+			creq := c.Request("auth.test.model.login", nil)
+			req := s.GetRequest(t).
+				AssertSubject(t, "auth.test.model.login").
+				AssertPathPayload(t, "uri", "/?lang=en")
+			if _, ok := req.Payload.(map[string]interface{})["queryParams"]; ok {
+				t.Fatalf("expected auth request payload to have no queryParams, but got:\n%s", req.RawPayload)
+			}
+			req.RespondSuccess(nil)
+			creq.GetResponse(t)
+		}, func(cfg *server.Config) {
+			if withSetting {
+				withAuthQueryParams(cfg)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+func withConnectionCountThresholds(thresholds ...int) func(*server.Config) {
+	return func(cfg *server.Config) {
+		cfg.ConnectionCountThresholds = thresholds
+	}
+}
+
+// Test that a message is published when the number of WebSocket connections
+// crosses a threshold, up or down.
+func TestConnectionCount_CrossingThreshold_PublishesMessage(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c1 := s.Connect()
+		c2 := s.Connect()
+		s.GetRequest(t).Equals(t, server.ConnectionCountSubject, json.RawMessage(`{"count":2,"direction":"up"}`))
+
+		c3 := s.Connect()
+		s.GetRequest(t).Equals(t, server.ConnectionCountSubject, json.RawMessage(`{"count":3,"direction":"up"}`))
+
+		c3.Disconnect()
+		s.GetRequest(t).Equals(t, server.ConnectionCountSubject, json.RawMessage(`{"count":2,"direction":"down"}`))
+
+		c2.Disconnect()
+		s.GetRequest(t).Equals(t, server.ConnectionCountSubject, json.RawMessage(`{"count":1,"direction":"down"}`))
+
+		// Validate no message is published when disconnecting c1 without
+		// crossing a threshold, by asserting that the next message is the
+		// one for crossing the threshold again.
+		c1.Disconnect()
+		s.AssertConnCount(t, 0)
+		s.Connect()
+		s.Connect()
+		s.GetRequest(t).Equals(t, server.ConnectionCountSubject, json.RawMessage(`{"count":2,"direction":"up"}`))
+	}, withConnectionCountThresholds(3, 2))
+}
+
+// Test that HTTP requests are not counted as connections.
+func TestConnectionCount_HTTPRequest_NotCounted(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"foo":"bar"}}`))
+		hreq.GetResponse(t).AssertStatusCode(t, 200)
+
+		s.Connect()
+		s.GetRequest(t).Equals(t, server.ConnectionCountSubject, json.RawMessage(`{"count":1,"direction":"up"}`))
+	}, withConnectionCountThresholds(1))
+}
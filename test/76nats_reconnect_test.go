@@ -0,0 +1,125 @@
+package test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+// Test that reconnecting to NATS sends get and access requests for a
+// subscribed model, and sends a change event for any value changed while
+// disconnected.
+func TestNATSReconnect_ChangedModel_SendsChangeEvent(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.Reconnect()
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"string":"bar","int":42,"bool":true,"null":null}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		c.AssertNoEvent(t, "test.model")
+	})
+}
+
+// Test that reconnecting to NATS sends add and remove events for a subscribed
+// collection changed while disconnected.
+func TestNATSReconnect_ChangedCollection_SendsAddRemoveEvents(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestCollection(t, s, c)
+
+		s.Reconnect()
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.collection").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.collection").RespondSuccess(json.RawMessage(`{"collection":[42,"new",true,null]}`))
+		c.GetEvent(t).Equals(t, "test.collection.remove", json.RawMessage(`{"idx":0}`))
+		c.GetEvent(t).Equals(t, "test.collection.add", json.RawMessage(`{"idx":1,"value":"new"}`))
+		c.AssertNoEvent(t, "test.collection")
+	})
+}
+
+// Test that reconnecting to NATS sends no events for an unchanged resource.
+func TestNATSReconnect_UnchangedModel_SendsNoEvents(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		model := resourceData("test.model")
+		subscribeToTestModel(t, s, c)
+
+		s.Reconnect()
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + model + `}`))
+		c.AssertNoEvent(t, "test.model")
+		// Validate subsequent events are sent to client
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"int":12}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"int":12}}`))
+	})
+}
+
+// Test that reconnecting to NATS unsubscribes a model if access was revoked
+// while disconnected.
+func TestNATSReconnect_AccessDenied_UnsubscribesResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		model := resourceData("test.model")
+		subscribeToTestModel(t, s, c)
+
+		s.Reconnect()
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":false}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + model + `}`))
+		c.GetEvent(t).Equals(t, "test.model.unsubscribe", mock.UnsubscribeReasonAccessDenied)
+	})
+}
+
+// Test that reconnecting to NATS deletes a model that was changed to a
+// collection while disconnected.
+func TestNATSReconnect_ChangedResourceType_DeletesResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.Reconnect()
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"collection":["foo",42,true,null]}`))
+		c.GetEvent(t).Equals(t, "test.model.delete", nil)
+		c.GetEvent(t).Equals(t, "test.model.unsubscribe", mock.UnsubscribeReasonDeleted)
+		// Validate subsequent events are not sent to client
+		s.ResourceEvent("test.model", "custom", json.RawMessage(`{"foo":"bar"}`))
+		c.AssertNoEvent(t, "test.model")
+		s.AssertErrorsLogged(t, 1)
+	})
+}
+
+// Test that the NATS event callbacks are called when the connection to NATS
+// is lost, and after it is reestablished.
+func TestNATSReconnect_EventCallbacks_CalledOnDisconnectAndReconnect(t *testing.T) {
+	var events []string
+	runServiceTest(t, "", func(serv *server.Service) {
+		serv.WithNATSEventCallbacks(
+			func() { events = append(events, "disconnect") },
+			func() { events = append(events, "reconnect") },
+		)
+	}, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.Disconnect()
+		if !reflect.DeepEqual(events, []string{"disconnect"}) {
+			t.Fatalf("expected events to be [disconnect], but got %v", events)
+		}
+		s.Reconnect()
+		if !reflect.DeepEqual(events, []string{"disconnect", "reconnect"}) {
+			t.Fatalf("expected events to be [disconnect reconnect], but got %v", events)
+		}
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		c.AssertNoEvent(t, "test.model")
+	})
+}
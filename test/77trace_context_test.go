@@ -0,0 +1,189 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+const (
+	testTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testTraceparent = "00-" + testTraceID + "-00f067aa0ba902b7-01"
+)
+
+var traceparentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+func withTraceContext(cfg *server.Config) {
+	cfg.TraceContext = true
+}
+
+// assertTraceparent asserts that the request has a traceparent header with
+// the trace ID, or any trace ID if traceID is empty, and a span ID other than
+// the one of testTraceparent. The trace ID and span ID are returned.
+func assertTraceparent(t *testing.T, r *Request, traceID string) (string, string) {
+	var v string
+	if h := r.Header["traceparent"]; len(h) > 0 {
+		v = h[0]
+	}
+	m := traceparentPattern.FindStringSubmatch(v)
+	if m == nil {
+		t.Fatalf("expected request %s to have a valid traceparent header, but got %#v", r.Subject, v)
+	}
+	if traceID != "" && m[1] != traceID {
+		t.Fatalf("expected request %s to have trace ID %#v, but got %#v", r.Subject, traceID, m[1])
+	}
+	if m[2] == "00f067aa0ba902b7" {
+		t.Fatalf("expected request %s to have a new span ID, but got the parent span ID", r.Subject)
+	}
+	return m[1], m[2]
+}
+
+// Test that get and access requests for a subscription are sent with a
+// traceparent header of a single span, in the trace of the WebSocket upgrade
+// request, and that the tracestate header is passed on.
+func TestTraceContext_Subscribe_SetsTraceparentOnRequests(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.ConnectWithHeader(http.Header{
+			"Traceparent": {testTraceparent},
+			"Tracestate":  {"congo=t61rcWkgMzE"},
+		})
+
+		creq := c.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		areq := mreqs.GetRequest(t, "access.test.model").AssertHeader(t, "tracestate", "congo=t61rcWkgMzE")
+		greq := mreqs.GetRequest(t, "get.test.model").AssertHeader(t, "tracestate", "congo=t61rcWkgMzE")
+		_, aspan := assertTraceparent(t, areq, testTraceID)
+		_, gspan := assertTraceparent(t, greq, testTraceID)
+		if aspan != gspan {
+			t.Errorf("expected requests to have the same span ID, but got %#v and %#v", aspan, gspan)
+		}
+		areq.RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		greq.RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		creq.GetResponse(t)
+
+		// Validate a new client request has a new span
+		creq = c.Request("call.test.model.method", nil)
+		req := s.GetRequest(t).AssertSubject(t, "call.test.model.method")
+		if _, span := assertTraceparent(t, req, testTraceID); span == gspan {
+			t.Errorf("expected call request to have a new span ID, but got %#v", span)
+		}
+		req.RespondSuccess(nil)
+		creq.GetResponse(t)
+	}, withTraceContext)
+}
+
+// Test that call and auth requests for client requests on a connection
+// without traceparent header are sent with a traceparent header, starting a
+// new trace for each client request.
+func TestTraceContext_WithoutTraceparent_StartsNewTrace(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+
+		creq := c.Request("auth.test.model.login", nil)
+		req := s.GetRequest(t).AssertHeader(t, "tracestate", "")
+		trace1, _ := assertTraceparent(t, req, "")
+		req.RespondSuccess(nil)
+		creq.GetResponse(t)
+
+		creq = c.Request("auth.test.model.login", nil)
+		req = s.GetRequest(t)
+		trace2, _ := assertTraceparent(t, req, "")
+		req.RespondSuccess(nil)
+		creq.GetResponse(t)
+
+		if trace1 == trace2 {
+			t.Errorf("expected client requests to have different trace IDs, but both got %#v", trace1)
+		}
+	}, withTraceContext)
+}
+
+// Test that get and access requests for an HTTP API request are sent with a
+// traceparent header in the trace of the HTTP request.
+func TestTraceContext_HTTPGet_SetsTraceparentOnRequests(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/model", nil, func(r *http.Request) {
+			r.Header.Set("traceparent", testTraceparent)
+		})
+		mreqs := s.GetParallelRequests(t, 2)
+		areq := mreqs.GetRequest(t, "access.test.model")
+		greq := mreqs.GetRequest(t, "get.test.model")
+		assertTraceparent(t, areq, testTraceID)
+		assertTraceparent(t, greq, testTraceID)
+		areq.RespondSuccess(json.RawMessage(`{"get":true}`))
+		greq.RespondSuccess(json.RawMessage(`{"model":` + resourceData("test.model") + `}`))
+		hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(resourceData("test.model")))
+	}, withTraceContext)
+}
+
+// Test that an invalid traceparent header is ignored, starting a new trace.
+func TestTraceContext_InvalidTraceparent_StartsNewTrace(t *testing.T) {
+	for _, traceparent := range []string{
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-" + testTraceID + "-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-" + testTraceID + "-00f067aa0ba902b7-01",
+		"00-" + testTraceID + "-00f067aa0ba902b7-01-extra",
+		"00-" + testTraceID + "-00f067aa0ba902b7",
+	} {
+		runNamedTest(t, traceparent, func(s *Session) {
+			c := s.ConnectWithHeader(http.Header{"Traceparent": {traceparent}})
+			creq := c.Request("auth.test.model.login", nil)
+			req := s.GetRequest(t)
+			if traceID, _ := assertTraceparent(t, req, ""); traceID == testTraceID {
+				t.Errorf("expected a new trace ID, but got %#v", traceID)
+			}
+			req.RespondSuccess(nil)
+			creq.GetResponse(t)
+		}, withTraceContext)
+	}
+}
+
+// Test that the trace context headers of a query event are set on the query
+// request.
+func TestTraceContext_QueryEvent_SetsEventTraceparentOnQueryRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestQueryModel(t, s, c, "q=foo&f=bar", "q=foo&f=bar")
+
+		s.ResourceEventWithHeaders("test.model", "query", json.RawMessage(`{"subject":"_EVENT_01_"}`), map[string][]string{
+			"traceparent": {testTraceparent},
+			"tracestate":  {"congo=t61rcWkgMzE"},
+		})
+		s.GetRequest(t).
+			AssertSubject(t, "_EVENT_01_").
+			AssertHeader(t, "traceparent", testTraceparent).
+			AssertHeader(t, "tracestate", "congo=t61rcWkgMzE").
+			RespondSuccess(json.RawMessage(`{}`))
+		c.AssertNoEvent(t, "test.model")
+	}, withTraceContext)
+}
+
+// Test that no trace context headers are set on requests if the
+// traceContext setting is not enabled.
+func TestTraceContext_Disabled_SetsNoTraceHeaders(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.ConnectWithHeader(http.Header{
+			"Traceparent": {testTraceparent},
+			"Tracestate":  {"congo=t61rcWkgMzE"},
+		})
+		subscribeToTestQueryModel(t, s, c, "q=foo&f=bar", "q=foo&f=bar")
+
+		creq := c.Request("auth.test.model.login", nil)
+		s.GetRequest(t).
+			AssertHeader(t, "traceparent", "").
+			AssertHeader(t, "tracestate", "").
+			RespondSuccess(nil)
+		creq.GetResponse(t)
+
+		s.ResourceEventWithHeaders("test.model", "query", json.RawMessage(`{"subject":"_EVENT_01_"}`), map[string][]string{
+			"traceparent": {testTraceparent},
+		})
+		s.GetRequest(t).
+			AssertSubject(t, "_EVENT_01_").
+			AssertHeader(t, "traceparent", "").
+			RespondSuccess(json.RawMessage(`{}`))
+	})
+}
@@ -0,0 +1,81 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+)
+
+// Background refresh interval used for testing
+const backgroundRefreshInterval = 100
+
+func withBackgroundRefresh(refresh map[string]int) func(*server.Config) {
+	return func(cfg *server.Config) {
+		cfg.BackgroundRefresh = refresh
+	}
+}
+
+// Test that a subscribed model matching a backgroundRefresh pattern is
+// re-fetched, and that a change event is sent for any changed value.
+func TestBackgroundRefresh_ChangedModel_SendsChangeEvent(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":{"string":"bar","int":42,"bool":true,"null":null}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		c.AssertNoEvent(t, "test.model")
+	}, withBackgroundRefresh(map[string]int{"test.>": backgroundRefreshInterval}))
+}
+
+// Test that a subscribed collection matching a backgroundRefresh pattern is
+// re-fetched, and that add and remove events are sent for any changes.
+func TestBackgroundRefresh_ChangedCollection_SendsAddRemoveEvents(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestCollection(t, s, c)
+
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.collection").
+			RespondSuccess(json.RawMessage(`{"collection":[42,"new",true,null]}`))
+		c.GetEvent(t).Equals(t, "test.collection.remove", json.RawMessage(`{"idx":0}`))
+		c.GetEvent(t).Equals(t, "test.collection.add", json.RawMessage(`{"idx":1,"value":"new"}`))
+		c.AssertNoEvent(t, "test.collection")
+	}, withBackgroundRefresh(map[string]int{"test.>": backgroundRefreshInterval}))
+}
+
+// Test that a subscribed resource is not re-fetched if it matches no
+// backgroundRefresh pattern, or if the longest matching pattern has a zero
+// interval.
+func TestBackgroundRefresh_NoMatchingInterval_SendsNoRequest(t *testing.T) {
+	for _, refresh := range []map[string]int{
+		{"other.>": backgroundRefreshInterval},
+		{"test.>": backgroundRefreshInterval, "test.model": 0},
+	} {
+		runTest(t, func(s *Session) {
+			c := s.Connect()
+			subscribeToTestModel(t, s, c)
+
+			time.Sleep(3 * backgroundRefreshInterval * time.Millisecond)
+			c.AssertNoNATSRequest(t, "test.model")
+		}, withBackgroundRefresh(refresh))
+	}
+}
+
+// Test that a resource without subscribers is not re-fetched while retained
+// in the cache.
+func TestBackgroundRefresh_UnsubscribedResource_SendsNoRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+		c.Request("unsubscribe.test.model", nil).GetResponse(t)
+
+		time.Sleep(3 * backgroundRefreshInterval * time.Millisecond)
+		c.AssertNoNATSRequest(t, "test.model")
+		s.AssertCacheSize(t, 1)
+	}, withBackgroundRefresh(map[string]int{"test.>": backgroundRefreshInterval}))
+}
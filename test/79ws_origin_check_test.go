@@ -0,0 +1,84 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+// Test that a WebSocket origin check created with AllowedOrigins accepts
+// allowed origins, and rejects other origins with 403 Forbidden.
+func TestWSOriginCheck_AllowedOrigins_ValidatesOrigin(t *testing.T) {
+	tbl := []struct {
+		Origin         string
+		ExpectedStatus int
+	}{
+		{"https://resgate.io", http.StatusSwitchingProtocols},
+		{"https://RESGATE.io", http.StatusSwitchingProtocols},
+		{"https://api.resgate.io", http.StatusSwitchingProtocols},
+		{"https://evil.io", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	}
+
+	for i, l := range tbl {
+		l := l
+		runServiceTest(t, fmt.Sprintf("#%d", i+1), func(serv *server.Service) {
+			serv.SetWebSocketOriginCheck(server.AllowedOrigins("https://resgate.io", "https://API.resgate.io"))
+		}, func(s *Session) {
+			resp := dialWS(s, l.Origin)
+			if resp == nil {
+				t.Fatal("expected a response, but got none")
+			}
+			if resp.StatusCode != l.ExpectedStatus {
+				t.Errorf("expected status code %d, but got %d", l.ExpectedStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
+// Test that a WebSocket origin check replaces the allowOrigin setting, and
+// that the connection is rejected with 403 Forbidden when it returns false.
+func TestWSOriginCheck_CheckReturnsFalse_RejectsUpgrade(t *testing.T) {
+	var called bool
+	runServiceTest(t, "", func(serv *server.Service) {
+		serv.SetWebSocketOriginCheck(func(r *http.Request) bool {
+			called = true
+			return false
+		})
+	}, func(s *Session) {
+		resp := dialWS(s, "https://resgate.io")
+		if resp == nil {
+			t.Fatal("expected a response, but got none")
+		}
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("expected status code %d, but got %d", http.StatusForbidden, resp.StatusCode)
+		}
+		if !called {
+			t.Errorf("expected origin check to be called")
+		}
+	}, func(cfg *server.Config) {
+		origin := "*"
+		cfg.AllowOrigin = &origin
+	})
+}
+
+// Test that setting a nil WebSocket origin check uses the allowOrigin
+// setting.
+func TestWSOriginCheck_NilCheck_UsesAllowOriginSetting(t *testing.T) {
+	runServiceTest(t, "", func(serv *server.Service) {
+		serv.SetWebSocketOriginCheck(func(r *http.Request) bool { return false })
+		serv.SetWebSocketOriginCheck(nil)
+	}, func(s *Session) {
+		if resp := dialWS(s, "https://resgate.io"); resp == nil || resp.StatusCode != http.StatusSwitchingProtocols {
+			t.Errorf("expected allowed origin to be accepted, but got %+v", resp)
+		}
+		if resp := dialWS(s, "https://evil.io"); resp == nil || resp.StatusCode != http.StatusForbidden {
+			t.Errorf("expected disallowed origin to be rejected, but got %+v", resp)
+		}
+	}, func(cfg *server.Config) {
+		origin := "https://resgate.io"
+		cfg.AllowOrigin = &origin
+	})
+}
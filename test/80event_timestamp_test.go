@@ -0,0 +1,124 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/resgateio/resgate/server"
+)
+
+func withTimestampEvents(cfg *server.Config) {
+	cfg.TimestampEvents = true
+}
+
+// Test that a ts field set by the service on change, add, and remove events
+// is sent to the client in UTC, with or without timestampEvents enabled.
+func TestEventTimestamp_ServiceTimestamp_SentToClient(t *testing.T) {
+	tbl := []struct {
+		RID           string
+		Event         string
+		Payload       string
+		ExpectedEvent string
+	}{
+		{"test.model", "change", `{"values":{"string":"bar"},"ts":"2024-01-01T00:00:00Z"}`, `{"values":{"string":"bar"},"ts":"2024-01-01T00:00:00Z"}`},
+		{"test.model", "change", `{"values":{"string":"bar"},"ts":"2024-01-01T02:00:00.5+02:00"}`, `{"values":{"string":"bar"},"ts":"2024-01-01T00:00:00.5Z"}`},
+		{"test.collection", "add", `{"idx":1,"value":"bar","ts":"2024-01-01T00:00:00Z"}`, `{"idx":1,"value":"bar","ts":"2024-01-01T00:00:00Z"}`},
+		{"test.collection", "remove", `{"idx":1,"ts":"2024-01-01T00:00:00Z"}`, `{"idx":1,"ts":"2024-01-01T00:00:00Z"}`},
+	}
+
+	for i, l := range tbl {
+		for _, timestampEvents := range []bool{true, false} {
+			l := l
+			timestampEvents := timestampEvents
+			runNamedTest(t, fmt.Sprintf("#%d with timestampEvents set to %v", i+1, timestampEvents), func(s *Session) {
+				c := s.Connect()
+				subscribeToResource(t, s, c, l.RID)
+
+				s.ResourceEvent(l.RID, l.Event, json.RawMessage(l.Payload))
+				c.GetEvent(t).Equals(t, l.RID+"."+l.Event, json.RawMessage(l.ExpectedEvent))
+			}, func(cfg *server.Config) {
+				cfg.TimestampEvents = timestampEvents
+			})
+		}
+	}
+}
+
+// Test that change, add, and remove events without a ts field are sent to
+// the client without ts if timestampEvents is not enabled.
+func TestEventTimestamp_NoServiceTimestamp_SentWithoutTimestamp(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+		subscribeToTestCollection(t, s, c)
+
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"string":"bar"}}`))
+		s.ResourceEvent("test.collection", "add", json.RawMessage(`{"idx":1,"value":"bar"}`))
+		c.GetEvent(t).Equals(t, "test.collection.add", json.RawMessage(`{"idx":1,"value":"bar"}`))
+		s.ResourceEvent("test.collection", "remove", json.RawMessage(`{"idx":1}`))
+		c.GetEvent(t).Equals(t, "test.collection.remove", json.RawMessage(`{"idx":1}`))
+	})
+}
+
+// Test that change, add, and remove events without a ts field are stamped
+// with the time received if timestampEvents is enabled.
+func TestEventTimestamp_NoServiceTimestamp_StampedByServer(t *testing.T) {
+	tbl := []struct {
+		RID     string
+		Event   string
+		Payload string
+	}{
+		{"test.model", "change", `{"values":{"string":"bar"}}`},
+		{"test.collection", "add", `{"idx":1,"value":"bar"}`},
+		{"test.collection", "remove", `{"idx":1}`},
+	}
+
+	for i, l := range tbl {
+		l := l
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			subscribeToResource(t, s, c, l.RID)
+
+			before := time.Now().Truncate(time.Millisecond)
+			s.ResourceEvent(l.RID, l.Event, json.RawMessage(l.Payload))
+			ev := c.GetEvent(t).AssertEventName(t, l.RID+"."+l.Event)
+			after := time.Now()
+
+			data, ok := ev.Data.(map[string]interface{})
+			if !ok {
+				t.Fatalf("expected event data to be an object, but got %#v", ev.Data)
+			}
+			str, ok := data["ts"].(string)
+			if !ok {
+				t.Fatalf("expected event data to have a ts string, but got %#v", data["ts"])
+			}
+			ts, err := time.Parse(time.RFC3339Nano, str)
+			if err != nil {
+				t.Fatalf("expected ts to be an RFC 3339 time, but got %#v: %s", str, err)
+			}
+			if ts.Before(before) || ts.After(after) {
+				t.Errorf("expected ts to be between %s and %s, but got %s", before, after, ts)
+			}
+		}, withTimestampEvents)
+	}
+}
+
+// Test that events generated by the cache on a system reset are stamped with
+// the time received if timestampEvents is enabled.
+func TestEventTimestamp_SystemReset_StampedByServer(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		subscribeToTestModel(t, s, c)
+
+		s.SystemEvent("reset", json.RawMessage(`{"resources":["test.>"]}`))
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":{"string":"bar","int":42,"bool":true,"null":null}}`))
+		ev := c.GetEvent(t).AssertEventName(t, "test.model.change")
+		if data, ok := ev.Data.(map[string]interface{}); !ok || data["ts"] == nil {
+			t.Errorf("expected event data to have a ts field, but got %#v", ev.Data)
+		}
+	}, withTimestampEvents)
+}
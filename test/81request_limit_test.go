@@ -0,0 +1,102 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+func withRequestLimit(limit, queueSize, queueTimeout int) func(*server.Config) {
+	return func(cfg *server.Config) {
+		cfg.RequestLimit = limit
+		cfg.RequestQueueSize = queueSize
+		cfg.RequestQueueTimeout = queueTimeout
+	}
+}
+
+// Test that requests beyond the request limit are queued until previous
+// requests are responded to, and that requests beyond the queue size fail
+// with system.serviceUnavailable.
+func TestRequestLimit_ExceedingLimit_QueuesAndShedsRequests(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+
+		creqA := c.Request("auth.test.model.a", nil)
+		creqB := c.Request("auth.test.model.b", nil)
+		creqC := c.Request("auth.test.model.c", nil)
+		creqD := c.Request("auth.test.model.d", nil)
+		reqs := s.GetParallelRequests(t, 2)
+
+		// Queue is full
+		creqD.GetResponse(t).AssertErrorCode(t, reserr.CodeServiceUnavailable)
+		s.AssertNATSRequestCount(t, "auth.test.model.c", 0)
+		s.AssertNATSRequestCount(t, "auth.test.model.d", 0)
+
+		// Responding frees a slot for the queued request
+		reqs.GetRequest(t, "auth.test.model.a").RespondSuccess(nil)
+		creqA.GetResponse(t)
+		reqC := s.GetRequest(t).AssertSubject(t, "auth.test.model.c")
+
+		reqs.GetRequest(t, "auth.test.model.b").RespondSuccess(nil)
+		creqB.GetResponse(t).AssertResult(t, json.RawMessage(`{"payload":null}`))
+		reqC.RespondSuccess(nil)
+		creqC.GetResponse(t).AssertResult(t, json.RawMessage(`{"payload":null}`))
+
+		// Requests are sent once the service answers again
+		creqE := c.Request("auth.test.model.e", nil)
+		s.GetRequest(t).AssertSubject(t, "auth.test.model.e").RespondSuccess(nil)
+		creqE.GetResponse(t).AssertResult(t, json.RawMessage(`{"payload":null}`))
+	}, withRequestLimit(2, 1, 0))
+}
+
+// Test that a queued request fails with system.serviceUnavailable when the
+// queue timeout expires, without being sent.
+func TestRequestLimit_QueueTimeout_FailsQueuedRequest(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+
+		creqA := c.Request("auth.test.model.a", nil)
+		creqB := c.Request("auth.test.model.b", nil)
+		reqA := s.GetRequest(t).AssertSubject(t, "auth.test.model.a")
+
+		creqB.GetResponse(t).AssertErrorCode(t, reserr.CodeServiceUnavailable)
+
+		reqA.RespondSuccess(nil)
+		creqA.GetResponse(t).AssertResult(t, json.RawMessage(`{"payload":null}`))
+		s.AssertNATSRequestCount(t, "auth.test.model.b", 0)
+
+		// Requests are sent once the service answers again
+		creqC := c.Request("auth.test.model.c", nil)
+		s.GetRequest(t).AssertSubject(t, "auth.test.model.c").RespondSuccess(nil)
+		creqC.GetResponse(t).AssertResult(t, json.RawMessage(`{"payload":null}`))
+	}, withRequestLimit(1, 1, 50))
+}
+
+// Test that a request limit holds under load, with no more outstanding
+// requests than the limit, and that all queued requests are eventually sent.
+func TestRequestLimit_ManyRequests_LimitHolds(t *testing.T) {
+	const limit = 5
+	const total = 50
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+
+		creqs := make([]*ClientRequest, total)
+		for i := range creqs {
+			creqs[i] = c.Request("auth.test.model.method", nil)
+		}
+
+		for sent := 0; sent < total; sent += limit {
+			reqs := s.GetParallelRequests(t, limit)
+			s.AssertNATSRequestCount(t, "auth.test.model.method", sent+limit)
+			for _, req := range reqs {
+				req.RespondSuccess(nil)
+			}
+		}
+
+		for _, creq := range creqs {
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"payload":null}`))
+		}
+	}, withRequestLimit(limit, total, 0))
+}
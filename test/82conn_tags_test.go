@@ -0,0 +1,90 @@
+package test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/resgateio/resgate/metrics"
+	"github.com/resgateio/resgate/server"
+)
+
+// testConnectionTagger tags connections with the client type from the
+// X-Client-Type header, and the client version from the User-Agent header.
+func testConnectionTagger(r *http.Request) map[string]string {
+	tags := make(map[string]string)
+	if v := r.Header.Get("X-Client-Type"); v != "" {
+		tags["client"] = v
+	}
+	if v := r.Header.Get("User-Agent"); v != "" {
+		tags["version"] = v
+	}
+	return tags
+}
+
+func taggedConnections(t *testing.T, tag, value string) float64 {
+	var m dto.Metric
+	if err := metrics.WSTaggedConnections.WithLabelValues(tag, value).Write(&m); err != nil {
+		t.Fatalf("error reading gauge: %s", err)
+	}
+	return m.GetGauge().GetValue()
+}
+
+// Test that the tags set by a connection tagger are included in the log
+// entries of the connection.
+func TestConnectionTagger_TaggedConnection_TagsInLog(t *testing.T) {
+	runServiceTest(t, "", func(serv *server.Service) {
+		serv.WithConnectionTagger(testConnectionTagger)
+	}, func(s *Session) {
+		c := s.ConnectWithHeader(http.Header{
+			"X-Client-Type": {"web"},
+			"User-Agent":    {"resclient 1.2"},
+		})
+		c.Request("version", versionRequest).GetResponse(t).AssertResult(t, versionResult)
+
+		expected := ` client=web version="resclient 1.2"] Connected`
+		if !strings.Contains(s.String(), expected) {
+			t.Errorf("expected log to contain %#v, but got:\n%s", expected, s.String())
+		}
+	})
+}
+
+// Test that a connection without tags has no tags in the log entries.
+func TestConnectionTagger_NoTags_NoTagsInLog(t *testing.T) {
+	runServiceTest(t, "", func(serv *server.Service) {
+		serv.WithConnectionTagger(testConnectionTagger)
+	}, func(s *Session) {
+		c := s.ConnectWithHeader(nil)
+		c.Request("version", versionRequest).GetResponse(t).AssertResult(t, versionResult)
+
+		if strings.Contains(s.String(), "client=") {
+			t.Errorf("expected log not to contain tags, but got:\n%s", s.String())
+		}
+	})
+}
+
+// Test that the tagged connections metric is increased for each tag on
+// connect, and decreased on disconnect.
+func TestConnectionTagger_TaggedConnection_UpdatesMetric(t *testing.T) {
+	runServiceTest(t, "", func(serv *server.Service) {
+		serv.WithConnectionTagger(testConnectionTagger)
+	}, func(s *Session) {
+		before := taggedConnections(t, "client", "metrics-test")
+		c := s.ConnectWithHeader(http.Header{"X-Client-Type": {"metrics-test"}})
+		c.Request("version", versionRequest).GetResponse(t).AssertResult(t, versionResult)
+		if v := taggedConnections(t, "client", "metrics-test"); v != before+1 {
+			t.Fatalf("expected tagged connections to be %v, but got %v", before+1, v)
+		}
+
+		c.Disconnect()
+		deadline := time.Now().Add(time.Second)
+		for taggedConnections(t, "client", "metrics-test") != before {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected tagged connections to be %v after disconnect, but got %v", before, taggedConnections(t, "client", "metrics-test"))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
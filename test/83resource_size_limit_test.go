@@ -0,0 +1,102 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+func withResourceSizeLimits(maxModelFields, maxCollectionSize int) func(*server.Config) {
+	return func(cfg *server.Config) {
+		cfg.MaxModelFields = maxModelFields
+		cfg.MaxCollectionSize = maxCollectionSize
+	}
+}
+
+// Test that a get response exceeding the resource size limits is responded
+// with system.resourceTooLarge, and that the resource is not cached.
+func TestResourceSizeLimit_ExceedingLimit_ReturnsErrResourceTooLarge(t *testing.T) {
+	tbl := []struct {
+		RID          string
+		GetResponse  string
+		ExpectedSize int
+	}{
+		{"test.model", `{"model":{"a":1,"b":2,"c":3}}`, 3},
+		{"test.collection", `{"collection":[1,2,3,4]}`, 4},
+	}
+
+	for i, l := range tbl {
+		l := l
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			expectedErr := &reserr.Error{
+				Code:    reserr.CodeResourceTooLarge,
+				Message: "Resource too large",
+				Data:    map[string]interface{}{"size": float64(l.ExpectedSize), "limit": float64(2)},
+			}
+
+			// Subscribe twice, to assert the resource is requested again
+			for j := 0; j < 2; j++ {
+				creq := c.Request("subscribe."+l.RID, nil)
+				mreqs := s.GetParallelRequests(t, 2)
+				mreqs.GetRequest(t, "access."+l.RID).RespondSuccess(json.RawMessage(`{"get":true}`))
+				mreqs.GetRequest(t, "get."+l.RID).RespondSuccess(json.RawMessage(l.GetResponse))
+				creq.GetResponse(t).AssertError(t, expectedErr)
+				s.AssertErrorsLogged(t, 1)
+			}
+		}, withResourceSizeLimits(2, 2))
+	}
+}
+
+// Test that a get response within the resource size limits is cached and
+// sent to the client.
+func TestResourceSizeLimit_WithinLimit_ReturnsResource(t *testing.T) {
+	tbl := []struct {
+		RID            string
+		GetResponse    string
+		ExpectedResult string
+	}{
+		{"test.model", `{"model":{"a":1,"b":2}}`, `{"models":{"test.model":{"a":1,"b":2}}}`},
+		{"test.collection", `{"collection":[1,2]}`, `{"collections":{"test.collection":[1,2]}}`},
+	}
+
+	for i, l := range tbl {
+		l := l
+		runNamedTest(t, fmt.Sprintf("#%d", i+1), func(s *Session) {
+			c := s.Connect()
+			creq := c.Request("subscribe."+l.RID, nil)
+			mreqs := s.GetParallelRequests(t, 2)
+			mreqs.GetRequest(t, "access."+l.RID).RespondSuccess(json.RawMessage(`{"get":true}`))
+			mreqs.GetRequest(t, "get."+l.RID).RespondSuccess(json.RawMessage(l.GetResponse))
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(l.ExpectedResult))
+			s.AssertNoErrorsLogged(t)
+		}, withResourceSizeLimits(2, 2))
+	}
+}
+
+// Test that a reset get response exceeding the resource size limits leaves
+// the cached resource unchanged.
+func TestResourceSizeLimit_ResetExceedingLimit_KeepsCachedResource(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		mreqs := s.GetParallelRequests(t, 2)
+		mreqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		mreqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":{"a":1}}`))
+		creq.GetResponse(t)
+
+		s.SystemEvent("reset", json.RawMessage(`{"resources":["test.model"]}`))
+		s.GetRequest(t).
+			AssertSubject(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":{"a":1,"b":2,"c":3}}`))
+		c.AssertNoEvent(t, "test.model")
+		s.AssertErrorsLogged(t, 2)
+
+		// Change event is sent as the cached model has no b field
+		s.ResourceEvent("test.model", "change", json.RawMessage(`{"values":{"b":2}}`))
+		c.GetEvent(t).Equals(t, "test.model.change", json.RawMessage(`{"values":{"b":2}}`))
+	}, withResourceSizeLimits(2, 2))
+}
@@ -0,0 +1,101 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+func withSystemEvents(cfg *server.Config) {
+	cfg.SystemEvents = true
+}
+
+// Test that system.resgate.subscribe is published once when many clients
+// subscribe to a resource, and that system.resgate.unsubscribe is published
+// once the last client unsubscribes.
+func TestSystemSubscriptionEvent_ManySubscribers_PublishedOncePerLifecycle(t *testing.T) {
+	const n = 5
+	model := resources["test.model"].data
+	runTest(t, func(s *Session) {
+		conns := make([]*Conn, n)
+		creqs := make([]*ClientRequest, n)
+		for i := range conns {
+			conns[i] = s.Connect()
+			creqs[i] = conns[i].Request("subscribe.test.model", nil)
+		}
+
+		// Validate a single subscribe message, and a single get request
+		reqs := s.GetParallelRequests(t, n+2)
+		count := 0
+		for _, req := range reqs {
+			switch req.Subject {
+			case "system.resgate.subscribe":
+				req.AssertPayload(t, json.RawMessage(`{"rid":"test.model"}`))
+				count++
+			case "access.test.model":
+				req.RespondSuccess(json.RawMessage(`{"get":true}`))
+			case "get.test.model":
+				req.RespondSuccess(json.RawMessage(`{"model":` + model + `}`))
+			default:
+				t.Fatalf("expected no request on subject %#v", req.Subject)
+			}
+		}
+		if count != 1 {
+			t.Fatalf("expected 1 system.resgate.subscribe message, but got %d", count)
+		}
+		for _, creq := range creqs {
+			creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":`+model+`}}`))
+		}
+
+		// Unsubscribe all clients
+		for _, c := range conns {
+			c.Request("unsubscribe.test.model", nil).GetResponse(t)
+		}
+		s.GetRequest(t).Equals(t, "system.resgate.unsubscribe", json.RawMessage(`{"rid":"test.model"}`))
+	}, withSystemEvents)
+}
+
+// Test that system.resgate.subscribe is published again when a resource is
+// subscribed to after the last subscriber has left.
+func TestSystemSubscriptionEvent_Resubscribe_PublishesSubscribeAgain(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		reqs := s.GetParallelRequests(t, 3)
+		reqs.GetRequest(t, "system.resgate.subscribe").AssertPayload(t, json.RawMessage(`{"rid":"test.model"}`))
+		reqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		reqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + resources["test.model"].data + `}`))
+		creq.GetResponse(t)
+
+		c.Request("unsubscribe.test.model", nil).GetResponse(t)
+		s.GetRequest(t).Equals(t, "system.resgate.unsubscribe", json.RawMessage(`{"rid":"test.model"}`))
+
+		// Resubscribe while the resource is still cached
+		creq = c.Request("subscribe.test.model", nil)
+		reqs = s.GetParallelRequests(t, 2)
+		reqs.GetRequest(t, "system.resgate.subscribe").AssertPayload(t, json.RawMessage(`{"rid":"test.model"}`))
+		reqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t)
+	}, withSystemEvents)
+}
+
+// Test that a call request on a resource without subscribers publishes no
+// system.resgate.subscribe or system.resgate.unsubscribe message, even though
+// the access and call requests are pending on the resource.
+func TestSystemSubscriptionEvent_CallRequest_PublishesNothing(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("call.test.model.method", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			RespondSuccess(json.RawMessage(`{"get":true,"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.method").
+			RespondSuccess(json.RawMessage(`{"foo":"bar"}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"payload":{"foo":"bar"}}`))
+
+		// Validate no system message precedes the flushing auth request
+		c.AssertNoNATSRequest(t, "test.model")
+	}, withSystemEvents)
+}
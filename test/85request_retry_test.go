@@ -0,0 +1,96 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/reserr"
+)
+
+func withRequestRetry(attempts, backoff, deadline int) func(*server.Config) {
+	return func(cfg *server.Config) {
+		cfg.RequestRetryAttempts = attempts
+		cfg.RequestRetryBackoff = backoff
+		cfg.RequestRetryDeadline = deadline
+	}
+}
+
+// Test that a get request that times out is retried, and that the client
+// gets the resource from the response to the retry.
+func TestRequestRetry_GetTimeout_RetriesRequest(t *testing.T) {
+	model := resources["test.model"].data
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		reqs := s.GetParallelRequests(t, 2)
+		reqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		reqs.GetRequest(t, "get.test.model").Timeout()
+
+		s.GetRequest(t).AssertSubject(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + model + `}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":`+model+`}}`))
+		s.AssertNATSRequestCount(t, "get.test.model", 2)
+	}, withRequestRetry(1, 10, 0))
+}
+
+// Test that an access request that times out is retried, and that the
+// client gets the resource once access is granted by the retry.
+func TestRequestRetry_AccessTimeout_RetriesRequest(t *testing.T) {
+	model := resources["test.model"].data
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		reqs := s.GetParallelRequests(t, 2)
+		reqs.GetRequest(t, "get.test.model").RespondSuccess(json.RawMessage(`{"model":` + model + `}`))
+		reqs.GetRequest(t, "access.test.model").Timeout()
+
+		s.GetRequest(t).AssertSubject(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		creq.GetResponse(t).AssertResult(t, json.RawMessage(`{"models":{"test.model":`+model+`}}`))
+		s.AssertNATSRequestCount(t, "access.test.model", 2)
+	}, withRequestRetry(1, 10, 0))
+}
+
+// Test that the timeout error is sent to the client once all retries of a
+// get request have timed out.
+func TestRequestRetry_AllAttemptsTimeout_RespondsTimeout(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		reqs := s.GetParallelRequests(t, 2)
+		reqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		reqs.GetRequest(t, "get.test.model").Timeout()
+		s.GetRequest(t).AssertSubject(t, "get.test.model").Timeout()
+		s.GetRequest(t).AssertSubject(t, "get.test.model").Timeout()
+
+		creq.GetResponse(t).AssertErrorCode(t, reserr.CodeTimeout)
+		s.AssertNATSRequestCount(t, "get.test.model", 3)
+	}, withRequestRetry(2, 10, 0))
+}
+
+// Test that a get request is not retried if the backoff would exceed the
+// retry deadline.
+func TestRequestRetry_DeadlineExceeded_RespondsTimeout(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("subscribe.test.model", nil)
+		reqs := s.GetParallelRequests(t, 2)
+		reqs.GetRequest(t, "access.test.model").RespondSuccess(json.RawMessage(`{"get":true}`))
+		reqs.GetRequest(t, "get.test.model").Timeout()
+
+		creq.GetResponse(t).AssertErrorCode(t, reserr.CodeTimeout)
+		s.AssertNATSRequestCount(t, "get.test.model", 1)
+	}, withRequestRetry(1, 100, 50))
+}
+
+// Test that a call request that times out is never retried.
+func TestRequestRetry_CallTimeout_NotRetried(t *testing.T) {
+	runTest(t, func(s *Session) {
+		c := s.Connect()
+		creq := c.Request("call.test.model.method", nil)
+		s.GetRequest(t).AssertSubject(t, "access.test.model").RespondSuccess(json.RawMessage(`{"call":"*"}`))
+		s.GetRequest(t).AssertSubject(t, "call.test.model.method").Timeout()
+
+		creq.GetResponse(t).AssertErrorCode(t, reserr.CodeTimeout)
+		s.AssertNATSRequestCount(t, "call.test.model.method", 1)
+	}, withRequestRetry(1, 10, 0))
+}
@@ -0,0 +1,88 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+func withAPIInfo(cfg *server.Config) {
+	cfg.APIInfo = true
+}
+
+// Test that the API info endpoint responds with the API info, using a stable
+// format.
+func TestAPIInfo_Enabled_RespondsWithAPIInfo(t *testing.T) {
+	put := "set"
+	del := "delete"
+	tbl := []struct {
+		Name     string
+		Config   func(*server.Config)
+		Expected string
+	}{
+		{"default", withAPIInfo, `{"protocol":"` + server.ProtocolVersion + `","apiPath":"/api/","wsPath":"/","apiEncoding":"json","verbs":[{"verb":"GET","action":"get"},{"verb":"HEAD","action":"get"},{"verb":"POST","action":"call"}]}`},
+		{"with method mappings", func(cfg *server.Config) {
+			cfg.APIInfo = true
+			cfg.PUTMethod = &put
+			cfg.DELETEMethod = &del
+		}, `{"protocol":"` + server.ProtocolVersion + `","apiPath":"/api/","wsPath":"/","apiEncoding":"json","verbs":[{"verb":"GET","action":"get"},{"verb":"HEAD","action":"get"},{"verb":"POST","action":"call"},{"verb":"PUT","action":"call","method":"set"},{"verb":"DELETE","action":"call","method":"delete"}]}`},
+		{"with public path prefix", func(cfg *server.Config) {
+			cfg.APIInfo = true
+			cfg.PublicPathPrefix = "/gateway"
+			cfg.APIEncoding = "jsonflat"
+		}, `{"protocol":"` + server.ProtocolVersion + `","apiPath":"/gateway/api/","wsPath":"/","apiEncoding":"jsonflat","verbs":[{"verb":"GET","action":"get"},{"verb":"HEAD","action":"get"},{"verb":"POST","action":"call"}]}`},
+	}
+
+	for _, l := range tbl {
+		l := l
+		runNamedTest(t, l.Name, func(s *Session) {
+			s.HTTPRequest("GET", "/api-info", nil).
+				GetResponse(t).
+				AssertStatusCode(t, http.StatusOK).
+				AssertHeaders(t, map[string]string{"Content-Type": "application/json; charset=utf-8"}).
+				AssertBody(t, []byte(l.Expected))
+		}, l.Config)
+	}
+}
+
+// Test that the API info includes no secrets from the configuration.
+func TestAPIInfo_WithSecrets_ExcludesSecrets(t *testing.T) {
+	runTest(t, func(s *Session) {
+		hresp := s.HTTPRequest("GET", "/api-info", nil).
+			GetResponse(t).
+			AssertStatusCode(t, http.StatusOK)
+		var info map[string]interface{}
+		if err := json.Unmarshal(hresp.Body.Bytes(), &info); err != nil {
+			t.Fatalf("expected a JSON object, but got %s", hresp.Body.String())
+		}
+		for _, secret := range []string{testAdminToken, "inspectsecret"} {
+			if strings.Contains(hresp.Body.String(), secret) {
+				t.Errorf("expected API info not to contain %#v, but got %s", secret, hresp.Body.String())
+			}
+		}
+	}, withAPIInfo, withAdminToken, func(cfg *server.Config) {
+		cfg.CacheInspectSecret = "inspectsecret"
+	})
+}
+
+// Test that the API info endpoint only accepts GET and HEAD requests.
+func TestAPIInfo_InvalidMethod_RespondsMethodNotAllowed(t *testing.T) {
+	runTest(t, func(s *Session) {
+		s.HTTPRequest("POST", "/api-info", nil).
+			GetResponse(t).
+			AssertStatusCode(t, http.StatusMethodNotAllowed).
+			AssertHeaders(t, map[string]string{"Allow": "GET, HEAD, OPTIONS"})
+	}, withAPIInfo)
+}
+
+// Test that the API info endpoint is not found when disabled.
+func TestAPIInfo_Disabled_RespondsNotFound(t *testing.T) {
+	runTest(t, func(s *Session) {
+		s.HTTPRequest("GET", "/api-info", nil).
+			GetResponse(t).
+			AssertStatusCode(t, http.StatusNotFound)
+	})
+}
@@ -0,0 +1,125 @@
+package test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/resgateio/resgate/server"
+)
+
+// jwtTestKey generates an RSA key, and returns it together with a config
+// function setting jwtAuth to validate JWTs with its public key.
+func jwtTestKey(t *testing.T) (*rsa.PrivateKey, func(*server.Config)) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return key, func(cfg *server.Config) {
+		cfg.JWTAuth = &server.JWTAuth{
+			PublicKeyFile: path,
+			Issuer:        "https://issuer.example.com",
+			Audience:      "resgate",
+		}
+	}
+}
+
+// signJWT returns an RS256 JWT with the claims, signed with the key.
+func signJWT(t *testing.T, key *rsa.PrivateKey, claims string) string {
+	signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(claims))
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// Test that the claims of a valid JWT in the Authorization header of the
+// WebSocket upgrade request are used as connection token, without any auth
+// request.
+func TestJWTAuth_ValidToken_SetsClaimsAsToken(t *testing.T) {
+	key, cfg := jwtTestKey(t)
+	claims := `{"iss":"https://issuer.example.com","aud":"resgate","sub":"user1"}`
+	runTest(t, func(s *Session) {
+		c := s.ConnectWithHeader(http.Header{"Authorization": {"Bearer " + signJWT(t, key, claims)}})
+
+		creq := c.Request("call.test.model.method", nil)
+		s.GetRequest(t).
+			AssertSubject(t, "access.test.model").
+			AssertPathPayload(t, "token", json.RawMessage(claims)).
+			RespondSuccess(json.RawMessage(`{"call":"*"}`))
+		s.GetRequest(t).
+			AssertSubject(t, "call.test.model.method").
+			AssertPathPayload(t, "token", json.RawMessage(claims)).
+			RespondSuccess(nil)
+		creq.GetResponse(t)
+	}, cfg)
+}
+
+// Test that an invalid or expired JWT results in no token, without failing
+// the connection.
+func TestJWTAuth_InvalidToken_SetsNoToken(t *testing.T) {
+	key, cfg := jwtTestKey(t)
+	tbl := []struct {
+		Name   string
+		Claims string
+	}{
+		{"expired", `{"iss":"https://issuer.example.com","aud":"resgate","exp":1000000000}`},
+		{"wrong issuer", `{"iss":"https://other.example.com","aud":"resgate"}`},
+		{"wrong audience", `{"iss":"https://issuer.example.com","aud":"other"}`},
+	}
+
+	for _, l := range tbl {
+		l := l
+		runNamedTest(t, l.Name, func(s *Session) {
+			c := s.ConnectWithHeader(http.Header{"Authorization": {"Bearer " + signJWT(t, key, l.Claims)}})
+
+			creq := c.Request("call.test.model.method", nil)
+			s.GetRequest(t).
+				AssertSubject(t, "access.test.model").
+				AssertPathPayload(t, "token", nil).
+				RespondSuccess(json.RawMessage(`{"call":"*"}`))
+			s.GetRequest(t).
+				AssertSubject(t, "call.test.model.method").
+				RespondSuccess(nil)
+			creq.GetResponse(t)
+		}, cfg)
+	}
+}
+
+// Test that the claims of a valid JWT in the Authorization header of an HTTP
+// request are used as token for the request.
+func TestJWTAuth_HTTPRequest_SetsClaimsAsToken(t *testing.T) {
+	key, cfg := jwtTestKey(t)
+	claims := `{"iss":"https://issuer.example.com","aud":"resgate","sub":"user1"}`
+	model := resources["test.model"].data
+	runTest(t, func(s *Session) {
+		hreq := s.HTTPRequest("GET", "/api/test/model", nil, withAuthorization("Bearer "+signJWT(t, key, claims)))
+
+		reqs := s.GetParallelRequests(t, 2)
+		reqs.GetRequest(t, "access.test.model").
+			AssertPathPayload(t, "token", json.RawMessage(claims)).
+			RespondSuccess(json.RawMessage(`{"get":true}`))
+		reqs.GetRequest(t, "get.test.model").
+			RespondSuccess(json.RawMessage(`{"model":` + model + `}`))
+		hreq.GetResponse(t).Equals(t, http.StatusOK, json.RawMessage(model))
+	}, cfg)
+}
@@ -6,7 +6,7 @@ import (
 )
 
 func BenchmarkCallRequestWithNilParamsOnSubscribedModel(b *testing.B) {
-	s := setup(nil)
+	s := setup(nil, nil)
 	c := s.Connect()
 
 	model := resourceData("test.model")
@@ -35,7 +35,7 @@ func BenchmarkCallRequestWithNilParamsOnSubscribedModel(b *testing.B) {
 }
 
 func BenchmarkCallRequestWithNilParamsOnSubscribedModelParallel(b *testing.B) {
-	s := setup(nil)
+	s := setup(nil, nil)
 	c := s.Connect()
 
 	model := resourceData("test.model")
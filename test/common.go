@@ -3,6 +3,9 @@ package test
 import (
 	"encoding/json"
 	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 type commonData struct{}
@@ -221,3 +224,12 @@ func subscribeToQueryResource(t *testing.T, s *Session, c *Conn, rid, q, normq s
 	}
 	return cid
 }
+
+// counterValue returns the current value of a prometheus counter.
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatalf("error reading counter: %s", err)
+	}
+	return m.GetCounter().GetValue()
+}
@@ -0,0 +1,110 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// goldenDir is the directory containing the golden files.
+const goldenDir = "testdata/golden"
+
+var updateGolden = flag.Bool("update", false, "update golden files with the client visible messages produced by the tests")
+
+// Golden records client visible messages for comparison with a golden file.
+// Messages are recorded with the object keys sorted, as some encodings write
+// map values in random order.
+type Golden struct {
+	b bytes.Buffer
+}
+
+// Response records a response to a client request.
+func (g *Golden) Response(cr *ClientResponse) *Golden {
+	return g.write("response", cr.Raw)
+}
+
+// Event records an event sent to the client.
+func (g *Golden) Event(ev *ClientEvent) *Golden {
+	return g.write("event", ev.Raw)
+}
+
+// HTTP records the status code, content type, and body of an HTTP response.
+func (g *Golden) HTTP(hr *HTTPResponse) *Golden {
+	label := fmt.Sprintf("http %d %s", hr.Code, hr.Header().Get("Content-Type"))
+	return g.write(strings.TrimSpace(label), hr.Body.Bytes())
+}
+
+func (g *Golden) write(label string, raw []byte) *Golden {
+	g.b.WriteString(label)
+	g.b.WriteString(": ")
+	g.b.Write(canonicalJSON(raw))
+	g.b.WriteByte('\n')
+	return g
+}
+
+// canonicalJSON returns the raw JSON with object keys sorted, and without any
+// insignificant whitespace. If raw is not valid JSON, it is returned as is.
+func canonicalJSON(raw []byte) []byte {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return raw
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return raw
+	}
+	return bytes.TrimRight(b.Bytes(), "\n")
+}
+
+// Assert asserts that the recorded messages equals the content of the golden
+// file with the given name. If the -update flag is set, the golden file is
+// written instead.
+func (g *Golden) Assert(t *testing.T, name string) {
+	path := filepath.Join(goldenDir, name+".golden")
+	got := g.b.Bytes()
+
+	if *updateGolden {
+		if err := os.MkdirAll(goldenDir, 0755); err != nil {
+			t.Fatalf("error creating golden directory: %s", err)
+		}
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("error writing golden file %s: %s", path, err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading golden file %s: %s\nrun the test with -update to create it", path, err)
+	}
+	if bytes.Equal(expected, got) {
+		return
+	}
+
+	el := strings.Split(string(expected), "\n")
+	gl := strings.Split(string(got), "\n")
+	for i := 0; i < len(el) || i < len(gl); i++ {
+		var e, g string
+		if i < len(el) {
+			e = el[i]
+		}
+		if i < len(gl) {
+			g = gl[i]
+		}
+		if e != g {
+			t.Fatalf("client visible messages differ from golden file %s at line %d:\nexpected:\n%s\nbut got:\n%s\n\n"+
+				"if the format change is intended, update the golden files by running:\n\tgo test ./test -run %s -update",
+				path, i+1, e, g, t.Name())
+		}
+	}
+}
@@ -19,13 +19,28 @@ import (
 type HTTPRequest struct {
 	ch  chan *HTTPResponse
 	req *http.Request
-	rr  *httptest.ResponseRecorder
+	rr  *flushRecorder
 }
 
 // HTTPResponse represents a response received from a HTTP request
 // made to the gateway
 type HTTPResponse struct {
 	*httptest.ResponseRecorder
+	// Flushes holds the length of the body at each flush.
+	Flushes []int
+}
+
+// flushRecorder is a httptest.ResponseRecorder that records the length of
+// the body at each flush.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes []int
+}
+
+// Flush records the length of the body before flushing.
+func (fr *flushRecorder) Flush() {
+	fr.flushes = append(fr.flushes, fr.Body.Len())
+	fr.ResponseRecorder.Flush()
 }
 
 // GetResponse awaits for a response and returns it.
@@ -29,6 +29,7 @@ type Request struct {
 	Subject    string
 	RawPayload []byte
 	Payload    interface{}
+	Header     map[string][]string
 	c          *NATSTestClient
 	cb         mq.Response
 }
@@ -37,9 +38,15 @@ type Request struct {
 type NATSTestClient struct {
 	l         logger.Logger
 	subs      map[string]*Subscription
+	reqSubs   map[string]mq.RequestHandler
 	reqs      chan *Request
 	connected bool
 	mu        sync.Mutex
+
+	disconnectHandler func()
+	reconnectHandler  func()
+
+	reqCounts map[string]int // Number of requests sent by subject
 }
 
 // ParallelRequests holds multiple requests in undetermined order
@@ -83,6 +90,7 @@ func (c *NATSTestClient) Connect() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.subs = make(map[string]*Subscription)
+	c.reqSubs = make(map[string]mq.RequestHandler)
 	c.reqs = make(chan *Request, 256)
 	c.connected = true
 	return nil
@@ -130,11 +138,16 @@ func (c *NATSTestClient) SendRequest(subj string, payload []byte, cb mq.Response
 		Subject:    subj,
 		RawPayload: payload,
 		Payload:    p,
+		Header:     requestHeaders,
 		c:          c,
 		cb:         cb,
 	}
 
 	c.Tracef("<== %s: %s", subj, payload)
+	if c.reqCounts == nil {
+		c.reqCounts = make(map[string]int)
+	}
+	c.reqCounts[subj]++
 	if c.connected {
 		c.reqs <- r
 	} else {
@@ -142,6 +155,32 @@ func (c *NATSTestClient) SendRequest(subj string, payload []byte, cb mq.Response
 	}
 }
 
+// Publish sends a message on a subject. The message is passed on as a request
+// without response callback, to let tests assert published messages in the
+// same way as requests.
+func (c *NATSTestClient) Publish(subj string, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var p interface{}
+	err := json.Unmarshal(payload, &p)
+	if err != nil {
+		panic("test: error unmarshaling published payload: " + err.Error())
+	}
+
+	c.Tracef("<=P %s: %s", subj, payload)
+	if !c.connected {
+		return nats.ErrConnectionClosed
+	}
+	c.reqs <- &Request{
+		Subject:    subj,
+		RawPayload: payload,
+		Payload:    p,
+		c:          c,
+	}
+	return nil
+}
+
 // Subscribe to all events on a resource namespace.
 // The namespace has the format "event."+resource
 func (c *NATSTestClient) Subscribe(namespace string, cb mq.Response) (mq.Unsubscriber, error) {
@@ -163,11 +202,93 @@ func (c *NATSTestClient) Subscribe(namespace string, cb mq.Response) (mq.Unsubsc
 	return s, nil
 }
 
+// SubscribeRequests subscribes to requests on a subject. The subscription is
+// not included in HasSubscriptions, and remains until the client is closed.
+func (c *NATSTestClient) SubscribeRequests(subject string, cb mq.RequestHandler) (mq.Unsubscriber, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.reqSubs[subject]; ok {
+		panic("test: request subscription for " + subject + " already exists")
+	}
+	c.reqSubs[subject] = cb
+	c.Tracef("<=S %s", subject)
+	return requestSubscription{}, nil
+}
+
+type requestSubscription struct{}
+
+func (requestSubscription) Unsubscribe() error { return nil }
+
+// ServiceRequest sends a request to resgate on a subject with a reply subject,
+// as if sent by a service. Any response is published on the reply subject.
+// It panics if there is no request subscription for the subject.
+func (c *NATSTestClient) ServiceRequest(subj string, reply string, payload interface{}) {
+	c.mu.Lock()
+	cb, ok := c.reqSubs[subj]
+	c.mu.Unlock()
+	if !ok {
+		panic("test: no request subscription for " + subj)
+	}
+
+	data, ok := payload.([]byte)
+	if !ok {
+		var err error
+		data, err = json.Marshal(payload)
+		if err != nil {
+			panic("test: error marshaling request: " + err.Error())
+		}
+	}
+
+	c.Tracef("=>R %s: %s", subj, data)
+	cb(subj, reply, data)
+}
+
 // SetClosedHandler sets the handler when the connection is closed
 func (c *NATSTestClient) SetClosedHandler(_ func(error)) {
 	// Does nothing
 }
 
+// SetReconnectHandler sets the handler called by Reconnect.
+func (c *NATSTestClient) SetReconnectHandler(cb func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reconnectHandler = cb
+}
+
+// SetDisconnectHandler sets the handler called by Disconnect.
+func (c *NATSTestClient) SetDisconnectHandler(cb func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.disconnectHandler = cb
+}
+
+// Disconnect simulates a lost connection, about to be reestablished, by
+// calling the disconnect handler.
+func (c *NATSTestClient) Disconnect() {
+	c.mu.Lock()
+	cb := c.disconnectHandler
+	c.mu.Unlock()
+	if cb == nil {
+		panic("test: no disconnect handler set")
+	}
+	c.Tracef("<=> Disconnected")
+	cb()
+}
+
+// Reconnect simulates a lost connection being reestablished, keeping all
+// subscriptions, by calling the reconnect handler.
+func (c *NATSTestClient) Reconnect() {
+	c.mu.Lock()
+	cb := c.reconnectHandler
+	c.mu.Unlock()
+	if cb == nil {
+		panic("test: no reconnect handler set")
+	}
+	c.Tracef("<=> Reconnected")
+	cb()
+}
+
 // HasSubscriptions asserts that there is a subscription for the given resource IDs
 func (c *NATSTestClient) HasSubscriptions(t *testing.T, rids ...string) {
 	c.mu.Lock()
@@ -212,24 +333,32 @@ func (c *NATSTestClient) NoSubscriptions(t *testing.T, rids ...string) {
 // ResourceEvent sends a resource event to resgate. The subject will be "event."+rid+"."+event .
 // It panics if there is no subscription for such event.
 func (c *NATSTestClient) ResourceEvent(rid string, event string, payload interface{}) {
-	c.event("event."+rid, event, payload)
+	c.event("event."+rid, event, payload, nil)
+}
+
+// ResourceEventWithHeaders sends a resource event with message headers to
+// resgate. The subject will be "event."+rid+"."+event .
+// It panics if there is no subscription for such event.
+func (c *NATSTestClient) ResourceEventWithHeaders(rid string, event string, payload interface{}, h map[string][]string) {
+	c.event("event."+rid, event, payload, h)
 }
 
 // ConnEvent sends a connection event to resgate. The subject will be "conn."+cid+"."+event .
 // It panics if there is no subscription for such event.
 func (c *NATSTestClient) ConnEvent(cid string, event string, payload interface{}) {
-	c.event("conn."+cid, event, payload)
+	c.event("conn."+cid, event, payload, nil)
 }
 
 // SystemEvent sends a system event to resgate. The subject will be "system."+event .
 // It panics if there is no subscription for such event.
 func (c *NATSTestClient) SystemEvent(event string, payload interface{}) {
-	c.event("system", event, payload)
+	c.event("system", event, payload, nil)
 }
 
-// event sends an event to resgate. The subject will be ns+"."+event .
+// event sends an event with message headers h to resgate. The subject will be
+// ns+"."+event .
 // It panics if there is no subscription for such event.
-func (c *NATSTestClient) event(ns string, event string, payload interface{}) {
+func (c *NATSTestClient) event(ns string, event string, payload interface{}, h map[string][]string) {
 	c.mu.Lock()
 
 	s, ok := c.subs[ns]
@@ -251,7 +380,7 @@ func (c *NATSTestClient) event(ns string, event string, payload interface{}) {
 	c.mu.Unlock()
 	subj := ns + "." + event
 	c.Tracef("=>> %s: %s", subj, data)
-	s.cb(subj, data, nil, nil)
+	s.cb(subj, data, h, nil)
 }
 
 // Unsubscribe removes the subscription.
@@ -290,6 +419,13 @@ func (c *NATSTestClient) GetRequest(t *testing.T) *Request {
 	return nil
 }
 
+// requestCount returns the number of requests sent on a subject.
+func (c *NATSTestClient) requestCount(subj string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reqCounts[subj]
+}
+
 // GetParallelRequests gets n number of requests where the order is uncertain.
 func (c *NATSTestClient) GetParallelRequests(t *testing.T, n int) ParallelRequests {
 	pr := make(ParallelRequests, n)
@@ -383,6 +519,19 @@ func (r *Request) AssertSubject(t *testing.T, subject string) *Request {
 	return r
 }
 
+// AssertHeader asserts that the request has a header with the expected
+// value. An empty value asserts that the header is missing.
+func (r *Request) AssertHeader(t *testing.T, key string, value string) *Request {
+	var v string
+	if h := r.Header[key]; len(h) > 0 {
+		v = h[0]
+	}
+	if v != value {
+		t.Fatalf("expected request header %#v to be %#v, but got %#v", key, value, v)
+	}
+	return r
+}
+
 // AssertPayload asserts that the request has the expected payload
 func (r *Request) AssertPayload(t *testing.T, payload interface{}) *Request {
 	var err error
@@ -453,6 +602,9 @@ func (r *Request) PathPayload(t *testing.T, path string) interface{} {
 		if v.Kind() == reflect.Interface {
 			v = v.Elem()
 		}
+		if !v.IsValid() {
+			t.Fatalf("expected to find path %#v, but part %#v is null", path, part)
+		}
 		typ := v.Type()
 		if typ.Kind() != reflect.Map {
 			t.Fatalf("expected to find path %#v, but part %#v is of type %s", path, part, typ)
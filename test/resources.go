@@ -9,11 +9,15 @@ import (
 type mockData struct {
 	UnsubscribeReasonAccessDenied json.RawMessage
 	UnsubscribeReasonDeleted      json.RawMessage
+	UnsubscribeReasonExpired      json.RawMessage
+	UnsubscribeReasonTypeMismatch json.RawMessage
 }
 
 var mock = mockData{
 	UnsubscribeReasonAccessDenied: json.RawMessage(`{"reason":{"code":"system.accessDenied","message":"Access denied"}}`),
 	UnsubscribeReasonDeleted:      json.RawMessage(`{"reason":{"code":"system.deleted","message":"Deleted"}}`),
+	UnsubscribeReasonExpired:      json.RawMessage(`{"reason":{"code":"system.sessionExpired","message":"Session expired"}}`),
+	UnsubscribeReasonTypeMismatch: json.RawMessage(`{"reason":{"code":"system.internalError","message":"Internal error: resource type changed by service"}}`),
 }
 
 // The following cyclic groups exist
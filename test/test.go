@@ -11,6 +11,7 @@ import (
 
 	"github.com/posener/wstest"
 	"github.com/resgateio/resgate/server"
+	"github.com/resgateio/resgate/server/rescache"
 )
 
 const timeoutSeconds = 1
@@ -30,7 +31,7 @@ type Session struct {
 	*CountLogger
 }
 
-func setup(t *testing.T, cfgs ...func(*server.Config)) *Session {
+func setup(t *testing.T, sfn func(*server.Service), cfgs ...func(*server.Config)) *Session {
 	l := NewCountLogger(true, true)
 
 	c := NewNATSTestClient(l)
@@ -39,6 +40,9 @@ func setup(t *testing.T, cfgs ...func(*server.Config)) *Session {
 		t.Fatalf("error creating new service: %s", err)
 	}
 	serv.SetLogger(l)
+	if sfn != nil {
+		sfn(serv)
+	}
 
 	s := &Session{
 		t:              t,
@@ -125,7 +129,7 @@ func (s *Session) HTTPRequest(method, url string, body []byte, opts ...func(r *h
 	}
 
 	// Record the response into a httptest.ResponseRecorder
-	rr := httptest.NewRecorder()
+	rr := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
 
 	hr := &HTTPRequest{
 		req: req,
@@ -137,12 +141,59 @@ func (s *Session) HTTPRequest(method, url string, body []byte, opts ...func(r *h
 		s.Tracef("H-> %s %s: %s", method, url, body)
 		s.s.ServeHTTP(rr, req)
 		s.Tracef("<-H %s %s: (%d) %s", method, url, rr.Code, rr.Body.String())
-		hr.ch <- &HTTPResponse{ResponseRecorder: rr}
+		hr.ch <- &HTTPResponse{ResponseRecorder: rr.ResponseRecorder, Flushes: rr.flushes}
 	}()
 
 	return hr
 }
 
+// AssertSubscriptionCount asserts that the total number of subscriptions to
+// cached resources eventually equals n.
+func (s *Session) AssertSubscriptionCount(t *testing.T, n int) *Session {
+	s.assertCacheStats(t, "subscription count", n, func(st rescache.Stats) int { return st.Subscriptions })
+	return s
+}
+
+// AssertCacheSize asserts that the number of cached resources, including
+// query resources, eventually equals n.
+func (s *Session) AssertCacheSize(t *testing.T, n int) *Session {
+	s.assertCacheStats(t, "cache size", n, func(st rescache.Stats) int { return st.Resources })
+	return s
+}
+
+// AssertConnCount asserts that the number of connections not yet disposed
+// eventually equals n.
+func (s *Session) AssertConnCount(t *testing.T, n int) *Session {
+	s.assertCacheStats(t, "connection count", n, func(st rescache.Stats) int { return st.Conns })
+	return s
+}
+
+// AssertNATSRequestCount asserts that exactly n requests have been sent to
+// NATS on the subject since the session started.
+func (s *Session) AssertNATSRequestCount(t *testing.T, subject string, n int) *Session {
+	if v := s.requestCount(subject); v != n {
+		t.Fatalf("expected %d NATS request(s) on %#v, but got %d", n, subject, v)
+	}
+	return s
+}
+
+// assertCacheStats polls the cache statistics until the value returned by
+// get equals n, or fails the test on timeout. Polling is needed as the cache
+// is updated asynchronously.
+func (s *Session) assertCacheStats(t *testing.T, name string, n int, get func(rescache.Stats) int) {
+	deadline := time.Now().Add(timeoutSeconds * time.Second)
+	for {
+		v := get(s.s.CacheStats())
+		if v == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s to be %d, but got %d", name, n, v)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func teardown(s *Session) {
 	for conn := range s.conns {
 		err := conn.Error()
@@ -183,6 +234,12 @@ func runTest(t *testing.T, cb func(*Session), cfgs ...func(*server.Config)) {
 }
 
 func runNamedTest(t *testing.T, name string, cb func(*Session), cfgs ...func(*server.Config)) {
+	runServiceTest(t, name, nil, cb, cfgs...)
+}
+
+// runServiceTest runs a named test, calling sfn with the service before it is
+// started.
+func runServiceTest(t *testing.T, name string, sfn func(*server.Service), cb func(*Session), cfgs ...func(*server.Config)) {
 	var s *Session
 	panicked := true
 	defer func() {
@@ -194,7 +251,7 @@ func runNamedTest(t *testing.T, name string, cb func(*Session), cfgs ...func(*se
 		}
 	}()
 
-	s = setup(t, cfgs...)
+	s = setup(t, sfn, cfgs...)
 	cb(s)
 	teardown(s)
 
@@ -25,6 +25,8 @@ type Conn struct {
 	mu      sync.Mutex
 	closeCh chan struct{}
 	err     error
+	readErr error  // Error returned when reading, set before closeCh is closed
+	reqID   uint64 // Next request ID
 }
 
 type clientRequest struct {
@@ -41,8 +43,6 @@ type clientResponse struct {
 	Data   interface{}   `json:"data"`
 }
 
-var clientRequestID uint64
-
 // ClientRequest represents a RES-client request
 type ClientRequest struct {
 	Method string
@@ -55,12 +55,14 @@ type ClientRequest struct {
 type ClientResponse struct {
 	Result interface{}
 	Error  *reserr.Error
+	Raw    []byte // Message as received by the client
 }
 
 // ClientEvent represents a RES-client event sent to the client
 type ClientEvent struct {
 	Event string
 	Data  interface{}
+	Raw   []byte // Message as received by the client
 }
 
 // ParallelEvents holds multiple events in undetermined order
@@ -90,8 +92,10 @@ func (c *Conn) Request(method string, params interface{}) *ClientRequest {
 		panic(c.err)
 	}
 
-	id := clientRequestID
-	clientRequestID++
+	// Request IDs are sequential per connection, starting at 0, to keep
+	// client visible messages deterministic.
+	id := c.reqID
+	c.reqID++
 	err := c.ws.WriteJSON(clientRequest{
 		ID:     id,
 		Method: method,
@@ -199,6 +203,7 @@ func (c *Conn) listen() {
 Loop:
 	for {
 		if _, in, err = c.ws.ReadMessage(); err != nil {
+			c.readErr = err
 			break
 		}
 
@@ -215,6 +220,7 @@ Loop:
 			c.evs <- &ClientEvent{
 				Event: *cr.Event,
 				Data:  cr.Data,
+				Raw:   in,
 			}
 			c.mu.Unlock()
 		} else {
@@ -230,6 +236,7 @@ Loop:
 			case req.ch <- &ClientResponse{
 				Result: cr.Result,
 				Error:  cr.Error,
+				Raw:    in,
 			}:
 			default:
 				c.setError(err)
@@ -423,3 +430,19 @@ func (c *Conn) AssertClosed(t *testing.T) {
 		t.Fatal("expected the connection to be closed, but it was not")
 	}
 }
+
+// AssertClosedWithReason asserts that the connection is closed by a close
+// message with the given code and reason.
+func (c *Conn) AssertClosedWithReason(t *testing.T, code int, reason string) {
+	c.AssertClosed(t)
+	cerr, ok := c.readErr.(*websocket.CloseError)
+	if !ok {
+		t.Fatalf("expected the connection to be closed with a close message, but got error: %v", c.readErr)
+	}
+	if cerr.Code != code {
+		t.Errorf("expected close code to be %d, but got %d", code, cerr.Code)
+	}
+	if cerr.Text != reason {
+		t.Errorf("expected close reason to be %#v, but got %#v", reason, cerr.Text)
+	}
+}